@@ -24,8 +24,12 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"l3/bgp/config"
 	"l3/bgp/server"
+	"l3/ospf/ospfdCommonDefs"
 	"sync"
 )
 
@@ -81,3 +85,83 @@ func SendRouteNotification(add []*config.RouteInfo, remove []*config.RouteInfo)
 		Remove: remove,
 	}
 }
+
+/*  Send next hop reachability changes to server
+ */
+func SendNextHopNotification(ipAddr string, reachable bool) {
+	bgpapi.server.NextHopCh <- config.NextHopStateInfo{
+		IP:        ipAddr,
+		Reachable: reachable,
+	}
+}
+
+/*  Send link state database updates to server
+ */
+func SendLinkStateNotification(add []*config.LinkStateLsa, remove []*config.LinkStateLsa) {
+	bgpapi.server.LinkStateCh <- &config.LinkStateCh{
+		Add:    add,
+		Remove: remove,
+	}
+}
+
+/*  Send the full link state database to server, LSAs that are not in the list are removed
+ */
+func SendLinkStateSync(lsas []*config.LinkStateLsa) {
+	bgpapi.server.LinkStateCh <- &config.LinkStateCh{
+		Add:  lsas,
+		Sync: true,
+	}
+}
+
+/*  Decode the link state database notification published by ospfd and send it to server.
+ *  Used by the plugins that subscribe to the ospfd publisher socket.
+ */
+func SendOspfLinkStateNotification(rxBuf []byte) error {
+	msg := ospfdCommonDefs.OspfdNotifyMsg{}
+	err := json.Unmarshal(rxBuf, &msg)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Unmarshal OSPF notification failed with err %s", err))
+	}
+
+	lsaList := make([]ospfdCommonDefs.OspfdLsaInfo, 0)
+	err = json.Unmarshal(msg.MsgBuf, &lsaList)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Unmarshal OSPF LSA list failed with err %s", err))
+	}
+
+	lsas := make([]*config.LinkStateLsa, 0, len(lsaList))
+	for _, lsaInfo := range lsaList {
+		lsa := &config.LinkStateLsa{
+			AreaId:      lsaInfo.AreaId,
+			LSType:      lsaInfo.LSType,
+			LSId:        lsaInfo.LSId,
+			AdvRouter:   lsaInfo.AdvRouter,
+			BitE:        lsaInfo.BitE,
+			BitB:        lsaInfo.BitB,
+			Netmask:     lsaInfo.Netmask,
+			AttachedRtr: lsaInfo.AttachedRtr,
+			Links:       make([]config.LinkStateLink, 0, len(lsaInfo.Links)),
+		}
+		for _, link := range lsaInfo.Links {
+			lsa.Links = append(lsa.Links, config.LinkStateLink{
+				LinkId:   link.LinkId,
+				LinkData: link.LinkData,
+				LinkType: link.LinkType,
+				Metric:   link.Metric,
+			})
+		}
+		lsas = append(lsas, lsa)
+	}
+
+	switch msg.MsgType {
+	case ospfdCommonDefs.NOTIFY_LSA_ADD:
+		SendLinkStateNotification(lsas, nil)
+	case ospfdCommonDefs.NOTIFY_LSA_DEL:
+		SendLinkStateNotification(nil, lsas)
+	case ospfdCommonDefs.NOTIFY_LSA_SYNC:
+		SendLinkStateSync(lsas)
+	default:
+		return errors.New(fmt.Sprintf("Unknown OSPF notification type %d", msg.MsgType))
+	}
+	return nil
+}
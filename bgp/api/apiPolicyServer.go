@@ -24,6 +24,7 @@
 package api
 
 import (
+	"l3/bgp/config"
 	bgppolicy "l3/bgp/policy"
 	"sync"
 	utilspolicy "utils/policy"
@@ -65,6 +66,18 @@ func UpdatePolicyCondition(condition utilspolicy.PolicyConditionConfig) {
 	return
 }
 
+func AddBGPPolicyCondition(condition config.BGPPolicyCondition) {
+	bgppolicyapi.policyManager.BGPCondCfgCh <- condition
+}
+
+func AddASPathList(asPathList config.ASPathList) {
+	bgppolicyapi.policyManager.ASPathListCfgCh <- asPathList
+}
+
+func RemoveASPathList(name string) {
+	bgppolicyapi.policyManager.ASPathListDelCh <- name
+}
+
 func AddPolicyStmt(stmt utilspolicy.PolicyStmtConfig) {
 	bgppolicyapi.policyManager.StmtCfgCh <- stmt
 }
@@ -0,0 +1,125 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// keychain.go
+package auth
+
+import (
+	"l3/bgp/config"
+	"sync"
+	"time"
+)
+
+/*  KeyChain holds the keys of a named key chain. The keys are picked by their send and accept
+ *  lifetimes so the keys can be rolled over without resetting the sessions that use the chain.
+ */
+type KeyChain struct {
+	Name  string
+	mutex sync.RWMutex
+	keys  []config.AuthKey
+}
+
+func NewKeyChain(name string) *KeyChain {
+	return &KeyChain{
+		Name: name,
+		keys: make([]config.AuthKey, 0),
+	}
+}
+
+func isLifetimeActive(start, end time.Time, now time.Time) bool {
+	return (start.IsZero() || !now.Before(start)) && (end.IsZero() || now.Before(end))
+}
+
+func (k *KeyChain) SetKeys(keys []config.AuthKey) {
+	defer k.mutex.Unlock()
+	k.mutex.Lock()
+	k.keys = make([]config.AuthKey, len(keys))
+	copy(k.keys, keys)
+}
+
+func (k *KeyChain) GetKeys() []config.AuthKey {
+	defer k.mutex.RUnlock()
+	k.mutex.RLock()
+	keys := make([]config.AuthKey, len(k.keys))
+	copy(keys, k.keys)
+	return keys
+}
+
+/*
+ * GetSendKey returns the key used to sign the segments. If the send lifetimes of multiple keys overlap,
+ * the key with the latest send lifetime start is used.
+ */
+func (k *KeyChain) GetSendKey(now time.Time) (config.AuthKey, bool) {
+	defer k.mutex.RUnlock()
+	k.mutex.RLock()
+	var sendKey config.AuthKey
+	found := false
+	for _, key := range k.keys {
+		if !isLifetimeActive(key.SendLifetimeStart, key.SendLifetimeEnd, now) {
+			continue
+		}
+		if !found || key.SendLifetimeStart.After(sendKey.SendLifetimeStart) ||
+			(key.SendLifetimeStart.Equal(sendKey.SendLifetimeStart) && key.SendId > sendKey.SendId) {
+			sendKey = key
+			found = true
+		}
+	}
+	return sendKey, found
+}
+
+/*
+ * GetActiveKeys returns the keys that must be installed on the socket, the keys within their accept
+ * lifetime and the send key.
+ */
+func (k *KeyChain) GetActiveKeys(now time.Time) []config.AuthKey {
+	sendKey, sendKeyFound := k.GetSendKey(now)
+	defer k.mutex.RUnlock()
+	k.mutex.RLock()
+	keys := make([]config.AuthKey, 0)
+	for _, key := range k.keys {
+		if isLifetimeActive(key.AcceptLifetimeStart, key.AcceptLifetimeEnd, now) ||
+			(sendKeyFound && key.SendId == sendKey.SendId && key.RecvId == sendKey.RecvId) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+/*
+ * GetNextChange returns the time when the next send or accept lifetime of the keys starts or ends.
+ * The zero time is returned if none of the lifetimes change after now.
+ */
+func (k *KeyChain) GetNextChange(now time.Time) time.Time {
+	defer k.mutex.RUnlock()
+	k.mutex.RLock()
+	var next time.Time
+	for _, key := range k.keys {
+		for _, t := range []time.Time{key.SendLifetimeStart, key.SendLifetimeEnd, key.AcceptLifetimeStart,
+			key.AcceptLifetimeEnd} {
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	return next
+}
@@ -0,0 +1,166 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// server_test.go
+// keychain_test.go
+package auth
+
+import (
+	"l3/bgp/config"
+	"testing"
+	"time"
+)
+
+var testBase = time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func testTime(hours int) time.Time {
+	return testBase.Add(time.Duration(hours) * time.Hour)
+}
+
+/*  The keys are rolled over from key 1 to key 2 at hour 10, the accept lifetimes overlap the send
+ *  lifetimes by an hour on each side. Key 3 has no lifetime limits.
+ */
+func getTestKeyChain(withUnlimited bool) *KeyChain {
+	keys := []config.AuthKey{
+		{SendId: 1, RecvId: 1, SendLifetimeStart: testTime(0), SendLifetimeEnd: testTime(10),
+			AcceptLifetimeStart: testTime(-1), AcceptLifetimeEnd: testTime(11)},
+		{SendId: 2, RecvId: 2, SendLifetimeStart: testTime(10), SendLifetimeEnd: testTime(20),
+			AcceptLifetimeStart: testTime(9), AcceptLifetimeEnd: testTime(21)},
+	}
+	if withUnlimited {
+		keys = append(keys, config.AuthKey{SendId: 3, RecvId: 3})
+	}
+	chain := NewKeyChain("test")
+	chain.SetKeys(keys)
+	return chain
+}
+
+func TestGetSendKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		withUnlimited bool
+		now           time.Time
+		found         bool
+		sendId        uint8
+	}{
+		{"before the first send lifetime", false, testTime(-1), false, 0},
+		{"at the start of the first send lifetime", false, testTime(0), true, 1},
+		{"just before the roll over", false, testTime(10).Add(-time.Nanosecond), true, 1},
+		{"at the roll over", false, testTime(10), true, 2},
+		{"just before the end of the last send lifetime", false, testTime(20).Add(-time.Nanosecond), true, 2},
+		{"at the end of the last send lifetime", false, testTime(20), false, 0},
+		{"unlimited key before the send lifetimes", true, testTime(-1), true, 3},
+		{"key with the latest start over the unlimited key", true, testTime(10), true, 2},
+		{"unlimited key after the send lifetimes", true, testTime(20), true, 3},
+	}
+
+	for _, test := range tests {
+		key, found := getTestKeyChain(test.withUnlimited).GetSendKey(test.now)
+		if found != test.found || (found && key.SendId != test.sendId) {
+			t.Errorf("%s: send key found %t id %d, expected found %t id %d", test.name, found, key.SendId,
+				test.found, test.sendId)
+		}
+	}
+}
+
+func TestGetSendKeySameStart(t *testing.T) {
+	chain := NewKeyChain("test")
+	chain.SetKeys([]config.AuthKey{
+		{SendId: 5, RecvId: 5, SendLifetimeStart: testTime(0)},
+		{SendId: 7, RecvId: 7, SendLifetimeStart: testTime(0)},
+		{SendId: 6, RecvId: 6, SendLifetimeStart: testTime(0)},
+	})
+	if key, found := chain.GetSendKey(testTime(1)); !found || key.SendId != 7 {
+		t.Error("Send key found", found, "id", key.SendId, "expected the highest send id 7")
+	}
+}
+
+func TestGetActiveKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected []uint8
+	}{
+		{"before the first accept lifetime", testTime(-2), []uint8{}},
+		{"at the start of the first accept lifetime", testTime(-1), []uint8{1}},
+		{"at the start of the second accept lifetime", testTime(9), []uint8{1, 2}},
+		{"at the roll over", testTime(10), []uint8{1, 2}},
+		{"at the end of the first accept lifetime", testTime(11), []uint8{2}},
+		{"after the send lifetimes", testTime(20), []uint8{2}},
+		{"at the end of the last accept lifetime", testTime(21), []uint8{}},
+	}
+
+	chain := getTestKeyChain(false)
+	for _, test := range tests {
+		keys := chain.GetActiveKeys(test.now)
+		ids := make([]uint8, 0, len(keys))
+		for _, key := range keys {
+			ids = append(ids, key.SendId)
+		}
+		if len(ids) != len(test.expected) {
+			t.Errorf("%s: active keys %v, expected %v", test.name, ids, test.expected)
+			continue
+		}
+		for idx := range ids {
+			if ids[idx] != test.expected[idx] {
+				t.Errorf("%s: active keys %v, expected %v", test.name, ids, test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestGetActiveKeysSendKeyNotAccepted(t *testing.T) {
+	// The send key is installed even when its accept lifetime ended
+	chain := NewKeyChain("test")
+	chain.SetKeys([]config.AuthKey{
+		{SendId: 1, RecvId: 1, SendLifetimeStart: testTime(0), AcceptLifetimeEnd: testTime(5)},
+	})
+	if keys := chain.GetActiveKeys(testTime(6)); len(keys) != 1 || keys[0].SendId != 1 {
+		t.Error("Active keys", keys, "expected the send key 1")
+	}
+}
+
+func TestGetNextChange(t *testing.T) {
+	tests := []struct {
+		name          string
+		withUnlimited bool
+		now           time.Time
+		expected      time.Time
+	}{
+		{"before all the lifetimes", false, testTime(-2), testTime(-1)},
+		{"at the start of an accept lifetime", false, testTime(-1), testTime(0)},
+		{"between the lifetime changes", false, testTime(5), testTime(9)},
+		{"at the roll over", false, testTime(10), testTime(11)},
+		{"at the end of the last send lifetime", false, testTime(20), testTime(21)},
+		{"at the end of the last accept lifetime", false, testTime(21), time.Time{}},
+		{"unlimited key does not change", true, testTime(21), time.Time{}},
+	}
+
+	for _, test := range tests {
+		next := getTestKeyChain(test.withUnlimited).GetNextChange(test.now)
+		if !next.Equal(test.expected) {
+			t.Errorf("%s: next change %s, expected %s", test.name, next, test.expected)
+		}
+	}
+}
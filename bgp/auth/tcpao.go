@@ -0,0 +1,298 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// tcpao.go
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"l3/bgp/config"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// TCP-AO socket options of the Linux kernel, RFC 5925
+const (
+	TCP_AO_ADD_KEY = 38
+	TCP_AO_DEL_KEY = 39
+	TCP_AO_INFO    = 40
+)
+
+const (
+	tcpAOSetCurrent uint32 = 1 << iota
+	tcpAOSetRNext
+)
+
+const TCPAOMaxKeyLen = 80
+const AuthKeyIdNone int32 = -1
+
+// Key chain algorithms and the names of the kernel crypto algorithms, RFC 5926
+var AlgorithmMap = map[string]string{
+	"hmac-sha-1":   "hmac(sha1)",
+	"aes-128-cmac": "cmac(aes128)",
+	"hmac-sha-256": "hmac(sha256)",
+}
+
+var AlgorithmMacLenMap = map[string]uint8{
+	"hmac-sha-1":   12,
+	"aes-128-cmac": 12,
+	"hmac-sha-256": 16,
+}
+
+type tcpAOAdd struct {
+	addr      [128]byte
+	algName   [64]byte
+	ifIndex   int32
+	flags     uint32
+	reserved2 uint16
+	prefix    uint8
+	sndId     uint8
+	rcvId     uint8
+	macLen    uint8
+	keyFlags  uint8
+	keyLen    uint8
+	key       [TCPAOMaxKeyLen]byte
+}
+
+type tcpAODel struct {
+	addr       [128]byte
+	ifIndex    int32
+	flags      uint32
+	reserved2  uint16
+	prefix     uint8
+	sndId      uint8
+	rcvId      uint8
+	currentKey uint8
+	rnext      uint8
+	keyFlags   uint8
+}
+
+type tcpAOInfo struct {
+	flags          uint32
+	reserved2      uint16
+	currentKey     uint8
+	rnext          uint8
+	pktGood        uint64
+	pktBad         uint64
+	pktKeyNotFound uint64
+	pktAORequired  uint64
+	pktDroppedICMP uint64
+}
+
+func ValidateKey(key config.AuthKey) error {
+	if _, ok := AlgorithmMap[key.Algorithm]; !ok {
+		return errors.New(fmt.Sprintf("Key %d algorithm %s is not supported", key.SendId, key.Algorithm))
+	}
+	if len(key.Secret) == 0 || len(key.Secret) > TCPAOMaxKeyLen {
+		return errors.New(fmt.Sprintf("Key %d secret length %d is not valid", key.SendId, len(key.Secret)))
+	}
+	return nil
+}
+
+func setSockAddr(addr *[128]byte, ip net.IP) uint8 {
+	if ip4 := ip.To4(); ip4 != nil {
+		sa := (*syscall.RawSockaddrInet4)(unsafe.Pointer(&addr[0]))
+		sa.Family = syscall.AF_INET
+		copy(sa.Addr[:], ip4)
+		return 32
+	}
+
+	sa := (*syscall.RawSockaddrInet6)(unsafe.Pointer(&addr[0]))
+	sa.Family = syscall.AF_INET6
+	copy(sa.Addr[:], ip.To16())
+	return 128
+}
+
+func setSockopt(fd int, opt int, val unsafe.Pointer, len uintptr) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd), uintptr(syscall.IPPROTO_TCP),
+		uintptr(opt), uintptr(val), len, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func addKey(fd int, ip net.IP, key config.AuthKey) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	opt := tcpAOAdd{
+		sndId:  key.SendId,
+		rcvId:  key.RecvId,
+		macLen: AlgorithmMacLenMap[key.Algorithm],
+		keyLen: uint8(len(key.Secret)),
+	}
+	opt.prefix = setSockAddr(&opt.addr, ip)
+	copy(opt.algName[:], AlgorithmMap[key.Algorithm])
+	copy(opt.key[:], key.Secret)
+	return setSockopt(fd, TCP_AO_ADD_KEY, unsafe.Pointer(&opt), unsafe.Sizeof(opt))
+}
+
+func delKey(fd int, ip net.IP, key config.AuthKey) error {
+	opt := tcpAODel{
+		sndId: key.SendId,
+		rcvId: key.RecvId,
+	}
+	opt.prefix = setSockAddr(&opt.addr, ip)
+	return setSockopt(fd, TCP_AO_DEL_KEY, unsafe.Pointer(&opt), unsafe.Sizeof(opt))
+}
+
+func setCurrentKey(fd int, key config.AuthKey) error {
+	opt := tcpAOInfo{
+		flags:      tcpAOSetCurrent | tcpAOSetRNext,
+		currentKey: key.SendId,
+		rnext:      key.RecvId,
+	}
+	return setSockopt(fd, TCP_AO_INFO, unsafe.Pointer(&opt), unsafe.Sizeof(opt))
+}
+
+/*  AOKeyState tracks the TCP-AO keys of a peer that are installed on a socket. The keys of a connection
+ *  that was accepted are copied from the listening socket, they are tracked with Inherit.
+ */
+type AOKeyState struct {
+	peer      net.IP
+	installed map[uint16]config.AuthKey
+	sendKeyId int32
+}
+
+func NewAOKeyState(peer net.IP) *AOKeyState {
+	return &AOKeyState{
+		peer:      peer,
+		installed: make(map[uint16]config.AuthKey),
+		sendKeyId: AuthKeyIdNone,
+	}
+}
+
+func getKeyIndex(key config.AuthKey) uint16 {
+	return uint16(key.SendId)<<8 | uint16(key.RecvId)
+}
+
+func (a *AOKeyState) GetSendKeyId() int32 {
+	return a.sendKeyId
+}
+
+func (a *AOKeyState) Inherit(chain *KeyChain) {
+	for _, key := range chain.GetKeys() {
+		a.installed[getKeyIndex(key)] = key
+	}
+}
+
+/*
+ * Sync installs the active keys of the key chain on the socket, makes the send key of the chain the
+ * current key and removes the keys that are no longer active.
+ */
+func (a *AOKeyState) Sync(fd int, chain *KeyChain, now time.Time) error {
+	var firstErr error
+	active := make(map[uint16]config.AuthKey)
+	for _, key := range chain.GetActiveKeys(now) {
+		idx := getKeyIndex(key)
+		active[idx] = key
+		if installedKey, ok := a.installed[idx]; ok {
+			if installedKey.Secret == key.Secret && installedKey.Algorithm == key.Algorithm {
+				continue
+			}
+			if err := delKey(fd, a.peer, installedKey); err != nil && err != syscall.ENOENT {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			delete(a.installed, idx)
+		}
+		if err := addKey(fd, a.peer, key); err != nil && err != syscall.EEXIST {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		a.installed[idx] = key
+	}
+
+	if sendKey, ok := chain.GetSendKey(now); ok {
+		if _, ok = a.installed[getKeyIndex(sendKey)]; ok && a.sendKeyId != int32(sendKey.SendId) {
+			if err := setCurrentKey(fd, sendKey); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+			} else {
+				a.sendKeyId = int32(sendKey.SendId)
+			}
+		}
+	}
+
+	for idx, key := range a.installed {
+		if _, ok := active[idx]; ok {
+			continue
+		}
+		// The current key can't be removed, it is retried after the send key is changed
+		if err := delKey(fd, a.peer, key); err != nil && err != syscall.ENOENT {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(a.installed, idx)
+	}
+	return firstErr
+}
+
+/*
+ * Clear removes all the keys of the peer from the socket.
+ */
+func (a *AOKeyState) Clear(fd int) error {
+	var firstErr error
+	for idx, key := range a.installed {
+		if err := delKey(fd, a.peer, key); err != nil && err != syscall.ENOENT {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(a.installed, idx)
+	}
+	a.sendKeyId = AuthKeyIdNone
+	return firstErr
+}
+
+/*
+ * ControlFd calls f with the file descriptor of the socket of a connection or a listener.
+ */
+func ControlFd(c syscall.Conn, f func(fd int) error) error {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var fErr error
+	err = rawConn.Control(func(fd uintptr) {
+		fErr = f(int(fd))
+	})
+	if err != nil {
+		return err
+	}
+	return fErr
+}
@@ -25,17 +25,21 @@
 package base
 
 import (
+	"encoding/binary"
 	"fmt"
+	"l3/bgp/auth"
 	"l3/bgp/config"
 	"l3/bgp/packet"
 	"models/events"
 	"net"
+	"sync"
 	"time"
 	"utils/eventUtils"
 	"utils/logging"
 )
 
 const IgnoreBfdFaultsDefaultTime uint32 = 300 // seconds
+const NeighborEventHistoryLen int = 32
 
 type NeighborConf struct {
 	logger               *logging.Writer
@@ -47,7 +51,10 @@ type NeighborConf struct {
 	ASSize               uint8
 	AfiSafiMap           map[uint32]bool
 	MaxPrefixesThreshold uint32
+	keyChain             *auth.KeyChain
+	keyChainMutex        sync.RWMutex
 	ignoreBfdFaultsTimer *time.Timer
+	statsMutex           sync.RWMutex
 }
 
 func NewNeighborConf(logger *logging.Writer, globalConf *config.GlobalConfig, peerGroup *config.PeerGroupConfig,
@@ -63,11 +70,13 @@ func NewNeighborConf(logger *logging.Writer, globalConf *config.GlobalConfig, pe
 		Neighbor: &config.Neighbor{
 			NeighborAddress: peerConf.NeighborAddress,
 			Config:          peerConf,
+			AfiSafis:        peerConf.AfiSafis,
 		},
 	}
 
 	conf.SetRunningConf(peerGroup, &conf.RunningConf)
 	conf.SetNeighborState(&conf.RunningConf)
+	conf.Neighbor.State.AuthActiveKeyId = auth.AuthKeyIdNone
 
 	if conf.RunningConf.LocalAS == conf.RunningConf.PeerAS {
 		conf.Neighbor.State.PeerType = config.PeerTypeInternal
@@ -85,6 +94,17 @@ func NewNeighborConf(logger *logging.Writer, globalConf *config.GlobalConfig, pe
 }
 
 func (n *NeighborConf) SetNeighborState(peerConf *config.NeighborConfig) {
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	stats := n.Neighbor.State.Statistics
+	if stats.PrefixCounters == nil {
+		stats.PrefixCounters = make(map[uint32]*config.PrefixCounters)
+	}
+	originatorIdLoops := n.Neighbor.State.OriginatorIdLoops
+	clusterListLoops := n.Neighbor.State.ClusterListLoops
+	peerRole := n.Neighbor.State.PeerRole
+	routeLeaksDropped := n.Neighbor.State.RouteLeaksDropped
+	authActiveKeyId := n.Neighbor.State.AuthActiveKeyId
 	n.Neighbor.State = config.NeighborState{
 		PeerAS:                  peerConf.PeerAS,
 		LocalAS:                 peerConf.LocalAS,
@@ -95,6 +115,7 @@ func (n *NeighborConf) SetNeighborState(peerConf *config.NeighborConfig) {
 		IfIndex:                 peerConf.IfIndex,
 		RouteReflectorClusterId: peerConf.RouteReflectorClusterId,
 		RouteReflectorClient:    peerConf.RouteReflectorClient,
+		RouteServerClient:       peerConf.RouteServerClient,
 		MultiHopEnable:          peerConf.MultiHopEnable,
 		MultiHopTTL:             peerConf.MultiHopTTL,
 		ConnectRetryTime:        peerConf.ConnectRetryTime,
@@ -108,6 +129,19 @@ func (n *NeighborConf) SetNeighborState(peerConf *config.NeighborConfig) {
 		MaxPrefixesDisconnect:   peerConf.MaxPrefixesDisconnect,
 		MaxPrefixesRestartTimer: peerConf.MaxPrefixesRestartTimer,
 		TotalPrefixes:           0,
+		GracefulShutdown:        peerConf.GracefulShutdown,
+		ORRGroup:                peerConf.ORRGroup,
+		OriginatorIdLoops:       originatorIdLoops,
+		ClusterListLoops:        clusterListLoops,
+		Role:                    peerConf.Role,
+		StrictRole:              peerConf.StrictRole,
+		PeerRole:                peerRole,
+		RouteLeaksDropped:       routeLeaksDropped,
+		AuthType:                n.getAuthType(peerConf),
+		AuthKeyChain:            peerConf.AuthKeyChain,
+		ExportPolicy:            peerConf.ExportPolicy,
+		AuthActiveKeyId:         authActiveKeyId,
+		Statistics:              stats,
 	}
 	n.MaxPrefixesThreshold = uint32(float64(peerConf.MaxPrefixes*uint32(peerConf.MaxPrefixesThresholdPct)) / 100)
 }
@@ -115,6 +149,8 @@ func (n *NeighborConf) SetNeighborState(peerConf *config.NeighborConfig) {
 func (n *NeighborConf) UpdateNeighborConf(nConf config.NeighborConfig, bgp *config.Bgp) {
 	n.Neighbor.NeighborAddress = nConf.NeighborAddress
 	n.Neighbor.Config = nConf
+	n.Neighbor.AfiSafis = nConf.AfiSafis
+	n.AfiSafiMap, _ = packet.GetProtocolFromConfig(&n.Neighbor.AfiSafis, n.Neighbor.NeighborAddress)
 	n.RunningConf = config.NeighborConfig{}
 	if (n.Group == nil && nConf.PeerGroup != "") || (n.Group != nil && nConf.PeerGroup != n.Group.Name) {
 		if peerGroup, ok := bgp.PeerGroups[nConf.PeerGroup]; ok {
@@ -183,6 +219,10 @@ func (n *NeighborConf) GetConfFromNeighbor(inConf *config.NeighborConfig, outCon
 		outConf.RouteReflectorClient = inConf.RouteReflectorClient
 	}
 
+	if inConf.RouteServerClient != false {
+		outConf.RouteServerClient = inConf.RouteServerClient
+	}
+
 	if inConf.MultiHopEnable != false {
 		outConf.MultiHopEnable = inConf.MultiHopEnable
 	}
@@ -235,9 +275,38 @@ func (n *NeighborConf) GetConfFromNeighbor(inConf *config.NeighborConfig, outCon
 		outConf.MaxPrefixesRestartTimer = inConf.MaxPrefixesRestartTimer
 	}
 
+	if inConf.GracefulShutdown != false {
+		outConf.GracefulShutdown = inConf.GracefulShutdown
+	}
+
+	if inConf.ORRGroup != "" {
+		outConf.ORRGroup = inConf.ORRGroup
+	}
+
+	if inConf.Role != "" {
+		outConf.Role = inConf.Role
+	}
+
+	if inConf.StrictRole != false {
+		outConf.StrictRole = inConf.StrictRole
+	}
+
+	if inConf.AuthType != "" {
+		outConf.AuthType = inConf.AuthType
+	}
+
+	if inConf.AuthKeyChain != "" {
+		outConf.AuthKeyChain = inConf.AuthKeyChain
+	}
+
+	if inConf.ExportPolicy != "" {
+		outConf.ExportPolicy = inConf.ExportPolicy
+	}
+
 	outConf.NeighborAddress = inConf.NeighborAddress
 	outConf.IfIndex = inConf.IfIndex
 	outConf.PeerGroup = inConf.PeerGroup
+	outConf.ConditionalAdvertisements = inConf.ConditionalAdvertisements
 }
 
 func (n *NeighborConf) IsInternal() bool {
@@ -252,16 +321,162 @@ func (n *NeighborConf) IsRouteReflectorClient() bool {
 	return n.RunningConf.RouteReflectorClient
 }
 
-func (n *NeighborConf) IncrPrefixCount() {
+/*
+ * GetClusterId returns the cluster id of the route reflector for the neighbor. The cluster id of the neighbor
+ * overrides the global cluster id, the router id is used if neither is configured.
+ */
+func (n *NeighborConf) GetClusterId() uint32 {
+	if n.RunningConf.RouteReflectorClusterId != 0 {
+		return n.RunningConf.RouteReflectorClusterId
+	}
+
+	if n.Global != nil {
+		if n.Global.RouteReflectorClusterId != 0 {
+			return n.Global.RouteReflectorClusterId
+		}
+		if routerId := n.Global.RouterId.To4(); routerId != nil {
+			return binary.BigEndian.Uint32(routerId)
+		}
+	}
+	return 0
+}
+
+/*
+ * CanReflect returns true if a path learned from the internal neighbor from can be advertised to this internal
+ * neighbor. Client to client reflection can be disabled for all the clients or only for the clients in the same
+ * cluster, when the clients are fully meshed.
+ */
+func (n *NeighborConf) CanReflect(from *NeighborConf) bool {
+	if !from.IsRouteReflectorClient() && !n.IsRouteReflectorClient() {
+		return false
+	}
+
+	if from.IsRouteReflectorClient() && n.IsRouteReflectorClient() && n.Global != nil {
+		if n.Global.DisableClientToClientReflection {
+			return false
+		}
+		if n.Global.DisableIntraClusterReflection && from.GetClusterId() == n.GetClusterId() {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *NeighborConf) getAuthType(peerConf *config.NeighborConfig) string {
+	if peerConf.AuthType != "" {
+		return peerConf.AuthType
+	}
+
+	// The password is used for TCP MD5 if the authentication type is not configured
+	if peerConf.AuthPassword != "" {
+		return config.AuthTypeMD5
+	}
+	return config.AuthTypeNone
+}
+
+func (n *NeighborConf) IsMD5Enabled() bool {
+	return n.getAuthType(&n.RunningConf) == config.AuthTypeMD5 && n.RunningConf.AuthPassword != ""
+}
+
+func (n *NeighborConf) IsAOEnabled() bool {
+	return n.getAuthType(&n.RunningConf) == config.AuthTypeAO && n.GetKeyChain() != nil
+}
+
+/*  The key chain is set by the server goroutine and used by the FSM goroutines to install the TCP-AO keys.
+ */
+func (n *NeighborConf) SetKeyChain(chain *auth.KeyChain) {
+	n.keyChainMutex.Lock()
+	defer n.keyChainMutex.Unlock()
+	n.keyChain = chain
+}
+
+func (n *NeighborConf) GetKeyChain() *auth.KeyChain {
+	n.keyChainMutex.RLock()
+	defer n.keyChainMutex.RUnlock()
+	return n.keyChain
+}
+
+/*
+ * GetRole returns the BGP role configured for the session with the neighbor, RFC 9234.
+ */
+func (n *NeighborConf) GetRole() (packet.BGPRole, bool) {
+	role, ok := packet.BGPRoleStrToTypeMap[n.RunningConf.Role]
+	return role, ok
+}
+
+func (n *NeighborConf) SetPeerRole(role packet.BGPRole, found bool) {
+	n.Neighbor.State.PeerRole = ""
+	if found {
+		n.Neighbor.State.PeerRole = packet.BGPRoleToStrMap[role]
+	}
+}
+
+func (n *NeighborConf) IsRouteServerClient() bool {
+	return n.RunningConf.RouteServerClient
+}
+
+func (n *NeighborConf) IsGracefulShutdown() bool {
+	return n.RunningConf.GracefulShutdown || (n.Global != nil && n.Global.GracefulShutdown)
+}
+
+/*
+ * UpdateGracefulShutdown applies the graceful shutdown setting of the neighbor without resetting the running
+ * config and the state of the session.
+ */
+func (n *NeighborConf) UpdateGracefulShutdown(nConf config.NeighborConfig) {
+	n.Neighbor.Config = nConf
+	n.RunningConf.GracefulShutdown = nConf.GracefulShutdown || (n.Group != nil && n.Group.GracefulShutdown)
+	n.Neighbor.State.GracefulShutdown = n.RunningConf.GracefulShutdown
+}
+
+/*  The neighbor statistics are updated from the FSM and the server goroutines and read by the RPC handler,
+ *  the statistics and the session state are protected by statsMutex. getPrefixCounters is called with the
+ *  lock held.
+ */
+func (n *NeighborConf) getPrefixCounters(protoFamily uint32) *config.PrefixCounters {
+	counters, ok := n.Neighbor.State.Statistics.PrefixCounters[protoFamily]
+	if !ok {
+		counters = &config.PrefixCounters{}
+		n.Neighbor.State.Statistics.PrefixCounters[protoFamily] = counters
+	}
+	return counters
+}
+
+func (n *NeighborConf) IncrPrefixCount(protoFamily uint32) {
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
 	n.Neighbor.State.TotalPrefixes++
+	n.getPrefixCounters(protoFamily).Accepted++
 }
 
-func (n *NeighborConf) DecrPrefixCount() {
+func (n *NeighborConf) DecrPrefixCount(protoFamily uint32) {
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
 	n.Neighbor.State.TotalPrefixes--
+	if counters := n.getPrefixCounters(protoFamily); counters.Accepted > 0 {
+		counters.Accepted--
+	}
 }
 
 func (n *NeighborConf) SetPrefixCount(count uint32) {
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
 	n.Neighbor.State.TotalPrefixes = 0
+	for _, counters := range n.Neighbor.State.Statistics.PrefixCounters {
+		counters.Accepted = 0
+	}
+}
+
+func (n *NeighborConf) AddReceivedPrefixCount(protoFamily uint32, count uint32) {
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	n.getPrefixCounters(protoFamily).Received += count
+}
+
+func (n *NeighborConf) SetAdvertisedPrefixCount(protoFamily uint32, count uint32) {
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	n.getPrefixCounters(protoFamily).Advertised = count
 }
 
 func (n *NeighborConf) CanAcceptNewPrefix() bool {
@@ -295,12 +510,99 @@ func (n *NeighborConf) PublishEvents(stateId uint32) {
 	}
 }
 
-func (n *NeighborConf) FSMStateChange(state uint32) {
-	n.logger.Infof("Neighbor %s: FSMStateChange %d", n.Neighbor.NeighborAddress, state)
+/*  FSMStateChange records the state transition in the neighbor event history along with the FSM event that
+ *  caused it. Transitions out of the ESTABLISHED state are counted as session resets.
+ */
+func (n *NeighborConf) FSMStateChange(state uint32, event string) {
+	n.logger.Infof("Neighbor %s: FSMStateChange %d event %s", n.Neighbor.NeighborAddress, state, event)
 	n.PublishEvents(state)
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	now := time.Now()
+	fromState := config.BGPFSMState(n.Neighbor.State.SessionState)
+	toState := config.BGPFSMState(state)
+	stats := &n.Neighbor.State.Statistics
+	stats.EventHistory = append(stats.EventHistory, config.NeighborEvent{
+		Time:      now,
+		FromState: fromState,
+		ToState:   toState,
+		Event:     event,
+	})
+	if len(stats.EventHistory) > NeighborEventHistoryLen {
+		stats.EventHistory = stats.EventHistory[len(stats.EventHistory)-NeighborEventHistoryLen:]
+	}
+
+	if toState == config.BGPFSMEstablished && fromState != config.BGPFSMEstablished {
+		stats.EstablishedTransitions++
+		stats.EstablishedTime = now
+	} else if fromState == config.BGPFSMEstablished && toState != config.BGPFSMEstablished {
+		stats.LastResetReason = event
+		stats.LastResetTime = now
+	}
 	n.Neighbor.State.SessionState = uint32(state)
 }
 
+func (n *NeighborConf) GetUptime() time.Duration {
+	n.statsMutex.RLock()
+	defer n.statsMutex.RUnlock()
+	if config.BGPFSMState(n.Neighbor.State.SessionState) != config.BGPFSMEstablished {
+		return 0
+	}
+	return time.Since(n.Neighbor.State.Statistics.EstablishedTime)
+}
+
+/*  GetStatisticsState returns a copy of the neighbor statistics and the session state that is safe to use
+ *  outside the goroutines that update them.
+ */
+func (n *NeighborConf) GetStatisticsState() *config.NeighborState {
+	n.statsMutex.RLock()
+	defer n.statsMutex.RUnlock()
+	stats := n.Neighbor.State.Statistics
+	stats.EventHistory = make([]config.NeighborEvent, len(stats.EventHistory))
+	copy(stats.EventHistory, n.Neighbor.State.Statistics.EventHistory)
+	stats.PrefixCounters = make(map[uint32]*config.PrefixCounters, len(stats.PrefixCounters))
+	for protoFamily, counters := range n.Neighbor.State.Statistics.PrefixCounters {
+		countersCopy := *counters
+		stats.PrefixCounters[protoFamily] = &countersCopy
+	}
+	return &config.NeighborState{
+		NeighborAddress: n.Neighbor.State.NeighborAddress,
+		IfIndex:         n.Neighbor.State.IfIndex,
+		SessionState:    n.Neighbor.State.SessionState,
+		Statistics:      stats,
+	}
+}
+
+func (n *NeighborConf) IncrConnectionAttempts() {
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	n.Neighbor.State.Statistics.ConnectionAttempts++
+}
+
+func (n *NeighborConf) NotificationSent(code uint8, subcode uint8, data []byte) {
+	n.Neighbor.State.Messages.Sent.Notification++
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	n.Neighbor.State.Statistics.LastNotificationSent = config.NotificationInfo{
+		Time:    time.Now(),
+		Code:    code,
+		Subcode: subcode,
+		Data:    data,
+	}
+}
+
+func (n *NeighborConf) NotificationReceived(code uint8, subcode uint8, data []byte) {
+	n.Neighbor.State.Messages.Received.Notification++
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	n.Neighbor.State.Statistics.LastNotificationRcvd = config.NotificationInfo{
+		Time:    time.Now(),
+		Code:    code,
+		Subcode: subcode,
+		Data:    data,
+	}
+}
+
 func (n *NeighborConf) SetPeerAttrs(bgpId net.IP, asSize uint8, holdTime uint32, keepaliveTime uint32,
 	addPathFamily map[packet.AFI]map[packet.SAFI]uint8) {
 	n.BGPId = bgpId
@@ -356,4 +658,12 @@ func (n *NeighborConf) PeerConnBroken() {
 	n.Neighbor.State.AddPathsRx = false
 	n.Neighbor.State.AddPathsMaxTx = 0
 	n.Neighbor.State.TotalPrefixes = 0
+	n.Neighbor.State.PeerRole = ""
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	for _, counters := range n.Neighbor.State.Statistics.PrefixCounters {
+		counters.Received = 0
+		counters.Accepted = 0
+		counters.Advertised = 0
+	}
 }
@@ -0,0 +1,188 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// neighbor_test.go
+package base
+
+import (
+	"l3/bgp/config"
+	"l3/bgp/packet"
+	"net"
+	"sync"
+	"testing"
+	"utils/logging"
+)
+
+func newTestNeighborConf(t *testing.T) *NeighborConf {
+	logger, err := logging.NewLogger("bgpd", "BGP", true)
+	if err != nil {
+		t.Fatal("Failed to start the logger. Exiting!!")
+	}
+
+	pConf := config.NeighborConfig{
+		BaseConfig:      config.BaseConfig{PeerAS: 65001, LocalAS: 65000},
+		NeighborAddress: net.ParseIP("10.1.1.1"),
+	}
+	return NewNeighborConf(logger, &config.GlobalConfig{}, nil, pConf)
+}
+
+func TestNeighborEventHistory(t *testing.T) {
+	nConf := newTestNeighborConf(t)
+	nConf.FSMStateChange(uint32(config.BGPFSMConnect), "BGPEventManualStart")
+	nConf.FSMStateChange(uint32(config.BGPFSMOpensent), "BGPEventTcpConnConfirmed")
+	nConf.FSMStateChange(uint32(config.BGPFSMOpenconfirm), "BGPEventBGPOpen")
+	nConf.FSMStateChange(uint32(config.BGPFSMEstablished), "BGPEventKeepAliveMsg")
+	nConf.FSMStateChange(uint32(config.BGPFSMIdle), "BGPEventHoldTimerExp")
+
+	state := nConf.GetStatisticsState()
+	stats := state.Statistics
+	if config.BGPFSMState(state.SessionState) != config.BGPFSMIdle {
+		t.Error("Session state", state.SessionState, "expected", config.BGPFSMIdle)
+	}
+	if len(stats.EventHistory) != 5 {
+		t.Fatal("Event history length", len(stats.EventHistory), "expected 5")
+	}
+	if stats.EventHistory[3].FromState != config.BGPFSMOpenconfirm ||
+		stats.EventHistory[3].ToState != config.BGPFSMEstablished {
+		t.Errorf("Event history entry 3 %+v, expected transition from OPENCONFIRM to ESTABLISHED",
+			stats.EventHistory[3])
+	}
+	if stats.EstablishedTransitions != 1 {
+		t.Error("Established transitions", stats.EstablishedTransitions, "expected 1")
+	}
+	if stats.LastResetReason != "BGPEventHoldTimerExp" || stats.LastResetTime.IsZero() {
+		t.Errorf("Last reset reason %s time %s, expected BGPEventHoldTimerExp", stats.LastResetReason,
+			stats.LastResetTime)
+	}
+	if nConf.GetUptime() != 0 {
+		t.Error("Uptime", nConf.GetUptime(), "expected 0 when the session is not established")
+	}
+
+	for i := 0; i < NeighborEventHistoryLen; i++ {
+		nConf.FSMStateChange(uint32(config.BGPFSMActive), "BGPEventConnRetryTimerExp")
+	}
+	stats = nConf.GetStatisticsState().Statistics
+	if len(stats.EventHistory) != NeighborEventHistoryLen {
+		t.Error("Event history length", len(stats.EventHistory), "expected", NeighborEventHistoryLen)
+	}
+	if stats.EventHistory[0].Event != "BGPEventConnRetryTimerExp" {
+		t.Error("Oldest event", stats.EventHistory[0].Event, "was not dropped from the history")
+	}
+}
+
+func TestNeighborPrefixCounters(t *testing.T) {
+	nConf := newTestNeighborConf(t)
+	ipv4Family := packet.GetProtocolFamily(packet.AfiIP, packet.SafiUnicast)
+	nConf.AddReceivedPrefixCount(ipv4Family, 3)
+	nConf.IncrPrefixCount(ipv4Family)
+	nConf.IncrPrefixCount(ipv4Family)
+	nConf.DecrPrefixCount(ipv4Family)
+	nConf.SetAdvertisedPrefixCount(ipv4Family, 5)
+
+	stats := nConf.GetStatisticsState().Statistics
+	counters, ok := stats.PrefixCounters[ipv4Family]
+	if !ok {
+		t.Fatal("Prefix counters for IPv4 unicast not found")
+	}
+	if *counters != (config.PrefixCounters{Received: 3, Accepted: 1, Advertised: 5}) {
+		t.Errorf("Prefix counters %+v, expected received 3 accepted 1 advertised 5", *counters)
+	}
+
+	/*  The counters returned are a copy, later updates don't change them. */
+	nConf.PeerConnBroken()
+	if *counters != (config.PrefixCounters{Received: 3, Accepted: 1, Advertised: 5}) {
+		t.Errorf("Prefix counters copy %+v changed after the session went down", *counters)
+	}
+	counters = nConf.GetStatisticsState().Statistics.PrefixCounters[ipv4Family]
+	if *counters != (config.PrefixCounters{}) {
+		t.Errorf("Prefix counters %+v, expected all 0 after the session went down", *counters)
+	}
+}
+
+func TestNeighborNotificationStatistics(t *testing.T) {
+	nConf := newTestNeighborConf(t)
+	nConf.NotificationSent(packet.BGPCease, packet.BGPCeaseAdminShutdown, nil)
+	nConf.NotificationReceived(packet.BGPHoldTimerExpired, 0, []byte{1})
+
+	stats := nConf.GetStatisticsState().Statistics
+	if stats.LastNotificationSent.Code != packet.BGPCease ||
+		stats.LastNotificationSent.Subcode != packet.BGPCeaseAdminShutdown {
+		t.Errorf("Last notification sent %+v, expected cease admin shutdown", stats.LastNotificationSent)
+	}
+	if stats.LastNotificationRcvd.Code != packet.BGPHoldTimerExpired {
+		t.Errorf("Last notification received %+v, expected hold timer expired", stats.LastNotificationRcvd)
+	}
+	if nConf.Neighbor.State.Messages.Sent.Notification != 1 ||
+		nConf.Neighbor.State.Messages.Received.Notification != 1 {
+		t.Errorf("Notification messages sent %d received %d, expected 1 and 1",
+			nConf.Neighbor.State.Messages.Sent.Notification, nConf.Neighbor.State.Messages.Received.Notification)
+	}
+}
+
+/*  The statistics are updated from the FSM and the server goroutines while the RPC handler reads them. Run
+ *  with -race to check the accesses are synchronized.
+ */
+func TestNeighborStatisticsConcurrentAccess(t *testing.T) {
+	nConf := newTestNeighborConf(t)
+	ipv4Family := packet.GetProtocolFamily(packet.AfiIP, packet.SafiUnicast)
+	ipv6Family := packet.GetProtocolFamily(packet.AfiIP6, packet.SafiUnicast)
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			nConf.FSMStateChange(uint32(config.BGPFSMEstablished), "BGPEventKeepAliveMsg")
+			nConf.FSMStateChange(uint32(config.BGPFSMIdle), "BGPEventHoldTimerExp")
+			nConf.IncrConnectionAttempts()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			nConf.IncrPrefixCount(ipv4Family)
+			nConf.IncrPrefixCount(ipv6Family)
+			nConf.AddReceivedPrefixCount(ipv6Family, 1)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			state := nConf.GetStatisticsState()
+			for _, counters := range state.Statistics.PrefixCounters {
+				_ = counters.Accepted
+			}
+			_ = len(state.Statistics.EventHistory)
+		}
+	}()
+	wg.Wait()
+
+	stats := nConf.GetStatisticsState().Statistics
+	if stats.ConnectionAttempts != 100 || stats.EstablishedTransitions != 100 {
+		t.Error("Connection attempts", stats.ConnectionAttempts, "established transitions",
+			stats.EstablishedTransitions, "expected 100 and 100")
+	}
+	if stats.PrefixCounters[ipv4Family].Accepted != 100 || stats.PrefixCounters[ipv6Family].Received != 100 {
+		t.Errorf("Prefix counters %+v %+v, expected 100 accepted IPv4 and 100 received IPv6 prefixes",
+			*stats.PrefixCounters[ipv4Family], *stats.PrefixCounters[ipv6Family])
+	}
+}
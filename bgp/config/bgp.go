@@ -26,31 +26,83 @@ package config
 
 import (
 	"net"
+	"time"
 )
 
 type SourcePolicyMap struct {
 	Sources string
 	Policy  string
 }
+
+/*  Optimal route reflection group, RFC 9107. The best path for the clients in
+ *  the group is selected with the IGP distances from IGPPosition.
+ */
+type ORRGroupConfig struct {
+	Name        string
+	IGPPosition net.IP
+}
+
 type GlobalConfig struct {
-	AS                  uint32
-	RouterId            net.IP
-	UseMultiplePaths    bool
-	EBGPMaxPaths        uint32
-	EBGPAllowMultipleAS bool
-	IBGPMaxPaths        uint32
-	Redistribution      []SourcePolicyMap
+	AS                              uint32
+	RouterId                        net.IP
+	UseMultiplePaths                bool
+	EBGPMaxPaths                    uint32
+	EBGPAllowMultipleAS             bool
+	IBGPMaxPaths                    uint32
+	Redistribution                  []SourcePolicyMap
+	GracefulShutdown                bool
+	GracefulShutdownTime            uint32
+	IPv4UnicastPIC                  bool
+	IPv6UnicastPIC                  bool
+	RouteReflectorClusterId         uint32
+	DisableClientToClientReflection bool
+	DisableIntraClusterReflection   bool
+	ORRGroups                       []ORRGroupConfig
 }
 
 type GlobalState struct {
-	AS                  uint32
-	RouterId            net.IP
-	UseMultiplePaths    bool
-	EBGPMaxPaths        uint32
-	EBGPAllowMultipleAS bool
-	IBGPMaxPaths        uint32
-	TotalPaths          uint32
-	TotalPrefixes       uint32
+	AS                              uint32
+	RouterId                        net.IP
+	UseMultiplePaths                bool
+	EBGPMaxPaths                    uint32
+	EBGPAllowMultipleAS             bool
+	IBGPMaxPaths                    uint32
+	TotalPaths                      uint32
+	TotalPrefixes                   uint32
+	GracefulShutdown                bool
+	GracefulShutdownTime            uint32
+	IPv4UnicastPIC                  bool
+	IPv6UnicastPIC                  bool
+	RouteReflectorClusterId         uint32
+	DisableClientToClientReflection bool
+	DisableIntraClusterReflection   bool
+	ORRGroups                       []ORRGroupConfig
+}
+
+const (
+	AuthTypeNone = "none"
+	AuthTypeMD5  = "md5"
+	AuthTypeAO   = "ao"
+)
+
+/*  Key of a key chain. SendId and RecvId are the TCP-AO key ids, the key is used to sign the segments
+ *  between SendLifetimeStart and SendLifetimeEnd and to verify them between AcceptLifetimeStart and
+ *  AcceptLifetimeEnd. A zero time leaves the lifetime open on that side.
+ */
+type AuthKey struct {
+	SendId              uint8
+	RecvId              uint8
+	Algorithm           string
+	Secret              string
+	SendLifetimeStart   time.Time
+	SendLifetimeEnd     time.Time
+	AcceptLifetimeStart time.Time
+	AcceptLifetimeEnd   time.Time
+}
+
+type KeyChainConfig struct {
+	Name string
+	Keys []AuthKey
 }
 
 type Global struct {
@@ -75,11 +127,50 @@ type Messages struct {
 	Received BgpCounters
 }
 
+type UpdateErrors struct {
+	SessionReset    uint32
+	AfiSafiDisable  uint32
+	TreatAsWithdraw uint32
+	AttrDiscard     uint32
+}
+
 type Queues struct {
 	Input  uint32
 	Output uint32
 }
 
+type NeighborEvent struct {
+	Time      time.Time
+	FromState BGPFSMState
+	ToState   BGPFSMState
+	Event     string
+}
+
+type NotificationInfo struct {
+	Time    time.Time
+	Code    uint8
+	Subcode uint8
+	Data    []byte
+}
+
+type PrefixCounters struct {
+	Received   uint32
+	Accepted   uint32
+	Advertised uint32
+}
+
+type NeighborStatistics struct {
+	EventHistory           []NeighborEvent
+	LastNotificationSent   NotificationInfo
+	LastNotificationRcvd   NotificationInfo
+	ConnectionAttempts     uint32
+	EstablishedTransitions uint32
+	EstablishedTime        time.Time
+	LastResetReason        string
+	LastResetTime          time.Time
+	PrefixCounters         map[uint32]*PrefixCounters
+}
+
 type BaseConfig struct {
 	PeerAS                  uint32
 	LocalAS                 uint32
@@ -88,6 +179,7 @@ type BaseConfig struct {
 	Description             string
 	RouteReflectorClusterId uint32
 	RouteReflectorClient    bool
+	RouteServerClient       bool
 	MultiHopEnable          bool
 	MultiHopTTL             uint8
 	ConnectRetryTime        uint32
@@ -101,13 +193,28 @@ type BaseConfig struct {
 	MaxPrefixesThresholdPct uint8
 	MaxPrefixesDisconnect   bool
 	MaxPrefixesRestartTimer uint8
+	GracefulShutdown        bool
+	ORRGroup                string
+	Role                    string
+	StrictRole              bool
+	AuthType                string
+	AuthKeyChain            string
+	ExportPolicy            string
+}
+
+type ConditionalAdvertisement struct {
+	AdvertiseCondition string
+	ExistCondition     string
+	NonExistCondition  string
 }
 
 type NeighborConfig struct {
 	BaseConfig
-	NeighborAddress net.IP
-	IfIndex         int32
-	PeerGroup       string
+	NeighborAddress           net.IP
+	IfIndex                   int32
+	PeerGroup                 string
+	ConditionalAdvertisements []ConditionalAdvertisement
+	AfiSafis                  []AfiSafiConfig
 }
 
 type NeighborState struct {
@@ -122,8 +229,10 @@ type NeighborState struct {
 	SessionState            uint32
 	Messages                Messages
 	Queues                  Queues
+	UpdateErrors            UpdateErrors
 	RouteReflectorClusterId uint32
 	RouteReflectorClient    bool
+	RouteServerClient       bool
 	MultiHopEnable          bool
 	MultiHopTTL             uint8
 	ConnectRetryTime        uint32
@@ -139,6 +248,20 @@ type NeighborState struct {
 	MaxPrefixesDisconnect   bool
 	MaxPrefixesRestartTimer uint8
 	TotalPrefixes           uint32
+	GracefulShutdown        bool
+	ShutdownMessage         string
+	ORRGroup                string
+	OriginatorIdLoops       uint32
+	ClusterListLoops        uint32
+	Role                    string
+	StrictRole              bool
+	PeerRole                string
+	RouteLeaksDropped       uint32
+	AuthType                string
+	AuthKeyChain            string
+	ExportPolicy            string
+	AuthActiveKeyId         int32
+	Statistics              NeighborStatistics
 }
 
 type TransportConfig struct {
@@ -170,8 +293,11 @@ type PrefixLimit struct {
 }
 
 type IPUnicast struct {
-	PrefixLimit      PrefixLimit
-	SendDefaultRoute bool
+	PrefixLimit           PrefixLimit
+	SendDefaultRoute      bool
+	DefaultRouteMED       uint32
+	DefaultRouteLocalPref uint32
+	DefaultRouteCondition string
 }
 
 type IPLabelledUnicast struct {
@@ -208,6 +334,7 @@ type AfiSafiConfig struct {
 type PeerCommand struct {
 	IP      net.IP
 	Command int
+	Message string
 }
 
 type Neighbor struct {
@@ -248,6 +375,26 @@ type ConditionInfo struct {
 	IpPrefix        string
 	MasklengthRange string
 }
+
+type ASPathListEntry struct {
+	Permit bool
+	Regex  string
+}
+
+type ASPathList struct {
+	Name    string
+	Entries []ASPathListEntry
+}
+
+type BGPPolicyCondition struct {
+	Name            string
+	ConditionType   string
+	ASPathList      string
+	AS              uint32
+	MinASPathLength uint32
+	MaxASPathLength uint32
+}
+
 type RouteConfig struct {
 	Cost              int32
 	IntfType          int32
@@ -257,4 +404,7 @@ type RouteConfig struct {
 	DestinationNw     string
 	OutgoingInterface string
 	IsIPv6            bool
+	// Backup next hop to use when NextHopIp is not reachable, empty if there is no backup
+	BackupNextHopIp         string
+	BackupOutgoingInterface string
 }
@@ -33,6 +33,11 @@ type ReachabilityInfo struct {
 	ReachableCh chan bool
 }
 
+type NextHopStateInfo struct {
+	IP        string
+	Reachable bool
+}
+
 type Operation int
 
 const (
@@ -101,3 +106,32 @@ type NextHopInfo struct {
 	NextHopIfType  int32
 	NextHopIfIndex int32
 }
+
+/*  This is mimic of ospfd LSA object exported for BGP-LS
+ */
+type LinkStateLink struct {
+	LinkId   uint32
+	LinkData uint32
+	LinkType uint8
+	Metric   uint16
+}
+
+type LinkStateLsa struct {
+	AreaId      uint32
+	LSType      uint8
+	LSId        uint32
+	AdvRouter   uint32
+	BitE        bool
+	BitB        bool
+	Netmask     uint32
+	AttachedRtr []uint32
+	Links       []LinkStateLink
+}
+
+/*  When Sync is set, Add has all the LSAs in the link state database
+ */
+type LinkStateCh struct {
+	Add    []*LinkStateLsa
+	Remove []*LinkStateLsa
+	Sync   bool
+}
@@ -43,6 +43,9 @@ type RouteMgrIntf interface {
 	UpdateRoute(cfg *RouteConfig , op string)
 	ApplyPolicy(protocol string, policy string, action string, conditions []*ConditionInfo)
 	GetRoutes() ([]*RouteInfo, []*RouteInfo)
+	SetBackupNextHop(cfg *RouteConfig)
+	SwitchToBackupNextHop(nextHopIp string, cfgs []*RouteConfig)
+	TrackNextHop(ipAddr string, track bool)
 }
 
 /*  Interface for handling policy related operations
@@ -58,3 +61,11 @@ type BfdMgrIntf interface {
 	CreateBfdSession(ipAddr string, sessionParam string) (bool, error)
 	DeleteBfdSession(ipAddr string) (bool, error)
 }
+
+/*  Interface for handling link state database notifications from the IGP and for notifying the IGP of the
+ *  BGP initial convergence
+ */
+type LinkStateMgrIntf interface {
+	Start()
+	NotifyConverged()
+}
@@ -68,6 +68,15 @@ type FSBfdMgr struct {
 	bfdSubSocket *nanomsg.SubSocket
 }
 
+/*  Link state manager will handle the link state database notifications from ospfd
+ */
+type FSLinkStateMgr struct {
+	plugin      string
+	logger      *logging.Writer
+	lsSubSocket *nanomsg.SubSocket
+	pubSocket   *nanomsg.PubSocket
+}
+
 func (mgr *FSIntfMgr) PortStateChange() {
 
 }
\ No newline at end of file
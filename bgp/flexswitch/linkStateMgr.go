@@ -0,0 +1,137 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package FSMgr
+
+import (
+	"encoding/json"
+	"l3/bgp/api"
+	"l3/bgp/bgpdCommonDefs"
+	"l3/ospf/ospfdCommonDefs"
+	"utils/logging"
+
+	nanomsg "github.com/op/go-nanomsg"
+)
+
+/*  Init link state manager
+ */
+func NewFSLinkStateMgr(logger *logging.Writer, fileName string) *FSLinkStateMgr {
+	mgr := &FSLinkStateMgr{
+		plugin: "flexswitch",
+		logger: logger,
+	}
+
+	return mgr
+}
+
+/*  Do any necessary init. Called from server..
+ */
+func (mgr *FSLinkStateMgr) Start() {
+	mgr.pubSocket, _ = mgr.SetupPubSocket(bgpdCommonDefs.PUB_SOCKET_ADDR)
+	// create ospfd sub socket listener
+	mgr.lsSubSocket, _ = mgr.SetupSubSocket(ospfdCommonDefs.PUB_SOCKET_ADDR)
+	if mgr.lsSubSocket == nil {
+		return
+	}
+	go mgr.listenForLinkStateNotifications()
+}
+
+/*  Listen for any link state database notifications from ospfd
+ */
+func (mgr *FSLinkStateMgr) listenForLinkStateNotifications() {
+	for {
+		mgr.logger.Info("Read on OSPF subscriber socket...")
+		rxBuf, err := mgr.lsSubSocket.Recv(0)
+		if err != nil {
+			mgr.logger.Err("Recv on OSPF subscriber socket failed with error:", err)
+			continue
+		}
+		mgr.handleLinkStateNotifications(rxBuf)
+	}
+}
+
+func (mgr *FSLinkStateMgr) handleLinkStateNotifications(rxBuf []byte) {
+	if err := api.SendOspfLinkStateNotification(rxBuf); err != nil {
+		mgr.logger.Err("Failed to handle OSPF link state notification, error:", err)
+	}
+}
+
+func (mgr *FSLinkStateMgr) SetupSubSocket(address string) (*nanomsg.SubSocket, error) {
+	var err error
+	var socket *nanomsg.SubSocket
+	if socket, err = nanomsg.NewSubSocket(); err != nil {
+		mgr.logger.Errf("Failed to create subscribe socket %s, error:%s", address, err)
+		return nil, err
+	}
+
+	if err = socket.Subscribe(""); err != nil {
+		mgr.logger.Errf("Failed to subscribe to \"\" on subscribe socket %s, error:%s",
+			address, err)
+		return nil, err
+	}
+
+	if _, err = socket.Connect(address); err != nil {
+		mgr.logger.Errf("Failed to connect to publisher socket %s, error:%s", address, err)
+		return nil, err
+	}
+
+	mgr.logger.Infof("Connected to publisher socket %s", address)
+	if err = socket.SetRecvBuffer(1024 * 1024); err != nil {
+		mgr.logger.Err("Failed to set the buffer size for subsriber socket %s, error:",
+			address, err)
+		return nil, err
+	}
+	return socket, nil
+}
+
+func (mgr *FSLinkStateMgr) SetupPubSocket(address string) (*nanomsg.PubSocket, error) {
+	socket, err := nanomsg.NewPubSocket()
+	if err != nil {
+		mgr.logger.Errf("Failed to create publish socket %s, error:%s", address, err)
+		return nil, err
+	}
+
+	if _, err = socket.Bind(address); err != nil {
+		mgr.logger.Errf("Failed to bind publish socket %s, error:%s", address, err)
+		return nil, err
+	}
+	return socket, nil
+}
+
+/*  Tell ospfd that BGP converged, ospfd leaves the wait for BGP stub router mode
+ */
+func (mgr *FSLinkStateMgr) NotifyConverged() {
+	if mgr.pubSocket == nil {
+		return
+	}
+	buf, err := json.Marshal(bgpdCommonDefs.BgpdNotifyMsg{
+		MsgType: bgpdCommonDefs.NOTIFY_BGP_CONVERGED,
+	})
+	if err != nil {
+		mgr.logger.Err("Failed to encode BGP converged notification, error:", err)
+		return
+	}
+	if _, err = mgr.pubSocket.Send(buf, nanomsg.DontWait); err != nil {
+		mgr.logger.Err("Failed to send BGP converged notification, error:", err)
+	}
+}
@@ -139,6 +139,10 @@ func (mgr *FSRouteMgr) handleRibUpdates(rxBuf []byte) {
 	updateMsg := "Add"
 
 	for err := decoder.Decode(&msg); err == nil; err = decoder.Decode(&msg) {
+		if msg.MsgType == ribdCommonDefs.NOTIFY_ROUTE_REACHABILITY_STATUS_UPDATE {
+			mgr.handleReachabilityUpdate(msg.MsgBuf)
+			continue
+		}
 		err = json.Unmarshal(msg.MsgBuf, &routeListInfo)
 		if err != nil {
 			mgr.logger.Errf(
@@ -155,6 +159,9 @@ func (mgr *FSRouteMgr) handleRibUpdates(rxBuf []byte) {
 		routes = append(routes, route)
 	}
 
+	if len(routes) == 0 && msg.MsgType == ribdCommonDefs.NOTIFY_ROUTE_REACHABILITY_STATUS_UPDATE {
+		return
+	}
 	if len(routes) > 0 {
 		if msg.MsgType == ribdCommonDefs.NOTIFY_ROUTE_CREATED {
 			api.SendRouteNotification(routes, make([]*config.RouteInfo, 0))
@@ -170,6 +177,19 @@ func (mgr *FSRouteMgr) handleRibUpdates(rxBuf []byte) {
 	}
 }
 
+/*  ribd notifies the reachability changes of the next hops tracked with
+ *  TrackNextHop
+ */
+func (mgr *FSRouteMgr) handleReachabilityUpdate(msgBuf []byte) {
+	var msgInfo ribdCommonDefs.RouteReachabilityStatusMsgInfo
+	if err := json.Unmarshal(msgBuf, &msgInfo); err != nil {
+		mgr.logger.Errf("Unmarshal RIB reachability update failed with err %s", err)
+		return
+	}
+	mgr.logger.Info("Next hop", msgInfo.Network, "reachable:", msgInfo.IsReachable)
+	api.SendNextHopNotification(msgInfo.Network, msgInfo.IsReachable)
+}
+
 func (mgr *FSRouteMgr) GetNextHopInfo(ipAddr string) (*config.NextHopInfo, error) {
 	info, err := mgr.ribdClient.GetRouteReachabilityInfo(ipAddr)
 	if err != nil {
@@ -285,6 +305,45 @@ func (mgr *FSRouteMgr) UpdateRoute(cfg *config.RouteConfig, op string) {
 	}
 }
 
+/*
+ * The backup next hop of the route is kept by RIBd. RIBd switches all the routes that use a next hop to their
+ * backup next hops when it's asked to with the next hop.
+ */
+func (mgr *FSRouteMgr) SetBackupNextHop(cfg *config.RouteConfig) {
+	backupCfg := ribdInt.BackupNextHopConfig{
+		DestinationNw:       cfg.DestinationNw,
+		NetworkMask:         cfg.NetworkMask,
+		Protocol:            cfg.Protocol,
+		Cost:                cfg.Cost,
+		IsIPv6:              cfg.IsIPv6,
+		NextHopIp:           cfg.NextHopIp,
+		NextHopIntRef:       cfg.OutgoingInterface,
+		BackupNextHopIp:     cfg.BackupNextHopIp,
+		BackupNextHopIntRef: cfg.BackupOutgoingInterface,
+	}
+	if err := mgr.ribdClient.OnewaySetBackupNextHop(&backupCfg); err != nil {
+		mgr.logger.Err("SetBackupNextHop: route", cfg.DestinationNw, "backup next hop", cfg.BackupNextHopIp,
+			"failed with error:", err)
+	}
+}
+
+func (mgr *FSRouteMgr) SwitchToBackupNextHop(nextHopIp string, cfgs []*config.RouteConfig) {
+	mgr.logger.Info("SwitchToBackupNextHop: next hop", nextHopIp, "switch", len(cfgs), "routes")
+	if err := mgr.ribdClient.OnewaySwitchToBackupNextHop(nextHopIp); err != nil {
+		mgr.logger.Err("SwitchToBackupNextHop: next hop", nextHopIp, "failed with error:", err)
+	}
+}
+
+func (mgr *FSRouteMgr) TrackNextHop(ipAddr string, track bool) {
+	op := "add"
+	if !track {
+		op = "del"
+	}
+	if err := mgr.ribdClient.TrackReachabilityStatus(ipAddr, "BGP", op); err != nil {
+		mgr.logger.Err("TrackNextHop: next hop", ipAddr, "op", op, "failed with error:", err)
+	}
+}
+
 func (mgr *FSRouteMgr) ApplyPolicy(protocol string, policy string, action string, conditions []*config.ConditionInfo) {
 	temp := make([]ribdInt.ConditionInfo, len(conditions))
 	ribdConditions := make([]*ribdInt.ConditionInfo, 0)
@@ -27,6 +27,7 @@ package fsm
 import (
 	"errors"
 	"fmt"
+	"l3/bgp/auth"
 	"l3/bgp/config"
 	"l3/bgp/packet"
 	"l3/bgp/utils"
@@ -134,7 +135,7 @@ func (o *OutTCPConn) Connect(seconds uint32, remote, local string, connCh chan n
 		return
 	}
 
-	if o.fsm.pConf.AuthPassword != "" {
+	if o.fsm.neighborConf.IsMD5Enabled() {
 		o.logger.Info("Neighbor:", o.fsm.pConf.NeighborAddress, "FSM", o.fsm.id,
 			"Set MD5 option on the socket:", socket, "password:", o.fsm.pConf.AuthPassword)
 		err = netUtils.SetSockoptTCPMD5(socket, remoteIP, o.fsm.pConf.AuthPassword)
@@ -144,6 +145,17 @@ func (o *OutTCPConn) Connect(seconds uint32, remote, local string, connCh chan n
 			errCh <- err
 			return
 		}
+	} else if chain := o.fsm.neighborConf.GetKeyChain(); chain != nil && o.fsm.neighborConf.IsAOEnabled() {
+		o.logger.Info("Neighbor:", o.fsm.pConf.NeighborAddress, "FSM", o.fsm.id,
+			"Set TCP-AO keys of key chain", o.fsm.pConf.AuthKeyChain, "on the socket:", socket)
+		aoKeys := auth.NewAOKeyState(net.ParseIP(remoteIP))
+		err = aoKeys.Sync(socket, chain, time.Now())
+		if err != nil {
+			o.logger.Info("Neighbor:", o.fsm.pConf.NeighborAddress, "FSM", o.fsm.id,
+				"Set TCP-AO keys on the socket failed with error", err)
+			errCh <- err
+			return
+		}
 	}
 
 	err = netUtils.Connect(socket, "tcp", remote, local, time.Duration(seconds)*time.Second)
@@ -330,6 +342,13 @@ func (p *PeerConn) DecodeMessage(header *packet.BGPHeader, buf []byte) (*packet.
 		msgOk = false
 	}
 
+	if packet.IsUpdateAttrErrors(err) {
+		// Path attribute errors that don't need a session reset are handled by the FSM
+		p.logger.Info("Neighbor:", p.fsm.pConf.NeighborAddress, "FSM", p.fsm.id,
+			"BGP update message has path attr errors, err:", err)
+		err = nil
+	}
+
 	if err != nil {
 		p.logger.Info("Neighbor:", p.fsm.pConf.NeighborAddress, "FSM", p.fsm.id,
 			"BGP packet body decode failed, err:", err)
@@ -348,6 +367,21 @@ func (p *PeerConn) DecodeMessage(header *packet.BGPHeader, buf []byte) (*packet.
 			p.logger.Info("Neighbor:", p.fsm.pConf.NeighborAddress,
 				"negotiated to recieve add paths from far end")
 		}
+		p.peerAttrs.ExtendedMsg = packet.IsExtendedMsgEnabled(msg.Body.(*packet.BGPOpen))
+		if p.peerAttrs.ExtendedMsg {
+			p.logger.Info("Neighbor:", p.fsm.pConf.NeighborAddress,
+				"negotiated to receive extended messages from far end")
+		}
+		if localRole, ok := p.fsm.neighborConf.GetRole(); ok {
+			err = packet.CheckRole(msg.Body.(*packet.BGPOpen), localRole, p.fsm.pConf.StrictRole)
+			if err != nil {
+				p.logger.Info("Neighbor:", p.fsm.pConf.NeighborAddress, "FSM", p.fsm.id,
+					"BGP role check failed, err:", err)
+				bgpErr := err.(packet.BGPMessageError)
+				msgErr = &bgpErr
+				msgOk = false
+			}
+		}
 	}
 
 	return msg, msgErr, msgOk
@@ -388,6 +422,16 @@ func (p *PeerConn) ReadPkt(doneCh chan bool, stopCh chan bool, exitCh chan bool)
 				continue
 			}
 
+			err = header.ValidateLen(packet.GetMaxMsgLen(p.peerAttrs.ExtendedMsg))
+			if err != nil {
+				p.logger.Info("Neighbor:", p.fsm.pConf.NeighborAddress, "FSM", p.fsm.id,
+					"BGP packet header validation failed, err:", err)
+				bgpErr := err.(packet.BGPMessageError)
+				p.fsm.pktRxCh <- packet.NewBGPPktInfo(nil, &bgpErr)
+				doneCh <- false
+				continue
+			}
+
 			if header.Type != packet.BGPMsgTypeKeepAlive {
 				p.logger.Info("Neighbor:", p.fsm.pConf.NeighborAddress, "FSM", p.fsm.id,
 					"Recieved BGP packet type=", header.Type, "len=", header.Len())
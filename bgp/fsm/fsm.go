@@ -27,12 +27,14 @@ package fsm
 import (
 	"bytes"
 	"fmt"
+	"l3/bgp/auth"
 	"l3/bgp/baseobjects"
 	"l3/bgp/config"
 	"l3/bgp/packet"
 	"net"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 	"utils/logging"
 )
@@ -435,7 +437,7 @@ func (st *OpenSentState) processEvent(event BGPFSMEvent, data interface{}) {
 
 	switch event {
 	case BGPEventManualStop:
-		st.fsm.SendNotificationMessage(packet.BGPCease, 0, nil)
+		st.fsm.SendAdminShutdownNotification()
 		st.fsm.StopConnectRetryTimer()
 		st.fsm.ClearPeerConn()
 		st.fsm.StopConnToPeer()
@@ -549,7 +551,7 @@ func (st *OpenConfirmState) processEvent(event BGPFSMEvent, data interface{}) {
 
 	switch event {
 	case BGPEventManualStop:
-		st.fsm.SendNotificationMessage(packet.BGPCease, 0, nil)
+		st.fsm.SendAdminShutdownNotification()
 		st.fsm.ClearPeerConn()
 		st.fsm.StopConnToPeer()
 		st.fsm.StopConnectRetryTimer()
@@ -666,7 +668,7 @@ func (st *EstablishedState) processEvent(event BGPFSMEvent, data interface{}) {
 
 	switch event {
 	case BGPEventManualStop:
-		st.fsm.SendNotificationMessage(packet.BGPCease, 0, nil)
+		st.fsm.SendAdminShutdownNotification()
 		st.fsm.StopConnectRetryTimer()
 		st.fsm.ClearPeerConn()
 		st.fsm.StopConnToPeer()
@@ -726,6 +728,7 @@ func (st *EstablishedState) processEvent(event BGPFSMEvent, data interface{}) {
 
 	case BGPEventUpdateMsgErr:
 		bgpMsgErr := data.(*packet.BGPMessageError)
+		atomic.AddUint32(&st.fsm.neighborConf.Neighbor.State.UpdateErrors.SessionReset, 1)
 		st.fsm.SendNotificationMessage(bgpMsgErr.TypeCode, bgpMsgErr.SubTypeCode, bgpMsgErr.Data)
 		st.fsm.StopConnectRetryTimer()
 		st.fsm.ClearPeerConn()
@@ -784,8 +787,9 @@ type PeerFSMConnState struct {
 }
 
 type PeerFSMEvent struct {
-	event  BGPFSMEvent
-	reason int
+	event   BGPFSMEvent
+	reason  int
+	message string
 }
 
 type FSM struct {
@@ -821,6 +825,8 @@ type FSM struct {
 	restartTime  uint32
 	restartTimer *time.Timer
 
+	shutdownMsg string
+
 	autoStart       bool
 	autoStop        bool
 	passiveTcpEst   bool
@@ -834,11 +840,18 @@ type FSM struct {
 	delayOpenTimer *time.Timer
 
 	afiSafiMap map[uint32]bool
+	maxMsgLen  uint32
 	pktTxCh    chan *packet.BGPMessage
 	pktRxCh    chan *packet.BGPPktInfo
 	eventRxCh  chan PeerFSMEvent
 	rxPktsFlag bool
 
+	afiSafiDisabled map[uint32]bool
+
+	aoKeys       *auth.AOKeyState
+	authKeyTimer *time.Timer
+	authKeysCh   chan bool
+
 	cleanup bool
 }
 
@@ -868,6 +881,8 @@ func NewFSM(fsmManager *FSMManager, id uint8, neighborConf *base.NeighborConf) *
 		dampPeerOscl:     false,
 		idleHoldTime:     BGPIdleHoldTimeDefault,
 		afiSafiMap:       make(map[uint32]bool),
+		maxMsgLen:        packet.BGPMsgMaxLen,
+		afiSafiDisabled:  make(map[uint32]bool),
 		cleanup:          false,
 	}
 
@@ -889,6 +904,10 @@ func NewFSM(fsmManager *FSMManager, id uint8, neighborConf *base.NeighborConf) *
 	fsm.restartTimer = time.NewTimer(time.Duration(5) * time.Second)
 	fsm.restartTimer.Stop()
 
+	fsm.authKeysCh = make(chan bool, 1)
+	fsm.authKeyTimer = time.NewTimer(time.Duration(5) * time.Second)
+	fsm.authKeyTimer.Stop()
+
 	return &fsm
 }
 
@@ -957,10 +976,13 @@ func (fsm *FSM) StartFSM() {
 				"Received event", fsmEvent.event, "reason", fsmEvent.reason)
 			if fsmEvent.reason == BGPCmdReasonMaxPrefixExceeded {
 				fsm.restartTime = uint32(fsm.neighborConf.RunningConf.MaxPrefixesRestartTimer)
+			} else if fsmEvent.reason == BGPCmdReasonAdminShutdown {
+				fsm.shutdownMsg = fsmEvent.message
 			}
 			fsm.ProcessEvent(fsmEvent.event, nil)
 			if fsmEvent.reason != BGPCmdReasonNone {
 				fsm.restartTime = 0
+				fsm.shutdownMsg = ""
 			}
 
 		case <-fsm.connectRetryTimer.C:
@@ -977,6 +999,12 @@ func (fsm *FSM) StartFSM() {
 
 		case <-fsm.restartTimer.C:
 			fsm.ProcessEvent(BGPEventAutoStart, nil)
+
+		case <-fsm.authKeyTimer.C:
+			fsm.updateAuthKeys()
+
+		case <-fsm.authKeysCh:
+			fsm.updateAuthKeys()
 		}
 	}
 }
@@ -1012,11 +1040,16 @@ func (fsm *FSM) ProcessPacket(msg *packet.BGPMessage, msgErr *packet.BGPMessageE
 			event = BGPEventUpdateMsg
 
 		case packet.BGPMsgTypeNotification:
-			fsm.neighborConf.Neighbor.State.Messages.Received.Notification++
 			event = BGPEventNotifMsg
 			notifyMsg := msg.Body.(*packet.BGPNotification)
+			fsm.neighborConf.NotificationReceived(notifyMsg.ErrorCode, notifyMsg.ErrorSubcode, notifyMsg.Data)
 			fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id,
 				"Received notification message:", notifyMsg.ErrorCode, notifyMsg.ErrorSubcode, notifyMsg.Data)
+			if shutdownMsg, ok := notifyMsg.GetShutdownCommunication(); ok {
+				fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id,
+					"Received shutdown communication:", shutdownMsg)
+				fsm.neighborConf.Neighbor.State.ShutdownMessage = shutdownMsg
+			}
 
 		case packet.BGPMsgTypeKeepAlive:
 			event = BGPEventKeepAliveMsg
@@ -1039,7 +1072,7 @@ func (fsm *FSM) ChangeState(newState BaseStateIface) {
 	fsm.State.leave()
 	fsm.State = newState
 	fsm.State.enter()
-	fsm.Manager.fsmStateChange(fsm.id, fsm.State.state())
+	fsm.Manager.fsmStateChange(fsm.id, fsm.State.state(), BGPEventTypeToStr[fsm.event])
 	if oldState == config.BGPFSMEstablished && fsm.State.state() != config.BGPFSMEstablished {
 		fsm.ConnBroken()
 	} else if oldState != config.BGPFSMEstablished && fsm.State.state() == config.BGPFSMEstablished {
@@ -1175,6 +1208,10 @@ func (fsm *FSM) ProcessOpenMessage(pkt *packet.BGPMessage) bool {
 		}
 	}
 
+	fsm.maxMsgLen = packet.GetMaxMsgLen(packet.IsExtendedMsgEnabled(body))
+	fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id, "Max message length set to",
+		fsm.maxMsgLen)
+
 	return fsm.Manager.receivedBGPOpenMessage(fsm.id, fsm.peerConn.dir, body)
 }
 
@@ -1182,6 +1219,7 @@ func (fsm *FSM) ProcessUpdateMessage(pkt *packet.BGPMessage) {
 	fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id,
 		"ProcessUpdateMessage: send message to server")
 	updateMsg := pkt.Body.(*packet.BGPUpdate)
+	fsm.processUpdateErrors(updateMsg)
 	for _, pa := range updateMsg.PathAttributes {
 		if mpReachNLRI, ok := pa.(*packet.BGPPathAttrMPReachNLRI); ok {
 			protoFamily := packet.GetProtocolFamily(mpReachNLRI.AFI, mpReachNLRI.SAFI)
@@ -1191,18 +1229,46 @@ func (fsm *FSM) ProcessUpdateMessage(pkt *packet.BGPMessage) {
 			}
 		}
 	}
+	if len(fsm.afiSafiDisabled) > 0 {
+		packet.RemoveMPAttrsForProtoFamilies(&updateMsg.PathAttributes, fsm.afiSafiDisabled)
+	}
 	atomic.AddUint32(&fsm.neighborConf.Neighbor.State.Queues.Input, 1)
 	go func() {
 		fsm.Manager.bgpPktSrcCh <- packet.NewBGPPktSrc(fsm.Manager.neighborConf.Neighbor.NeighborAddress.String(), pkt)
 	}()
 }
 
+func (fsm *FSM) processUpdateErrors(updateMsg *packet.BGPUpdate) {
+	counters := &fsm.neighborConf.Neighbor.State.UpdateErrors
+	for _, attrErr := range updateMsg.AttrErrors {
+		fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id, "Update message path attr",
+			attrErr.Code, "error:", attrErr.Err, "action:", packet.BGPUpdateErrorActionToStrMap[attrErr.Action])
+		switch attrErr.Action {
+		case packet.BGPUpdateErrorActionAttrDiscard:
+			atomic.AddUint32(&counters.AttrDiscard, 1)
+
+		case packet.BGPUpdateErrorActionTreatAsWithdraw:
+			atomic.AddUint32(&counters.TreatAsWithdraw, 1)
+
+		case packet.BGPUpdateErrorActionAfiSafiDisable:
+			atomic.AddUint32(&counters.AfiSafiDisable, 1)
+			if !fsm.afiSafiDisabled[attrErr.ProtoFamily] {
+				afi, safi := packet.GetAfiSafi(attrErr.ProtoFamily)
+				fsm.logger.Warning("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id,
+					"Disable AFI", afi, "SAFI", safi, "for the session")
+				fsm.afiSafiDisabled[attrErr.ProtoFamily] = true
+				delete(fsm.afiSafiMap, attrErr.ProtoFamily)
+			}
+		}
+	}
+}
+
 func (fsm *FSM) sendUpdateMessage(bgpMsg *packet.BGPMessage) {
-	updateMsgs := packet.ConstructMaxSizedUpdatePackets(bgpMsg)
+	updateMsgs := packet.ConstructMaxSizedUpdatePackets(bgpMsg, fsm.maxMsgLen)
 	atomic.AddUint32(&fsm.neighborConf.Neighbor.State.Queues.Output, ^uint32(0))
 
 	for idx, _ := range updateMsgs {
-		packet, _ := updateMsgs[idx].Encode()
+		packet, _ := updateMsgs[idx].EncodeWithMaxLen(fsm.maxMsgLen)
 		fsm.logger.Infof("Neighbor:%s FSM %d Tx BGP UPDATE %x", fsm.pConf.NeighborAddress, fsm.id, packet)
 
 		num, err := (*fsm.peerConn.conn).Write(packet)
@@ -1222,7 +1288,8 @@ func (fsm *FSM) sendOpenMessage() {
 	fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id,
 		"sendOpenMessage: send address family", fsm.neighborConf.AfiSafiMap)
 	optParams := packet.ConstructOptParams(uint32(fsm.pConf.LocalAS), fsm.neighborConf.AfiSafiMap,
-		fsm.neighborConf.RunningConf.AddPathsRx, fsm.neighborConf.RunningConf.AddPathsMaxTx)
+		fsm.neighborConf.RunningConf.AddPathsRx, fsm.neighborConf.RunningConf.AddPathsMaxTx,
+		fsm.neighborConf.RunningConf.Role)
 	bgpOpenMsg := packet.NewBGPOpenMessage(fsm.pConf.LocalAS, uint16(fsm.holdTime), fsm.gConf.RouterId.To4().String(), optParams)
 	packet, _ := bgpOpenMsg.Encode()
 	num, err := (*fsm.peerConn.conn).Write(packet)
@@ -1247,19 +1314,31 @@ func (fsm *FSM) sendKeepAliveMessage() {
 }
 
 func (fsm *FSM) SendNotificationMessage(code uint8, subCode uint8, data []byte) {
-	bgpNotifMsg := packet.NewBGPNotificationMessage(code, subCode, data)
-	packet, _ := bgpNotifMsg.Encode()
-	num, err := (*fsm.peerConn.conn).Write(packet)
+	fsm.sendNotification(packet.NewBGPNotificationMessageWithMaxLen(code, subCode, data, fsm.maxMsgLen))
+}
+
+func (fsm *FSM) sendNotification(bgpNotifMsg *packet.BGPMessage) {
+	pkt, _ := bgpNotifMsg.EncodeWithMaxLen(fsm.maxMsgLen)
+	num, err := (*fsm.peerConn.conn).Write(pkt)
 	if err != nil {
 		fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id,
 			"Conn.Write failed to send Notification message with error:", err)
 		return
 	}
-	fsm.neighborConf.Neighbor.State.Messages.Sent.Notification++
+	notif := bgpNotifMsg.Body.(*packet.BGPNotification)
+	fsm.neighborConf.NotificationSent(notif.ErrorCode, notif.ErrorSubcode, notif.Data)
 	fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id,
 		"Conn.Write succeeded. sent Notification message with", num, "bytes")
 }
 
+/*
+ * SendAdminShutdownNotification sends the Cease/Administrative Shutdown notification along with the operator
+ * message of the shutdown command, RFC 8203.
+ */
+func (fsm *FSM) SendAdminShutdownNotification() {
+	fsm.sendNotification(packet.NewBGPShutdownNotificationMessage(packet.BGPCeaseAdminShutdown, fsm.shutdownMsg))
+}
+
 func (fsm *FSM) SetPeerConn(data interface{}) {
 	fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id, "SetPeerConn called")
 	if fsm.peerConn != nil {
@@ -1269,6 +1348,12 @@ func (fsm *FSM) SetPeerConn(data interface{}) {
 	}
 	pConnDir := data.(PeerConnDir)
 	fsm.peerConn = NewPeerConn(fsm, pConnDir.connDir, pConnDir.conn)
+	if chain := fsm.neighborConf.GetKeyChain(); chain != nil && fsm.neighborConf.IsAOEnabled() {
+		// The keys were installed before the connect or copied from the listening socket
+		fsm.aoKeys = auth.NewAOKeyState(fsm.pConf.NeighborAddress)
+		fsm.aoKeys.Inherit(chain)
+		fsm.updateAuthKeys()
+	}
 	go fsm.peerConn.StartReading()
 }
 
@@ -1281,10 +1366,48 @@ func (fsm *FSM) ClearPeerConn() {
 	}
 	fsm.StopKeepAliveTimer()
 	fsm.StopHoldTimer()
+	fsm.authKeyTimer.Stop()
+	fsm.aoKeys = nil
+	fsm.neighborConf.Neighbor.State.AuthActiveKeyId = auth.AuthKeyIdNone
 	fsm.peerConn.StopReading()
 	<-fsm.peerConn.exitCh
 	fsm.logger.Info("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id, "Conn exited")
 	fsm.peerConn = nil
+	fsm.maxMsgLen = packet.BGPMsgMaxLen
+	fsm.afiSafiDisabled = make(map[uint32]bool)
+}
+
+/*
+ * updateAuthKeys installs the TCP-AO keys of the key chain that are active now on the connection and
+ * restarts the timer for the next key change.
+ */
+func (fsm *FSM) updateAuthKeys() {
+	chain := fsm.neighborConf.GetKeyChain()
+	if fsm.peerConn == nil || fsm.aoKeys == nil || chain == nil || !fsm.neighborConf.IsAOEnabled() {
+		return
+	}
+
+	conn, ok := (*fsm.peerConn.conn).(syscall.Conn)
+	if !ok {
+		fsm.logger.Err("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id,
+			"Can't update TCP-AO keys, connection does not support socket options")
+		return
+	}
+
+	now := time.Now()
+	err := auth.ControlFd(conn, func(fd int) error {
+		return fsm.aoKeys.Sync(fd, chain, now)
+	})
+	if err != nil {
+		fsm.logger.Err("Neighbor:", fsm.pConf.NeighborAddress, "FSM", fsm.id,
+			"Failed to update TCP-AO keys with error", err)
+	}
+	fsm.neighborConf.Neighbor.State.AuthActiveKeyId = fsm.aoKeys.GetSendKeyId()
+
+	fsm.authKeyTimer.Stop()
+	if next := chain.GetNextChange(now); !next.IsZero() {
+		fsm.authKeyTimer.Reset(next.Sub(now))
+	}
 }
 
 func (fsm *FSM) startRxPkts() {
@@ -1340,6 +1463,7 @@ func (fsm *FSM) InitiateConnToPeer() {
 		local = net.JoinHostPort(strings.TrimSpace(fsm.pConf.UpdateSource), "0")
 	}
 	if fsm.outTCPConn == nil {
+		fsm.neighborConf.IncrConnectionAttempts()
 		fsm.outTCPConn = NewOutTCPConn(fsm, fsm.outConnCh, fsm.outConnErrCh)
 		go fsm.outTCPConn.ConnectToPeer(fsm.connectRetryTime, remote, local)
 	}
@@ -57,11 +57,13 @@ type PeerAttrs struct {
 const (
 	BGPCmdReasonNone int = iota
 	BGPCmdReasonMaxPrefixExceeded
+	BGPCmdReasonAdminShutdown
 )
 
 type PeerFSMCommand struct {
 	Command int
 	Reason  int
+	Message string
 }
 
 type FSMManager struct {
@@ -81,6 +83,7 @@ type FSMManager struct {
 	StopFSMCh      chan string
 	acceptConn     bool
 	CommandCh      chan PeerFSMCommand
+	AuthKeysCh     chan bool
 	activeFSM      uint8
 	newConnCh      chan PeerFSMConnState
 	fsmMutex       sync.RWMutex
@@ -104,6 +107,7 @@ func NewFSMManager(logger *logging.Writer, neighborConf *base.NeighborConf, bgpP
 	mgr.CloseCh = make(chan bool)
 	mgr.StopFSMCh = make(chan string)
 	mgr.CommandCh = make(chan PeerFSMCommand, 5)
+	mgr.AuthKeysCh = make(chan bool, 1)
 	mgr.activeFSM = uint8(config.ConnDirInvalid)
 	mgr.newConnCh = make(chan PeerFSMConnState, 2)
 	mgr.fsmMutex = sync.RWMutex{}
@@ -166,6 +170,16 @@ func (mgr *FSMManager) Init() {
 			mgr.Cleanup()
 			return
 
+		case <-mgr.AuthKeysCh:
+			for _, fsm := range mgr.fsms {
+				if fsm != nil {
+					select {
+					case fsm.authKeysCh <- true:
+					default:
+					}
+				}
+			}
+
 		case fsmCommand := <-mgr.CommandCh:
 			event := BGPFSMEvent(fsmCommand.Command)
 			mgr.logger.Infof("FSMManager: Neighbor %s: Received FSM command %d",
@@ -176,7 +190,7 @@ func (mgr *FSMManager) Init() {
 					if fsm != nil {
 						mgr.logger.Infof("FSMManager: Neighbor %s: FSM %d Send command %d",
 							mgr.pConf.NeighborAddress, id, event)
-						fsm.eventRxCh <- PeerFSMEvent{event, fsmCommand.Reason}
+						fsm.eventRxCh <- PeerFSMEvent{event, fsmCommand.Reason, fsmCommand.Message}
 					}
 				}
 			}
@@ -236,9 +250,9 @@ func (mgr *FSMManager) fsmBroken(id uint8, fsmDelete bool) {
 	}
 }
 
-func (mgr *FSMManager) fsmStateChange(id uint8, state config.BGPFSMState) {
+func (mgr *FSMManager) fsmStateChange(id uint8, state config.BGPFSMState, event string) {
 	if mgr.activeFSM == id || mgr.activeFSM == uint8(config.ConnDirInvalid) {
-		mgr.neighborConf.FSMStateChange(uint32(state))
+		mgr.neighborConf.FSMStateChange(uint32(state), event)
 	}
 }
 
@@ -277,7 +291,7 @@ func (mgr *FSMManager) StopFSM(stopMsg string) {
 	for id, fsm := range mgr.fsms {
 		if fsm != nil {
 			mgr.logger.Infof("FSMManager: Neighbor %s FSM %d - Stop FSM", mgr.pConf.NeighborAddress, id)
-			fsm.eventRxCh <- PeerFSMEvent{BGPEventTcpConnFails, BGPCmdReasonNone}
+			fsm.eventRxCh <- PeerFSMEvent{BGPEventTcpConnFails, BGPCmdReasonNone, ""}
 			mgr.fsmBroken(id, false)
 		}
 	}
@@ -356,6 +370,8 @@ func (mgr *FSMManager) receivedBGPOpenMessage(id uint8, connDir config.ConnDir,
 		asSize := packet.GetASSize(openMsg)
 		addPathFamily := packet.GetAddPathFamily(openMsg)
 		mgr.neighborConf.SetPeerAttrs(openMsg.BGPId, asSize, mgr.fsms[id].holdTime, mgr.fsms[id].keepAliveTime, addPathFamily)
+		peerRole, found, _ := packet.GetRole(openMsg)
+		mgr.neighborConf.SetPeerRole(peerRole, found)
 	}
 
 	if closeConnDir == connDir {
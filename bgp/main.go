@@ -87,10 +87,17 @@ func main() {
 	case OVSDB_PLUGIN:
 		// if plugin used is ovs db then lets start ovsdb client listener
 		quit := make(chan bool)
-		rMgr := ovsMgr.NewOvsRouteMgr()
-		pMgr := ovsMgr.NewOvsPolicyMgr()
+		rMgr, err := ovsMgr.NewOvsRouteMgr(logger)
+		if err != nil {
+			return
+		}
+		pMgr, err := ovsMgr.NewOvsPolicyMgr(logger)
+		if err != nil {
+			return
+		}
 		iMgr := ovsMgr.NewOvsIntfMgr()
 		bMgr := ovsMgr.NewOvsBfdMgr()
+		lsMgr := ovsMgr.NewOvsLinkStateMgr(logger)
 		sDBMgr, err := statedbclient.NewStateDBClient(statedbclient.OVSPlugin, logger)
 		if err != nil {
 			logger.Info(fmt.Sprintln("Starting OVDB state DB client failed ERROR:", err))
@@ -100,9 +107,12 @@ func main() {
 		// starting bgp policy engine...
 		logger.Info(fmt.Sprintln("Starting BGP policy engine..."))
 		bgpPolicyMgr := bgppolicy.NewPolicyManager(logger, pMgr)
+		// ovsdb route and policy managers use the api layer once they are started
+		api.InitPolicy(bgpPolicyMgr)
 		go bgpPolicyMgr.StartPolicyEngine()
 
-		bgpServer := server.NewBGPServer(logger, bgpPolicyMgr, iMgr, rMgr, bMgr, sDBMgr)
+		bgpServer := server.NewBGPServer(logger, bgpPolicyMgr, iMgr, rMgr, bMgr, lsMgr, sDBMgr)
+		api.Init(bgpServer)
 		go bgpServer.StartServer()
 
 		logger.Info(fmt.Sprintln("Starting config listener..."))
@@ -138,6 +148,7 @@ func main() {
 			return
 		}
 		pMgr := FSMgr.NewFSPolicyMgr(logger, fileName)
+		lsMgr := FSMgr.NewFSLinkStateMgr(logger, fileName)
 		sDBMgr, err := statedbclient.NewStateDBClient(statedbclient.FlexSwitchPlugin, logger)
 		if err != nil {
 			return
@@ -149,7 +160,7 @@ func main() {
 
 		logger.Info(fmt.Sprintln("Starting BGP Server..."))
 
-		bgpServer := server.NewBGPServer(logger, bgpPolicyMgr, iMgr, rMgr, bMgr, sDBMgr)
+		bgpServer := server.NewBGPServer(logger, bgpPolicyMgr, iMgr, rMgr, bMgr, lsMgr, sDBMgr)
 		go bgpServer.StartServer()
 
 		api.InitPolicy(bgpPolicyMgr)
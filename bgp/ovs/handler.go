@@ -79,13 +79,11 @@ func NewBGPOvsdbNotifier(ch chan *ovsdb.TableUpdates) *BGPOvsdbNotifier {
 }
 
 func NewBGPOvsdbHandler(logger *logging.Writer, handler *rpc.BGPHandler) (*BGPOvsdbHandler, error) {
-	ovs, err := ovsdb.Connect(OVSDB_HANDLER_HOST_IP, OVSDB_HANDLER_HOST_PORT)
+	ovsUpdateCh := make(chan *ovsdb.TableUpdates)
+	ovs, err := connectOvsdb(ovsUpdateCh)
 	if err != nil {
 		return nil, err
 	}
-	ovsUpdateCh := make(chan *ovsdb.TableUpdates)
-	n := NewBGPOvsdbNotifier(ovsUpdateCh)
-	ovs.Register(n)
 
 	return &BGPOvsdbHandler{
 		logger:         logger,
@@ -102,17 +100,35 @@ func NewBGPOvsdbHandler(logger *logging.Writer, handler *rpc.BGPHandler) (*BGPOv
  *  notification channel
  */
 func (ovsHdl *BGPOvsdbHandler) PopulateOvsdbCache(updates ovsdb.TableUpdates) {
+	populateOvsdbCache(ovsHdl.cache, updates)
+}
+
+/*  Connect to the ovsdb server and register a notifier that sends the table
+ *  updates on updateCh
+ */
+func connectOvsdb(updateCh chan *ovsdb.TableUpdates) (*ovsdb.OvsdbClient, error) {
+	ovs, err := ovsdb.Connect(OVSDB_HANDLER_HOST_IP, OVSDB_HANDLER_HOST_PORT)
+	if err != nil {
+		return nil, err
+	}
+	ovs.Register(NewBGPOvsdbNotifier(updateCh))
+	return ovs, nil
+}
+
+/*  Apply the table updates to a cache of table name -> row uuid -> row
+ */
+func populateOvsdbCache(cache map[string]map[string]ovsdb.Row, updates ovsdb.TableUpdates) {
 	for table, tableUpdate := range updates.Updates {
-		if _, ok := ovsHdl.cache[table]; !ok {
-			ovsHdl.cache[table] = make(map[string]ovsdb.Row)
+		if _, ok := cache[table]; !ok {
+			cache[table] = make(map[string]ovsdb.Row)
 		}
 
 		for uuid, row := range tableUpdate.Rows {
 			empty := ovsdb.Row{}
 			if !reflect.DeepEqual(row.New, empty) {
-				ovsHdl.cache[table][uuid] = row.New
+				cache[table][uuid] = row.New
 			} else {
-				delete(ovsHdl.cache[table], uuid)
+				delete(cache[table], uuid)
 			}
 		}
 	}
@@ -34,12 +34,18 @@ import (
 )
 
 const (
-	OVSDB_DEFAULT_VRF          = "vrf_default"
-	OVSDB_BGP_ROUTER_TABLE     = "BGP_Router"
-	OVSDB_BGP_NEIGHBOR_TABLE   = "BGP_Neighbor"
-	OVSDB_VRF_TABLE            = "VRF"
-	OVSDB_BGP_NEIGHBOR_ENTRIES = "bgp_neighbors"
-	OVSDB_BGP_ROUTER_ENTRIES   = "bgp_routers"
+	OVSDB_DEFAULT_VRF           = "vrf_default"
+	OVSDB_BGP_ROUTER_TABLE      = "BGP_Router"
+	OVSDB_BGP_NEIGHBOR_TABLE    = "BGP_Neighbor"
+	OVSDB_VRF_TABLE             = "VRF"
+	OVSDB_BGP_NEIGHBOR_ENTRIES  = "bgp_neighbors"
+	OVSDB_BGP_ROUTER_ENTRIES    = "bgp_routers"
+	OVSDB_ROUTE_TABLE           = "Route"
+	OVSDB_NEXTHOP_TABLE         = "Nexthop"
+	OVSDB_PREFIX_LIST_TABLE     = "Prefix_List"
+	OVSDB_PREFIX_ENTRY_TABLE    = "Prefix_List_Entry"
+	OVSDB_ROUTE_MAP_TABLE       = "Route_Map"
+	OVSDB_ROUTE_MAP_ENTRY_TABLE = "Route_Map_Entry"
 )
 
 type UUID string
@@ -61,14 +67,87 @@ func sameUUID(src UUID, dst string) bool {
  *	value: [uuid 4c682c17-8499-4abd-b359-ffaea8f2f79b]
  */
 func (ovsHdl *BGPOvsdbHandler) getObjUUID(val interface{}) UUID {
-	retVal, exists := val.([]interface{})
-	if !exists {
-		return ""
+	return getUUIDFromValue(val)
+}
+
+/*  Get uuid from a column value. The value is either decoded by the ovsdb
+ *  library or still in the wire format [uuid 4c682c17-8499-4abd-b359-ffaea8f2f79b]
+ */
+func getUUIDFromValue(val interface{}) UUID {
+	switch value := val.(type) {
+	case ovsdb.UUID:
+		return UUID(value.GoUuid)
+	case []interface{}:
+		if len(value) != 2 {
+			return ""
+		}
+		if kind, ok := value[0].(string); !ok || kind != "uuid" {
+			return ""
+		}
+		id, _ := value[1].(string)
+		return UUID(id)
+	}
+	return ""
+}
+
+/*  Get the elements of a set column. A set with a single element is sent as the
+ *  element itself.
+ */
+func getSetFromValue(val interface{}) []interface{} {
+	switch value := val.(type) {
+	case nil:
+		return nil
+	case ovsdb.OvsSet:
+		return value.GoSet
+	case *ovsdb.OvsSet:
+		return value.GoSet
 	}
-	if len(retVal) != 2 || retVal[0].(string) != "uuid" {
-		return ""
+	return []interface{}{val}
+}
+
+/*  Get the value of an optional string column
+ */
+func getStringFromValue(val interface{}) (string, bool) {
+	elems := getSetFromValue(val)
+	if len(elems) != 1 {
+		return "", false
 	}
-	return UUID(retVal[1].(string))
+	str, ok := elems[0].(string)
+	return str, ok
+}
+
+/*  Get the value of an optional integer column
+ */
+func getIntFromValue(val interface{}) (int, bool) {
+	elems := getSetFromValue(val)
+	if len(elems) != 1 {
+		return 0, false
+	}
+	num, ok := elems[0].(float64)
+	return int(num), ok
+}
+
+/*  Get the value of an optional boolean column
+ */
+func getBoolFromValue(val interface{}) (bool, bool) {
+	elems := getSetFromValue(val)
+	if len(elems) != 1 {
+		return false, false
+	}
+	b, ok := elems[0].(bool)
+	return b, ok
+}
+
+/*  Get the go map from a map column
+ */
+func getMapFromValue(val interface{}) map[interface{}]interface{} {
+	switch value := val.(type) {
+	case ovsdb.OvsMap:
+		return value.GoMap
+	case *ovsdb.OvsMap:
+		return value.GoMap
+	}
+	return nil
 }
 
 /*  Lets get asn number for the local bgp and also get the ovsdb BGP_Router uuid
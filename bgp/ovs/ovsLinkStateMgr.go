@@ -0,0 +1,109 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package ovsMgr
+
+import (
+	"encoding/json"
+	"l3/bgp/api"
+	"l3/bgp/bgpdCommonDefs"
+	"l3/ospf/ospfdCommonDefs"
+	"utils/logging"
+
+	nanomsg "github.com/op/go-nanomsg"
+)
+
+/*  Constructor for link state manager
+ */
+func NewOvsLinkStateMgr(logger *logging.Writer) *OvsLinkStateMgr {
+	mgr := &OvsLinkStateMgr{
+		plugin: "ovsdb",
+		logger: logger,
+	}
+
+	return mgr
+}
+
+/*  ospfd publishes the link state database on the same socket for all the plugins
+ */
+func (mgr *OvsLinkStateMgr) Start() {
+	pubSocket, err := nanomsg.NewPubSocket()
+	if err != nil {
+		mgr.logger.Err("Link state manager failed to create publish socket, error:", err)
+	} else if _, err = pubSocket.Bind(bgpdCommonDefs.PUB_SOCKET_ADDR); err != nil {
+		mgr.logger.Err("Link state manager failed to bind to", bgpdCommonDefs.PUB_SOCKET_ADDR, "error:", err)
+	} else {
+		mgr.pubSocket = pubSocket
+	}
+
+	socket, err := nanomsg.NewSubSocket()
+	if err != nil {
+		mgr.logger.Err("Link state manager failed to create subscribe socket, error:", err)
+		return
+	}
+	if err = socket.Subscribe(""); err != nil {
+		mgr.logger.Err("Link state manager failed to subscribe, error:", err)
+		return
+	}
+	if _, err = socket.Connect(ospfdCommonDefs.PUB_SOCKET_ADDR); err != nil {
+		mgr.logger.Err("Link state manager failed to connect to", ospfdCommonDefs.PUB_SOCKET_ADDR, "error:", err)
+		return
+	}
+	if err = socket.SetRecvBuffer(1024 * 1024); err != nil {
+		mgr.logger.Err("Link state manager failed to set the receive buffer size, error:", err)
+		return
+	}
+	mgr.lsSubSocket = socket
+	go mgr.listenForLinkStateNotifications()
+}
+
+func (mgr *OvsLinkStateMgr) listenForLinkStateNotifications() {
+	for {
+		rxBuf, err := mgr.lsSubSocket.Recv(0)
+		if err != nil {
+			mgr.logger.Err("Recv on OSPF subscriber socket failed with error:", err)
+			continue
+		}
+		if err = api.SendOspfLinkStateNotification(rxBuf); err != nil {
+			mgr.logger.Err("Failed to handle OSPF link state notification, error:", err)
+		}
+	}
+}
+
+/*  Tell ospfd that BGP converged
+ */
+func (mgr *OvsLinkStateMgr) NotifyConverged() {
+	if mgr.pubSocket == nil {
+		return
+	}
+	buf, err := json.Marshal(bgpdCommonDefs.BgpdNotifyMsg{
+		MsgType: bgpdCommonDefs.NOTIFY_BGP_CONVERGED,
+	})
+	if err != nil {
+		mgr.logger.Err("Failed to encode BGP converged notification, error:", err)
+		return
+	}
+	if _, err = mgr.pubSocket.Send(buf, nanomsg.DontWait); err != nil {
+		mgr.logger.Err("Failed to send BGP converged notification, error:", err)
+	}
+}
@@ -23,18 +23,57 @@
 
 package ovsMgr
 
+import (
+	"l3/bgp/config"
+	"sync"
+	"utils/logging"
+	utilspolicy "utils/policy"
+
+	nanomsg "github.com/op/go-nanomsg"
+	ovsdb "github.com/socketplane/libovsdb"
+)
+
 type OvsIntfMgr struct {
 	plugin string
 }
 
+/*  Route manager writes the BGP routes to the ovsdb Route/Nexthop tables and
+ *  reads the routes of other protocols for redistribution
+ */
 type OvsRouteMgr struct {
-	plugin string
+	plugin       string
+	logger       *logging.Writer
+	ovsClient    *ovsdb.OvsdbClient
+	updateCh     chan *ovsdb.TableUpdates
+	redistCh     chan bool
+	cacheMutex   sync.RWMutex
+	cache        map[string]map[string]ovsdb.Row
+	redistProtos map[string]bool
+	redistRoutes map[string]*config.RouteInfo
+	nextHops     map[string]bool
 }
 
+/*  Policy manager maps the ovsdb route maps and prefix lists to policy
+ *  definitions, statements and conditions
+ */
 type OvsPolicyMgr struct {
-	plugin string
+	plugin      string
+	logger      *logging.Writer
+	ovsClient   *ovsdb.OvsdbClient
+	updateCh    chan *ovsdb.TableUpdates
+	cache       map[string]map[string]ovsdb.Row
+	conditions  map[string]utilspolicy.PolicyConditionConfig
+	stmts       map[string]utilspolicy.PolicyStmtConfig
+	definitions map[string]utilspolicy.PolicyDefinitionConfig
 }
 
 type OvsBfdMgr struct {
 	plugin string
 }
+
+type OvsLinkStateMgr struct {
+	plugin      string
+	logger      *logging.Writer
+	lsSubSocket *nanomsg.SubSocket
+	pubSocket   *nanomsg.PubSocket
+}
@@ -23,16 +23,338 @@
 
 package ovsMgr
 
+import (
+	"errors"
+	"fmt"
+	"l3/bgp/api"
+	bgppolicy "l3/bgp/policy"
+	"net"
+	"reflect"
+	"sort"
+	"utils/logging"
+	utilspolicy "utils/policy"
+
+	ovsdb "github.com/socketplane/libovsdb"
+)
+
+const (
+	OVSDB_ACTION_PERMIT           = "permit"
+	OVSDB_MATCH_PREFIX_LIST       = "prefix_list"
+	OVSDB_MATCH_IPV6_PREFIX_LIST  = "ipv6_address_prefix_list"
+	OVSDB_POLICY_MATCH_TYPE_ANY   = "any"
+	OVSDB_POLICY_MATCH_DST_PREFIX = "MatchDstIpPrefix"
+)
+
 /*  Constructor for policy manager
  */
-func NewOvsPolicyMgr() *OvsPolicyMgr {
+func NewOvsPolicyMgr(logger *logging.Writer) (*OvsPolicyMgr, error) {
+	updateCh := make(chan *ovsdb.TableUpdates)
+	ovs, err := connectOvsdb(updateCh)
+	if err != nil {
+		logger.Err("Failed to connect to ovsdb, error:", err)
+		return nil, err
+	}
+
 	mgr := &OvsPolicyMgr{
-		plugin: "ovsdb",
+		plugin:      "ovsdb",
+		logger:      logger,
+		ovsClient:   ovs,
+		updateCh:    updateCh,
+		cache:       make(map[string]map[string]ovsdb.Row),
+		conditions:  make(map[string]utilspolicy.PolicyConditionConfig),
+		stmts:       make(map[string]utilspolicy.PolicyStmtConfig),
+		definitions: make(map[string]utilspolicy.PolicyDefinitionConfig),
 	}
 
-	return mgr
+	return mgr, nil
 }
 
+/*  Start is called from the policy engine goroutine before it reads the config
+ *  channels and hence the ovsdb tables are read in a separate goroutine.
+ */
 func (mgr *OvsPolicyMgr) Start() {
+	mgr.logger.Info("Starting ovsdb policyMgr")
+	go mgr.listenForPolicyUpdates()
+}
+
+func (mgr *OvsPolicyMgr) listenForPolicyUpdates() {
+	initial, err := mgr.ovsClient.MonitorAll(OVSDB_HANDLER_DB_TABLE, "")
+	if err != nil {
+		mgr.logger.Err("Policy manager failed to monitor ovsdb, error:", err)
+		return
+	}
+
+	updates := initial
+	for {
+		populateOvsdbCache(mgr.cache, *updates)
+		for _, table := range []string{OVSDB_PREFIX_LIST_TABLE, OVSDB_PREFIX_ENTRY_TABLE, OVSDB_ROUTE_MAP_TABLE,
+			OVSDB_ROUTE_MAP_ENTRY_TABLE} {
+			if _, ok := updates.Updates[table]; ok {
+				mgr.syncPolicies()
+				break
+			}
+		}
+		updates = <-mgr.updateCh
+	}
+}
+
+/*  Get the rows of an ovsdb map column of sequence number -> row uuid sorted on
+ *  the sequence number
+ */
+func (mgr *OvsPolicyMgr) getSortedEntries(val interface{}, table string) ([]int, []ovsdb.Row) {
+	seqs := make([]int, 0)
+	rows := make(map[int]ovsdb.Row)
+	for key, value := range getMapFromValue(val) {
+		seq, ok := key.(float64)
+		if !ok {
+			continue
+		}
+		row, ok := mgr.cache[table][string(getUUIDFromValue(value))]
+		if !ok {
+			continue
+		}
+		seqs = append(seqs, int(seq))
+		rows[int(seq)] = row
+	}
 
+	sort.Ints(seqs)
+	sortedRows := make([]ovsdb.Row, 0, len(seqs))
+	for _, seq := range seqs {
+		sortedRows = append(sortedRows, rows[seq])
+	}
+	return seqs, sortedRows
+}
+
+/*  Prefix list entries are converted to destination prefix match conditions.
+ *  The entries are matched in sequence order and a deny entry stops the match,
+ *  which a policy condition can't express. Deny entries after the last permit
+ *  entry are the same as the implicit deny at the end of the list and are
+ *  dropped, a prefix list with a deny entry before a permit entry is rejected.
+ */
+func (mgr *OvsPolicyMgr) convertPrefixList(prefixList ovsdb.Row,
+	conditions map[string]utilspolicy.PolicyConditionConfig) (string, []string, error) {
+	name, _ := prefixList.Fields["name"].(string)
+	listConds := make(map[string]utilspolicy.PolicyConditionConfig)
+	condNames := make([]string, 0)
+	denySeq := -1
+	seqs, entries := mgr.getSortedEntries(prefixList.Fields["prefix_list_entries"], OVSDB_PREFIX_ENTRY_TABLE)
+	for idx, entry := range entries {
+		if action, _ := entry.Fields["action"].(string); action != OVSDB_ACTION_PERMIT {
+			if denySeq == -1 {
+				denySeq = seqs[idx]
+			}
+			continue
+		}
+		if denySeq != -1 {
+			return name, nil, errors.New(fmt.Sprintf("Prefix list %s deny entry seq %d before permit entry seq %d "+
+				"is not supported", name, denySeq, seqs[idx]))
+		}
+
+		prefix, _ := entry.Fields["prefix"].(string)
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return name, nil, errors.New(fmt.Sprintf("Prefix list %s seq %d invalid prefix %s", name, seqs[idx],
+				prefix))
+		}
+
+		ones, bits := ipNet.Mask.Size()
+		lenRange := "exact"
+		ge, geOk := getIntFromValue(entry.Fields["ge"])
+		le, leOk := getIntFromValue(entry.Fields["le"])
+		if geOk || leOk {
+			if !geOk {
+				ge = ones
+			}
+			if !leOk {
+				le = bits
+			}
+			lenRange = fmt.Sprintf("%d-%d", ge, le)
+		}
+
+		condName := fmt.Sprintf("%s_%d", name, seqs[idx])
+		listConds[condName] = utilspolicy.PolicyConditionConfig{
+			Name:          condName,
+			ConditionType: OVSDB_POLICY_MATCH_DST_PREFIX,
+			MatchDstIpPrefixConditionInfo: utilspolicy.PolicyDstIpMatchPrefixSetCondition{
+				Prefix: utilspolicy.PolicyPrefix{
+					IpPrefix:        ipNet.String(),
+					MasklengthRange: lenRange,
+				},
+			},
+		}
+		condNames = append(condNames, condName)
+	}
+
+	if denySeq != -1 {
+		mgr.logger.Info("Prefix list", name, "deny entries from seq", denySeq, "match the implicit deny")
+	}
+	for condName, cond := range listConds {
+		conditions[condName] = cond
+	}
+	return name, condNames, nil
+}
+
+/*  Route map entries are converted to policy statements and the route map to
+ *  a policy definition that applies the first statement that matches. A route
+ *  map that uses a rejected prefix list is rejected.
+ */
+func (mgr *OvsPolicyMgr) convertRouteMap(routeMap ovsdb.Row, prefixLists map[string][]string,
+	rejectedLists map[string]bool, stmts map[string]utilspolicy.PolicyStmtConfig, definitions map[string]utilspolicy.PolicyDefinitionConfig) {
+	name, _ := routeMap.Fields["name"].(string)
+	stmtPrecedenceList := make([]utilspolicy.PolicyDefinitionStmtPrecedence, 0)
+	seqs, entries := mgr.getSortedEntries(routeMap.Fields["route_map_entries"], OVSDB_ROUTE_MAP_ENTRY_TABLE)
+	for idx, entry := range entries {
+		stmtName := fmt.Sprintf("%s_%d", name, seqs[idx])
+		action, _ := entry.Fields["action"].(string)
+		stmt := utilspolicy.PolicyStmtConfig{
+			Name:            stmtName,
+			MatchConditions: OVSDB_POLICY_MATCH_TYPE_ANY,
+			Conditions:      make([]string, 0),
+			Actions:         []string{action},
+		}
+
+		valid := true
+		for key, value := range getMapFromValue(entry.Fields["match"]) {
+			matchType, _ := key.(string)
+			matchValue, _ := value.(string)
+			if matchType != OVSDB_MATCH_PREFIX_LIST && matchType != OVSDB_MATCH_IPV6_PREFIX_LIST {
+				mgr.logger.Info("Route map", name, "seq", seqs[idx], "match", matchType, "is not supported")
+				continue
+			}
+
+			if rejectedLists[matchValue] {
+				mgr.logger.Err("Route map", name, "seq", seqs[idx], "uses rejected prefix list", matchValue)
+				return
+			}
+
+			// A statement without conditions matches all the routes
+			condNames := prefixLists[matchValue]
+			if len(condNames) == 0 {
+				mgr.logger.Info("Route map", name, "seq", seqs[idx], "prefix list", matchValue,
+					"has no permit entries")
+				valid = false
+				break
+			}
+			stmt.Conditions = append(stmt.Conditions, condNames...)
+		}
+		if !valid {
+			continue
+		}
+
+		stmts[stmtName] = stmt
+		stmtPrecedenceList = append(stmtPrecedenceList, utilspolicy.PolicyDefinitionStmtPrecedence{
+			Precedence: seqs[idx],
+			Statement:  stmtName,
+		})
+	}
+
+	if len(stmtPrecedenceList) == 0 {
+		return
+	}
+	definitions[name] = utilspolicy.PolicyDefinitionConfig{
+		Name:                       name,
+		MatchType:                  OVSDB_POLICY_MATCH_TYPE_ANY,
+		PolicyDefinitionStatements: stmtPrecedenceList,
+		Extensions:                 bgppolicy.PolicyExtensions{},
+	}
+}
+
+/*  Convert the ovsdb prefix lists and route maps to policy objects and send the
+ *  difference from the objects that were sent before to the policy engine.
+ *  Objects that use a changed object are removed and added again.
+ */
+func (mgr *OvsPolicyMgr) syncPolicies() {
+	conditions := make(map[string]utilspolicy.PolicyConditionConfig)
+	stmts := make(map[string]utilspolicy.PolicyStmtConfig)
+	definitions := make(map[string]utilspolicy.PolicyDefinitionConfig)
+
+	prefixLists := make(map[string][]string)
+	rejectedLists := make(map[string]bool)
+	for _, prefixList := range mgr.cache[OVSDB_PREFIX_LIST_TABLE] {
+		name, condNames, err := mgr.convertPrefixList(prefixList, conditions)
+		if err != nil {
+			mgr.logger.Err("Rejected prefix list", name, "error:", err)
+			rejectedLists[name] = true
+			continue
+		}
+		prefixLists[name] = condNames
+	}
+	for _, routeMap := range mgr.cache[OVSDB_ROUTE_MAP_TABLE] {
+		mgr.convertRouteMap(routeMap, prefixLists, rejectedLists, stmts, definitions)
+	}
+
+	removedConds := make(map[string]bool)
+	for name, cond := range mgr.conditions {
+		if newCond, ok := conditions[name]; !ok || !reflect.DeepEqual(cond, newCond) {
+			removedConds[name] = true
+		}
+	}
+
+	removedStmts := make(map[string]bool)
+	for name, stmt := range mgr.stmts {
+		newStmt, ok := stmts[name]
+		if !ok || !reflect.DeepEqual(stmt, newStmt) {
+			removedStmts[name] = true
+			continue
+		}
+		for _, condName := range stmt.Conditions {
+			if removedConds[condName] {
+				removedStmts[name] = true
+				break
+			}
+		}
+	}
+
+	removedDefs := make(map[string]bool)
+	for name, def := range mgr.definitions {
+		newDef, ok := definitions[name]
+		if !ok || !reflect.DeepEqual(def, newDef) {
+			removedDefs[name] = true
+			continue
+		}
+		for _, stmtPrecedence := range def.PolicyDefinitionStatements {
+			if removedStmts[stmtPrecedence.Statement] {
+				removedDefs[name] = true
+				break
+			}
+		}
+	}
+
+	for name := range removedDefs {
+		mgr.logger.Info("Remove policy definition", name)
+		api.RemovePolicyDefinition(name)
+		delete(mgr.definitions, name)
+	}
+	for name := range removedStmts {
+		mgr.logger.Info("Remove policy statement", name)
+		api.RemovePolicyStmt(name)
+		delete(mgr.stmts, name)
+	}
+	for name := range removedConds {
+		mgr.logger.Info("Remove policy condition", name)
+		api.RemovePolicyCondition(name)
+		delete(mgr.conditions, name)
+	}
+
+	for name, cond := range conditions {
+		if _, ok := mgr.conditions[name]; !ok {
+			mgr.logger.Info("Add policy condition", name)
+			api.AddPolicyCondition(cond)
+			mgr.conditions[name] = cond
+		}
+	}
+	for name, stmt := range stmts {
+		if _, ok := mgr.stmts[name]; !ok {
+			mgr.logger.Info("Add policy statement", name)
+			api.AddPolicyStmt(stmt)
+			mgr.stmts[name] = stmt
+		}
+	}
+	for name, def := range definitions {
+		if _, ok := mgr.definitions[name]; !ok {
+			mgr.logger.Info("Add policy definition", name)
+			api.AddPolicyDefinition(def)
+			mgr.definitions[name] = def
+		}
+	}
 }
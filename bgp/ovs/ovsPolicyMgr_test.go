@@ -0,0 +1,265 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// ovsPolicyMgr_test.go
+package ovsMgr
+
+import (
+	"fmt"
+	"l3/bgp/api"
+	bgppolicy "l3/bgp/policy"
+	"testing"
+	"utils/logging"
+	utilspolicy "utils/policy"
+
+	ovsdb "github.com/socketplane/libovsdb"
+)
+
+type testPrefixEntry struct {
+	seq    int
+	action string
+	prefix string
+	ge     int
+	le     int
+}
+
+func newTestPolicyMgr(t *testing.T) *OvsPolicyMgr {
+	logger, err := logging.NewLogger("bgpd", "BGP", true)
+	if err != nil {
+		t.Fatal("Failed to start the logger. Exiting!!")
+	}
+
+	return &OvsPolicyMgr{
+		plugin:      "ovsdb",
+		logger:      logger,
+		cache:       make(map[string]map[string]ovsdb.Row),
+		conditions:  make(map[string]utilspolicy.PolicyConditionConfig),
+		stmts:       make(map[string]utilspolicy.PolicyStmtConfig),
+		definitions: make(map[string]utilspolicy.PolicyDefinitionConfig),
+	}
+}
+
+func addTestPrefixList(mgr *OvsPolicyMgr, name string, entries []testPrefixEntry) ovsdb.Row {
+	if _, ok := mgr.cache[OVSDB_PREFIX_ENTRY_TABLE]; !ok {
+		mgr.cache[OVSDB_PREFIX_ENTRY_TABLE] = make(map[string]ovsdb.Row)
+	}
+	if _, ok := mgr.cache[OVSDB_PREFIX_LIST_TABLE]; !ok {
+		mgr.cache[OVSDB_PREFIX_LIST_TABLE] = make(map[string]ovsdb.Row)
+	}
+
+	entryMap := make(map[interface{}]interface{})
+	for _, entry := range entries {
+		uuid := fmt.Sprintf("%s-entry-%d", name, entry.seq)
+		fields := map[string]interface{}{
+			"action": entry.action,
+			"prefix": entry.prefix,
+		}
+		if entry.ge != 0 {
+			fields["ge"] = float64(entry.ge)
+		}
+		if entry.le != 0 {
+			fields["le"] = float64(entry.le)
+		}
+		mgr.cache[OVSDB_PREFIX_ENTRY_TABLE][uuid] = ovsdb.Row{Fields: fields}
+		entryMap[float64(entry.seq)] = ovsdb.UUID{GoUuid: uuid}
+	}
+
+	prefixList := ovsdb.Row{Fields: map[string]interface{}{
+		"name":                name,
+		"prefix_list_entries": ovsdb.OvsMap{GoMap: entryMap},
+	}}
+	mgr.cache[OVSDB_PREFIX_LIST_TABLE][name+"-uuid"] = prefixList
+	return prefixList
+}
+
+func TestConvertPrefixList(t *testing.T) {
+	tests := []struct {
+		name       string
+		entries    []testPrefixEntry
+		valid      bool
+		conditions map[string]string
+	}{
+		{
+			name: "permit",
+			entries: []testPrefixEntry{
+				{seq: 10, action: "permit", prefix: "10.1.0.0/16"},
+				{seq: 20, action: "permit", prefix: "10.2.0.0/16", le: 24},
+				{seq: 30, action: "permit", prefix: "10.3.0.0/16", ge: 20, le: 28},
+			},
+			valid: true,
+			conditions: map[string]string{
+				"permit_10": "10.1.0.0/16 exact",
+				"permit_20": "10.2.0.0/16 16-24",
+				"permit_30": "10.3.0.0/16 20-28",
+			},
+		},
+		{
+			name: "trailingDeny",
+			entries: []testPrefixEntry{
+				{seq: 10, action: "permit", prefix: "10.1.0.0/16"},
+				{seq: 20, action: "deny", prefix: "10.2.0.0/16"},
+				{seq: 30, action: "deny", prefix: "0.0.0.0/0", le: 32},
+			},
+			valid: true,
+			conditions: map[string]string{
+				"trailingDeny_10": "10.1.0.0/16 exact",
+			},
+		},
+		{
+			name: "denyOnly",
+			entries: []testPrefixEntry{
+				{seq: 10, action: "deny", prefix: "10.1.0.0/16"},
+			},
+			valid:      true,
+			conditions: map[string]string{},
+		},
+		{
+			name: "denyBeforePermit",
+			entries: []testPrefixEntry{
+				{seq: 10, action: "permit", prefix: "10.1.0.0/16"},
+				{seq: 20, action: "deny", prefix: "10.2.1.0/24"},
+				{seq: 30, action: "permit", prefix: "10.2.0.0/16", le: 24},
+			},
+			valid: false,
+		},
+		{
+			name: "invalidPrefix",
+			entries: []testPrefixEntry{
+				{seq: 10, action: "permit", prefix: "10.1.0.0"},
+			},
+			valid: false,
+		},
+	}
+
+	for _, test := range tests {
+		mgr := newTestPolicyMgr(t)
+		prefixList := addTestPrefixList(mgr, test.name, test.entries)
+		conditions := make(map[string]utilspolicy.PolicyConditionConfig)
+		name, condNames, err := mgr.convertPrefixList(prefixList, conditions)
+		if name != test.name {
+			t.Errorf("Prefix list %s converted with name %s", test.name, name)
+		}
+		if !test.valid {
+			if err == nil {
+				t.Errorf("Prefix list %s was not rejected", test.name)
+			}
+			if len(conditions) != 0 {
+				t.Errorf("Prefix list %s was rejected but added conditions %v", test.name, conditions)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Prefix list %s was rejected, error: %s", test.name, err)
+			continue
+		}
+		if len(condNames) != len(test.conditions) || len(conditions) != len(test.conditions) {
+			t.Errorf("Prefix list %s converted to conditions %v, expected %v", test.name, condNames,
+				test.conditions)
+			continue
+		}
+		for _, condName := range condNames {
+			cond, ok := conditions[condName]
+			if !ok {
+				t.Errorf("Prefix list %s condition %s not found", test.name, condName)
+				continue
+			}
+			prefix := cond.MatchDstIpPrefixConditionInfo.Prefix
+			if match := prefix.IpPrefix + " " + prefix.MasklengthRange; match != test.conditions[condName] {
+				t.Errorf("Prefix list %s condition %s matches %s, expected %s", test.name, condName, match,
+					test.conditions[condName])
+			}
+		}
+	}
+}
+
+func TestSyncPoliciesRejectedPrefixList(t *testing.T) {
+	mgr := newTestPolicyMgr(t)
+	addTestPrefixList(mgr, "allowed", []testPrefixEntry{
+		{seq: 10, action: "permit", prefix: "10.1.0.0/16"},
+	})
+	addTestPrefixList(mgr, "rejected", []testPrefixEntry{
+		{seq: 10, action: "deny", prefix: "10.2.1.0/24"},
+		{seq: 20, action: "permit", prefix: "10.2.0.0/16", le: 24},
+	})
+
+	mgr.cache[OVSDB_ROUTE_MAP_ENTRY_TABLE] = map[string]ovsdb.Row{
+		"rm1-entry-10": ovsdb.Row{Fields: map[string]interface{}{
+			"action": "permit",
+			"match":  ovsdb.OvsMap{GoMap: map[interface{}]interface{}{OVSDB_MATCH_PREFIX_LIST: "allowed"}},
+		}},
+		"rm2-entry-10": ovsdb.Row{Fields: map[string]interface{}{
+			"action": "permit",
+			"match":  ovsdb.OvsMap{GoMap: map[interface{}]interface{}{OVSDB_MATCH_PREFIX_LIST: "allowed"}},
+		}},
+		"rm2-entry-20": ovsdb.Row{Fields: map[string]interface{}{
+			"action": "permit",
+			"match":  ovsdb.OvsMap{GoMap: map[interface{}]interface{}{OVSDB_MATCH_PREFIX_LIST: "rejected"}},
+		}},
+	}
+	mgr.cache[OVSDB_ROUTE_MAP_TABLE] = map[string]ovsdb.Row{
+		"rm1-uuid": ovsdb.Row{Fields: map[string]interface{}{
+			"name": "rm1",
+			"route_map_entries": ovsdb.OvsMap{GoMap: map[interface{}]interface{}{
+				float64(10): ovsdb.UUID{GoUuid: "rm1-entry-10"},
+			}},
+		}},
+		"rm2-uuid": ovsdb.Row{Fields: map[string]interface{}{
+			"name": "rm2",
+			"route_map_entries": ovsdb.OvsMap{GoMap: map[interface{}]interface{}{
+				float64(10): ovsdb.UUID{GoUuid: "rm2-entry-10"},
+				float64(20): ovsdb.UUID{GoUuid: "rm2-entry-20"},
+			}},
+		}},
+	}
+
+	// The policy objects are sent to buffered channels instead of the policy engine
+	policyManager := &bgppolicy.BGPPolicyManager{
+		ConditionCfgCh:  make(chan utilspolicy.PolicyConditionConfig, 10),
+		StmtCfgCh:       make(chan utilspolicy.PolicyStmtConfig, 10),
+		DefinitionCfgCh: make(chan utilspolicy.PolicyDefinitionConfig, 10),
+		ConditionDelCh:  make(chan string, 10),
+		StmtDelCh:       make(chan string, 10),
+		DefinitionDelCh: make(chan string, 10),
+	}
+	api.InitPolicy(policyManager)
+
+	mgr.syncPolicies()
+	if len(policyManager.DefinitionCfgCh) != 1 {
+		t.Error("Expected 1 policy definition sent to the policy engine, sent", len(policyManager.DefinitionCfgCh))
+	}
+	if _, ok := mgr.definitions["rm1"]; !ok {
+		t.Error("Route map rm1 was not converted to a policy definition")
+	}
+	if _, ok := mgr.definitions["rm2"]; ok {
+		t.Error("Route map rm2 uses a rejected prefix list but was converted to a policy definition")
+	}
+	if _, ok := mgr.conditions["allowed_10"]; !ok {
+		t.Error("Condition allowed_10 not found")
+	}
+	for name, _ := range mgr.conditions {
+		if name != "allowed_10" {
+			t.Error("Unexpected condition", name)
+		}
+	}
+}
@@ -24,42 +24,720 @@
 package ovsMgr
 
 import (
-	//"fmt"
+	"errors"
+	"fmt"
+	"l3/bgp/api"
 	"l3/bgp/config"
+	"l3/rib/ribdCommonDefs"
+	"net"
+	"strings"
+	"utils/logging"
+
+	ovsdb "github.com/socketplane/libovsdb"
+)
+
+const (
+	OVSDB_ROUTE_FROM_BGP       = "bgp"
+	OVSDB_ROUTE_AFI_IPV4       = "ipv4"
+	OVSDB_ROUTE_AFI_IPV6       = "ipv6"
+	OVSDB_ROUTE_SAFI_UNICAST   = "unicast"
+	OVSDB_ROUTE_EBGP_DISTANCE  = 20
+	OVSDB_ROUTE_IBGP_DISTANCE  = 200
+	OVSDB_NEXTHOP_NAMED_UUID   = "bgpnexthop"
+	OVSDB_BACKUP_NAMED_UUID    = "bgpbackupnexthop"
+	OVSDB_ROUTE_REDIST_CH_SIZE = 1
+	OVSDB_POLICY_ACTION_REDIST = "Redistribution"
 )
 
 /*  Constructor for route manager
  */
-func NewOvsRouteMgr() *OvsRouteMgr {
+func NewOvsRouteMgr(logger *logging.Writer) (*OvsRouteMgr, error) {
+	updateCh := make(chan *ovsdb.TableUpdates)
+	ovs, err := connectOvsdb(updateCh)
+	if err != nil {
+		logger.Err("Failed to connect to ovsdb, error:", err)
+		return nil, err
+	}
+
 	mgr := &OvsRouteMgr{
-		plugin: "ovsdb",
+		plugin:       "ovsdb",
+		logger:       logger,
+		ovsClient:    ovs,
+		updateCh:     updateCh,
+		redistCh:     make(chan bool, OVSDB_ROUTE_REDIST_CH_SIZE),
+		cache:        make(map[string]map[string]ovsdb.Row),
+		redistProtos: make(map[string]bool),
+		redistRoutes: make(map[string]*config.RouteInfo),
+		nextHops:     make(map[string]bool),
 	}
 
-	return mgr
+	return mgr, nil
 }
 
+/*  Read the current ovsdb tables before returning so that GetRoutes and
+ *  GetNextHopInfo can be served right after start.
+ */
 func (mgr *OvsRouteMgr) Start() {
+	initial, err := mgr.ovsClient.MonitorAll(OVSDB_HANDLER_DB_TABLE, "")
+	if err != nil {
+		mgr.logger.Err("Route manager failed to monitor ovsdb, error:", err)
+		return
+	}
+
+	mgr.cacheMutex.Lock()
+	populateOvsdbCache(mgr.cache, *initial)
+	mgr.cacheMutex.Unlock()
+	go mgr.listenForRouteUpdates()
+	go mgr.processRedistribution()
+}
 
+/*  Table updates are only cached here. The ovsdb client delivers the updates
+ *  from the goroutine that reads the transaction replies and the server waits
+ *  for those replies while it holds the routes channel.
+ */
+func (mgr *OvsRouteMgr) listenForRouteUpdates() {
+	for updates := range mgr.updateCh {
+		mgr.cacheMutex.Lock()
+		populateOvsdbCache(mgr.cache, *updates)
+		mgr.cacheMutex.Unlock()
+		_, routeUpd := updates.Updates[OVSDB_ROUTE_TABLE]
+		_, nextHopUpd := updates.Updates[OVSDB_NEXTHOP_TABLE]
+		if routeUpd || nextHopUpd {
+			mgr.notifyRedistribution()
+		}
+	}
 }
 
+func (mgr *OvsRouteMgr) notifyRedistribution() {
+	select {
+	case mgr.redistCh <- true:
+	default:
+	}
+}
+
+/*  Send the changes to the redistributed routes and the reachability of the
+ *  tracked next hops to the server after the route tables changed
+ */
+func (mgr *OvsRouteMgr) processRedistribution() {
+	for range mgr.redistCh {
+		add, remove := mgr.updateRedistributedRoutes()
+		if len(add) > 0 || len(remove) > 0 {
+			api.SendRouteNotification(add, remove)
+		}
+		for ipAddr, reachable := range mgr.updateNextHopReachability() {
+			api.SendNextHopNotification(ipAddr, reachable)
+		}
+	}
+}
+
+/*  Convert the network and mask in the route config to the ovsdb prefix
+ *  format 10.1.1.0/24
+ */
+func (mgr *OvsRouteMgr) getRoutePrefix(cfg *config.RouteConfig) (string, error) {
+	ip := net.ParseIP(cfg.DestinationNw)
+	mask := net.ParseIP(cfg.NetworkMask)
+	if ip == nil || mask == nil {
+		return "", errors.New(fmt.Sprintf("Invalid route %s/%s", cfg.DestinationNw, cfg.NetworkMask))
+	}
+
+	var ipMask net.IPMask
+	if cfg.IsIPv6 {
+		ipMask = net.IPMask(mask.To16())
+	} else {
+		ipMask = net.IPMask(mask.To4())
+	}
+	ones, _ := ipMask.Size()
+	return fmt.Sprintf("%s/%d", ip.Mask(ipMask).String(), ones), nil
+}
+
+func (mgr *OvsRouteMgr) getVrfUUID(name string) (UUID, error) {
+	for uuid, vrf := range mgr.cache[OVSDB_VRF_TABLE] {
+		if vrf.Fields["name"] == name {
+			return UUID(uuid), nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("VRF %s not found in ovsdb", name))
+}
+
+func getRouteAfi(cfg *config.RouteConfig) string {
+	if cfg.IsIPv6 {
+		return OVSDB_ROUTE_AFI_IPV6
+	}
+	return OVSDB_ROUTE_AFI_IPV4
+}
+
+/*  Get the prefix, vrf uuid and address family that identify the bgp route of
+ *  the route config in the ovsdb Route table. Called with the cache lock held.
+ */
+func (mgr *OvsRouteMgr) getRouteKey(cfg *config.RouteConfig) (string, UUID, string, error) {
+	prefix, err := mgr.getRoutePrefix(cfg)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	vrfUUID, err := mgr.getVrfUUID(OVSDB_DEFAULT_VRF)
+	if err != nil {
+		return prefix, "", "", err
+	}
+	return prefix, vrfUUID, getRouteAfi(cfg), nil
+}
+
+/*  Find the bgp route row for the prefix in the vrf and address family.
+ *  Returns the row uuid.
+ */
+func (mgr *OvsRouteMgr) getBGPRoute(vrfUUID UUID, afi string, prefix string) (UUID, ovsdb.Row, bool) {
+	for uuid, route := range mgr.cache[OVSDB_ROUTE_TABLE] {
+		if route.Fields["from"] == OVSDB_ROUTE_FROM_BGP && route.Fields["prefix"] == prefix &&
+			route.Fields["address_family"] == afi && getUUIDFromValue(route.Fields["vrf"]) == vrfUUID {
+			return UUID(uuid), route, true
+		}
+	}
+	return "", ovsdb.Row{}, false
+}
+
+/*  Conditions that match the bgp route rows of the prefix in the vrf and
+ *  address family
+ */
+func newBGPRouteConditions(vrfUUID UUID, afi string, prefix string) []interface{} {
+	return []interface{}{
+		ovsdb.NewCondition("vrf", "==", ovsdb.UUID{GoUuid: string(vrfUUID)}),
+		ovsdb.NewCondition("address_family", "==", afi),
+		ovsdb.NewCondition("prefix", "==", prefix),
+		ovsdb.NewCondition("from", "==", OVSDB_ROUTE_FROM_BGP),
+	}
+}
+
+func (mgr *OvsRouteMgr) getNextHopUUIDs(route ovsdb.Row) []UUID {
+	uuids := make([]UUID, 0)
+	for _, val := range getSetFromValue(route.Fields["nexthops"]) {
+		if uuid := getUUIDFromValue(val); uuid != "" {
+			uuids = append(uuids, uuid)
+		}
+	}
+	return uuids
+}
+
+func (mgr *OvsRouteMgr) getNextHopIp(route ovsdb.Row) string {
+	for _, uuid := range mgr.getNextHopUUIDs(route) {
+		if ip, selected, ok := mgr.getNextHop(uuid); ok && selected {
+			return ip
+		}
+	}
+	return ""
+}
+
+/*  Returns the ip address of the next hop and whether it's selected for
+ *  forwarding. Backup next hops are not selected.
+ */
+func (mgr *OvsRouteMgr) getNextHop(uuid UUID) (string, bool, bool) {
+	nextHop, ok := mgr.cache[OVSDB_NEXTHOP_TABLE][string(uuid)]
+	if !ok {
+		return "", false, false
+	}
+	ip, ok := getStringFromValue(nextHop.Fields["ip_address"])
+	if !ok {
+		return "", false, false
+	}
+	selected, ok := getBoolFromValue(nextHop.Fields["selected"])
+	return ip, !ok || selected, true
+}
+
+func (mgr *OvsRouteMgr) newNextHopInsertOp(cfg *config.RouteConfig) ovsdb.Operation {
+	nextHop := make(map[string]interface{})
+	nextHop["ip_address"] = cfg.NextHopIp
+	nextHop["selected"] = true
+
+	return ovsdb.Operation{
+		Op:       "insert",
+		Table:    OVSDB_NEXTHOP_TABLE,
+		Row:      nextHop,
+		UUIDName: OVSDB_NEXTHOP_NAMED_UUID,
+	}
+}
+
+func newRouteNextHopsMutateOp(routeUUID UUID, mutator string, uuids ...ovsdb.UUID) ovsdb.Operation {
+	nextHops, _ := ovsdb.NewOvsSet(uuids)
+	return ovsdb.Operation{
+		Op:        "mutate",
+		Table:     OVSDB_ROUTE_TABLE,
+		Mutations: []interface{}{ovsdb.NewMutation("nexthops", mutator, nextHops)},
+		Where:     []interface{}{ovsdb.NewCondition("_uuid", "==", ovsdb.UUID{GoUuid: string(routeUUID)})},
+	}
+}
+
+func (mgr *OvsRouteMgr) transact(operations ...ovsdb.Operation) error {
+	results, err := mgr.ovsClient.Transact(OVSDB_HANDLER_DB_TABLE, operations...)
+	if err != nil {
+		return err
+	}
+
+	if len(results) < len(operations) {
+		return errors.New(fmt.Sprintf("ovsdb transaction returned %d results for %d operations", len(results),
+			len(operations)))
+	}
+
+	for idx, result := range results {
+		if result.Error != "" {
+			return errors.New(fmt.Sprintf("ovsdb transaction failed, operation %d, error %s, details %s", idx,
+				result.Error, result.Details))
+		}
+	}
+	return nil
+}
+
+/*  Operations that replace the bgp route rows of the prefix with a route with
+ *  a single next hop. The rows are matched in the transaction so that a route
+ *  that is not in the cache yet is not added twice.
+ */
+func (mgr *OvsRouteMgr) newRouteCreateOps(cfg *config.RouteConfig, prefix string, vrfUUID UUID,
+	afi string) []ovsdb.Operation {
+	distance := OVSDB_ROUTE_IBGP_DISTANCE
+	if cfg.Protocol == "EBGP" {
+		distance = OVSDB_ROUTE_EBGP_DISTANCE
+	}
+	nextHops, _ := ovsdb.NewOvsSet([]ovsdb.UUID{ovsdb.UUID{GoUuid: OVSDB_NEXTHOP_NAMED_UUID}})
+
+	route := make(map[string]interface{})
+	route["vrf"] = ovsdb.UUID{GoUuid: string(vrfUUID)}
+	route["prefix"] = prefix
+	route["from"] = OVSDB_ROUTE_FROM_BGP
+	route["address_family"] = afi
+	route["sub_address_family"] = OVSDB_ROUTE_SAFI_UNICAST
+	route["distance"] = distance
+	route["metric"] = cfg.Cost
+	route["nexthops"] = nextHops
+
+	return []ovsdb.Operation{
+		ovsdb.Operation{
+			Op:    "delete",
+			Table: OVSDB_ROUTE_TABLE,
+			Where: newBGPRouteConditions(vrfUUID, afi, prefix),
+		},
+		mgr.newNextHopInsertOp(cfg),
+		ovsdb.Operation{
+			Op:    "insert",
+			Table: OVSDB_ROUTE_TABLE,
+			Row:   route,
+		},
+	}
+}
+
+/*  Add the bgp route to the ovsdb Route table with a single next hop. More next
+ *  hops are added by UpdateRoute. An existing bgp route for the prefix is
+ *  replaced.
+ */
 func (mgr *OvsRouteMgr) CreateRoute(cfg *config.RouteConfig) {
-	//fmt.Println("Create Route called in", mgr.plugin, "with configs", cfg)
+	mgr.cacheMutex.RLock()
+	prefix, vrfUUID, afi, err := mgr.getRouteKey(cfg)
+	mgr.cacheMutex.RUnlock()
+	if err != nil {
+		mgr.logger.Err("CreateRoute - route", prefix, "error:", err)
+		return
+	}
+
+	err = mgr.transact(mgr.newRouteCreateOps(cfg, prefix, vrfUUID, afi)...)
+	if err != nil {
+		mgr.logger.Err("CreateRoute - route", prefix, "next hop", cfg.NextHopIp, "error:", err)
+		return
+	}
+	mgr.logger.Info("CreateRoute - added route", prefix, "next hop", cfg.NextHopIp)
 }
 
+/*  Remove the bgp route from the ovsdb Route table. The next hops are not root
+ *  rows and are removed by ovsdb with the route.
+ */
 func (mgr *OvsRouteMgr) DeleteRoute(cfg *config.RouteConfig) {
+	mgr.cacheMutex.RLock()
+	prefix, vrfUUID, afi, err := mgr.getRouteKey(cfg)
+	mgr.cacheMutex.RUnlock()
+	if err != nil {
+		mgr.logger.Err("DeleteRoute - route", prefix, "error:", err)
+		return
+	}
 
+	err = mgr.transact(ovsdb.Operation{
+		Op:    "delete",
+		Table: OVSDB_ROUTE_TABLE,
+		Where: newBGPRouteConditions(vrfUUID, afi, prefix),
+	})
+	if err != nil {
+		mgr.logger.Err("DeleteRoute - route", prefix, "error:", err)
+		return
+	}
+	mgr.logger.Info("DeleteRoute - removed route", prefix)
 }
 
+/*  Add or remove a next hop of the bgp route. The route is removed with its
+ *  last next hop.
+ */
 func (mgr *OvsRouteMgr) UpdateRoute(cfg *config.RouteConfig, op string) {
+	mgr.cacheMutex.RLock()
+	prefix, vrfUUID, afi, err := mgr.getRouteKey(cfg)
+	if err != nil {
+		mgr.cacheMutex.RUnlock()
+		mgr.logger.Err("UpdateRoute - route", prefix, "error:", err)
+		return
+	}
+	routeUUID, route, found := mgr.getBGPRoute(vrfUUID, afi, prefix)
+	var removeUUID UUID
+	selectedNextHops := 0
+	if found {
+		for _, uuid := range mgr.getNextHopUUIDs(route) {
+			ip, selected, ok := mgr.getNextHop(uuid)
+			if !ok || !selected {
+				continue
+			}
+			selectedNextHops++
+			if ip == cfg.NextHopIp {
+				removeUUID = uuid
+			}
+		}
+	}
+	mgr.cacheMutex.RUnlock()
+
+	switch op {
+	case "add":
+		if !found {
+			mgr.CreateRoute(cfg)
+			return
+		}
+		err = mgr.transact(mgr.newNextHopInsertOp(cfg), newRouteNextHopsMutateOp(routeUUID, "insert",
+			ovsdb.UUID{GoUuid: OVSDB_NEXTHOP_NAMED_UUID}))
+
+	case "remove":
+		if !found || removeUUID == "" {
+			mgr.logger.Info("UpdateRoute - next hop", cfg.NextHopIp, "not found for route", prefix)
+			return
+		}
+		if selectedNextHops == 1 {
+			mgr.DeleteRoute(cfg)
+			return
+		}
+		err = mgr.transact(newRouteNextHopsMutateOp(routeUUID, "delete", ovsdb.UUID{GoUuid: string(removeUUID)}))
+
+	default:
+		mgr.logger.Err("UpdateRoute - unknown operation", op, "for route", prefix)
+		return
+	}
+
+	if err != nil {
+		mgr.logger.Err("UpdateRoute -", op, "route", prefix, "next hop", cfg.NextHopIp, "error:", err)
+		return
+	}
+	mgr.logger.Info("UpdateRoute -", op, "route", prefix, "next hop", cfg.NextHopIp)
+}
+
+/*  Replace the backup next hop of the bgp route. The backup next hop is added
+ *  to the route but not selected for forwarding. An empty backup next hop
+ *  removes the backup.
+ */
+func (mgr *OvsRouteMgr) SetBackupNextHop(cfg *config.RouteConfig) {
+	mgr.cacheMutex.RLock()
+	prefix, vrfUUID, afi, err := mgr.getRouteKey(cfg)
+	if err != nil {
+		mgr.cacheMutex.RUnlock()
+		mgr.logger.Err("SetBackupNextHop - route", prefix, "error:", err)
+		return
+	}
+	routeUUID, route, found := mgr.getBGPRoute(vrfUUID, afi, prefix)
+	backupUUIDs := make([]ovsdb.UUID, 0)
+	if found {
+		for _, uuid := range mgr.getNextHopUUIDs(route) {
+			if _, selected, ok := mgr.getNextHop(uuid); ok && !selected {
+				backupUUIDs = append(backupUUIDs, ovsdb.UUID{GoUuid: string(uuid)})
+			}
+		}
+	}
+	mgr.cacheMutex.RUnlock()
+
+	if !found {
+		mgr.logger.Info("SetBackupNextHop - route", prefix, "not found")
+		return
+	}
+
+	operations := make([]ovsdb.Operation, 0)
+	if len(backupUUIDs) > 0 {
+		operations = append(operations, newRouteNextHopsMutateOp(routeUUID, "delete", backupUUIDs...))
+	}
+	if cfg.BackupNextHopIp != "" {
+		nextHop := make(map[string]interface{})
+		nextHop["ip_address"] = cfg.BackupNextHopIp
+		nextHop["selected"] = false
+		operations = append(operations, ovsdb.Operation{
+			Op:       "insert",
+			Table:    OVSDB_NEXTHOP_TABLE,
+			Row:      nextHop,
+			UUIDName: OVSDB_BACKUP_NAMED_UUID,
+		}, newRouteNextHopsMutateOp(routeUUID, "insert", ovsdb.UUID{GoUuid: OVSDB_BACKUP_NAMED_UUID}))
+	}
+	if len(operations) == 0 {
+		return
+	}
+
+	if err = mgr.transact(operations...); err != nil {
+		mgr.logger.Err("SetBackupNextHop - route", prefix, "backup next hop", cfg.BackupNextHopIp, "error:", err)
+		return
+	}
+	mgr.logger.Info("SetBackupNextHop - route", prefix, "backup next hop", cfg.BackupNextHopIp)
+}
+
+/*  Switch the bgp routes that use nextHopIp to their backup next hops with a
+ *  single transaction. The failed next hop is removed and the backup next hop
+ *  is selected for forwarding.
+ */
+func (mgr *OvsRouteMgr) SwitchToBackupNextHop(nextHopIp string, cfgs []*config.RouteConfig) {
+	operations := make([]ovsdb.Operation, 0)
+	mgr.cacheMutex.RLock()
+	for idx, cfg := range cfgs {
+		prefix, vrfUUID, afi, err := mgr.getRouteKey(cfg)
+		if err != nil {
+			mgr.logger.Err("SwitchToBackupNextHop - route", prefix, "error:", err)
+			continue
+		}
+
+		routeUUID, route, found := mgr.getBGPRoute(vrfUUID, afi, prefix)
+		if !found {
+			continue
+		}
+
+		var failedUUID, backupUUID UUID
+		for _, uuid := range mgr.getNextHopUUIDs(route) {
+			ip, selected, ok := mgr.getNextHop(uuid)
+			if !ok {
+				continue
+			}
+			if selected && ip == cfg.NextHopIp {
+				failedUUID = uuid
+			} else if !selected && ip == cfg.BackupNextHopIp {
+				backupUUID = uuid
+			}
+		}
+
+		if backupUUID != "" {
+			operations = append(operations, ovsdb.Operation{
+				Op:    "update",
+				Table: OVSDB_NEXTHOP_TABLE,
+				Row:   map[string]interface{}{"selected": true},
+				Where: []interface{}{ovsdb.NewCondition("_uuid", "==", ovsdb.UUID{GoUuid: string(backupUUID)})},
+			})
+		} else {
+			uuidName := fmt.Sprintf("%s%d", OVSDB_BACKUP_NAMED_UUID, idx)
+			nextHop := make(map[string]interface{})
+			nextHop["ip_address"] = cfg.BackupNextHopIp
+			nextHop["selected"] = true
+			operations = append(operations, ovsdb.Operation{
+				Op:       "insert",
+				Table:    OVSDB_NEXTHOP_TABLE,
+				Row:      nextHop,
+				UUIDName: uuidName,
+			}, newRouteNextHopsMutateOp(routeUUID, "insert", ovsdb.UUID{GoUuid: uuidName}))
+		}
+		if failedUUID != "" {
+			operations = append(operations, newRouteNextHopsMutateOp(routeUUID, "delete",
+				ovsdb.UUID{GoUuid: string(failedUUID)}))
+		}
+	}
+	mgr.cacheMutex.RUnlock()
+
+	if len(operations) == 0 {
+		return
+	}
+
+	if err := mgr.transact(operations...); err != nil {
+		mgr.logger.Err("SwitchToBackupNextHop - next hop", nextHopIp, "error:", err)
+		return
+	}
+	mgr.logger.Info("SwitchToBackupNextHop - switched", len(cfgs), "routes from next hop", nextHopIp)
+}
 
+/*  Longest prefix match of ip on the routes that are selected for forwarding.
+ *  Called with the cache lock held.
+ */
+func (mgr *OvsRouteMgr) lookupRoute(ip net.IP) (*net.IPNet, ovsdb.Row) {
+	var bestNet *net.IPNet
+	var bestRoute ovsdb.Row
+	bestLen := -1
+	for _, route := range mgr.cache[OVSDB_ROUTE_TABLE] {
+		if selected, ok := getBoolFromValue(route.Fields["selected"]); !ok || !selected {
+			continue
+		}
+		prefix, ok := route.Fields["prefix"].(string)
+		if !ok {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil || !ipNet.Contains(ip) {
+			continue
+		}
+		if ones, _ := ipNet.Mask.Size(); ones > bestLen {
+			bestLen = ones
+			bestNet = ipNet
+			bestRoute = route
+		}
+	}
+	return bestNet, bestRoute
 }
 
 func (mgr *OvsRouteMgr) GetNextHopInfo(ipAddr string) (*config.NextHopInfo, error) {
-	return nil, nil
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		return nil, errors.New(fmt.Sprintf("Invalid IP address %s", ipAddr))
+	}
+
+	mgr.cacheMutex.RLock()
+	defer mgr.cacheMutex.RUnlock()
+
+	bestNet, bestRoute := mgr.lookupRoute(ip)
+	if bestNet == nil {
+		return nil, errors.New(fmt.Sprintf("No route found for %s", ipAddr))
+	}
+
+	metric, _ := getIntFromValue(bestRoute.Fields["metric"])
+	reachInfo := &config.NextHopInfo{
+		IPAddr:      bestNet.IP.String(),
+		Mask:        net.IP(bestNet.Mask).String(),
+		Metric:      int32(metric),
+		NextHopIp:   mgr.getNextHopIp(bestRoute),
+		IsReachable: true,
+	}
+	return reachInfo, nil
+}
+
+/*  The reachability of the tracked next hops is checked when the Route or
+ *  Nexthop tables change and the changes are sent to the server.
+ */
+func (mgr *OvsRouteMgr) TrackNextHop(ipAddr string, track bool) {
+	mgr.cacheMutex.Lock()
+	defer mgr.cacheMutex.Unlock()
+
+	if !track {
+		delete(mgr.nextHops, ipAddr)
+		return
+	}
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		mgr.logger.Err("TrackNextHop - invalid IP address", ipAddr)
+		return
+	}
+	ipNet, _ := mgr.lookupRoute(ip)
+	mgr.nextHops[ipAddr] = ipNet != nil
 }
+
+/*  Returns the tracked next hops whose reachability changed
+ */
+func (mgr *OvsRouteMgr) updateNextHopReachability() map[string]bool {
+	changed := make(map[string]bool)
+
+	mgr.cacheMutex.Lock()
+	defer mgr.cacheMutex.Unlock()
+
+	for ipAddr, wasReachable := range mgr.nextHops {
+		ipNet, _ := mgr.lookupRoute(net.ParseIP(ipAddr))
+		if reachable := ipNet != nil; reachable != wasReachable {
+			mgr.logger.Info("Next hop", ipAddr, "reachable:", reachable)
+			mgr.nextHops[ipAddr] = reachable
+			changed[ipAddr] = reachable
+		}
+	}
+	return changed
+}
+
+/*  Redistribution is set up with MatchProtocol conditions. The protocols are
+ *  matched against the from column of the ovsdb Route table. Redistribution is
+ *  the only policy action supported.
+ */
 func (mgr *OvsRouteMgr) ApplyPolicy(protocol string, policy string, action string, conditions []*config.ConditionInfo) {
-	return
+	if action != OVSDB_POLICY_ACTION_REDIST {
+		mgr.logger.Err("ApplyPolicy - policy", policy, "action", action, "is not supported")
+		return
+	}
+
+	mgr.cacheMutex.Lock()
+	for _, condition := range conditions {
+		if condition.ConditionType != "MatchProtocol" {
+			mgr.logger.Info("ApplyPolicy - policy", policy, "condition type", condition.ConditionType,
+				"is not supported")
+			continue
+		}
+		mgr.logger.Info("ApplyPolicy - redistribute", condition.Protocol, "routes to", protocol)
+		mgr.redistProtos[strings.ToLower(condition.Protocol)] = true
+	}
+	mgr.cacheMutex.Unlock()
+	mgr.notifyRedistribution()
+}
+
+func (mgr *OvsRouteMgr) getRedistributeRouteInfo(route ovsdb.Row) *config.RouteInfo {
+	from, ok := route.Fields["from"].(string)
+	if !ok || from == OVSDB_ROUTE_FROM_BGP || !mgr.redistProtos[from] {
+		return nil
+	}
+	if selected, ok := getBoolFromValue(route.Fields["selected"]); !ok || !selected {
+		return nil
+	}
+	prefix, ok := route.Fields["prefix"].(string)
+	if !ok {
+		return nil
+	}
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		mgr.logger.Err("Invalid prefix", prefix, "in ovsdb route table")
+		return nil
+	}
+
+	addrType := ribdCommonDefs.IPv4
+	if ipNet.IP.To4() == nil {
+		addrType = ribdCommonDefs.IPv6
+	}
+	return &config.RouteInfo{
+		IPAddr:      ipNet.IP.String(),
+		Mask:        net.IP(ipNet.Mask).String(),
+		NextHopIp:   mgr.getNextHopIp(route),
+		RouteOrigin: from,
+		AddressType: addrType,
+	}
 }
+
+/*  Compare the routes in the ovsdb Route table with the routes that were
+ *  already redistributed and return the routes to add and remove.
+ */
+func (mgr *OvsRouteMgr) updateRedistributedRoutes() ([]*config.RouteInfo, []*config.RouteInfo) {
+	add := make([]*config.RouteInfo, 0)
+	remove := make([]*config.RouteInfo, 0)
+
+	mgr.cacheMutex.Lock()
+	defer mgr.cacheMutex.Unlock()
+
+	routes := mgr.cache[OVSDB_ROUTE_TABLE]
+	for uuid, oldInfo := range mgr.redistRoutes {
+		// BGP only needs the prefix of a redistributed route, other changes
+		// to the route are not notified
+		if route, ok := routes[uuid]; ok {
+			newInfo := mgr.getRedistributeRouteInfo(route)
+			if newInfo != nil && newInfo.IPAddr == oldInfo.IPAddr && newInfo.Mask == oldInfo.Mask {
+				mgr.redistRoutes[uuid] = newInfo
+				continue
+			}
+		}
+		remove = append(remove, oldInfo)
+		delete(mgr.redistRoutes, uuid)
+	}
+
+	for uuid, route := range routes {
+		if _, ok := mgr.redistRoutes[uuid]; ok {
+			continue
+		}
+		if info := mgr.getRedistributeRouteInfo(route); info != nil {
+			add = append(add, info)
+			mgr.redistRoutes[uuid] = info
+		}
+	}
+	return add, remove
+}
+
 func (mgr *OvsRouteMgr) GetRoutes() ([]*config.RouteInfo, []*config.RouteInfo) {
-	return nil, nil
+	add, remove := mgr.updateRedistributedRoutes()
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, nil
+	}
+	return add, remove
 }
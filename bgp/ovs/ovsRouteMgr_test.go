@@ -0,0 +1,165 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// ovsRouteMgr_test.go
+package ovsMgr
+
+import (
+	"l3/bgp/config"
+	"testing"
+	"utils/logging"
+
+	ovsdb "github.com/socketplane/libovsdb"
+)
+
+const (
+	testDefaultVrfUUID = "vrf-default-uuid"
+	testOtherVrfUUID   = "vrf-red-uuid"
+)
+
+func newTestRouteMgr(t *testing.T) *OvsRouteMgr {
+	logger, err := logging.NewLogger("bgpd", "BGP", true)
+	if err != nil {
+		t.Fatal("Failed to start the logger. Exiting!!")
+	}
+
+	mgr := &OvsRouteMgr{
+		plugin:       "ovsdb",
+		logger:       logger,
+		redistCh:     make(chan bool, OVSDB_ROUTE_REDIST_CH_SIZE),
+		cache:        make(map[string]map[string]ovsdb.Row),
+		redistProtos: make(map[string]bool),
+		redistRoutes: make(map[string]*config.RouteInfo),
+	}
+	mgr.cache[OVSDB_VRF_TABLE] = map[string]ovsdb.Row{
+		testDefaultVrfUUID: ovsdb.Row{Fields: map[string]interface{}{"name": OVSDB_DEFAULT_VRF}},
+		testOtherVrfUUID:   ovsdb.Row{Fields: map[string]interface{}{"name": "vrf_red"}},
+	}
+	return mgr
+}
+
+func newTestRouteRow(vrfUUID, afi, prefix, from string) ovsdb.Row {
+	return ovsdb.Row{Fields: map[string]interface{}{
+		"vrf":            []interface{}{"uuid", vrfUUID},
+		"address_family": afi,
+		"prefix":         prefix,
+		"from":           from,
+	}}
+}
+
+func TestGetBGPRoute(t *testing.T) {
+	mgr := newTestRouteMgr(t)
+	mgr.cache[OVSDB_ROUTE_TABLE] = map[string]ovsdb.Row{
+		"red-bgp":        newTestRouteRow(testOtherVrfUUID, OVSDB_ROUTE_AFI_IPV4, "10.1.0.0/16", OVSDB_ROUTE_FROM_BGP),
+		"default-static": newTestRouteRow(testDefaultVrfUUID, OVSDB_ROUTE_AFI_IPV4, "10.1.0.0/16", "static"),
+		"default-bgp":    newTestRouteRow(testDefaultVrfUUID, OVSDB_ROUTE_AFI_IPV4, "10.1.0.0/16", OVSDB_ROUTE_FROM_BGP),
+		"default-bgp-v6": newTestRouteRow(testDefaultVrfUUID, OVSDB_ROUTE_AFI_IPV6, "2001:db8::/32", OVSDB_ROUTE_FROM_BGP),
+	}
+
+	tests := []struct {
+		cfg   config.RouteConfig
+		found bool
+		uuid  UUID
+	}{
+		{config.RouteConfig{DestinationNw: "10.1.1.1", NetworkMask: "255.255.0.0"}, true, "default-bgp"},
+		{config.RouteConfig{DestinationNw: "10.2.0.0", NetworkMask: "255.255.0.0"}, false, ""},
+		{config.RouteConfig{DestinationNw: "2001:db8::", NetworkMask: "ffff:ffff::", IsIPv6: true}, true,
+			"default-bgp-v6"},
+	}
+
+	for _, test := range tests {
+		prefix, vrfUUID, afi, err := mgr.getRouteKey(&test.cfg)
+		if err != nil {
+			t.Errorf("Failed to get the route key for %s/%s, error: %s", test.cfg.DestinationNw,
+				test.cfg.NetworkMask, err)
+			continue
+		}
+		if vrfUUID != testDefaultVrfUUID {
+			t.Errorf("Route %s got vrf %s, expected %s", prefix, vrfUUID, testDefaultVrfUUID)
+		}
+
+		uuid, _, found := mgr.getBGPRoute(vrfUUID, afi, prefix)
+		if found != test.found || uuid != test.uuid {
+			t.Errorf("Route %s afi %s found %t uuid %s, expected found %t uuid %s", prefix, afi, found, uuid,
+				test.found, test.uuid)
+		}
+	}
+
+	// The ipv4 prefix is not found in the ipv6 address family
+	if _, _, found := mgr.getBGPRoute(testDefaultVrfUUID, OVSDB_ROUTE_AFI_IPV6, "10.1.0.0/16"); found {
+		t.Error("Route 10.1.0.0/16 found in address family", OVSDB_ROUTE_AFI_IPV6)
+	}
+}
+
+func TestNewRouteCreateOps(t *testing.T) {
+	mgr := newTestRouteMgr(t)
+	cfg := &config.RouteConfig{
+		DestinationNw: "10.1.0.0",
+		NetworkMask:   "255.255.0.0",
+		NextHopIp:     "192.168.1.1",
+		Protocol:      "EBGP",
+	}
+
+	prefix, vrfUUID, afi, err := mgr.getRouteKey(cfg)
+	if err != nil {
+		t.Fatal("Failed to get the route key, error:", err)
+	}
+	ops := mgr.newRouteCreateOps(cfg, prefix, vrfUUID, afi)
+	if len(ops) != 3 {
+		t.Fatal("Expected 3 operations to create the route, got", len(ops))
+	}
+
+	// The existing bgp route rows are removed in the same transaction
+	if ops[0].Op != "delete" || ops[0].Table != OVSDB_ROUTE_TABLE ||
+		len(ops[0].Where) != len(newBGPRouteConditions(vrfUUID, afi, prefix)) {
+		t.Errorf("First operation %+v does not delete the bgp route rows", ops[0])
+	}
+	if ops[1].Op != "insert" || ops[1].Table != OVSDB_NEXTHOP_TABLE || ops[1].Row["ip_address"] != cfg.NextHopIp {
+		t.Errorf("Second operation %+v does not insert the next hop", ops[1])
+	}
+	route := ops[2].Row
+	if ops[2].Op != "insert" || ops[2].Table != OVSDB_ROUTE_TABLE {
+		t.Fatalf("Third operation %+v does not insert the route", ops[2])
+	}
+	if route["prefix"] != "10.1.0.0/16" || route["address_family"] != OVSDB_ROUTE_AFI_IPV4 ||
+		route["vrf"] != (ovsdb.UUID{GoUuid: testDefaultVrfUUID}) || route["distance"] != OVSDB_ROUTE_EBGP_DISTANCE {
+		t.Errorf("Route row %+v does not match the route config %+v", route, cfg)
+	}
+}
+
+func TestApplyPolicyAction(t *testing.T) {
+	mgr := newTestRouteMgr(t)
+	conditions := []*config.ConditionInfo{
+		&config.ConditionInfo{ConditionType: "MatchProtocol", Protocol: "STATIC"},
+	}
+
+	mgr.ApplyPolicy("BGP", "export", "Export", conditions)
+	if len(mgr.redistProtos) != 0 {
+		t.Error("Policy with action Export set up redistribution of", mgr.redistProtos)
+	}
+
+	mgr.ApplyPolicy("BGP", "redist", OVSDB_POLICY_ACTION_REDIST, conditions)
+	if !mgr.redistProtos["static"] {
+		t.Error("Policy with action", OVSDB_POLICY_ACTION_REDIST, "did not set up redistribution of static routes")
+	}
+}
@@ -50,6 +50,7 @@ var ProtocolFamilyMap = map[string]uint32{
 	"ipv6-unicast":   GetProtocolFamily(AfiIP6, SafiUnicast),
 	"ipv4-multicast": GetProtocolFamily(AfiIP, SafiMulticast),
 	"ipv6-multicast": GetProtocolFamily(AfiIP6, SafiMulticast),
+	"link-state":     GetProtocolFamily(AfiLinkState, SafiLinkState),
 }
 
 var AFINextHopLenMap = map[AFI]int{
@@ -31,6 +31,7 @@ import (
 	"math"
 	"net"
 	"strconv"
+	"unicode/utf8"
 )
 
 type BGPPktInfo struct {
@@ -55,6 +56,7 @@ type BGPPeerAttrs struct {
 	ASSize           uint8
 	AddPathFamily    map[AFI]map[SAFI]uint8
 	AddPathsRxActual bool
+	ExtendedMsg      bool
 }
 
 const BGPASTrans uint16 = 23456
@@ -75,6 +77,8 @@ const (
 	BGPMsgHeaderLen               = 19
 	BGPUpdateMsgMinLen            = 23
 	BGPMsgMaxLen                  = 4096
+	BGPExtendedMsgMaxLen          = 65535
+	BGPNotificationMsgMinLen      = 21
 )
 
 const (
@@ -103,6 +107,10 @@ const (
 	_
 	BGPUnacceptableHoldTime
 	BGPUnsupportedCapability
+	_
+	_
+	_
+	BGPRoleMismatch
 )
 
 const (
@@ -120,6 +128,29 @@ const (
 	BGPMalformedASPath
 )
 
+const (
+	_ uint8 = iota
+	BGPCeaseMaxPrefixesReached
+	BGPCeaseAdminShutdown
+	BGPCeasePeerDeconfigured
+	BGPCeaseAdminReset
+	BGPCeaseConnectionRejected
+	BGPCeaseOtherConfigChange
+	BGPCeaseConnCollisionResolution
+	BGPCeaseOutOfResources
+)
+
+// Max length of the shutdown communication carried in a Cease NOTIFICATION (RFC 8203)
+const BGPShutdownCommunicationMaxLen = 128
+
+const (
+	BGPCommunityNoExport          uint32 = 0xFFFFFF01
+	BGPCommunityNoAdvertise       uint32 = 0xFFFFFF02
+	BGPCommunityNoExportSubconfed uint32 = 0xFFFFFF03
+	BGPCommunityGracefulShutdown  uint32 = 0xFFFF0000
+	BGPGracefulShutdownLocalPref  uint32 = 0
+)
+
 type BGPOptParamType uint8
 
 const (
@@ -137,14 +168,18 @@ type BGPCapabilityType uint8
 const (
 	_ BGPCapabilityType = iota
 	BGPCapTypeMPExt
-	BGPCapTypeAS4Path BGPCapabilityType = 65
-	BGPCapTypeAddPath BGPCapabilityType = 69
+	BGPCapTypeExtendedMsg BGPCapabilityType = 6
+	BGPCapTypeRole        BGPCapabilityType = 9
+	BGPCapTypeAS4Path     BGPCapabilityType = 65
+	BGPCapTypeAddPath     BGPCapabilityType = 69
 )
 
 var BGPCapTypeToStruct = map[BGPCapabilityType]BGPCapability{
-	BGPCapTypeMPExt:   &BGPCapMPExt{},
-	BGPCapTypeAS4Path: &BGPCapAS4Path{},
-	BGPCapTypeAddPath: &BGPCapAddPath{},
+	BGPCapTypeMPExt:       &BGPCapMPExt{},
+	BGPCapTypeExtendedMsg: &BGPCapExtendedMsg{},
+	BGPCapTypeRole:        &BGPCapRole{},
+	BGPCapTypeAS4Path:     &BGPCapAS4Path{},
+	BGPCapTypeAddPath:     &BGPCapAddPath{},
 }
 
 const (
@@ -152,6 +187,42 @@ const (
 	BGPCapAddPathTx
 )
 
+// BGP roles, RFC 9234
+type BGPRole uint8
+
+const (
+	BGPRoleProvider BGPRole = iota
+	BGPRoleRS
+	BGPRoleRSClient
+	BGPRoleCustomer
+	BGPRolePeer
+)
+
+var BGPRoleToStrMap = map[BGPRole]string{
+	BGPRoleProvider: "provider",
+	BGPRoleRS:       "rs",
+	BGPRoleRSClient: "rs-client",
+	BGPRoleCustomer: "customer",
+	BGPRolePeer:     "peer",
+}
+
+var BGPRoleStrToTypeMap = map[string]BGPRole{
+	"provider":  BGPRoleProvider,
+	"rs":        BGPRoleRS,
+	"rs-client": BGPRoleRSClient,
+	"customer":  BGPRoleCustomer,
+	"peer":      BGPRolePeer,
+}
+
+// The role the peer is expected to advertise for each local role
+var BGPRolePeerRoleMap = map[BGPRole]BGPRole{
+	BGPRoleProvider: BGPRoleCustomer,
+	BGPRoleRS:       BGPRoleRSClient,
+	BGPRoleRSClient: BGPRoleRS,
+	BGPRoleCustomer: BGPRoleProvider,
+	BGPRolePeer:     BGPRolePeer,
+}
+
 type BGPPathAttrFlag uint8
 
 const (
@@ -176,7 +247,7 @@ const (
 	BGPPathAttrTypeLocalPref
 	BGPPathAttrTypeAtomicAggregate
 	BGPPathAttrTypeAggregator
-	_
+	BGPPathAttrTypeCommunities
 	BGPPathAttrTypeOriginatorId
 	BGPPathAttrTypeClusterList
 	_
@@ -190,6 +261,9 @@ const (
 	BGPPathAttrTypeUnknown
 )
 
+const BGPPathAttrTypeLinkState BGPPathAttrType = 29
+const BGPPathAttrTypeOTC BGPPathAttrType = 35
+
 type BGPPathAttrOriginType uint8
 
 const (
@@ -225,12 +299,15 @@ var BGPPathAttrTypeToStructMap = map[BGPPathAttrType]BGPPathAttr{
 	BGPPathAttrTypeLocalPref:       &BGPPathAttrLocalPref{},
 	BGPPathAttrTypeAtomicAggregate: &BGPPathAttrAtomicAggregate{},
 	BGPPathAttrTypeAggregator:      &BGPPathAttrAggregator{},
+	BGPPathAttrTypeCommunities:     &BGPPathAttrCommunities{},
 	BGPPathAttrTypeOriginatorId:    &BGPPathAttrOriginatorId{},
 	BGPPathAttrTypeClusterList:     &BGPPathAttrClusterList{},
 	BGPPathAttrTypeMPReachNLRI:     &BGPPathAttrMPReachNLRI{},
 	BGPPathAttrTypeMPUnreachNLRI:   &BGPPathAttrMPUnreachNLRI{},
 	BGPPathAttrTypeAS4Path:         &BGPPathAttrAS4Path{},
 	BGPPathAttrTypeAS4Aggregator:   &BGPPathAttrAS4Aggregator{},
+	BGPPathAttrTypeLinkState:       &BGPPathAttrLinkState{},
+	BGPPathAttrTypeOTC:             &BGPPathAttrOTC{},
 }
 
 var BGPPathAttrTypeFlagsMap = map[BGPPathAttrType][]BGPPathAttrFlag{
@@ -241,12 +318,15 @@ var BGPPathAttrTypeFlagsMap = map[BGPPathAttrType][]BGPPathAttrFlag{
 	BGPPathAttrTypeLocalPref:       []BGPPathAttrFlag{BGPPathAttrFlagTransitive, BGPPathAttrFlagAllMinusExtendedLen},
 	BGPPathAttrTypeAtomicAggregate: []BGPPathAttrFlag{BGPPathAttrFlagTransitive, BGPPathAttrFlagAllMinusExtendedLen},
 	BGPPathAttrTypeAggregator:      []BGPPathAttrFlag{BGPPathAttrFlagOptional | BGPPathAttrFlagTransitive, BGPPathAttrFlagAllMinusExtendedLen},
+	BGPPathAttrTypeCommunities:     []BGPPathAttrFlag{BGPPathAttrFlagOptional | BGPPathAttrFlagTransitive, BGPPathAttrFlagAllMinusExtendedLen},
 	BGPPathAttrTypeOriginatorId:    []BGPPathAttrFlag{BGPPathAttrFlagOptional, BGPPathAttrFlagAllMinusExtendedLen},
 	BGPPathAttrTypeClusterList:     []BGPPathAttrFlag{BGPPathAttrFlagOptional, BGPPathAttrFlagAllMinusExtendedLen},
 	BGPPathAttrTypeMPReachNLRI:     []BGPPathAttrFlag{BGPPathAttrFlagOptional, BGPPathAttrFlagAllMinusExtendedLen},
 	BGPPathAttrTypeMPUnreachNLRI:   []BGPPathAttrFlag{BGPPathAttrFlagOptional, BGPPathAttrFlagAllMinusExtendedLen},
 	BGPPathAttrTypeAS4Path:         []BGPPathAttrFlag{BGPPathAttrFlagOptional | BGPPathAttrFlagTransitive, BGPPathAttrFlagAllMinusExtendedLen},
 	BGPPathAttrTypeAS4Aggregator:   []BGPPathAttrFlag{BGPPathAttrFlagOptional | BGPPathAttrFlagTransitive, BGPPathAttrFlagAllMinusExtendedLen},
+	BGPPathAttrTypeLinkState:       []BGPPathAttrFlag{BGPPathAttrFlagOptional, BGPPathAttrFlagAllMinusExtendedLen},
+	BGPPathAttrTypeOTC:             []BGPPathAttrFlag{BGPPathAttrFlagOptional | BGPPathAttrFlagTransitive, BGPPathAttrFlagAllMinusExtendedLen},
 }
 
 var BGPPathAttrTypeLenMap = map[BGPPathAttrType]uint16{
@@ -255,7 +335,48 @@ var BGPPathAttrTypeLenMap = map[BGPPathAttrType]uint16{
 	BGPPathAttrTypeMultiExitDisc:   4,
 	BGPPathAttrTypeLocalPref:       4,
 	BGPPathAttrTypeAtomicAggregate: 0,
+	BGPPathAttrTypeOriginatorId:    4,
 	BGPPathAttrTypeAS4Aggregator:   8,
+	BGPPathAttrTypeOTC:             4,
+}
+
+// Error handling actions for malformed UPDATE messages as defined in RFC 7606, in the increasing order of severity.
+type BGPUpdateErrorAction uint8
+
+const (
+	BGPUpdateErrorActionNone BGPUpdateErrorAction = iota
+	BGPUpdateErrorActionAttrDiscard
+	BGPUpdateErrorActionTreatAsWithdraw
+	BGPUpdateErrorActionAfiSafiDisable
+	BGPUpdateErrorActionSessionReset
+)
+
+var BGPUpdateErrorActionToStrMap = map[BGPUpdateErrorAction]string{
+	BGPUpdateErrorActionNone:            "None",
+	BGPUpdateErrorActionAttrDiscard:     "AttributeDiscard",
+	BGPUpdateErrorActionTreatAsWithdraw: "TreatAsWithdraw",
+	BGPUpdateErrorActionAfiSafiDisable:  "AfiSafiDisable",
+	BGPUpdateErrorActionSessionReset:    "SessionReset",
+}
+
+// Attributes that are not in this map use treat-as-withdraw.
+var BGPPathAttrTypeErrorActionMap = map[BGPPathAttrType]BGPUpdateErrorAction{
+	BGPPathAttrTypeOrigin:          BGPUpdateErrorActionTreatAsWithdraw,
+	BGPPathAttrTypeASPath:          BGPUpdateErrorActionTreatAsWithdraw,
+	BGPPathAttrTypeNextHop:         BGPUpdateErrorActionTreatAsWithdraw,
+	BGPPathAttrTypeMultiExitDisc:   BGPUpdateErrorActionTreatAsWithdraw,
+	BGPPathAttrTypeLocalPref:       BGPUpdateErrorActionTreatAsWithdraw,
+	BGPPathAttrTypeAtomicAggregate: BGPUpdateErrorActionAttrDiscard,
+	BGPPathAttrTypeAggregator:      BGPUpdateErrorActionAttrDiscard,
+	BGPPathAttrTypeCommunities:     BGPUpdateErrorActionTreatAsWithdraw,
+	BGPPathAttrTypeOriginatorId:    BGPUpdateErrorActionTreatAsWithdraw,
+	BGPPathAttrTypeClusterList:     BGPUpdateErrorActionTreatAsWithdraw,
+	BGPPathAttrTypeMPReachNLRI:     BGPUpdateErrorActionAfiSafiDisable,
+	BGPPathAttrTypeMPUnreachNLRI:   BGPUpdateErrorActionAfiSafiDisable,
+	BGPPathAttrTypeAS4Path:         BGPUpdateErrorActionAttrDiscard,
+	BGPPathAttrTypeAS4Aggregator:   BGPUpdateErrorActionAttrDiscard,
+	BGPPathAttrTypeLinkState:       BGPUpdateErrorActionAttrDiscard,
+	BGPPathAttrTypeOTC:             BGPUpdateErrorActionTreatAsWithdraw,
 }
 
 type BGPMessageError struct {
@@ -269,6 +390,30 @@ func (e BGPMessageError) Error() string {
 	return fmt.Sprintf("%v:%v - %v", e.TypeCode, e.SubTypeCode, e.Message)
 }
 
+type BGPAttrError struct {
+	Code        BGPPathAttrType
+	Action      BGPUpdateErrorAction
+	ProtoFamily uint32
+	Err         BGPMessageError
+}
+
+// BGPUpdateAttrErrors is returned when the path attribute errors in an UPDATE message were handled as per
+// RFC 7606 and the message can still be processed without resetting the session.
+type BGPUpdateAttrErrors struct {
+	Action BGPUpdateErrorAction
+	Errors []BGPAttrError
+}
+
+func (e BGPUpdateAttrErrors) Error() string {
+	return fmt.Sprintf("Update message path attr errors, action: %s, errors: %v",
+		BGPUpdateErrorActionToStrMap[e.Action], e.Errors)
+}
+
+func IsUpdateAttrErrors(err error) bool {
+	_, ok := err.(BGPUpdateAttrErrors)
+	return ok
+}
+
 type BGPHeader struct {
 	Marker [BGPHeaderMarkerLen]byte
 	Length uint16
@@ -304,6 +449,18 @@ func (header *BGPHeader) Len() uint32 {
 	return uint32(header.Length)
 }
 
+// ValidateLen checks the message length in the header against the minimum length of a BGP message and the
+// maximum length negotiated for the session.
+func (header *BGPHeader) ValidateLen(maxLen uint32) error {
+	if header.Len() < BGPMsgHeaderLen || header.Len() > maxLen {
+		data := make([]byte, 2)
+		binary.BigEndian.PutUint16(data, header.Length)
+		return BGPMessageError{BGPMsgHeaderError, BGPBadMessageLen, data,
+			fmt.Sprintf("Bad message length %d, max allowed %d", header.Len(), maxLen)}
+	}
+	return nil
+}
+
 type BGPBody interface {
 	Clone() BGPBody
 	Encode() ([]byte, error)
@@ -399,6 +556,83 @@ func NewBGPCapMPExt(afi AFI, safi SAFI) *BGPCapMPExt {
 	}
 }
 
+type BGPCapExtendedMsg struct {
+	BGPCapabilityBase
+}
+
+func (msg *BGPCapExtendedMsg) New() BGPCapability {
+	return &BGPCapExtendedMsg{}
+}
+
+func (msg *BGPCapExtendedMsg) Encode() ([]byte, error) {
+	return msg.BGPCapabilityBase.Encode()
+}
+
+func (msg *BGPCapExtendedMsg) Decode(pkt []byte) error {
+	err := msg.BGPCapabilityBase.Decode(pkt)
+	if err != nil {
+		return err
+	}
+
+	if msg.Len != 0 {
+		return BGPMessageError{BGPOpenMsgError, BGPUnspecific, nil,
+			fmt.Sprintf("Extended message capability length %d is not 0", msg.Len)}
+	}
+	return nil
+}
+
+func NewBGPCapExtendedMsg() *BGPCapExtendedMsg {
+	return &BGPCapExtendedMsg{
+		BGPCapabilityBase: BGPCapabilityBase{
+			Type: BGPCapTypeExtendedMsg,
+			Len:  0,
+		},
+	}
+}
+
+type BGPCapRole struct {
+	BGPCapabilityBase
+	Value BGPRole
+}
+
+func (msg *BGPCapRole) New() BGPCapability {
+	return &BGPCapRole{}
+}
+
+func (msg *BGPCapRole) Encode() ([]byte, error) {
+	pkt, err := msg.BGPCapabilityBase.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	pkt[2] = uint8(msg.Value)
+	return pkt, nil
+}
+
+func (msg *BGPCapRole) Decode(pkt []byte) error {
+	err := msg.BGPCapabilityBase.Decode(pkt)
+	if err != nil {
+		return err
+	}
+
+	if msg.Len != 1 {
+		return BGPMessageError{BGPOpenMsgError, BGPRoleMismatch, nil,
+			fmt.Sprintf("Role capability length %d is not 1", msg.Len)}
+	}
+	msg.Value = BGPRole(pkt[2])
+	return nil
+}
+
+func NewBGPCapRole(role BGPRole) *BGPCapRole {
+	return &BGPCapRole{
+		BGPCapabilityBase: BGPCapabilityBase{
+			Type: BGPCapTypeRole,
+			Len:  1,
+		},
+		Value: role,
+	}
+}
+
 type BGPCapAS4Path struct {
 	BGPCapabilityBase
 	Value uint32
@@ -855,12 +1089,61 @@ func (msg *BGPNotification) Decode(header *BGPHeader, pkt []byte, data interface
 }
 
 func NewBGPNotificationMessage(errorCode uint8, errorSubCode uint8, data []byte) *BGPMessage {
+	return NewBGPNotificationMessageWithMaxLen(errorCode, errorSubCode, data, BGPMsgMaxLen)
+}
+
+// NewBGPNotificationMessageWithMaxLen truncates the data so that the notification does not exceed maxLen bytes.
+func NewBGPNotificationMessageWithMaxLen(errorCode uint8, errorSubCode uint8, data []byte,
+	maxLen uint32) *BGPMessage {
+	if uint32(len(data))+BGPNotificationMsgMinLen > maxLen {
+		data = data[:maxLen-BGPNotificationMsgMinLen]
+	}
 	return &BGPMessage{
-		Header: BGPHeader{Length: 21 + uint16(len(data)), Type: BGPMsgTypeNotification},
+		Header: BGPHeader{Length: BGPNotificationMsgMinLen + uint16(len(data)), Type: BGPMsgTypeNotification},
 		Body:   &BGPNotification{errorCode, errorSubCode, data},
 	}
 }
 
+// EncodeShutdownCommunication encodes the free-form operator message sent in the Cease/Administrative-Shutdown
+// and Cease/Administrative-Reset notifications (RFC 8203). The message is truncated on a UTF-8 character boundary.
+func EncodeShutdownCommunication(msg string) []byte {
+	if len(msg) > BGPShutdownCommunicationMaxLen {
+		msg = msg[:BGPShutdownCommunicationMaxLen]
+		for len(msg) > 0 && !utf8.ValidString(msg) {
+			msg = msg[:len(msg)-1]
+		}
+	}
+	data := make([]byte, 1, len(msg)+1)
+	data[0] = uint8(len(msg))
+	return append(data, msg...)
+}
+
+func NewBGPShutdownNotificationMessage(errorSubCode uint8, msg string) *BGPMessage {
+	var data []byte
+	if msg != "" {
+		data = EncodeShutdownCommunication(msg)
+	}
+	return NewBGPNotificationMessage(BGPCease, errorSubCode, data)
+}
+
+// GetShutdownCommunication returns the operator message carried in the notification, if any.
+func (msg *BGPNotification) GetShutdownCommunication() (string, bool) {
+	if msg.ErrorCode != BGPCease ||
+		(msg.ErrorSubcode != BGPCeaseAdminShutdown && msg.ErrorSubcode != BGPCeaseAdminReset) {
+		return "", false
+	}
+
+	if len(msg.Data) == 0 {
+		return "", false
+	}
+
+	msgLen := int(msg.Data[0])
+	if msgLen == 0 || msgLen+1 > len(msg.Data) || !utf8.Valid(msg.Data[1:msgLen+1]) {
+		return "", false
+	}
+	return string(msg.Data[1 : msgLen+1]), true
+}
+
 type NLRI interface {
 	Clone() NLRI
 	Encode(AFI) ([]byte, error)
@@ -1517,7 +1800,7 @@ func (as *BGPPathAttrASPath) Decode(pkt []byte, data interface{}) error {
 
 		err = asPathSegment.Decode(pkt[ptr:], data)
 		if err != nil {
-			return nil
+			return BGPMessageError{BGPUpdateMsgError, BGPMalformedASPath, nil, "Malformed AS path segment"}
 		}
 		ptr += uint32(asPathSegment.TotalLen())
 		if ptr > (uint32(as.Length) + uint32(as.BGPPathAttrLen)) {
@@ -1611,7 +1894,7 @@ func (as *BGPPathAttrAS4Path) Decode(pkt []byte, data interface{}) error {
 
 		err = asPathSegment.Decode(pkt[ptr:], data)
 		if err != nil {
-			return nil
+			return BGPMessageError{BGPUpdateMsgError, BGPMalformedASPath, nil, "Malformed AS path segment"}
 		}
 		ptr += uint32(asPathSegment.TotalLen())
 		if ptr > (uint32(as.Length) + uint32(as.BGPPathAttrLen)) {
@@ -1937,7 +2220,7 @@ func (a *BGPPathAttrAggregator) Decode(pkt []byte, data interface{}) error {
 
 	peerAttrs := data.(BGPPeerAttrs)
 	asSize := peerAttrs.ASSize
-	if a.BGPPathAttrBase.Length < uint16(asSize+4) {
+	if a.BGPPathAttrBase.Length != uint16(asSize+4) {
 		return BGPMessageError{BGPUpdateMsgError, BGPAttrLenError, pkt[:a.BGPPathAttrBase.TotalLen()], "Bad Attribute Length"}
 	}
 
@@ -2099,6 +2382,53 @@ func NewBGPPathAttrOriginatorId(id net.IP) *BGPPathAttrOriginatorId {
 	}
 }
 
+type BGPPathAttrOTC struct {
+	BGPPathAttrBase
+	Value uint32
+}
+
+func (o *BGPPathAttrOTC) Clone() BGPPathAttr {
+	x := *o
+	x.BGPPathAttrBase = o.BGPPathAttrBase.Clone()
+	return &x
+}
+
+func (o *BGPPathAttrOTC) Encode() ([]byte, error) {
+	pkt, err := o.BGPPathAttrBase.Encode()
+	if err != nil {
+		return pkt, err
+	}
+
+	binary.BigEndian.PutUint32(pkt[o.BGPPathAttrBase.BGPPathAttrLen:], o.Value)
+	return pkt, nil
+}
+
+func (o *BGPPathAttrOTC) Decode(pkt []byte, data interface{}) error {
+	err := o.BGPPathAttrBase.Decode(pkt, data)
+	if err != nil {
+		return err
+	}
+
+	o.Value = binary.BigEndian.Uint32(pkt[o.BGPPathAttrLen : o.BGPPathAttrLen+o.Length])
+	return nil
+}
+
+func (o *BGPPathAttrOTC) New() BGPPathAttr {
+	return &BGPPathAttrOTC{}
+}
+
+func NewBGPPathAttrOTC(as uint32) *BGPPathAttrOTC {
+	return &BGPPathAttrOTC{
+		BGPPathAttrBase: BGPPathAttrBase{
+			Flags:          BGPPathAttrFlagOptional | BGPPathAttrFlagTransitive,
+			Code:           BGPPathAttrTypeOTC,
+			Length:         4,
+			BGPPathAttrLen: 3,
+		},
+		Value: as,
+	}
+}
+
 type BGPPathAttrClusterList struct {
 	BGPPathAttrBase
 	Value []uint32
@@ -2133,6 +2463,10 @@ func (c *BGPPathAttrClusterList) Decode(pkt []byte, data interface{}) error {
 		return err
 	}
 
+	if c.Length%4 != 0 {
+		return BGPMessageError{BGPUpdateMsgError, BGPAttrLenError, pkt[:c.TotalLen()], "Bad Attribute Length"}
+	}
+
 	var i uint16
 	c.Value = make([]uint32, c.Length/4)
 	for i = 0; i < uint16(c.Length/4); i++ {
@@ -2164,6 +2498,89 @@ func NewBGPPathAttrClusterList() *BGPPathAttrClusterList {
 	}
 }
 
+type BGPPathAttrCommunities struct {
+	BGPPathAttrBase
+	Value []uint32
+}
+
+func (c *BGPPathAttrCommunities) Clone() BGPPathAttr {
+	x := *c
+	x.BGPPathAttrBase = c.BGPPathAttrBase.Clone()
+	x.Value = make([]uint32, len(c.Value))
+	copy(x.Value, c.Value)
+	return &x
+}
+
+func (c *BGPPathAttrCommunities) Encode() ([]byte, error) {
+	pkt, err := c.BGPPathAttrBase.Encode()
+	if err != nil {
+		return pkt, err
+	}
+
+	var i uint16
+	for i = 0; i < uint16(len(c.Value)); i++ {
+		binary.BigEndian.PutUint32(pkt[c.BGPPathAttrBase.BGPPathAttrLen+(4*i):], c.Value[i])
+	}
+	return pkt, nil
+}
+
+func (c *BGPPathAttrCommunities) Decode(pkt []byte, data interface{}) error {
+	err := c.BGPPathAttrBase.Decode(pkt, data)
+	if err != nil {
+		return err
+	}
+
+	if c.Length%4 != 0 {
+		return BGPMessageError{BGPUpdateMsgError, BGPAttrLenError, pkt[:c.TotalLen()], "Bad Attribute Length"}
+	}
+
+	var i uint16
+	c.Value = make([]uint32, c.Length/4)
+	for i = 0; i < uint16(c.Length/4); i++ {
+		c.Value[i] = binary.BigEndian.Uint32(pkt[c.BGPPathAttrLen+(4*i) : c.BGPPathAttrLen+(4*i)+4])
+	}
+	return nil
+}
+
+func (c *BGPPathAttrCommunities) HasCommunity(community uint32) bool {
+	for _, val := range c.Value {
+		if val == community {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *BGPPathAttrCommunities) AddCommunity(community uint32) bool {
+	if c.HasCommunity(community) {
+		return false
+	}
+
+	c.Value = append(c.Value, community)
+	c.Length += 4
+	if c.Length > 255 {
+		c.Flags |= BGPPathAttrFlagExtendedLen
+		c.BGPPathAttrLen = 4
+	}
+	return true
+}
+
+func (c *BGPPathAttrCommunities) New() BGPPathAttr {
+	return &BGPPathAttrCommunities{}
+}
+
+func NewBGPPathAttrCommunities() *BGPPathAttrCommunities {
+	return &BGPPathAttrCommunities{
+		BGPPathAttrBase: BGPPathAttrBase{
+			Flags:          BGPPathAttrFlagOptional | BGPPathAttrFlagTransitive,
+			Code:           BGPPathAttrTypeCommunities,
+			Length:         0,
+			BGPPathAttrLen: 3,
+		},
+		Value: make([]uint32, 0),
+	}
+}
+
 type BGPPathAttrUnknown struct {
 	BGPPathAttrBase
 	Value []byte
@@ -2220,6 +2637,7 @@ type BGPUpdate struct {
 	TotalPathAttrLen   uint16
 	PathAttributes     []BGPPathAttr
 	NLRI               []NLRI
+	AttrErrors         []BGPAttrError
 }
 
 func (msg *BGPUpdate) Clone() BGPBody {
@@ -2298,7 +2716,9 @@ func decodeNLRI(pkt []byte, ipPrefix *[]NLRI, length uint32, afi AFI, data inter
 	peerAttrs := data.(BGPPeerAttrs)
 
 	for ptr < length {
-		if peerAttrs.AddPathsRxActual {
+		if afi == AfiLinkState {
+			ip = &BGPLSNLRI{}
+		} else if peerAttrs.AddPathsRxActual {
 			ip = &ExtNLRI{}
 		} else {
 			ip = &IPPrefix{}
@@ -2319,24 +2739,129 @@ func decodeNLRI(pkt []byte, ipPrefix *[]NLRI, length uint32, afi AFI, data inter
 	return ptr, nil
 }
 
-func checkPathAttributes(pathAttrs []BGPPathAttr) error {
-	found := make(map[BGPPathAttrType]bool)
-	for _, attr := range pathAttrs {
-		if found[attr.GetCode()] {
-			return BGPMessageError{BGPUpdateMsgError, BGPMalformedAttrList, nil,
-				fmt.Sprintf("Path Attr type %d appeared twice in the UPDATE message", attr)}
+func getPathAttrTotalLen(pkt []byte) (uint32, bool) {
+	if len(pkt) < 3 {
+		return 0, false
+	}
+
+	if BGPPathAttrFlag(pkt[0])&BGPPathAttrFlagExtendedLen != 0 {
+		if len(pkt) < 4 {
+			return 0, false
 		}
-		found[attr.GetCode()] = true
+		return uint32(binary.BigEndian.Uint16(pkt[2:4])) + 4, true
+	}
+	return uint32(pkt[2]) + 3, true
+}
+
+func getAttrErrorAction(code BGPPathAttrType, pkt []byte) (BGPUpdateErrorAction, uint32) {
+	action, ok := BGPPathAttrTypeErrorActionMap[code]
+	if !ok {
+		action = BGPUpdateErrorActionTreatAsWithdraw
+	}
+
+	protoFamily := uint32(0)
+	if action == BGPUpdateErrorActionAfiSafiDisable {
+		hdrLen := uint32(3)
+		if BGPPathAttrFlag(pkt[0])&BGPPathAttrFlagExtendedLen != 0 {
+			hdrLen = 4
+		}
+		// AFI/SAFI can't be determined, the session has to be reset
+		if uint32(len(pkt)) < hdrLen+3 {
+			return BGPUpdateErrorActionSessionReset, protoFamily
+		}
+		afi := AFI(binary.BigEndian.Uint16(pkt[hdrLen : hdrLen+2]))
+		safi := SAFI(pkt[hdrLen+2])
+		protoFamily = GetProtocolFamily(afi, safi)
+	}
+	return action, protoFamily
+}
+
+func (msg *BGPUpdate) addAttrError(code BGPPathAttrType, action BGPUpdateErrorAction, protoFamily uint32,
+	err BGPMessageError) {
+	msg.AttrErrors = append(msg.AttrErrors, BGPAttrError{code, action, protoFamily, err})
+}
+
+func (msg *BGPUpdate) GetErrorAction() BGPUpdateErrorAction {
+	action := BGPUpdateErrorActionNone
+	for _, attrErr := range msg.AttrErrors {
+		if attrErr.Action > action {
+			action = attrErr.Action
+		}
+	}
+	return action
+}
+
+func (msg *BGPUpdate) HasErrorAction(action BGPUpdateErrorAction) bool {
+	for _, attrErr := range msg.AttrErrors {
+		if attrErr.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (msg *BGPUpdate) GetDisabledProtoFamilies() []uint32 {
+	protoFamilies := make([]uint32, 0)
+	for _, attrErr := range msg.AttrErrors {
+		if attrErr.Action == BGPUpdateErrorActionAfiSafiDisable {
+			protoFamilies = append(protoFamilies, attrErr.ProtoFamily)
+		}
+	}
+	return protoFamilies
+}
+
+func (msg *BGPUpdate) checkMandatoryAttrs(found map[BGPPathAttrType]bool) {
+	if len(msg.NLRI) == 0 && !HasMPReachNLRI(msg.PathAttributes) {
+		return
 	}
 
 	for _, attrType := range BGPPathAttrWellKnownMandatory {
+		if attrType == BGPPathAttrTypeNextHop && len(msg.NLRI) == 0 {
+			continue
+		}
 		if !found[attrType] {
-			return BGPMessageError{BGPUpdateMsgError, BGPMissingWellKnownAttr, []byte{byte(attrType)},
-				fmt.Sprintf("Path Attr type %v appeared twice in the UPDATE message", attrType)}
+			msg.addAttrError(attrType, BGPUpdateErrorActionTreatAsWithdraw, 0,
+				BGPMessageError{BGPUpdateMsgError, BGPMissingWellKnownAttr, []byte{byte(attrType)},
+					fmt.Sprintf("Well known mandatory path attr type %d is missing in the UPDATE message", attrType)})
 		}
 	}
+}
 
-	return nil
+// TreatAsWithdraw converts the UPDATE message into a withdraw of all the NLRIs that were found in it.
+func (msg *BGPUpdate) TreatAsWithdraw() {
+	var mpReach *BGPPathAttrMPReachNLRI
+	var mpUnreach *BGPPathAttrMPUnreachNLRI
+
+	pathAttrs := make([]BGPPathAttr, 0)
+	for _, pa := range msg.PathAttributes {
+		switch attr := pa.(type) {
+		case *BGPPathAttrMPReachNLRI:
+			mpReach = attr
+		case *BGPPathAttrMPUnreachNLRI:
+			mpUnreach = attr
+			pathAttrs = append(pathAttrs, attr)
+		}
+	}
+
+	if mpReach != nil && len(mpReach.NLRI) > 0 {
+		if mpUnreach != nil && mpUnreach.AFI == mpReach.AFI && mpUnreach.SAFI == mpReach.SAFI {
+			mpUnreach.AddNLRIList(mpReach.NLRI)
+		} else {
+			mpUnreach = NewBGPPathAttrMPUnreachNLRI()
+			mpUnreach.AFI = mpReach.AFI
+			mpUnreach.SAFI = mpReach.SAFI
+			mpUnreach.AddNLRIList(mpReach.NLRI)
+			pathAttrs = append(pathAttrs, mpUnreach)
+		}
+	}
+
+	msg.WithdrawnRoutes = append(msg.WithdrawnRoutes, msg.NLRI...)
+	msg.NLRI = make([]NLRI, 0)
+	msg.PathAttributes = pathAttrs
+	msg.TotalPathAttrLen = 0
+	for _, pa := range msg.PathAttributes {
+		msg.TotalPathAttrLen += uint16(pa.TotalLen())
+	}
 }
 
 func (msg *BGPUpdate) Decode(header *BGPHeader, pkt []byte, data interface{}) error {
@@ -2368,18 +2893,50 @@ func (msg *BGPUpdate) Decode(header *BGPHeader, pkt []byte, data interface{}) er
 	}
 
 	msg.PathAttributes = make([]BGPPathAttr, 0)
-	for length > 0 {
-		pa := BGPGetPathAttr(pkt[ptr:])
-		err = pa.Decode(pkt[ptr:], data)
+	msg.AttrErrors = nil
+	found := make(map[BGPPathAttrType]bool)
+	paEnd := ptr + uint32(length)
+	for ptr < paEnd {
+		paLen, ok := getPathAttrTotalLen(pkt[ptr:paEnd])
+		if !ok || ptr+paLen > paEnd {
+			// Can't find the start of the next attribute, skip the rest of the attributes
+			msg.addAttrError(BGPPathAttrTypeUnknown, BGPUpdateErrorActionTreatAsWithdraw, 0,
+				BGPMessageError{BGPUpdateMsgError, BGPAttrLenError, nil,
+					"Path attribute length exceeds the total path attribute length"})
+			ptr = paEnd
+			break
+		}
+
+		attrPkt := pkt[ptr : ptr+paLen]
+		code := BGPPathAttrType(attrPkt[1])
+		ptr += paLen
+		if found[code] {
+			if code == BGPPathAttrTypeMPReachNLRI || code == BGPPathAttrTypeMPUnreachNLRI {
+				return BGPMessageError{BGPUpdateMsgError, BGPMalformedAttrList, nil,
+					fmt.Sprintf("Path Attr type %d appeared twice in the UPDATE message", code)}
+			}
+			msg.addAttrError(code, BGPUpdateErrorActionAttrDiscard, 0,
+				BGPMessageError{BGPUpdateMsgError, BGPMalformedAttrList, nil,
+					fmt.Sprintf("Path Attr type %d appeared twice in the UPDATE message", code)})
+			continue
+		}
+		found[code] = true
+
+		pa := BGPGetPathAttr(attrPkt)
+		err = pa.Decode(attrPkt, data)
 		if err != nil {
-			return err
+			bgpErr, ok := err.(BGPMessageError)
+			if !ok {
+				bgpErr = BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil, err.Error()}
+			}
+			action, protoFamily := getAttrErrorAction(code, attrPkt)
+			if action == BGPUpdateErrorActionSessionReset {
+				return bgpErr
+			}
+			msg.addAttrError(code, action, protoFamily, bgpErr)
+			continue
 		}
 		msg.PathAttributes = append(msg.PathAttributes, pa)
-		ptr += pa.TotalLen()
-		length -= int(pa.TotalLen())
-	}
-	if length < 0 {
-		return BGPMessageError{BGPUpdateMsgError, BGPMalformedAttrList, nil, "Malformed Attributes"}
 	}
 
 	msg.NLRI = make([]NLRI, 0)
@@ -2388,6 +2945,15 @@ func (msg *BGPUpdate) Decode(header *BGPHeader, pkt []byte, data interface{}) er
 	if err != nil {
 		return err
 	}
+
+	msg.checkMandatoryAttrs(found)
+	// Treat-as-withdraw applies to the NLRIs that are not disabled even if an AFI/SAFI is disabled as well
+	if msg.HasErrorAction(BGPUpdateErrorActionTreatAsWithdraw) {
+		msg.TreatAsWithdraw()
+	}
+	if len(msg.AttrErrors) > 0 {
+		return BGPUpdateAttrErrors{msg.GetErrorAction(), msg.AttrErrors}
+	}
 	return nil
 }
 
@@ -2415,13 +2981,17 @@ func (msg *BGPMessage) Clone() *BGPMessage {
 }
 
 func (msg *BGPMessage) Encode() ([]byte, error) {
+	return msg.EncodeWithMaxLen(BGPMsgMaxLen)
+}
+
+func (msg *BGPMessage) EncodeWithMaxLen(maxLen uint32) ([]byte, error) {
 	body, err := msg.Body.Encode()
 	if err != nil {
 		return nil, err
 	}
 
 	if msg.Header.Length == 0 {
-		if BGPMsgHeaderLen+len(body) > BGPMsgMaxLen {
+		if uint32(BGPMsgHeaderLen+len(body)) > maxLen {
 			return nil, BGPMessageError{0, 0, nil, fmt.Sprintf("BGP message is %d bytes long", BGPMsgHeaderLen+len(body))}
 		}
 		msg.Header.Length = BGPMsgHeaderLen + uint16(len(body))
@@ -2454,7 +3024,7 @@ func (msg *BGPMessage) Decode(header *BGPHeader, pkt []byte, data interface{}) e
 	}
 	err := msg.Body.Decode(header, pkt, data)
 
-	if err == nil && msg.Header.Type == BGPMsgTypeUpdate {
+	if (err == nil || IsUpdateAttrErrors(err)) && msg.Header.Type == BGPMsgTypeUpdate {
 		NormalizeASPath(msg, data)
 	}
 	return err
@@ -32,6 +32,7 @@ import (
 	"l3/bgp/utils"
 	"math"
 	"net"
+	"strings"
 	"testing"
 	"utils/logging"
 )
@@ -243,6 +244,107 @@ func TestBGPUpdatePathAttrsBadLength(t *testing.T) {
 	}
 }
 
+func TestBGPUpdateRevisedErrorHandling(t *testing.T) {
+	origin := "40010100"
+	asPath := "40020602011908b10a"
+	nextHop := "4003040a0a00c2"
+	med := "80040400000000"
+	nlri := "180a0101"
+	mpReachV6 := "800e1e0002011020010db8000000000000000000000001004020010db800000000"
+	mpUnreachV6 := "800f03000201"
+	v6Family := GetProtocolFamily(AfiIP6, SafiUnicast)
+
+	tests := []struct {
+		name      string
+		pathAttrs string
+		nlri      string
+		resetErr  bool
+		action    BGPUpdateErrorAction
+		numNLRI   int
+		numWdrawn int
+	}{
+		{"no error", origin + asPath + nextHop + med, nlri, false, BGPUpdateErrorActionNone, 1, 0},
+		{"bad aggregator length", origin + asPath + nextHop + med + "c007051908b10a0a", nlri, false,
+			BGPUpdateErrorActionAttrDiscard, 1, 0},
+		{"duplicate MED", origin + asPath + nextHop + med + med, nlri, false, BGPUpdateErrorActionAttrDiscard, 1, 0},
+		{"bad MED length", origin + asPath + nextHop + "800403000000", nlri, false,
+			BGPUpdateErrorActionTreatAsWithdraw, 0, 1},
+		{"missing origin", asPath + nextHop + med, nlri, false, BGPUpdateErrorActionTreatAsWithdraw, 0, 1},
+		{"attr overrun", origin + asPath + nextHop + "800408000000", nlri, false,
+			BGPUpdateErrorActionTreatAsWithdraw, 0, 1},
+		{"malformed MP reach", origin + asPath + nextHop + med + "800e050002011000", nlri, false,
+			BGPUpdateErrorActionAfiSafiDisable, 1, 0},
+		{"duplicate MP unreach", origin + asPath + nextHop + med + mpUnreachV6 + mpUnreachV6, nlri, true,
+			BGPUpdateErrorActionSessionReset, 0, 0},
+		{"MP reach with bad MED length", origin + asPath + "800403000000" + mpReachV6, "", false,
+			BGPUpdateErrorActionTreatAsWithdraw, 0, 0},
+		{"bad MED length with malformed MP reach", origin + asPath + nextHop + "800403000000" + "800e050002011000",
+			nlri, false, BGPUpdateErrorActionAfiSafiDisable, 0, 1},
+	}
+
+	for _, test := range tests {
+		strPkt := fmt.Sprintf("0000%04x", len(test.pathAttrs)/2) + test.pathAttrs + test.nlri
+		hexPkt, err := hex.DecodeString(strPkt)
+		if err != nil {
+			t.Fatal("Failed to decode the string to hex, string =", strPkt)
+		}
+
+		header := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xff, 0x00, 0x00, 0x02}
+		binary.BigEndian.PutUint16(header[16:18], uint16(len(hexPkt)+19))
+		bgpHeader := NewBGPHeader()
+		err = bgpHeader.Decode(header)
+		if err != nil {
+			t.Fatal("BGP packet header decode failed with error", err)
+		}
+
+		peerAttrs := BGPPeerAttrs{ASSize: 4}
+		bgpMessage := NewBGPMessage()
+		err = bgpMessage.Decode(bgpHeader, hexPkt, peerAttrs)
+		if test.resetErr {
+			if err == nil {
+				t.Error(test.name, "- BGP update message decode called... expected failure, got NO error")
+			}
+			continue
+		}
+		if test.action == BGPUpdateErrorActionNone && err != nil {
+			t.Error(test.name, "- BGP update message decode failed with error:", err)
+			continue
+		}
+		if test.action != BGPUpdateErrorActionNone && !IsUpdateAttrErrors(err) {
+			t.Error(test.name, "- BGP update message decode called... expected path attr errors, got", err)
+			continue
+		}
+
+		updateMsg := bgpMessage.Body.(*BGPUpdate)
+		if updateMsg.GetErrorAction() != test.action {
+			t.Error(test.name, "- expected action", BGPUpdateErrorActionToStrMap[test.action], "got",
+				BGPUpdateErrorActionToStrMap[updateMsg.GetErrorAction()])
+		}
+		if len(updateMsg.NLRI) != test.numNLRI || len(updateMsg.WithdrawnRoutes) != test.numWdrawn {
+			t.Error(test.name, "- expected", test.numNLRI, "NLRI and", test.numWdrawn, "withdrawn routes, got NLRI:",
+				updateMsg.NLRI, "withdrawn routes:", updateMsg.WithdrawnRoutes)
+		}
+
+		if test.action == BGPUpdateErrorActionAfiSafiDisable {
+			families := updateMsg.GetDisabledProtoFamilies()
+			if len(families) != 1 || families[0] != v6Family {
+				t.Error(test.name, "- expected disabled families", []uint32{v6Family}, "got", families)
+			}
+		}
+
+		if test.name == "MP reach with bad MED length" {
+			if HasMPReachNLRI(updateMsg.PathAttributes) {
+				t.Error(test.name, "- MP_REACH_NLRI was not removed from the path attributes")
+			}
+			mpUnreach, ok := updateMsg.PathAttributes[0].(*BGPPathAttrMPUnreachNLRI)
+			if len(updateMsg.PathAttributes) != 1 || !ok || len(mpUnreach.NLRI) != 1 {
+				t.Error(test.name, "- expected MP_UNREACH_NLRI with 1 NLRI, got path attrs", updateMsg.PathAttributes)
+			}
+		}
+	}
+}
+
 func TestBGPUpdatePacketDecode(t *testing.T) {
 	strPkts := make([]string, 0)
 	// With base Path attrs - ORIGIN, AS_PATH (4 byte), NEXT_HOP, MULTI_EXIT_DISC
@@ -436,3 +538,286 @@ func TestBGPUpdateEncode(t *testing.T) {
 		t.Fatal("Cloned update message is not the same as the original message")
 	}
 }
+
+func TestBGPHeaderValidateLen(t *testing.T) {
+	lengths := []uint16{18, 19, 4096, 4097, 65535}
+	results := []bool{false, true, true, false, false}
+	extResults := []bool{false, true, true, true, true}
+	for idx, length := range lengths {
+		header := NewBGPHeader()
+		header.Length = length
+		header.Type = BGPMsgTypeUpdate
+
+		err := header.ValidateLen(BGPMsgMaxLen)
+		if (err == nil) != results[idx] {
+			t.Error("ValidateLen called with length", length, "max len", BGPMsgMaxLen, "got error:", err)
+		}
+		if err != nil {
+			bgpErr := err.(BGPMessageError)
+			if bgpErr.TypeCode != BGPMsgHeaderError || bgpErr.SubTypeCode != BGPBadMessageLen ||
+				binary.BigEndian.Uint16(bgpErr.Data) != length {
+				t.Error("ValidateLen called with length", length, "got unexpected error", bgpErr)
+			}
+		}
+
+		err = header.ValidateLen(BGPExtendedMsgMaxLen)
+		if (err == nil) != extResults[idx] {
+			t.Error("ValidateLen called with length", length, "max len", BGPExtendedMsgMaxLen, "got error:", err)
+		}
+	}
+}
+
+func TestBGPNotificationMaxLen(t *testing.T) {
+	data := make([]byte, BGPMsgMaxLen)
+	notifMsg := NewBGPNotificationMessage(BGPUpdateMsgError, BGPMalformedAttrList, data)
+	pkt, err := notifMsg.Encode()
+	if err != nil {
+		t.Fatal("BGP notification message encode failed with error:", err)
+	}
+	if len(pkt) != BGPMsgMaxLen {
+		t.Fatal("BGP notification message length expected", BGPMsgMaxLen, "got", len(pkt))
+	}
+
+	notifMsg = NewBGPNotificationMessageWithMaxLen(BGPUpdateMsgError, BGPMalformedAttrList, data,
+		BGPExtendedMsgMaxLen)
+	pkt, err = notifMsg.EncodeWithMaxLen(BGPExtendedMsgMaxLen)
+	if err != nil {
+		t.Fatal("BGP notification message encode failed with error:", err)
+	}
+	if len(pkt) != BGPNotificationMsgMinLen+BGPMsgMaxLen {
+		t.Fatal("BGP notification message length expected", BGPNotificationMsgMinLen+BGPMsgMaxLen, "got", len(pkt))
+	}
+}
+
+func TestBGPUpdateLinkState(t *testing.T) {
+	logger, err := logging.NewLogger("bgpd", "BGP", true)
+	if err != nil {
+		t.Fatal("Failed to start the logger. Exiting!!")
+	}
+	utils.SetLogger(logger)
+
+	localNode := NewBGPLSNodeDescriptor(100, 0, 0, net.ParseIP("1.1.1.1").To4())
+	remoteNode := NewBGPLSNodeDescriptor(100, 0, 0, net.ParseIP("2.2.2.2").To4())
+	pseudonode := NewBGPLSNodeDescriptor(100, 0, 0,
+		GetBGPLSPseudonodeRouterId(net.ParseIP("2.2.2.2"), net.ParseIP("10.1.1.2")))
+	lsNLRI := []NLRI{
+		NewBGPLSNodeNLRI(BGPLSProtocolOSPFv2, 0, localNode),
+		NewBGPLSLinkNLRI(BGPLSProtocolOSPFv2, 0, localNode, remoteNode, net.ParseIP("10.1.1.1"),
+			net.ParseIP("10.1.1.2"), 0, 0),
+		NewBGPLSLinkNLRI(BGPLSProtocolOSPFv2, 0, localNode, pseudonode, nil, nil, 5, 0),
+		NewBGPLSPrefixNLRI(BGPLSProtocolOSPFv2, 0, localNode, BGPLSOSPFRouteTypeIntraArea,
+			NewIPPrefix(net.ParseIP("20.1.0.0"), 16)),
+	}
+
+	pa := make([]BGPPathAttr, 0)
+	pa = append(pa, NewBGPPathAttrOrigin(BGPPathAttrOriginIGP))
+	pa = append(pa, NewBGPPathAttrASPath())
+	lsAttr := NewBGPPathAttrLinkState()
+	lsAttr.AddTLV(NewBGPLSTLV(BGPLSTLVNodeFlagBits, []byte{BGPLSNodeFlagABR}))
+	lsAttr.AddTLV(NewBGPLSUint32TLV(BGPLSTLVPrefixMetric, 10))
+	pa = append(pa, lsAttr)
+
+	mpReachNLRI := NewBGPPathAttrMPReachNLRI()
+	mpReachNLRI.AFI = AfiLinkState
+	mpReachNLRI.SAFI = SafiLinkState
+	mpNextHop := NewMPNextHopIP()
+	mpNextHop.SetNextHop(net.ParseIP("10.1.1.1").To4())
+	mpReachNLRI.SetNextHop(mpNextHop)
+	mpReachNLRI.SetNLRIList(lsNLRI)
+	pa = append(pa, mpReachNLRI)
+
+	mpUnreachNLRI := NewBGPPathAttrMPUnreachNLRI()
+	mpUnreachNLRI.AFI = AfiLinkState
+	mpUnreachNLRI.SAFI = SafiLinkState
+	mpUnreachNLRI.AddNLRI(NewBGPLSNodeNLRI(BGPLSProtocolOSPFv2, 0, remoteNode))
+	pa = append(pa, mpUnreachNLRI)
+
+	updateMsg := NewBGPUpdateMessage(make([]NLRI, 0), pa, make([]NLRI, 0))
+	pkt, err := updateMsg.Encode()
+	if err != nil {
+		t.Fatal("BGP update message with link state NLRI encode failed with error:", err)
+	}
+
+	newPkt, err := updateMsg.Clone().Encode()
+	if err != nil {
+		t.Fatal("Cloned BGP update message encode failed with error:", err)
+	}
+	if !bytes.Equal(pkt, newPkt) {
+		t.Fatal("Cloned update message is not the same as the original message")
+	}
+
+	bgpHeader := NewBGPHeader()
+	err = bgpHeader.Decode(pkt)
+	if err != nil {
+		t.Fatal("BGP packet header decode failed with error", err)
+	}
+
+	peerAttrs := BGPPeerAttrs{ASSize: 4}
+	msg := NewBGPMessage()
+	err = msg.Decode(bgpHeader, pkt[BGPMsgHeaderLen:], peerAttrs)
+	if err != nil {
+		t.Fatal("BGP update message with link state NLRI decode failed with error:", err)
+	}
+
+	body := msg.Body.(*BGPUpdate)
+	if body.GetErrorAction() != BGPUpdateErrorActionNone {
+		t.Fatal("BGP update message with link state NLRI decode returned error action", body.GetErrorAction())
+	}
+
+	var decodedReach *BGPPathAttrMPReachNLRI
+	var decodedUnreach *BGPPathAttrMPUnreachNLRI
+	var decodedLSAttr *BGPPathAttrLinkState
+	for _, attr := range body.PathAttributes {
+		switch val := attr.(type) {
+		case *BGPPathAttrMPReachNLRI:
+			decodedReach = val
+		case *BGPPathAttrMPUnreachNLRI:
+			decodedUnreach = val
+		case *BGPPathAttrLinkState:
+			decodedLSAttr = val
+		}
+	}
+
+	if decodedReach == nil || len(decodedReach.NLRI) != len(lsNLRI) {
+		t.Fatal("MP_REACH_NLRI with link state NLRI not decoded correctly:", decodedReach)
+	}
+	for idx, nlri := range decodedReach.NLRI {
+		if nlri.String() != lsNLRI[idx].String() {
+			t.Error("Link state NLRI", idx, "expected", lsNLRI[idx], "got", nlri)
+		}
+	}
+	if prefix := decodedReach.NLRI[3].GetIPPrefix(); prefix == nil || prefix.Length != 16 ||
+		!prefix.Prefix.Equal(net.ParseIP("20.1.0.0")) {
+		t.Error("Link state prefix NLRI returned wrong prefix", prefix)
+	}
+	if decodedReach.NLRI[0].GetIPPrefix() != nil {
+		t.Error("Link state node NLRI returned a prefix", decodedReach.NLRI[0].GetIPPrefix())
+	}
+
+	if decodedUnreach == nil || len(decodedUnreach.NLRI) != 1 ||
+		decodedUnreach.NLRI[0].String() != mpUnreachNLRI.NLRI[0].String() {
+		t.Fatal("MP_UNREACH_NLRI with link state NLRI not decoded correctly:", decodedUnreach)
+	}
+
+	if decodedLSAttr == nil || len(decodedLSAttr.TLVs) != 2 {
+		t.Fatal("BGP-LS attribute not decoded correctly:", decodedLSAttr)
+	}
+	if tlv, ok := decodedLSAttr.GetTLV(BGPLSTLVPrefixMetric); !ok || binary.BigEndian.Uint32(tlv.Value) != 10 {
+		t.Error("BGP-LS attribute prefix metric TLV not decoded correctly:", decodedLSAttr)
+	}
+}
+
+func TestBGPLSNLRIDecodeErrors(t *testing.T) {
+	localNode := NewBGPLSNodeDescriptor(100, 0, 0, net.ParseIP("1.1.1.1").To4())
+	linkNLRI := NewBGPLSLinkNLRI(BGPLSProtocolOSPFv2, 0, localNode, localNode, nil, nil, 1, 2)
+	pkt, err := linkNLRI.Encode(AfiLinkState)
+	if err != nil {
+		t.Fatal("Link state link NLRI encode failed with error:", err)
+	}
+
+	tests := map[string][]byte{
+		"short header":     pkt[:3],
+		"truncated nlri":   pkt[:len(pkt)-1],
+		"unknown type":     append([]byte{0, 9}, pkt[2:]...),
+		"no remote node":   append([]byte{0, byte(BGPLSNLRITypeLink), 0, 13}, pkt[4:17]...),
+		"short descriptor": append(append([]byte{}, pkt[:4]...), append(pkt[4:13], 1, 0, 0, 8)...),
+	}
+	for name, data := range tests {
+		nlri := &BGPLSNLRI{}
+		if err := nlri.Decode(data, AfiLinkState); err == nil {
+			t.Error("Link state NLRI decode did not fail for", name, "data", data)
+		}
+	}
+}
+
+func TestBGPUpdateCommunities(t *testing.T) {
+	logger, err := logging.NewLogger("bgpd", "BGP", true)
+	if err != nil {
+		t.Fatal("Failed to start the logger. Exiting!!")
+	}
+	utils.SetLogger(logger)
+
+	nlri := []NLRI{ConstructIPPrefix("20.1.10.0", "255.255.255.0")}
+	updateMsg := NewBGPUpdateMessage(make([]NLRI, 0), ConstructPathAttrForDefaultRoute(net.ParseIP("10.1.10.1"),
+		20, 200), nlri)
+	if !AddCommunity(updateMsg, BGPCommunityNoExport) || !AddCommunity(updateMsg, BGPCommunityGracefulShutdown) {
+		t.Fatal("Failed to add communities to the update message")
+	}
+	if AddCommunity(updateMsg, BGPCommunityGracefulShutdown) {
+		t.Error("AddCommunity added community", BGPCommunityGracefulShutdown, "twice")
+	}
+
+	pkt, err := updateMsg.Encode()
+	if err != nil {
+		t.Fatal("BGP update message with communities encode failed with error:", err)
+	}
+
+	bgpHeader := NewBGPHeader()
+	err = bgpHeader.Decode(pkt)
+	if err != nil {
+		t.Fatal("BGP packet header decode failed with error", err)
+	}
+
+	peerAttrs := BGPPeerAttrs{ASSize: 4}
+	msg := NewBGPMessage()
+	err = msg.Decode(bgpHeader, pkt[BGPMsgHeaderLen:], peerAttrs)
+	if err != nil {
+		t.Fatal("BGP update message with communities decode failed with error:", err)
+	}
+
+	body := msg.Body.(*BGPUpdate)
+	if body.GetErrorAction() != BGPUpdateErrorActionNone {
+		t.Fatal("BGP update message with communities decode returned error action", body.GetErrorAction())
+	}
+	if len(body.PathAttributes) != 6 {
+		t.Fatal("Expected 6 path attrs in the decoded message, got", body.PathAttributes)
+	}
+	if !HasCommunity(body.PathAttributes, BGPCommunityNoExport) ||
+		!HasCommunity(body.PathAttributes, BGPCommunityGracefulShutdown) {
+		t.Error("Communities not decoded correctly:", body.PathAttributes)
+	}
+	if HasCommunity(body.PathAttributes, BGPCommunityNoAdvertise) {
+		t.Error("HasCommunity found community", BGPCommunityNoAdvertise, "that was not added")
+	}
+}
+
+func TestBGPShutdownCommunication(t *testing.T) {
+	notifMsg := NewBGPShutdownNotificationMessage(BGPCeaseAdminShutdown, "Maintenance window, back in 1 hour")
+	pkt, err := notifMsg.Encode()
+	if err != nil {
+		t.Fatal("BGP notification message encode failed with error:", err)
+	}
+
+	bgpHeader := NewBGPHeader()
+	err = bgpHeader.Decode(pkt)
+	if err != nil {
+		t.Fatal("BGP packet header decode failed with error", err)
+	}
+
+	msg := NewBGPMessage()
+	err = msg.Decode(bgpHeader, pkt[BGPMsgHeaderLen:], BGPPeerAttrs{ASSize: 4})
+	if err != nil {
+		t.Fatal("BGP notification message decode failed with error:", err)
+	}
+
+	shutdownMsg, ok := msg.Body.(*BGPNotification).GetShutdownCommunication()
+	if !ok || shutdownMsg != "Maintenance window, back in 1 hour" {
+		t.Error("Shutdown communication not decoded correctly, got", shutdownMsg)
+	}
+
+	longMsg := strings.Repeat("a", BGPShutdownCommunicationMaxLen-1) + "é"
+	data := EncodeShutdownCommunication(longMsg)
+	if int(data[0]) != BGPShutdownCommunicationMaxLen-1 || len(data) != BGPShutdownCommunicationMaxLen {
+		t.Error("Shutdown communication not truncated on a character boundary, length", data[0])
+	}
+
+	notif := &BGPNotification{BGPCease, BGPCeaseAdminShutdown, []byte{10, 'a', 'b'}}
+	if _, ok = notif.GetShutdownCommunication(); ok {
+		t.Error("GetShutdownCommunication returned a message with a bad length")
+	}
+
+	notif = &BGPNotification{BGPCease, BGPCeasePeerDeconfigured, EncodeShutdownCommunication("bye")}
+	if _, ok = notif.GetShutdownCommunication(); ok {
+		t.Error("GetShutdownCommunication returned a message for Cease subcode", BGPCeasePeerDeconfigured)
+	}
+}
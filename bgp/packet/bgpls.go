@@ -0,0 +1,558 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// bgpls.go - North-Bound Distribution of Link-State information using BGP (RFC 7752)
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+)
+
+const (
+	AfiLinkState  AFI  = 16388
+	SafiLinkState SAFI = 71
+)
+
+const (
+	BGPLSNLRITypeNode uint16 = iota + 1
+	BGPLSNLRITypeLink
+	BGPLSNLRITypeIPv4Prefix
+	BGPLSNLRITypeIPv6Prefix
+)
+
+var BGPLSNLRITypeToStrMap = map[uint16]string{
+	BGPLSNLRITypeNode:       "Node",
+	BGPLSNLRITypeLink:       "Link",
+	BGPLSNLRITypeIPv4Prefix: "IPv4Prefix",
+	BGPLSNLRITypeIPv6Prefix: "IPv6Prefix",
+}
+
+const (
+	BGPLSProtocolISISL1 uint8 = iota + 1
+	BGPLSProtocolISISL2
+	BGPLSProtocolOSPFv2
+	BGPLSProtocolDirect
+	BGPLSProtocolStatic
+	BGPLSProtocolOSPFv3
+)
+
+// NLRI descriptor TLVs
+const (
+	BGPLSTLVLocalNode          uint16 = 256
+	BGPLSTLVRemoteNode         uint16 = 257
+	BGPLSTLVLinkLocalRemoteId  uint16 = 258
+	BGPLSTLVIPv4InterfaceAddr  uint16 = 259
+	BGPLSTLVIPv4NeighborAddr   uint16 = 260
+	BGPLSTLVOSPFRouteType      uint16 = 264
+	BGPLSTLVIPReachabilityInfo uint16 = 265
+)
+
+// Node descriptor sub-TLVs
+const (
+	BGPLSTLVAutonomousSystem uint16 = 512
+	BGPLSTLVBGPLSId          uint16 = 513
+	BGPLSTLVOSPFAreaId       uint16 = 514
+	BGPLSTLVIGPRouterId      uint16 = 515
+)
+
+// BGP-LS attribute TLVs
+const (
+	BGPLSTLVNodeFlagBits   uint16 = 1024
+	BGPLSTLVNodeName       uint16 = 1026
+	BGPLSTLVLocalRouterId  uint16 = 1028
+	BGPLSTLVRemoteRouterId uint16 = 1030
+	BGPLSTLVIGPMetric      uint16 = 1095
+	BGPLSTLVPrefixMetric   uint16 = 1155
+)
+
+const (
+	BGPLSNodeFlagAttached uint8 = 0x40
+	BGPLSNodeFlagExternal uint8 = 0x20
+	BGPLSNodeFlagABR      uint8 = 0x10
+)
+
+const (
+	BGPLSOSPFRouteTypeIntraArea uint8 = iota + 1
+	BGPLSOSPFRouteTypeInterArea
+	BGPLSOSPFRouteTypeExternal1
+	BGPLSOSPFRouteTypeExternal2
+	BGPLSOSPFRouteTypeNSSA1
+	BGPLSOSPFRouteTypeNSSA2
+)
+
+const BGPLSTLVHeaderLen = 4
+const BGPLSNLRIHeaderLen = 4
+
+// Length of the protocol id and the identifier that follow the NLRI header
+const bgplsNLRIFixedLen = 9
+
+type BGPLSTLV struct {
+	Type  uint16
+	Value []byte
+}
+
+func (t *BGPLSTLV) Clone() BGPLSTLV {
+	x := *t
+	x.Value = make([]byte, len(t.Value))
+	copy(x.Value, t.Value)
+	return x
+}
+
+func (t *BGPLSTLV) Len() uint32 {
+	return uint32(BGPLSTLVHeaderLen + len(t.Value))
+}
+
+func (t *BGPLSTLV) Encode(pkt []byte) {
+	binary.BigEndian.PutUint16(pkt[0:2], t.Type)
+	binary.BigEndian.PutUint16(pkt[2:4], uint16(len(t.Value)))
+	copy(pkt[4:], t.Value)
+}
+
+func (t *BGPLSTLV) String() string {
+	return fmt.Sprintf("{%d %x}", t.Type, t.Value)
+}
+
+func NewBGPLSTLV(tlvType uint16, value []byte) BGPLSTLV {
+	return BGPLSTLV{
+		Type:  tlvType,
+		Value: value,
+	}
+}
+
+func NewBGPLSUint32TLV(tlvType uint16, value uint32) BGPLSTLV {
+	bytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(bytes, value)
+	return NewBGPLSTLV(tlvType, bytes)
+}
+
+func encodeBGPLSTLVs(tlvs []BGPLSTLV) []byte {
+	length := uint32(0)
+	for idx := range tlvs {
+		length += tlvs[idx].Len()
+	}
+
+	pkt := make([]byte, length)
+	idx := uint32(0)
+	for i := range tlvs {
+		tlvs[i].Encode(pkt[idx:])
+		idx += tlvs[i].Len()
+	}
+	return pkt
+}
+
+func decodeBGPLSTLVs(pkt []byte) ([]BGPLSTLV, error) {
+	tlvs := make([]BGPLSTLV, 0)
+	idx := 0
+	for idx < len(pkt) {
+		if len(pkt[idx:]) < BGPLSTLVHeaderLen {
+			return tlvs, BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil,
+				"Not enough data to decode BGP-LS TLV"}
+		}
+		tlvType := binary.BigEndian.Uint16(pkt[idx : idx+2])
+		tlvLen := int(binary.BigEndian.Uint16(pkt[idx+2 : idx+4]))
+		idx += BGPLSTLVHeaderLen
+		if len(pkt[idx:]) < tlvLen {
+			return tlvs, BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil,
+				fmt.Sprintf("BGP-LS TLV %d length %d exceeds the available data", tlvType, tlvLen)}
+		}
+		value := make([]byte, tlvLen)
+		copy(value, pkt[idx:idx+tlvLen])
+		tlvs = append(tlvs, NewBGPLSTLV(tlvType, value))
+		idx += tlvLen
+	}
+	return tlvs, nil
+}
+
+type BGPLSNodeDescriptor struct {
+	ASN      uint32
+	BGPLSId  uint32
+	AreaId   uint32
+	RouterId []byte
+}
+
+func (n *BGPLSNodeDescriptor) Clone() BGPLSNodeDescriptor {
+	x := *n
+	x.RouterId = make([]byte, len(n.RouterId))
+	copy(x.RouterId, n.RouterId)
+	return x
+}
+
+func (n *BGPLSNodeDescriptor) getTLVs() []BGPLSTLV {
+	tlvs := make([]BGPLSTLV, 0)
+	if n.ASN != 0 {
+		tlvs = append(tlvs, NewBGPLSUint32TLV(BGPLSTLVAutonomousSystem, n.ASN))
+	}
+	if n.BGPLSId != 0 {
+		tlvs = append(tlvs, NewBGPLSUint32TLV(BGPLSTLVBGPLSId, n.BGPLSId))
+	}
+	tlvs = append(tlvs, NewBGPLSUint32TLV(BGPLSTLVOSPFAreaId, n.AreaId))
+	tlvs = append(tlvs, NewBGPLSTLV(BGPLSTLVIGPRouterId, n.RouterId))
+	return tlvs
+}
+
+func (n *BGPLSNodeDescriptor) Encode(tlvType uint16) BGPLSTLV {
+	return NewBGPLSTLV(tlvType, encodeBGPLSTLVs(n.getTLVs()))
+}
+
+func (n *BGPLSNodeDescriptor) Decode(tlv BGPLSTLV) error {
+	subTLVs, err := decodeBGPLSTLVs(tlv.Value)
+	if err != nil {
+		return err
+	}
+
+	for _, subTLV := range subTLVs {
+		switch subTLV.Type {
+		case BGPLSTLVAutonomousSystem, BGPLSTLVBGPLSId, BGPLSTLVOSPFAreaId:
+			if len(subTLV.Value) != 4 {
+				return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil,
+					fmt.Sprintf("Bad length %d for node descriptor sub-TLV %d", len(subTLV.Value), subTLV.Type)}
+			}
+			value := binary.BigEndian.Uint32(subTLV.Value)
+			if subTLV.Type == BGPLSTLVAutonomousSystem {
+				n.ASN = value
+			} else if subTLV.Type == BGPLSTLVBGPLSId {
+				n.BGPLSId = value
+			} else {
+				n.AreaId = value
+			}
+
+		case BGPLSTLVIGPRouterId:
+			n.RouterId = subTLV.Value
+		}
+	}
+
+	if len(n.RouterId) == 0 {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil,
+			"IGP router id not found in the node descriptor"}
+	}
+	return nil
+}
+
+func (n *BGPLSNodeDescriptor) String() string {
+	routerId := fmt.Sprintf("%x", n.RouterId)
+	if len(n.RouterId) >= 4 {
+		routerId = net.IP(n.RouterId[:4]).String()
+		if len(n.RouterId) > 4 {
+			routerId += "-" + net.IP(n.RouterId[4:]).String()
+		}
+	}
+	return fmt.Sprintf("{AS %d Id %d Area %d Router %s}", n.ASN, n.BGPLSId, n.AreaId, routerId)
+}
+
+func NewBGPLSNodeDescriptor(asn uint32, bgplsId uint32, areaId uint32, routerId []byte) *BGPLSNodeDescriptor {
+	return &BGPLSNodeDescriptor{
+		ASN:      asn,
+		BGPLSId:  bgplsId,
+		AreaId:   areaId,
+		RouterId: routerId,
+	}
+}
+
+// Returns the IGP router id of an OSPF pseudonode, the router id of the DR followed by its interface address
+func GetBGPLSPseudonodeRouterId(drRouterId net.IP, drIfAddr net.IP) []byte {
+	routerId := make([]byte, 0, 8)
+	routerId = append(routerId, drRouterId.To4()...)
+	routerId = append(routerId, drIfAddr.To4()...)
+	return routerId
+}
+
+type BGPLSNLRI struct {
+	Type        uint16
+	ProtocolId  uint8
+	Identifier  uint64
+	LocalNode   BGPLSNodeDescriptor
+	RemoteNode  BGPLSNodeDescriptor
+	Descriptors []BGPLSTLV
+}
+
+func (n *BGPLSNLRI) Clone() NLRI {
+	x := *n
+	x.LocalNode = n.LocalNode.Clone()
+	x.RemoteNode = n.RemoteNode.Clone()
+	x.Descriptors = make([]BGPLSTLV, len(n.Descriptors))
+	for idx := range n.Descriptors {
+		x.Descriptors[idx] = n.Descriptors[idx].Clone()
+	}
+	return &x
+}
+
+func (n *BGPLSNLRI) getTLVs() []BGPLSTLV {
+	tlvs := make([]BGPLSTLV, 0, len(n.Descriptors)+2)
+	tlvs = append(tlvs, n.LocalNode.Encode(BGPLSTLVLocalNode))
+	if n.Type == BGPLSNLRITypeLink {
+		tlvs = append(tlvs, n.RemoteNode.Encode(BGPLSTLVRemoteNode))
+	}
+	tlvs = append(tlvs, n.Descriptors...)
+	return tlvs
+}
+
+func (n *BGPLSNLRI) Encode(afi AFI) ([]byte, error) {
+	tlvBytes := encodeBGPLSTLVs(n.getTLVs())
+	if len(tlvBytes)+bgplsNLRIFixedLen > math.MaxUint16 {
+		return nil, fmt.Errorf("BGP-LS NLRI %s is too long", n.String())
+	}
+
+	pkt := make([]byte, BGPLSNLRIHeaderLen+bgplsNLRIFixedLen+len(tlvBytes))
+	binary.BigEndian.PutUint16(pkt[0:2], n.Type)
+	binary.BigEndian.PutUint16(pkt[2:4], uint16(bgplsNLRIFixedLen+len(tlvBytes)))
+	pkt[4] = n.ProtocolId
+	binary.BigEndian.PutUint64(pkt[5:13], n.Identifier)
+	copy(pkt[13:], tlvBytes)
+	return pkt, nil
+}
+
+func (n *BGPLSNLRI) Decode(pkt []byte, afi AFI) error {
+	if len(pkt) < BGPLSNLRIHeaderLen {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil, "BGP-LS NLRI does not contain the header"}
+	}
+
+	n.Type = binary.BigEndian.Uint16(pkt[0:2])
+	length := int(binary.BigEndian.Uint16(pkt[2:4]))
+	if length < bgplsNLRIFixedLen || len(pkt) < BGPLSNLRIHeaderLen+length {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil,
+			fmt.Sprintf("BGP-LS NLRI length %d is invalid", length)}
+	}
+
+	if _, ok := BGPLSNLRITypeToStrMap[n.Type]; !ok {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil,
+			fmt.Sprintf("Unknown BGP-LS NLRI type %d", n.Type)}
+	}
+
+	n.ProtocolId = pkt[4]
+	n.Identifier = binary.BigEndian.Uint64(pkt[5:13])
+	tlvs, err := decodeBGPLSTLVs(pkt[BGPLSNLRIHeaderLen+bgplsNLRIFixedLen : BGPLSNLRIHeaderLen+length])
+	if err != nil {
+		return err
+	}
+
+	if len(tlvs) == 0 || tlvs[0].Type != BGPLSTLVLocalNode {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil,
+			"Local node descriptor not found in BGP-LS NLRI"}
+	}
+	if err = n.LocalNode.Decode(tlvs[0]); err != nil {
+		return err
+	}
+	tlvs = tlvs[1:]
+
+	if n.Type == BGPLSNLRITypeLink {
+		if len(tlvs) == 0 || tlvs[0].Type != BGPLSTLVRemoteNode {
+			return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, nil,
+				"Remote node descriptor not found in BGP-LS link NLRI"}
+		}
+		if err = n.RemoteNode.Decode(tlvs[0]); err != nil {
+			return err
+		}
+		tlvs = tlvs[1:]
+	}
+	n.Descriptors = tlvs
+	return nil
+}
+
+func (n *BGPLSNLRI) Len() uint32 {
+	return uint32(BGPLSNLRIHeaderLen+bgplsNLRIFixedLen) + uint32(len(encodeBGPLSTLVs(n.getTLVs())))
+}
+
+// Returns the prefix of an IP reachability TLV for the prefix NLRI and nil for the node and link NLRI
+func (n *BGPLSNLRI) GetIPPrefix() *IPPrefix {
+	if n.Type != BGPLSNLRITypeIPv4Prefix {
+		return nil
+	}
+
+	for _, tlv := range n.Descriptors {
+		if tlv.Type == BGPLSTLVIPReachabilityInfo && len(tlv.Value) > 0 {
+			ip := &IPPrefix{}
+			if err := ip.Decode(tlv.Value, AfiIP); err != nil {
+				return nil
+			}
+			return ip
+		}
+	}
+	return nil
+}
+
+func (n *BGPLSNLRI) GetPrefix() net.IP {
+	if ip := n.GetIPPrefix(); ip != nil {
+		return ip.Prefix
+	}
+	return nil
+}
+
+func (n *BGPLSNLRI) GetLength() uint8 {
+	if ip := n.GetIPPrefix(); ip != nil {
+		return ip.Length
+	}
+	return 0
+}
+
+func (n *BGPLSNLRI) GetPathId() uint32 {
+	return 0
+}
+
+func (n *BGPLSNLRI) String() string {
+	str := "{" + BGPLSNLRITypeToStrMap[n.Type] + " " + strconv.Itoa(int(n.ProtocolId)) + " " +
+		strconv.FormatUint(n.Identifier, 10) + " " + n.LocalNode.String()
+	if n.Type == BGPLSNLRITypeLink {
+		str += " " + n.RemoteNode.String()
+	}
+	for idx := range n.Descriptors {
+		str += " " + n.Descriptors[idx].String()
+	}
+	return str + "}"
+}
+
+func NewBGPLSNodeNLRI(protocolId uint8, identifier uint64, localNode *BGPLSNodeDescriptor) *BGPLSNLRI {
+	return &BGPLSNLRI{
+		Type:        BGPLSNLRITypeNode,
+		ProtocolId:  protocolId,
+		Identifier:  identifier,
+		LocalNode:   *localNode,
+		Descriptors: make([]BGPLSTLV, 0),
+	}
+}
+
+// Link descriptors use the interface and neighbor addresses for numbered links and the link local/remote ids for
+// unnumbered links.
+func NewBGPLSLinkNLRI(protocolId uint8, identifier uint64, localNode, remoteNode *BGPLSNodeDescriptor,
+	localIfAddr, neighborAddr net.IP, localId, remoteId uint32) *BGPLSNLRI {
+	descriptors := make([]BGPLSTLV, 0)
+	if localIfAddr != nil && localIfAddr.To4() != nil {
+		descriptors = append(descriptors, NewBGPLSTLV(BGPLSTLVIPv4InterfaceAddr, []byte(localIfAddr.To4())))
+		if neighborAddr != nil && neighborAddr.To4() != nil {
+			descriptors = append(descriptors, NewBGPLSTLV(BGPLSTLVIPv4NeighborAddr, []byte(neighborAddr.To4())))
+		}
+	} else {
+		ids := make([]byte, 8)
+		binary.BigEndian.PutUint32(ids[0:4], localId)
+		binary.BigEndian.PutUint32(ids[4:8], remoteId)
+		descriptors = append(descriptors, NewBGPLSTLV(BGPLSTLVLinkLocalRemoteId, ids))
+	}
+
+	return &BGPLSNLRI{
+		Type:        BGPLSNLRITypeLink,
+		ProtocolId:  protocolId,
+		Identifier:  identifier,
+		LocalNode:   *localNode,
+		RemoteNode:  *remoteNode,
+		Descriptors: descriptors,
+	}
+}
+
+func NewBGPLSPrefixNLRI(protocolId uint8, identifier uint64, localNode *BGPLSNodeDescriptor, routeType uint8,
+	prefix *IPPrefix) *BGPLSNLRI {
+	descriptors := make([]BGPLSTLV, 0)
+	if routeType != 0 {
+		descriptors = append(descriptors, NewBGPLSTLV(BGPLSTLVOSPFRouteType, []byte{routeType}))
+	}
+	reachInfo := make([]byte, prefix.Len())
+	reachInfo[0] = prefix.Length
+	copy(reachInfo[1:], prefix.Prefix.To4()[:(prefix.Length+7)/8])
+	descriptors = append(descriptors, NewBGPLSTLV(BGPLSTLVIPReachabilityInfo, reachInfo))
+
+	return &BGPLSNLRI{
+		Type:        BGPLSNLRITypeIPv4Prefix,
+		ProtocolId:  protocolId,
+		Identifier:  identifier,
+		LocalNode:   *localNode,
+		Descriptors: descriptors,
+	}
+}
+
+type BGPPathAttrLinkState struct {
+	BGPPathAttrBase
+	TLVs []BGPLSTLV
+}
+
+func (l *BGPPathAttrLinkState) Clone() BGPPathAttr {
+	x := *l
+	x.BGPPathAttrBase = l.BGPPathAttrBase.Clone()
+	x.TLVs = make([]BGPLSTLV, len(l.TLVs))
+	for idx := range l.TLVs {
+		x.TLVs[idx] = l.TLVs[idx].Clone()
+	}
+	return &x
+}
+
+func (l *BGPPathAttrLinkState) Encode() ([]byte, error) {
+	pkt, err := l.BGPPathAttrBase.Encode()
+	if err != nil {
+		return pkt, err
+	}
+
+	copy(pkt[l.BGPPathAttrBase.BGPPathAttrLen:], encodeBGPLSTLVs(l.TLVs))
+	return pkt, nil
+}
+
+func (l *BGPPathAttrLinkState) Decode(pkt []byte, data interface{}) error {
+	err := l.BGPPathAttrBase.Decode(pkt, data)
+	if err != nil {
+		return err
+	}
+
+	l.TLVs, err = decodeBGPLSTLVs(pkt[l.BGPPathAttrLen : l.BGPPathAttrLen+l.Length])
+	if err != nil {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, pkt[:l.TotalLen()], err.Error()}
+	}
+	return nil
+}
+
+func (l *BGPPathAttrLinkState) New() BGPPathAttr {
+	return &BGPPathAttrLinkState{}
+}
+
+func (l *BGPPathAttrLinkState) AddTLV(tlv BGPLSTLV) {
+	l.TLVs = append(l.TLVs, tlv)
+	l.Length += uint16(tlv.Len())
+}
+
+func (l *BGPPathAttrLinkState) GetTLV(tlvType uint16) (BGPLSTLV, bool) {
+	for _, tlv := range l.TLVs {
+		if tlv.Type == tlvType {
+			return tlv, true
+		}
+	}
+	return BGPLSTLV{}, false
+}
+
+func (l *BGPPathAttrLinkState) String() string {
+	str := "{LinkState"
+	for idx := range l.TLVs {
+		str += " " + l.TLVs[idx].String()
+	}
+	return str + "}"
+}
+
+func NewBGPPathAttrLinkState() *BGPPathAttrLinkState {
+	return &BGPPathAttrLinkState{
+		BGPPathAttrBase: BGPPathAttrBase{
+			Flags:          BGPPathAttrFlagOptional | BGPPathAttrFlagExtendedLen,
+			Code:           BGPPathAttrTypeLinkState,
+			Length:         0,
+			BGPPathAttrLen: 4,
+		},
+		TLVs: make([]BGPLSTLV, 0),
+	}
+}
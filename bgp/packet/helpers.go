@@ -25,7 +25,7 @@
 package packet
 
 import (
-	_ "fmt"
+	"fmt"
 	"l3/bgp/utils"
 	"math"
 	"net"
@@ -154,6 +154,22 @@ func RemoveMPAttrs(pathAttrs *[]BGPPathAttr) (mpReach *BGPPathAttrMPReachNLRI, m
 	return mpReach, mpUnreach
 }
 
+func RemoveMPAttrsForProtoFamilies(pathAttrs *[]BGPPathAttr, protoFamilies map[uint32]bool) {
+	newPathAttrs := make([]BGPPathAttr, 0, len(*pathAttrs))
+	for _, pa := range *pathAttrs {
+		if mpReach, ok := pa.(*BGPPathAttrMPReachNLRI); ok &&
+			protoFamilies[GetProtocolFamily(mpReach.AFI, mpReach.SAFI)] {
+			continue
+		}
+		if mpUnreach, ok := pa.(*BGPPathAttrMPUnreachNLRI); ok &&
+			protoFamilies[GetProtocolFamily(mpUnreach.AFI, mpUnreach.SAFI)] {
+			continue
+		}
+		newPathAttrs = append(newPathAttrs, pa)
+	}
+	*pathAttrs = newPathAttrs
+}
+
 func SetLocalPref(updateMsg *BGPMessage, pref uint32) {
 	body := updateMsg.Body.(*BGPUpdate)
 
@@ -273,6 +289,66 @@ func GetNumASes(pathAttrs []BGPPathAttr) uint32 {
 	return total
 }
 
+func getASPathSegmentASes(seg BGPASPathSegment) []uint32 {
+	switch seg.(type) {
+	case *BGPAS4PathSegment:
+		return seg.(*BGPAS4PathSegment).AS
+
+	case *BGPAS2PathSegment:
+		as2 := seg.(*BGPAS2PathSegment).AS
+		asList := make([]uint32, 0, len(as2))
+		for _, as := range as2 {
+			asList = append(asList, uint32(as))
+		}
+		return asList
+	}
+
+	return nil
+}
+
+/*  Neighbor AS is the first AS in the leftmost AS_SEQUENCE segment of the AS path.
+ */
+func GetNeighborAS(pathAttrs []BGPPathAttr) (uint32, bool) {
+	for _, attr := range pathAttrs {
+		if attr.GetCode() == BGPPathAttrTypeASPath {
+			asPaths := attr.(*BGPPathAttrASPath).Value
+			if len(asPaths) == 0 || asPaths[0].GetType() != BGPASPathSegmentSequence {
+				return 0, false
+			}
+
+			asList := getASPathSegmentASes(asPaths[0])
+			if len(asList) == 0 {
+				return 0, false
+			}
+			return asList[0], true
+		}
+	}
+
+	return 0, false
+}
+
+/*  Origin AS is the last AS in the rightmost segment of the AS path. There is no
+ *  single origin AS if the rightmost segment is an AS_SET.
+ */
+func GetOriginAS(pathAttrs []BGPPathAttr) (uint32, bool) {
+	for _, attr := range pathAttrs {
+		if attr.GetCode() == BGPPathAttrTypeASPath {
+			asPaths := attr.(*BGPPathAttrASPath).Value
+			if len(asPaths) == 0 || asPaths[len(asPaths)-1].GetType() != BGPASPathSegmentSequence {
+				return 0, false
+			}
+
+			asList := getASPathSegmentASes(asPaths[len(asPaths)-1])
+			if len(asList) == 0 {
+				return 0, false
+			}
+			return asList[len(asList)-1], true
+		}
+	}
+
+	return 0, false
+}
+
 func GetOrigin(pathAttrs []BGPPathAttr) uint8 {
 	for _, attr := range pathAttrs {
 		if attr.GetCode() == BGPPathAttrTypeOrigin {
@@ -472,6 +548,48 @@ func ConstructPathAttrForConnRoutes(ip net.IP, as uint32) []BGPPathAttr {
 	return pathAttrs
 }
 
+func ConstructPathAttrForDefaultRoute(nextHopIP net.IP, med, localPref uint32) []BGPPathAttr {
+	pathAttrs := make([]BGPPathAttr, 0)
+
+	origin := NewBGPPathAttrOrigin(BGPPathAttrOriginIGP)
+	pathAttrs = append(pathAttrs, origin)
+
+	asPath := NewBGPPathAttrASPath()
+	pathAttrs = append(pathAttrs, asPath)
+
+	if nextHopIP.To4() != nil {
+		nextHop := NewBGPPathAttrNextHop()
+		nextHop.Value = nextHopIP
+		pathAttrs = append(pathAttrs, nextHop)
+	}
+
+	if med != 0 {
+		multiExitDisc := NewBGPPathAttrMultiExitDisc()
+		multiExitDisc.Value = med
+		pathAttrs = append(pathAttrs, multiExitDisc)
+	}
+
+	if localPref != 0 {
+		pref := NewBGPPathAttrLocalPref()
+		pref.Value = localPref
+		pathAttrs = append(pathAttrs, pref)
+	}
+
+	return pathAttrs
+}
+
+func ConstructPathAttrForLinkState() []BGPPathAttr {
+	pathAttrs := make([]BGPPathAttr, 0)
+
+	origin := NewBGPPathAttrOrigin(BGPPathAttrOriginIGP)
+	pathAttrs = append(pathAttrs, origin)
+
+	asPath := NewBGPPathAttrASPath()
+	pathAttrs = append(pathAttrs, asPath)
+
+	return pathAttrs
+}
+
 func CopyPathAttrs(pathAttrs []BGPPathAttr) []BGPPathAttr {
 	newPathAttrs := make([]BGPPathAttr, len(pathAttrs))
 	copy(newPathAttrs, pathAttrs)
@@ -578,16 +696,85 @@ func RemoveClusterList(updateMsg *BGPMessage) {
 	removePathAttr(updateMsg, BGPPathAttrTypeClusterList)
 }
 
+func AddCommunity(updateMsg *BGPMessage, community uint32) bool {
+	body := updateMsg.Body.(*BGPUpdate)
+	var pa BGPPathAttr
+	var i int
+	found := false
+	idx := -1
+
+	for i, pa = range body.PathAttributes {
+		if pa.GetCode() == BGPPathAttrTypeCommunities {
+			idx = i
+			found = true
+			break
+		} else if idx == -1 {
+			if pa.GetCode() > BGPPathAttrTypeCommunities {
+				idx = i
+			} else if i == len(body.PathAttributes)-1 {
+				idx = i + 1
+			}
+		}
+	}
+
+	if !found && idx >= 0 {
+		communities := NewBGPPathAttrCommunities()
+		body.PathAttributes = append(body.PathAttributes, communities)
+		copy(body.PathAttributes[idx+1:], body.PathAttributes[idx:])
+		body.PathAttributes[idx] = communities
+	}
+
+	if idx >= 0 {
+		return body.PathAttributes[idx].(*BGPPathAttrCommunities).AddCommunity(community)
+	}
+
+	return false
+}
+
+func GetOTC(pathAttrs []BGPPathAttr) (uint32, bool) {
+	for _, attr := range pathAttrs {
+		if attr.GetCode() == BGPPathAttrTypeOTC {
+			return attr.(*BGPPathAttrOTC).Value, true
+		}
+	}
+
+	return uint32(0), false
+}
+
+func AddOTC(pathAttrs []BGPPathAttr, as uint32) []BGPPathAttr {
+	if _, ok := GetOTC(pathAttrs); ok {
+		return pathAttrs
+	}
+
+	return AddPathAttrToPathAttrs(pathAttrs, BGPPathAttrTypeOTC, NewBGPPathAttrOTC(as))
+}
+
+func HasCommunity(pathAttrs []BGPPathAttr, community uint32) bool {
+	for _, attr := range pathAttrs {
+		if attr.GetCode() == BGPPathAttrTypeCommunities {
+			return attr.(*BGPPathAttrCommunities).HasCommunity(community)
+		}
+	}
+
+	return false
+}
+
 func ConvertIPBytesToUint(bytes []byte) uint32 {
 	return uint32(bytes[0])<<24 | uint32(bytes[1]<<16) | uint32(bytes[2]<<8) | uint32(bytes[3])
 }
 
-func ConstructOptParams(as uint32, afiSAfiMap map[uint32]bool, addPathsRx bool, addPathsMaxTx uint8) []BGPOptParam {
+func ConstructOptParams(as uint32, afiSAfiMap map[uint32]bool, addPathsRx bool, addPathsMaxTx uint8,
+	role string) []BGPOptParam {
 	optParams := make([]BGPOptParam, 0)
 	capParams := make([]BGPCapability, 0)
 
 	cap4ByteASPath := NewBGPCap4ByteASPath(as)
 	capParams = append(capParams, cap4ByteASPath)
+	capParams = append(capParams, NewBGPCapExtendedMsg())
+	if bgpRole, ok := BGPRoleStrToTypeMap[role]; ok {
+		utils.Logger.Infof("Advertising capability for role %s\n", role)
+		capParams = append(capParams, NewBGPCapRole(bgpRole))
+	}
 	capAddPaths := NewBGPCapAddPath()
 	addPathFlags := uint8(0)
 	if addPathsRx {
@@ -633,6 +820,77 @@ func GetASSize(openMsg *BGPOpen) uint8 {
 	return 2
 }
 
+func IsExtendedMsgEnabled(openMsg *BGPOpen) bool {
+	for _, optParam := range openMsg.OptParams {
+		if capabilities, ok := optParam.(*BGPOptParamCapability); ok {
+			for _, capability := range capabilities.Value {
+				if capability.GetCode() == BGPCapTypeExtendedMsg {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+ * GetRole returns the role advertised by the peer in the OPEN message. Role capabilities with
+ * different values in the same OPEN message are a role mismatch, RFC 9234.
+ */
+func GetRole(openMsg *BGPOpen) (BGPRole, bool, error) {
+	var role BGPRole
+	found := false
+	for _, optParam := range openMsg.OptParams {
+		if capabilities, ok := optParam.(*BGPOptParamCapability); ok {
+			for _, capability := range capabilities.Value {
+				if roleCap, ok := capability.(*BGPCapRole); ok {
+					if found && roleCap.Value != role {
+						return role, found, BGPMessageError{BGPOpenMsgError, BGPRoleMismatch, nil,
+							"Role capability received multiple times with different values"}
+					}
+					role = roleCap.Value
+					found = true
+				}
+			}
+		}
+	}
+
+	return role, found, nil
+}
+
+/*
+ * CheckRole validates the role advertised by the peer against the local role. In strict mode
+ * the peer must advertise a role.
+ */
+func CheckRole(openMsg *BGPOpen, localRole BGPRole, strict bool) error {
+	peerRole, found, err := GetRole(openMsg)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		if strict {
+			return BGPMessageError{BGPOpenMsgError, BGPRoleMismatch, nil,
+				"Role capability not received from the peer in strict mode"}
+		}
+		return nil
+	}
+
+	if BGPRolePeerRoleMap[localRole] != peerRole {
+		return BGPMessageError{BGPOpenMsgError, BGPRoleMismatch, nil,
+			fmt.Sprintf("Local role %s does not match the peer role %d", BGPRoleToStrMap[localRole], peerRole)}
+	}
+	return nil
+}
+
+func GetMaxMsgLen(extendedMsg bool) uint32 {
+	if extendedMsg {
+		return BGPExtendedMsgMaxLen
+	}
+	return BGPMsgMaxLen
+}
+
 func GetAddPathFamily(openMsg *BGPOpen) map[AFI]map[SAFI]uint8 {
 	addPathFamily := make(map[AFI]map[SAFI]uint8)
 	for _, optParam := range openMsg.OptParams {
@@ -835,7 +1093,7 @@ func NormalizeASPath(updateMsg *BGPMessage, data interface{}) {
 	}
 }
 
-func ConstructMaxSizedUpdatePackets(bgpMsg *BGPMessage) []*BGPMessage {
+func ConstructMaxSizedUpdatePackets(bgpMsg *BGPMessage, maxLen uint32) []*BGPMessage {
 	var withdrawnRoutes []NLRI
 	newUpdateMsgs := make([]*BGPMessage, 0)
 	pktLen := uint32(BGPUpdateMsgMinLen)
@@ -846,7 +1104,7 @@ func ConstructMaxSizedUpdatePackets(bgpMsg *BGPMessage) []*BGPMessage {
 	if updateMsg.WithdrawnRoutes != nil {
 		for lastIdx = 0; lastIdx < len(updateMsg.WithdrawnRoutes); lastIdx++ {
 			nlriLen := updateMsg.WithdrawnRoutes[lastIdx].Len()
-			if nlriLen+pktLen > BGPMsgMaxLen {
+			if nlriLen+pktLen > maxLen {
 				newMsg := NewBGPUpdateMessage(updateMsg.WithdrawnRoutes[startIdx:lastIdx], nil, nil)
 				newUpdateMsgs = append(newUpdateMsgs, newMsg)
 				startIdx = lastIdx
@@ -864,7 +1122,7 @@ func ConstructMaxSizedUpdatePackets(bgpMsg *BGPMessage) []*BGPMessage {
 	for i := 0; i < len(updateMsg.PathAttributes); i++ {
 		paLen += updateMsg.PathAttributes[i].TotalLen()
 	}
-	if pktLen+paLen > BGPMsgMaxLen {
+	if pktLen+paLen > maxLen {
 		newMsg := NewBGPUpdateMessage(withdrawnRoutes, nil, nil)
 		withdrawnRoutes = nil
 		newUpdateMsgs = append(newUpdateMsgs, newMsg)
@@ -876,7 +1134,7 @@ func ConstructMaxSizedUpdatePackets(bgpMsg *BGPMessage) []*BGPMessage {
 	lastIdx = 0
 	for lastIdx = 0; lastIdx < len(updateMsg.NLRI); lastIdx++ {
 		nlriLen := updateMsg.NLRI[lastIdx].Len()
-		if nlriLen+pktLen+paLen > BGPMsgMaxLen {
+		if nlriLen+pktLen+paLen > maxLen {
 			newMsg := NewBGPUpdateMessage(withdrawnRoutes, updateMsg.PathAttributes, updateMsg.NLRI[startIdx:lastIdx])
 			newUpdateMsgs = append(newUpdateMsgs, newMsg)
 			if withdrawnRoutes != nil {
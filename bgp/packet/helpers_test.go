@@ -53,7 +53,7 @@ func TestBGPUpdateMessageWithdrawnRoutesLenMoreThanMaxAllowed(t *testing.T) {
 	}
 
 	for idx, _ := range bgpMsgs {
-		updateMsgs := ConstructMaxSizedUpdatePackets(bgpMsgs[idx])
+		updateMsgs := ConstructMaxSizedUpdatePackets(bgpMsgs[idx], BGPMsgMaxLen)
 		if len(updateMsgs) != numMsgs[idx] {
 			t.Error("ConstructMaxSizedUpdatePackets called... expected", numMsgs[idx], "update messages, got", len(updateMsgs))
 		} else {
@@ -92,7 +92,7 @@ func TestBGPUpdateMessageNLRILenMoreThanMaxAllowed(t *testing.T) {
 	}
 
 	for idx, _ := range bgpMsgs {
-		updateMsgs := ConstructMaxSizedUpdatePackets(bgpMsgs[idx])
+		updateMsgs := ConstructMaxSizedUpdatePackets(bgpMsgs[idx], BGPMsgMaxLen)
 		if len(updateMsgs) != numMsgs[idx] {
 			t.Error("ConstructMaxSizedUpdatePackets called... expected", numMsgs[idx], "update messages, got", len(updateMsgs))
 		} else {
@@ -114,3 +114,180 @@ func TestBGPUpdateForConnectedRoutes(t *testing.T) {
 	nlri = append(nlri, dest)
 	NewBGPUpdateMessage(make([]NLRI, 0), pa, nlri)
 }
+
+func TestBGPUpdateForDefaultRoute(t *testing.T) {
+	pa := ConstructPathAttrForDefaultRoute(net.ParseIP("10.1.10.1"), 20, 200)
+	if len(pa) != 5 {
+		t.Fatal("Expected 5 path attrs for default route, got", len(pa))
+	}
+	if pa[3].(*BGPPathAttrMultiExitDisc).Value != 20 || pa[4].(*BGPPathAttrLocalPref).Value != 200 {
+		t.Error("Default route MED or local pref not set, path attrs:", pa)
+	}
+
+	pa = ConstructPathAttrForDefaultRoute(net.ParseIP("2001::1"), 0, 0)
+	if len(pa) != 2 {
+		t.Error("Expected only origin and AS path for IPv6 default route, got", pa)
+	}
+
+	nlri := []NLRI{ConstructIPPrefix("0.0.0.0", "0.0.0.0")}
+	updateMsg := NewBGPUpdateMessage(make([]NLRI, 0), ConstructPathAttrForDefaultRoute(net.ParseIP("10.1.10.1"),
+		0, 0), nlri)
+	if _, err := updateMsg.Encode(); err != nil {
+		t.Error("Failed to encode default route update with error:", err)
+	}
+}
+
+func TestBGPUpdateMessageExtendedMsgMaxLen(t *testing.T) {
+	prefix := []byte{0x0A, 0x00, 0x00}
+	withdrawnRoutes := make([]NLRI, 0)
+	for i := 0; i < 3055; i++ {
+		ip := make([]byte, 4)
+		prefix[len(prefix)-1] += 1
+		if prefix[len(prefix)-1] == 0 {
+			prefix[len(prefix)-2] += 1
+		}
+		copy(ip, prefix)
+		withdrawnRoutes = append(withdrawnRoutes, NewIPPrefix(ip, uint8(len(prefix)*8)))
+	}
+	bgpMsg := NewBGPUpdateMessage(withdrawnRoutes, nil, nil)
+
+	updateMsgs := ConstructMaxSizedUpdatePackets(bgpMsg, BGPExtendedMsgMaxLen)
+	if len(updateMsgs) != 1 {
+		t.Fatal("ConstructMaxSizedUpdatePackets called... expected 1 update message, got", len(updateMsgs))
+	}
+
+	if _, err := updateMsgs[0].Encode(); err == nil {
+		t.Fatal("Encode called... expected failure for message longer than", BGPMsgMaxLen, "bytes, got NO error")
+	}
+
+	pkt, err := updateMsgs[0].EncodeWithMaxLen(BGPExtendedMsgMaxLen)
+	if err != nil {
+		t.Fatal("EncodeWithMaxLen failed with error:", err)
+	}
+	if len(pkt) <= BGPMsgMaxLen {
+		t.Fatal("EncodeWithMaxLen called... expected message longer than", BGPMsgMaxLen, "bytes, got", len(pkt))
+	}
+}
+
+func TestExtendedMsgCapability(t *testing.T) {
+	afiSafiMap := make(map[uint32]bool)
+	afiSafiMap[GetProtocolFamily(AfiIP, SafiUnicast)] = true
+	optParams := ConstructOptParams(12345, afiSafiMap, false, 0, "")
+	openMsg := NewBGPOpenMessage(12345, 180, "10.1.10.1", optParams)
+	pkt, err := openMsg.Encode()
+	if err != nil {
+		t.Fatal("BGP open message encode failed with error:", err)
+	}
+
+	header := NewBGPHeader()
+	header.Decode(pkt[:BGPMsgHeaderLen])
+	newOpenMsg := NewBGPMessage()
+	err = newOpenMsg.Decode(header, pkt[BGPMsgHeaderLen:], BGPPeerAttrs{ASSize: 2})
+	if err != nil {
+		t.Fatal("BGP open message decode failed with error:", err)
+	}
+
+	if !IsExtendedMsgEnabled(newOpenMsg.Body.(*BGPOpen)) {
+		t.Fatal("Extended message capability not found in the open message")
+	}
+
+	if GetMaxMsgLen(true) != BGPExtendedMsgMaxLen || GetMaxMsgLen(false) != BGPMsgMaxLen {
+		t.Fatal("GetMaxMsgLen returned wrong max message length")
+	}
+}
+
+func TestRoleCapability(t *testing.T) {
+	afiSafiMap := make(map[uint32]bool)
+	afiSafiMap[GetProtocolFamily(AfiIP, SafiUnicast)] = true
+	optParams := ConstructOptParams(12345, afiSafiMap, false, 0, "customer")
+	openMsg := NewBGPOpenMessage(12345, 180, "10.1.10.1", optParams)
+	pkt, err := openMsg.Encode()
+	if err != nil {
+		t.Fatal("BGP open message encode failed with error:", err)
+	}
+
+	header := NewBGPHeader()
+	header.Decode(pkt[:BGPMsgHeaderLen])
+	newOpenMsg := NewBGPMessage()
+	err = newOpenMsg.Decode(header, pkt[BGPMsgHeaderLen:], BGPPeerAttrs{ASSize: 2})
+	if err != nil {
+		t.Fatal("BGP open message decode failed with error:", err)
+	}
+
+	body := newOpenMsg.Body.(*BGPOpen)
+	role, found, err := GetRole(body)
+	if err != nil || !found || role != BGPRoleCustomer {
+		t.Fatal("GetRole returned role", role, "found", found, "error", err, "expected customer")
+	}
+
+	if err = CheckRole(body, BGPRoleProvider, true); err != nil {
+		t.Fatal("CheckRole failed for provider-customer with error:", err)
+	}
+
+	if err = CheckRole(body, BGPRolePeer, false); err == nil || err.(BGPMessageError).SubTypeCode != BGPRoleMismatch {
+		t.Fatal("CheckRole called... expected role mismatch for peer-customer, got", err)
+	}
+
+	noRoleMsg := NewBGPOpenMessage(12345, 180, "10.1.10.1", ConstructOptParams(12345, afiSafiMap, false, 0, ""))
+	noRoleBody := noRoleMsg.Body.(*BGPOpen)
+	if err = CheckRole(noRoleBody, BGPRoleProvider, false); err != nil {
+		t.Fatal("CheckRole failed without peer role in non strict mode with error:", err)
+	}
+	if err = CheckRole(noRoleBody, BGPRoleProvider, true); err == nil {
+		t.Fatal("CheckRole called... expected role mismatch without peer role in strict mode, got NO error")
+	}
+}
+
+func TestOTCPathAttr(t *testing.T) {
+	pathAttrs := make([]BGPPathAttr, 0)
+	pathAttrs = append(pathAttrs, NewBGPPathAttrOrigin(BGPPathAttrOriginIGP))
+	pathAttrs = AddOTC(pathAttrs, 65001)
+	pathAttrs = AddOTC(pathAttrs, 65002)
+	if otc, ok := GetOTC(pathAttrs); !ok || otc != 65001 {
+		t.Fatal("GetOTC returned", otc, ok, "expected 65001")
+	}
+
+	pkt, err := NewBGPPathAttrOTC(65001).Encode()
+	if err != nil {
+		t.Fatal("OTC path attr encode failed with error:", err)
+	}
+
+	otcAttr := &BGPPathAttrOTC{}
+	if err = otcAttr.Decode(pkt, BGPPeerAttrs{ASSize: 4}); err != nil {
+		t.Fatal("OTC path attr decode failed with error:", err)
+	}
+	if otcAttr.Value != 65001 || otcAttr.Flags != BGPPathAttrFlagOptional|BGPPathAttrFlagTransitive {
+		t.Fatal("OTC path attr decode returned", otcAttr, "expected value 65001")
+	}
+}
+
+func TestGetNeighborAndOriginAS(t *testing.T) {
+	asPath := NewBGPPathAttrASPath()
+	pathAttrs := []BGPPathAttr{asPath}
+	if _, ok := GetNeighborAS(pathAttrs); ok {
+		t.Error("GetNeighborAS found neighbor AS in an empty AS path")
+	}
+	if _, ok := GetOriginAS(pathAttrs); ok {
+		t.Error("GetOriginAS found origin AS in an empty AS path")
+	}
+
+	seq := NewBGPAS4PathSegmentSeq()
+	seq.AppendAS(65002)
+	seq.AppendAS(174)
+	seq.AppendAS(65001)
+	asPath.AppendASPathSegment(seq)
+	if as, ok := GetNeighborAS(pathAttrs); !ok || as != 65002 {
+		t.Error("GetNeighborAS expected 65002, got", as, ok)
+	}
+	if as, ok := GetOriginAS(pathAttrs); !ok || as != 65001 {
+		t.Error("GetOriginAS expected 65001, got", as, ok)
+	}
+
+	set := NewBGPAS4PathSegmentSet()
+	set.AppendAS(65010)
+	set.AppendAS(65011)
+	asPath.AppendASPathSegment(set)
+	if _, ok := GetOriginAS(pathAttrs); ok {
+		t.Error("GetOriginAS found origin AS when the last segment is an AS set")
+	}
+}
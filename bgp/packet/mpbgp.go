@@ -34,8 +34,9 @@ import (
 )
 
 var BGPAFIToStructMap = map[AFI]MPNextHop{
-	AfiIP:  &MPNextHopIP{},
-	AfiIP6: &MPNextHopIP6{},
+	AfiIP:        &MPNextHopIP{},
+	AfiIP6:       &MPNextHopIP6{},
+	AfiLinkState: &MPNextHopIP{},
 }
 
 type MPNextHop interface {
@@ -334,13 +335,25 @@ func (r *BGPPathAttrMPReachNLRI) Decode(pkt []byte, data interface{}) error {
 		return err
 	}
 
+	if r.BGPPathAttrBase.Length < 5 {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, pkt[:r.TotalLen()], "Bad Attribute Length"}
+	}
+
 	idx := int(r.BGPPathAttrBase.BGPPathAttrLen)
 	r.AFI = AFI(binary.BigEndian.Uint16(pkt[idx : idx+2]))
 	r.SAFI = SAFI(pkt[idx+2])
 	idx += 3
 
+	if int(pkt[idx])+5 > int(r.BGPPathAttrBase.Length) {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, pkt[:r.TotalLen()],
+			fmt.Sprintf("Next hop length %d exceeds the attribute length", pkt[idx])}
+	}
+
 	nextHop := BGPGetMPNextHop(r.AFI)
-	nextHop.Decode(pkt[idx:])
+	err = nextHop.Decode(pkt[idx:])
+	if err != nil {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, pkt[:r.TotalLen()], err.Error()}
+	}
 	r.NextHop = nextHop
 	idx += int(nextHop.Len())
 
@@ -433,6 +446,10 @@ func (u *BGPPathAttrMPUnreachNLRI) Decode(pkt []byte, data interface{}) error {
 		return err
 	}
 
+	if u.BGPPathAttrBase.Length < 3 {
+		return BGPMessageError{BGPUpdateMsgError, BGPOptionalAttrError, pkt[:u.TotalLen()], "Bad Attribute Length"}
+	}
+
 	idx := int(u.BGPPathAttrBase.BGPPathAttrLen)
 	u.AFI = AFI(binary.BigEndian.Uint16(pkt[idx : idx+2]))
 	u.SAFI = SAFI(pkt[idx+2])
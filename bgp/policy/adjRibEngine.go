@@ -25,30 +25,241 @@
 package policy
 
 import (
+	"errors"
+	"fmt"
+	"l3/bgp/config"
+	"l3/bgp/packet"
 	bgprib "l3/bgp/rib"
+	"sync"
+	"sync/atomic"
 	"utils/logging"
 	utilspolicy "utils/policy"
 )
 
+const (
+	PolicyConditionTypeDstIpPrefixMatch = "MatchDstIpPrefix"
+	PolicyActionTypeRouteDisposition    = "RouteDisposition"
+)
+
 type AdjRibPolicyExtensions struct {
 	HitCounter    int
 	RouteList     []string
 	RouteInfoList []*bgprib.AdjRIBRoute
 }
 
+/*  The adj-RIB policy engine runs the import and export policies of the neighbors
+ *  on the paths received from or sent to a neighbor. The statements are picked by the
+ *  policy matcher, the same as the Loc-RIB engine, and the route disposition action of
+ *  the statement decides. Conditions and actions that can't be run on the paths sent to
+ *  a neighbor are kept for the Loc-RIB engine, the policies that use them are rejected
+ *  as export policies.
+ *  The config is written by the policy manager goroutine and the policies are run by
+ *  the server goroutine.
+ */
 type AdjRibPPolicyEngine struct {
 	BasePolicyEngine
+	mutex            sync.RWMutex
+	matcher          *policyMatcher
+	actions          map[string]utilspolicy.PolicyActionConfig
+	policyUpdateFunc func(string)
 }
 
 func NewAdjRibPolicyEngine(logger *logging.Writer) *AdjRibPPolicyEngine {
 	policyEngine := &AdjRibPPolicyEngine{
 		BasePolicyEngine: NewBasePolicyEngine(logger, utilspolicy.NewPolicyEngineDB(logger)),
+		matcher:          newPolicyMatcher(),
+		actions:          make(map[string]utilspolicy.PolicyActionConfig),
 	}
 	policyEngine.SetGetPolicyEntityMapIndexFunc(getPolicyEnityKey)
 	return policyEngine
 }
 
+/*  SetPolicyUpdateFunc sets the func that is called with the name of a policy after the policy is created
+ *  or deleted. It is called on the goroutine that changes the config.
+ */
+func (eng *AdjRibPPolicyEngine) SetPolicyUpdateFunc(policyUpdateFunc func(string)) {
+	eng.policyUpdateFunc = policyUpdateFunc
+}
+
+func (eng *AdjRibPPolicyEngine) notifyPolicyUpdate(policyName string) {
+	if eng.policyUpdateFunc != nil {
+		eng.policyUpdateFunc(policyName)
+	}
+}
+
+func (eng *AdjRibPPolicyEngine) CreatePolicyCondition(condCfg utilspolicy.PolicyConditionConfig) (bool, error) {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if err := eng.matcher.createCondition(condCfg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (eng *AdjRibPPolicyEngine) CreateBGPPolicyCondition(condCfg config.BGPPolicyCondition) (bool, error) {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if err := eng.matcher.createBGPCondition(condCfg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (eng *AdjRibPPolicyEngine) DeletePolicyCondition(conditionName string) (bool, error) {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if err := eng.matcher.deleteCondition(conditionName); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (eng *AdjRibPPolicyEngine) CreatePolicyAction(actionCfg utilspolicy.PolicyActionConfig) (bool, error) {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if _, ok := eng.actions[actionCfg.Name]; ok {
+		return false, errors.New(fmt.Sprintf("Action %s already exists", actionCfg.Name))
+	}
+	eng.actions[actionCfg.Name] = actionCfg
+	return true, nil
+}
+
+func (eng *AdjRibPPolicyEngine) DeletePolicyAction(actionName string) (bool, error) {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if _, ok := eng.actions[actionName]; !ok {
+		return false, errors.New(fmt.Sprintf("Action %s not found", actionName))
+	}
+	delete(eng.actions, actionName)
+	return true, nil
+}
+
+func (eng *AdjRibPPolicyEngine) CreatePolicyStmt(stmtCfg utilspolicy.PolicyStmtConfig) error {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	for _, actionName := range stmtCfg.Actions {
+		if _, ok := eng.actions[actionName]; !ok {
+			return errors.New(fmt.Sprintf("Statement %s, action %s not found", stmtCfg.Name, actionName))
+		}
+	}
+	return eng.matcher.createStmt(stmtCfg)
+}
+
+func (eng *AdjRibPPolicyEngine) DeletePolicyStmt(stmtName string) error {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	return eng.matcher.deleteStmt(stmtName)
+}
+
 func (eng *AdjRibPPolicyEngine) CreatePolicyDefinition(defCfg utilspolicy.PolicyDefinitionConfig) error {
-	defCfg.Extensions = AdjRibPolicyExtensions{}
-	return eng.PolicyEngine.CreatePolicyDefinition(defCfg)
+	eng.mutex.Lock()
+	err := eng.matcher.createDefinition(defCfg)
+	eng.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	eng.notifyPolicyUpdate(defCfg.Name)
+	return nil
+}
+
+func (eng *AdjRibPPolicyEngine) DeletePolicyDefinition(policyName string) error {
+	eng.mutex.Lock()
+	err := eng.matcher.deleteDefinition(policyName)
+	eng.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	eng.notifyPolicyUpdate(policyName)
+	return nil
+}
+
+/*  ValidateExportPolicy returns an error if the policy is not configured or if one of its statements
+ *  uses a condition or an action that can't be run on the paths sent to a neighbor.
+ */
+func (eng *AdjRibPPolicyEngine) ValidateExportPolicy(policyName string) error {
+	eng.mutex.RLock()
+	defer eng.mutex.RUnlock()
+	stmts, ok := eng.matcher.definitions[policyName]
+	if !ok {
+		return errors.New(fmt.Sprintf("Export policy %s not found", policyName))
+	}
+
+	for _, stmtName := range stmts {
+		stmt, ok := eng.matcher.stmts[stmtName]
+		if !ok {
+			return errors.New(fmt.Sprintf("Export policy %s, statement %s not found", policyName, stmtName))
+		}
+		for _, condName := range stmt.conditions {
+			condition, ok := eng.matcher.conditions[condName]
+			if !ok {
+				return errors.New(fmt.Sprintf("Export policy %s, condition %s not found", policyName,
+					condName))
+			}
+			if condition.unsupported != "" {
+				return errors.New(fmt.Sprintf("Export policy %s, condition %s, %s is not supported in "+
+					"export policies", policyName, condName, condition.unsupported))
+			}
+		}
+		for _, actionName := range stmt.actions {
+			action, ok := eng.actions[actionName]
+			if !ok {
+				return errors.New(fmt.Sprintf("Export policy %s, action %s not found", policyName, actionName))
+			}
+			if action.ActionType != PolicyActionTypeRouteDisposition {
+				return errors.New(fmt.Sprintf("Export policy %s, action %s, action type %s is not supported "+
+					"in export policies", policyName, actionName, action.ActionType))
+			}
+		}
+	}
+	return nil
+}
+
+func (eng *AdjRibPPolicyEngine) CreateASPathList(listCfg config.ASPathList) error {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	return eng.BasePolicyEngine.CreateASPathList(listCfg)
+}
+
+func (eng *AdjRibPPolicyEngine) DeleteASPathList(name string) error {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	return eng.BasePolicyEngine.DeleteASPathList(name)
+}
+
+/*  FilterPath runs the policy on the path of the NLRI and returns true if the path
+ *  is accepted. The route disposition action of the first statement that matches
+ *  decides, a statement without one accepts the path. Paths that don't match any
+ *  statement and paths that are run through a policy that is not configured are
+ *  rejected.
+ */
+func (eng *AdjRibPPolicyEngine) FilterPath(policyName string, nlri packet.NLRI, path *bgprib.Path) bool {
+	eng.mutex.RLock()
+	defer eng.mutex.RUnlock()
+	stmt, found := eng.matcher.matchPolicy(&eng.BasePolicyEngine, policyName, nlri, path)
+	if !found {
+		eng.logger.Infof("AdjRibPPolicyEngine:FilterPath - policy %s not found", policyName)
+		return false
+	}
+	if stmt == nil {
+		return false
+	}
+
+	atomic.AddUint32(&stmt.hitCounter, 1)
+	for _, actionName := range stmt.actions {
+		if action, ok := eng.actions[actionName]; ok && action.ActionType == PolicyActionTypeRouteDisposition {
+			return action.Accept && !action.Reject
+		}
+	}
+	return true
+}
+
+func (eng *AdjRibPPolicyEngine) GetStmtHitCounter(stmtName string) uint32 {
+	eng.mutex.RLock()
+	defer eng.mutex.RUnlock()
+	if stmt, ok := eng.matcher.stmts[stmtName]; ok {
+		return atomic.LoadUint32(&stmt.hitCounter)
+	}
+	return 0
 }
@@ -0,0 +1,157 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// aspath.go
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"l3/bgp/config"
+	bgprib "l3/bgp/rib"
+	"regexp"
+	"strings"
+)
+
+const (
+	BGPConditionTypeASPathMatch       = "MatchASPath"
+	BGPConditionTypeOriginASMatch     = "MatchOriginAS"
+	BGPConditionTypeNeighborASMatch   = "MatchNeighborAS"
+	BGPConditionTypeASPathLengthMatch = "MatchASPathLength"
+)
+
+/*  '_' in an AS path regex matches an AS boundary, the same as other BGP
+ *  implementations. The AS path string is "65002 174 { 65010, 65011 }".
+ */
+const asPathBoundaryRegex = "(^|[ ,{}]+|$)"
+
+type asPathListEntry struct {
+	permit bool
+	regex  *regexp.Regexp
+}
+
+type ASPathList struct {
+	Name    string
+	entries []asPathListEntry
+}
+
+func NewASPathList(listCfg config.ASPathList) (*ASPathList, error) {
+	asPathList := &ASPathList{
+		Name:    listCfg.Name,
+		entries: make([]asPathListEntry, 0, len(listCfg.Entries)),
+	}
+
+	for _, entry := range listCfg.Entries {
+		regex, err := regexp.Compile(strings.Replace(entry.Regex, "_", asPathBoundaryRegex, -1))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("AS path list %s, invalid regex %s, error %s", listCfg.Name,
+				entry.Regex, err))
+		}
+		asPathList.entries = append(asPathList.entries, asPathListEntry{permit: entry.Permit, regex: regex})
+	}
+	return asPathList, nil
+}
+
+/*  The first entry that matches the AS path decides. AS paths that don't match
+ *  any entry are denied.
+ */
+func (l *ASPathList) Match(asPath string) bool {
+	for _, entry := range l.entries {
+		if entry.regex.MatchString(asPath) {
+			return entry.permit
+		}
+	}
+	return false
+}
+
+func (eng *BasePolicyEngine) CreateASPathList(listCfg config.ASPathList) error {
+	asPathList, err := NewASPathList(listCfg)
+	if err != nil {
+		eng.logger.Err("BasePolicyEngine:CreateASPathList -", err)
+		return err
+	}
+
+	eng.asPathLists[listCfg.Name] = asPathList
+	return nil
+}
+
+func (eng *BasePolicyEngine) DeleteASPathList(name string) error {
+	if _, ok := eng.asPathLists[name]; !ok {
+		return errors.New(fmt.Sprintf("AS path list %s not found", name))
+	}
+
+	delete(eng.asPathLists, name)
+	return nil
+}
+
+func ValidateBGPPolicyCondition(condCfg config.BGPPolicyCondition) error {
+	switch condCfg.ConditionType {
+	case BGPConditionTypeASPathMatch:
+		if condCfg.ASPathList == "" {
+			return errors.New(fmt.Sprintf("Condition %s, AS path list not specified", condCfg.Name))
+		}
+
+	case BGPConditionTypeOriginASMatch, BGPConditionTypeNeighborASMatch:
+		if condCfg.AS == 0 {
+			return errors.New(fmt.Sprintf("Condition %s, AS not specified", condCfg.Name))
+		}
+
+	case BGPConditionTypeASPathLengthMatch:
+		if condCfg.MaxASPathLength != 0 && condCfg.MaxASPathLength < condCfg.MinASPathLength {
+			return errors.New(fmt.Sprintf("Condition %s, max AS path length %d is less than min %d",
+				condCfg.Name, condCfg.MaxASPathLength, condCfg.MinASPathLength))
+		}
+
+	default:
+		return errors.New(fmt.Sprintf("Condition %s, unknown condition type %s", condCfg.Name,
+			condCfg.ConditionType))
+	}
+	return nil
+}
+
+func (eng *BasePolicyEngine) matchBGPCondition(condCfg config.BGPPolicyCondition, path *bgprib.Path) bool {
+	switch condCfg.ConditionType {
+	case BGPConditionTypeASPathMatch:
+		asPathList, ok := eng.asPathLists[condCfg.ASPathList]
+		if !ok {
+			eng.logger.Info("BasePolicyEngine:matchBGPCondition - AS path list", condCfg.ASPathList, "not found")
+			return false
+		}
+		return asPathList.Match(path.GetASPathString())
+
+	case BGPConditionTypeOriginASMatch:
+		as, ok := path.GetOriginAS()
+		return ok && as == condCfg.AS
+
+	case BGPConditionTypeNeighborASMatch:
+		as, ok := path.GetNeighborAS()
+		return ok && as == condCfg.AS
+
+	case BGPConditionTypeASPathLengthMatch:
+		numASes := path.GetNumASes()
+		return numASes >= condCfg.MinASPathLength &&
+			(condCfg.MaxASPathLength == 0 || numASes <= condCfg.MaxASPathLength)
+	}
+
+	return false
+}
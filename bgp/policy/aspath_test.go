@@ -0,0 +1,521 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// aspath_test.go
+package policy
+
+import (
+	"l3/bgp/config"
+	"l3/bgp/packet"
+	bgprib "l3/bgp/rib"
+	"l3/bgp/utils"
+	"net"
+	"testing"
+	"utils/logging"
+	"utils/patriciaDB"
+	utilspolicy "utils/policy"
+	"utils/policy/policyCommonDefs"
+)
+
+func newTestLogger(t *testing.T) *logging.Writer {
+	logger, err := logging.NewLogger("bgpd", "BGP", true)
+	if err != nil {
+		t.Fatal("Failed to start the logger. Exiting!!")
+	}
+	utils.SetLogger(logger)
+	return logger
+}
+
+/*  newTestPath constructs a path with an AS path of the AS sequence followed by an
+ *  AS set if asSet is not empty.
+ */
+func newTestPath(locRib *bgprib.LocRib, asSeq []uint32, asSet []uint32) *bgprib.Path {
+	asPath := packet.NewBGPPathAttrASPath()
+	asPath.ASSize = 4
+	if len(asSeq) > 0 {
+		seg := packet.NewBGPAS4PathSegmentSeq()
+		for _, as := range asSeq {
+			seg.AppendAS(as)
+		}
+		asPath.AppendASPathSegment(seg)
+	}
+	if len(asSet) > 0 {
+		seg := packet.NewBGPAS4PathSegmentSet()
+		for _, as := range asSet {
+			seg.AppendAS(as)
+		}
+		asPath.AppendASPathSegment(seg)
+	}
+
+	pathAttrs := []packet.BGPPathAttr{packet.NewBGPPathAttrOrigin(packet.BGPPathAttrOriginIGP), asPath}
+	return bgprib.NewPath(locRib, nil, pathAttrs, nil, bgprib.RouteTypeEGP)
+}
+
+func TestASPathListMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []config.ASPathListEntry
+		asPath   string
+		expected bool
+	}{
+		{"Boundary matches the first AS", []config.ASPathListEntry{{Permit: true, Regex: "^65001_"}},
+			"65001 174", true},
+		{"Boundary doesn't match a longer AS", []config.ASPathListEntry{{Permit: true, Regex: "_174_"}},
+			"65001 1740", false},
+		{"Boundary matches the last AS", []config.ASPathListEntry{{Permit: true, Regex: "_174$"}}, "65001 174", true},
+		{"Boundary matches an AS in a set", []config.ASPathListEntry{{Permit: true, Regex: "_65011_"}},
+			"65001 { 65010, 65011 }", true},
+		{"Empty AS path", []config.ASPathListEntry{{Permit: true, Regex: "^$"}}, "", true},
+		{"First matching entry denies",
+			[]config.ASPathListEntry{{Permit: false, Regex: "_174_"}, {Permit: true, Regex: ".*"}},
+			"65001 174", false},
+		{"First matching entry permits",
+			[]config.ASPathListEntry{{Permit: true, Regex: "_174_"}, {Permit: false, Regex: ".*"}},
+			"65001 174", true},
+		{"No matching entry", []config.ASPathListEntry{{Permit: true, Regex: "^65002_"}}, "65001 174", false},
+	}
+
+	for _, test := range tests {
+		asPathList, err := NewASPathList(config.ASPathList{Name: "list1", Entries: test.entries})
+		if err != nil {
+			t.Errorf("%s: NewASPathList failed with error %s", test.name, err)
+			continue
+		}
+		if matched := asPathList.Match(test.asPath); matched != test.expected {
+			t.Errorf("%s: AS path \"%s\" matched %t, expected %t", test.name, test.asPath, matched,
+				test.expected)
+		}
+	}
+}
+
+func TestASPathListInvalidRegex(t *testing.T) {
+	listCfg := config.ASPathList{Name: "list1", Entries: []config.ASPathListEntry{{Permit: true, Regex: "65001(_"}}}
+	if _, err := NewASPathList(listCfg); err == nil {
+		t.Error("NewASPathList with an invalid regex didn't fail")
+	}
+}
+
+func TestValidateBGPPolicyCondition(t *testing.T) {
+	tests := []struct {
+		condCfg     config.BGPPolicyCondition
+		expectedErr bool
+	}{
+		{config.BGPPolicyCondition{Name: "c1", ConditionType: BGPConditionTypeASPathMatch, ASPathList: "l1"}, false},
+		{config.BGPPolicyCondition{Name: "c2", ConditionType: BGPConditionTypeASPathMatch}, true},
+		{config.BGPPolicyCondition{Name: "c3", ConditionType: BGPConditionTypeOriginASMatch, AS: 65001}, false},
+		{config.BGPPolicyCondition{Name: "c4", ConditionType: BGPConditionTypeNeighborASMatch}, true},
+		{config.BGPPolicyCondition{Name: "c5", ConditionType: BGPConditionTypeASPathLengthMatch,
+			MinASPathLength: 3, MaxASPathLength: 2}, true},
+		{config.BGPPolicyCondition{Name: "c6", ConditionType: BGPConditionTypeASPathLengthMatch,
+			MinASPathLength: 3}, false},
+		{config.BGPPolicyCondition{Name: "c7", ConditionType: "MatchCommunity"}, true},
+	}
+
+	for _, test := range tests {
+		err := ValidateBGPPolicyCondition(test.condCfg)
+		if (err != nil) != test.expectedErr {
+			t.Errorf("Condition %s: ValidateBGPPolicyCondition returned error %v, expected error %t",
+				test.condCfg.Name, err, test.expectedErr)
+		}
+	}
+}
+
+func TestMatchBGPCondition(t *testing.T) {
+	logger := newTestLogger(t)
+	locRib := bgprib.NewLocRib(logger, nil, nil, &config.GlobalConfig{})
+	eng := NewAdjRibPolicyEngine(logger)
+	listCfg := config.ASPathList{Name: "via174", Entries: []config.ASPathListEntry{{Permit: true, Regex: "_174_"}}}
+	if err := eng.CreateASPathList(listCfg); err != nil {
+		t.Fatal("CreateASPathList failed with error", err)
+	}
+
+	path := newTestPath(locRib, []uint32{65001, 174, 65002}, nil)
+	setPath := newTestPath(locRib, []uint32{65001}, []uint32{65010, 65011})
+	tests := []struct {
+		name     string
+		condCfg  config.BGPPolicyCondition
+		path     *bgprib.Path
+		expected bool
+	}{
+		{"AS path list matches", config.BGPPolicyCondition{ConditionType: BGPConditionTypeASPathMatch,
+			ASPathList: "via174"}, path, true},
+		{"AS path list doesn't match", config.BGPPolicyCondition{ConditionType: BGPConditionTypeASPathMatch,
+			ASPathList: "via174"}, setPath, false},
+		{"AS path list not found", config.BGPPolicyCondition{ConditionType: BGPConditionTypeASPathMatch,
+			ASPathList: "unknown"}, path, false},
+		{"Origin AS matches", config.BGPPolicyCondition{ConditionType: BGPConditionTypeOriginASMatch,
+			AS: 65002}, path, true},
+		{"Origin AS doesn't match", config.BGPPolicyCondition{ConditionType: BGPConditionTypeOriginASMatch,
+			AS: 65001}, path, false},
+		{"No origin AS with AS set", config.BGPPolicyCondition{ConditionType: BGPConditionTypeOriginASMatch,
+			AS: 65011}, setPath, false},
+		{"Neighbor AS matches", config.BGPPolicyCondition{ConditionType: BGPConditionTypeNeighborASMatch,
+			AS: 65001}, path, true},
+		{"Neighbor AS doesn't match", config.BGPPolicyCondition{ConditionType: BGPConditionTypeNeighborASMatch,
+			AS: 174}, path, false},
+		{"AS path length in range", config.BGPPolicyCondition{ConditionType: BGPConditionTypeASPathLengthMatch,
+			MinASPathLength: 2, MaxASPathLength: 3}, path, true},
+		{"AS path length above max", config.BGPPolicyCondition{ConditionType: BGPConditionTypeASPathLengthMatch,
+			MinASPathLength: 1, MaxASPathLength: 2}, path, false},
+		{"AS path length without max", config.BGPPolicyCondition{ConditionType: BGPConditionTypeASPathLengthMatch,
+			MinASPathLength: 3}, path, true},
+	}
+
+	for _, test := range tests {
+		if matched := eng.matchBGPCondition(test.condCfg, test.path); matched != test.expected {
+			t.Errorf("%s: matched %t, expected %t", test.name, matched, test.expected)
+		}
+	}
+}
+
+func createTestPolicy(t *testing.T, eng *AdjRibPPolicyEngine) {
+	listCfg := config.ASPathList{Name: "via174", Entries: []config.ASPathListEntry{{Permit: true, Regex: "_174_"}}}
+	if err := eng.CreateASPathList(listCfg); err != nil {
+		t.Fatal("CreateASPathList failed with error", err)
+	}
+
+	prefixCond := utilspolicy.PolicyConditionConfig{
+		Name:          "prefix10",
+		ConditionType: PolicyConditionTypeDstIpPrefixMatch,
+		MatchDstIpPrefixConditionInfo: utilspolicy.PolicyDstIpMatchPrefixSetCondition{
+			Prefix: utilspolicy.PolicyPrefix{IpPrefix: "10.0.0.0/8", MasklengthRange: "8-24"},
+		},
+	}
+	if _, err := eng.CreatePolicyCondition(prefixCond); err != nil {
+		t.Fatal("CreatePolicyCondition failed with error", err)
+	}
+	bgpConds := []config.BGPPolicyCondition{
+		{Name: "via174", ConditionType: BGPConditionTypeASPathMatch, ASPathList: "via174"},
+		{Name: "origin65002", ConditionType: BGPConditionTypeOriginASMatch, AS: 65002},
+	}
+	for _, condCfg := range bgpConds {
+		if _, err := eng.CreateBGPPolicyCondition(condCfg); err != nil {
+			t.Fatal("CreateBGPPolicyCondition failed with error", err)
+		}
+	}
+
+	actions := []utilspolicy.PolicyActionConfig{
+		{Name: "accept", ActionType: PolicyActionTypeRouteDisposition, Accept: true},
+		{Name: "reject", ActionType: PolicyActionTypeRouteDisposition, Reject: true},
+	}
+	for _, actionCfg := range actions {
+		if _, err := eng.CreatePolicyAction(actionCfg); err != nil {
+			t.Fatal("CreatePolicyAction failed with error", err)
+		}
+	}
+
+	stmts := []utilspolicy.PolicyStmtConfig{
+		{Name: "rejectVia174", MatchConditions: "all", Conditions: []string{"prefix10", "via174"},
+			Actions: []string{"reject"}},
+		{Name: "acceptPrefixOrOrigin", MatchConditions: "any", Conditions: []string{"prefix10", "origin65002"},
+			Actions: []string{"accept"}},
+	}
+	for _, stmtCfg := range stmts {
+		if err := eng.CreatePolicyStmt(stmtCfg); err != nil {
+			t.Fatal("CreatePolicyStmt failed with error", err)
+		}
+	}
+
+	defCfg := utilspolicy.PolicyDefinitionConfig{
+		Name: "export1",
+		PolicyDefinitionStatements: []utilspolicy.PolicyDefinitionStmtPrecedence{
+			{Precedence: 2, Statement: "acceptPrefixOrOrigin"},
+			{Precedence: 1, Statement: "rejectVia174"},
+		},
+	}
+	if err := eng.CreatePolicyDefinition(defCfg); err != nil {
+		t.Fatal("CreatePolicyDefinition failed with error", err)
+	}
+}
+
+func TestAdjRibFilterPath(t *testing.T) {
+	logger := newTestLogger(t)
+	locRib := bgprib.NewLocRib(logger, nil, nil, &config.GlobalConfig{})
+	eng := NewAdjRibPolicyEngine(logger)
+	createTestPolicy(t, eng)
+
+	via174 := newTestPath(locRib, []uint32{65001, 174, 65003}, nil)
+	origin65002 := newTestPath(locRib, []uint32{65001, 65002}, nil)
+	other := newTestPath(locRib, []uint32{65001, 65003}, nil)
+	tests := []struct {
+		name         string
+		prefix       string
+		length       uint8
+		path         *bgprib.Path
+		expected     bool
+		expectedStmt string
+	}{
+		{"Prefix via AS 174 rejected", "10.1.0.0", 16, via174, false, "rejectVia174"},
+		{"Prefix not via AS 174 accepted", "10.1.0.0", 16, other, true, "acceptPrefixOrOrigin"},
+		{"Prefix longer than the range accepted by origin", "10.1.1.0", 25, origin65002, true,
+			"acceptPrefixOrOrigin"},
+		{"Other prefix via AS 174 doesn't match any statement", "20.1.0.0", 16, via174, false, ""},
+		{"Other prefix from AS 65002 accepted", "20.1.0.0", 16, origin65002, true, "acceptPrefixOrOrigin"},
+	}
+
+	for _, test := range tests {
+		hitCounts := map[string]uint32{
+			"rejectVia174":         eng.GetStmtHitCounter("rejectVia174"),
+			"acceptPrefixOrOrigin": eng.GetStmtHitCounter("acceptPrefixOrOrigin"),
+		}
+		nlri := packet.NewIPPrefix(net.ParseIP(test.prefix).To4(), test.length)
+		if accepted := eng.FilterPath("export1", nlri, test.path); accepted != test.expected {
+			t.Errorf("%s: FilterPath returned %t, expected %t", test.name, accepted, test.expected)
+		}
+		for stmtName, hitCount := range hitCounts {
+			expectedCount := hitCount
+			if stmtName == test.expectedStmt {
+				expectedCount++
+			}
+			if count := eng.GetStmtHitCounter(stmtName); count != expectedCount {
+				t.Errorf("%s: statement %s hit counter %d, expected %d", test.name, stmtName, count,
+					expectedCount)
+			}
+		}
+	}
+
+	nlri := packet.NewIPPrefix(net.ParseIP("10.1.0.0").To4(), 16)
+	if eng.FilterPath("unknown", nlri, other) {
+		t.Error("FilterPath with an unknown policy accepted the path")
+	}
+}
+
+func TestAdjRibPolicyConfigValidation(t *testing.T) {
+	logger := newTestLogger(t)
+	eng := NewAdjRibPolicyEngine(logger)
+	createTestPolicy(t, eng)
+
+	stmtCfg := utilspolicy.PolicyStmtConfig{Name: "stmt1", Conditions: []string{"unknown"}}
+	if err := eng.CreatePolicyStmt(stmtCfg); err == nil {
+		t.Error("CreatePolicyStmt with an unknown condition didn't fail")
+	}
+
+	if err := eng.ValidateExportPolicy("export1"); err != nil {
+		t.Error("ValidateExportPolicy failed with error", err)
+	}
+	if err := eng.ValidateExportPolicy("unknown"); err == nil {
+		t.Error("ValidateExportPolicy of an unknown policy didn't fail")
+	}
+
+	/*  Conditions and actions the engine can't run are accepted for the Loc-RIB engine, the policies that
+	 *  use them can't be export policies.
+	 */
+	prefixSetCond := utilspolicy.PolicyConditionConfig{
+		Name:          "prefixSet1",
+		ConditionType: PolicyConditionTypeDstIpPrefixMatch,
+		MatchDstIpPrefixConditionInfo: utilspolicy.PolicyDstIpMatchPrefixSetCondition{
+			PrefixSet: "set1",
+		},
+	}
+	if _, err := eng.CreatePolicyCondition(prefixSetCond); err != nil {
+		t.Error("CreatePolicyCondition with a prefix set failed with error", err)
+	}
+	aggAction := utilspolicy.PolicyActionConfig{Name: "agg1", ActionType: PolicyActionTypeAggregate}
+	if _, err := eng.CreatePolicyAction(aggAction); err != nil {
+		t.Error("CreatePolicyAction with an aggregate action failed with error", err)
+	}
+	stmts := []utilspolicy.PolicyStmtConfig{
+		{Name: "prefixSetStmt", Conditions: []string{"prefixSet1"}, Actions: []string{"accept"}},
+		{Name: "aggStmt", Conditions: []string{"prefix10"}, Actions: []string{"agg1"}},
+	}
+	for _, stmtCfg := range stmts {
+		if err := eng.CreatePolicyStmt(stmtCfg); err != nil {
+			t.Fatal("CreatePolicyStmt failed with error", err)
+		}
+
+		policyName := stmtCfg.Name + "Policy"
+		defCfg := utilspolicy.PolicyDefinitionConfig{
+			Name: policyName,
+			PolicyDefinitionStatements: []utilspolicy.PolicyDefinitionStmtPrecedence{
+				{Precedence: 1, Statement: stmtCfg.Name},
+			},
+		}
+		if err := eng.CreatePolicyDefinition(defCfg); err != nil {
+			t.Fatal("CreatePolicyDefinition failed with error", err)
+		}
+		if err := eng.ValidateExportPolicy(policyName); err == nil {
+			t.Errorf("ValidateExportPolicy of policy %s didn't fail", policyName)
+		}
+	}
+
+	if _, err := eng.DeletePolicyCondition("via174"); err != nil {
+		t.Error("DeletePolicyCondition failed with error", err)
+	}
+	if _, err := eng.DeletePolicyCondition("via174"); err == nil {
+		t.Error("DeletePolicyCondition of a deleted condition didn't fail")
+	}
+
+	/*  The statement that refers to the deleted condition doesn't match anymore. */
+	locRib := bgprib.NewLocRib(logger, nil, nil, &config.GlobalConfig{})
+	via174 := newTestPath(locRib, []uint32{65001, 174, 65003}, nil)
+	nlri := packet.NewIPPrefix(net.ParseIP("10.1.0.0").To4(), 16)
+	if !eng.FilterPath("export1", nlri, via174) {
+		t.Error("FilterPath rejected the path after the reject condition was deleted")
+	}
+}
+
+func TestAdjRibPolicyUpdateFunc(t *testing.T) {
+	logger := newTestLogger(t)
+	eng := NewAdjRibPolicyEngine(logger)
+	updatedPolicies := make([]string, 0)
+	eng.SetPolicyUpdateFunc(func(policyName string) {
+		updatedPolicies = append(updatedPolicies, policyName)
+	})
+
+	createTestPolicy(t, eng)
+	if len(updatedPolicies) != 1 || updatedPolicies[0] != "export1" {
+		t.Fatal("Policy update func called with", updatedPolicies, "after the policy was created")
+	}
+
+	if err := eng.DeletePolicyDefinition("unknown"); err == nil {
+		t.Error("DeletePolicyDefinition of an unknown policy didn't fail")
+	}
+	if err := eng.DeletePolicyDefinition("export1"); err != nil {
+		t.Fatal("DeletePolicyDefinition failed with error", err)
+	}
+	if len(updatedPolicies) != 2 || updatedPolicies[1] != "export1" {
+		t.Fatal("Policy update func called with", updatedPolicies, "after the policy was deleted")
+	}
+}
+
+type testLocRibParams struct {
+	nlri packet.NLRI
+	path *bgprib.Path
+}
+
+func TestLocRibPolicyFilter(t *testing.T) {
+	logger := newTestLogger(t)
+	locRib := bgprib.NewLocRib(logger, nil, nil, &config.GlobalConfig{})
+	eng := NewLocRibPolicyEngine(logger)
+
+	prefixCond := utilspolicy.PolicyConditionConfig{
+		Name:          "prefix10",
+		ConditionType: PolicyConditionTypeDstIpPrefixMatch,
+		MatchDstIpPrefixConditionInfo: utilspolicy.PolicyDstIpMatchPrefixSetCondition{
+			Prefix: utilspolicy.PolicyPrefix{IpPrefix: "10.0.0.0/8", MasklengthRange: "8-24"},
+		},
+	}
+	if _, err := eng.CreatePolicyCondition(prefixCond); err != nil {
+		t.Fatal("CreatePolicyCondition failed with error", err)
+	}
+	originCond := config.BGPPolicyCondition{Name: "origin65002", ConditionType: BGPConditionTypeOriginASMatch,
+		AS: 65002}
+	if _, err := eng.CreateBGPPolicyCondition(originCond); err != nil {
+		t.Fatal("CreateBGPPolicyCondition failed with error", err)
+	}
+	stmts := []utilspolicy.PolicyStmtConfig{
+		{Name: "aggOrigin65002", MatchConditions: "all", Conditions: []string{"prefix10", "origin65002"},
+			Actions: []string{"permit"}},
+		{Name: "aggPrefix10", MatchConditions: "all", Conditions: []string{"prefix10"},
+			Actions: []string{"permit"}},
+	}
+	for _, stmtCfg := range stmts {
+		if err := eng.CreatePolicyStmt(stmtCfg); err != nil {
+			t.Fatal("CreatePolicyStmt failed with error", err)
+		}
+	}
+	defCfg := utilspolicy.PolicyDefinitionConfig{
+		Name: "agg1",
+		PolicyDefinitionStatements: []utilspolicy.PolicyDefinitionStmtPrecedence{
+			{Precedence: 1, Statement: "aggOrigin65002"},
+			{Precedence: 2, Statement: "aggPrefix10"},
+		},
+	}
+	if err := eng.CreatePolicyDefinition(defCfg); err != nil {
+		t.Fatal("CreatePolicyDefinition failed with error", err)
+	}
+
+	var appliedConds []interface{}
+	var updatedStmt string
+	undoneStmt := ""
+	eng.SetActionFuncs(map[int]PolicyActionFunc{
+		policyCommonDefs.PolicyActionTypeAggregate: {
+			ApplyFunc: func(actionInfo interface{}, conditionInfo []interface{}, params interface{}) {
+				appliedConds = conditionInfo
+			},
+			UndoFunc: func(actionInfo interface{}, conditionList []interface{}, params interface{},
+				policyStmt utilspolicy.PolicyStmt) {
+				undoneStmt = policyStmt.Name
+			},
+		},
+	})
+	eng.SetEntityUpdateFunc(func(details utilspolicy.PolicyDetails, params interface{}) {
+		updatedStmt = details.PolicyStmt
+	})
+	eng.SetGetRoutePathFunc(func(params interface{}) (packet.NLRI, *bgprib.Path) {
+		routeParams := params.(testLocRibParams)
+		return routeParams.nlri, routeParams.path
+	})
+
+	policyDB := eng.GetPolicyEngine().PolicyDB
+	policy := policyDB.Get(patriciaDB.Prefix("agg1")).(utilspolicy.Policy)
+	eng.UpdateApplyPolicy(utilspolicy.ApplyPolicyInfo{ApplyPolicy: policy,
+		Action: utilspolicy.PolicyAction{Name: "agg1", ActionType: policyCommonDefs.PolicyActionTypeAggregate}}, true)
+
+	origin65002 := newTestPath(locRib, []uint32{65001, 65002}, nil)
+	other := newTestPath(locRib, []uint32{65001, 65003}, nil)
+	tests := []struct {
+		name          string
+		prefix        string
+		length        uint8
+		path          *bgprib.Path
+		expectedStmt  string
+		expectedConds int
+	}{
+		{"Prefix from AS 65002 matches the first statement", "10.1.0.0", 16, origin65002, "aggOrigin65002", 2},
+		{"Prefix from another AS skips the first statement", "10.1.0.0", 16, other, "aggPrefix10", 1},
+		{"Other prefix doesn't match", "20.1.0.0", 16, origin65002, "", 0},
+	}
+
+	for _, test := range tests {
+		hitCounts := map[string]uint32{
+			"aggOrigin65002": eng.GetStmtHitCounter("aggOrigin65002"),
+			"aggPrefix10":    eng.GetStmtHitCounter("aggPrefix10"),
+		}
+		appliedConds, updatedStmt, undoneStmt = nil, "", ""
+		params := testLocRibParams{packet.NewIPPrefix(net.ParseIP(test.prefix).To4(), test.length), test.path}
+		eng.PolicyEngineFilter(utilspolicy.PolicyEngineFilterEntityParams{}, 0, params)
+		if updatedStmt != test.expectedStmt {
+			t.Errorf("%s: matched statement %q, expected %q", test.name, updatedStmt, test.expectedStmt)
+		}
+		if len(appliedConds) != test.expectedConds {
+			t.Errorf("%s: action applied with %d conditions, expected %d", test.name, len(appliedConds),
+				test.expectedConds)
+		}
+		for stmtName, hitCount := range hitCounts {
+			expectedCount := hitCount
+			if stmtName == test.expectedStmt {
+				expectedCount++
+			}
+			if count := eng.GetStmtHitCounter(stmtName); count != expectedCount {
+				t.Errorf("%s: statement %s hit counter %d, expected %d", test.name, stmtName, count,
+					expectedCount)
+			}
+		}
+
+		eng.UndoPolicyForEntity(utilspolicy.PolicyEngineFilterEntityParams{}, policy, params)
+		if undoneStmt != test.expectedStmt {
+			t.Errorf("%s: undone statement %q, expected %q", test.name, undoneStmt, test.expectedStmt)
+		}
+	}
+}
@@ -21,12 +21,17 @@
 // |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
 //
 
-// policy.go
+// locRibEngine.go
 package policy
 
 import (
+	"l3/bgp/config"
+	"l3/bgp/packet"
 	bgprib "l3/bgp/rib"
+	"sync"
+	"sync/atomic"
 	"utils/logging"
+	"utils/patriciaDB"
 	utilspolicy "utils/policy"
 )
 
@@ -36,19 +41,309 @@ type PolicyExtensions struct {
 	RouteInfoList []*bgprib.Route
 }
 
+/*  GetRoutePathFunc returns the NLRI and the path of the route in the params that are
+ *  passed to the policy engine.
+ */
+type GetRoutePathFunc func(params interface{}) (packet.NLRI, *bgprib.Path)
+
+/*  The Loc-RIB policy engine runs the policies applied to the Loc-RIB routes, like the
+ *  aggregates. The policies are kept in the policy engine DB, which tracks the routes of
+ *  each policy, and in the policy matcher. The statement of an applied policy is picked by
+ *  the matcher, so the BGP path conditions are matched along with the prefix conditions,
+ *  and the action of the applied policy is run by the engine.
+ *  The config is written by the policy manager and the server goroutines and the policies
+ *  are run by the server goroutine.
+ */
 type LocRibPolicyEngine struct {
 	BasePolicyEngine
+	mutex               sync.RWMutex
+	matcher             *policyMatcher
+	applied             []utilspolicy.ApplyPolicyInfo
+	actionFuncs         map[int]PolicyActionFunc
+	entityUpdateFunc    utilspolicy.EntityUpdatefunc
+	traverseApplyFunc   utilspolicy.EntityTraverseAndApplyPolicyfunc
+	traverseReverseFunc utilspolicy.EntityTraverseAndReversePolicyfunc
+	getRoutePathFunc    GetRoutePathFunc
 }
 
 func NewLocRibPolicyEngine(logger *logging.Writer) *LocRibPolicyEngine {
 	policyEngine := &LocRibPolicyEngine{
 		BasePolicyEngine: NewBasePolicyEngine(logger, utilspolicy.NewPolicyEngineDB(logger)),
+		matcher:          newPolicyMatcher(),
+		applied:          make([]utilspolicy.ApplyPolicyInfo, 0),
+		actionFuncs:      make(map[int]PolicyActionFunc),
 	}
 	policyEngine.SetGetPolicyEntityMapIndexFunc(getPolicyEnityKey)
 	return policyEngine
 }
 
+func (eng *LocRibPolicyEngine) SetTraverseFuncs(traverseApplyFunc utilspolicy.EntityTraverseAndApplyPolicyfunc,
+	traverseReverseFunc utilspolicy.EntityTraverseAndReversePolicyfunc) {
+	eng.traverseApplyFunc = traverseApplyFunc
+	eng.traverseReverseFunc = traverseReverseFunc
+}
+
+func (eng *LocRibPolicyEngine) SetActionFuncs(actionFuncMap map[int]PolicyActionFunc) {
+	for actionType, actionFuncs := range actionFuncMap {
+		eng.actionFuncs[actionType] = actionFuncs
+	}
+}
+
+func (eng *LocRibPolicyEngine) SetEntityUpdateFunc(entityUpdateFunc utilspolicy.EntityUpdatefunc) {
+	eng.entityUpdateFunc = entityUpdateFunc
+}
+
+func (eng *LocRibPolicyEngine) SetGetRoutePathFunc(getRoutePathFunc GetRoutePathFunc) {
+	eng.getRoutePathFunc = getRoutePathFunc
+}
+
+func (eng *LocRibPolicyEngine) CreatePolicyCondition(condCfg utilspolicy.PolicyConditionConfig) (bool, error) {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if err := eng.matcher.createCondition(condCfg); err != nil {
+		return false, err
+	}
+
+	ok, err := eng.BasePolicyEngine.CreatePolicyCondition(condCfg)
+	if err != nil {
+		eng.matcher.deleteCondition(condCfg.Name)
+	}
+	return ok, err
+}
+
+/*  The BGP path conditions are only kept by the matcher, the policy engine DB can't match them.
+ */
+func (eng *LocRibPolicyEngine) CreateBGPPolicyCondition(condCfg config.BGPPolicyCondition) (bool, error) {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if err := eng.matcher.createBGPCondition(condCfg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (eng *LocRibPolicyEngine) DeletePolicyCondition(conditionName string) (bool, error) {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	condition, ok := eng.matcher.conditions[conditionName]
+	if err := eng.matcher.deleteCondition(conditionName); err != nil {
+		return false, err
+	}
+	if ok && condition.bgpCond != nil {
+		return true, nil
+	}
+	return eng.BasePolicyEngine.DeletePolicyCondition(conditionName)
+}
+
+func (eng *LocRibPolicyEngine) CreatePolicyStmt(stmtCfg utilspolicy.PolicyStmtConfig) error {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if err := eng.matcher.createStmt(stmtCfg); err != nil {
+		return err
+	}
+
+	dbStmtCfg := stmtCfg
+	dbStmtCfg.Conditions = make([]string, 0, len(stmtCfg.Conditions))
+	for _, condName := range stmtCfg.Conditions {
+		if eng.matcher.conditions[condName].bgpCond == nil {
+			dbStmtCfg.Conditions = append(dbStmtCfg.Conditions, condName)
+		}
+	}
+	err := eng.BasePolicyEngine.CreatePolicyStmt(dbStmtCfg)
+	if err != nil {
+		eng.matcher.deleteStmt(stmtCfg.Name)
+	}
+	return err
+}
+
+func (eng *LocRibPolicyEngine) DeletePolicyStmt(stmtName string) error {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if err := eng.matcher.deleteStmt(stmtName); err != nil {
+		return err
+	}
+	return eng.BasePolicyEngine.DeletePolicyStmt(stmtName)
+}
+
 func (eng *LocRibPolicyEngine) CreatePolicyDefinition(defCfg utilspolicy.PolicyDefinitionConfig) error {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	if err := eng.matcher.createDefinition(defCfg); err != nil {
+		return err
+	}
+
 	defCfg.Extensions = PolicyExtensions{}
-	return eng.PolicyEngine.CreatePolicyDefinition(defCfg)
+	err := eng.PolicyEngine.CreatePolicyDefinition(defCfg)
+	if err != nil {
+		eng.matcher.deleteDefinition(defCfg.Name)
+	}
+	return err
+}
+
+/*  DeletePolicyDefinition reverses the policy on the routes it was applied to before it is
+ *  deleted.
+ */
+func (eng *LocRibPolicyEngine) DeletePolicyDefinition(policyName string) error {
+	eng.mutex.Lock()
+	if _, ok := eng.matcher.definitions[policyName]; !ok {
+		eng.mutex.Unlock()
+		return eng.BasePolicyEngine.DeletePolicyDefinition(policyName)
+	}
+	applied := false
+	for idx, info := range eng.applied {
+		if info.ApplyPolicy.Name == policyName {
+			eng.applied = append(eng.applied[:idx], eng.applied[idx+1:]...)
+			applied = true
+			break
+		}
+	}
+	eng.mutex.Unlock()
+
+	if applied && eng.traverseReverseFunc != nil {
+		if item := eng.PolicyEngine.PolicyDB.Get(patriciaDB.Prefix(policyName)); item != nil {
+			eng.traverseReverseFunc(item.(utilspolicy.Policy))
+		}
+	}
+
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	eng.matcher.deleteDefinition(policyName)
+	return eng.BasePolicyEngine.DeletePolicyDefinition(policyName)
+}
+
+func (eng *LocRibPolicyEngine) CreateASPathList(listCfg config.ASPathList) error {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	return eng.BasePolicyEngine.CreateASPathList(listCfg)
+}
+
+func (eng *LocRibPolicyEngine) DeleteASPathList(name string) error {
+	eng.mutex.Lock()
+	defer eng.mutex.Unlock()
+	return eng.BasePolicyEngine.DeleteASPathList(name)
+}
+
+/*  UpdateApplyPolicy applies the policy with the action to the routes of the Loc-RIB, the
+ *  routes are traversed by the traverse apply func.
+ */
+func (eng *LocRibPolicyEngine) UpdateApplyPolicy(info utilspolicy.ApplyPolicyInfo, apply bool) {
+	eng.mutex.Lock()
+	for idx, appliedInfo := range eng.applied {
+		if appliedInfo.ApplyPolicy.Name == info.ApplyPolicy.Name {
+			eng.applied = append(eng.applied[:idx], eng.applied[idx+1:]...)
+			break
+		}
+	}
+	if apply {
+		eng.applied = append(eng.applied, info)
+	}
+	eng.mutex.Unlock()
+
+	if apply && eng.traverseApplyFunc != nil {
+		eng.traverseApplyFunc(info, func(entity utilspolicy.PolicyEngineFilterEntityParams, policyData interface{},
+			params interface{}) {
+			eng.applyPolicy(entity, policyData.(utilspolicy.ApplyPolicyInfo), params)
+		})
+	}
+}
+
+/*  matchAppliedPolicy returns the statement of the applied policy that matches the route
+ *  in the params. The caller holds the lock.
+ */
+func (eng *LocRibPolicyEngine) matchAppliedPolicy(info utilspolicy.ApplyPolicyInfo, params interface{}) *matchStmt {
+	if eng.getRoutePathFunc == nil {
+		eng.logger.Err("LocRibPolicyEngine:matchAppliedPolicy - get route path func not set")
+		return nil
+	}
+
+	nlri, path := eng.getRoutePathFunc(params)
+	if nlri == nil {
+		return nil
+	}
+	stmt, _ := eng.matcher.matchPolicy(&eng.BasePolicyEngine, info.ApplyPolicy.Name, nlri, path)
+	return stmt
+}
+
+func (eng *LocRibPolicyEngine) applyPolicy(entity utilspolicy.PolicyEngineFilterEntityParams,
+	info utilspolicy.ApplyPolicyInfo, params interface{}) {
+	eng.mutex.RLock()
+	stmt := eng.matchAppliedPolicy(info, params)
+	var conditionInfos []interface{}
+	if stmt != nil {
+		atomic.AddUint32(&stmt.hitCounter, 1)
+		conditionInfos = eng.matcher.conditionInfos(stmt)
+	}
+	eng.mutex.RUnlock()
+	if stmt == nil {
+		return
+	}
+
+	if actionFuncs, ok := eng.actionFuncs[info.Action.ActionType]; ok && actionFuncs.ApplyFunc != nil {
+		actionFuncs.ApplyFunc(info.Action.ActionInfo, conditionInfos, params)
+	}
+	if eng.entityUpdateFunc != nil {
+		eng.entityUpdateFunc(utilspolicy.PolicyDetails{Policy: info.ApplyPolicy.Name, PolicyStmt: stmt.name},
+			params)
+	}
+}
+
+/*  PolicyEngineFilter runs the applied policies on the route in the params when the route
+ *  is added to or removed from the Loc-RIB.
+ */
+func (eng *LocRibPolicyEngine) PolicyEngineFilter(entity utilspolicy.PolicyEngineFilterEntityParams, policyPath int,
+	params interface{}) {
+	eng.mutex.RLock()
+	applied := make([]utilspolicy.ApplyPolicyInfo, len(eng.applied))
+	copy(applied, eng.applied)
+	eng.mutex.RUnlock()
+
+	for _, info := range applied {
+		eng.applyPolicy(entity, info, params)
+	}
+}
+
+/*  UndoPolicyForEntity runs the undo action of the policy on the route in the params if the
+ *  policy matches the route.
+ */
+func (eng *LocRibPolicyEngine) UndoPolicyForEntity(entity utilspolicy.PolicyEngineFilterEntityParams,
+	policy utilspolicy.Policy, params interface{}) {
+	eng.mutex.RLock()
+	var info utilspolicy.ApplyPolicyInfo
+	var stmt *matchStmt
+	var conditionInfos []interface{}
+	if definition, ok := eng.matcher.definitions[policy.Name]; ok && len(definition) > 0 {
+		info = utilspolicy.ApplyPolicyInfo{ApplyPolicy: policy}
+		for _, appliedInfo := range eng.applied {
+			if appliedInfo.ApplyPolicy.Name == policy.Name {
+				info = appliedInfo
+				break
+			}
+		}
+		stmt = eng.matchAppliedPolicy(info, params)
+		if stmt != nil {
+			conditionInfos = eng.matcher.conditionInfos(stmt)
+		}
+	}
+	eng.mutex.RUnlock()
+	if stmt == nil {
+		return
+	}
+
+	if actionFuncs, ok := eng.actionFuncs[info.Action.ActionType]; ok && actionFuncs.UndoFunc != nil {
+		policyStmt := utilspolicy.PolicyStmt{
+			Name:       stmt.name,
+			Conditions: stmt.conditions,
+			Actions:    stmt.actions,
+		}
+		actionFuncs.UndoFunc(info.Action.ActionInfo, conditionInfos, params, policyStmt)
+	}
+}
+
+func (eng *LocRibPolicyEngine) GetStmtHitCounter(stmtName string) uint32 {
+	eng.mutex.RLock()
+	defer eng.mutex.RUnlock()
+	if stmt, ok := eng.matcher.stmts[stmtName]; ok {
+		return atomic.LoadUint32(&stmt.hitCounter)
+	}
+	return 0
 }
@@ -0,0 +1,248 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// matcher.go
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"l3/bgp/config"
+	"l3/bgp/packet"
+	bgprib "l3/bgp/rib"
+	"sort"
+	utilspolicy "utils/policy"
+)
+
+const PolicyMatchConditionsAll = "all"
+
+/*  Conditions that can't be matched against a path are kept with the reason, so that the
+ *  statements and policies that use them can still be configured. The statements that use
+ *  them never match.
+ */
+type matchCondition struct {
+	prefixRange *PrefixRange
+	prefixInfo  utilspolicy.MatchPrefixConditionInfo
+	bgpCond     *config.BGPPolicyCondition
+	unsupported string
+}
+
+type matchStmt struct {
+	name       string
+	matchAll   bool
+	conditions []string
+	actions    []string
+	hitCounter uint32
+}
+
+type stmtPrecedenceList []utilspolicy.PolicyDefinitionStmtPrecedence
+
+func (l stmtPrecedenceList) Len() int           { return len(l) }
+func (l stmtPrecedenceList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l stmtPrecedenceList) Less(i, j int) bool { return l[i].Precedence < l[j].Precedence }
+
+/*  policyMatcher keeps the conditions, statements and policies of a policy engine and
+ *  picks the statement of a policy that matches a path. The prefix conditions and the BGP
+ *  path conditions are matched together and the first statement that matches in
+ *  precedence order is picked. The caller serializes the access.
+ */
+type policyMatcher struct {
+	conditions  map[string]matchCondition
+	stmts       map[string]*matchStmt
+	definitions map[string][]string
+}
+
+func newPolicyMatcher() *policyMatcher {
+	return &policyMatcher{
+		conditions:  make(map[string]matchCondition),
+		stmts:       make(map[string]*matchStmt),
+		definitions: make(map[string][]string),
+	}
+}
+
+func (m *policyMatcher) createCondition(condCfg utilspolicy.PolicyConditionConfig) error {
+	condition := matchCondition{}
+	if condCfg.ConditionType != PolicyConditionTypeDstIpPrefixMatch {
+		condition.unsupported = fmt.Sprintf("condition type %s", condCfg.ConditionType)
+	} else if condCfg.MatchDstIpPrefixConditionInfo.PrefixSet != "" {
+		condition.unsupported = fmt.Sprintf("prefix set %s", condCfg.MatchDstIpPrefixConditionInfo.PrefixSet)
+	} else {
+		prefixRange, err := NewPrefixRange(condCfg.MatchDstIpPrefixConditionInfo.Prefix)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Condition %s, invalid prefix, error %s", condCfg.Name, err))
+		}
+		condition.prefixRange = prefixRange
+		condition.prefixInfo = utilspolicy.MatchPrefixConditionInfo{
+			DstIpMatch: true,
+			Prefix:     condCfg.MatchDstIpPrefixConditionInfo.Prefix,
+		}
+	}
+
+	if _, ok := m.conditions[condCfg.Name]; ok {
+		return errors.New(fmt.Sprintf("Condition %s already exists", condCfg.Name))
+	}
+	m.conditions[condCfg.Name] = condition
+	return nil
+}
+
+func (m *policyMatcher) createBGPCondition(condCfg config.BGPPolicyCondition) error {
+	if err := ValidateBGPPolicyCondition(condCfg); err != nil {
+		return err
+	}
+
+	if _, ok := m.conditions[condCfg.Name]; ok {
+		return errors.New(fmt.Sprintf("Condition %s already exists", condCfg.Name))
+	}
+	m.conditions[condCfg.Name] = matchCondition{bgpCond: &condCfg}
+	return nil
+}
+
+func (m *policyMatcher) deleteCondition(conditionName string) error {
+	if _, ok := m.conditions[conditionName]; !ok {
+		return errors.New(fmt.Sprintf("Condition %s not found", conditionName))
+	}
+	delete(m.conditions, conditionName)
+	return nil
+}
+
+func (m *policyMatcher) createStmt(stmtCfg utilspolicy.PolicyStmtConfig) error {
+	if _, ok := m.stmts[stmtCfg.Name]; ok {
+		return errors.New(fmt.Sprintf("Statement %s already exists", stmtCfg.Name))
+	}
+	for _, condName := range stmtCfg.Conditions {
+		if _, ok := m.conditions[condName]; !ok {
+			return errors.New(fmt.Sprintf("Statement %s, condition %s not found", stmtCfg.Name, condName))
+		}
+	}
+
+	m.stmts[stmtCfg.Name] = &matchStmt{
+		name:       stmtCfg.Name,
+		matchAll:   stmtCfg.MatchConditions == "" || stmtCfg.MatchConditions == PolicyMatchConditionsAll,
+		conditions: stmtCfg.Conditions,
+		actions:    stmtCfg.Actions,
+	}
+	return nil
+}
+
+func (m *policyMatcher) deleteStmt(stmtName string) error {
+	if _, ok := m.stmts[stmtName]; !ok {
+		return errors.New(fmt.Sprintf("Statement %s not found", stmtName))
+	}
+	delete(m.stmts, stmtName)
+	return nil
+}
+
+func (m *policyMatcher) createDefinition(defCfg utilspolicy.PolicyDefinitionConfig) error {
+	if _, ok := m.definitions[defCfg.Name]; ok {
+		return errors.New(fmt.Sprintf("Policy %s already exists", defCfg.Name))
+	}
+
+	stmtPrecedences := make([]utilspolicy.PolicyDefinitionStmtPrecedence, len(defCfg.PolicyDefinitionStatements))
+	copy(stmtPrecedences, defCfg.PolicyDefinitionStatements)
+	sort.Sort(stmtPrecedenceList(stmtPrecedences))
+	stmts := make([]string, 0, len(stmtPrecedences))
+	for _, stmtPrecedence := range stmtPrecedences {
+		if _, ok := m.stmts[stmtPrecedence.Statement]; !ok {
+			return errors.New(fmt.Sprintf("Policy %s, statement %s not found", defCfg.Name,
+				stmtPrecedence.Statement))
+		}
+		stmts = append(stmts, stmtPrecedence.Statement)
+	}
+	m.definitions[defCfg.Name] = stmts
+	return nil
+}
+
+func (m *policyMatcher) deleteDefinition(policyName string) error {
+	if _, ok := m.definitions[policyName]; !ok {
+		return errors.New(fmt.Sprintf("Policy %s not found", policyName))
+	}
+	delete(m.definitions, policyName)
+	return nil
+}
+
+func (m *policyMatcher) matchCondition(eng *BasePolicyEngine, condName string, nlri packet.NLRI,
+	path *bgprib.Path) bool {
+	condition, ok := m.conditions[condName]
+	if !ok || condition.unsupported != "" {
+		return false
+	}
+
+	if condition.prefixRange != nil {
+		return condition.prefixRange.Matches(nlri.GetPrefix(), nlri.GetLength())
+	}
+	return path != nil && eng.matchBGPCondition(*condition.bgpCond, path)
+}
+
+func (m *policyMatcher) matchStmt(eng *BasePolicyEngine, stmt *matchStmt, nlri packet.NLRI,
+	path *bgprib.Path) bool {
+	if len(stmt.conditions) == 0 {
+		return true
+	}
+
+	for _, condName := range stmt.conditions {
+		matched := m.matchCondition(eng, condName, nlri, path)
+		if matched && !stmt.matchAll {
+			return true
+		} else if !matched && stmt.matchAll {
+			return false
+		}
+	}
+	return stmt.matchAll
+}
+
+/*  matchPolicy returns the first statement of the policy, in precedence order, that
+ *  matches the path of the NLRI. It returns false if the policy is not configured.
+ */
+func (m *policyMatcher) matchPolicy(eng *BasePolicyEngine, policyName string, nlri packet.NLRI,
+	path *bgprib.Path) (*matchStmt, bool) {
+	stmts, ok := m.definitions[policyName]
+	if !ok {
+		return nil, false
+	}
+
+	for _, stmtName := range stmts {
+		if stmt, ok := m.stmts[stmtName]; ok && m.matchStmt(eng, stmt, nlri, path) {
+			return stmt, true
+		}
+	}
+	return nil, true
+}
+
+/*  conditionInfos returns the info of the conditions of the statement that is passed to
+ *  the action funcs, the same as the info of the policy engine DB conditions.
+ */
+func (m *policyMatcher) conditionInfos(stmt *matchStmt) []interface{} {
+	conditionInfos := make([]interface{}, 0, len(stmt.conditions))
+	for _, condName := range stmt.conditions {
+		condition, ok := m.conditions[condName]
+		if !ok || condition.unsupported != "" {
+			continue
+		}
+		if condition.bgpCond != nil {
+			conditionInfos = append(conditionInfos, *condition.bgpCond)
+		} else {
+			conditionInfos = append(conditionInfos, condition.prefixInfo)
+		}
+	}
+	return conditionInfos
+}
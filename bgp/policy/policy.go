@@ -25,11 +25,13 @@
 package policy
 
 import (
-	_ "fmt"
+	"l3/bgp/config"
 	"utils/logging"
 	utilspolicy "utils/policy"
 )
 
+const PolicyActionTypeAggregate = "Aggregate"
+
 type PolicyActionFunc struct {
 	ApplyFunc utilspolicy.Policyfunc
 	UndoFunc  utilspolicy.UndoActionfunc
@@ -51,17 +53,22 @@ type BGPPolicyEngine interface {
 	SetIsEntityPresentFunc(utilspolicy.PolicyCheckfunc)
 	SetGetPolicyEntityMapIndexFunc(utilspolicy.GetPolicyEnityMapIndexFunc)
 	GetPolicyEngine() *utilspolicy.PolicyEngineDB
+	CreateASPathList(config.ASPathList) error
+	DeleteASPathList(string) error
+	CreateBGPPolicyCondition(config.BGPPolicyCondition) (bool, error)
 }
 
 type BasePolicyEngine struct {
 	logger       *logging.Writer
 	PolicyEngine *utilspolicy.PolicyEngineDB
+	asPathLists  map[string]*ASPathList
 }
 
 func NewBasePolicyEngine(logger *logging.Writer, policyEngine *utilspolicy.PolicyEngineDB) BasePolicyEngine {
 	return BasePolicyEngine{
 		logger:       logger,
 		PolicyEngine: policyEngine,
+		asPathLists:  make(map[string]*ASPathList),
 	}
 }
 
@@ -119,7 +126,15 @@ func (eng *BasePolicyEngine) CreatePolicyStmt(stmtCfg utilspolicy.PolicyStmtConf
 	return eng.PolicyEngine.CreatePolicyStatement(stmtCfg)
 }
 
+/*  The route disposition actions are only run by the adj-RIB policy engine, they are not created in the
+ *  policy engine DB.
+ */
 func (eng *BasePolicyEngine) CreatePolicyAction(actionCfg utilspolicy.PolicyActionConfig) (bool, error) {
+	if actionCfg.ActionType != PolicyActionTypeAggregate {
+		eng.logger.Info("BasePolicyEngine:CreatePolicyAction - skip action", actionCfg.Name, "of type",
+			actionCfg.ActionType)
+		return false, nil
+	}
 	return eng.PolicyEngine.CreatePolicyAggregateAction(actionCfg)
 }
 
@@ -176,6 +176,52 @@ func GetNetworkPrefixFromCIDR(ipAddr string) (ipPrefix patriciaDB.Prefix, err er
 	return patriciaDB.Prefix(destNet), err
 }
 
+/*  PrefixRange is the prefix and the mask length range of a prefix match condition.
+ *  An empty mask length range or "exact" matches the prefix length only.
+ */
+type PrefixRange struct {
+	ipNet  *net.IPNet
+	minLen uint8
+	maxLen uint8
+}
+
+func NewPrefixRange(prefix utilspolicy.PolicyPrefix) (*PrefixRange, error) {
+	_, ipNet, err := net.ParseCIDR(prefix.IpPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, _ := ipNet.Mask.Size()
+	pRange := &PrefixRange{ipNet: ipNet, minLen: uint8(ones), maxLen: uint8(ones)}
+	lenRange := prefix.MasklengthRange
+	if lenRange == "" || lenRange == "exact" {
+		return pRange, nil
+	}
+
+	tokens := strings.Split(lenRange, "-")
+	if len(tokens) != 2 {
+		return nil, errors.New(fmt.Sprintf("Invalid mask length range %s", lenRange))
+	}
+	minLen, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	maxLen, err := strconv.Atoi(tokens[1])
+	if err != nil {
+		return nil, err
+	}
+	if minLen > maxLen {
+		return nil, errors.New(fmt.Sprintf("Invalid mask length range %s", lenRange))
+	}
+	pRange.minLen = uint8(minLen)
+	pRange.maxLen = uint8(maxLen)
+	return pRange, nil
+}
+
+func (p *PrefixRange) Matches(ip net.IP, length uint8) bool {
+	return length >= p.minLen && length <= p.maxLen && p.ipNet.Contains(ip)
+}
+
 func (eng *LocRibPolicyEngine) DeleteRoutePolicyState(route *bgprib.Route, policyName string) {
 	utils.Logger.Info("deleteRoutePolicyState")
 	found := false
@@ -33,6 +33,14 @@ import (
 
 var PolicyManager *BGPPolicyManager
 
+/*  policyCfgReq is a config change that is applied by the policy manager goroutine.
+ *  The error of the change is sent back on errCh.
+ */
+type policyCfgReq struct {
+	applyFunc func() error
+	errCh     chan error
+}
+
 type BGPPolicyManager struct {
 	logger          *logging.Writer
 	policyEngines   []BGPPolicyEngine
@@ -44,6 +52,10 @@ type BGPPolicyManager struct {
 	ActionDelCh     chan string
 	StmtDelCh       chan string
 	DefinitionDelCh chan string
+	ASPathListCfgCh chan config.ASPathList
+	ASPathListDelCh chan string
+	BGPCondCfgCh    chan config.BGPPolicyCondition
+	cfgReqCh        chan policyCfgReq
 	policyPlugin    config.PolicyMgrIntf
 }
 
@@ -60,6 +72,10 @@ func NewPolicyManager(logger *logging.Writer, pMgr config.PolicyMgrIntf) *BGPPol
 		policyManager.ActionDelCh = make(chan string)
 		policyManager.StmtDelCh = make(chan string)
 		policyManager.DefinitionDelCh = make(chan string)
+		policyManager.ASPathListCfgCh = make(chan config.ASPathList)
+		policyManager.ASPathListDelCh = make(chan string)
+		policyManager.BGPCondCfgCh = make(chan config.BGPPolicyCondition)
+		policyManager.cfgReqCh = make(chan policyCfgReq)
 		policyManager.policyPlugin = pMgr
 		PolicyManager = policyManager
 	}
@@ -71,57 +87,186 @@ func (eng *BGPPolicyManager) AddPolicyEngine(bgpPE BGPPolicyEngine) {
 	eng.policyEngines = append(eng.policyEngines, bgpPE)
 }
 
+/*  applyToEngines applies the config change to all the policy engines and returns the
+ *  first error.
+ */
+func (eng *BGPPolicyManager) applyToEngines(op string, name string, applyFunc func(BGPPolicyEngine) error) error {
+	eng.logger.Info("BGPPolicyEngine -", op, name)
+	var retErr error
+	for _, pe := range eng.policyEngines {
+		if err := applyFunc(pe); err != nil {
+			eng.logger.Err("BGPPolicyEngine -", op, name, "failed with error", err)
+			if retErr == nil {
+				retErr = err
+			}
+		}
+	}
+	return retErr
+}
+
+func (eng *BGPPolicyManager) createPolicyCondition(condCfg utilspolicy.PolicyConditionConfig) error {
+	return eng.applyToEngines("create condition", condCfg.Name, func(pe BGPPolicyEngine) error {
+		_, err := pe.CreatePolicyCondition(condCfg)
+		return err
+	})
+}
+
+func (eng *BGPPolicyManager) createBGPPolicyCondition(condCfg config.BGPPolicyCondition) error {
+	return eng.applyToEngines("create BGP condition", condCfg.Name, func(pe BGPPolicyEngine) error {
+		_, err := pe.CreateBGPPolicyCondition(condCfg)
+		return err
+	})
+}
+
+func (eng *BGPPolicyManager) createASPathList(listCfg config.ASPathList) error {
+	return eng.applyToEngines("create AS path list", listCfg.Name, func(pe BGPPolicyEngine) error {
+		return pe.CreateASPathList(listCfg)
+	})
+}
+
+func (eng *BGPPolicyManager) deleteASPathList(listName string) error {
+	return eng.applyToEngines("delete AS path list", listName, func(pe BGPPolicyEngine) error {
+		return pe.DeleteASPathList(listName)
+	})
+}
+
+func (eng *BGPPolicyManager) createPolicyAction(actionCfg utilspolicy.PolicyActionConfig) error {
+	return eng.applyToEngines("create action", actionCfg.Name, func(pe BGPPolicyEngine) error {
+		_, err := pe.CreatePolicyAction(actionCfg)
+		return err
+	})
+}
+
+func (eng *BGPPolicyManager) createPolicyStmt(stmtCfg utilspolicy.PolicyStmtConfig) error {
+	return eng.applyToEngines("create statement", stmtCfg.Name, func(pe BGPPolicyEngine) error {
+		return pe.CreatePolicyStmt(stmtCfg)
+	})
+}
+
+func (eng *BGPPolicyManager) createPolicyDefinition(defCfg utilspolicy.PolicyDefinitionConfig) error {
+	return eng.applyToEngines("create policy", defCfg.Name, func(pe BGPPolicyEngine) error {
+		return pe.CreatePolicyDefinition(defCfg)
+	})
+}
+
+func (eng *BGPPolicyManager) deletePolicyCondition(conditionName string) error {
+	return eng.applyToEngines("delete condition", conditionName, func(pe BGPPolicyEngine) error {
+		_, err := pe.DeletePolicyCondition(conditionName)
+		return err
+	})
+}
+
+func (eng *BGPPolicyManager) deletePolicyAction(actionName string) error {
+	return eng.applyToEngines("delete action", actionName, func(pe BGPPolicyEngine) error {
+		_, err := pe.DeletePolicyAction(actionName)
+		return err
+	})
+}
+
+func (eng *BGPPolicyManager) deletePolicyStmt(stmtName string) error {
+	return eng.applyToEngines("delete statement", stmtName, func(pe BGPPolicyEngine) error {
+		return pe.DeletePolicyStmt(stmtName)
+	})
+}
+
+func (eng *BGPPolicyManager) deletePolicyDefinition(policyName string) error {
+	return eng.applyToEngines("delete policy", policyName, func(pe BGPPolicyEngine) error {
+		return pe.DeletePolicyDefinition(policyName)
+	})
+}
+
+/*  sendCfgReq applies the config change on the policy manager goroutine and waits for
+ *  the result. It is used by the config handlers that report the error to the caller.
+ */
+func (eng *BGPPolicyManager) sendCfgReq(applyFunc func() error) error {
+	errCh := make(chan error)
+	eng.cfgReqCh <- policyCfgReq{applyFunc: applyFunc, errCh: errCh}
+	return <-errCh
+}
+
+func (eng *BGPPolicyManager) CreatePolicyCondition(condCfg utilspolicy.PolicyConditionConfig) error {
+	return eng.sendCfgReq(func() error { return eng.createPolicyCondition(condCfg) })
+}
+
+func (eng *BGPPolicyManager) CreateBGPPolicyCondition(condCfg config.BGPPolicyCondition) error {
+	return eng.sendCfgReq(func() error { return eng.createBGPPolicyCondition(condCfg) })
+}
+
+func (eng *BGPPolicyManager) CreateASPathList(listCfg config.ASPathList) error {
+	return eng.sendCfgReq(func() error { return eng.createASPathList(listCfg) })
+}
+
+func (eng *BGPPolicyManager) DeleteASPathList(listName string) error {
+	return eng.sendCfgReq(func() error { return eng.deleteASPathList(listName) })
+}
+
+func (eng *BGPPolicyManager) CreatePolicyAction(actionCfg utilspolicy.PolicyActionConfig) error {
+	return eng.sendCfgReq(func() error { return eng.createPolicyAction(actionCfg) })
+}
+
+func (eng *BGPPolicyManager) CreatePolicyStmt(stmtCfg utilspolicy.PolicyStmtConfig) error {
+	return eng.sendCfgReq(func() error { return eng.createPolicyStmt(stmtCfg) })
+}
+
+func (eng *BGPPolicyManager) CreatePolicyDefinition(defCfg utilspolicy.PolicyDefinitionConfig) error {
+	return eng.sendCfgReq(func() error { return eng.createPolicyDefinition(defCfg) })
+}
+
+func (eng *BGPPolicyManager) DeletePolicyCondition(conditionName string) error {
+	return eng.sendCfgReq(func() error { return eng.deletePolicyCondition(conditionName) })
+}
+
+func (eng *BGPPolicyManager) DeletePolicyAction(actionName string) error {
+	return eng.sendCfgReq(func() error { return eng.deletePolicyAction(actionName) })
+}
+
+func (eng *BGPPolicyManager) DeletePolicyStmt(stmtName string) error {
+	return eng.sendCfgReq(func() error { return eng.deletePolicyStmt(stmtName) })
+}
+
+func (eng *BGPPolicyManager) DeletePolicyDefinition(policyName string) error {
+	return eng.sendCfgReq(func() error { return eng.deletePolicyDefinition(policyName) })
+}
+
 func (eng *BGPPolicyManager) StartPolicyEngine() {
 	eng.policyPlugin.Start()
 	for {
 		select {
+		case req := <-eng.cfgReqCh:
+			req.errCh <- req.applyFunc()
+
 		case condCfg := <-eng.ConditionCfgCh:
-			eng.logger.Info("BGPPolicyEngine - create condition", condCfg.Name)
-			for _, pe := range eng.policyEngines {
-				pe.CreatePolicyCondition(condCfg)
-			}
+			eng.createPolicyCondition(condCfg)
+
+		case condCfg := <-eng.BGPCondCfgCh:
+			eng.createBGPPolicyCondition(condCfg)
+
+		case listCfg := <-eng.ASPathListCfgCh:
+			eng.createASPathList(listCfg)
+
+		case listName := <-eng.ASPathListDelCh:
+			eng.deleteASPathList(listName)
 
 		case actionCfg := <-eng.ActionCfgCh:
-			eng.logger.Info("BGPPolicyEngine - create action", actionCfg.Name)
-			for _, pe := range eng.policyEngines {
-				pe.CreatePolicyAction(actionCfg)
-			}
+			eng.createPolicyAction(actionCfg)
 
 		case stmtCfg := <-eng.StmtCfgCh:
-			eng.logger.Info("BGPPolicyEngine - create statement", stmtCfg.Name)
-			for _, pe := range eng.policyEngines {
-				pe.CreatePolicyStmt(stmtCfg)
-			}
+			eng.createPolicyStmt(stmtCfg)
 
 		case defCfg := <-eng.DefinitionCfgCh:
-			eng.logger.Info("BGPPolicyEngine - create policy", defCfg.Name)
-			for _, pe := range eng.policyEngines {
-				pe.CreatePolicyDefinition(defCfg)
-			}
+			eng.createPolicyDefinition(defCfg)
 
 		case conditionName := <-eng.ConditionDelCh:
-			eng.logger.Info("BGPPolicyEngine - delete condition", conditionName)
-			for _, pe := range eng.policyEngines {
-				pe.DeletePolicyCondition(conditionName)
-			}
+			eng.deletePolicyCondition(conditionName)
 
 		case actionName := <-eng.ActionDelCh:
-			eng.logger.Info("BGPPolicyEngine - delete action", actionName)
-			for _, pe := range eng.policyEngines {
-				pe.DeletePolicyAction(actionName)
-			}
+			eng.deletePolicyAction(actionName)
 
 		case stmtName := <-eng.StmtDelCh:
-			eng.logger.Info("BGPPolicyEngine - delete statment", stmtName)
-			for _, pe := range eng.policyEngines {
-				pe.DeletePolicyStmt(stmtName)
-			}
+			eng.deletePolicyStmt(stmtName)
 
 		case policyName := <-eng.DefinitionDelCh:
-			eng.logger.Info("BGPPolicyEngine - delete statment", policyName)
-			for _, pe := range eng.policyEngines {
-				pe.DeletePolicyDefinition(policyName)
-			}
+			eng.deletePolicyDefinition(policyName)
 		}
 	}
 }
@@ -63,6 +63,10 @@ type Destination struct {
 	BGPRouteState     *bgpd.BGPRouteState
 	PathInfoRouteMap  map[*bgpd.PathInfo]*Route
 	routeListIdx      int
+	backupPath        *Path
+	activeBackupPath  *Path
+	failedPath        *Path
+	unreachableRoutes map[*Path]*ReachabilityInfo
 }
 
 func NewDestination(rib *LocRib, nlri packet.NLRI, protoFamily uint32, gConf *config.GlobalConfig) *Destination {
@@ -238,6 +242,7 @@ func (d *Destination) AddOrUpdatePath(peerIp string, pathId uint32, path *Path)
 		if d.LocRibPath == oldPath {
 			d.LocRibPath = nil
 		}
+		d.indexPathNextHop(oldPath, false)
 	} else {
 		d.logger.Infof("Destination %s New path from %s, id %d", d.NLRI.GetPrefix(), peerIp, pathId)
 		added = true
@@ -260,6 +265,7 @@ func (d *Destination) AddOrUpdatePath(peerIp string, pathId uint32, path *Path)
 	d.PathInfoRouteMap[route.PathInfo] = route
 	route.setIdx(idx)
 	d.peerPathMap[peerIp][pathId] = path
+	d.indexPathNextHop(path, true)
 	return added
 }
 
@@ -279,6 +285,12 @@ func (d *Destination) RemovePath(peerIP string, pathId uint32, path *Path) *Path
 			}
 		}
 
+		for _, addPath := range d.AddPaths {
+			if addPath == oldPath {
+				d.recalculate = true
+			}
+		}
+
 		if d.LocRibPath == oldPath {
 			d.recalculate = true
 			d.LocRibPath = nil
@@ -304,6 +316,7 @@ func (d *Destination) RemovePath(peerIP string, pathId uint32, path *Path) *Path
 		if len(d.peerPathMap[peerIP]) == 0 {
 			delete(d.peerPathMap, peerIP)
 		}
+		d.indexPathNextHop(oldPath, false)
 	} else {
 		d.logger.Err("Destination", d.NLRI.GetPrefix().String(), "Path with path id", pathId,
 			"not found from peer", peerIP)
@@ -326,10 +339,28 @@ func (d *Destination) RemoveAllPaths(peerIP string, path *Path) {
 	}
 }
 
+/*
+ * RecalculatePathPrefs recalculates the preference of the paths received from the peer. It returns true if the
+ * destination has any path from the peer and needs to select the best path again.
+ */
+func (d *Destination) RecalculatePathPrefs(peerIP string) bool {
+	pathMap, ok := d.peerPathMap[peerIP]
+	if !ok || len(pathMap) == 0 {
+		return false
+	}
+
+	for _, path := range pathMap {
+		path.RecalculatePref()
+	}
+	d.recalculate = true
+	return true
+}
+
 func (d *Destination) RemoveAllNeighborPaths() {
 	for peerIP, pathMap := range d.peerPathMap {
 		for pathId, path := range pathMap {
 			if path.NeighborConf != nil {
+				d.indexPathNextHop(path, false)
 				delete(d.peerPathMap[peerIP], pathId)
 				if len(d.peerPathMap[peerIP]) == 0 {
 					delete(d.peerPathMap, peerIP)
@@ -412,7 +443,9 @@ func (d *Destination) SelectRouteForLocRib(addPathCount int) (RouteAction, bool,
 	}
 	d.recalculate = false
 
-	if d.LocRibPath != nil {
+	// With PIC the loc rib path is not a candidate once its NEXT_HOP is not reachable
+	if d.LocRibPath != nil && (d.LocRibPath.NeighborConf == nil || !d.isPICEnabled() ||
+		d.LocRibPath.IsReachable(d.protoFamily)) {
 		var peerIP string
 		if d.LocRibPath.NeighborConf != nil {
 			peerIP = d.LocRibPath.NeighborConf.Neighbor.NeighborAddress.String()
@@ -555,7 +588,7 @@ func (d *Destination) SelectRouteForLocRib(addPathCount int) (RouteAction, bool,
 				route.ResetMultiPath()
 				route.ResetBestPath()
 				if path.IsAggregate() || !path.IsLocal() {
-					reachInfo := path.GetReachability(d.protoFamily)
+					reachInfo := d.getInstalledReachability(path)
 					d.logger.Infof("Remove route for ip=%s nexthop=%s\n", d.NLRI.GetPrefix().String(),
 						reachInfo.NextHop)
 					protocol := "IBGP"
@@ -572,20 +605,25 @@ func (d *Destination) SelectRouteForLocRib(addPathCount int) (RouteAction, bool,
 						IsIPv6:            isIPv6,
 					}
 					//d.rib.routeMgr.DeleteRoute(&cfg)
-					d.rib.routeMgr.UpdateRoute(&cfg, "remove")
+					if path != d.failedPath {
+						d.rib.routeMgr.UpdateRoute(&cfg, "remove")
+					}
 					d.logger.Infof("DeleteV4Route for ip=%s nexthop=%s DONE\n", d.NLRI.GetPrefix().String(),
 						reachInfo.NextHop)
 				}
 			}
 			locRibAction = RouteActionDelete
 			d.LocRibPath = nil
+		} else if len(d.ecmpPaths) > 0 {
+			// RemovePath already reset the Loc-RIB path, the installed routes are removed below
+			locRibAction = RouteActionDelete
 		}
 	}
 
 	for path, route := range d.ecmpPaths {
 		if route.action == RouteActionNone || route.action == RouteActionDelete {
 			if path.IsAggregate() || !path.IsLocal() {
-				reachInfo := path.GetReachability(d.protoFamily)
+				reachInfo := d.getInstalledReachability(path)
 				d.logger.Info("Remove route from ECMP paths, route =", route, "ip =",
 					d.NLRI.GetPrefix().String(), "next hop =", reachInfo.NextHop)
 				protocol := "IBGP"
@@ -602,7 +640,9 @@ func (d *Destination) SelectRouteForLocRib(addPathCount int) (RouteAction, bool,
 					IsIPv6:            isIPv6,
 				}
 				//d.rib.routeMgr.DeleteRoute(&cfg)
-				d.rib.routeMgr.UpdateRoute(&cfg, "remove")
+				if path != d.failedPath {
+					d.rib.routeMgr.UpdateRoute(&cfg, "remove")
+				}
 				d.logger.Info("DeleteV4Route from ECMP paths, route =", route, "ip =",
 					d.NLRI.GetPrefix().String(), "next hop =", reachInfo.NextHop, "DONE")
 			}
@@ -615,7 +655,15 @@ func (d *Destination) SelectRouteForLocRib(addPathCount int) (RouteAction, bool,
 		}
 	}
 
+	firstRoute = d.reconcileActiveBackupPath(createRibRoutes, firstRoute)
+	primaryInstalled := false
 	for _, path := range createRibRoutes {
+		if path == d.LocRibPath {
+			primaryInstalled = true
+		}
+		if path == d.activeBackupPath {
+			continue
+		}
 		reachInfo := path.GetReachability(d.protoFamily)
 		d.logger.Infof("Add route for ip=%s, mask=%s, next hop=%s\n", d.NLRI.GetPrefix().String(),
 			d.constructNetmaskFromLen(int(d.NLRI.GetLength()), ipLength*8).String(), reachInfo.NextHop)
@@ -640,9 +688,56 @@ func (d *Destination) SelectRouteForLocRib(addPathCount int) (RouteAction, bool,
 			d.rib.routeMgr.UpdateRoute(&cfg, "add")
 		}
 	}
+	d.activeBackupPath = nil
+	d.failedPath = nil
+	d.unreachableRoutes = nil
+	d.updateBackupPath(primaryInstalled)
 	return locRibAction, addPathsUpdated, addedRoutes, updatedRoutes, deletedRoutes
 }
 
+/*
+ * SelectRouteForView runs the best path selection on the paths of the destination that are accepted by
+ * isEligible. Unlike SelectRouteForLocRib it does not install any route or modify the destination.
+ */
+func (d *Destination) SelectRouteForView(isEligible func(*Path) bool) *Path {
+	eligiblePaths := d.getEligiblePaths(isEligible)
+	if len(eligiblePaths) == 0 {
+		return nil
+	}
+
+	if len(eligiblePaths) > 1 {
+		eligiblePaths, _, _ = d.calculateBestPath(eligiblePaths, make([]*Path, 0), false, false, 0)
+	}
+	return eligiblePaths[0]
+}
+
+/*
+ * getEligiblePaths returns the valid paths of the destination that are accepted by isEligible. Only the paths
+ * from the most preferred route source are returned.
+ */
+func (d *Destination) getEligiblePaths(isEligible func(*Path) bool) []*Path {
+	eligiblePaths := make([]*Path, 0)
+	routeSrc := RouteSrcUnknown
+
+	for _, pathMap := range d.peerPathMap {
+		for _, path := range pathMap {
+			if !path.IsReachable(d.protoFamily) || path.HasASLoop() || !isEligible(path) {
+				continue
+			}
+
+			currPathSource := getRouteSource(path.routeType)
+			if currPathSource > routeSrc {
+				continue
+			} else if currPathSource < routeSrc {
+				eligiblePaths = eligiblePaths[:0]
+				routeSrc = currPathSource
+			}
+			eligiblePaths = append(eligiblePaths, path)
+		}
+	}
+	return eligiblePaths
+}
+
 func (d *Destination) getRoutesWithHighestPref(updatedPaths []*Path, prunedPaths []PathSortIface) ([]*Path,
 	[]PathSortIface) {
 	maxPref := uint32(0)
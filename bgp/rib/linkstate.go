@@ -0,0 +1,394 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// linkstate.go
+package rib
+
+import (
+	"encoding/binary"
+	"l3/bgp/config"
+	"l3/bgp/packet"
+	"net"
+	"utils/logging"
+)
+
+const (
+	LsaTypeRouter uint8 = iota + 1
+	LsaTypeNetwork
+)
+
+const (
+	LsaLinkTypeP2P uint8 = iota + 1
+	LsaLinkTypeTransit
+	LsaLinkTypeStub
+	LsaLinkTypeVirtual
+)
+
+type lsaKey struct {
+	LSType    uint8
+	LSId      uint32
+	AdvRouter uint32
+}
+
+/*  Network LSAs are identified in the transit links of the router LSAs by the interface address of the DR
+ */
+type networkKey struct {
+	AreaId   uint32
+	DRIfAddr uint32
+}
+
+type LinkStateRoute struct {
+	NLRI *packet.BGPLSNLRI
+	Attr *packet.BGPPathAttrLinkState
+}
+
+func NewLinkStateRoute(nlri *packet.BGPLSNLRI, attr *packet.BGPPathAttrLinkState) *LinkStateRoute {
+	return &LinkStateRoute{
+		NLRI: nlri,
+		Attr: attr,
+	}
+}
+
+/*  Link state rib holds the BGP-LS routes that mirror the link state database of the IGP.
+ *  Routes are kept per LSA and only the routes of the LSAs that are added, updated or removed are recomputed.
+ *  The routes of a router LSA with a transit link depend on the network LSA of the link and are recomputed
+ *  when that network LSA changes.
+ */
+type LinkStateRib struct {
+	logger         *logging.Writer
+	gConf          *config.GlobalConfig
+	Path           *Path
+	areaLsas       map[uint32]map[lsaKey]*config.LinkStateLsa
+	lsaRoutes      map[uint32]map[lsaKey]map[string]*LinkStateRoute
+	networkLsas    map[networkKey]*config.LinkStateLsa
+	transitRouters map[networkKey]map[lsaKey]bool
+}
+
+func NewLinkStateRib(locRib *LocRib) *LinkStateRib {
+	pathAttrs := packet.ConstructPathAttrForLinkState()
+	return &LinkStateRib{
+		logger:         locRib.logger,
+		gConf:          locRib.gConf,
+		Path:           NewPath(locRib, nil, pathAttrs, nil, RouteTypeIGP),
+		areaLsas:       make(map[uint32]map[lsaKey]*config.LinkStateLsa),
+		lsaRoutes:      make(map[uint32]map[lsaKey]map[string]*LinkStateRoute),
+		networkLsas:    make(map[networkKey]*config.LinkStateLsa),
+		transitRouters: make(map[networkKey]map[lsaKey]bool),
+	}
+}
+
+func getLsaKey(lsa *config.LinkStateLsa) lsaKey {
+	return lsaKey{lsa.LSType, lsa.LSId, lsa.AdvRouter}
+}
+
+func uint32ToIP(val uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, val)
+	return ip
+}
+
+func maskLen(mask uint32) uint8 {
+	ones, _ := net.IPMask(uint32ToIP(mask)).Size()
+	return uint8(ones)
+}
+
+func newIGPMetricTLV(metric uint16) packet.BGPLSTLV {
+	value := make([]byte, 2)
+	binary.BigEndian.PutUint16(value, metric)
+	return packet.NewBGPLSTLV(packet.BGPLSTLVIGPMetric, value)
+}
+
+func (l *LinkStateRib) nodeDescriptor(areaId uint32, routerId []byte) *packet.BGPLSNodeDescriptor {
+	return packet.NewBGPLSNodeDescriptor(l.gConf.AS, 0, areaId, routerId)
+}
+
+func (l *LinkStateRib) addRoute(routes map[string]*LinkStateRoute, nlri *packet.BGPLSNLRI,
+	attr *packet.BGPPathAttrLinkState) {
+	routes[nlri.String()] = NewLinkStateRoute(nlri, attr)
+}
+
+func (l *LinkStateRib) findNetworkLsa(areaId uint32, drIfAddr uint32) *config.LinkStateLsa {
+	return l.networkLsas[networkKey{areaId, drIfAddr}]
+}
+
+/*  setTransitLinks adds or removes the router LSA as a dependent of the network LSAs of its transit links
+ */
+func (l *LinkStateRib) setTransitLinks(lsa *config.LinkStateLsa, add bool) {
+	key := getLsaKey(lsa)
+	for _, link := range lsa.Links {
+		if link.LinkType != LsaLinkTypeTransit {
+			continue
+		}
+		nKey := networkKey{lsa.AreaId, link.LinkId}
+		if add {
+			if _, ok := l.transitRouters[nKey]; !ok {
+				l.transitRouters[nKey] = make(map[lsaKey]bool)
+			}
+			l.transitRouters[nKey][key] = true
+		} else if routers, ok := l.transitRouters[nKey]; ok {
+			delete(routers, key)
+			if len(routers) == 0 {
+				delete(l.transitRouters, nKey)
+			}
+		}
+	}
+}
+
+/*  removeLsa removes the LSA from the rib and marks the LSAs whose routes need to be recomputed as dirty
+ */
+func (l *LinkStateRib) removeLsa(lsa *config.LinkStateLsa, dirty map[uint32]map[lsaKey]bool) {
+	key := getLsaKey(lsa)
+	old, ok := l.areaLsas[lsa.AreaId][key]
+	if !ok {
+		return
+	}
+
+	delete(l.areaLsas[lsa.AreaId], key)
+	if len(l.areaLsas[lsa.AreaId]) == 0 {
+		delete(l.areaLsas, lsa.AreaId)
+	}
+	l.indexLsa(old, false, dirty)
+}
+
+func (l *LinkStateRib) addLsa(lsa *config.LinkStateLsa, dirty map[uint32]map[lsaKey]bool) {
+	key := getLsaKey(lsa)
+	if old, ok := l.areaLsas[lsa.AreaId][key]; ok {
+		l.indexLsa(old, false, dirty)
+	}
+
+	if _, ok := l.areaLsas[lsa.AreaId]; !ok {
+		l.areaLsas[lsa.AreaId] = make(map[lsaKey]*config.LinkStateLsa)
+	}
+	l.areaLsas[lsa.AreaId][key] = lsa
+	l.indexLsa(lsa, true, dirty)
+}
+
+/*  indexLsa adds or removes the LSA from the network LSA and transit link indexes and marks the LSA and the
+ *  router LSAs that depend on it as dirty
+ */
+func (l *LinkStateRib) indexLsa(lsa *config.LinkStateLsa, add bool, dirty map[uint32]map[lsaKey]bool) {
+	if _, ok := dirty[lsa.AreaId]; !ok {
+		dirty[lsa.AreaId] = make(map[lsaKey]bool)
+	}
+	dirty[lsa.AreaId][getLsaKey(lsa)] = true
+
+	switch lsa.LSType {
+	case LsaTypeRouter:
+		l.setTransitLinks(lsa, add)
+
+	case LsaTypeNetwork:
+		nKey := networkKey{lsa.AreaId, lsa.LSId}
+		if add {
+			l.networkLsas[nKey] = lsa
+		} else if l.networkLsas[nKey] == lsa {
+			delete(l.networkLsas, nKey)
+		}
+		for key := range l.transitRouters[nKey] {
+			dirty[lsa.AreaId][key] = true
+		}
+	}
+}
+
+func (l *LinkStateRib) addRouterLsaRoutes(routes map[string]*LinkStateRoute, lsa *config.LinkStateLsa) {
+	routerId := uint32ToIP(lsa.AdvRouter)
+	localNode := l.nodeDescriptor(lsa.AreaId, routerId)
+
+	var flags uint8
+	if lsa.BitE {
+		flags |= packet.BGPLSNodeFlagExternal
+	}
+	if lsa.BitB {
+		flags |= packet.BGPLSNodeFlagABR
+	}
+	nodeAttr := packet.NewBGPPathAttrLinkState()
+	nodeAttr.AddTLV(packet.NewBGPLSTLV(packet.BGPLSTLVNodeFlagBits, []byte{flags}))
+	nodeAttr.AddTLV(packet.NewBGPLSTLV(packet.BGPLSTLVLocalRouterId, routerId))
+	l.addRoute(routes, packet.NewBGPLSNodeNLRI(packet.BGPLSProtocolOSPFv2, 0, localNode), nodeAttr)
+
+	for _, link := range lsa.Links {
+		switch link.LinkType {
+		case LsaLinkTypeP2P:
+			remoteId := uint32ToIP(link.LinkId)
+			remoteNode := l.nodeDescriptor(lsa.AreaId, remoteId)
+			nlri := packet.NewBGPLSLinkNLRI(packet.BGPLSProtocolOSPFv2, 0, localNode, remoteNode,
+				uint32ToIP(link.LinkData), nil, 0, 0)
+			attr := packet.NewBGPPathAttrLinkState()
+			attr.AddTLV(packet.NewBGPLSTLV(packet.BGPLSTLVLocalRouterId, routerId))
+			attr.AddTLV(packet.NewBGPLSTLV(packet.BGPLSTLVRemoteRouterId, remoteId))
+			attr.AddTLV(newIGPMetricTLV(link.Metric))
+			l.addRoute(routes, nlri, attr)
+
+		case LsaLinkTypeTransit:
+			networkLsa := l.findNetworkLsa(lsa.AreaId, link.LinkId)
+			if networkLsa == nil {
+				l.logger.Info("LinkStateRib: network LSA not found for transit link", uint32ToIP(link.LinkId),
+					"of router", routerId, "area", lsa.AreaId)
+				continue
+			}
+			pseudonode := l.nodeDescriptor(lsa.AreaId,
+				packet.GetBGPLSPseudonodeRouterId(uint32ToIP(networkLsa.AdvRouter), uint32ToIP(link.LinkId)))
+			nlri := packet.NewBGPLSLinkNLRI(packet.BGPLSProtocolOSPFv2, 0, localNode, pseudonode,
+				uint32ToIP(link.LinkData), nil, 0, 0)
+			attr := packet.NewBGPPathAttrLinkState()
+			attr.AddTLV(packet.NewBGPLSTLV(packet.BGPLSTLVLocalRouterId, routerId))
+			attr.AddTLV(newIGPMetricTLV(link.Metric))
+			l.addRoute(routes, nlri, attr)
+
+		case LsaLinkTypeStub:
+			prefix := packet.NewIPPrefix(uint32ToIP(link.LinkId&link.LinkData), maskLen(link.LinkData))
+			nlri := packet.NewBGPLSPrefixNLRI(packet.BGPLSProtocolOSPFv2, 0, localNode,
+				packet.BGPLSOSPFRouteTypeIntraArea, prefix)
+			attr := packet.NewBGPPathAttrLinkState()
+			attr.AddTLV(packet.NewBGPLSUint32TLV(packet.BGPLSTLVPrefixMetric, uint32(link.Metric)))
+			l.addRoute(routes, nlri, attr)
+		}
+	}
+}
+
+func (l *LinkStateRib) addNetworkLsaRoutes(routes map[string]*LinkStateRoute, lsa *config.LinkStateLsa) {
+	drRouterId := uint32ToIP(lsa.AdvRouter)
+	pseudonode := l.nodeDescriptor(lsa.AreaId,
+		packet.GetBGPLSPseudonodeRouterId(drRouterId, uint32ToIP(lsa.LSId)))
+
+	nodeAttr := packet.NewBGPPathAttrLinkState()
+	nodeAttr.AddTLV(packet.NewBGPLSTLV(packet.BGPLSTLVLocalRouterId, drRouterId))
+	l.addRoute(routes, packet.NewBGPLSNodeNLRI(packet.BGPLSProtocolOSPFv2, 0, pseudonode), nodeAttr)
+
+	// Links from the pseudonode to the attached routers have a metric of 0
+	for _, rtr := range lsa.AttachedRtr {
+		remoteId := uint32ToIP(rtr)
+		remoteNode := l.nodeDescriptor(lsa.AreaId, remoteId)
+		nlri := packet.NewBGPLSLinkNLRI(packet.BGPLSProtocolOSPFv2, 0, pseudonode, remoteNode, nil, nil, 0, 0)
+		attr := packet.NewBGPPathAttrLinkState()
+		attr.AddTLV(packet.NewBGPLSTLV(packet.BGPLSTLVRemoteRouterId, remoteId))
+		attr.AddTLV(newIGPMetricTLV(0))
+		l.addRoute(routes, nlri, attr)
+	}
+
+	prefix := packet.NewIPPrefix(uint32ToIP(lsa.LSId&lsa.Netmask), maskLen(lsa.Netmask))
+	nlri := packet.NewBGPLSPrefixNLRI(packet.BGPLSProtocolOSPFv2, 0, pseudonode,
+		packet.BGPLSOSPFRouteTypeIntraArea, prefix)
+	attr := packet.NewBGPPathAttrLinkState()
+	attr.AddTLV(packet.NewBGPLSUint32TLV(packet.BGPLSTLVPrefixMetric, 0))
+	l.addRoute(routes, nlri, attr)
+}
+
+func (l *LinkStateRib) computeLsaRoutes(areaId uint32, key lsaKey) map[string]*LinkStateRoute {
+	routes := make(map[string]*LinkStateRoute)
+	lsa, ok := l.areaLsas[areaId][key]
+	if !ok {
+		return routes
+	}
+
+	if lsa.LSType == LsaTypeRouter {
+		l.addRouterLsaRoutes(routes, lsa)
+	} else if lsa.LSType == LsaTypeNetwork {
+		l.addNetworkLsaRoutes(routes, lsa)
+	}
+	return routes
+}
+
+/*  ProcessLsaUpdates returns the routes updated and withdrawn and the areas with LSAs that changed.
+ */
+func (l *LinkStateRib) ProcessLsaUpdates(add, remove []*config.LinkStateLsa) ([]*LinkStateRoute,
+	[]*LinkStateRoute, map[uint32]bool) {
+	updated := make([]*LinkStateRoute, 0)
+	withdrawn := make([]*LinkStateRoute, 0)
+	areas := make(map[uint32]bool)
+
+	dirty := make(map[uint32]map[lsaKey]bool)
+	for _, lsa := range remove {
+		l.removeLsa(lsa, dirty)
+	}
+
+	for _, lsa := range add {
+		l.addLsa(lsa, dirty)
+	}
+
+	for areaId, keys := range dirty {
+		areas[areaId] = true
+		for key := range keys {
+			oldRoutes := l.lsaRoutes[areaId][key]
+			newRoutes := l.computeLsaRoutes(areaId, key)
+			for nlriKey, route := range newRoutes {
+				if oldRoute, ok := oldRoutes[nlriKey]; !ok || oldRoute.Attr.String() != route.Attr.String() {
+					updated = append(updated, route)
+				}
+			}
+			for nlriKey, route := range oldRoutes {
+				if _, ok := newRoutes[nlriKey]; !ok {
+					withdrawn = append(withdrawn, route)
+				}
+			}
+
+			if len(newRoutes) == 0 {
+				delete(l.lsaRoutes[areaId], key)
+			} else {
+				if _, ok := l.lsaRoutes[areaId]; !ok {
+					l.lsaRoutes[areaId] = make(map[lsaKey]map[string]*LinkStateRoute)
+				}
+				l.lsaRoutes[areaId][key] = newRoutes
+			}
+		}
+		if len(l.lsaRoutes[areaId]) == 0 {
+			delete(l.lsaRoutes, areaId)
+		}
+	}
+
+	l.logger.Info("LinkStateRib: processed LSA updates, updated", len(updated), "withdrawn", len(withdrawn))
+	return updated, withdrawn, areas
+}
+
+/*  GetStaleLsas returns the LSAs in the rib that are not in the full link state database sent by the IGP.
+ */
+func (l *LinkStateRib) GetStaleLsas(lsas []*config.LinkStateLsa) []*config.LinkStateLsa {
+	current := make(map[uint32]map[lsaKey]bool)
+	for _, lsa := range lsas {
+		if _, ok := current[lsa.AreaId]; !ok {
+			current[lsa.AreaId] = make(map[lsaKey]bool)
+		}
+		current[lsa.AreaId][lsaKey{lsa.LSType, lsa.LSId, lsa.AdvRouter}] = true
+	}
+
+	stale := make([]*config.LinkStateLsa, 0)
+	for areaId, areaLsas := range l.areaLsas {
+		for key, lsa := range areaLsas {
+			if !current[areaId][key] {
+				stale = append(stale, lsa)
+			}
+		}
+	}
+	return stale
+}
+
+func (l *LinkStateRib) GetRoutes() []*LinkStateRoute {
+	routes := make([]*LinkStateRoute, 0)
+	for _, areaRoutes := range l.lsaRoutes {
+		for _, lsaRoutes := range areaRoutes {
+			for _, route := range lsaRoutes {
+				routes = append(routes, route)
+			}
+		}
+	}
+	return routes
+}
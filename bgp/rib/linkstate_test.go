@@ -0,0 +1,173 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// linkstate_test.go
+package rib
+
+import (
+	"l3/bgp/config"
+	"l3/bgp/packet"
+	"l3/bgp/utils"
+	"testing"
+	"utils/logging"
+)
+
+const (
+	testRtr1    uint32 = 0x01010101
+	testRtr2    uint32 = 0x02020202
+	testRtr3    uint32 = 0x03030303
+	testDRAddr  uint32 = 0x0a000002
+	testNetmask uint32 = 0xffffff00
+)
+
+func newTestLinkStateRib(t *testing.T) *LinkStateRib {
+	logger, err := logging.NewLogger("bgpd", "BGP", true)
+	if err != nil {
+		t.Fatal("Failed to start the logger. Exiting!!")
+	}
+	utils.SetLogger(logger)
+	locRib := NewLocRib(logger, nil, nil, &config.GlobalConfig{AS: 65001})
+	return NewLinkStateRib(locRib)
+}
+
+func newTestRouterLsa(areaId uint32, routerId uint32, links []config.LinkStateLink) *config.LinkStateLsa {
+	return &config.LinkStateLsa{
+		AreaId:    areaId,
+		LSType:    LsaTypeRouter,
+		LSId:      routerId,
+		AdvRouter: routerId,
+		Links:     links,
+	}
+}
+
+func newTestNetworkLsa(areaId uint32, attached []uint32) *config.LinkStateLsa {
+	return &config.LinkStateLsa{
+		AreaId:      areaId,
+		LSType:      LsaTypeNetwork,
+		LSId:        testDRAddr,
+		AdvRouter:   testRtr2,
+		Netmask:     testNetmask,
+		AttachedRtr: attached,
+	}
+}
+
+func countRoutes(routes []*LinkStateRoute) map[uint16]int {
+	count := make(map[uint16]int)
+	for _, route := range routes {
+		count[route.NLRI.Type]++
+	}
+	return count
+}
+
+func checkRoutes(t *testing.T, step string, routes []*LinkStateRoute, nodes, links, prefixes int) {
+	count := countRoutes(routes)
+	if len(routes) != nodes+links+prefixes || count[packet.BGPLSNLRITypeNode] != nodes ||
+		count[packet.BGPLSNLRITypeLink] != links || count[packet.BGPLSNLRITypeIPv4Prefix] != prefixes {
+		t.Errorf("%s: got routes %v, expected %d nodes, %d links, %d prefixes", step, count, nodes, links,
+			prefixes)
+	}
+}
+
+func TestLinkStateRibProcessLsaUpdates(t *testing.T) {
+	l := newTestLinkStateRib(t)
+
+	rtr1 := newTestRouterLsa(0, testRtr1, []config.LinkStateLink{
+		{LinkId: testRtr3, LinkData: 0x0b000001, LinkType: LsaLinkTypeP2P, Metric: 10},
+		{LinkId: 0x0c000000, LinkData: testNetmask, LinkType: LsaLinkTypeStub, Metric: 1},
+	})
+	updated, withdrawn, areas := l.ProcessLsaUpdates([]*config.LinkStateLsa{rtr1}, nil)
+	checkRoutes(t, "Add router LSA", updated, 1, 1, 1)
+	checkRoutes(t, "Add router LSA withdrawn", withdrawn, 0, 0, 0)
+	if len(areas) != 1 || !areas[0] {
+		t.Error("Add router LSA: wrong areas", areas)
+	}
+
+	// The transit link is added once the network LSA of the DR is known
+	rtr2 := newTestRouterLsa(0, testRtr2, []config.LinkStateLink{
+		{LinkId: testDRAddr, LinkData: testDRAddr, LinkType: LsaLinkTypeTransit, Metric: 5},
+	})
+	updated, withdrawn, _ = l.ProcessLsaUpdates([]*config.LinkStateLsa{rtr2}, nil)
+	checkRoutes(t, "Add router LSA with transit link", updated, 1, 0, 0)
+	checkRoutes(t, "Add router LSA with transit link withdrawn", withdrawn, 0, 0, 0)
+
+	network := newTestNetworkLsa(0, []uint32{testRtr1, testRtr2})
+	updated, withdrawn, _ = l.ProcessLsaUpdates([]*config.LinkStateLsa{network}, nil)
+	checkRoutes(t, "Add network LSA", updated, 1, 3, 1)
+	checkRoutes(t, "Add network LSA withdrawn", withdrawn, 0, 0, 0)
+
+	// Only the link with the changed metric is updated
+	rtr1 = newTestRouterLsa(0, testRtr1, []config.LinkStateLink{
+		{LinkId: testRtr3, LinkData: 0x0b000001, LinkType: LsaLinkTypeP2P, Metric: 20},
+		{LinkId: 0x0c000000, LinkData: testNetmask, LinkType: LsaLinkTypeStub, Metric: 1},
+	})
+	updated, withdrawn, _ = l.ProcessLsaUpdates([]*config.LinkStateLsa{rtr1}, nil)
+	checkRoutes(t, "Update router LSA", updated, 0, 1, 0)
+	checkRoutes(t, "Update router LSA withdrawn", withdrawn, 0, 0, 0)
+
+	network = newTestNetworkLsa(0, []uint32{testRtr2})
+	updated, withdrawn, _ = l.ProcessLsaUpdates([]*config.LinkStateLsa{network}, nil)
+	checkRoutes(t, "Update network LSA", updated, 0, 0, 0)
+	checkRoutes(t, "Update network LSA withdrawn", withdrawn, 0, 1, 0)
+
+	// The transit link of the router LSA is withdrawn with the network LSA
+	updated, withdrawn, _ = l.ProcessLsaUpdates(nil, []*config.LinkStateLsa{network})
+	checkRoutes(t, "Withdraw network LSA", updated, 0, 0, 0)
+	checkRoutes(t, "Withdraw network LSA withdrawn", withdrawn, 1, 2, 1)
+
+	updated, withdrawn, areas = l.ProcessLsaUpdates(nil, []*config.LinkStateLsa{rtr1})
+	checkRoutes(t, "Withdraw router LSA", updated, 0, 0, 0)
+	checkRoutes(t, "Withdraw router LSA withdrawn", withdrawn, 1, 1, 1)
+	if len(areas) != 1 || !areas[0] {
+		t.Error("Withdraw router LSA: wrong areas", areas)
+	}
+
+	checkRoutes(t, "Remaining routes", l.GetRoutes(), 1, 0, 0)
+
+	updated, withdrawn, areas = l.ProcessLsaUpdates(nil, []*config.LinkStateLsa{rtr1})
+	if len(updated) != 0 || len(withdrawn) != 0 || len(areas) != 0 {
+		t.Error("Withdraw of an unknown LSA changed routes", updated, withdrawn, areas)
+	}
+}
+
+func TestLinkStateRibGetStaleLsas(t *testing.T) {
+	l := newTestLinkStateRib(t)
+	rtr1 := newTestRouterLsa(0, testRtr1, nil)
+	rtr2 := newTestRouterLsa(0, testRtr2, nil)
+	rtr1Area1 := newTestRouterLsa(1, testRtr1, nil)
+	l.ProcessLsaUpdates([]*config.LinkStateLsa{rtr1, rtr2, rtr1Area1}, nil)
+
+	stale := l.GetStaleLsas([]*config.LinkStateLsa{newTestRouterLsa(0, testRtr1, nil),
+		newTestRouterLsa(0, testRtr3, nil)})
+	if len(stale) != 2 {
+		t.Fatal("Expected 2 stale LSAs, got", len(stale))
+	}
+	for _, lsa := range stale {
+		if lsa != rtr2 && lsa != rtr1Area1 {
+			t.Error("Unexpected stale LSA", lsa)
+		}
+	}
+
+	if stale = l.GetStaleLsas([]*config.LinkStateLsa{rtr1, rtr2, rtr1Area1}); len(stale) != 0 {
+		t.Error("Expected no stale LSA, got", stale)
+	}
+}
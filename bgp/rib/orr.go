@@ -0,0 +1,479 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// orr.go
+package rib
+
+import (
+	"encoding/binary"
+	"l3/bgp/config"
+	"math"
+	"net"
+	"utils/logging"
+)
+
+type igpNode struct {
+	network bool
+	id      uint32
+}
+
+type igpEdge struct {
+	node   igpNode
+	metric uint32
+}
+
+type igpPrefix struct {
+	ipNet    *net.IPNet
+	distance uint32
+}
+
+/*
+ * IGPDistances holds the IGP distances from an IGP position to the prefixes of the link state database. The
+ * distances are computed with SPF on the router and network LSAs of the areas the position is in, so only the
+ * intra area prefixes are reachable.
+ */
+type IGPDistances struct {
+	areaPrefixes map[uint32][]igpPrefix
+}
+
+/*
+ * GetDistance returns the IGP distance to the longest prefix that matches ip.
+ */
+func (i *IGPDistances) GetDistance(ip net.IP) (uint32, bool) {
+	found := false
+	bestLen := -1
+	distance := uint32(math.MaxUint32)
+	for _, prefixes := range i.areaPrefixes {
+		for _, prefix := range prefixes {
+			if !prefix.ipNet.Contains(ip) {
+				continue
+			}
+
+			ones, _ := prefix.ipNet.Mask.Size()
+			if ones > bestLen || (ones == bestLen && prefix.distance < distance) {
+				found = true
+				bestLen = ones
+				distance = prefix.distance
+			}
+		}
+	}
+	return distance, found
+}
+
+func newIGPPrefix(addr, mask uint32, distance uint32) igpPrefix {
+	return igpPrefix{
+		ipNet:    &net.IPNet{IP: uint32ToIP(addr & mask), Mask: net.IPMask(uint32ToIP(mask))},
+		distance: distance,
+	}
+}
+
+func (l *LinkStateRib) getAreaGraph(areaId uint32) (map[igpNode][]igpEdge, map[igpNode][]igpPrefix) {
+	edges := make(map[igpNode][]igpEdge)
+	prefixes := make(map[igpNode][]igpPrefix)
+	for _, lsa := range l.areaLsas[areaId] {
+		if lsa.LSType == LsaTypeRouter {
+			node := igpNode{false, lsa.AdvRouter}
+			prefixes[node] = append(prefixes[node], newIGPPrefix(lsa.AdvRouter, math.MaxUint32, 0))
+			for _, link := range lsa.Links {
+				switch link.LinkType {
+				case LsaLinkTypeP2P:
+					edges[node] = append(edges[node], igpEdge{igpNode{false, link.LinkId}, uint32(link.Metric)})
+				case LsaLinkTypeTransit:
+					edges[node] = append(edges[node], igpEdge{igpNode{true, link.LinkId}, uint32(link.Metric)})
+				case LsaLinkTypeStub:
+					prefixes[node] = append(prefixes[node], newIGPPrefix(link.LinkId, link.LinkData,
+						uint32(link.Metric)))
+				}
+			}
+		} else if lsa.LSType == LsaTypeNetwork {
+			node := igpNode{true, lsa.LSId}
+			prefixes[node] = append(prefixes[node], newIGPPrefix(lsa.LSId, lsa.Netmask, 0))
+			for _, rtr := range lsa.AttachedRtr {
+				edges[node] = append(edges[node], igpEdge{igpNode{false, rtr}, 0})
+			}
+		}
+	}
+	return edges, prefixes
+}
+
+/*
+ * isRouterInArea returns whether the area has the router LSA of the router.
+ */
+func (l *LinkStateRib) isRouterInArea(areaId uint32, routerId uint32) bool {
+	_, ok := l.areaLsas[areaId][lsaKey{LsaTypeRouter, routerId, routerId}]
+	return ok
+}
+
+/*
+ * getAreaIGPDistances runs SPF from the router rootId in the area and returns the distances to the prefixes of
+ * the area.
+ */
+func (l *LinkStateRib) getAreaIGPDistances(areaId uint32, rootId uint32) []igpPrefix {
+	edges, prefixes := l.getAreaGraph(areaId)
+	rootNode := igpNode{false, rootId}
+	areaPrefixes := make([]igpPrefix, 0)
+	nodeDist := map[igpNode]uint32{rootNode: 0}
+	visited := make(map[igpNode]bool)
+	for {
+		var node igpNode
+		found := false
+		for candidate, dist := range nodeDist {
+			if !visited[candidate] && (!found || dist < nodeDist[node]) {
+				node = candidate
+				found = true
+			}
+		}
+		if !found {
+			break
+		}
+
+		visited[node] = true
+		for _, prefix := range prefixes[node] {
+			areaPrefixes = append(areaPrefixes, igpPrefix{prefix.ipNet, nodeDist[node] + prefix.distance})
+		}
+		for _, edge := range edges[node] {
+			dist := nodeDist[node] + edge.metric
+			if curr, ok := nodeDist[edge.node]; !ok || dist < curr {
+				nodeDist[edge.node] = dist
+			}
+		}
+	}
+	return areaPrefixes
+}
+
+/*
+ * GetIGPDistances runs SPF from the router with the router id root in all the areas of the link state database.
+ * Returns nil if the router is not in the link state database.
+ */
+func (l *LinkStateRib) GetIGPDistances(root net.IP) *IGPDistances {
+	areas := make(map[uint32]bool)
+	for areaId := range l.areaLsas {
+		areas[areaId] = true
+	}
+	distances, _ := l.UpdateIGPDistances(root, nil, areas)
+	return distances
+}
+
+/*
+ * UpdateIGPDistances runs SPF from the router with the router id root only in the areas that changed. The
+ * distances of the other areas are copied from distances. Returns the new distances, nil if the router is not in
+ * the link state database, and whether the distances of any area of the router were computed or removed.
+ */
+func (l *LinkStateRib) UpdateIGPDistances(root net.IP, distances *IGPDistances, areas map[uint32]bool) (
+	*IGPDistances, bool) {
+	if root.To4() == nil {
+		return nil, false
+	}
+
+	rootId := binary.BigEndian.Uint32(root.To4())
+	newDistances := &IGPDistances{areaPrefixes: make(map[uint32][]igpPrefix)}
+	if distances != nil {
+		for areaId, prefixes := range distances.areaPrefixes {
+			newDistances.areaPrefixes[areaId] = prefixes
+		}
+	}
+
+	changed := false
+	for areaId := range areas {
+		if l.isRouterInArea(areaId, rootId) {
+			newDistances.areaPrefixes[areaId] = l.getAreaIGPDistances(areaId, rootId)
+			changed = true
+		} else if _, ok := newDistances.areaPrefixes[areaId]; ok {
+			delete(newDistances.areaPrefixes, areaId)
+			changed = true
+		}
+	}
+
+	if len(newDistances.areaPrefixes) == 0 {
+		return nil, changed
+	}
+	return newDistances, changed
+}
+
+/*
+ * getRoutesWithLowestIGPDistance keeps the paths with the lowest IGP distance to the NEXT_HOP.
+ */
+func (d *Destination) getRoutesWithLowestIGPDistance(updatedPaths []*Path, igpDistance func(*Path) uint32) []*Path {
+	lowestDistance := uint32(math.MaxUint32)
+	idx := 0
+	for i := 0; i < len(updatedPaths); i++ {
+		distance := igpDistance(updatedPaths[i])
+		if distance < lowestDistance || i == 0 {
+			lowestDistance = distance
+			updatedPaths[0] = updatedPaths[i]
+			idx = 1
+		} else if distance == lowestDistance {
+			updatedPaths[idx] = updatedPaths[i]
+			idx++
+		}
+	}
+	return updatedPaths[:idx]
+}
+
+/*
+ * SelectRouteForIGPDistance runs the best path selection on the paths of the destination with the IGP distances
+ * to the NEXT_HOP from igpDistance. Like SelectRouteForView it does not install any route or modify the
+ * destination.
+ */
+func (d *Destination) SelectRouteForIGPDistance(igpDistance func(*Path) uint32) *Path {
+	paths := d.getEligiblePaths(func(*Path) bool { return true })
+	if len(paths) == 0 {
+		return nil
+	}
+
+	prunedPaths := make([]PathSortIface, 0)
+	if len(paths) > 1 {
+		paths, prunedPaths = d.getRoutesWithHighestPref(paths, prunedPaths)
+	}
+	if len(paths) > 1 {
+		paths, prunedPaths = d.getRoutesWithSmallestAS(paths, prunedPaths)
+	}
+	if len(paths) > 1 {
+		paths, prunedPaths = d.getRoutesWithLowestOrigin(paths, prunedPaths)
+	}
+	if len(paths) > 1 {
+		paths, prunedPaths = d.removeIBGPRoutesIfEBGPExist(paths, prunedPaths)
+	}
+	if len(paths) > 1 {
+		paths = d.getRoutesWithLowestIGPDistance(paths, igpDistance)
+	}
+	if len(paths) > 1 {
+		paths, prunedPaths = d.getRoutesWithLowestBGPId(paths, prunedPaths)
+	}
+	if len(paths) > 1 {
+		paths, prunedPaths = d.getRoutesWithShorterClusterLen(paths, prunedPaths)
+	}
+	if len(paths) > 1 {
+		paths, prunedPaths = d.getRoutesWithLowestPeerAddress(paths, prunedPaths)
+	}
+	return paths[0]
+}
+
+/*
+ * ORRGroupRib is the Loc-RIB of the route reflector clients in an optimal route reflection group, RFC 9107. The
+ * best path for a destination is selected with the IGP distances from the IGP position of the group instead of
+ * the route reflector. The Loc-RIB path is used while the IGP position is not in the link state database.
+ */
+type ORRGroupRib struct {
+	logger      *logging.Writer
+	locRib      *LocRib
+	Name        string
+	IGPPosition net.IP
+	distances   *IGPDistances
+	destPathMap map[uint32]map[string]*Path
+}
+
+func NewORRGroupRib(locRib *LocRib, groupConf config.ORRGroupConfig) *ORRGroupRib {
+	return &ORRGroupRib{
+		logger:      locRib.logger,
+		locRib:      locRib,
+		Name:        groupConf.Name,
+		IGPPosition: groupConf.IGPPosition,
+		destPathMap: make(map[uint32]map[string]*Path),
+	}
+}
+
+func (o *ORRGroupRib) selectPath(dest *Destination) *Path {
+	if o.distances == nil {
+		return dest.LocRibPath
+	}
+
+	protoFamily := dest.GetProtocolFamily()
+	return dest.SelectRouteForIGPDistance(func(path *Path) uint32 {
+		if path.NeighborConf == nil {
+			return 0
+		}
+
+		nextHop := path.GetNextHop(protoFamily)
+		if nextHop == nil {
+			return math.MaxUint32
+		}
+		distance, _ := o.distances.GetDistance(nextHop)
+		return distance
+	})
+}
+
+/*
+ * processDest runs the best path selection for the group. The destination is advertised if the best path
+ * changed or advertise is set.
+ */
+func (o *ORRGroupRib) processDest(dest *Destination, advertise bool, updated map[uint32]map[*Path][]*Destination,
+	withdrawn []*Destination) (map[uint32]map[*Path][]*Destination, []*Destination) {
+	protoFamily := dest.GetProtocolFamily()
+	ip := dest.NLRI.GetPrefix().String()
+	oldPath, found := o.destPathMap[protoFamily][ip]
+	path := o.selectPath(dest)
+
+	if path == nil {
+		if found {
+			delete(o.destPathMap[protoFamily], ip)
+		}
+		if found || advertise {
+			withdrawn = append(withdrawn, dest)
+		}
+		return updated, withdrawn
+	}
+
+	if found && oldPath == path && !advertise {
+		return updated, withdrawn
+	}
+
+	if _, ok := o.destPathMap[protoFamily]; !ok {
+		o.destPathMap[protoFamily] = make(map[string]*Path)
+	}
+	o.destPathMap[protoFamily][ip] = path
+
+	if _, ok := updated[protoFamily]; !ok {
+		updated[protoFamily] = make(map[*Path][]*Destination)
+	}
+	updated[protoFamily][path] = append(updated[protoFamily][path], dest)
+	return updated, withdrawn
+}
+
+func (o *ORRGroupRib) GetPath(dest *Destination) *Path {
+	return o.destPathMap[dest.GetProtocolFamily()][dest.NLRI.GetPrefix().String()]
+}
+
+/*
+ * ProcessUpdates converts the updates of the Loc-RIB to the updates of the group. The destinations updated in
+ * the Loc-RIB are always advertised, the modified destinations only if the best path of the group changed.
+ */
+func (o *ORRGroupRib) ProcessUpdates(updated map[uint32]map[*Path][]*Destination, withdrawn,
+	modifiedDests []*Destination) (map[uint32]map[*Path][]*Destination, []*Destination) {
+	groupUpdated := make(map[uint32]map[*Path][]*Destination)
+	groupWithdrawn := make([]*Destination, 0)
+	processed := make(map[*Destination]bool)
+
+	for _, dest := range withdrawn {
+		if dest == nil {
+			continue
+		}
+		processed[dest] = true
+		protoFamily := dest.GetProtocolFamily()
+		delete(o.destPathMap[protoFamily], dest.NLRI.GetPrefix().String())
+		groupWithdrawn = append(groupWithdrawn, dest)
+	}
+
+	for _, pathDestMap := range updated {
+		for _, destinations := range pathDestMap {
+			for _, dest := range destinations {
+				if dest != nil && !processed[dest] {
+					processed[dest] = true
+					groupUpdated, groupWithdrawn = o.processDest(dest, true, groupUpdated, groupWithdrawn)
+				}
+			}
+		}
+	}
+
+	for _, dest := range modifiedDests {
+		if !processed[dest] {
+			processed[dest] = true
+			groupUpdated, groupWithdrawn = o.processDest(dest, false, groupUpdated, groupWithdrawn)
+		}
+	}
+
+	return groupUpdated, groupWithdrawn
+}
+
+/*
+ * SetIGPDistances sets the IGP distances from the IGP position of the group and runs the best path selection for
+ * all the destinations. Returns the destinations whose best path for the group changed.
+ */
+func (o *ORRGroupRib) SetIGPDistances(distances *IGPDistances) (map[uint32]map[*Path][]*Destination,
+	[]*Destination) {
+	o.distances = distances
+	updated := make(map[uint32]map[*Path][]*Destination)
+	withdrawn := make([]*Destination, 0)
+	for _, destMap := range o.locRib.destPathMap {
+		for _, dest := range destMap {
+			updated, withdrawn = o.processDest(dest, false, updated, withdrawn)
+		}
+	}
+
+	o.logger.Infof("ORR group %s: IGP position %s in link state database %t, withdrawn %d destinations",
+		o.Name, o.IGPPosition, distances != nil, len(withdrawn))
+	return updated, withdrawn
+}
+
+/*
+ * ProcessTopologyChange updates the IGP distances from the IGP position of the group after the LSAs of areas
+ * changed in the link state database. Nothing is done if the IGP position is not in any of the areas. The best path
+ * selection is run only for the destinations with paths whose NEXT_HOP distance changed. Returns the destinations
+ * whose best path for the group changed.
+ */
+func (o *ORRGroupRib) ProcessTopologyChange(linkStateRib *LinkStateRib, areas map[uint32]bool) (
+	map[uint32]map[*Path][]*Destination, []*Destination) {
+	updated := make(map[uint32]map[*Path][]*Destination)
+	withdrawn := make([]*Destination, 0)
+	oldDistances := o.distances
+	distances, changed := linkStateRib.UpdateIGPDistances(o.IGPPosition, oldDistances, areas)
+	if !changed {
+		return updated, withdrawn
+	}
+
+	if oldDistances == nil || distances == nil {
+		return o.SetIGPDistances(distances)
+	}
+
+	o.distances = distances
+	nextHopChanged := make(map[string]bool)
+	isNextHopChanged := func(nextHop net.IP) bool {
+		if nextHop == nil {
+			return false
+		}
+		key := nextHop.String()
+		if isChanged, ok := nextHopChanged[key]; ok {
+			return isChanged
+		}
+		oldDistance, oldFound := oldDistances.GetDistance(nextHop)
+		distance, found := distances.GetDistance(nextHop)
+		nextHopChanged[key] = oldDistance != distance || oldFound != found
+		return nextHopChanged[key]
+	}
+
+	count := 0
+	for protoFamily, destMap := range o.locRib.destPathMap {
+		for _, dest := range destMap {
+			affected := false
+			for _, pathMap := range dest.peerPathMap {
+				for _, path := range pathMap {
+					if path.NeighborConf != nil && isNextHopChanged(path.GetNextHop(protoFamily)) {
+						affected = true
+						break
+					}
+				}
+				if affected {
+					break
+				}
+			}
+
+			if affected {
+				count++
+				updated, withdrawn = o.processDest(dest, false, updated, withdrawn)
+			}
+		}
+	}
+
+	o.logger.Infof("ORR group %s: IGP distances changed, processed %d destinations", o.Name, count)
+	return updated, withdrawn
+}
@@ -67,6 +67,12 @@ func getRouteSource(routeType uint8) uint8 {
 	return RouteSrcUnknown
 }
 
+const (
+	ReflectionLoopNone uint8 = iota
+	ReflectionLoopOriginatorId
+	ReflectionLoopClusterList
+)
+
 type NHReachabilityInfo struct {
 	nextHop          net.IP
 	reachabilityInfo *ReachabilityInfo
@@ -137,9 +143,28 @@ func (p *Path) calculatePref() uint32 {
 		pref = BGP_EXTERNAL_PREF
 	}
 
+	// Paths that are being drained are the least preferred, RFC 8326
+	if p.isGracefulShutdown() {
+		p.LocalPref = packet.BGPGracefulShutdownLocalPref
+		pref = packet.BGPGracefulShutdownLocalPref
+	}
+
 	return pref
 }
 
+func (p *Path) isGracefulShutdown() bool {
+	if p.NeighborConf == nil {
+		return false
+	}
+
+	return p.NeighborConf.IsGracefulShutdown() ||
+		packet.HasCommunity(p.PathAttrs, packet.BGPCommunityGracefulShutdown)
+}
+
+func (p *Path) RecalculatePref() {
+	p.Pref = p.calculatePref()
+}
+
 func (p *Path) constructNHReachabilityInfo(mpReach *packet.BGPPathAttrMPReachNLRI) {
 	for _, attr := range p.PathAttrs {
 		if attr.GetCode() == packet.BGPPathAttrTypeNextHop {
@@ -161,25 +186,33 @@ func (p *Path) constructNHReachabilityInfo(mpReach *packet.BGPPathAttrMPReachNLR
 	}
 }
 
-func (p *Path) IsValid() bool {
+/*
+ * GetReflectionLoop checks the ORIGINATOR_ID and the CLUSTER_LIST of the path for a route reflection loop,
+ * RFC 4456. The CLUSTER_LIST is checked against all the cluster ids of the route reflector.
+ */
+func (p *Path) GetReflectionLoop() uint8 {
 	for _, attr := range p.PathAttrs {
 		if attr.GetCode() == packet.BGPPathAttrTypeOriginatorId {
 			if p.NeighborConf.Global.RouterId.Equal(attr.(*packet.BGPPathAttrOriginatorId).Value) {
-				return false
+				return ReflectionLoopOriginatorId
 			}
 		}
 
 		if attr.GetCode() == packet.BGPPathAttrTypeClusterList {
 			clusters := attr.(*packet.BGPPathAttrClusterList).Value
 			for _, clusterId := range clusters {
-				if clusterId == p.NeighborConf.RunningConf.RouteReflectorClusterId {
-					return false
+				if p.rib.clusterIds[clusterId] {
+					return ReflectionLoopClusterList
 				}
 			}
 		}
 	}
 
-	return true
+	return ReflectionLoopNone
+}
+
+func (p *Path) IsValid() bool {
+	return p.GetReflectionLoop() == ReflectionLoopNone
 }
 
 func (p *Path) GetNeighborConf() *base.NeighborConf {
@@ -275,6 +308,18 @@ func (p *Path) GetNumASes() uint32 {
 	return packet.GetNumASes(p.PathAttrs)
 }
 
+func (p *Path) GetASPathString() string {
+	return strings.Join(p.GetAS4ByteList(), " ")
+}
+
+func (p *Path) GetNeighborAS() (uint32, bool) {
+	return packet.GetNeighborAS(p.PathAttrs)
+}
+
+func (p *Path) GetOriginAS() (uint32, bool) {
+	return packet.GetOriginAS(p.PathAttrs)
+}
+
 func (p *Path) GetOrigin() uint8 {
 	return packet.GetOrigin(p.PathAttrs)
 }
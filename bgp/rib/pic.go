@@ -0,0 +1,388 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// pic.go
+package rib
+
+import (
+	"l3/bgp/config"
+	"l3/bgp/packet"
+	"strconv"
+)
+
+/*
+ * BGP Prefix Independent Convergence. A backup path is installed with the route manager along with the best path
+ * of a destination. When the NEXT_HOP of the best path is not reachable, all the routes that use the NEXT_HOP are
+ * switched to their backup next hop with a single route manager operation before the best path selection runs
+ * for each of the destinations.
+ */
+
+func (l *LocRib) isPICEnabled() bool {
+	return l.gConf.IPv4UnicastPIC || l.gConf.IPv6UnicastPIC
+}
+
+func (d *Destination) isPICEnabled() bool {
+	switch d.protoFamily {
+	case packet.GetProtocolFamily(packet.AfiIP, packet.SafiUnicast):
+		return d.gConf.IPv4UnicastPIC
+	case packet.GetProtocolFamily(packet.AfiIP6, packet.SafiUnicast):
+		return d.gConf.IPv6UnicastPIC
+	}
+	return false
+}
+
+func (d *Destination) getRouteConfig(path *Path) config.RouteConfig {
+	ipLength := packet.GetAddressLengthForFamily(d.protoFamily)
+	protocol := "IBGP"
+	if path.IsExternal() {
+		protocol = "EBGP"
+	}
+
+	cfg := config.RouteConfig{
+		Protocol:      protocol,
+		NetworkMask:   d.constructNetmaskFromLen(int(d.NLRI.GetLength()), ipLength*8).String(),
+		DestinationNw: d.NLRI.GetPrefix().String(),
+		IsIPv6:        ipLength == 16,
+	}
+	if reachInfo := path.GetReachability(d.protoFamily); reachInfo != nil {
+		cfg.Cost = reachInfo.Metric
+		cfg.IntfType = reachInfo.NextHopIfType
+		cfg.NextHopIp = reachInfo.NextHop
+		cfg.OutgoingInterface = strconv.Itoa(int(reachInfo.NextHopIfIdx))
+	} else if nextHop := path.GetNextHop(d.protoFamily); nextHop != nil {
+		cfg.NextHopIp = nextHop.String()
+	}
+	return cfg
+}
+
+/*
+ * selectBackupPath returns the backup for the best path of the destination. Paths with the same NEXT_HOP as the
+ * best path can't be used as the backup. The best external path is preferred, the next best path is used if there
+ * are no external paths. There is no backup for ECMP routes.
+ */
+func (d *Destination) selectBackupPath() *Path {
+	if !d.isPICEnabled() || d.LocRibPath == nil || d.LocRibPath.NeighborConf == nil || len(d.ecmpPaths) != 1 {
+		return nil
+	}
+
+	nextHop := d.LocRibPath.GetNextHop(d.protoFamily)
+	reachInfo := d.LocRibPath.GetReachability(d.protoFamily)
+	if nextHop == nil || reachInfo == nil {
+		return nil
+	}
+
+	externalPaths := make([]*Path, 0)
+	internalPaths := make([]*Path, 0)
+	for _, pathMap := range d.peerPathMap {
+		for _, path := range pathMap {
+			if path == d.LocRibPath || path.NeighborConf == nil || !path.IsReachable(d.protoFamily) ||
+				path.HasASLoop() {
+				continue
+			}
+
+			pathNextHop := path.GetNextHop(d.protoFamily)
+			if pathNextHop == nil || pathNextHop.Equal(nextHop) ||
+				path.GetReachability(d.protoFamily).NextHop == reachInfo.NextHop {
+				continue
+			}
+
+			if path.IsExternal() {
+				externalPaths = append(externalPaths, path)
+			} else {
+				internalPaths = append(internalPaths, path)
+			}
+		}
+	}
+
+	paths := externalPaths
+	if len(paths) == 0 {
+		paths = internalPaths
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	if len(paths) > 1 {
+		paths, _, _ = d.calculateBestPath(paths, make([]*Path, 0), false, false, 0)
+	}
+	return paths[0]
+}
+
+/*
+ * updateBackupPath selects the backup path after the best path selection and hands it to the route manager if it
+ * changed. primaryInstalled is true if the route for the best path was just installed without a backup.
+ */
+func (d *Destination) updateBackupPath(primaryInstalled bool) {
+	backupPath := d.selectBackupPath()
+	if d.LocRibPath == nil || (backupPath == d.backupPath && !primaryInstalled) ||
+		(backupPath == nil && primaryInstalled) {
+		d.backupPath = backupPath
+		return
+	}
+
+	d.backupPath = backupPath
+	cfg := d.getRouteConfig(d.LocRibPath)
+	if backupPath != nil {
+		backupCfg := d.getRouteConfig(backupPath)
+		cfg.BackupNextHopIp = backupCfg.NextHopIp
+		cfg.BackupOutgoingInterface = backupCfg.OutgoingInterface
+		d.logger.Infof("Destination %s backup next hop %s", d.NLRI.GetPrefix(), cfg.BackupNextHopIp)
+	} else {
+		d.logger.Infof("Destination %s remove backup next hop", d.NLRI.GetPrefix())
+	}
+	d.rib.routeMgr.SetBackupNextHop(&cfg)
+}
+
+/*
+ * activateBackupPath returns the route config to switch the route of the destination to the backup next hop if
+ * the best path uses the NEXT_HOP. The backup path is installed in place of the best path till the best path
+ * selection runs again.
+ */
+func (d *Destination) activateBackupPath(nextHop string) *config.RouteConfig {
+	if d.backupPath == nil || d.LocRibPath == nil || len(d.ecmpPaths) != 1 {
+		return nil
+	}
+
+	pathNextHop := d.LocRibPath.GetNextHop(d.protoFamily)
+	if pathNextHop == nil || pathNextHop.String() != nextHop || !d.backupPath.IsReachable(d.protoFamily) {
+		return nil
+	}
+
+	cfg := d.getRouteConfig(d.LocRibPath)
+	backupCfg := d.getRouteConfig(d.backupPath)
+	cfg.BackupNextHopIp = backupCfg.NextHopIp
+	cfg.BackupOutgoingInterface = backupCfg.OutgoingInterface
+	d.failedPath = d.LocRibPath
+	d.activeBackupPath = d.backupPath
+	d.backupPath = nil
+	return &cfg
+}
+
+/*
+ * getInstalledReachability returns the reachability the route of the path was installed with. The reachability of
+ * a path is reset when its NEXT_HOP is not reachable and the route is removed with the saved reachability.
+ */
+func (d *Destination) getInstalledReachability(path *Path) *ReachabilityInfo {
+	if reachInfo := path.GetReachability(d.protoFamily); reachInfo != nil {
+		return reachInfo
+	}
+	return d.unreachableRoutes[path]
+}
+
+/*
+ * reconcileActiveBackupPath is called before the routes selected by the best path selection are installed. The
+ * active backup path is already installed, it's removed if it was not selected. Returns whether the first route
+ * still needs to be created.
+ */
+func (d *Destination) reconcileActiveBackupPath(createRibRoutes []*Path, firstRoute bool) bool {
+	if d.activeBackupPath == nil {
+		return firstRoute
+	}
+
+	for _, path := range createRibRoutes {
+		if path == d.activeBackupPath {
+			return false
+		}
+	}
+
+	cfg := d.getRouteConfig(d.activeBackupPath)
+	d.rib.routeMgr.UpdateRoute(&cfg, "remove")
+	return firstRoute
+}
+
+/*
+ * indexPathNextHop adds the destination to or removes it from the destinations of the NEXT_HOP of the neighbor
+ * path. The index is used to find the destinations with paths that use a NEXT_HOP when it's not reachable.
+ */
+func (d *Destination) indexPathNextHop(path *Path, add bool) {
+	if d.rib == nil || path == nil || path.NeighborConf == nil {
+		return
+	}
+	pathNextHop := path.GetNextHop(d.protoFamily)
+	if pathNextHop == nil {
+		return
+	}
+
+	nextHop := pathNextHop.String()
+	dests, ok := d.rib.nextHopDests[nextHop]
+	if add {
+		if !ok {
+			dests = make(map[*Destination]int)
+			d.rib.nextHopDests[nextHop] = dests
+		}
+		dests[d]++
+		return
+	}
+
+	if !ok || dests[d] == 0 {
+		return
+	}
+	dests[d]--
+	if dests[d] == 0 {
+		delete(dests, d)
+		if len(dests) == 0 {
+			delete(d.rib.nextHopDests, nextHop)
+		}
+	}
+}
+
+/*
+ * trackNextHop asks the route manager to notify the reachability changes of the NEXT_HOP when prefix independent
+ * convergence is enabled. The notifications are processed by ProcessUnreachableNextHop and
+ * ProcessReachableNextHop.
+ */
+func (l *LocRib) trackNextHop(nextHop string) {
+	if l.trackedNextHops[nextHop] || !l.isPICEnabled() {
+		return
+	}
+	l.trackedNextHops[nextHop] = true
+	l.routeMgr.TrackNextHop(nextHop, true)
+}
+
+/*
+ * updateTrackedNextHops tracks the resolved and the unreachable NEXT_HOPs when prefix independent convergence is
+ * enabled and stops tracking them when it's disabled.
+ */
+func (l *LocRib) updateTrackedNextHops() {
+	if !l.isPICEnabled() {
+		for nextHop := range l.trackedNextHops {
+			l.routeMgr.TrackNextHop(nextHop, false)
+		}
+		l.trackedNextHops = make(map[string]bool)
+		return
+	}
+
+	for nextHop := range l.reachabilityMap {
+		l.trackNextHop(nextHop)
+	}
+	for nextHop := range l.unreachablePaths {
+		l.trackNextHop(nextHop)
+	}
+}
+
+/*
+ * ProcessUnreachableNextHop switches the routes that use the NEXT_HOP to their backup next hops and runs the best
+ * path selection for the destinations with prefix independent convergence enabled and paths that use the NEXT_HOP.
+ */
+func (l *LocRib) ProcessUnreachableNextHop(nextHop string, addPathCount int) (map[uint32]map[*Path][]*Destination,
+	[]*Destination, []*Destination) {
+	updated := make(map[uint32]map[*Path][]*Destination)
+	withdrawn := make([]*Destination, 0)
+	updatedAddPaths := make([]*Destination, 0)
+
+	if _, ok := l.reachabilityMap[nextHop]; !ok {
+		return updated, withdrawn, updatedAddPaths
+	}
+	delete(l.reachabilityMap, nextHop)
+
+	destPaths := make(map[*Destination]map[*Path][]uint32)
+	for dest := range l.nextHopDests[nextHop] {
+		if !dest.isPICEnabled() {
+			continue
+		}
+		for _, pathMap := range dest.peerPathMap {
+			for pathId, path := range pathMap {
+				pathNextHop := path.GetNextHop(dest.protoFamily)
+				if path.NeighborConf == nil || pathNextHop == nil || pathNextHop.String() != nextHop ||
+					!path.IsReachable(dest.protoFamily) {
+					continue
+				}
+
+				if _, ok := destPaths[dest]; !ok {
+					destPaths[dest] = make(map[*Path][]uint32)
+				}
+				destPaths[dest][path] = append(destPaths[dest][path], pathId)
+				// Paths are shared by destinations, save the reachability before it's reset for any of them
+				if dest.unreachableRoutes == nil {
+					dest.unreachableRoutes = make(map[*Path]*ReachabilityInfo)
+				}
+				dest.unreachableRoutes[path] = path.GetReachability(dest.protoFamily)
+			}
+		}
+	}
+
+	backupRoutes := make([]*config.RouteConfig, 0)
+	for dest := range destPaths {
+		if cfg := dest.activateBackupPath(nextHop); cfg != nil {
+			backupRoutes = append(backupRoutes, cfg)
+		}
+	}
+	if len(backupRoutes) > 0 {
+		l.logger.Infof("Next hop %s is not reachable, switch %d routes to the backup next hop", nextHop,
+			len(backupRoutes))
+		l.routeMgr.SwitchToBackupNextHop(nextHop, backupRoutes)
+	}
+
+	if _, ok := l.unreachablePaths[nextHop]; !ok && len(destPaths) > 0 {
+		l.unreachablePaths[nextHop] = make(map[*Path]map[*Destination][]uint32)
+	}
+	for dest, paths := range destPaths {
+		for path, pathIds := range paths {
+			path.SetReachabilityForNextHop(nextHop, nil)
+			if _, ok := l.unreachablePaths[nextHop][path]; !ok {
+				l.unreachablePaths[nextHop][path] = make(map[*Destination][]uint32)
+			}
+			l.unreachablePaths[nextHop][path][dest] = append(l.unreachablePaths[nextHop][path][dest], pathIds...)
+		}
+
+		dest.recalculate = true
+		action, addPathsMod, addRoutes, updRoutes, delRoutes := dest.SelectRouteForLocRib(addPathCount)
+		updated, withdrawn, updatedAddPaths = l.updateRibOutInfo(action, addPathsMod, addRoutes, updRoutes,
+			delRoutes, dest, updated, withdrawn, updatedAddPaths)
+		l.stateDBMgr.UpdateObject(l.GetRouteStateConfigObj(dest.GetBGPRoute()))
+	}
+	return updated, withdrawn, updatedAddPaths
+}
+
+/*
+ * ProcessReachableNextHop runs the best path selection for the destinations with paths that were not selected
+ * because the NEXT_HOP was not reachable.
+ */
+func (l *LocRib) ProcessReachableNextHop(nextHop string, addPathCount int) (map[uint32]map[*Path][]*Destination,
+	[]*Destination, []*Destination) {
+	updated := make(map[uint32]map[*Path][]*Destination)
+	withdrawn := make([]*Destination, 0)
+	updatedAddPaths := make([]*Destination, 0)
+
+	if _, ok := l.unreachablePaths[nextHop]; !ok {
+		return updated, withdrawn, updatedAddPaths
+	}
+
+	reachabilityInfo := l.GetReachabilityInfo(nextHop)
+	if reachabilityInfo == nil {
+		return updated, withdrawn, updatedAddPaths
+	}
+	return l.ProcessRoutesForReachableRoutes(nextHop, reachabilityInfo, addPathCount, updated, withdrawn,
+		updatedAddPaths)
+}
+
+/*
+ * UpdateBackupPaths selects the backup paths of all the destinations after the PIC config changed.
+ */
+func (l *LocRib) UpdateBackupPaths() {
+	l.updateTrackedNextHops()
+	for _, destMap := range l.destPathMap {
+		for _, dest := range destMap {
+			dest.updateBackupPath(false)
+		}
+	}
+}
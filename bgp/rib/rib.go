@@ -33,6 +33,7 @@ import (
 	"models/objects"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 	"utils/logging"
 	"utils/statedbclient"
@@ -67,6 +68,10 @@ type LocRib struct {
 	destPathMap      map[uint32]map[string]*Destination
 	reachabilityMap  map[string]*ReachabilityInfo
 	unreachablePaths map[string]map[*Path]map[*Destination][]uint32
+	trackedNextHops  map[string]bool
+	nextHopDests     map[string]map[*Destination]int
+	modifiedDests    map[*Destination]bool
+	clusterIds       map[uint32]bool
 	routeList        []*Destination
 	routeMutex       sync.RWMutex
 	routeListDirty   bool
@@ -84,6 +89,10 @@ func NewLocRib(logger *logging.Writer, rMgr config.RouteMgrIntf, sDBMgr statedbc
 		destPathMap:      make(map[uint32]map[string]*Destination),
 		reachabilityMap:  make(map[string]*ReachabilityInfo),
 		unreachablePaths: make(map[string]map[*Path]map[*Destination][]uint32),
+		trackedNextHops:  make(map[string]bool),
+		nextHopDests:     make(map[string]map[*Destination]int),
+		modifiedDests:    make(map[*Destination]bool),
+		clusterIds:       make(map[uint32]bool),
 		routeList:        make([]*Destination, 0),
 		routeListDirty:   false,
 		activeGet:        false,
@@ -112,6 +121,7 @@ func (l *LocRib) GetReachabilityInfo(ipStr string) *ReachabilityInfo {
 	}
 
 	l.logger.Infof("GetReachabilityInfo: Reachability info not cached for Next hop %s", ipStr)
+	l.trackNextHop(ipStr)
 	ribdReachabilityInfo, err := l.routeMgr.GetNextHopInfo(ipStr)
 	if err != nil {
 		l.logger.Infof("NEXT_HOP[%s] is not reachable", ipStr)
@@ -160,6 +170,7 @@ func (l *LocRib) GetDest(nlri packet.NLRI, protoFamily uint32, createIfNotExist
 func (l *LocRib) updateRibOutInfo(action RouteAction, addPathsMod bool, addRoutes, updRoutes, delRoutes []*Route,
 	dest *Destination, updated map[uint32]map[*Path][]*Destination, withdrawn, updatedAddPaths []*Destination) (
 	map[uint32]map[*Path][]*Destination, []*Destination, []*Destination) {
+	l.modifiedDests[dest] = true
 	if action == RouteActionAdd || action == RouteActionReplace {
 		if _, ok := updated[dest.protoFamily]; !ok {
 			updated[dest.protoFamily] = make(map[*Path][]*Destination)
@@ -177,6 +188,27 @@ func (l *LocRib) updateRibOutInfo(action RouteAction, addPathsMod bool, addRoute
 	return updated, withdrawn, updatedAddPaths
 }
 
+/*
+ * GetModifiedDests returns the destinations whose paths were processed since the last call, including the ones
+ * where the Loc-RIB path did not change. Per client views use it to find the destinations to recalculate.
+ */
+func (l *LocRib) GetModifiedDests() []*Destination {
+	dests := make([]*Destination, 0, len(l.modifiedDests))
+	for dest, _ := range l.modifiedDests {
+		dests = append(dests, dest)
+	}
+	l.modifiedDests = make(map[*Destination]bool)
+	return dests
+}
+
+/*
+ * SetClusterIds sets the cluster ids of the route reflector. A path with any of the cluster ids in the
+ * CLUSTER_LIST is discarded.
+ */
+func (l *LocRib) SetClusterIds(clusterIds map[uint32]bool) {
+	l.clusterIds = clusterIds
+}
+
 func (l *LocRib) GetRouteStateConfigObj(route *bgpd.BGPRouteState) objects.ConfigObj {
 	var dbObj objects.BGPRouteState
 	objects.ConvertThriftTobgpdBGPRouteStateObj(route, &dbObj)
@@ -237,7 +269,7 @@ func (l *LocRib) ProcessRoutes(peerIP string, add, rem []packet.NLRI, addPath, r
 				if neighborConf := remPath.GetNeighborConf(); neighborConf != nil {
 					l.logger.Infof("Decrement prefix count for destination %s from Peer %s",
 						nlri.GetPrefix().String(), peerIP)
-					neighborConf.DecrPrefixCount()
+					neighborConf.DecrPrefixCount(protoFamily)
 				}
 			}
 			if action == RouteActionDelete {
@@ -276,7 +308,7 @@ func (l *LocRib) ProcessRoutes(peerIP string, add, rem []packet.NLRI, addPath, r
 			}
 			l.logger.Infof("Increment prefix count for destination %s from Peer %s",
 				nlri.GetPrefix().String(), peerIP)
-			addPath.NeighborConf.IncrPrefixCount()
+			addPath.NeighborConf.IncrPrefixCount(protoFamily)
 		}
 
 		dest.AddOrUpdatePath(peerIP, nlri.GetPathId(), addPath)
@@ -323,6 +355,7 @@ func (l *LocRib) ProcessRoutesForReachableRoutes(nextHop string, reachabilityInf
 				l.stateDBMgr.AddObject(l.GetRouteStateConfigObj(dest.GetBGPRoute()))
 			}
 		}
+		delete(l.unreachablePaths, nextHop)
 	}
 
 	return updated, withdrawn, updatedAddPaths
@@ -331,9 +364,18 @@ func (l *LocRib) ProcessRoutesForReachableRoutes(nextHop string, reachabilityInf
 func (l *LocRib) TestNHAndProcessRoutes(peerIP string, add, remove []packet.NLRI, addPath, remPath *Path,
 	addPathCount int, protoFamily uint32, updated map[uint32]map[*Path][]*Destination, withdrawn,
 	updatedAddPaths []*Destination) (map[uint32]map[*Path][]*Destination, []*Destination, []*Destination, bool) {
+	if addPath.NeighborConf != nil && len(add) > 0 {
+		addPath.NeighborConf.AddReceivedPrefixCount(protoFamily, uint32(len(add)))
+	}
+
 	nextHop := addPath.GetNextHop(protoFamily)
 	if nextHop == nil {
-		l.logger.Errf("RIB - Next hop not found for protocol family %d", protoFamily)
+		// An UPDATE with only the withdrawn routes doesn't carry the path attributes
+		if len(add) > 0 {
+			l.logger.Errf("RIB - Next hop not found for protocol family %d", protoFamily)
+		}
+		updated, withdrawn, updatedAddPaths, _ = l.ProcessRoutes(peerIP, nil, remove, addPath, remPath,
+			addPathCount, protoFamily, updated, withdrawn, updatedAddPaths)
 		return updated, withdrawn, updatedAddPaths, true
 	}
 	nextHopStr := nextHop.String()
@@ -341,9 +383,15 @@ func (l *LocRib) TestNHAndProcessRoutes(peerIP string, add, remove []packet.NLRI
 	addPath.SetReachabilityForFamily(protoFamily, reachabilityInfo)
 
 	//addPath.GetReachabilityInfo()
-	if !addPath.IsValid() {
+	switch addPath.GetReflectionLoop() {
+	case ReflectionLoopOriginatorId:
+		l.logger.Info("Received a update with our router id as the originator id, Discarding the update.")
+		atomic.AddUint32(&addPath.NeighborConf.Neighbor.State.OriginatorIdLoops, 1)
+		return updated, withdrawn, updatedAddPaths, true
+	case ReflectionLoopClusterList:
 		l.logger.Infof("Received a update with our cluster id %d, Discarding the update.",
-			addPath.NeighborConf.RunningConf.RouteReflectorClusterId)
+			addPath.NeighborConf.GetClusterId())
+		atomic.AddUint32(&addPath.NeighborConf.Neighbor.State.ClusterListLoops, 1)
 		return updated, withdrawn, updatedAddPaths, true
 	}
 
@@ -379,7 +427,29 @@ func (l *LocRib) ProcessUpdate(neighborConf *base.NeighborConf, pktInfo *packet.
 	updatedAddPaths := make([]*Destination, 0)
 	addedAllPrefixes := true
 
+	for _, protoFamily := range body.GetDisabledProtoFamilies() {
+		remPath := NewPath(l, neighborConf, nil, nil, RouteTypeEGP)
+		updated, withdrawn, updatedAddPaths = l.removeUpdatesFromNeighborForFamily(pktInfo.Src, protoFamily,
+			remPath, addPathCount, updated, withdrawn, updatedAddPaths)
+	}
+
 	mpReach, mpUnreach := packet.RemoveMPAttrs(&body.PathAttributes)
+	// An UPDATE that is treated as withdraw can carry MP_UNREACH_NLRI for more than one AFI/SAFI
+	mpUnreachList := make([]*packet.BGPPathAttrMPUnreachNLRI, 0)
+	for {
+		_, extraMPUnreach := packet.RemoveMPAttrs(&body.PathAttributes)
+		if extraMPUnreach == nil {
+			break
+		}
+		mpUnreachList = append(mpUnreachList, extraMPUnreach)
+	}
+	// Link state routes are only originated from the IGP, the ones received from the neighbors are ignored
+	if mpReach != nil && mpReach.AFI == packet.AfiLinkState {
+		mpReach = nil
+	}
+	if mpUnreach != nil && mpUnreach.AFI == packet.AfiLinkState {
+		mpUnreach = nil
+	}
 	remPath := NewPath(l, neighborConf, body.PathAttributes, mpReach, RouteTypeEGP)
 	addPath := NewPath(l, neighborConf, body.PathAttributes, mpReach, RouteTypeEGP)
 
@@ -406,6 +476,15 @@ func (l *LocRib) ProcessUpdate(neighborConf *base.NeighborConf, pktInfo *packet.
 		updated, withdrawn, updatedAddPaths, addedAllPrefixes = l.TestNHAndProcessRoutes(pktInfo.Src, mpReach.NLRI,
 			nil, addPath, remPath, addPathCount, protoFamily, updated, withdrawn, updatedAddPaths)
 	}
+
+	for _, unreach := range mpUnreachList {
+		if unreach.AFI == packet.AfiLinkState {
+			continue
+		}
+		protoFamily := packet.GetProtocolFamily(unreach.AFI, unreach.SAFI)
+		updated, withdrawn, updatedAddPaths, addedAllPrefixes = l.TestNHAndProcessRoutes(pktInfo.Src, nil,
+			unreach.NLRI, addPath, remPath, addPathCount, protoFamily, updated, withdrawn, updatedAddPaths)
+	}
 	return updated, withdrawn, updatedAddPaths, addedAllPrefixes
 }
 
@@ -444,29 +523,65 @@ func (l *LocRib) RemoveUpdatesFromNeighbor(peerIP string, neighborConf *base.Nei
 	updated := make(map[uint32]map[*Path][]*Destination)
 	updatedAddPaths := make([]*Destination, 0)
 
-	for protoFamily, ipDestMap := range l.destPathMap {
-		for destIP, dest := range ipDestMap {
-			op := l.stateDBMgr.UpdateObject
-			dest.RemoveAllPaths(peerIP, remPath)
+	for protoFamily := range l.destPathMap {
+		updated, withdrawn, updatedAddPaths = l.removeUpdatesFromNeighborForFamily(peerIP, protoFamily, remPath,
+			addPathCount, updated, withdrawn, updatedAddPaths)
+	}
+
+	if neighborConf != nil {
+		neighborConf.SetPrefixCount(0)
+	}
+	return updated, withdrawn, updatedAddPaths
+}
+
+func (l *LocRib) removeUpdatesFromNeighborForFamily(peerIP string, protoFamily uint32, remPath *Path,
+	addPathCount int, updated map[uint32]map[*Path][]*Destination, withdrawn, updatedAddPaths []*Destination) (
+	map[uint32]map[*Path][]*Destination, []*Destination, []*Destination) {
+	for destIP, dest := range l.destPathMap[protoFamily] {
+		op := l.stateDBMgr.UpdateObject
+		dest.RemoveAllPaths(peerIP, remPath)
+		action, addPathsMod, addRoutes, updRoutes, delRoutes := dest.SelectRouteForLocRib(addPathCount)
+		l.logger.Info("RemoveUpdatesFromNeighbor - dest", dest.NLRI.GetPrefix().String(),
+			"SelectRouteForLocRib returned action", action, "addRoutes", addRoutes, "updRoutes", updRoutes,
+			"delRoutes", delRoutes)
+		updated, withdrawn, updatedAddPaths = l.updateRibOutInfo(action, addPathsMod, addRoutes, updRoutes,
+			delRoutes, dest, updated, withdrawn, updatedAddPaths)
+		if action == RouteActionDelete && dest.IsEmpty() {
+			l.logger.Info("All routes removed for dest", dest.NLRI.GetPrefix().String())
+			l.removeRoutesFromRouteList(dest)
+			delete(l.destPathMap[protoFamily], destIP)
+			op = l.stateDBMgr.DeleteObject
+		}
+		op(l.GetRouteStateConfigObj(dest.GetBGPRoute()))
+	}
+	return updated, withdrawn, updatedAddPaths
+}
+
+/*
+ * RecalculateNeighborPathPrefs selects the best path again for all the destinations that have a path from the
+ * neighbor, after the preference of the neighbor paths changed.
+ */
+func (l *LocRib) RecalculateNeighborPathPrefs(peerIP string, addPathCount int) (map[uint32]map[*Path][]*Destination,
+	[]*Destination, []*Destination) {
+	withdrawn := make([]*Destination, 0)
+	updated := make(map[uint32]map[*Path][]*Destination)
+	updatedAddPaths := make([]*Destination, 0)
+
+	for protoFamily := range l.destPathMap {
+		for _, dest := range l.destPathMap[protoFamily] {
+			if !dest.RecalculatePathPrefs(peerIP) {
+				continue
+			}
+
 			action, addPathsMod, addRoutes, updRoutes, delRoutes := dest.SelectRouteForLocRib(addPathCount)
-			l.logger.Info("RemoveUpdatesFromNeighbor - dest", dest.NLRI.GetPrefix().String(),
+			l.logger.Info("RecalculateNeighborPathPrefs - dest", dest.NLRI.GetPrefix().String(),
 				"SelectRouteForLocRib returned action", action, "addRoutes", addRoutes, "updRoutes", updRoutes,
 				"delRoutes", delRoutes)
 			updated, withdrawn, updatedAddPaths = l.updateRibOutInfo(action, addPathsMod, addRoutes, updRoutes,
 				delRoutes, dest, updated, withdrawn, updatedAddPaths)
-			if action == RouteActionDelete && dest.IsEmpty() {
-				l.logger.Info("All routes removed for dest", dest.NLRI.GetPrefix().String())
-				l.removeRoutesFromRouteList(dest)
-				delete(l.destPathMap[protoFamily], destIP)
-				op = l.stateDBMgr.DeleteObject
-			}
-			op(l.GetRouteStateConfigObj(dest.GetBGPRoute()))
+			l.stateDBMgr.UpdateObject(l.GetRouteStateConfigObj(dest.GetBGPRoute()))
 		}
 	}
-
-	if neighborConf != nil {
-		neighborConf.SetPrefixCount(0)
-	}
 	return updated, withdrawn, updatedAddPaths
 }
 
@@ -508,6 +623,18 @@ func (l *LocRib) GetLocRib() map[uint32]map[*Path][]*Destination {
 	return updated
 }
 
+func (l *LocRib) GetMatchingDests(isMatch func(*Destination) bool) []*Destination {
+	dests := make([]*Destination, 0)
+	for _, ipDestMap := range l.destPathMap {
+		for _, dest := range ipDestMap {
+			if dest.LocRibPath != nil && isMatch(dest) {
+				dests = append(dests, dest)
+			}
+		}
+	}
+	return dests
+}
+
 func (l *LocRib) RemoveRouteFromAggregate(ip *packet.IPPrefix, aggIP *packet.IPPrefix, srcIP string,
 	protoFamily uint32, bgpAgg *config.BGPAggregate, ipDest *Destination, addPathCount int) (
 	map[uint32]map[*Path][]*Destination, []*Destination, []*Destination) {
@@ -527,8 +654,7 @@ func (l *LocRib) RemoveRouteFromAggregate(ip *packet.IPPrefix, aggIP *packet.IPP
 		}
 		dest = ipDest
 	}
-	l.logger.Info("RemoveRouteFromAggregate: locRibPath", dest.LocRibPath, "locRibRoutePath",
-		dest.LocRibPathRoute.path)
+	l.logger.Info("RemoveRouteFromAggregate: locRibPath", dest.LocRibPath, "locRibRoute", dest.LocRibPathRoute)
 	op := l.stateDBMgr.UpdateObject
 
 	if aggDest, ok = l.GetDest(aggIP, protoFamily, false); !ok {
@@ -555,9 +681,9 @@ func (l *LocRib) RemoveRouteFromAggregate(ip *packet.IPPrefix, aggIP *packet.IPP
 		dest.aggPath = aggPath
 	}
 	if action == RouteActionDelete && aggDest.IsEmpty() {
-		l.removeRoutesFromRouteList(dest)
+		l.removeRoutesFromRouteList(aggDest)
 		delete(l.destPathMap[protoFamily], aggIP.Prefix.String())
-		op = l.stateDBMgr.DeleteObject
+		l.stateDBMgr.DeleteObject(l.GetRouteStateConfigObj(aggDest.GetBGPRoute()))
 	}
 	op(l.GetRouteStateConfigObj(dest.GetBGPRoute()))
 
@@ -110,3 +110,11 @@ func (r *Route) SetAdditionalPath() {
 func (r *Route) ResetAdditionalPath() {
 	r.PathInfo.AdditionalPath = false
 }
+
+func (r *Route) GetPath() *Path {
+	return r.path
+}
+
+func (r *Route) IsAggregate() bool {
+	return r.path != nil && r.path.IsAggregate()
+}
@@ -0,0 +1,173 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// routeserver.go
+package rib
+
+import (
+	"l3/bgp/baseobjects"
+	"l3/bgp/packet"
+	"utils/logging"
+)
+
+/*
+ * ExportFilterFunc returns true if the export policy of a neighbor accepts the path of the destination.
+ */
+type ExportFilterFunc func(dest *Destination, path *Path) bool
+
+/*
+ * RouteServerClientRib is the per client Loc-RIB of a route server client (RFC 7947 section 2.3.2.1).
+ * The best path for a destination is selected only from the paths the client would accept, i.e. the
+ * paths that pass the client's export policy, so the route server's own best path can't hide the other
+ * paths from the client.
+ */
+type RouteServerClientRib struct {
+	logger       *logging.Writer
+	locRib       *LocRib
+	neighborConf *base.NeighborConf
+	exportFilter ExportFilterFunc
+	destPathMap  map[uint32]map[string]*Path
+}
+
+func NewRouteServerClientRib(locRib *LocRib, neighborConf *base.NeighborConf,
+	exportFilter ExportFilterFunc) *RouteServerClientRib {
+	return &RouteServerClientRib{
+		logger:       locRib.logger,
+		locRib:       locRib,
+		neighborConf: neighborConf,
+		exportFilter: exportFilter,
+		destPathMap:  make(map[uint32]map[string]*Path),
+	}
+}
+
+func (r *RouteServerClientRib) isPathEligible(dest *Destination, path *Path) bool {
+	if r.exportFilter != nil && !r.exportFilter(dest, path) {
+		return false
+	}
+
+	if path.NeighborConf == nil {
+		return true
+	}
+
+	// Paths learned from the client are never sent back to it.
+	if path.NeighborConf.RunningConf.NeighborAddress.String() ==
+		r.neighborConf.RunningConf.NeighborAddress.String() {
+		return false
+	}
+
+	// The client would drop a path that has its own AS in the AS path.
+	if packet.HasASLoop(path.PathAttrs, r.neighborConf.RunningConf.PeerAS) {
+		return false
+	}
+
+	if path.NeighborConf.IsInternal() && r.neighborConf.IsInternal() && !r.neighborConf.CanReflect(path.NeighborConf) {
+		return false
+	}
+	return true
+}
+
+func (r *RouteServerClientRib) processDest(dest *Destination, updated map[uint32]map[*Path][]*Destination,
+	withdrawn []*Destination) (map[uint32]map[*Path][]*Destination, []*Destination) {
+	protoFamily := dest.GetProtocolFamily()
+	ip := dest.NLRI.GetPrefix().String()
+	oldPath, found := r.destPathMap[protoFamily][ip]
+	path := dest.SelectRouteForView(func(path *Path) bool {
+		return r.isPathEligible(dest, path)
+	})
+
+	if path == nil {
+		if found {
+			r.logger.Infof("Route server client %s: withdraw dest %s", r.neighborConf.Neighbor.NeighborAddress,
+				ip)
+			delete(r.destPathMap[protoFamily], ip)
+			withdrawn = append(withdrawn, dest)
+		}
+		return updated, withdrawn
+	}
+
+	if found && oldPath == path {
+		return updated, withdrawn
+	}
+
+	r.logger.Infof("Route server client %s: dest %s best path changed", r.neighborConf.Neighbor.NeighborAddress,
+		ip)
+	if _, ok := r.destPathMap[protoFamily]; !ok {
+		r.destPathMap[protoFamily] = make(map[string]*Path)
+	}
+	r.destPathMap[protoFamily][ip] = path
+
+	if _, ok := updated[protoFamily]; !ok {
+		updated[protoFamily] = make(map[*Path][]*Destination)
+	}
+	updated[protoFamily][path] = append(updated[protoFamily][path], dest)
+	return updated, withdrawn
+}
+
+func (r *RouteServerClientRib) GetPath(dest *Destination) *Path {
+	return r.destPathMap[dest.GetProtocolFamily()][dest.NLRI.GetPrefix().String()]
+}
+
+/*
+ * ProcessUpdates converts the updates of the Loc-RIB to the updates of the client's view. The destinations
+ * withdrawn from the Loc-RIB are withdrawn from the view as well, this includes the destinations suppressed
+ * by an aggregate. All the other updated or modified destinations run the best path selection for the client.
+ */
+func (r *RouteServerClientRib) ProcessUpdates(updated map[uint32]map[*Path][]*Destination, withdrawn,
+	modifiedDests []*Destination) (map[uint32]map[*Path][]*Destination, []*Destination) {
+	clientUpdated := make(map[uint32]map[*Path][]*Destination)
+	clientWithdrawn := make([]*Destination, 0)
+	processed := make(map[*Destination]bool)
+
+	for _, dest := range withdrawn {
+		if dest == nil {
+			continue
+		}
+		processed[dest] = true
+		protoFamily := dest.GetProtocolFamily()
+		ip := dest.NLRI.GetPrefix().String()
+		if _, ok := r.destPathMap[protoFamily][ip]; ok {
+			delete(r.destPathMap[protoFamily], ip)
+			clientWithdrawn = append(clientWithdrawn, dest)
+		}
+	}
+
+	for _, pathDestMap := range updated {
+		for _, destinations := range pathDestMap {
+			for _, dest := range destinations {
+				if dest != nil && !processed[dest] {
+					processed[dest] = true
+					clientUpdated, clientWithdrawn = r.processDest(dest, clientUpdated, clientWithdrawn)
+				}
+			}
+		}
+	}
+
+	for _, dest := range modifiedDests {
+		if !processed[dest] {
+			processed[dest] = true
+			clientUpdated, clientWithdrawn = r.processDest(dest, clientUpdated, clientWithdrawn)
+		}
+	}
+
+	return clientUpdated, clientWithdrawn
+}
@@ -22,7 +22,49 @@
 //                                                                                                           
 
 namespace go bgpdInt
+typedef i32 int
+
+struct BGPNeighborEvent {
+	1: string Time,
+	2: string FromState,
+	3: string ToState,
+	4: string Event,
+}
+struct BGPNotificationInfo {
+	1: string Time,
+	2: byte Code,
+	3: byte Subcode,
+	4: string Data,
+}
+struct BGPPrefixCounters {
+	1: string AfiSafiName,
+	2: i32 Received,
+	3: i32 Accepted,
+	4: i32 Advertised,
+}
+struct BGPNeighborStatistics {
+	1: string NeighborAddress,
+	2: i32 IfIndex,
+	3: i32 SessionState,
+	4: i64 Uptime,
+	5: i32 EstablishedTransitions,
+	6: i32 ConnectionAttempts,
+	7: string LastResetReason,
+	8: string LastResetTime,
+	9: BGPNotificationInfo LastNotificationSent,
+	10: BGPNotificationInfo LastNotificationRcvd,
+	11: list<BGPNeighborEvent> EventHistory,
+	12: list<BGPPrefixCounters> PrefixCounters,
+}
+struct BGPNeighborStatisticsGetInfo {
+	1: int StartIdx,
+	2: int EndIdx,
+	3: int Count,
+	4: bool More,
+	5: list<BGPNeighborStatistics> BGPNeighborStatisticsList,
+}
 
 service BGPDINTServices
 {
+	BGPNeighborStatisticsGetInfo GetBulkBGPNeighborStatistics(1: int fromIndex, 2: int count);
 }
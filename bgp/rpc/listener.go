@@ -26,14 +26,19 @@ package rpc
 
 import (
 	"bgpd"
+	"bgpdInt"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"l3/bgp/auth"
 	"l3/bgp/config"
+	"l3/bgp/packet"
 	bgppolicy "l3/bgp/policy"
 	"l3/bgp/server"
 	"models/objects"
 	"net"
 	"strings"
+	"time"
 	"utils/dbutils"
 	"utils/logging"
 	utilspolicy "utils/policy"
@@ -69,12 +74,19 @@ func NewBGPHandler(server *server.BGPServer, policyMgr *bgppolicy.BGPPolicyManag
 func (h *BGPHandler) convertModelToBGPGlobalConfig(obj objects.BGPGlobal) (config.GlobalConfig, error) {
 	var err error
 	gConf := config.GlobalConfig{
-		AS:                  obj.ASNum,
-		RouterId:            h.convertStrIPToNetIP(obj.RouterId),
-		UseMultiplePaths:    obj.UseMultiplePaths,
-		EBGPMaxPaths:        obj.EBGPMaxPaths,
-		EBGPAllowMultipleAS: obj.EBGPAllowMultipleAS,
-		IBGPMaxPaths:        obj.IBGPMaxPaths,
+		AS:                              obj.ASNum,
+		RouterId:                        h.convertStrIPToNetIP(obj.RouterId),
+		UseMultiplePaths:                obj.UseMultiplePaths,
+		EBGPMaxPaths:                    obj.EBGPMaxPaths,
+		EBGPAllowMultipleAS:             obj.EBGPAllowMultipleAS,
+		IBGPMaxPaths:                    obj.IBGPMaxPaths,
+		GracefulShutdown:                obj.GracefulShutdown,
+		GracefulShutdownTime:            uint32(obj.GracefulShutdownTime),
+		IPv4UnicastPIC:                  obj.IPv4UnicastPIC,
+		IPv6UnicastPIC:                  obj.IPv6UnicastPIC,
+		RouteReflectorClusterId:         uint32(obj.RouteReflectorClusterId),
+		DisableClientToClientReflection: obj.DisableClientToClientReflection,
+		DisableIntraClusterReflection:   obj.DisableIntraClusterReflection,
 	}
 	if obj.Redistribution != nil {
 		gConf.Redistribution = make([]config.SourcePolicyMap, 0)
@@ -83,6 +95,15 @@ func (h *BGPHandler) convertModelToBGPGlobalConfig(obj objects.BGPGlobal) (confi
 			gConf.Redistribution = append(gConf.Redistribution, redistribution)
 		}
 	}
+	for i := 0; i < len(obj.ORRGroups); i++ {
+		igpPosition := h.convertStrIPToNetIP(obj.ORRGroups[i].IGPPosition)
+		if igpPosition == nil || igpPosition.To4() == nil {
+			h.logger.Err("convertModelToBGPGlobalConfig - ORR group", obj.ORRGroups[i].Name,
+				"IGP position is not valid:", obj.ORRGroups[i].IGPPosition)
+			return gConf, config.IPError{obj.ORRGroups[i].IGPPosition}
+		}
+		gConf.ORRGroups = append(gConf.ORRGroups, config.ORRGroupConfig{obj.ORRGroups[i].Name, igpPosition})
+	}
 
 	if gConf.RouterId == nil {
 		h.logger.Err("convertModelToBGPGlobalConfig - IP is not valid:", obj.RouterId)
@@ -123,6 +144,7 @@ func (h *BGPHandler) convertModelToBGPPeerGroup(obj objects.BGPPeerGroup) (group
 			Description:             obj.Description,
 			RouteReflectorClusterId: uint32(obj.RouteReflectorClusterId),
 			RouteReflectorClient:    obj.RouteReflectorClient,
+			RouteServerClient:       obj.RouteServerClient,
 			MultiHopEnable:          obj.MultiHopEnable,
 			MultiHopTTL:             uint8(obj.MultiHopTTL),
 			ConnectRetryTime:        uint32(obj.ConnectRetryTime),
@@ -134,6 +156,13 @@ func (h *BGPHandler) convertModelToBGPPeerGroup(obj objects.BGPPeerGroup) (group
 			MaxPrefixesThresholdPct: uint8(obj.MaxPrefixesThresholdPct),
 			MaxPrefixesDisconnect:   obj.MaxPrefixesDisconnect,
 			MaxPrefixesRestartTimer: uint8(obj.MaxPrefixesRestartTimer),
+			GracefulShutdown:        obj.GracefulShutdown,
+			ORRGroup:                obj.ORRGroup,
+			Role:                    obj.Role,
+			StrictRole:              obj.StrictRole,
+			AuthType:                obj.AuthType,
+			AuthKeyChain:            obj.AuthKeyChain,
+			ExportPolicy:            obj.ExportPolicy,
 		},
 		Name: obj.Name,
 	}
@@ -158,12 +187,125 @@ func (h *BGPHandler) handlePeerGroup() error {
 			return err
 		}
 
+		if err = h.isValidExportPolicy(group.ExportPolicy); err != nil {
+			h.logger.Err("handlePeerGroup - Failed to create peer group", group.Name, "error:", err)
+			continue
+		}
+
 		h.server.AddPeerGroupCh <- server.PeerGroupUpdate{config.PeerGroupConfig{}, group, make([]bool, 0)}
 	}
 
 	return nil
 }
 
+func (h *BGPHandler) convertStrToTime(t string) (time.Time, error) {
+	if strings.TrimSpace(t) == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(t))
+}
+
+func (h *BGPHandler) convertToAuthKey(sendId, recvId int, algorithm, secret, sendStart, sendEnd, acceptStart,
+	acceptEnd string) (key config.AuthKey, err error) {
+	if sendId < 0 || sendId > 255 || recvId < 0 || recvId > 255 {
+		return key, errors.New(fmt.Sprintf("Key send id %d or receive id %d is not valid", sendId, recvId))
+	}
+
+	key = config.AuthKey{
+		SendId:    uint8(sendId),
+		RecvId:    uint8(recvId),
+		Algorithm: algorithm,
+		Secret:    secret,
+	}
+	if err = auth.ValidateKey(key); err != nil {
+		return key, err
+	}
+
+	lifetimes := []*time.Time{&key.SendLifetimeStart, &key.SendLifetimeEnd, &key.AcceptLifetimeStart,
+		&key.AcceptLifetimeEnd}
+	for idx, t := range []string{sendStart, sendEnd, acceptStart, acceptEnd} {
+		if *lifetimes[idx], err = h.convertStrToTime(t); err != nil {
+			return key, errors.New(fmt.Sprintf("Key %d lifetime %s is not valid", sendId, t))
+		}
+	}
+	return key, nil
+}
+
+func (h *BGPHandler) convertModelToBGPKeyChain(obj objects.BGPKeyChain) (keyChain config.KeyChainConfig, err error) {
+	keyChain = config.KeyChainConfig{
+		Name: obj.Name,
+		Keys: make([]config.AuthKey, 0, len(obj.Keys)),
+	}
+	for i := 0; i < len(obj.Keys); i++ {
+		key, err := h.convertToAuthKey(int(obj.Keys[i].SendId), int(obj.Keys[i].RecvId), obj.Keys[i].Algorithm,
+			obj.Keys[i].Secret, obj.Keys[i].SendLifetimeStart, obj.Keys[i].SendLifetimeEnd,
+			obj.Keys[i].AcceptLifetimeStart, obj.Keys[i].AcceptLifetimeEnd)
+		if err != nil {
+			return keyChain, err
+		}
+		keyChain.Keys = append(keyChain.Keys, key)
+	}
+	return keyChain, nil
+}
+
+func (h *BGPHandler) handleKeyChains() error {
+	var obj objects.BGPKeyChain
+	objList, err := h.dbUtil.GetAllObjFromDb(obj)
+	if err != nil {
+		h.logger.Errf("GetAllObjFromDb for BGPKeyChain failed with error %s", err)
+		return err
+	}
+
+	for _, confObj := range objList {
+		obj = confObj.(objects.BGPKeyChain)
+
+		keyChain, err := h.convertModelToBGPKeyChain(obj)
+		if err != nil {
+			h.logger.Err("handleKeyChains - Failed to convert Model object to BGP key chain, error:", err)
+			return err
+		}
+
+		h.server.AddKeyChainCh <- keyChain
+	}
+
+	return nil
+}
+
+/*  convertToAfiSafiConfigs converts the AFI/SAFI names of a neighbor to the AFI/SAFI
+ *  config and sets the default route config of the unicast address families. A
+ *  neighbor without AFI/SAFIs uses the unicast family of the neighbor address and
+ *  it is added to the config when the default route is sent.
+ */
+func convertToAfiSafiConfigs(afiSafis []string, neighborAddress net.IP, defRouteConf config.IPUnicast) (
+	[]config.AfiSafiConfig, error) {
+	if len(afiSafis) == 0 && defRouteConf.SendDefaultRoute {
+		if neighborAddress.To4() == nil {
+			afiSafis = []string{"ipv6-unicast"}
+		} else {
+			afiSafis = []string{"ipv4-unicast"}
+		}
+	}
+
+	afiSafiConfigs := make([]config.AfiSafiConfig, 0, len(afiSafis))
+	for _, afiSafi := range afiSafis {
+		if _, ok := packet.ProtocolFamilyMap[afiSafi]; !ok {
+			return nil, errors.New(fmt.Sprintf("AFI/SAFI %s not supported", afiSafi))
+		}
+		afiSafiConfig := config.AfiSafiConfig{
+			AfiSafiName:    afiSafi,
+			AfiSafiEnabled: true,
+		}
+		switch afiSafi {
+		case "ipv4-unicast":
+			afiSafiConfig.IPv4Unicast = defRouteConf
+		case "ipv6-unicast":
+			afiSafiConfig.IPv6Unicast = defRouteConf
+		}
+		afiSafiConfigs = append(afiSafiConfigs, afiSafiConfig)
+	}
+	return afiSafiConfigs, nil
+}
+
 func (h *BGPHandler) convertModelToBGPNeighbor(obj objects.BGPNeighbor) (neighbor config.NeighborConfig, err error) {
 	var ip net.IP
 	var ifIndex int32
@@ -174,6 +316,18 @@ func (h *BGPHandler) convertModelToBGPNeighbor(obj objects.BGPNeighbor) (neighbo
 		return neighbor, err
 	}
 
+	afiSafis, err := convertToAfiSafiConfigs(obj.AfiSafis, ip, config.IPUnicast{
+		SendDefaultRoute:      obj.SendDefaultRoute,
+		DefaultRouteMED:       uint32(obj.DefaultRouteMED),
+		DefaultRouteLocalPref: uint32(obj.DefaultRouteLocalPref),
+		DefaultRouteCondition: obj.DefaultRouteCondition,
+	})
+	if err != nil {
+		h.logger.Info("convertModelToBGPNeighbor: convertToAfiSafiConfigs failed for neighbor address",
+			obj.NeighborAddress, "error:", err)
+		return neighbor, err
+	}
+
 	neighbor = config.NeighborConfig{
 		BaseConfig: config.BaseConfig{
 			PeerAS:                  uint32(obj.PeerAS),
@@ -183,6 +337,7 @@ func (h *BGPHandler) convertModelToBGPNeighbor(obj objects.BGPNeighbor) (neighbo
 			Description:             obj.Description,
 			RouteReflectorClusterId: uint32(obj.RouteReflectorClusterId),
 			RouteReflectorClient:    obj.RouteReflectorClient,
+			RouteServerClient:       obj.RouteServerClient,
 			MultiHopEnable:          obj.MultiHopEnable,
 			MultiHopTTL:             uint8(obj.MultiHopTTL),
 			ConnectRetryTime:        uint32(obj.ConnectRetryTime),
@@ -196,10 +351,18 @@ func (h *BGPHandler) convertModelToBGPNeighbor(obj objects.BGPNeighbor) (neighbo
 			MaxPrefixesThresholdPct: uint8(obj.MaxPrefixesThresholdPct),
 			MaxPrefixesDisconnect:   obj.MaxPrefixesDisconnect,
 			MaxPrefixesRestartTimer: uint8(obj.MaxPrefixesRestartTimer),
+			GracefulShutdown:        obj.GracefulShutdown,
+			ORRGroup:                obj.ORRGroup,
+			Role:                    obj.Role,
+			StrictRole:              obj.StrictRole,
+			AuthType:                obj.AuthType,
+			AuthKeyChain:            obj.AuthKeyChain,
+			ExportPolicy:            obj.ExportPolicy,
 		},
 		NeighborAddress: ip,
 		IfIndex:         ifIndex,
 		PeerGroup:       obj.PeerGroup,
+		AfiSafis:        afiSafis,
 	}
 	return neighbor, err
 }
@@ -222,6 +385,12 @@ func (h *BGPHandler) handleNeighborConfig() error {
 			return err
 		}
 
+		if err = h.isValidExportPolicy(neighbor.ExportPolicy); err != nil {
+			h.logger.Err("handleNeighborConfig - Failed to create neighbor", neighbor.NeighborAddress,
+				"error:", err)
+			continue
+		}
+
 		h.server.AddPeerCh <- server.PeerUpdate{config.NeighborConfig{}, neighbor, make([]bool, 0)}
 	}
 
@@ -243,6 +412,17 @@ func convertModelToPolicyConditionConfig(
 	}
 }
 
+func convertModelToBGPPolicyCondition(cfg objects.BGPPolicyCondition) config.BGPPolicyCondition {
+	return config.BGPPolicyCondition{
+		Name:            cfg.Name,
+		ConditionType:   cfg.ConditionType,
+		ASPathList:      cfg.ASPathList,
+		AS:              uint32(cfg.AS),
+		MinASPathLength: uint32(cfg.MinASPathLength),
+		MaxASPathLength: uint32(cfg.MaxASPathLength),
+	}
+}
+
 func (h *BGPHandler) handlePolicyConditions() error {
 	h.logger.Info("handlePolicyConditions")
 	var conditionObj objects.BGPPolicyCondition
@@ -254,11 +434,55 @@ func (h *BGPHandler) handlePolicyConditions() error {
 	}
 
 	for idx := 0; idx < len(conditionList); idx++ {
-		policyCondCfg :=
-			convertModelToPolicyConditionConfig(conditionList[idx].(objects.BGPPolicyCondition))
-		h.logger.Info("handlePolicyConditions - create policy condition",
-			policyCondCfg.Name)
-		h.bgpPolicyMgr.ConditionCfgCh <- *policyCondCfg
+		conditionCfg := conditionList[idx].(objects.BGPPolicyCondition)
+		if isBGPPolicyConditionType(conditionCfg.ConditionType) {
+			h.logger.Info("handlePolicyConditions - create BGP policy condition", conditionCfg.Name)
+			err = h.bgpPolicyMgr.CreateBGPPolicyCondition(convertModelToBGPPolicyCondition(conditionCfg))
+		} else {
+			policyCondCfg := convertModelToPolicyConditionConfig(conditionCfg)
+			h.logger.Info("handlePolicyConditions - create policy condition",
+				policyCondCfg.Name)
+			err = h.bgpPolicyMgr.CreatePolicyCondition(*policyCondCfg)
+		}
+		if err != nil {
+			h.logger.Err("handlePolicyConditions - Failed to create policy condition",
+				conditionCfg.Name, "with error", err)
+		}
+	}
+	return nil
+}
+
+func convertModelToASPathList(cfg objects.BGPASPathList) config.ASPathList {
+	asPathList := config.ASPathList{
+		Name:    cfg.Name,
+		Entries: make([]config.ASPathListEntry, 0, len(cfg.Entries)),
+	}
+	for _, entry := range cfg.Entries {
+		asPathList.Entries = append(asPathList.Entries, config.ASPathListEntry{
+			Permit: entry.Permit,
+			Regex:  entry.Regex,
+		})
+	}
+	return asPathList
+}
+
+func (h *BGPHandler) handleASPathLists() error {
+	h.logger.Info("handleASPathLists")
+	var asPathListObj objects.BGPASPathList
+	asPathLists, err := h.dbUtil.GetAllObjFromDb(asPathListObj)
+	if err != nil {
+		h.logger.Err("handleASPathLists - Failed to create AS path list",
+			"config on restart with error", err)
+		return err
+	}
+
+	for idx := 0; idx < len(asPathLists); idx++ {
+		asPathList := convertModelToASPathList(asPathLists[idx].(objects.BGPASPathList))
+		h.logger.Info("handleASPathLists - create AS path list", asPathList.Name)
+		if err = h.bgpPolicyMgr.CreateASPathList(asPathList); err != nil {
+			h.logger.Err("handleASPathLists - Failed to create AS path list",
+				asPathList.Name, "with error", err)
+		}
 	}
 	return nil
 }
@@ -267,6 +491,8 @@ func convertModelToPolicyActionConfig(cfg objects.BGPPolicyAction) *utilspolicy.
 	return &utilspolicy.PolicyActionConfig{
 		Name:            cfg.Name,
 		ActionType:      cfg.ActionType,
+		Accept:          cfg.Accept,
+		Reject:          cfg.Reject,
 		GenerateASSet:   cfg.GenerateASSet,
 		SendSummaryOnly: cfg.SendSummaryOnly,
 	}
@@ -287,7 +513,10 @@ func (h *BGPHandler) handlePolicyActions() error {
 			convertModelToPolicyActionConfig(actionList[idx].(objects.BGPPolicyAction))
 		h.logger.Info("handlePolicyActions - create policy action",
 			policyActionCfg.Name)
-		h.bgpPolicyMgr.ActionCfgCh <- *policyActionCfg
+		if err = h.bgpPolicyMgr.CreatePolicyAction(*policyActionCfg); err != nil {
+			h.logger.Err("handlePolicyActions - Failed to create policy action",
+				policyActionCfg.Name, "with error", err)
+		}
 	}
 	return nil
 }
@@ -315,7 +544,10 @@ func (h *BGPHandler) handlePolicyStmts() error {
 		policyStmtCfg := convertModelToPolicyStmtConfig(stmtList[idx].(objects.BGPPolicyStmt))
 		h.logger.Info("handlePolicyStmts - create policy statement",
 			policyStmtCfg.Name)
-		h.bgpPolicyMgr.StmtCfgCh <- *policyStmtCfg
+		if err = h.bgpPolicyMgr.CreatePolicyStmt(*policyStmtCfg); err != nil {
+			h.logger.Err("handlePolicyStmts - Failed to create policy statement",
+				policyStmtCfg.Name, "with error", err)
+		}
 	}
 	return nil
 }
@@ -354,7 +586,10 @@ func (h *BGPHandler) handlePolicyDefinitions() error {
 			definitionList[idx].(objects.BGPPolicyDefinition))
 		h.logger.Info("handlePolicyDefinitions - create policy definition",
 			policyDefCfg.Name)
-		h.bgpPolicyMgr.DefinitionCfgCh <- *policyDefCfg
+		if err = h.bgpPolicyMgr.CreatePolicyDefinition(*policyDefCfg); err != nil {
+			h.logger.Err("handlePolicyDefinitions - Failed to create policy definition",
+				policyDefCfg.Name, "with error", err)
+		}
 	}
 	return nil
 }
@@ -362,6 +597,10 @@ func (h *BGPHandler) handlePolicyDefinitions() error {
 func (h *BGPHandler) readConfigFromDB(filePath string) error {
 	var err error
 
+	if err = h.handleASPathLists(); err != nil {
+		return err
+	}
+
 	if err = h.handlePolicyConditions(); err != nil {
 		return err
 	}
@@ -382,6 +621,10 @@ func (h *BGPHandler) readConfigFromDB(filePath string) error {
 		return err
 	}
 
+	if err = h.handleKeyChains(); err != nil {
+		return err
+	}
+
 	if err = h.handlePeerGroup(); err != nil {
 		return err
 	}
@@ -414,12 +657,19 @@ func (h *BGPHandler) validateBGPGlobal(bgpGlobal *bgpd.BGPGlobal) (gConf config.
 	}
 
 	gConf = config.GlobalConfig{
-		AS:                  uint32(bgpGlobal.ASNum),
-		RouterId:            ip,
-		UseMultiplePaths:    bgpGlobal.UseMultiplePaths,
-		EBGPMaxPaths:        uint32(bgpGlobal.EBGPMaxPaths),
-		EBGPAllowMultipleAS: bgpGlobal.EBGPAllowMultipleAS,
-		IBGPMaxPaths:        uint32(bgpGlobal.IBGPMaxPaths),
+		AS:                              uint32(bgpGlobal.ASNum),
+		RouterId:                        ip,
+		UseMultiplePaths:                bgpGlobal.UseMultiplePaths,
+		EBGPMaxPaths:                    uint32(bgpGlobal.EBGPMaxPaths),
+		EBGPAllowMultipleAS:             bgpGlobal.EBGPAllowMultipleAS,
+		IBGPMaxPaths:                    uint32(bgpGlobal.IBGPMaxPaths),
+		GracefulShutdown:                bgpGlobal.GracefulShutdown,
+		GracefulShutdownTime:            uint32(bgpGlobal.GracefulShutdownTime),
+		IPv4UnicastPIC:                  bgpGlobal.IPv4UnicastPIC,
+		IPv6UnicastPIC:                  bgpGlobal.IPv6UnicastPIC,
+		RouteReflectorClusterId:         uint32(bgpGlobal.RouteReflectorClusterId),
+		DisableClientToClientReflection: bgpGlobal.DisableClientToClientReflection,
+		DisableIntraClusterReflection:   bgpGlobal.DisableIntraClusterReflection,
 	}
 	if bgpGlobal.Redistribution != nil {
 		gConf.Redistribution = make([]config.SourcePolicyMap, 0)
@@ -428,6 +678,15 @@ func (h *BGPHandler) validateBGPGlobal(bgpGlobal *bgpd.BGPGlobal) (gConf config.
 			gConf.Redistribution = append(gConf.Redistribution, redistribution)
 		}
 	}
+	for i := 0; i < len(bgpGlobal.ORRGroups); i++ {
+		igpPosition := h.convertStrIPToNetIP(bgpGlobal.ORRGroups[i].IGPPosition)
+		if igpPosition == nil || igpPosition.To4() == nil {
+			err = errors.New(fmt.Sprintf("BGPGlobal: ORR group %s IGP position %s is not valid",
+				bgpGlobal.ORRGroups[i].Name, bgpGlobal.ORRGroups[i].IGPPosition))
+			return gConf, err
+		}
+		gConf.ORRGroups = append(gConf.ORRGroups, config.ORRGroupConfig{bgpGlobal.ORRGroups[i].Name, igpPosition})
+	}
 	return gConf, nil
 }
 
@@ -462,6 +721,13 @@ func (h *BGPHandler) GetBGPGlobalState(rtrId string) (*bgpd.BGPGlobalState, erro
 	bgpGlobalResponse.IBGPMaxPaths = int32(bgpGlobal.IBGPMaxPaths)
 	bgpGlobalResponse.TotalPaths = int32(bgpGlobal.TotalPaths)
 	bgpGlobalResponse.TotalPrefixes = int32(bgpGlobal.TotalPrefixes)
+	bgpGlobalResponse.GracefulShutdown = bgpGlobal.GracefulShutdown
+	bgpGlobalResponse.GracefulShutdownTime = int32(bgpGlobal.GracefulShutdownTime)
+	bgpGlobalResponse.IPv4UnicastPIC = bgpGlobal.IPv4UnicastPIC
+	bgpGlobalResponse.IPv6UnicastPIC = bgpGlobal.IPv6UnicastPIC
+	bgpGlobalResponse.RouteReflectorClusterId = int32(bgpGlobal.RouteReflectorClusterId)
+	bgpGlobalResponse.DisableClientToClientReflection = bgpGlobal.DisableClientToClientReflection
+	bgpGlobalResponse.DisableIntraClusterReflection = bgpGlobal.DisableIntraClusterReflection
 	return bgpGlobalResponse, nil
 }
 
@@ -551,8 +817,37 @@ func (h *BGPHandler) isValidIP(ip string) bool {
 	return true
 }
 
+func (h *BGPHandler) isValidAuth(authType string, keyChain string) error {
+	switch authType {
+	case "", config.AuthTypeNone, config.AuthTypeMD5:
+		return nil
+	case config.AuthTypeAO:
+		if keyChain == "" {
+			return errors.New("Key chain is not set for TCP-AO authentication")
+		}
+		return nil
+	}
+	return errors.New(fmt.Sprintf("Authentication type %s not valid", authType))
+}
+
+func (h *BGPHandler) isValidRole(role string) bool {
+	if role == "" {
+		return true
+	}
+
+	_, ok := packet.BGPRoleStrToTypeMap[role]
+	return ok
+}
+
 // Set BGP Default values.. This needs to move to API Layer once Northbound interfaces are implemented
 // for all the listeners
+func (h *BGPHandler) isValidExportPolicy(exportPolicy string) error {
+	if exportPolicy == "" {
+		return nil
+	}
+	return h.server.ValidateExportPolicy(exportPolicy)
+}
+
 func (h *BGPHandler) setDefault(pconf *config.NeighborConfig) {
 	if pconf.BaseConfig.HoldTime == 0 { // default hold time is 180 seconds
 		pconf.BaseConfig.HoldTime = 180
@@ -583,6 +878,25 @@ func (h *BGPHandler) ValidateBGPNeighbor(bgpNeighbor *bgpd.BGPNeighbor) (pConf c
 		return pConf, err
 	}
 
+	if !h.isValidRole(bgpNeighbor.Role) {
+		err = errors.New(fmt.Sprintf("Role %s not a valid BGP role", bgpNeighbor.Role))
+		return pConf, err
+	}
+
+	if err = h.isValidAuth(bgpNeighbor.AuthType, bgpNeighbor.AuthKeyChain); err != nil {
+		return pConf, err
+	}
+
+	afiSafis, err := convertToAfiSafiConfigs(bgpNeighbor.AfiSafis, ip, config.IPUnicast{
+		SendDefaultRoute:      bgpNeighbor.SendDefaultRoute,
+		DefaultRouteMED:       uint32(bgpNeighbor.DefaultRouteMED),
+		DefaultRouteLocalPref: uint32(bgpNeighbor.DefaultRouteLocalPref),
+		DefaultRouteCondition: bgpNeighbor.DefaultRouteCondition,
+	})
+	if err != nil {
+		return pConf, err
+	}
+
 	pConf = config.NeighborConfig{
 		BaseConfig: config.BaseConfig{
 			PeerAS:                  uint32(bgpNeighbor.PeerAS),
@@ -592,6 +906,7 @@ func (h *BGPHandler) ValidateBGPNeighbor(bgpNeighbor *bgpd.BGPNeighbor) (pConf c
 			Description:             bgpNeighbor.Description,
 			RouteReflectorClusterId: uint32(bgpNeighbor.RouteReflectorClusterId),
 			RouteReflectorClient:    bgpNeighbor.RouteReflectorClient,
+			RouteServerClient:       bgpNeighbor.RouteServerClient,
 			MultiHopEnable:          bgpNeighbor.MultiHopEnable,
 			MultiHopTTL:             uint8(bgpNeighbor.MultiHopTTL),
 			ConnectRetryTime:        uint32(bgpNeighbor.ConnectRetryTime),
@@ -605,10 +920,18 @@ func (h *BGPHandler) ValidateBGPNeighbor(bgpNeighbor *bgpd.BGPNeighbor) (pConf c
 			MaxPrefixesThresholdPct: uint8(bgpNeighbor.MaxPrefixesThresholdPct),
 			MaxPrefixesDisconnect:   bgpNeighbor.MaxPrefixesDisconnect,
 			MaxPrefixesRestartTimer: uint8(bgpNeighbor.MaxPrefixesRestartTimer),
+			GracefulShutdown:        bgpNeighbor.GracefulShutdown,
+			ORRGroup:                bgpNeighbor.ORRGroup,
+			Role:                    bgpNeighbor.Role,
+			StrictRole:              bgpNeighbor.StrictRole,
+			AuthType:                bgpNeighbor.AuthType,
+			AuthKeyChain:            bgpNeighbor.AuthKeyChain,
+			ExportPolicy:            bgpNeighbor.ExportPolicy,
 		},
 		NeighborAddress: ip,
 		IfIndex:         ifIndex,
 		PeerGroup:       bgpNeighbor.PeerGroup,
+		AfiSafis:        afiSafis,
 	}
 	h.setDefault(&pConf)
 	return pConf, err
@@ -632,6 +955,10 @@ func (h *BGPHandler) SendBGPNeighbor(oldNeighbor *bgpd.BGPNeighbor,
 		return false, err
 	}
 
+	if err = h.isValidExportPolicy(newNeighConf.ExportPolicy); err != nil {
+		return false, err
+	}
+
 	h.server.AddPeerCh <- server.PeerUpdate{oldNeighConf, newNeighConf, attrSet}
 	return true, nil
 }
@@ -654,6 +981,20 @@ func (h *BGPHandler) convertToThriftNeighbor(neighborState *config.NeighborState
 	bgpNeighborResponse.SessionState = int32(neighborState.SessionState)
 	bgpNeighborResponse.RouteReflectorClusterId = int32(neighborState.RouteReflectorClusterId)
 	bgpNeighborResponse.RouteReflectorClient = neighborState.RouteReflectorClient
+	bgpNeighborResponse.RouteServerClient = neighborState.RouteServerClient
+	bgpNeighborResponse.GracefulShutdown = neighborState.GracefulShutdown
+	bgpNeighborResponse.ORRGroup = neighborState.ORRGroup
+	bgpNeighborResponse.OriginatorIdLoops = int32(neighborState.OriginatorIdLoops)
+	bgpNeighborResponse.ClusterListLoops = int32(neighborState.ClusterListLoops)
+	bgpNeighborResponse.Role = neighborState.Role
+	bgpNeighborResponse.StrictRole = neighborState.StrictRole
+	bgpNeighborResponse.PeerRole = neighborState.PeerRole
+	bgpNeighborResponse.RouteLeaksDropped = int32(neighborState.RouteLeaksDropped)
+	bgpNeighborResponse.AuthType = neighborState.AuthType
+	bgpNeighborResponse.AuthKeyChain = neighborState.AuthKeyChain
+	bgpNeighborResponse.ExportPolicy = neighborState.ExportPolicy
+	bgpNeighborResponse.AuthActiveKeyId = neighborState.AuthActiveKeyId
+	bgpNeighborResponse.ShutdownMessage = neighborState.ShutdownMessage
 	bgpNeighborResponse.MultiHopEnable = neighborState.MultiHopEnable
 	bgpNeighborResponse.MultiHopTTL = int8(neighborState.MultiHopTTL)
 	bgpNeighborResponse.ConnectRetryTime = int32(neighborState.ConnectRetryTime)
@@ -723,6 +1064,85 @@ func (h *BGPHandler) GetBulkBGPNeighborState(index bgpd.Int,
 	return bgpNeighborStateBulk, nil
 }
 
+func convertTimeToStr(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.String()
+}
+
+func convertToNotificationInfo(notif config.NotificationInfo) *bgpdInt.BGPNotificationInfo {
+	return &bgpdInt.BGPNotificationInfo{
+		Time:    convertTimeToStr(notif.Time),
+		Code:    int8(notif.Code),
+		Subcode: int8(notif.Subcode),
+		Data:    hex.EncodeToString(notif.Data),
+	}
+}
+
+func (h *BGPHandler) convertToNeighborStatistics(neighborState *config.NeighborState) *bgpdInt.BGPNeighborStatistics {
+	stats := &neighborState.Statistics
+	neighborStats := &bgpdInt.BGPNeighborStatistics{
+		NeighborAddress:        neighborState.NeighborAddress.String(),
+		IfIndex:                neighborState.IfIndex,
+		SessionState:           int32(neighborState.SessionState),
+		EstablishedTransitions: int32(stats.EstablishedTransitions),
+		ConnectionAttempts:     int32(stats.ConnectionAttempts),
+		LastResetReason:        stats.LastResetReason,
+		LastResetTime:          convertTimeToStr(stats.LastResetTime),
+		LastNotificationSent:   convertToNotificationInfo(stats.LastNotificationSent),
+		LastNotificationRcvd:   convertToNotificationInfo(stats.LastNotificationRcvd),
+		EventHistory:           make([]*bgpdInt.BGPNeighborEvent, 0, len(stats.EventHistory)),
+		PrefixCounters:         make([]*bgpdInt.BGPPrefixCounters, 0, len(stats.PrefixCounters)),
+	}
+
+	if config.BGPFSMState(neighborState.SessionState) == config.BGPFSMEstablished {
+		neighborStats.Uptime = int64(time.Since(stats.EstablishedTime).Seconds())
+	}
+
+	for _, event := range stats.EventHistory {
+		neighborStats.EventHistory = append(neighborStats.EventHistory, &bgpdInt.BGPNeighborEvent{
+			Time:      convertTimeToStr(event.Time),
+			FromState: config.GetBGPStateToStr(event.FromState),
+			ToState:   config.GetBGPStateToStr(event.ToState),
+			Event:     event.Event,
+		})
+	}
+
+	for afiSafiName, protoFamily := range packet.ProtocolFamilyMap {
+		if counters, ok := stats.PrefixCounters[protoFamily]; ok {
+			neighborStats.PrefixCounters = append(neighborStats.PrefixCounters, &bgpdInt.BGPPrefixCounters{
+				AfiSafiName: afiSafiName,
+				Received:    int32(counters.Received),
+				Accepted:    int32(counters.Accepted),
+				Advertised:  int32(counters.Advertised),
+			})
+		}
+	}
+
+	return neighborStats
+}
+
+/*  The statistics are copied under the neighbor statistics lock, the FSM and the server goroutines keep
+ *  updating them while the response is built.
+ */
+func (h *BGPHandler) GetBulkBGPNeighborStatistics(index bgpdInt.Int,
+	count bgpdInt.Int) (*bgpdInt.BGPNeighborStatisticsGetInfo, error) {
+	nextIdx, currCount, bgpNeighbors := h.server.BulkGetBGPNeighborStatistics(int(index), int(count))
+	neighborStatsList := make([]*bgpdInt.BGPNeighborStatistics, len(bgpNeighbors))
+	for idx, item := range bgpNeighbors {
+		neighborStatsList[idx] = h.convertToNeighborStatistics(item)
+	}
+
+	neighborStatsBulk := bgpdInt.NewBGPNeighborStatisticsGetInfo()
+	neighborStatsBulk.StartIdx = index
+	neighborStatsBulk.EndIdx = bgpdInt.Int(nextIdx)
+	neighborStatsBulk.Count = bgpdInt.Int(currCount)
+	neighborStatsBulk.More = (nextIdx != 0)
+	neighborStatsBulk.BGPNeighborStatisticsList = neighborStatsList
+	return neighborStatsBulk, nil
+}
+
 func (h *BGPHandler) UpdateBGPNeighbor(origN *bgpd.BGPNeighbor, updatedN *bgpd.BGPNeighbor,
 	attrSet []bool, op []*bgpd.PatchOpInfo) (bool, error) {
 	h.logger.Info("Update peer attrs:", updatedN)
@@ -760,6 +1180,15 @@ func (h *BGPHandler) ValidateBGPPeerGroup(peerGroup *bgpd.BGPPeerGroup) (group c
 		return group, err
 	}
 
+	if !h.isValidRole(peerGroup.Role) {
+		err = errors.New(fmt.Sprintf("Role %s not a valid BGP role", peerGroup.Role))
+		return group, err
+	}
+
+	if err = h.isValidAuth(peerGroup.AuthType, peerGroup.AuthKeyChain); err != nil {
+		return group, err
+	}
+
 	group = config.PeerGroupConfig{
 		BaseConfig: config.BaseConfig{
 			PeerAS:                  uint32(peerGroup.PeerAS),
@@ -769,6 +1198,7 @@ func (h *BGPHandler) ValidateBGPPeerGroup(peerGroup *bgpd.BGPPeerGroup) (group c
 			Description:             peerGroup.Description,
 			RouteReflectorClusterId: uint32(peerGroup.RouteReflectorClusterId),
 			RouteReflectorClient:    peerGroup.RouteReflectorClient,
+			RouteServerClient:       peerGroup.RouteServerClient,
 			MultiHopEnable:          peerGroup.MultiHopEnable,
 			MultiHopTTL:             uint8(peerGroup.MultiHopTTL),
 			ConnectRetryTime:        uint32(peerGroup.ConnectRetryTime),
@@ -780,6 +1210,13 @@ func (h *BGPHandler) ValidateBGPPeerGroup(peerGroup *bgpd.BGPPeerGroup) (group c
 			MaxPrefixesThresholdPct: uint8(peerGroup.MaxPrefixesThresholdPct),
 			MaxPrefixesDisconnect:   peerGroup.MaxPrefixesDisconnect,
 			MaxPrefixesRestartTimer: uint8(peerGroup.MaxPrefixesRestartTimer),
+			GracefulShutdown:        peerGroup.GracefulShutdown,
+			ORRGroup:                peerGroup.ORRGroup,
+			Role:                    peerGroup.Role,
+			StrictRole:              peerGroup.StrictRole,
+			AuthType:                peerGroup.AuthType,
+			AuthKeyChain:            peerGroup.AuthKeyChain,
+			ExportPolicy:            peerGroup.ExportPolicy,
 		},
 		Name: peerGroup.Name,
 	}
@@ -800,6 +1237,10 @@ func (h *BGPHandler) SendBGPPeerGroup(oldGroup *bgpd.BGPPeerGroup,
 		return false, err
 	}
 
+	if err = h.isValidExportPolicy(newGroupConf.ExportPolicy); err != nil {
+		return false, err
+	}
+
 	h.server.AddPeerGroupCh <- server.PeerGroupUpdate{oldGroupConf, newGroupConf, attrSet}
 	return true, nil
 }
@@ -858,13 +1299,42 @@ func convertThriftToPolicyConditionConfig(
 	}
 }
 
+func convertThriftToBGPPolicyCondition(cfg *bgpd.BGPPolicyCondition) config.BGPPolicyCondition {
+	return config.BGPPolicyCondition{
+		Name:            cfg.Name,
+		ConditionType:   cfg.ConditionType,
+		ASPathList:      cfg.ASPathList,
+		AS:              uint32(cfg.AS),
+		MinASPathLength: uint32(cfg.MinASPathLength),
+		MaxASPathLength: uint32(cfg.MaxASPathLength),
+	}
+}
+
+func isBGPPolicyConditionType(conditionType string) bool {
+	switch conditionType {
+	case bgppolicy.BGPConditionTypeASPathMatch, bgppolicy.BGPConditionTypeOriginASMatch,
+		bgppolicy.BGPConditionTypeNeighborASMatch, bgppolicy.BGPConditionTypeASPathLengthMatch:
+		return true
+	}
+	return false
+}
+
 func (h *BGPHandler) CreateBGPPolicyCondition(cfg *bgpd.BGPPolicyCondition) (val bool, err error) {
 	h.logger.Info("CreatePolicyConditioncfg")
-	switch cfg.ConditionType {
-	case "MatchDstIpPrefix":
+	switch {
+	case cfg.ConditionType == "MatchDstIpPrefix":
 		policyCfg := convertThriftToPolicyConditionConfig(cfg)
-		val = true
-		h.bgpPolicyMgr.ConditionCfgCh <- *policyCfg
+		err = h.bgpPolicyMgr.CreatePolicyCondition(*policyCfg)
+		val = err == nil
+		break
+	case isBGPPolicyConditionType(cfg.ConditionType):
+		condCfg := convertThriftToBGPPolicyCondition(cfg)
+		if err = bgppolicy.ValidateBGPPolicyCondition(condCfg); err != nil {
+			h.logger.Info("CreateBGPPolicyCondition - invalid condition", cfg.Name, "error", err)
+			break
+		}
+		err = h.bgpPolicyMgr.CreateBGPPolicyCondition(condCfg)
+		val = err == nil
 		break
 	default:
 		h.logger.Info("Unknown condition type ", cfg.ConditionType)
@@ -891,14 +1361,16 @@ func (h *BGPHandler) UpdateBGPPolicyCondition(origC *bgpd.BGPPolicyCondition,
 }
 
 func (h *BGPHandler) DeleteBGPPolicyCondition(cfg *bgpd.BGPPolicyCondition) (val bool, err error) {
-	h.bgpPolicyMgr.ConditionDelCh <- cfg.Name
-	return val, err
+	err = h.bgpPolicyMgr.DeletePolicyCondition(cfg.Name)
+	return err == nil, err
 }
 
 func convertThriftToPolicyActionConfig(cfg *bgpd.BGPPolicyAction) *utilspolicy.PolicyActionConfig {
 	return &utilspolicy.PolicyActionConfig{
 		Name:            cfg.Name,
 		ActionType:      cfg.ActionType,
+		Accept:          cfg.Accept,
+		Reject:          cfg.Reject,
 		GenerateASSet:   cfg.GenerateASSet,
 		SendSummaryOnly: cfg.SendSummaryOnly,
 	}
@@ -907,10 +1379,10 @@ func convertThriftToPolicyActionConfig(cfg *bgpd.BGPPolicyAction) *utilspolicy.P
 func (h *BGPHandler) CreateBGPPolicyAction(cfg *bgpd.BGPPolicyAction) (val bool, err error) {
 	h.logger.Info("CreatePolicyAction")
 	switch cfg.ActionType {
-	case "Aggregate":
+	case bgppolicy.PolicyActionTypeAggregate, bgppolicy.PolicyActionTypeRouteDisposition:
 		actionCfg := convertThriftToPolicyActionConfig(cfg)
-		val = true
-		h.bgpPolicyMgr.ActionCfgCh <- *actionCfg
+		err = h.bgpPolicyMgr.CreatePolicyAction(*actionCfg)
+		val = err == nil
 		break
 	default:
 		h.logger.Info("Unknown action type ", cfg.ActionType)
@@ -936,8 +1408,53 @@ func (h *BGPHandler) UpdateBGPPolicyAction(origC *bgpd.BGPPolicyAction, updatedC
 }
 
 func (h *BGPHandler) DeleteBGPPolicyAction(cfg *bgpd.BGPPolicyAction) (val bool, err error) {
-	h.bgpPolicyMgr.ActionDelCh <- cfg.Name
-	return val, err
+	err = h.bgpPolicyMgr.DeletePolicyAction(cfg.Name)
+	return err == nil, err
+}
+
+func convertThriftToASPathList(cfg *bgpd.BGPASPathList) config.ASPathList {
+	asPathList := config.ASPathList{
+		Name:    cfg.Name,
+		Entries: make([]config.ASPathListEntry, 0, len(cfg.Entries)),
+	}
+	for _, entry := range cfg.Entries {
+		asPathList.Entries = append(asPathList.Entries, config.ASPathListEntry{
+			Permit: entry.Permit,
+			Regex:  entry.Regex,
+		})
+	}
+	return asPathList
+}
+
+func (h *BGPHandler) CreateBGPASPathList(cfg *bgpd.BGPASPathList) (val bool, err error) {
+	h.logger.Info("CreateBGPASPathList", cfg.Name)
+	asPathList := convertThriftToASPathList(cfg)
+	if _, err = bgppolicy.NewASPathList(asPathList); err != nil {
+		h.logger.Info("CreateBGPASPathList - invalid AS path list", cfg.Name, "error", err)
+		return false, err
+	}
+
+	err = h.bgpPolicyMgr.CreateASPathList(asPathList)
+	return err == nil, err
+}
+
+func (h *BGPHandler) UpdateBGPASPathList(origCfg *bgpd.BGPASPathList, updatedCfg *bgpd.BGPASPathList,
+	attrSet []bool, op []*bgpd.PatchOpInfo) (val bool, err error) {
+	h.logger.Info("UpdateBGPASPathList", origCfg.Name)
+	asPathList := convertThriftToASPathList(updatedCfg)
+	if _, err = bgppolicy.NewASPathList(asPathList); err != nil {
+		h.logger.Info("UpdateBGPASPathList - invalid AS path list", updatedCfg.Name, "error", err)
+		return false, err
+	}
+
+	err = h.bgpPolicyMgr.CreateASPathList(asPathList)
+	return err == nil, err
+}
+
+func (h *BGPHandler) DeleteBGPASPathList(cfg *bgpd.BGPASPathList) (val bool, err error) {
+	h.logger.Info("DeleteBGPASPathList", cfg.Name)
+	err = h.bgpPolicyMgr.DeleteASPathList(cfg.Name)
+	return err == nil, err
 }
 
 func convertThriftToPolicyStmtConfig(cfg *bgpd.BGPPolicyStmt) *utilspolicy.PolicyStmtConfig {
@@ -951,10 +1468,9 @@ func convertThriftToPolicyStmtConfig(cfg *bgpd.BGPPolicyStmt) *utilspolicy.Polic
 
 func (h *BGPHandler) CreateBGPPolicyStmt(cfg *bgpd.BGPPolicyStmt) (val bool, err error) {
 	h.logger.Info("CreatePolicyStmt")
-	val = true
 	stmtCfg := convertThriftToPolicyStmtConfig(cfg)
-	h.bgpPolicyMgr.StmtCfgCh <- *stmtCfg
-	return val, err
+	err = h.bgpPolicyMgr.CreatePolicyStmt(*stmtCfg)
+	return err == nil, err
 }
 
 func (h *BGPHandler) GetBGPPolicyStmtState(name string) (*bgpd.BGPPolicyStmtState, error) {
@@ -975,9 +1491,8 @@ func (h *BGPHandler) UpdateBGPPolicyStmt(origC *bgpd.BGPPolicyStmt,
 }
 
 func (h *BGPHandler) DeleteBGPPolicyStmt(cfg *bgpd.BGPPolicyStmt) (val bool, err error) {
-	//return policy.DeleteBGPPolicyStmt(name)
-	h.bgpPolicyMgr.StmtDelCh <- cfg.Name
-	return true, nil
+	err = h.bgpPolicyMgr.DeletePolicyStmt(cfg.Name)
+	return err == nil, err
 }
 
 func convertThriftToPolicyDefintionConfig(
@@ -1001,10 +1516,9 @@ func convertThriftToPolicyDefintionConfig(
 
 func (h *BGPHandler) CreateBGPPolicyDefinition(cfg *bgpd.BGPPolicyDefinition) (val bool, err error) {
 	h.logger.Info("CreatePolicyDefinition")
-	val = true
 	definitionCfg := convertThriftToPolicyDefintionConfig(cfg)
-	h.bgpPolicyMgr.DefinitionCfgCh <- *definitionCfg
-	return val, err
+	err = h.bgpPolicyMgr.CreatePolicyDefinition(*definitionCfg)
+	return err == nil, err
 }
 
 func (h *BGPHandler) GetBGPPolicyDefinitionState(name string) (*bgpd.BGPPolicyDefinitionState, error) {
@@ -1025,8 +1539,8 @@ func (h *BGPHandler) UpdateBGPPolicyDefinition(origC *bgpd.BGPPolicyDefinition,
 }
 
 func (h *BGPHandler) DeleteBGPPolicyDefinition(cfg *bgpd.BGPPolicyDefinition) (val bool, err error) {
-	h.bgpPolicyMgr.DefinitionDelCh <- cfg.Name
-	return val, err
+	err = h.bgpPolicyMgr.DeletePolicyDefinition(cfg.Name)
+	return err == nil, err
 }
 
 func (h *BGPHandler) validateBGPAggregate(bgpAgg *bgpd.BGPAggregate) (aggConf config.BGPAggregate, err error) {
@@ -1081,3 +1595,55 @@ func (h *BGPHandler) DeleteBGPAggregate(bgpAgg *bgpd.BGPAggregate) (bool, error)
 	h.server.RemAggCh <- bgpAgg.IpPrefix
 	return true, nil
 }
+
+func (h *BGPHandler) validateBGPKeyChain(bgpKeyChain *bgpd.BGPKeyChain) (keyChain config.KeyChainConfig, err error) {
+	if bgpKeyChain == nil {
+		return keyChain, err
+	}
+
+	keyChain = config.KeyChainConfig{
+		Name: bgpKeyChain.Name,
+		Keys: make([]config.AuthKey, 0, len(bgpKeyChain.Keys)),
+	}
+	for i := 0; i < len(bgpKeyChain.Keys); i++ {
+		key, err := h.convertToAuthKey(int(bgpKeyChain.Keys[i].SendId), int(bgpKeyChain.Keys[i].RecvId),
+			bgpKeyChain.Keys[i].Algorithm, bgpKeyChain.Keys[i].Secret, bgpKeyChain.Keys[i].SendLifetimeStart,
+			bgpKeyChain.Keys[i].SendLifetimeEnd, bgpKeyChain.Keys[i].AcceptLifetimeStart,
+			bgpKeyChain.Keys[i].AcceptLifetimeEnd)
+		if err != nil {
+			h.logger.Info("validateBGPKeyChain: Key chain", bgpKeyChain.Name, "key is not valid, error:", err)
+			return keyChain, err
+		}
+		keyChain.Keys = append(keyChain.Keys, key)
+	}
+	return keyChain, nil
+}
+
+func (h *BGPHandler) CreateBGPKeyChain(bgpKeyChain *bgpd.BGPKeyChain) (bool, error) {
+	h.logger.Info("Create key chain:", bgpKeyChain.Name)
+	keyChain, err := h.validateBGPKeyChain(bgpKeyChain)
+	if err != nil {
+		return false, err
+	}
+
+	h.server.AddKeyChainCh <- keyChain
+	return true, nil
+}
+
+func (h *BGPHandler) UpdateBGPKeyChain(origK *bgpd.BGPKeyChain, updatedK *bgpd.BGPKeyChain, attrSet []bool,
+	op []*bgpd.PatchOpInfo) (bool, error) {
+	h.logger.Info("Update key chain:", updatedK.Name)
+	keyChain, err := h.validateBGPKeyChain(updatedK)
+	if err != nil {
+		return false, err
+	}
+
+	h.server.AddKeyChainCh <- keyChain
+	return true, nil
+}
+
+func (h *BGPHandler) DeleteBGPKeyChain(bgpKeyChain *bgpd.BGPKeyChain) (bool, error) {
+	h.logger.Info("Delete key chain:", bgpKeyChain.Name)
+	h.server.RemKeyChainCh <- bgpKeyChain.Name
+	return true, nil
+}
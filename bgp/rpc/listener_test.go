@@ -0,0 +1,109 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// listener_test.go
+package rpc
+
+import (
+	"l3/bgp/baseobjects"
+	"l3/bgp/config"
+	"l3/bgp/packet"
+	"net"
+	"testing"
+	"utils/logging"
+)
+
+func TestNeighborDefaultRouteConfig(t *testing.T) {
+	logger, err := logging.NewLogger("bgpd", "BGP", true)
+	if err != nil {
+		t.Fatal("Failed to start the logger. Exiting!!")
+	}
+
+	defRouteConf := config.IPUnicast{
+		SendDefaultRoute:      true,
+		DefaultRouteMED:       10,
+		DefaultRouteLocalPref: 200,
+		DefaultRouteCondition: "cond1",
+	}
+	tests := []struct {
+		name         string
+		address      string
+		afiSafis     []string
+		defRouteConf config.IPUnicast
+		expected     []string
+		expectedErr  bool
+	}{
+		{"IPv4 neighbor without AFI/SAFIs", "10.1.1.1", nil, defRouteConf, []string{"ipv4-unicast"}, false},
+		{"IPv6 neighbor without AFI/SAFIs", "2001:db8::1", nil, defRouteConf, []string{"ipv6-unicast"}, false},
+		{"IPv4 and IPv6 unicast", "10.1.1.1", []string{"ipv4-unicast", "ipv6-unicast"}, defRouteConf,
+			[]string{"ipv4-unicast", "ipv6-unicast"}, false},
+		{"Link state only", "10.1.1.1", []string{"link-state"}, defRouteConf, []string{"link-state"}, false},
+		{"Default route not sent", "10.1.1.1", nil, config.IPUnicast{}, []string{}, false},
+		{"Unknown AFI/SAFI", "10.1.1.1", []string{"ipv4-foo"}, defRouteConf, nil, true},
+	}
+
+	ipv4Family := packet.GetProtocolFamily(packet.AfiIP, packet.SafiUnicast)
+	ipv6Family := packet.GetProtocolFamily(packet.AfiIP6, packet.SafiUnicast)
+	for _, test := range tests {
+		ip := net.ParseIP(test.address)
+		afiSafis, err := convertToAfiSafiConfigs(test.afiSafis, ip, test.defRouteConf)
+		if test.expectedErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got AFI/SAFIs %+v", test.name, afiSafis)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed with error %s", test.name, err)
+			continue
+		}
+		if len(afiSafis) != len(test.expected) {
+			t.Errorf("%s: expected AFI/SAFIs %v, got %+v", test.name, test.expected, afiSafis)
+			continue
+		}
+
+		pConf := config.NeighborConfig{NeighborAddress: ip, AfiSafis: afiSafis}
+		nConf := base.NewNeighborConf(logger, &config.GlobalConfig{}, nil, pConf)
+		for idx, afiSafi := range nConf.Neighbor.AfiSafis {
+			if afiSafi.AfiSafiName != test.expected[idx] {
+				t.Errorf("%s: expected AFI/SAFI %s, got %s", test.name, test.expected[idx], afiSafi.AfiSafiName)
+			}
+
+			protoFamily := packet.ProtocolFamilyMap[afiSafi.AfiSafiName]
+			if !nConf.AfiSafiMap[protoFamily] {
+				t.Errorf("%s: AFI/SAFI %s not enabled", test.name, afiSafi.AfiSafiName)
+			}
+
+			var ipv4Conf, ipv6Conf config.IPUnicast
+			if protoFamily == ipv4Family {
+				ipv4Conf = test.defRouteConf
+			} else if protoFamily == ipv6Family {
+				ipv6Conf = test.defRouteConf
+			}
+			if afiSafi.IPv4Unicast != ipv4Conf || afiSafi.IPv6Unicast != ipv6Conf {
+				t.Errorf("%s: AFI/SAFI %s, expected default route config %+v %+v, got %+v %+v", test.name,
+					afiSafi.AfiSafiName, ipv4Conf, ipv6Conf, afiSafi.IPv4Unicast, afiSafi.IPv6Unicast)
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// auth.go
+package server
+
+import (
+	"l3/bgp/auth"
+	"l3/bgp/config"
+	"time"
+	"utils/netUtils"
+)
+
+/*  listenerAuth is the authentication that is set up for a neighbor on the listening socket.
+ */
+type listenerAuth struct {
+	md5    bool
+	aoKeys *auth.AOKeyState
+	chain  *auth.KeyChain
+}
+
+func (server *BGPServer) getKeyChain(name string) *auth.KeyChain {
+	chain, ok := server.KeyChains[name]
+	if !ok {
+		// The neighbors can refer to a key chain before it is configured
+		chain = auth.NewKeyChain(name)
+		server.KeyChains[name] = chain
+	}
+	return chain
+}
+
+/*
+ * clearPeerAuth removes the MD5 password or the TCP-AO keys of the neighbor from the listening socket.
+ */
+func (server *BGPServer) clearPeerAuth(peerIP string) {
+	lAuth, ok := server.listenerAuths[peerIP]
+	if !ok {
+		return
+	}
+
+	if lAuth.md5 {
+		err := netUtils.SetTCPListenerMD5(server.listener, peerIP, "")
+		if err != nil {
+			server.logger.Info("Failed to remove MD5 authentication for neighbor", peerIP, "with error", err)
+		}
+	}
+	if lAuth.aoKeys != nil && server.listener != nil {
+		err := auth.ControlFd(server.listener, lAuth.aoKeys.Clear)
+		if err != nil {
+			server.logger.Info("Failed to remove TCP-AO keys for neighbor", peerIP, "with error", err)
+		}
+	}
+	delete(server.listenerAuths, peerIP)
+}
+
+/*
+ * setPeerAuth sets up the MD5 password or the TCP-AO keys of the neighbor on the listening socket
+ * based on the authentication type of the neighbor.
+ */
+func (server *BGPServer) setPeerAuth(peer *Peer) {
+	peerIP := peer.NeighborConf.Neighbor.NeighborAddress.String()
+	server.clearPeerAuth(peerIP)
+
+	if peer.NeighborConf.IsMD5Enabled() {
+		peer.NeighborConf.SetKeyChain(nil)
+		err := netUtils.SetTCPListenerMD5(server.listener, peerIP, peer.NeighborConf.RunningConf.AuthPassword)
+		if err != nil {
+			server.logger.Info("Failed to add MD5 authentication for neighbor", peerIP, "with error", err)
+		}
+		server.listenerAuths[peerIP] = &listenerAuth{md5: true}
+		return
+	}
+
+	if peer.NeighborConf.RunningConf.AuthType != config.AuthTypeAO {
+		peer.NeighborConf.SetKeyChain(nil)
+		return
+	}
+
+	if peer.NeighborConf.RunningConf.AuthKeyChain == "" {
+		server.logger.Err("Key chain is not configured for TCP-AO of neighbor", peerIP)
+		peer.NeighborConf.SetKeyChain(nil)
+		return
+	}
+
+	chain := server.getKeyChain(peer.NeighborConf.RunningConf.AuthKeyChain)
+	peer.NeighborConf.SetKeyChain(chain)
+	server.listenerAuths[peerIP] = &listenerAuth{
+		aoKeys: auth.NewAOKeyState(peer.NeighborConf.Neighbor.NeighborAddress),
+		chain:  chain,
+	}
+	server.updateListenerAuthKeys()
+}
+
+/*
+ * updateListenerAuthKeys installs the TCP-AO keys that are active now on the listening socket and
+ * restarts the timer for the next key change. The connections that are accepted get a copy of the keys.
+ */
+func (server *BGPServer) updateListenerAuthKeys() {
+	server.authKeyTimer.Stop()
+	if server.listener == nil {
+		return
+	}
+
+	now := time.Now()
+	var next time.Time
+	for peerIP, lAuth := range server.listenerAuths {
+		if lAuth.aoKeys == nil {
+			continue
+		}
+
+		err := auth.ControlFd(server.listener, func(fd int) error {
+			return lAuth.aoKeys.Sync(fd, lAuth.chain, now)
+		})
+		if err != nil {
+			server.logger.Err("Failed to update TCP-AO keys on the listener for neighbor", peerIP,
+				"with error", err)
+		}
+
+		if chainNext := lAuth.chain.GetNextChange(now); !chainNext.IsZero() &&
+			(next.IsZero() || chainNext.Before(next)) {
+			next = chainNext
+		}
+	}
+
+	if !next.IsZero() {
+		server.authKeyTimer.Reset(next.Sub(now))
+	}
+}
+
+func (server *BGPServer) ProcessKeyChainUpdate(keyChain config.KeyChainConfig) {
+	server.logger.Info("Update key chain", keyChain.Name)
+	chain := server.getKeyChain(keyChain.Name)
+	chain.SetKeys(keyChain.Keys)
+	server.updateKeyChainInPeers(chain)
+}
+
+func (server *BGPServer) ProcessKeyChainDelete(name string) {
+	server.logger.Info("Delete key chain", name)
+	chain, ok := server.KeyChains[name]
+	if !ok {
+		server.logger.Info("Key chain", name, "not found")
+		return
+	}
+
+	// The neighbors that still use the key chain lose the keys
+	chain.SetKeys(nil)
+	server.updateKeyChainInPeers(chain)
+	for _, peer := range server.PeerMap {
+		if peer.NeighborConf.GetKeyChain() == chain {
+			return
+		}
+	}
+	delete(server.KeyChains, name)
+}
+
+/*
+ * updateKeyChainInPeers installs the keys of the key chain on the listening socket and the connections
+ * of the neighbors using the key chain without resetting the sessions.
+ */
+func (server *BGPServer) updateKeyChainInPeers(chain *auth.KeyChain) {
+	server.updateListenerAuthKeys()
+	for _, peer := range server.PeerMap {
+		if peer.NeighborConf.GetKeyChain() == chain {
+			peer.UpdateAuthKeys()
+		}
+	}
+}
@@ -0,0 +1,303 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+//  _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// condadv.go
+package server
+
+import (
+	"l3/bgp/config"
+	bgppolicy "l3/bgp/policy"
+	bgprib "l3/bgp/rib"
+	"utils/patriciaDB"
+	utilspolicy "utils/policy"
+)
+
+/*
+ * condPrefixEntry is the set of LocRib destinations that match the prefix of a policy condition used by a
+ * conditional advertisement rule or a default route condition.
+ */
+type condPrefixEntry struct {
+	prefix utilspolicy.PolicyPrefix
+	pRange *bgppolicy.PrefixRange
+	dests  map[*bgprib.Destination]bool
+}
+
+func (e *condPrefixEntry) update(dest *bgprib.Destination) bool {
+	matches := dest.LocRibPath != nil && e.pRange.Matches(dest.NLRI.GetPrefix(), dest.NLRI.GetLength())
+	if matches == e.dests[dest] {
+		return false
+	}
+
+	if matches {
+		e.dests[dest] = true
+	} else {
+		delete(e.dests, dest)
+	}
+	return true
+}
+
+func (server *BGPServer) getConditionPrefix(name string) (utilspolicy.PolicyPrefix, bool) {
+	policyDB := server.locRibPE.GetPolicyEngine()
+	item := policyDB.PolicyConditionsDB.Get(patriciaDB.Prefix(name))
+	if item == nil {
+		server.logger.Errf("Conditional advertisement - policy condition %s not found", name)
+		return utilspolicy.PolicyPrefix{}, false
+	}
+
+	matchPrefix, ok := item.(utilspolicy.PolicyCondition).ConditionInfo.(utilspolicy.MatchPrefixConditionInfo)
+	if !ok || matchPrefix.UsePrefixSet {
+		server.logger.Errf("Conditional advertisement - policy condition %s is not a prefix match condition", name)
+		return utilspolicy.PolicyPrefix{}, false
+	}
+	return matchPrefix.Prefix, true
+}
+
+/*
+ * getCondPrefixEntry returns the destinations that match the policy condition. The entry is built by walking
+ * LocRib when the condition is first used and is kept up to date by updateCondPrefixIndex after that.
+ */
+func (server *BGPServer) getCondPrefixEntry(name string) *condPrefixEntry {
+	prefix, ok := server.getConditionPrefix(name)
+	if !ok {
+		return nil
+	}
+
+	if entry, ok := server.condDests[name]; ok && entry.prefix == prefix {
+		return entry
+	}
+
+	pRange, err := bgppolicy.NewPrefixRange(prefix)
+	if err != nil {
+		server.logger.Errf("Conditional advertisement - policy condition %s has invalid prefix, error %s", name,
+			err)
+		return nil
+	}
+
+	entry := &condPrefixEntry{prefix: prefix, pRange: pRange, dests: make(map[*bgprib.Destination]bool)}
+	for _, dest := range server.LocRib.GetMatchingDests(func(dest *bgprib.Destination) bool {
+		return pRange.Matches(dest.NLRI.GetPrefix(), dest.NLRI.GetLength())
+	}) {
+		entry.dests[dest] = true
+	}
+	server.condDests[name] = entry
+	return entry
+}
+
+/*
+ * updateCondPrefixIndex updates the destinations of the indexed policy conditions with the modified destinations
+ * and returns the conditions whose destinations changed. The conditions that are not used by any peer anymore
+ * are removed from the index and the conditions whose prefix was changed are rebuilt when they are used next.
+ */
+func (server *BGPServer) updateCondPrefixIndex(modifiedDests []*bgprib.Destination) map[string]bool {
+	changed := make(map[string]bool)
+	if len(server.condDests) == 0 {
+		return changed
+	}
+
+	inUse := make(map[string]bool)
+	for _, peer := range server.PeerMap {
+		for _, condAdv := range peer.NeighborConf.RunningConf.ConditionalAdvertisements {
+			inUse[condAdv.AdvertiseCondition] = true
+			inUse[condAdv.ExistCondition] = true
+			inUse[condAdv.NonExistCondition] = true
+		}
+		for _, conf := range server.getDefaultRouteConfs(peer) {
+			inUse[conf.DefaultRouteCondition] = true
+		}
+	}
+
+	for name, entry := range server.condDests {
+		if !inUse[name] {
+			delete(server.condDests, name)
+			continue
+		}
+
+		if prefix, ok := server.getConditionPrefix(name); !ok || prefix != entry.prefix {
+			delete(server.condDests, name)
+			changed[name] = true
+			continue
+		}
+
+		for _, dest := range modifiedDests {
+			if entry.update(dest) {
+				changed[name] = true
+			}
+		}
+	}
+	return changed
+}
+
+/*
+ * evalConditionalAdvertisement returns true if the routes matching the advertise condition can be sent to the
+ * neighbor, i.e. the exist condition matches a route in LocRib and the non-exist condition does not.
+ */
+func (server *BGPServer) evalConditionalAdvertisement(condAdv config.ConditionalAdvertisement) bool {
+	if condAdv.ExistCondition != "" {
+		entry := server.getCondPrefixEntry(condAdv.ExistCondition)
+		if entry == nil || len(entry.dests) == 0 {
+			return false
+		}
+	}
+
+	if condAdv.NonExistCondition != "" {
+		entry := server.getCondPrefixEntry(condAdv.NonExistCondition)
+		if entry != nil && len(entry.dests) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (server *BGPServer) getPeerPathForDest(peer *Peer, dest *bgprib.Destination) *bgprib.Path {
+	if clientRib := peer.getRouteServerClientRib(); clientRib != nil {
+		return clientRib.GetPath(dest)
+	} else if orrRib := server.getPeerORRGroupRib(peer); orrRib != nil {
+		return orrRib.GetPath(dest)
+	}
+	return dest.LocRibPath
+}
+
+func addDestToUpdated(updated map[uint32]map[*bgprib.Path][]*bgprib.Destination, path *bgprib.Path,
+	dest *bgprib.Destination) {
+	protoFamily := dest.GetProtocolFamily()
+	if _, ok := updated[protoFamily]; !ok {
+		updated[protoFamily] = make(map[*bgprib.Path][]*bgprib.Destination)
+	}
+	updated[protoFamily][path] = append(updated[protoFamily][path], dest)
+}
+
+/*
+ * applyConditionalAdvertisements re-evaluates the conditional advertisement rules of the peer whose exist or
+ * non-exist conditions changed. It returns the updates for the peer with the routes of the rules that are not
+ * satisfied filtered out, the routes of the rules that stopped being satisfied withdrawn and the routes of the
+ * rules that became satisfied advertised again.
+ */
+func (server *BGPServer) applyConditionalAdvertisements(peer *Peer,
+	updated map[uint32]map[*bgprib.Path][]*bgprib.Destination, withdrawn, updatedAddPaths []*bgprib.Destination,
+	changedConds map[string]bool) (map[uint32]map[*bgprib.Path][]*bgprib.Destination, []*bgprib.Destination,
+	[]*bgprib.Destination) {
+	condAdvs := peer.NeighborConf.RunningConf.ConditionalAdvertisements
+	if len(condAdvs) == 0 && len(peer.condAdvState) == 0 {
+		return updated, withdrawn, updatedAddPaths
+	}
+
+	advertiseDests := make(map[*bgprib.Destination]bool)
+	withdrawDests := make(map[*bgprib.Destination]bool)
+	suppressed := make([]*condPrefixEntry, 0)
+	condAdvState := make(map[config.ConditionalAdvertisement]bool)
+	for _, condAdv := range condAdvs {
+		advEntry := server.getCondPrefixEntry(condAdv.AdvertiseCondition)
+		if advEntry == nil {
+			continue
+		}
+
+		advertise, ok := peer.condAdvState[condAdv]
+		if !ok || changedConds[condAdv.ExistCondition] || changedConds[condAdv.NonExistCondition] {
+			if !ok {
+				// The routes were advertised before the rule was configured
+				advertise = true
+			}
+			newAdvertise := server.evalConditionalAdvertisement(condAdv)
+			if newAdvertise != advertise {
+				server.logger.Infof("Neighbor %s: conditional advertisement %+v changed to advertise %t",
+					peer.NeighborConf.Neighbor.NeighborAddress, condAdv, newAdvertise)
+				for dest, _ := range advEntry.dests {
+					if newAdvertise {
+						advertiseDests[dest] = true
+					} else {
+						withdrawDests[dest] = true
+					}
+				}
+			}
+			advertise = newAdvertise
+		}
+
+		condAdvState[condAdv] = advertise
+		if !advertise {
+			suppressed = append(suppressed, advEntry)
+		}
+	}
+
+	for condAdv, advertise := range peer.condAdvState {
+		if _, ok := condAdvState[condAdv]; ok || advertise {
+			continue
+		}
+		server.logger.Infof("Neighbor %s: conditional advertisement %+v removed, advertise the routes",
+			peer.NeighborConf.Neighbor.NeighborAddress, condAdv)
+		if advEntry := server.getCondPrefixEntry(condAdv.AdvertiseCondition); advEntry != nil {
+			for dest, _ := range advEntry.dests {
+				advertiseDests[dest] = true
+			}
+		}
+	}
+	peer.condAdvState = condAdvState
+
+	if len(suppressed) == 0 && len(advertiseDests) == 0 && len(withdrawDests) == 0 {
+		return updated, withdrawn, updatedAddPaths
+	}
+
+	isSuppressed := func(dest *bgprib.Destination) bool {
+		for _, advEntry := range suppressed {
+			if advEntry.dests[dest] {
+				return true
+			}
+		}
+		return false
+	}
+
+	condUpdated := make(map[uint32]map[*bgprib.Path][]*bgprib.Destination)
+	for _, pathDestMap := range updated {
+		for path, destinations := range pathDestMap {
+			for _, dest := range destinations {
+				if dest == nil || isSuppressed(dest) {
+					continue
+				}
+				delete(advertiseDests, dest)
+				addDestToUpdated(condUpdated, path, dest)
+			}
+		}
+	}
+
+	for dest, _ := range advertiseDests {
+		if isSuppressed(dest) {
+			continue
+		}
+		if path := server.getPeerPathForDest(peer, dest); path != nil {
+			addDestToUpdated(condUpdated, path, dest)
+		}
+	}
+
+	condWithdrawn := make([]*bgprib.Destination, 0, len(withdrawn)+len(withdrawDests))
+	condWithdrawn = append(condWithdrawn, withdrawn...)
+	for dest, _ := range withdrawDests {
+		condWithdrawn = append(condWithdrawn, dest)
+	}
+
+	condUpdatedAddPaths := make([]*bgprib.Destination, 0, len(updatedAddPaths))
+	for _, dest := range updatedAddPaths {
+		if !isSuppressed(dest) {
+			condUpdatedAddPaths = append(condUpdatedAddPaths, dest)
+		}
+	}
+	return condUpdated, condWithdrawn, condUpdatedAddPaths
+}
@@ -0,0 +1,65 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+//  _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// converge.go
+package server
+
+import (
+	"time"
+)
+
+const (
+	BGPConvergeIdleTime        = 10 * time.Second
+	BGPConvergedNotifyInterval = 30 * time.Second
+)
+
+/*
+ * resetConvergeTimer restarts the idle period while BGP did not converge yet. It is called whenever a peer comes
+ * up or a BGP message is received.
+ */
+func (server *BGPServer) resetConvergeTimer() {
+	if server.converged {
+		return
+	}
+	server.convergeTimer.Reset(BGPConvergeIdleTime)
+}
+
+/*
+ * checkConvergence declares the initial BGP convergence once all the configured peers are established and no BGP
+ * message was received for BGPConvergeIdleTime. The IGP is notified so that it leaves the stub router mode it uses
+ * while waiting for BGP. The notification is repeated periodically so that a restarted IGP learns about it too.
+ */
+func (server *BGPServer) checkConvergence() {
+	if !server.converged {
+		for _, peer := range server.PeerMap {
+			if !peer.isEstablished() {
+				server.convergeTimer.Reset(BGPConvergeIdleTime)
+				return
+			}
+		}
+		server.logger.Info("BGP converged")
+		server.converged = true
+	}
+	server.lsMgr.NotifyConverged()
+	server.convergeTimer.Reset(BGPConvergedNotifyInterval)
+}
@@ -0,0 +1,116 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+//  _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// defaultorig.go
+package server
+
+import (
+	"l3/bgp/config"
+	"l3/bgp/packet"
+	bgprib "l3/bgp/rib"
+)
+
+func (server *BGPServer) getDefaultRouteConfs(peer *Peer) map[uint32]config.IPUnicast {
+	ipv4Family := packet.GetProtocolFamily(packet.AfiIP, packet.SafiUnicast)
+	ipv6Family := packet.GetProtocolFamily(packet.AfiIP6, packet.SafiUnicast)
+	defRouteConfs := make(map[uint32]config.IPUnicast)
+
+	for _, afiSafi := range peer.NeighborConf.Neighbor.AfiSafis {
+		protoFamily, ok := packet.ProtocolFamilyMap[afiSafi.AfiSafiName]
+		if !ok {
+			continue
+		}
+
+		if protoFamily == ipv4Family && afiSafi.IPv4Unicast.SendDefaultRoute {
+			defRouteConfs[protoFamily] = afiSafi.IPv4Unicast
+		} else if protoFamily == ipv6Family && afiSafi.IPv6Unicast.SendDefaultRoute {
+			defRouteConfs[protoFamily] = afiSafi.IPv6Unicast
+		}
+	}
+	return defRouteConfs
+}
+
+func (server *BGPServer) isDefaultRouteConditionMet(conf config.IPUnicast) bool {
+	if conf.DefaultRouteCondition == "" {
+		return true
+	}
+
+	entry := server.getCondPrefixEntry(conf.DefaultRouteCondition)
+	return entry != nil && len(entry.dests) > 0
+}
+
+func (server *BGPServer) stopDefaultOriginate(peer *Peer, protoFamily uint32) {
+	ipPrefix := peer.getDefaultRouteNLRI(protoFamily).GetIPPrefix()
+	if dest, ok := server.LocRib.GetDest(ipPrefix, protoFamily, false); ok && dest.LocRibPath != nil {
+		if path := server.getPeerPathForDest(peer, dest); path != nil && peer.isAdvertisable(dest, path) {
+			// Replace the generated default route with the one from LocRib
+			peer.StopDefaultRoute(protoFamily, false)
+			updated := make(map[uint32]map[*bgprib.Path][]*bgprib.Destination)
+			addDestToUpdated(updated, path, dest)
+			peer.SendUpdate(updated, make([]*bgprib.Destination, 0), make([]*bgprib.Destination, 0))
+			return
+		}
+	}
+	peer.StopDefaultRoute(protoFamily, true)
+}
+
+/*
+ * ProcessDefaultOriginate generates the default route for the address families of the peer that are configured
+ * to send it. A default route gated by a policy condition is only sent while the condition matches a route in
+ * LocRib, it is re-evaluated when the destinations that match the condition changed.
+ */
+func (server *BGPServer) ProcessDefaultOriginate(peer *Peer, changedConds map[string]bool) {
+	if peer.NeighborConf.Neighbor.Transport.Config.LocalAddress == nil {
+		return
+	}
+
+	defRouteConfs := server.getDefaultRouteConfs(peer)
+	for protoFamily, _ := range peer.defRoutes {
+		if _, ok := defRouteConfs[protoFamily]; !ok {
+			server.stopDefaultOriginate(peer, protoFamily)
+		}
+	}
+
+	for protoFamily, conf := range defRouteConfs {
+		defRoute, originated := peer.defRoutes[protoFamily]
+		if originated && defRoute.conf == conf && !changedConds[conf.DefaultRouteCondition] {
+			continue
+		}
+
+		if !server.isDefaultRouteConditionMet(conf) {
+			if originated {
+				server.stopDefaultOriginate(peer, protoFamily)
+			}
+			continue
+		}
+
+		if originated && defRoute.conf == conf {
+			continue
+		}
+
+		pathAttrs := packet.ConstructPathAttrForDefaultRoute(peer.NeighborConf.Neighbor.Transport.Config.LocalAddress,
+			conf.DefaultRouteMED, conf.DefaultRouteLocalPref)
+		path := bgprib.NewPath(server.LocRib, nil, pathAttrs, nil, bgprib.RouteTypeStatic)
+		peer.OriginateDefaultRoute(protoFamily, path, conf)
+	}
+}
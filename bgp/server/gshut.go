@@ -0,0 +1,117 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+//  _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// gshut.go
+package server
+
+import (
+	"l3/bgp/config"
+	"reflect"
+	"time"
+)
+
+/*
+ * isGracefulShutdownUpdate returns true if the graceful shutdown setting is the only change in the neighbor
+ * config. Such a change is applied without resetting the session.
+ */
+func isGracefulShutdownUpdate(oldConf, newConf config.NeighborConfig) bool {
+	if oldConf.NeighborAddress == nil || oldConf.GracefulShutdown == newConf.GracefulShutdown {
+		return false
+	}
+
+	newConf.GracefulShutdown = oldConf.GracefulShutdown
+	return reflect.DeepEqual(oldConf, newConf)
+}
+
+func isGlobalGracefulShutdownUpdate(oldConf, newConf config.GlobalConfig) bool {
+	if oldConf.RouterId == nil || (oldConf.GracefulShutdown == newConf.GracefulShutdown &&
+		oldConf.GracefulShutdownTime == newConf.GracefulShutdownTime) {
+		return false
+	}
+
+	newConf.GracefulShutdown = oldConf.GracefulShutdown
+	newConf.GracefulShutdownTime = oldConf.GracefulShutdownTime
+	return reflect.DeepEqual(oldConf, newConf)
+}
+
+func (server *BGPServer) UpdateGlobalGracefulShutdown(gConf config.GlobalConfig) {
+	server.logger.Infof("Global graceful shutdown %t, drain time %d seconds", gConf.GracefulShutdown,
+		gConf.GracefulShutdownTime)
+	server.copyGlobalConf(gConf)
+	server.constructBGPGlobalState(&gConf)
+	for _, peer := range server.PeerMap {
+		server.UpdatePeerGracefulShutdown(peer)
+	}
+}
+
+/*
+ * UpdatePeerGracefulShutdown starts or stops the graceful shutdown of the peer, RFC 8326. The paths received from
+ * the peer are the least preferred and the paths advertised to the peer are tagged with the GRACEFUL_SHUTDOWN
+ * community while the peer is in graceful shutdown. The paths of the other peers only change if the best path
+ * changed, all the paths are advertised again to the peer only.
+ */
+func (server *BGPServer) UpdatePeerGracefulShutdown(peer *Peer) {
+	gShut := peer.NeighborConf.IsGracefulShutdown()
+	if gShut == peer.isGracefulShutdown() {
+		return
+	}
+
+	peerIP := peer.NeighborConf.Neighbor.NeighborAddress.String()
+	if gShut {
+		server.logger.Infof("Neighbor %s: Start graceful shutdown", peerIP)
+		peer.gShutStart = time.Now()
+	} else {
+		server.logger.Infof("Neighbor %s: Stop graceful shutdown", peerIP)
+		peer.gShutStart = time.Time{}
+		peer.cancelShutdown()
+	}
+
+	updated, withdrawn, updatedAddPaths := server.LocRib.RecalculateNeighborPathPrefs(peerIP, server.AddPathCount)
+	updated, withdrawn, updatedAddPaths = server.CheckForAggregation(updated, withdrawn, updatedAddPaths)
+	server.SendUpdate(updated, withdrawn, updatedAddPaths)
+
+	if peer.isEstablished() {
+		peer.resetRibOut()
+		server.SendAllRoutesToPeer(peer)
+	}
+}
+
+/*
+ * ShutdownPeer administratively shuts down the session with the peer. The shutdown of a peer in graceful
+ * shutdown is delayed until the graceful shutdown time has passed, to let the traffic move away from the peer.
+ */
+func (server *BGPServer) ShutdownPeer(peer *Peer, msg string) {
+	drainTime := time.Duration(server.BgpConfig.Global.Config.GracefulShutdownTime) * time.Second
+	if peer.isGracefulShutdown() && peer.isEstablished() {
+		if remaining := drainTime - time.Since(peer.gShutStart); remaining > 0 {
+			server.logger.Infof("Neighbor %s: Shutdown in %s after draining the traffic",
+				peer.NeighborConf.Neighbor.NeighborAddress, remaining)
+			peer.scheduleShutdown(remaining, msg)
+			return
+		}
+	}
+
+	server.logger.Infof("Neighbor %s: Shutdown, message: %s", peer.NeighborConf.Neighbor.NeighborAddress, msg)
+	peer.cancelShutdown()
+	peer.Shutdown(msg)
+}
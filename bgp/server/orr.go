@@ -0,0 +1,110 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// orr.go
+package server
+
+import (
+	bgprib "l3/bgp/rib"
+)
+
+type orrGroupUpdate struct {
+	updated   map[uint32]map[*bgprib.Path][]*bgprib.Destination
+	withdrawn []*bgprib.Destination
+}
+
+/*
+ * updateClusterIds sets the cluster ids of the route reflector in the Loc-RIB after the neighbors or the global
+ * config changed. Each route reflector client can use a different cluster id.
+ */
+func (server *BGPServer) updateClusterIds() {
+	clusterIds := make(map[uint32]bool)
+	for _, peer := range server.PeerMap {
+		if peer.NeighborConf.IsRouteReflectorClient() {
+			clusterIds[peer.NeighborConf.GetClusterId()] = true
+		}
+	}
+	server.LocRib.SetClusterIds(clusterIds)
+}
+
+/*
+ * setupORRGroups creates the Loc-RIBs of the optimal route reflection groups from the global config.
+ */
+func (server *BGPServer) setupORRGroups() {
+	server.ORRGroupRibs = make(map[string]*bgprib.ORRGroupRib)
+	for _, groupConf := range server.BgpConfig.Global.Config.ORRGroups {
+		server.logger.Infof("Add ORR group %s, IGP position %s", groupConf.Name, groupConf.IGPPosition)
+		orrRib := bgprib.NewORRGroupRib(server.LocRib, groupConf)
+		orrRib.SetIGPDistances(server.LinkStateRib.GetIGPDistances(groupConf.IGPPosition))
+		server.ORRGroupRibs[groupConf.Name] = orrRib
+	}
+}
+
+/*
+ * getPeerORRGroupRib returns the Loc-RIB of the optimal route reflection group of the internal peer. Peers that
+ * use a route server client view or receive multiple paths with add paths don't use the group.
+ */
+func (server *BGPServer) getPeerORRGroupRib(peer *Peer) *bgprib.ORRGroupRib {
+	groupName := peer.NeighborConf.RunningConf.ORRGroup
+	if groupName == "" || !peer.NeighborConf.IsInternal() || peer.NeighborConf.IsRouteServerClient() ||
+		peer.getAddPathsMaxTx() > 0 {
+		return nil
+	}
+	return server.ORRGroupRibs[groupName]
+}
+
+func (server *BGPServer) processORRUpdates(updated map[uint32]map[*bgprib.Path][]*bgprib.Destination, withdrawn,
+	modifiedDests []*bgprib.Destination) map[*bgprib.ORRGroupRib]*orrGroupUpdate {
+	orrUpdates := make(map[*bgprib.ORRGroupRib]*orrGroupUpdate)
+	for _, orrRib := range server.ORRGroupRibs {
+		groupUpdated, groupWithdrawn := orrRib.ProcessUpdates(updated, withdrawn, modifiedDests)
+		orrUpdates[orrRib] = &orrGroupUpdate{groupUpdated, groupWithdrawn}
+	}
+	return orrUpdates
+}
+
+/*
+ * ProcessORRTopologyChange runs the best path selection of the optimal route reflection groups with IGP positions
+ * in the areas that changed in the link state database and sends the changed paths to the peers in the groups.
+ */
+func (server *BGPServer) ProcessORRTopologyChange(areas map[uint32]bool) {
+	if len(areas) == 0 {
+		return
+	}
+
+	for _, orrRib := range server.ORRGroupRibs {
+		updated, withdrawn := orrRib.ProcessTopologyChange(server.LinkStateRib, areas)
+		if len(updated) == 0 && len(withdrawn) == 0 {
+			continue
+		}
+
+		for _, peer := range server.PeerMap {
+			if server.getPeerORRGroupRib(peer) != orrRib {
+				continue
+			}
+			peerUpdated, peerWithdrawn, _ := server.applyConditionalAdvertisements(peer, updated, withdrawn, nil,
+				nil)
+			peer.SendUpdate(peerUpdated, peerWithdrawn, nil)
+		}
+	}
+}
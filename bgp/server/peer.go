@@ -33,29 +33,42 @@ import (
 	bgprib "l3/bgp/rib"
 	"net"
 	"sync/atomic"
+	"time"
 	"utils/logging"
 )
 
+type defaultRoute struct {
+	path *bgprib.Path
+	conf config.IPUnicast
+}
+
 type Peer struct {
-	server       *BGPServer
-	logger       *logging.Writer
-	locRib       *bgprib.LocRib
-	NeighborConf *base.NeighborConf
-	fsmManager   *fsm.FSMManager
-	ifIdx        int32
-	ribIn        map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute
-	ribOut       map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute
+	server        *BGPServer
+	logger        *logging.Writer
+	locRib        *bgprib.LocRib
+	NeighborConf  *base.NeighborConf
+	fsmManager    *fsm.FSMManager
+	ifIdx         int32
+	ribIn         map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute
+	ribOut        map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute
+	clientRib     *bgprib.RouteServerClientRib
+	condAdvState  map[config.ConditionalAdvertisement]bool
+	defRoutes     map[uint32]*defaultRoute
+	gShutStart    time.Time
+	shutdownTimer *time.Timer
 }
 
 func NewPeer(server *BGPServer, locRib *bgprib.LocRib, globalConf *config.GlobalConfig,
 	peerGroup *config.PeerGroupConfig, peerConf config.NeighborConfig) *Peer {
 	peer := Peer{
-		server: server,
-		logger: server.logger,
-		locRib: locRib,
-		ifIdx:  -1,
-		ribIn:  make(map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute),
-		ribOut: make(map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute),
+		server:       server,
+		logger:       server.logger,
+		locRib:       locRib,
+		ifIdx:        -1,
+		ribIn:        make(map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute),
+		ribOut:       make(map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute),
+		condAdvState: make(map[config.ConditionalAdvertisement]bool),
+		defRoutes:    make(map[uint32]*defaultRoute),
 	}
 
 	peer.NeighborConf = base.NewNeighborConf(peer.logger, globalConf, peerGroup, peerConf)
@@ -107,6 +120,7 @@ func (p *Peer) Init() {
 }
 
 func (p *Peer) Cleanup() {
+	p.cancelShutdown()
 	p.ProcessBfd(false)
 	p.fsmManager.CloseCh <- true
 	p.fsmManager = nil
@@ -145,21 +159,122 @@ func (p *Peer) Command(command int, reason int) {
 			p.NeighborConf.Neighbor.NeighborAddress)
 		return
 	}
-	p.fsmManager.CommandCh <- fsm.PeerFSMCommand{command, reason}
+	p.fsmManager.CommandCh <- fsm.PeerFSMCommand{command, reason, ""}
+}
+
+/*
+ * UpdateAuthKeys updates the TCP-AO keys of the connections after the key chain of the neighbor changed.
+ */
+func (p *Peer) UpdateAuthKeys() {
+	if p.fsmManager == nil {
+		return
+	}
+
+	select {
+	case p.fsmManager.AuthKeysCh <- true:
+	default:
+	}
+}
+
+/*
+ * Shutdown stops the session with the Cease/Administrative Shutdown notification that carries the operator
+ * message.
+ */
+func (p *Peer) Shutdown(msg string) {
+	if p.fsmManager == nil {
+		p.logger.Infof("FSM Manager is not instantiated yet for neighbor %s\n",
+			p.NeighborConf.Neighbor.NeighborAddress)
+		return
+	}
+	p.fsmManager.CommandCh <- fsm.PeerFSMCommand{Command: int(fsm.BGPEventManualStop),
+		Reason: fsm.BGPCmdReasonAdminShutdown, Message: msg}
+}
+
+func (p *Peer) scheduleShutdown(delay time.Duration, msg string) {
+	p.cancelShutdown()
+	ip := p.NeighborConf.Neighbor.NeighborAddress
+	p.shutdownTimer = time.AfterFunc(delay, func() {
+		p.server.PeerCommandCh <- config.PeerCommand{IP: ip, Command: int(fsm.BGPEventManualStop), Message: msg}
+	})
+}
+
+func (p *Peer) cancelShutdown() {
+	if p.shutdownTimer != nil {
+		p.shutdownTimer.Stop()
+		p.shutdownTimer = nil
+	}
+}
+
+func (p *Peer) isGracefulShutdown() bool {
+	return !p.gShutStart.IsZero()
+}
+
+func (p *Peer) isEstablished() bool {
+	return p.NeighborConf.Neighbor.Transport.Config.LocalAddress != nil
 }
 
 func (p *Peer) getAddPathsMaxTx() int {
 	return int(p.NeighborConf.Neighbor.State.AddPathsMaxTx)
 }
 
+/*
+ * getRouteServerClientRib returns the per client Loc-RIB of a route server client. The clients that receive
+ * multiple paths with add paths are not affected by path hiding, so they use the shared Loc-RIB.
+ */
+func (p *Peer) getRouteServerClientRib() *bgprib.RouteServerClientRib {
+	if !p.NeighborConf.IsRouteServerClient() || p.getAddPathsMaxTx() > 0 {
+		p.clientRib = nil
+		return nil
+	}
+
+	if p.clientRib == nil {
+		p.clientRib = bgprib.NewRouteServerClientRib(p.locRib, p.NeighborConf, p.isExportPermitted)
+	}
+	return p.clientRib
+}
+
+func (p *Peer) isTransparentPath(path *bgprib.Path) bool {
+	return p.NeighborConf.IsExternal() && p.NeighborConf.IsRouteServerClient() && path != nil &&
+		path.NeighborConf != nil
+}
+
+func (p *Peer) getNextHopForPath(path *bgprib.Path, protoFamily uint32) net.IP {
+	if p.isTransparentPath(path) {
+		if nextHop := path.GetNextHop(protoFamily); nextHop != nil {
+			return nextHop
+		}
+	}
+	return p.NeighborConf.Neighbor.Transport.Config.LocalAddress
+}
+
 func (p *Peer) clearRibOut() {
 	p.ribIn = nil
 	p.ribOut = nil
 	p.ribIn = make(map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute)
 	p.ribOut = make(map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute)
+	p.clientRib = nil
+	p.defRoutes = make(map[uint32]*defaultRoute)
 	p.initAdjRIBTables()
 }
 
+/*
+ * resetRibOut forgets the paths advertised to the peer, including the route server client view, so that all
+ * the paths are advertised again with the next update. The originated default routes are advertised right away.
+ */
+func (p *Peer) resetRibOut() {
+	p.ribOut = make(map[uint32]map[string]map[uint32]*bgprib.AdjRIBRoute)
+	p.clientRib = nil
+	for protoFamily, ok := range p.NeighborConf.AfiSafiMap {
+		if ok {
+			p.ribOut[protoFamily] = make(map[string]map[uint32]*bgprib.AdjRIBRoute)
+		}
+	}
+
+	for protoFamily, defRoute := range p.defRoutes {
+		p.OriginateDefaultRoute(protoFamily, defRoute.path, defRoute.conf)
+	}
+}
+
 func (p *Peer) ProcessBfd(add bool) {
 	ipAddr := p.NeighborConf.Neighbor.NeighborAddress.String()
 	sessionParam := p.NeighborConf.RunningConf.BfdSessionParam
@@ -197,6 +312,11 @@ func (p *Peer) PeerConnEstablished(conn *net.Conn) {
 	p.NeighborConf.Neighbor.Transport.Config.LocalAddress = net.ParseIP(host)
 	p.NeighborConf.PeerConnEstablished()
 	p.clearRibOut()
+	if p.NeighborConf.IsGracefulShutdown() {
+		p.gShutStart = time.Now()
+	} else {
+		p.gShutStart = time.Time{}
+	}
 	//p.Server.PeerConnEstCh <- p.Neighbor.NeighborAddress.String()
 }
 
@@ -253,6 +373,44 @@ func (p *Peer) ReceiveUpdate(msg *packet.BGPMessage) {
 	}
 }
 
+/*
+ * processOTC applies the Only to Customer ingress rules of RFC 9234 to the UPDATE message received from the
+ * neighbor. The routes that are leaked by the neighbor are treated as withdrawn.
+ */
+func (p *Peer) processOTC(update *packet.BGPUpdate) {
+	role, ok := p.NeighborConf.GetRole()
+	if !ok || (len(update.NLRI) == 0 && !packet.HasMPReachNLRI(update.PathAttributes)) {
+		return
+	}
+
+	otc, found := packet.GetOTC(update.PathAttributes)
+	leak := false
+	switch role {
+	case packet.BGPRoleProvider, packet.BGPRoleRS:
+		leak = found
+	case packet.BGPRolePeer:
+		leak = found && otc != p.NeighborConf.RunningConf.PeerAS
+	}
+
+	if leak {
+		numRoutes := uint32(len(update.NLRI))
+		for _, pa := range update.PathAttributes {
+			if mpReach, ok := pa.(*packet.BGPPathAttrMPReachNLRI); ok {
+				numRoutes += uint32(len(mpReach.NLRI))
+			}
+		}
+		p.logger.Infof("Neighbor %s: Route leak detected, OTC %d, dropped %d routes",
+			p.NeighborConf.Neighbor.NeighborAddress, otc, numRoutes)
+		atomic.AddUint32(&p.NeighborConf.Neighbor.State.RouteLeaksDropped, numRoutes)
+		update.TreatAsWithdraw()
+		return
+	}
+
+	if !found && (role == packet.BGPRoleCustomer || role == packet.BGPRolePeer || role == packet.BGPRoleRSClient) {
+		update.PathAttributes = packet.AddOTC(update.PathAttributes, p.NeighborConf.RunningConf.PeerAS)
+	}
+}
+
 func (p *Peer) updatePathAttrs(bgpMsg *packet.BGPMessage, path *bgprib.Path) bool {
 	if p.NeighborConf.Neighbor.Transport.Config.LocalAddress == nil {
 		p.logger.Errf("Neighbor %s: Can't send Update message, FSM is not",
@@ -280,11 +438,20 @@ func (p *Peer) updatePathAttrs(bgpMsg *packet.BGPMessage, path *bgprib.Path) boo
 		if path.NeighborConf != nil && (path.NeighborConf.IsRouteReflectorClient() ||
 			p.NeighborConf.IsRouteReflectorClient()) {
 			removeRRPathAttrs = false
+			// Paths from a client are reflected with the cluster id of the client, paths to a client with
+			// the cluster id of the client they are reflected to.
+			clusterId := p.NeighborConf.GetClusterId()
+			if path.NeighborConf.IsRouteReflectorClient() {
+				clusterId = path.NeighborConf.GetClusterId()
+			}
 			packet.AddOriginatorId(bgpMsg, path.NeighborConf.BGPId)
-			packet.AddClusterId(bgpMsg, path.NeighborConf.RunningConf.RouteReflectorClusterId)
+			packet.AddClusterId(bgpMsg, clusterId)
 		} else {
 			packet.SetLocalPref(bgpMsg, path.GetPreference())
 		}
+	} else if p.isTransparentPath(path) {
+		// Route server does not change AS_PATH, NEXT_HOP and MULTI_EXIT_DISC of the client routes, RFC 7947
+		packet.RemoveLocalPref(bgpMsg)
 	} else {
 		// Do change these path attrs for local routes
 		if path.NeighborConf != nil {
@@ -304,6 +471,19 @@ func (p *Peer) updatePathAttrs(bgpMsg *packet.BGPMessage, path *bgprib.Path) boo
 		packet.RemoveClusterList(bgpMsg)
 	}
 
+	// Routes sent to customers, peers and route server clients are marked Only to Customer, RFC 9234
+	if role, ok := p.NeighborConf.GetRole(); ok && (role == packet.BGPRoleProvider ||
+		role == packet.BGPRolePeer || role == packet.BGPRoleRS) {
+		updateMsg.PathAttributes = packet.AddOTC(updateMsg.PathAttributes, p.NeighborConf.RunningConf.LocalAS)
+	}
+
+	if p.NeighborConf.IsGracefulShutdown() {
+		packet.AddCommunity(bgpMsg, packet.BGPCommunityGracefulShutdown)
+		if p.NeighborConf.IsInternal() {
+			packet.SetLocalPref(bgpMsg, packet.BGPGracefulShutdownLocalPref)
+		}
+	}
+
 	return true
 }
 
@@ -311,8 +491,7 @@ func (p *Peer) sendUpdateMsg(msg *packet.BGPMessage, path *bgprib.Path) {
 	if path != nil && path.NeighborConf != nil {
 		if path.NeighborConf.IsInternal() {
 
-			if p.NeighborConf.IsInternal() && !path.NeighborConf.IsRouteReflectorClient() &&
-				!p.NeighborConf.IsRouteReflectorClient() {
+			if p.NeighborConf.IsInternal() && !p.NeighborConf.CanReflect(path.NeighborConf) {
 				return
 			}
 		}
@@ -331,12 +510,35 @@ func (p *Peer) sendUpdateMsg(msg *packet.BGPMessage, path *bgprib.Path) {
 
 }
 
-func (p *Peer) isAdvertisable(path *bgprib.Path) bool {
+/*
+ * isExportPermitted returns true if the neighbor doesn't have an export policy or the export policy accepts the
+ * path of the destination.
+ */
+func (p *Peer) isExportPermitted(dest *bgprib.Destination, path *bgprib.Path) bool {
+	exportPolicy := p.NeighborConf.RunningConf.ExportPolicy
+	if exportPolicy == "" || path == nil {
+		return true
+	}
+	return p.server.ribOutPE.FilterPath(exportPolicy, dest.NLRI, path)
+}
+
+func (p *Peer) isAdvertisable(dest *bgprib.Destination, path *bgprib.Path) bool {
+	if !p.isExportPermitted(dest, path) {
+		return false
+	}
+
+	// Routes marked Only to Customer are not sent to providers, peers and route servers, RFC 9234
+	if role, ok := p.NeighborConf.GetRole(); ok && path != nil && (role == packet.BGPRoleCustomer ||
+		role == packet.BGPRolePeer || role == packet.BGPRoleRSClient) {
+		if _, found := packet.GetOTC(path.PathAttrs); found {
+			return false
+		}
+	}
+
 	if path != nil && path.NeighborConf != nil {
 		if path.NeighborConf.IsInternal() {
 
-			if p.NeighborConf.IsInternal() && !path.NeighborConf.IsRouteReflectorClient() &&
-				!p.NeighborConf.IsRouteReflectorClient() {
+			if p.NeighborConf.IsInternal() && !p.NeighborConf.CanReflect(path.NeighborConf) {
 				return false
 			}
 		}
@@ -351,6 +553,23 @@ func (p *Peer) isAdvertisable(path *bgprib.Path) bool {
 	return true
 }
 
+/*
+ * addPathToRibOut adds the path with the path id to the adj-RIB-out of the peer and to the updates sent to it.
+ */
+func (p *Peer) addPathToRibOut(newUpdated map[*bgprib.Path]map[uint32][]packet.NLRI, dest *bgprib.Destination,
+	path *bgprib.Path, pathId uint32) {
+	protoFamily := dest.GetProtocolFamily()
+	if _, ok := newUpdated[path]; !ok {
+		newUpdated[path] = make(map[uint32][]packet.NLRI)
+	}
+	if _, ok := newUpdated[path][protoFamily]; !ok {
+		newUpdated[path][protoFamily] = make([]packet.NLRI, 0)
+	}
+	nlri := packet.NewExtNLRI(pathId, dest.NLRI.GetIPPrefix())
+	newUpdated[path][protoFamily] = append(newUpdated[path][protoFamily], nlri)
+	p.ribOut[protoFamily][dest.NLRI.GetPrefix().String()][pathId] = bgprib.NewAdjRIBRoute(nlri, path, pathId)
+}
+
 func (p *Peer) calculateAddPathsAdvertisements(dest *bgprib.Destination, path *bgprib.Path,
 	newUpdated map[*bgprib.Path]map[uint32][]packet.NLRI, withdrawList map[uint32][]packet.NLRI, addPathsTx int) (
 	map[*bgprib.Path]map[uint32][]packet.NLRI, map[uint32][]packet.NLRI) {
@@ -364,37 +583,23 @@ func (p *Peer) calculateAddPathsAdvertisements(dest *bgprib.Destination, path *b
 		p.ribOut[protoFamily][ip] = make(map[uint32]*bgprib.AdjRIBRoute)
 	}
 
-	pathAdded := false
-	protoFamilyAdded := false
-	if _, ok := newUpdated[path]; ok {
-		pathAdded = true
-		if _, ok := newUpdated[path][protoFamily]; ok {
-			protoFamilyAdded = true
-		}
+	locRibPath := path
+	if locRibPath == nil {
+		locRibPath = dest.LocRibPath
 	}
-
-	if p.isAdvertisable(path) {
+	if p.isAdvertisable(dest, locRibPath) {
 		route := dest.LocRibPathRoute
 		if path != nil { // Loc-RIB path changed
-			if !pathAdded {
-				newUpdated[path] = make(map[uint32][]packet.NLRI)
-				pathAdded = true
-			}
-			if !protoFamilyAdded {
-				newUpdated[path][protoFamily] = make([]packet.NLRI, 0)
-				protoFamilyAdded = true
-			}
-			nlri := packet.NewExtNLRI(route.OutPathId, dest.NLRI.GetIPPrefix())
-			newUpdated[path][protoFamily] = append(newUpdated[path][protoFamily], nlri)
+			p.addPathToRibOut(newUpdated, dest, path, route.OutPathId)
 		} else {
 			path = dest.LocRibPath
 		}
 		pathIdMap[route.OutPathId] = path
 	}
 
-	for i := 0; i < len(dest.AddPaths) && len(pathIdMap) < (addPathsTx-1); i++ {
+	for i := 0; i < len(dest.AddPaths) && len(pathIdMap) < addPathsTx; i++ {
 		route := dest.GetPathRoute(dest.AddPaths[i])
-		if route != nil && p.isAdvertisable(dest.AddPaths[i]) {
+		if route != nil && p.isAdvertisable(dest, dest.AddPaths[i]) {
 			pathIdMap[route.OutPathId] = dest.AddPaths[i]
 		}
 	}
@@ -405,42 +610,101 @@ func (p *Peer) calculateAddPathsAdvertisements(dest *bgprib.Destination, path *b
 			nlri := packet.NewExtNLRI(ribPathId, dest.NLRI.GetIPPrefix())
 			withdrawList[protoFamily] = append(withdrawList[protoFamily], nlri)
 			delete(p.ribOut[protoFamily][ip], ribPathId)
-		} else if ribRoute.Path == path {
-			delete(pathIdMap, ribPathId)
-		} else if ribRoute.Path != path {
-			if !pathAdded {
-				newUpdated[path] = make(map[uint32][]packet.NLRI)
-				pathAdded = true
-			}
-			if !protoFamilyAdded {
-				newUpdated[path][protoFamily] = make([]packet.NLRI, 0)
-				protoFamilyAdded = true
+		} else {
+			if ribRoute.Path != path {
+				p.addPathToRibOut(newUpdated, dest, path, ribPathId)
 			}
-			nlri := packet.NewExtNLRI(ribPathId, dest.NLRI.GetIPPrefix())
-			newUpdated[path][protoFamily] = append(newUpdated[path][protoFamily], nlri)
-			p.ribOut[protoFamily][ip][ribPathId] = bgprib.NewAdjRIBRoute(nlri, path, ribPathId)
 			delete(pathIdMap, ribPathId)
 		}
 	}
 
 	for pathId, path := range pathIdMap {
-		if !pathAdded {
-			newUpdated[path] = make(map[uint32][]packet.NLRI)
-			pathAdded = true
-		}
-		if !protoFamilyAdded {
-			newUpdated[path][protoFamily] = make([]packet.NLRI, 0)
-			protoFamilyAdded = true
-		}
-		nlri := packet.NewExtNLRI(pathId, dest.NLRI.GetIPPrefix())
-		newUpdated[path][protoFamily] = append(newUpdated[path][protoFamily], nlri)
-		p.ribOut[protoFamily][ip][pathId] = bgprib.NewAdjRIBRoute(nlri, path, pathId)
-		delete(pathIdMap, pathId)
+		p.addPathToRibOut(newUpdated, dest, path, pathId)
 	}
 
 	return newUpdated, withdrawList
 }
 
+func (p *Peer) getDefaultRouteNLRI(protoFamily uint32) packet.NLRI {
+	var ipPrefix *packet.IPPrefix
+	if protoFamily == packet.GetProtocolFamily(packet.AfiIP6, packet.SafiUnicast) {
+		ipPrefix = packet.ConstructIPPrefix("::", "::")
+	} else {
+		ipPrefix = packet.ConstructIPPrefix("0.0.0.0", "0.0.0.0")
+	}
+
+	if p.getAddPathsMaxTx() > 0 {
+		return packet.NewExtNLRI(0, ipPrefix)
+	}
+	return ipPrefix
+}
+
+/*
+ * isDefaultRouteOriginated returns true if the peer is sent a default route generated for it. The default route
+ * from LocRib is not advertised to the peer in that case.
+ */
+func (p *Peer) isDefaultRouteOriginated(dest *bgprib.Destination) bool {
+	_, ok := p.defRoutes[dest.GetProtocolFamily()]
+	return ok && dest.NLRI.GetLength() == 0
+}
+
+/*
+ * OriginateDefaultRoute sends the default route directly from the Adj-RIB-Out of the peer, the route is
+ * not added to LocRib.
+ */
+func (p *Peer) OriginateDefaultRoute(protoFamily uint32, path *bgprib.Path, conf config.IPUnicast) {
+	if !p.NeighborConf.AfiSafiMap[protoFamily] {
+		return
+	}
+
+	nlri := p.getDefaultRouteNLRI(protoFamily)
+	ip := nlri.GetPrefix().String()
+	p.logger.Infof("Neighbor %s: originate default route %s for family %d",
+		p.NeighborConf.Neighbor.NeighborAddress, ip, protoFamily)
+	p.defRoutes[protoFamily] = &defaultRoute{path: path, conf: conf}
+	if _, ok := p.ribOut[protoFamily]; !ok {
+		p.ribOut[protoFamily] = make(map[string]map[uint32]*bgprib.AdjRIBRoute)
+	}
+	p.ribOut[protoFamily][ip] = make(map[uint32]*bgprib.AdjRIBRoute)
+	p.ribOut[protoFamily][ip][nlri.GetPathId()] = bgprib.NewAdjRIBRoute(nlri, path, nlri.GetPathId())
+
+	newUpdated := make(map[*bgprib.Path]map[uint32][]packet.NLRI)
+	newUpdated[path] = make(map[uint32][]packet.NLRI)
+	newUpdated[path][protoFamily] = []packet.NLRI{nlri}
+	p.sendUpdatedPaths(newUpdated)
+	p.updateAdvertisedPrefixCount(protoFamily)
+}
+
+/*
+ * StopDefaultRoute removes the generated default route from the Adj-RIB-Out. The route is withdrawn if
+ * sendWithdraw is set, otherwise the caller replaces it with the default route from LocRib.
+ */
+func (p *Peer) StopDefaultRoute(protoFamily uint32, sendWithdraw bool) {
+	if _, ok := p.defRoutes[protoFamily]; !ok {
+		return
+	}
+
+	nlri := p.getDefaultRouteNLRI(protoFamily)
+	ip := nlri.GetPrefix().String()
+	p.logger.Infof("Neighbor %s: stop default route %s for family %d", p.NeighborConf.Neighbor.NeighborAddress,
+		ip, protoFamily)
+	delete(p.defRoutes, protoFamily)
+	if p.ribOut[protoFamily] != nil {
+		delete(p.ribOut[protoFamily], ip)
+	}
+
+	if sendWithdraw {
+		withdrawList := make(map[uint32][]packet.NLRI)
+		withdrawList[protoFamily] = []packet.NLRI{nlri}
+		p.sendWithdrawList(withdrawList)
+	}
+	p.updateAdvertisedPrefixCount(protoFamily)
+}
+
+func (p *Peer) updateAdvertisedPrefixCount(protoFamily uint32) {
+	p.NeighborConf.SetAdvertisedPrefixCount(protoFamily, uint32(len(p.ribOut[protoFamily])))
+}
+
 func (p *Peer) SendUpdate(updated map[uint32]map[*bgprib.Path][]*bgprib.Destination, withdrawn,
 	updatedAddPaths []*bgprib.Destination) {
 	p.logger.Infof("Neighbor %s: Send update message valid routes:%v, withdraw routes:%v",
@@ -456,7 +720,7 @@ func (p *Peer) SendUpdate(updated map[uint32]map[*bgprib.Path][]*bgprib.Destinat
 	newUpdated := make(map[*bgprib.Path]map[uint32][]packet.NLRI)
 	if len(withdrawn) > 0 {
 		for _, dest := range withdrawn {
-			if dest != nil {
+			if dest != nil && !p.isDefaultRouteOriginated(dest) {
 				protoFamily := dest.GetProtocolFamily()
 				if _, ok := withdrawList[protoFamily]; !ok {
 					withdrawList[protoFamily] = make([]packet.NLRI, 0)
@@ -497,7 +761,7 @@ func (p *Peer) SendUpdate(updated map[uint32]map[*bgprib.Path][]*bgprib.Destinat
 		}
 		for path, destinations := range pathDestMap {
 			for _, dest := range destinations {
-				if dest == nil {
+				if dest == nil || p.isDefaultRouteOriginated(dest) {
 					continue
 				}
 				ip := dest.NLRI.GetPrefix().String()
@@ -505,14 +769,18 @@ func (p *Peer) SendUpdate(updated map[uint32]map[*bgprib.Path][]*bgprib.Destinat
 					newUpdated, withdrawList = p.calculateAddPathsAdvertisements(dest, path, newUpdated,
 						withdrawList, addPathsTx)
 				} else {
-					if !p.isAdvertisable(path) {
+					if !p.isAdvertisable(dest, path) {
 						if p.ribOut[protoFamily][ip] != nil {
 							withdrawList[protoFamily] = append(withdrawList[protoFamily], dest.NLRI)
 							delete(p.ribOut[protoFamily], ip)
 						}
 					} else {
-						route := dest.LocRibPathRoute
-						pathId := route.OutPathId
+						// Path of a route server client view may not be the Loc-RIB path, it is only
+						// advertised with a single path id.
+						var pathId uint32
+						if route := dest.LocRibPathRoute; route != nil {
+							pathId = route.OutPathId
+						}
 						if _, ok := p.ribOut[protoFamily][ip]; !ok {
 							p.ribOut[protoFamily][ip] = make(map[uint32]*bgprib.AdjRIBRoute)
 						}
@@ -541,11 +809,22 @@ func (p *Peer) SendUpdate(updated map[uint32]map[*bgprib.Path][]*bgprib.Destinat
 
 	if addPathsTx > 0 {
 		for _, dest := range updatedAddPaths {
+			if p.isDefaultRouteOriginated(dest) {
+				continue
+			}
 			newUpdated, withdrawList = p.calculateAddPathsAdvertisements(dest, nil, newUpdated, withdrawList,
 				addPathsTx)
 		}
 	}
 
+	p.sendWithdrawList(withdrawList)
+	p.sendUpdatedPaths(newUpdated)
+	for protoFamily, _ := range p.ribOut {
+		p.updateAdvertisedPrefixCount(protoFamily)
+	}
+}
+
+func (p *Peer) sendWithdrawList(withdrawList map[uint32][]packet.NLRI) {
 	if withdrawList != nil {
 		p.logger.Infof("Neighbor %s: Send update message withdraw routes:%+v",
 			p.NeighborConf.Neighbor.NeighborAddress, withdrawList)
@@ -575,7 +854,9 @@ func (p *Peer) SendUpdate(updated map[uint32]map[*bgprib.Path][]*bgprib.Destinat
 			p.sendUpdateMsg(updateMsg.Clone(), nil)
 		}
 	}
+}
 
+func (p *Peer) sendUpdatedPaths(newUpdated map[*bgprib.Path]map[uint32][]packet.NLRI) {
 	p.logger.Infof("Neighbor %s: new updated routes:%+v",
 		p.NeighborConf.Neighbor.NeighborAddress, newUpdated)
 	for path, pfNLRIMap := range newUpdated {
@@ -597,7 +878,7 @@ func (p *Peer) SendUpdate(updated map[uint32]map[*bgprib.Path][]*bgprib.Destinat
 				mpReachNLRI.AFI = afi
 				mpReachNLRI.SAFI = safi
 				mpNextHop := packet.NewMPNextHopIP()
-				mpNextHop.SetNextHop(p.NeighborConf.Neighbor.Transport.Config.LocalAddress)
+				mpNextHop.SetNextHop(p.getNextHopForPath(path, protoFamily))
 				mpReachNLRI.SetNextHop(mpNextHop)
 				mpReachNLRI.SetNLRIList(nlriList)
 				pa = packet.AddMPReachNLRIToPathAttrs(pa, mpReachNLRI)
@@ -617,3 +898,48 @@ func (p *Peer) SendUpdate(updated map[uint32]map[*bgprib.Path][]*bgprib.Destinat
 		}
 	}
 }
+
+func (p *Peer) SendLinkStateUpdate(updated, withdrawn []*bgprib.LinkStateRoute) {
+	protoFamily := packet.GetProtocolFamily(packet.AfiLinkState, packet.SafiLinkState)
+	if !p.NeighborConf.AfiSafiMap[protoFamily] || (len(updated) == 0 && len(withdrawn) == 0) {
+		return
+	}
+
+	if p.NeighborConf.Neighbor.Transport.Config.LocalAddress == nil {
+		p.logger.Errf("Neighbor %s: Can't send link state Update message, FSM is not in Established state",
+			p.NeighborConf.Neighbor.NeighborAddress)
+		return
+	}
+
+	p.logger.Infof("Neighbor %s: Send link state update message, updated:%d withdrawn:%d",
+		p.NeighborConf.Neighbor.NeighborAddress, len(updated), len(withdrawn))
+	if len(withdrawn) > 0 {
+		mpUnreachNLRI := packet.NewBGPPathAttrMPUnreachNLRI()
+		mpUnreachNLRI.AFI = packet.AfiLinkState
+		mpUnreachNLRI.SAFI = packet.SafiLinkState
+		for _, route := range withdrawn {
+			mpUnreachNLRI.AddNLRI(route.NLRI)
+		}
+		pathAttrs := make([]packet.BGPPathAttr, 0)
+		pathAttrs = append(pathAttrs, mpUnreachNLRI)
+		updateMsg := packet.NewBGPUpdateMessage(nil, pathAttrs, nil)
+		p.sendUpdateMsg(updateMsg.Clone(), nil)
+	}
+
+	// Each link state route carries its own BGP-LS attribute, send them in separate updates
+	lsPath := p.server.LinkStateRib.Path
+	for _, route := range updated {
+		pa := packet.CopyPathAttrs(lsPath.PathAttrs)
+		pa = append(pa, route.Attr)
+		mpReachNLRI := packet.NewBGPPathAttrMPReachNLRI()
+		mpReachNLRI.AFI = packet.AfiLinkState
+		mpReachNLRI.SAFI = packet.SafiLinkState
+		mpNextHop := packet.NewMPNextHopIP()
+		mpNextHop.SetNextHop(p.NeighborConf.Neighbor.Transport.Config.LocalAddress)
+		mpReachNLRI.SetNextHop(mpNextHop)
+		mpReachNLRI.AddNLRI(route.NLRI)
+		pa = packet.AddMPReachNLRIToPathAttrs(pa, mpReachNLRI)
+		updateMsg := packet.NewBGPUpdateMessage(nil, pa, nil)
+		p.sendUpdateMsg(updateMsg.Clone(), lsPath)
+	}
+}
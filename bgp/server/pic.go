@@ -0,0 +1,74 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// pic.go
+package server
+
+import (
+	"l3/bgp/config"
+	bgprib "l3/bgp/rib"
+	"reflect"
+)
+
+/*
+ * isGlobalPICUpdate returns true if the prefix independent convergence settings are the only change in the
+ * global config. Such a change is applied without resetting the sessions.
+ */
+func isGlobalPICUpdate(oldConf, newConf config.GlobalConfig) bool {
+	if oldConf.RouterId == nil || (oldConf.IPv4UnicastPIC == newConf.IPv4UnicastPIC &&
+		oldConf.IPv6UnicastPIC == newConf.IPv6UnicastPIC) {
+		return false
+	}
+
+	newConf.IPv4UnicastPIC = oldConf.IPv4UnicastPIC
+	newConf.IPv6UnicastPIC = oldConf.IPv6UnicastPIC
+	return reflect.DeepEqual(oldConf, newConf)
+}
+
+func (server *BGPServer) UpdateGlobalPIC(gConf config.GlobalConfig) {
+	server.logger.Infof("Prefix independent convergence IPv4 unicast %t, IPv6 unicast %t", gConf.IPv4UnicastPIC,
+		gConf.IPv6UnicastPIC)
+	server.copyGlobalConf(gConf)
+	server.constructBGPGlobalState(&gConf)
+	server.LocRib.UpdateBackupPaths()
+}
+
+/*
+ * ProcessNextHopReachability is called when the route manager notifies a reachability change of a tracked next
+ * hop. It switches the routes to the backup next hops when the next hop is not reachable and runs the best path
+ * selection for the routes that use the next hop.
+ */
+func (server *BGPServer) ProcessNextHopReachability(ip string, reachable bool) {
+	var updated map[uint32]map[*bgprib.Path][]*bgprib.Destination
+	var withdrawn, updatedAddPaths []*bgprib.Destination
+	if reachable {
+		updated, withdrawn, updatedAddPaths = server.LocRib.ProcessReachableNextHop(ip, server.AddPathCount)
+	} else {
+		updated, withdrawn, updatedAddPaths = server.LocRib.ProcessUnreachableNextHop(ip, server.AddPathCount)
+	}
+
+	if len(updated) > 0 || len(withdrawn) > 0 || len(updatedAddPaths) > 0 {
+		updated, withdrawn, updatedAddPaths = server.CheckForAggregation(updated, withdrawn, updatedAddPaths)
+		server.SendUpdate(updated, withdrawn, updatedAddPaths)
+	}
+}
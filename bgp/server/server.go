@@ -27,6 +27,7 @@ package server
 import (
 	"errors"
 	"fmt"
+	"l3/bgp/auth"
 	"l3/bgp/config"
 	"l3/bgp/fsm"
 	"l3/bgp/packet"
@@ -39,10 +40,10 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"utils/dbutils"
 	"utils/eventUtils"
 	"utils/logging"
-	"utils/netUtils"
 	"utils/patriciaDB"
 	utilspolicy "utils/policy"
 	"utils/policy/policyCommonDefs"
@@ -87,7 +88,6 @@ type BGPServer struct {
 	logger           *logging.Writer
 	policyManager    *bgppolicy.BGPPolicyManager
 	locRibPE         *bgppolicy.LocRibPolicyEngine
-	ribInPE          *bgppolicy.AdjRibPPolicyEngine
 	ribOutPE         *bgppolicy.AdjRibPPolicyEngine
 	listener         *net.TCPListener
 	ifaceMgr         *utils.InterfaceMgr
@@ -99,6 +99,8 @@ type BGPServer struct {
 	RemPeerGroupCh   chan string
 	AddAggCh         chan AggUpdate
 	RemAggCh         chan string
+	AddKeyChainCh    chan config.KeyChainConfig
+	RemKeyChainCh    chan string
 	PeerFSMConnCh    chan fsm.PeerFSMConn
 	PeerConnEstCh    chan string
 	PeerConnBrokenCh chan string
@@ -108,6 +110,9 @@ type BGPServer struct {
 	BfdCh            chan config.BfdInfo
 	IntfCh           chan config.IntfStateInfo
 	RoutesCh         chan *config.RouteCh
+	NextHopCh        chan config.NextHopStateInfo
+	LinkStateCh      chan *config.LinkStateCh
+	exportPolicyCh   chan string
 	acceptCh         chan *net.TCPConn
 	GlobalCfgDone    bool
 
@@ -116,6 +121,14 @@ type BGPServer struct {
 	Neighbors      []*Peer
 	LocRib         *bgprib.LocRib
 	ConnRoutesPath *bgprib.Path
+	LinkStateRib   *bgprib.LinkStateRib
+	ORRGroupRibs   map[string]*bgprib.ORRGroupRib
+	condDests      map[string]*condPrefixEntry
+	KeyChains      map[string]*auth.KeyChain
+	listenerAuths  map[string]*listenerAuth
+	authKeyTimer   *time.Timer
+	convergeTimer  *time.Timer
+	converged      bool
 	IfacePeerMap   map[int32][]string
 	ifaceIP        net.IP
 	actionFuncMap  map[int]bgppolicy.PolicyActionFunc
@@ -124,12 +137,14 @@ type BGPServer struct {
 	IntfMgr    config.IntfStateMgrIntf
 	routeMgr   config.RouteMgrIntf
 	bfdMgr     config.BfdMgrIntf
+	lsMgr      config.LinkStateMgrIntf
 	stateDBMgr statedbclient.StateDBClient
 	eventDbHdl *dbutils.DBUtil
 }
 
 func NewBGPServer(logger *logging.Writer, policyManager *bgppolicy.BGPPolicyManager, iMgr config.IntfStateMgrIntf,
-	rMgr config.RouteMgrIntf, bMgr config.BfdMgrIntf, sDBMgr statedbclient.StateDBClient) *BGPServer {
+	rMgr config.RouteMgrIntf, bMgr config.BfdMgrIntf, lsMgr config.LinkStateMgrIntf,
+	sDBMgr statedbclient.StateDBClient) *BGPServer {
 	bgpServer := &BGPServer{}
 	bgpServer.logger = logger
 	bgpServer.policyManager = policyManager
@@ -143,6 +158,8 @@ func NewBGPServer(logger *logging.Writer, policyManager *bgppolicy.BGPPolicyMana
 	bgpServer.RemPeerGroupCh = make(chan string)
 	bgpServer.AddAggCh = make(chan AggUpdate)
 	bgpServer.RemAggCh = make(chan string)
+	bgpServer.AddKeyChainCh = make(chan config.KeyChainConfig)
+	bgpServer.RemKeyChainCh = make(chan string)
 	bgpServer.PeerFSMConnCh = make(chan fsm.PeerFSMConn, 50)
 	bgpServer.PeerConnEstCh = make(chan string)
 	bgpServer.PeerConnBrokenCh = make(chan string)
@@ -152,6 +169,9 @@ func NewBGPServer(logger *logging.Writer, policyManager *bgppolicy.BGPPolicyMana
 	bgpServer.BfdCh = make(chan config.BfdInfo)
 	bgpServer.IntfCh = make(chan config.IntfStateInfo)
 	bgpServer.RoutesCh = make(chan *config.RouteCh)
+	bgpServer.NextHopCh = make(chan config.NextHopStateInfo)
+	bgpServer.LinkStateCh = make(chan *config.LinkStateCh)
+	bgpServer.exportPolicyCh = make(chan string)
 
 	bgpServer.NeighborMutex = sync.RWMutex{}
 	bgpServer.PeerMap = make(map[string]*Peer)
@@ -159,8 +179,18 @@ func NewBGPServer(logger *logging.Writer, policyManager *bgppolicy.BGPPolicyMana
 	bgpServer.IntfMgr = iMgr
 	bgpServer.routeMgr = rMgr
 	bgpServer.bfdMgr = bMgr
+	bgpServer.lsMgr = lsMgr
 	bgpServer.stateDBMgr = sDBMgr
 	bgpServer.LocRib = bgprib.NewLocRib(logger, rMgr, sDBMgr, &bgpServer.BgpConfig.Global.Config)
+	bgpServer.LinkStateRib = bgprib.NewLinkStateRib(bgpServer.LocRib)
+	bgpServer.ORRGroupRibs = make(map[string]*bgprib.ORRGroupRib)
+	bgpServer.condDests = make(map[string]*condPrefixEntry)
+	bgpServer.KeyChains = make(map[string]*auth.KeyChain)
+	bgpServer.listenerAuths = make(map[string]*listenerAuth)
+	bgpServer.authKeyTimer = time.NewTimer(time.Second)
+	bgpServer.authKeyTimer.Stop()
+	bgpServer.convergeTimer = time.NewTimer(BGPConvergeIdleTime)
+	bgpServer.convergeTimer.Stop()
 	bgpServer.IfacePeerMap = make(map[int32][]string)
 	bgpServer.ifaceIP = nil
 	bgpServer.actionFuncMap = make(map[int]bgppolicy.PolicyActionFunc)
@@ -178,9 +208,14 @@ func NewBGPServer(logger *logging.Writer, policyManager *bgppolicy.BGPPolicyMana
 	locRibPE.SetIsEntityPresentFunc(bgpServer.DoesRouteExist)
 	locRibPE.SetActionFuncs(bgpServer.actionFuncMap)
 	locRibPE.SetTraverseFuncs(bgpServer.TraverseAndApplyBGPRib, bgpServer.TraverseAndReverseBGPRib)
+	locRibPE.SetGetRoutePathFunc(bgpServer.GetPolicyRoutePath)
 	bgpServer.locRibPE = locRibPE
 	bgpServer.policyManager.AddPolicyEngine(bgpServer.locRibPE)
 
+	bgpServer.ribOutPE = bgppolicy.NewAdjRibPolicyEngine(logger)
+	bgpServer.ribOutPE.SetPolicyUpdateFunc(bgpServer.notifyExportPolicyUpdate)
+	bgpServer.policyManager.AddPolicyEngine(bgpServer.ribOutPE)
+
 	return bgpServer
 }
 
@@ -222,8 +257,22 @@ func (server *BGPServer) IsPeerLocal(peerIp string) bool {
 
 func (server *BGPServer) SendUpdate(updated map[uint32]map[*bgprib.Path][]*bgprib.Destination, withdrawn,
 	updatedAddPaths []*bgprib.Destination) {
+	modifiedDests := server.LocRib.GetModifiedDests()
+	changedConds := server.updateCondPrefixIndex(modifiedDests)
+	orrUpdates := server.processORRUpdates(updated, withdrawn, modifiedDests)
 	for _, peer := range server.PeerMap {
-		peer.SendUpdate(updated, withdrawn, updatedAddPaths)
+		peerUpdated, peerWithdrawn, peerUpdatedAddPaths := updated, withdrawn, updatedAddPaths
+		if clientRib := peer.getRouteServerClientRib(); clientRib != nil {
+			peerUpdated, peerWithdrawn = clientRib.ProcessUpdates(updated, withdrawn, modifiedDests)
+			peerUpdatedAddPaths = nil
+		} else if orrRib := server.getPeerORRGroupRib(peer); orrRib != nil {
+			peerUpdated, peerWithdrawn = orrUpdates[orrRib].updated, orrUpdates[orrRib].withdrawn
+			peerUpdatedAddPaths = nil
+		}
+		peerUpdated, peerWithdrawn, peerUpdatedAddPaths = server.applyConditionalAdvertisements(peer, peerUpdated,
+			peerWithdrawn, peerUpdatedAddPaths, changedConds)
+		peer.SendUpdate(peerUpdated, peerWithdrawn, peerUpdatedAddPaths)
+		server.ProcessDefaultOriginate(peer, changedConds)
 	}
 }
 
@@ -382,6 +431,9 @@ func (server *BGPServer) setUpdatedWithAggPaths(policyParams *PolicyParams,
 		for aggPath, aggDestinations := range aggPathDestMap {
 			destMap := make(map[*bgprib.Destination]bool)
 			ppUpdated := *policyParams.updated
+			if _, ok := ppUpdated[aggFamily]; !ok {
+				ppUpdated[aggFamily] = make(map[*bgprib.Path][]*bgprib.Destination)
+			}
 			if _, ok := ppUpdated[aggFamily][aggPath]; !ok {
 				ppUpdated[aggFamily][aggPath] = make([]*bgprib.Destination, 0)
 			} else {
@@ -491,6 +543,11 @@ func (server *BGPServer) ApplyAggregateAction(actionInfo interface{},
 	server.logger.Infof("ApplyAggregateAction: aggregate result update=%+v, withdrawn=%+v", updated, withdrawn)
 	server.setUpdatedWithAggPaths(&policyParams, updated, aggActions.SendSummaryOnly, ipPrefix, protoFamily,
 		updatedAddPaths)
+	// The aggregate is withdrawn when the last contributing route is removed from it
+	for _, aggDest := range withdrawn {
+		server.logger.Infof("ApplyAggregateAction: add agg dest %+v to withdrawn", aggDest.NLRI.GetPrefix())
+		(*policyParams.withdrawn) = append((*policyParams.withdrawn), aggDest)
+	}
 	server.logger.Infof("ApplyAggregateAction: after updating agg paths, update=%+v, withdrawn=%+v, ",
 		"policyparams.update=%+v, policyparams.withdrawn=%+v", updated, withdrawn, *policyParams.updated,
 		*policyParams.withdrawn)
@@ -503,16 +560,20 @@ func (server *BGPServer) CheckForAggregation(updated map[uint32]map[*bgprib.Path
 	server.logger.Infof("BGPServer:checkForAggregate - start, updated %v withdrawn %v", updated, withdrawn)
 
 	for _, dest := range withdrawn {
-		if dest == nil || dest.LocRibPath == nil || dest.LocRibPath.IsAggregate() {
+		if dest == nil {
 			continue
 		}
 
+		// The Loc-RIB path of a withdrawn destination is already reset, use the route it was advertised with
 		route := dest.GetLocRibPathRoute()
 		if route == nil {
 			server.logger.Infof("BGPServer:checkForAggregate - route not found withdraw dest %s",
 				dest.NLRI.GetPrefix().String())
 			continue
 		}
+		if route.IsAggregate() {
+			continue
+		}
 		peEntity := utilspolicy.PolicyEngineFilterEntityParams{
 			DestNetIp:  route.Dest.BGPRouteState.Network + "/" + strconv.Itoa(int(route.Dest.BGPRouteState.CIDRLen)),
 			NextHopIp:  route.PathInfo.NextHop,
@@ -529,7 +590,7 @@ func (server *BGPServer) CheckForAggregation(updated map[uint32]map[*bgprib.Path
 			withdrawn:       &withdrawn,
 			updatedAddPaths: &updatedAddPaths,
 		}
-		server.locRibPE.PolicyEngine.PolicyEngineFilter(peEntity, policyCommonDefs.PolicyPath_Export, callbackInfo)
+		server.locRibPE.PolicyEngineFilter(peEntity, policyCommonDefs.PolicyPath_Export, callbackInfo)
 	}
 
 	for _, pathDestMap := range updated {
@@ -558,7 +619,7 @@ func (server *BGPServer) CheckForAggregation(updated map[uint32]map[*bgprib.Path
 						withdrawn:       &withdrawn,
 						updatedAddPaths: &updatedAddPaths,
 					}
-					server.locRibPE.PolicyEngine.PolicyEngineFilter(peEntity, policyCommonDefs.PolicyPath_Export, callbackInfo)
+					server.locRibPE.PolicyEngineFilter(peEntity, policyCommonDefs.PolicyPath_Export, callbackInfo)
 					server.logger.Infof("BGPServer:checkForAggregate - update dest %s policylist %v hit %v ",
 						"after applying create policy\n", dest.NLRI.GetPrefix().String(), route.PolicyList,
 						route.PolicyHitCounter)
@@ -588,6 +649,14 @@ func (server *BGPServer) UpdateRouteAndPolicyDB(policyDetails utilspolicy.Policy
 	server.locRibPE.UpdatePolicyRouteMap(policyParams.route, policyDetails.Policy, op)
 }
 
+func (server *BGPServer) GetPolicyRoutePath(params interface{}) (packet.NLRI, *bgprib.Path) {
+	policyParams := params.(PolicyParams)
+	if policyParams.route == nil || policyParams.route.Dest == nil {
+		return nil, nil
+	}
+	return policyParams.route.Dest.NLRI, policyParams.route.GetPath()
+}
+
 func (server *BGPServer) TraverseAndApplyBGPRib(data interface{}, updateFunc utilspolicy.PolicyApplyfunc) {
 	server.logger.Infof("BGPServer:TraverseRibForPolicies - start")
 	policy := data.(utilspolicy.ApplyPolicyInfo)
@@ -663,7 +732,7 @@ func (server *BGPServer) TraverseAndReverseBGPRib(policyData interface{}) {
 			server.logger.Info("Invalid route ", ipPrefix)
 			continue
 		}
-		server.locRibPE.PolicyEngine.PolicyEngineUndoPolicyForEntity(peEntity, policy, callbackInfo)
+		server.locRibPE.UndoPolicyForEntity(peEntity, policy, callbackInfo)
 		server.locRibPE.DeleteRoutePolicyState(route, policy.Name)
 		server.locRibPE.PolicyEngine.DeletePolicyEntityMapEntry(peEntity, policy.Name)
 	}
@@ -678,6 +747,7 @@ func (server *BGPServer) ProcessUpdate(pktInfo *packet.BGPPktSrc) {
 
 	atomic.AddUint32(&peer.NeighborConf.Neighbor.State.Queues.Input, ^uint32(0))
 	peer.NeighborConf.Neighbor.State.Messages.Received.Update++
+	peer.processOTC(pktInfo.Msg.Body.(*packet.BGPUpdate))
 	updated, withdrawn, updatedAddPaths, addedAllPrefixes := server.LocRib.ProcessUpdate(
 		peer.NeighborConf, pktInfo, server.AddPathCount)
 	if !addedAllPrefixes {
@@ -726,6 +796,15 @@ func (server *BGPServer) ProcessConnectedRoutes(installedRoutes, withdrawnRoutes
 	server.SendUpdate(updated, withdrawn, updatedAddPaths)
 }
 
+func (server *BGPServer) ProcessLinkStateUpdates(add, remove []*config.LinkStateLsa) {
+	server.logger.Info("Link state LSAs added:", len(add), "removed:", len(remove))
+	updated, withdrawn, areas := server.LinkStateRib.ProcessLsaUpdates(add, remove)
+	for _, peer := range server.PeerMap {
+		peer.SendLinkStateUpdate(updated, withdrawn)
+	}
+	server.ProcessORRTopologyChange(areas)
+}
+
 func (server *BGPServer) ProcessIntfStates(intfs []*config.IntfStateInfo) {
 	for _, ifState := range intfs {
 		if ifState.State == config.INTF_CREATED {
@@ -745,11 +824,69 @@ func (server *BGPServer) ProcessRemoveNeighbor(peerIp string, peer *Peer) {
 	server.SendUpdate(updated, withdrawn, updatedAddPaths)
 }
 
+/*
+ * SendAllRoutesToPeer advertises the paths of the peer's view of LocRib to the peer. The other peers are not
+ * affected.
+ */
 func (server *BGPServer) SendAllRoutesToPeer(peer *Peer) {
 	withdrawn := make([]*bgprib.Destination, 0)
 	updatedAddPaths := make([]*bgprib.Destination, 0)
 	updated := server.LocRib.GetLocRib()
-	server.SendUpdate(updated, withdrawn, updatedAddPaths)
+	if clientRib := peer.getRouteServerClientRib(); clientRib != nil {
+		updated, withdrawn = clientRib.ProcessUpdates(updated, withdrawn, nil)
+	} else if orrRib := server.getPeerORRGroupRib(peer); orrRib != nil {
+		orrUpdated := make(map[uint32]map[*bgprib.Path][]*bgprib.Destination)
+		for _, pathDestMap := range updated {
+			for _, destinations := range pathDestMap {
+				for _, dest := range destinations {
+					if path := orrRib.GetPath(dest); path != nil {
+						addDestToUpdated(orrUpdated, path, dest)
+					}
+				}
+			}
+		}
+		updated = orrUpdated
+	}
+
+	updated, withdrawn, updatedAddPaths = server.applyConditionalAdvertisements(peer, updated, withdrawn,
+		updatedAddPaths, nil)
+	peer.SendUpdate(updated, withdrawn, updatedAddPaths)
+	server.ProcessDefaultOriginate(peer, nil)
+	peer.SendLinkStateUpdate(server.LinkStateRib.GetRoutes(), nil)
+}
+
+/*
+ * ValidateExportPolicy returns an error if the policy can't be used as the export policy of a neighbor.
+ */
+func (server *BGPServer) ValidateExportPolicy(policyName string) error {
+	return server.ribOutPE.ValidateExportPolicy(policyName)
+}
+
+/*
+ * notifyExportPolicyUpdate is called by the policy manager goroutine when a policy is created or deleted. The
+ * server may not be listening for updates yet, the policy is sent to the server without blocking the policy
+ * manager.
+ */
+func (server *BGPServer) notifyExportPolicyUpdate(policyName string) {
+	go func() {
+		server.exportPolicyCh <- policyName
+	}()
+}
+
+/*
+ * ProcessExportPolicyUpdate runs the updated export policy on the routes advertised to the established peers
+ * that use the policy. The routes that the policy rejects now are withdrawn and the routes it accepts now are
+ * advertised.
+ */
+func (server *BGPServer) ProcessExportPolicyUpdate(policyName string) {
+	for peerIP, peer := range server.PeerMap {
+		if peer.NeighborConf.RunningConf.ExportPolicy != policyName || !peer.isEstablished() {
+			continue
+		}
+
+		server.logger.Infof("Neighbor %s: Export policy %s updated, send all routes", peerIP, policyName)
+		server.SendAllRoutesToPeer(peer)
+	}
 }
 
 func (server *BGPServer) RemoveRoutesFromAllNeighbor() {
@@ -791,8 +928,10 @@ func (server *BGPServer) UpdatePeerGroupInPeers(groupName string, peerGroup *con
 	peers := server.StopPeersByGroup(groupName)
 	for _, peer := range peers {
 		peer.UpdatePeerGroup(peerGroup)
+		server.setPeerAuth(peer)
 		peer.Init()
 	}
+	server.updateClusterIds()
 }
 
 func (server *BGPServer) SetupRedistribution(gConf config.GlobalConfig) {
@@ -932,6 +1071,14 @@ func (server *BGPServer) copyGlobalConf(gConf config.GlobalConfig) {
 	server.BgpConfig.Global.Config.EBGPMaxPaths = gConf.EBGPMaxPaths
 	server.BgpConfig.Global.Config.EBGPAllowMultipleAS = gConf.EBGPAllowMultipleAS
 	server.BgpConfig.Global.Config.IBGPMaxPaths = gConf.IBGPMaxPaths
+	server.BgpConfig.Global.Config.GracefulShutdown = gConf.GracefulShutdown
+	server.BgpConfig.Global.Config.GracefulShutdownTime = gConf.GracefulShutdownTime
+	server.BgpConfig.Global.Config.IPv4UnicastPIC = gConf.IPv4UnicastPIC
+	server.BgpConfig.Global.Config.IPv6UnicastPIC = gConf.IPv6UnicastPIC
+	server.BgpConfig.Global.Config.RouteReflectorClusterId = gConf.RouteReflectorClusterId
+	server.BgpConfig.Global.Config.DisableClientToClientReflection = gConf.DisableClientToClientReflection
+	server.BgpConfig.Global.Config.DisableIntraClusterReflection = gConf.DisableIntraClusterReflection
+	server.BgpConfig.Global.Config.ORRGroups = gConf.ORRGroups
 }
 
 func (server *BGPServer) handleBfdNotifications(oper config.Operation, DestIp string,
@@ -998,12 +1145,29 @@ func (server *BGPServer) constructBGPGlobalState(gConf *config.GlobalConfig) {
 	server.BgpConfig.Global.State.EBGPMaxPaths = gConf.EBGPMaxPaths
 	server.BgpConfig.Global.State.EBGPAllowMultipleAS = gConf.EBGPAllowMultipleAS
 	server.BgpConfig.Global.State.IBGPMaxPaths = gConf.IBGPMaxPaths
+	server.BgpConfig.Global.State.GracefulShutdown = gConf.GracefulShutdown
+	server.BgpConfig.Global.State.GracefulShutdownTime = gConf.GracefulShutdownTime
+	server.BgpConfig.Global.State.IPv4UnicastPIC = gConf.IPv4UnicastPIC
+	server.BgpConfig.Global.State.IPv6UnicastPIC = gConf.IPv6UnicastPIC
+	server.BgpConfig.Global.State.RouteReflectorClusterId = gConf.RouteReflectorClusterId
+	server.BgpConfig.Global.State.DisableClientToClientReflection = gConf.DisableClientToClientReflection
+	server.BgpConfig.Global.State.DisableIntraClusterReflection = gConf.DisableIntraClusterReflection
+	server.BgpConfig.Global.State.ORRGroups = gConf.ORRGroups
 }
 
 func (server *BGPServer) listenChannelUpdates() {
 	for {
 		select {
 		case globalUpdate := <-server.GlobalConfigCh:
+			if isGlobalGracefulShutdownUpdate(globalUpdate.OldConfig, globalUpdate.NewConfig) {
+				server.UpdateGlobalGracefulShutdown(globalUpdate.NewConfig)
+				break
+			}
+			if isGlobalPICUpdate(globalUpdate.OldConfig, globalUpdate.NewConfig) {
+				server.UpdateGlobalPIC(globalUpdate.NewConfig)
+				break
+			}
+
 			for peerIP, peer := range server.PeerMap {
 				server.logger.Infof("Cleanup peer %s", peerIP)
 				peer.Cleanup()
@@ -1017,9 +1181,11 @@ func (server *BGPServer) listenChannelUpdates() {
 			server.RemoveRoutesFromAllNeighbor()
 			server.copyGlobalConf(gConf)
 			server.constructBGPGlobalState(&gConf)
+			server.setupORRGroups()
 			for _, peer := range server.PeerMap {
 				peer.Init()
 			}
+			server.updateClusterIds()
 			server.SetupRedistribution(gConf)
 
 		case peerUpdate := <-server.AddPeerCh:
@@ -1028,19 +1194,22 @@ func (server *BGPServer) listenChannelUpdates() {
 			newPeer := peerUpdate.NewPeer
 			var peer *Peer
 			var ok bool
+			if isGracefulShutdownUpdate(oldPeer, newPeer) {
+				if peer, ok = server.PeerMap[oldPeer.NeighborAddress.String()]; ok {
+					peer.NeighborConf.UpdateGracefulShutdown(newPeer)
+					server.UpdatePeerGracefulShutdown(peer)
+					break
+				}
+			}
+
 			if oldPeer.NeighborAddress != nil {
 				if peer, ok = server.PeerMap[oldPeer.NeighborAddress.String()]; ok {
 					server.logger.Info("Clean up peer", oldPeer.NeighborAddress.String())
 					peer.Cleanup()
 					server.ProcessRemoveNeighbor(oldPeer.NeighborAddress.String(), peer)
-					if peer.NeighborConf.RunningConf.AuthPassword != "" {
-						err := netUtils.SetTCPListenerMD5(server.listener, oldPeer.NeighborAddress.String(), "")
-						if err != nil {
-							server.logger.Info("Failed to add MD5 authentication for old neighbor",
-								newPeer.NeighborAddress.String(), "with error", err)
-						}
-					}
+					server.clearPeerAuth(oldPeer.NeighborAddress.String())
 					peer.UpdateNeighborConf(newPeer, &server.BgpConfig)
+					server.setPeerAuth(peer)
 
 					runtime.Gosched()
 				} else {
@@ -1070,20 +1239,14 @@ func (server *BGPServer) listenChannelUpdates() {
 				}
 				server.logger.Info("Add neighbor, ip:", newPeer.NeighborAddress.String())
 				peer = NewPeer(server, server.LocRib, &server.BgpConfig.Global.Config, groupConfig, newPeer)
-				if peer.NeighborConf.RunningConf.AuthPassword != "" {
-					err := netUtils.SetTCPListenerMD5(server.listener, newPeer.NeighborAddress.String(),
-						peer.NeighborConf.RunningConf.AuthPassword)
-					if err != nil {
-						server.logger.Info("Failed to add MD5 authentication for neighbor",
-							newPeer.NeighborAddress.String(), "with error", err)
-					}
-				}
+				server.setPeerAuth(peer)
 				server.PeerMap[newPeer.NeighborAddress.String()] = peer
 				server.NeighborMutex.Lock()
 				server.addPeerToList(peer)
 				server.NeighborMutex.Unlock()
 			}
 			peer.Init()
+			server.updateClusterIds()
 
 		case remPeer := <-server.RemPeerCh:
 			server.logger.Info("Remove Peer:", remPeer)
@@ -1098,7 +1261,9 @@ func (server *BGPServer) listenChannelUpdates() {
 			server.NeighborMutex.Unlock()
 			delete(server.PeerMap, remPeer)
 			peer.Cleanup()
+			server.clearPeerAuth(remPeer)
 			server.ProcessRemoveNeighbor(remPeer, peer)
+			server.updateClusterIds()
 
 		case groupUpdate := <-server.AddPeerGroupCh:
 			oldGroupConf := groupUpdate.OldGroup
@@ -1144,6 +1309,21 @@ func (server *BGPServer) listenChannelUpdates() {
 		case ipPrefix := <-server.RemAggCh:
 			server.DeleteAgg(ipPrefix)
 
+		case keyChain := <-server.AddKeyChainCh:
+			server.ProcessKeyChainUpdate(keyChain)
+
+		case name := <-server.RemKeyChainCh:
+			server.ProcessKeyChainDelete(name)
+
+		case <-server.authKeyTimer.C:
+			server.updateListenerAuthKeys()
+
+		case <-server.convergeTimer.C:
+			server.checkConvergence()
+
+		case policyName := <-server.exportPolicyCh:
+			server.ProcessExportPolicyUpdate(policyName)
+
 		case tcpConn := <-server.acceptCh:
 			server.logger.Info("Connected to", tcpConn.RemoteAddr().String())
 			host, _, _ := net.SplitHostPort(tcpConn.RemoteAddr().String())
@@ -1164,8 +1344,13 @@ func (server *BGPServer) listenChannelUpdates() {
 				server.logger.Infof("Failed to apply command %s.",
 					"Peer at that address does not exist, %v\n",
 					peerCommand.Command, peerCommand.IP)
+				break
+			}
+			if peerCommand.Command == int(fsm.BGPEventManualStop) {
+				server.ShutdownPeer(peer, peerCommand.Message)
+			} else {
+				peer.Command(peerCommand.Command, fsm.BGPCmdReasonNone)
 			}
-			peer.Command(peerCommand.Command, fsm.BGPCmdReasonNone)
 
 		case peerFSMConn := <-server.PeerFSMConnCh:
 			server.logger.Infof("Server: Peer %s FSM established/broken",
@@ -1185,6 +1370,7 @@ func (server *BGPServer) listenChannelUpdates() {
 				}
 				server.setInterfaceMapForPeer(peerFSMConn.PeerIP, peer)
 				server.SendAllRoutesToPeer(peer)
+				server.resetConvergeTimer()
 			} else {
 				peer.PeerConnBroken(true)
 				addPathsMaxTx := peer.getAddPathsMaxTx()
@@ -1265,6 +1451,7 @@ func (server *BGPServer) listenChannelUpdates() {
 			server.logger.Info("Received BGP message from peer %s",
 				pktInfo.Src)
 			server.ProcessUpdate(pktInfo)
+			server.resetConvergeTimer()
 
 		case reachabilityInfo := <-server.ReachabilityCh:
 			server.logger.Info("Server: Reachability info for ip",
@@ -1295,6 +1482,15 @@ func (server *BGPServer) listenChannelUpdates() {
 			}
 		case routeInfo := <-server.RoutesCh:
 			server.ProcessConnectedRoutes(routeInfo.Add, routeInfo.Remove)
+
+		case nextHopInfo := <-server.NextHopCh:
+			server.ProcessNextHopReachability(nextHopInfo.IP, nextHopInfo.Reachable)
+
+		case lsInfo := <-server.LinkStateCh:
+			if lsInfo.Sync {
+				lsInfo.Remove = server.LinkStateRib.GetStaleLsas(lsInfo.Add)
+			}
+			server.ProcessLinkStateUpdates(lsInfo.Add, lsInfo.Remove)
 		}
 	}
 
@@ -1340,6 +1536,7 @@ func (server *BGPServer) StartServer() {
 	server.IntfMgr.Start()
 	server.routeMgr.Start()
 	server.bfdMgr.Start()
+	server.lsMgr.Start()
 	server.SetupRedistribution(gConf)
 
 	/*  ALERT: StartServer is a go routine and hence do not have any other go routine where
@@ -1355,6 +1552,7 @@ func (server *BGPServer) StartServer() {
 	intfs := server.IntfMgr.GetIPv4Intfs()
 	server.ProcessIntfStates(intfs)
 
+	server.convergeTimer.Reset(BGPConvergeIdleTime)
 	server.listenChannelUpdates()
 }
 
@@ -1392,6 +1590,26 @@ func (s *BGPServer) BulkGetBGPNeighbors(index int, count int) (int, int, []*conf
 	return index, count, result
 }
 
+func (s *BGPServer) BulkGetBGPNeighborStatistics(index int, count int) (int, int, []*config.NeighborState) {
+	defer s.NeighborMutex.RUnlock()
+
+	s.NeighborMutex.RLock()
+	if index+count > len(s.Neighbors) {
+		count = len(s.Neighbors) - index
+	}
+
+	result := make([]*config.NeighborState, count)
+	for i := 0; i < count; i++ {
+		result[i] = s.Neighbors[i+index].NeighborConf.GetStatisticsState()
+	}
+
+	index += count
+	if index >= len(s.Neighbors) {
+		index = 0
+	}
+	return index, count, result
+}
+
 func (svr *BGPServer) VerifyBgpGlobalConfig() bool {
 	return svr.GlobalCfgDone
 }
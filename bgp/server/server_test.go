@@ -0,0 +1,770 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// server_test.go
+package server
+
+import (
+	"encoding/binary"
+	"l3/bgp/config"
+	"l3/bgp/packet"
+	bgppolicy "l3/bgp/policy"
+	bgprib "l3/bgp/rib"
+	"l3/bgp/test/speaker"
+	"l3/bgp/utils"
+	"net"
+	"sync"
+	"testing"
+	"time"
+	"utils/logging"
+	utilspolicy "utils/policy"
+	"utils/statedbclient"
+)
+
+const (
+	testTimeout  = 10 * time.Second
+	testLocalAS  = 65000
+	testRouterId = "10.0.0.1"
+	testServerIP = "127.0.0.1"
+)
+
+func testGlobalConfig() config.GlobalConfig {
+	return config.GlobalConfig{AS: testLocalAS, RouterId: net.ParseIP(testRouterId)}
+}
+
+type testIntfMgr struct{}
+
+func (m *testIntfMgr) Start()                                           {}
+func (m *testIntfMgr) PortStateChange()                                 {}
+func (m *testIntfMgr) GetIPv4Intfs() []*config.IntfStateInfo            { return nil }
+func (m *testIntfMgr) GetIPv4Information(ifIndex int32) (string, error) { return "", nil }
+func (m *testIntfMgr) GetIfIndex(ifIndex int, ifType int) int32         { return 0 }
+
+/*  testRouteMgr resolves all the next hops as directly connected and records the backup next hops and the
+ *  next hops tracked by BGP.
+ */
+type testRouteMgr struct {
+	sync.Mutex
+	backupNextHops   map[string]string
+	switchedNextHops map[string]string
+	trackedNextHops  map[string]bool
+}
+
+func newTestRouteMgr() *testRouteMgr {
+	return &testRouteMgr{
+		backupNextHops:   make(map[string]string),
+		switchedNextHops: make(map[string]string),
+		trackedNextHops:  make(map[string]bool),
+	}
+}
+
+func (m *testRouteMgr) Start() {}
+
+func (m *testRouteMgr) GetNextHopInfo(ipAddr string) (*config.NextHopInfo, error) {
+	return &config.NextHopInfo{IPAddr: ipAddr, NextHopIp: ipAddr, IsReachable: true}, nil
+}
+
+func (m *testRouteMgr) CreateRoute(cfg *config.RouteConfig)                   {}
+func (m *testRouteMgr) DeleteRoute(cfg *config.RouteConfig)                   {}
+func (m *testRouteMgr) UpdateRoute(cfg *config.RouteConfig, op string)        {}
+func (m *testRouteMgr) GetRoutes() ([]*config.RouteInfo, []*config.RouteInfo) { return nil, nil }
+
+func (m *testRouteMgr) SetBackupNextHop(cfg *config.RouteConfig) {
+	m.Lock()
+	defer m.Unlock()
+	if cfg.BackupNextHopIp == "" {
+		delete(m.backupNextHops, cfg.DestinationNw)
+		return
+	}
+	m.backupNextHops[cfg.DestinationNw] = cfg.BackupNextHopIp
+}
+
+func (m *testRouteMgr) ApplyPolicy(protocol string, policy string, action string,
+	conditions []*config.ConditionInfo) {
+}
+
+func (m *testRouteMgr) SwitchToBackupNextHop(nextHopIp string, cfgs []*config.RouteConfig) {
+	m.Lock()
+	defer m.Unlock()
+	for _, cfg := range cfgs {
+		m.switchedNextHops[cfg.DestinationNw] = cfg.BackupNextHopIp
+	}
+}
+
+func (m *testRouteMgr) TrackNextHop(ipAddr string, track bool) {
+	m.Lock()
+	defer m.Unlock()
+	if !track {
+		delete(m.trackedNextHops, ipAddr)
+		return
+	}
+	m.trackedNextHops[ipAddr] = true
+}
+
+/*  waitFor polls the recorded state till check returns true
+ */
+func (m *testRouteMgr) waitFor(timeout time.Duration, check func(m *testRouteMgr) bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		m.Lock()
+		done := check(m)
+		m.Unlock()
+		if done {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+type testBfdMgr struct{}
+
+func (m *testBfdMgr) Start() {}
+func (m *testBfdMgr) CreateBfdSession(ipAddr string, sessionParam string) (bool, error) {
+	return true, nil
+}
+func (m *testBfdMgr) DeleteBfdSession(ipAddr string) (bool, error) { return true, nil }
+
+type testLinkStateMgr struct{}
+
+func (m *testLinkStateMgr) Start() {}
+
+func (m *testLinkStateMgr) NotifyConverged() {}
+
+type testPolicyMgr struct{}
+
+func (m *testPolicyMgr) Start() {}
+
+type testStateDBClient struct {
+	statedbclient.StateDBClient
+}
+
+func (c *testStateDBClient) AddObject(obj interface{}) error    { return nil }
+func (c *testStateDBClient) DeleteObject(obj interface{}) error { return nil }
+func (c *testStateDBClient) UpdateObject(obj interface{}) error { return nil }
+
+var testServer *BGPServer
+var testServerOnce sync.Once
+var testLogger *logging.Writer
+var testRouteManager *testRouteMgr
+var testPolicyManager *bgppolicy.BGPPolicyManager
+
+/*  getTestServer starts the BGP server that is shared by the tests. The server listens on the BGP port
+ *  and the test speakers connect to it from their own loopback addresses.
+ */
+func getTestServer(t *testing.T) *BGPServer {
+	testServerOnce.Do(func() {
+		logger, err := logging.NewLogger("bgpd", "BGP", true)
+		if err != nil {
+			t.Fatal("Failed to start the logger. Exiting!!")
+		}
+		utils.SetLogger(logger)
+		testLogger = logger
+
+		testPolicyManager = bgppolicy.NewPolicyManager(logger, &testPolicyMgr{})
+		go testPolicyManager.StartPolicyEngine()
+		testRouteManager = newTestRouteMgr()
+		testServer = NewBGPServer(logger, testPolicyManager, &testIntfMgr{}, testRouteManager, &testBfdMgr{},
+			&testLinkStateMgr{}, &testStateDBClient{})
+		go testServer.StartServer()
+		testServer.GlobalConfigCh <- GlobalUpdate{NewConfig: testGlobalConfig()}
+	})
+	if testServer == nil {
+		t.Fatal("BGP server not started")
+	}
+	return testServer
+}
+
+func addTestNeighbor(server *BGPServer, address string, peerAS uint32, baseConf config.BaseConfig) {
+	baseConf.PeerAS = peerAS
+	baseConf.LocalAS = testLocalAS
+	baseConf.ConnectRetryTime = 120
+	baseConf.HoldTime = 180
+	baseConf.KeepaliveTime = 60
+	server.AddPeerCh <- PeerUpdate{
+		NewPeer: config.NeighborConfig{BaseConfig: baseConf, NeighborAddress: net.ParseIP(address)},
+	}
+}
+
+/*  connectSpeaker configures the neighbor and brings up the session from the speaker. The connection is
+ *  retried until the server is listening.
+ */
+func connectSpeaker(t *testing.T, server *BGPServer, address string, peerAS uint32, baseConf config.BaseConfig,
+	conf speaker.Config) *speaker.Speaker {
+	addTestNeighbor(server, address, peerAS, baseConf)
+	conf.LocalAddress = address
+	conf.LocalAS = peerAS
+	conf.RouterId = address
+	deadline := time.Now().Add(testTimeout)
+	for {
+		s := speaker.NewSpeaker(testLogger, conf)
+		err := s.Dial(net.JoinHostPort(testServerIP, config.BGPPort), testTimeout)
+		if err == nil {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Speaker", address, "failed to connect with error:", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func removeSpeaker(server *BGPServer, s *speaker.Speaker, address string) {
+	s.Close()
+	server.RemPeerCh <- address
+}
+
+func announce(t *testing.T, s *speaker.Speaker, attrs speaker.PathAttrs, prefixes ...string) {
+	nlri := make([]packet.NLRI, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		ipPrefix, err := packet.ConstructIPPrefixFromCIDR(prefix)
+		if err != nil {
+			t.Fatal("Failed to construct prefix", prefix, "with error:", err)
+		}
+		nlri = append(nlri, ipPrefix)
+	}
+	if err := s.Announce(s.ConstructPathAttrs(attrs), nlri...); err != nil {
+		t.Fatal("Failed to announce", prefixes, "with error:", err)
+	}
+}
+
+func withdraw(t *testing.T, s *speaker.Speaker, prefixes ...string) {
+	nlri := make([]packet.NLRI, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		ipPrefix, _ := packet.ConstructIPPrefixFromCIDR(prefix)
+		nlri = append(nlri, ipPrefix)
+	}
+	if err := s.Withdraw(nlri...); err != nil {
+		t.Fatal("Failed to withdraw", prefixes, "with error:", err)
+	}
+}
+
+func checkASPath(t *testing.T, route *speaker.Route, expected []uint32) {
+	asPath := route.GetASPath()
+	if len(asPath) != len(expected) {
+		t.Fatalf("Route %s AS path %v, expected %v", route.GetPrefix(), asPath, expected)
+	}
+	for idx := range expected {
+		if asPath[idx] != expected[idx] {
+			t.Fatalf("Route %s AS path %v, expected %v", route.GetPrefix(), asPath, expected)
+		}
+	}
+}
+
+func getPrefixPaths(s *speaker.Speaker, protoFamily uint32, prefix string) []*speaker.Route {
+	routes := make([]*speaker.Route, 0)
+	for _, route := range s.GetRoutes(protoFamily) {
+		if route.GetPrefix() == prefix {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+var ipv4Family = packet.GetProtocolFamily(packet.AfiIP, packet.SafiUnicast)
+
+func TestBestPathSelection(t *testing.T) {
+	server := getTestServer(t)
+	s1 := connectSpeaker(t, server, "127.0.1.1", 65011, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s1, "127.0.1.1")
+	s2 := connectSpeaker(t, server, "127.0.1.2", 65012, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s2, "127.0.1.2")
+	s3 := connectSpeaker(t, server, "127.0.1.3", 65013, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s3, "127.0.1.3")
+
+	prefix := "10.35.1.0/24"
+	announce(t, s1, speaker.PathAttrs{ASPath: []uint32{65011, 100, 200}, NextHop: net.ParseIP("127.0.1.1")}, prefix)
+	for _, s := range []*speaker.Speaker{s2, s3} {
+		route, err := s.WaitForRoute(ipv4Family, prefix, 0, testTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkASPath(t, route, []uint32{testLocalAS, 65011, 100, 200})
+	}
+
+	// The path with the shorter AS path replaces the best path and is not sent back to its neighbor
+	announce(t, s2, speaker.PathAttrs{ASPath: []uint32{65012}, NextHop: net.ParseIP("127.0.1.2")}, prefix)
+	err := s3.WaitFor(testTimeout, func(ribIn map[uint32]map[string]*speaker.Route) bool {
+		for _, route := range ribIn[ipv4Family] {
+			if route.GetPrefix() == prefix && len(route.GetASPath()) == 2 {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		t.Fatal("Best path with the shorter AS path not advertised,", err)
+	}
+	if err = s2.WaitForWithdraw(ipv4Family, prefix, 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// Falls back to the remaining path when the best path is withdrawn
+	withdraw(t, s2, prefix)
+	err = s3.WaitFor(testTimeout, func(ribIn map[uint32]map[string]*speaker.Route) bool {
+		for _, route := range ribIn[ipv4Family] {
+			if route.GetPrefix() == prefix && len(route.GetASPath()) == 4 {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		t.Fatal("Path from 127.0.1.1 not advertised after the best path was withdrawn,", err)
+	}
+
+	withdraw(t, s1, prefix)
+	if err = s3.WaitForWithdraw(ipv4Family, prefix, 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddPaths(t *testing.T) {
+	server := getTestServer(t)
+	s1 := connectSpeaker(t, server, "127.0.2.1", 65021, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s1, "127.0.2.1")
+	s2 := connectSpeaker(t, server, "127.0.2.2", 65022, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s2, "127.0.2.2")
+	s3 := connectSpeaker(t, server, "127.0.2.3", 65023, config.BaseConfig{AddPathsMaxTx: 2},
+		speaker.Config{AddPathsRx: true})
+	defer removeSpeaker(server, s3, "127.0.2.3")
+
+	prefix := "10.35.2.0/24"
+	announce(t, s1, speaker.PathAttrs{ASPath: []uint32{65021, 100}, NextHop: net.ParseIP("127.0.2.1")}, prefix)
+	announce(t, s2, speaker.PathAttrs{ASPath: []uint32{65022}, NextHop: net.ParseIP("127.0.2.2")}, prefix)
+	err := s3.WaitFor(testTimeout, func(ribIn map[uint32]map[string]*speaker.Route) bool {
+		count := 0
+		for _, route := range ribIn[ipv4Family] {
+			if route.GetPrefix() == prefix {
+				count++
+			}
+		}
+		return count == 2
+	})
+	if err != nil {
+		t.Fatal("Both the paths not advertised with add paths,", err)
+	}
+
+	routes := getPrefixPaths(s3, ipv4Family, prefix)
+	if routes[0].GetPathId() == routes[1].GetPathId() {
+		t.Fatal("Paths advertised with the same path id", routes[0].GetPathId())
+	}
+
+	withdraw(t, s1, prefix)
+	err = s3.WaitFor(testTimeout, func(ribIn map[uint32]map[string]*speaker.Route) bool {
+		count := 0
+		for _, route := range ribIn[ipv4Family] {
+			if route.GetPrefix() == prefix {
+				count++
+			}
+		}
+		return count == 1
+	})
+	if err != nil {
+		t.Fatal("Path from 127.0.2.1 not withdrawn with add paths,", err)
+	}
+	checkASPath(t, getPrefixPaths(s3, ipv4Family, prefix)[0], []uint32{testLocalAS, 65022})
+}
+
+/*  createExportPolicy creates the policy that rejects the paths through AS 174 and accepts all the other
+ *  paths to 10.0.0.0/8.
+ */
+func createExportPolicy(name string) {
+	testPolicyManager.ASPathListCfgCh <- config.ASPathList{
+		Name:    name + "Via174",
+		Entries: []config.ASPathListEntry{{Permit: true, Regex: "_174_"}},
+	}
+	testPolicyManager.ConditionCfgCh <- utilspolicy.PolicyConditionConfig{
+		Name:          name + "Prefix10",
+		ConditionType: bgppolicy.PolicyConditionTypeDstIpPrefixMatch,
+		MatchDstIpPrefixConditionInfo: utilspolicy.PolicyDstIpMatchPrefixSetCondition{
+			Prefix: utilspolicy.PolicyPrefix{IpPrefix: "10.0.0.0/8", MasklengthRange: "8-32"},
+		},
+	}
+	testPolicyManager.BGPCondCfgCh <- config.BGPPolicyCondition{
+		Name:          name + "Via174",
+		ConditionType: bgppolicy.BGPConditionTypeASPathMatch,
+		ASPathList:    name + "Via174",
+	}
+	testPolicyManager.ActionCfgCh <- utilspolicy.PolicyActionConfig{
+		Name:       name + "Accept",
+		ActionType: bgppolicy.PolicyActionTypeRouteDisposition,
+		Accept:     true,
+	}
+	testPolicyManager.ActionCfgCh <- utilspolicy.PolicyActionConfig{
+		Name:       name + "Reject",
+		ActionType: bgppolicy.PolicyActionTypeRouteDisposition,
+		Reject:     true,
+	}
+	testPolicyManager.StmtCfgCh <- utilspolicy.PolicyStmtConfig{
+		Name:            name + "RejectVia174",
+		MatchConditions: "all",
+		Conditions:      []string{name + "Prefix10", name + "Via174"},
+		Actions:         []string{name + "Reject"},
+	}
+	testPolicyManager.StmtCfgCh <- utilspolicy.PolicyStmtConfig{
+		Name:            name + "AcceptPrefix10",
+		MatchConditions: "all",
+		Conditions:      []string{name + "Prefix10"},
+		Actions:         []string{name + "Accept"},
+	}
+	testPolicyManager.DefinitionCfgCh <- utilspolicy.PolicyDefinitionConfig{
+		Name: name,
+		PolicyDefinitionStatements: []utilspolicy.PolicyDefinitionStmtPrecedence{
+			{Precedence: 1, Statement: name + "RejectVia174"},
+			{Precedence: 2, Statement: name + "AcceptPrefix10"},
+		},
+	}
+}
+
+func TestExportPolicy(t *testing.T) {
+	server := getTestServer(t)
+	createExportPolicy("testExport")
+
+	s1 := connectSpeaker(t, server, "127.0.3.1", 65031, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s1, "127.0.3.1")
+	s2 := connectSpeaker(t, server, "127.0.3.2", 65032, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s2, "127.0.3.2")
+	s3 := connectSpeaker(t, server, "127.0.3.3", 65033, config.BaseConfig{ExportPolicy: "testExport"},
+		speaker.Config{})
+	defer removeSpeaker(server, s3, "127.0.3.3")
+	s4 := connectSpeaker(t, server, "127.0.3.4", 65034,
+		config.BaseConfig{ExportPolicy: "testExport", RouteServerClient: true}, speaker.Config{})
+	defer removeSpeaker(server, s4, "127.0.3.4")
+
+	// The best path to 10.35.3.0/24 is through AS 174, the other path is longer
+	announce(t, s2, speaker.PathAttrs{ASPath: []uint32{65032, 300, 400}, NextHop: net.ParseIP("127.0.3.2")},
+		"10.35.3.0/24")
+	if _, err := s3.WaitForRoute(ipv4Family, "10.35.3.0/24", 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	announce(t, s1, speaker.PathAttrs{ASPath: []uint32{65031, 174}, NextHop: net.ParseIP("127.0.3.1")},
+		"10.35.3.0/24", "10.35.4.0/24")
+	announce(t, s1, speaker.PathAttrs{ASPath: []uint32{65031}, NextHop: net.ParseIP("127.0.3.1")}, "10.35.5.0/24")
+
+	for _, s := range []*speaker.Speaker{s3, s4} {
+		if _, err := s.WaitForRoute(ipv4Family, "10.35.5.0/24", 0, testTimeout); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.WaitForRoute(ipv4Family, "10.35.4.0/24", 0, 0); err == nil {
+			t.Fatal("Path through AS 174 to 10.35.4.0/24 advertised with the export policy")
+		}
+	}
+
+	// The export policy rejects the best path, the neighbor doesn't get the other path
+	if err := s3.WaitForWithdraw(ipv4Family, "10.35.3.0/24", 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// The route server client gets the best path that its export policy accepts, transparently
+	route, err := s4.WaitForRoute(ipv4Family, "10.35.3.0/24", 0, testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkASPath(t, route, []uint32{65032, 300, 400})
+	if !route.GetNextHop().Equal(net.ParseIP("127.0.3.2")) {
+		t.Fatal("Route server client got next hop", route.GetNextHop(), "expected 127.0.3.2")
+	}
+
+	// Neighbors without the export policy get the best path
+	route, err = s2.WaitForRoute(ipv4Family, "10.35.4.0/24", 0, testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkASPath(t, route, []uint32{testLocalAS, 65031, 174})
+}
+
+func TestExportPolicyUpdate(t *testing.T) {
+	server := getTestServer(t)
+
+	s1 := connectSpeaker(t, server, "127.0.7.1", 65071, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s1, "127.0.7.1")
+	s2 := connectSpeaker(t, server, "127.0.7.2", 65072, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s2, "127.0.7.2")
+	s3 := connectSpeaker(t, server, "127.0.7.3", 65073, config.BaseConfig{ExportPolicy: "testLateExport"},
+		speaker.Config{})
+	defer removeSpeaker(server, s3, "127.0.7.3")
+
+	announce(t, s1, speaker.PathAttrs{ASPath: []uint32{65071}, NextHop: net.ParseIP("127.0.7.1")}, "10.40.1.0/24")
+	announce(t, s1, speaker.PathAttrs{ASPath: []uint32{65071, 174}, NextHop: net.ParseIP("127.0.7.1")},
+		"10.40.2.0/24")
+	for _, prefix := range []string{"10.40.1.0/24", "10.40.2.0/24"} {
+		if _, err := s2.WaitForRoute(ipv4Family, prefix, 0, testTimeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s3.WaitForRoute(ipv4Family, "10.40.1.0/24", 0, 0); err == nil {
+		t.Fatal("Route advertised to the neighbor before its export policy was created")
+	}
+
+	// The routes are sent again when the export policy is created
+	createExportPolicy("testLateExport")
+	if _, err := s3.WaitForRoute(ipv4Family, "10.40.1.0/24", 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s3.WaitForRoute(ipv4Family, "10.40.2.0/24", 0, 0); err == nil {
+		t.Fatal("Path through AS 174 to 10.40.2.0/24 advertised with the export policy")
+	}
+	if err := server.ValidateExportPolicy("testLateExport"); err != nil {
+		t.Error("ValidateExportPolicy failed with error", err)
+	}
+
+	// The routes are withdrawn when the export policy is deleted
+	if err := testPolicyManager.DeletePolicyDefinition("testLateExport"); err != nil {
+		t.Fatal("DeletePolicyDefinition failed with error", err)
+	}
+	if err := s3.WaitForWithdraw(ipv4Family, "10.40.1.0/24", 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.ValidateExportPolicy("testLateExport"); err == nil {
+		t.Error("ValidateExportPolicy of the deleted policy didn't fail")
+	}
+}
+
+func TestAggregation(t *testing.T) {
+	server := getTestServer(t)
+	server.AddAggCh <- AggUpdate{NewAgg: config.BGPAggregate{IPPrefix: "10.36.0.0/16", SendSummaryOnly: true}}
+	defer func() { server.RemAggCh <- "10.36.0.0/16" }()
+
+	s1 := connectSpeaker(t, server, "127.0.4.1", 65041, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s1, "127.0.4.1")
+	s2 := connectSpeaker(t, server, "127.0.4.2", 65042, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s2, "127.0.4.2")
+
+	attrs := speaker.PathAttrs{ASPath: []uint32{65041}, NextHop: net.ParseIP("127.0.4.1")}
+	announce(t, s1, attrs, "10.36.1.0/24", "10.36.2.0/24")
+	announce(t, s1, attrs, "10.37.1.0/24")
+	if _, err := s2.WaitForRoute(ipv4Family, "10.36.0.0/16", 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s2.WaitForRoute(ipv4Family, "10.37.1.0/24", 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the summary is advertised
+	for _, prefix := range []string{"10.36.1.0/24", "10.36.2.0/24"} {
+		if _, err := s2.WaitForRoute(ipv4Family, prefix, 0, 0); err == nil {
+			t.Fatal("Contributing route", prefix, "advertised with summary only")
+		}
+	}
+
+	// The aggregate stays until the last contributing route is withdrawn
+	withdraw(t, s1, "10.36.1.0/24")
+	withdraw(t, s1, "10.37.1.0/24")
+	if err := s2.WaitForWithdraw(ipv4Family, "10.37.1.0/24", 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s2.WaitForRoute(ipv4Family, "10.36.0.0/16", 0, 0); err != nil {
+		t.Fatal("Aggregate withdrawn while 10.36.2.0/24 is still reachable")
+	}
+
+	withdraw(t, s1, "10.36.2.0/24")
+	if err := s2.WaitForWithdraw(ipv4Family, "10.36.0.0/16", 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+/*  waitForASPathLen waits till the speaker has the path to the prefix with the AS path length.
+ */
+func waitForASPathLen(s *speaker.Speaker, prefix string, asPathLen int) error {
+	return s.WaitFor(testTimeout, func(ribIn map[uint32]map[string]*speaker.Route) bool {
+		for _, route := range ribIn[ipv4Family] {
+			if route.GetPrefix() == prefix && len(route.GetASPath()) == asPathLen {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestPICBackupPath(t *testing.T) {
+	server := getTestServer(t)
+	baseConf := testGlobalConfig()
+	picConf := testGlobalConfig()
+	picConf.IPv4UnicastPIC = true
+	server.GlobalConfigCh <- GlobalUpdate{OldConfig: baseConf, NewConfig: picConf}
+	picEnabled := true
+	defer func() {
+		if picEnabled {
+			server.GlobalConfigCh <- GlobalUpdate{OldConfig: picConf, NewConfig: baseConf}
+		}
+	}()
+
+	s1 := connectSpeaker(t, server, "127.0.5.1", 65051, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s1, "127.0.5.1")
+	s2 := connectSpeaker(t, server, "127.0.5.2", 65052, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s2, "127.0.5.2")
+	s3 := connectSpeaker(t, server, "127.0.5.3", 65053, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s3, "127.0.5.3")
+
+	prefix := "10.38.1.0/24"
+	dest := "10.38.1.0"
+	announce(t, s1, speaker.PathAttrs{ASPath: []uint32{65051}, NextHop: net.ParseIP("127.0.5.1")}, prefix)
+	if err := waitForASPathLen(s3, prefix, 2); err != nil {
+		t.Fatal("Best path from 127.0.5.1 not advertised,", err)
+	}
+
+	// The path from the other neighbor is the backup of the best path
+	announce(t, s2, speaker.PathAttrs{ASPath: []uint32{65052, 100}, NextHop: net.ParseIP("127.0.5.2")}, prefix)
+	backupSet := testRouteManager.waitFor(testTimeout, func(m *testRouteMgr) bool {
+		return m.backupNextHops[dest] == "127.0.5.2" && m.trackedNextHops["127.0.5.1"] &&
+			m.trackedNextHops["127.0.5.2"]
+	})
+	if !backupSet {
+		t.Fatal("Backup next hop 127.0.5.2 not set for", prefix, "or the next hops not tracked")
+	}
+
+	// The route is switched to the backup next hop when the route manager reports the next hop unreachable
+	server.NextHopCh <- config.NextHopStateInfo{IP: "127.0.5.1", Reachable: false}
+	switched := testRouteManager.waitFor(testTimeout, func(m *testRouteMgr) bool {
+		return m.switchedNextHops[dest] == "127.0.5.2"
+	})
+	if !switched {
+		t.Fatal("Route", prefix, "not switched to the backup next hop 127.0.5.2")
+	}
+	if err := waitForASPathLen(s3, prefix, 3); err != nil {
+		t.Fatal("Backup path from 127.0.5.2 not advertised after the next hop was not reachable,", err)
+	}
+
+	// The best path is selected again when the next hop is reachable
+	server.NextHopCh <- config.NextHopStateInfo{IP: "127.0.5.1", Reachable: true}
+	if err := waitForASPathLen(s3, prefix, 2); err != nil {
+		t.Fatal("Path from 127.0.5.1 not advertised after the next hop was reachable,", err)
+	}
+	backupSet = testRouteManager.waitFor(testTimeout, func(m *testRouteMgr) bool {
+		return m.backupNextHops[dest] == "127.0.5.2"
+	})
+	if !backupSet {
+		t.Fatal("Backup next hop 127.0.5.2 not set for", prefix, "after the best path was selected again")
+	}
+
+	// The next hops are not tracked once PIC is disabled
+	server.GlobalConfigCh <- GlobalUpdate{OldConfig: picConf, NewConfig: baseConf}
+	picEnabled = false
+	untracked := testRouteManager.waitFor(testTimeout, func(m *testRouteMgr) bool {
+		return len(m.trackedNextHops) == 0 && m.backupNextHops[dest] == ""
+	})
+	if !untracked {
+		t.Fatal("Next hops still tracked or backup next hop set after PIC was disabled")
+	}
+}
+
+func testIPToUint32(ip string) uint32 {
+	return binary.BigEndian.Uint32(net.ParseIP(ip).To4())
+}
+
+func testRouterLsa(routerId string, links ...config.LinkStateLink) *config.LinkStateLsa {
+	return &config.LinkStateLsa{
+		LSType:    bgprib.LsaTypeRouter,
+		LSId:      testIPToUint32(routerId),
+		AdvRouter: testIPToUint32(routerId),
+		Links:     links,
+	}
+}
+
+func testP2PLink(routerId string, metric uint16) config.LinkStateLink {
+	return config.LinkStateLink{LinkId: testIPToUint32(routerId), LinkType: bgprib.LsaLinkTypeP2P, Metric: metric}
+}
+
+func testStubLink(hostIP string) config.LinkStateLink {
+	return config.LinkStateLink{LinkId: testIPToUint32(hostIP), LinkData: testIPToUint32("255.255.255.255"),
+		LinkType: bgprib.LsaLinkTypeStub}
+}
+
+func waitForNextHop(s *speaker.Speaker, prefix string, nextHop string) error {
+	return s.WaitFor(testTimeout, func(ribIn map[uint32]map[string]*speaker.Route) bool {
+		for _, route := range ribIn[ipv4Family] {
+			if route.GetPrefix() == prefix && route.GetNextHop().Equal(net.ParseIP(nextHop)) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestORRIGPDistance(t *testing.T) {
+	server := getTestServer(t)
+	baseConf := testGlobalConfig()
+	orrConf := testGlobalConfig()
+	orrConf.ORRGroups = []config.ORRGroupConfig{{Name: "orr1", IGPPosition: net.ParseIP("1.1.1.1")}}
+	server.GlobalConfigCh <- GlobalUpdate{OldConfig: baseConf, NewConfig: orrConf}
+	defer func() { server.GlobalConfigCh <- GlobalUpdate{OldConfig: orrConf, NewConfig: baseConf} }()
+
+	// The next hop of 127.0.6.1 is at distance 30 and the next hop of 127.0.6.2 at distance 10 from 1.1.1.1
+	positionLsa := testRouterLsa("1.1.1.1", testP2PLink("2.2.2.2", 30), testP2PLink("3.3.3.3", 10))
+	lsas := []*config.LinkStateLsa{positionLsa, testRouterLsa("2.2.2.2", testStubLink("127.0.6.1")),
+		testRouterLsa("3.3.3.3", testStubLink("127.0.6.2"))}
+	server.LinkStateCh <- &config.LinkStateCh{Add: lsas}
+	defer func() { server.LinkStateCh <- &config.LinkStateCh{Remove: lsas[1:]} }()
+
+	s1 := connectSpeaker(t, server, "127.0.6.1", testLocalAS, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s1, "127.0.6.1")
+	s2 := connectSpeaker(t, server, "127.0.6.2", testLocalAS, config.BaseConfig{}, speaker.Config{})
+	defer removeSpeaker(server, s2, "127.0.6.2")
+	s3 := connectSpeaker(t, server, "127.0.6.3", testLocalAS,
+		config.BaseConfig{RouteReflectorClient: true, ORRGroup: "orr1"}, speaker.Config{})
+	defer removeSpeaker(server, s3, "127.0.6.3")
+	s4 := connectSpeaker(t, server, "127.0.6.4", testLocalAS, config.BaseConfig{RouteReflectorClient: true},
+		speaker.Config{})
+	defer removeSpeaker(server, s4, "127.0.6.4")
+
+	// The Loc-RIB selects the path from the neighbor with the lower router id, the ORR group the path with the
+	// lower IGP distance from the IGP position
+	prefix := "10.39.1.0/24"
+	announce(t, s1, speaker.PathAttrs{ASPath: []uint32{100}, NextHop: net.ParseIP("127.0.6.1")}, prefix)
+	announce(t, s2, speaker.PathAttrs{ASPath: []uint32{100}, NextHop: net.ParseIP("127.0.6.2")}, prefix)
+	if err := waitForNextHop(s3, prefix, "127.0.6.2"); err != nil {
+		t.Fatal("Path with the lower IGP distance not advertised to the ORR group client,", err)
+	}
+	if err := waitForNextHop(s4, prefix, "127.0.6.1"); err != nil {
+		t.Fatal("Loc-RIB best path not advertised to the client outside the ORR group,", err)
+	}
+
+	// The ORR group selects the other path after the IGP distance changed
+	positionLsa = testRouterLsa("1.1.1.1", testP2PLink("2.2.2.2", 5), testP2PLink("3.3.3.3", 10))
+	server.LinkStateCh <- &config.LinkStateCh{Add: []*config.LinkStateLsa{positionLsa}}
+	if err := waitForNextHop(s3, prefix, "127.0.6.1"); err != nil {
+		t.Fatal("Path with the lower IGP distance not advertised after the IGP distance changed,", err)
+	}
+
+	positionLsa = testRouterLsa("1.1.1.1", testP2PLink("2.2.2.2", 30), testP2PLink("3.3.3.3", 10))
+	server.LinkStateCh <- &config.LinkStateCh{Add: []*config.LinkStateLsa{positionLsa}}
+	if err := waitForNextHop(s3, prefix, "127.0.6.2"); err != nil {
+		t.Fatal("Path with the lower IGP distance not advertised after the IGP distance changed back,", err)
+	}
+
+	// The Loc-RIB best path is used when the IGP position is not in the link state database
+	server.LinkStateCh <- &config.LinkStateCh{Remove: []*config.LinkStateLsa{positionLsa}}
+	if err := waitForNextHop(s3, prefix, "127.0.6.1"); err != nil {
+		t.Fatal("Loc-RIB best path not advertised after the IGP position was removed,", err)
+	}
+
+	withdraw(t, s1, prefix)
+	withdraw(t, s2, prefix)
+	if err := s3.WaitForWithdraw(ipv4Family, prefix, 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
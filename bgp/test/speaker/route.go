@@ -0,0 +1,183 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// route.go
+package speaker
+
+import (
+	"fmt"
+	"l3/bgp/packet"
+	"net"
+)
+
+/*  PathAttrs describes the path attributes of the routes announced by the speaker. MED and local
+ *  preference are not sent when they are 0.
+ */
+type PathAttrs struct {
+	Origin      packet.BGPPathAttrOriginType
+	ASPath      []uint32
+	NextHop     net.IP
+	MED         uint32
+	LocalPref   uint32
+	Communities []uint32
+}
+
+/*  ConstructPathAttrs encodes the AS path with the AS size negotiated with the far end.
+ */
+func (s *Speaker) ConstructPathAttrs(attrs PathAttrs) []packet.BGPPathAttr {
+	pathAttrs := make([]packet.BGPPathAttr, 0)
+	pathAttrs = append(pathAttrs, packet.NewBGPPathAttrOrigin(attrs.Origin))
+
+	asPath := packet.NewBGPPathAttrASPath()
+	asPath.ASSize = s.peerAttrs.ASSize
+	if len(attrs.ASPath) > 0 {
+		var seg packet.BGPASPathSegment
+		if s.peerAttrs.ASSize == 4 {
+			seg = packet.NewBGPAS4PathSegmentSeq()
+		} else {
+			seg = packet.NewBGPAS2PathSegmentSeq()
+		}
+		for _, as := range attrs.ASPath {
+			seg.AppendAS(as)
+		}
+		asPath.AppendASPathSegment(seg)
+	}
+	pathAttrs = append(pathAttrs, asPath)
+
+	if attrs.NextHop.To4() != nil {
+		nextHop := packet.NewBGPPathAttrNextHop()
+		nextHop.Value = attrs.NextHop.To4()
+		pathAttrs = append(pathAttrs, nextHop)
+	}
+
+	if attrs.MED != 0 {
+		med := packet.NewBGPPathAttrMultiExitDisc()
+		med.Value = attrs.MED
+		pathAttrs = append(pathAttrs, med)
+	}
+
+	if attrs.LocalPref != 0 {
+		localPref := packet.NewBGPPathAttrLocalPref()
+		localPref.Value = attrs.LocalPref
+		pathAttrs = append(pathAttrs, localPref)
+	}
+
+	if len(attrs.Communities) > 0 {
+		communities := packet.NewBGPPathAttrCommunities()
+		for _, community := range attrs.Communities {
+			communities.AddCommunity(community)
+		}
+		pathAttrs = append(pathAttrs, communities)
+	}
+
+	return pathAttrs
+}
+
+/*  Route is a route received from the far end.
+ */
+type Route struct {
+	NLRI      packet.NLRI
+	PathAttrs []packet.BGPPathAttr
+}
+
+func NewRoute(nlri packet.NLRI, pathAttrs []packet.BGPPathAttr) *Route {
+	return &Route{
+		NLRI:      nlri,
+		PathAttrs: pathAttrs,
+	}
+}
+
+func getRouteKey(prefix string, pathId uint32) string {
+	if _, ipNet, err := net.ParseCIDR(prefix); err == nil {
+		prefix = ipNet.String()
+	}
+	return fmt.Sprintf("%s-%d", prefix, pathId)
+}
+
+func (r *Route) key() string {
+	return getRouteKey(r.GetPrefix(), r.GetPathId())
+}
+
+/*  GetPrefix returns the prefix of the route in CIDR notation.
+ */
+func (r *Route) GetPrefix() string {
+	return fmt.Sprintf("%s/%d", r.NLRI.GetPrefix(), r.NLRI.GetLength())
+}
+
+func (r *Route) GetPathId() uint32 {
+	if extNLRI, ok := r.NLRI.(*packet.ExtNLRI); ok {
+		return extNLRI.PathId
+	}
+	return r.NLRI.GetPathId()
+}
+
+func (r *Route) GetASPath() []uint32 {
+	asList := make([]uint32, 0)
+	for _, attr := range r.PathAttrs {
+		if asPath, ok := attr.(*packet.BGPPathAttrASPath); ok {
+			for _, seg := range asPath.Value {
+				switch seg.(type) {
+				case *packet.BGPAS4PathSegment:
+					asList = append(asList, seg.(*packet.BGPAS4PathSegment).AS...)
+
+				case *packet.BGPAS2PathSegment:
+					for _, as := range seg.(*packet.BGPAS2PathSegment).AS {
+						asList = append(asList, uint32(as))
+					}
+				}
+			}
+			break
+		}
+	}
+	return asList
+}
+
+func (r *Route) GetNextHop() net.IP {
+	for _, attr := range r.PathAttrs {
+		if mpReach, ok := attr.(*packet.BGPPathAttrMPReachNLRI); ok && mpReach.NextHop != nil {
+			return mpReach.NextHop.GetNextHop()
+		}
+	}
+	return packet.GetNextHop(r.PathAttrs)
+}
+
+func (r *Route) GetOrigin() uint8 {
+	return packet.GetOrigin(r.PathAttrs)
+}
+
+func (r *Route) GetMED() (uint32, bool) {
+	return packet.GetMED(r.PathAttrs)
+}
+
+func (r *Route) GetLocalPref() (uint32, bool) {
+	for _, attr := range r.PathAttrs {
+		if localPref, ok := attr.(*packet.BGPPathAttrLocalPref); ok {
+			return localPref.Value, true
+		}
+	}
+	return 0, false
+}
+
+func (r *Route) HasCommunity(community uint32) bool {
+	return packet.HasCommunity(r.PathAttrs, community)
+}
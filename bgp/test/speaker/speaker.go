@@ -0,0 +1,516 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// speaker.go
+package speaker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"l3/bgp/packet"
+	"net"
+	"sync"
+	"time"
+	"utils/logging"
+)
+
+const DefaultHoldTime uint16 = 180
+
+/*  Config is the OPEN message the speaker sends. If OptParams is set it is sent as is, otherwise the
+ *  capabilities are constructed from AfiSafis and the add path settings the same way bgpd does.
+ *  LocalAddress is the source address of the connection when the speaker dials, bgpd identifies the
+ *  neighbor by it.
+ */
+type Config struct {
+	LocalAddress  string
+	LocalAS       uint32
+	RouterId      string
+	HoldTime      uint16
+	AfiSafis      map[uint32]bool
+	AddPathsRx    bool
+	AddPathsMaxTx uint8
+	Role          string
+	OptParams     []packet.BGPOptParam
+}
+
+/*  Speaker is a minimal BGP speaker that is used to script sessions with bgpd in tests. It brings up
+ *  the session, keeps it alive and records all the UPDATE messages received from the far end.
+ */
+type Speaker struct {
+	logger    *logging.Writer
+	conf      Config
+	conn      net.Conn
+	peerAttrs packet.BGPPeerAttrs
+	PeerOpen  *packet.BGPOpen
+
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	updates    []*packet.BGPUpdate
+	ribIn      map[uint32]map[string]*Route
+	notif      *packet.BGPNotification
+	err        error
+	rxCh       chan bool
+	closeCh    chan bool
+	doneCh     chan bool
+}
+
+func NewSpeaker(logger *logging.Writer, conf Config) *Speaker {
+	if conf.HoldTime == 0 {
+		conf.HoldTime = DefaultHoldTime
+	}
+	if len(conf.AfiSafis) == 0 {
+		conf.AfiSafis = map[uint32]bool{packet.ProtocolFamilyMap["ipv4-unicast"]: true}
+	}
+
+	return &Speaker{
+		logger: logger,
+		conf:   conf,
+		peerAttrs: packet.BGPPeerAttrs{
+			ASSize: 2,
+		},
+		updates: make([]*packet.BGPUpdate, 0),
+		ribIn:   make(map[uint32]map[string]*Route),
+		rxCh:    make(chan bool, 1),
+		closeCh: make(chan bool),
+		doneCh:  make(chan bool),
+	}
+}
+
+/*  Dial opens the TCP connection to bgpd and brings up the session.
+ */
+func (s *Speaker) Dial(addr string, timeout time.Duration) error {
+	dialer := net.Dialer{Timeout: timeout}
+	if s.conf.LocalAddress != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(s.conf.LocalAddress)}
+	}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.establish(conn, timeout)
+}
+
+/*  Accept waits for bgpd to connect to the listener and brings up the session.
+ */
+func (s *Speaker) Accept(listener net.Listener, timeout time.Duration) error {
+	if tcpListener, ok := listener.(*net.TCPListener); ok {
+		tcpListener.SetDeadline(time.Now().Add(timeout))
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		return err
+	}
+	return s.establish(conn, timeout)
+}
+
+func (s *Speaker) establish(conn net.Conn, timeout time.Duration) error {
+	s.conn = conn
+	if err := s.openSession(timeout); err != nil {
+		conn.Close()
+		s.conn = nil
+		return err
+	}
+
+	s.logger.Infof("Speaker AS %d: session established with %s", s.conf.LocalAS, conn.RemoteAddr())
+	go s.readMessages()
+	go s.sendKeepAlives(s.getKeepAliveTime())
+	return nil
+}
+
+func (s *Speaker) openSession(timeout time.Duration) error {
+	optParams := s.conf.OptParams
+	if optParams == nil {
+		optParams = packet.ConstructOptParams(s.conf.LocalAS, s.conf.AfiSafis, s.conf.AddPathsRx,
+			s.conf.AddPathsMaxTx, s.conf.Role)
+	}
+	if err := s.SendMessage(packet.NewBGPOpenMessage(s.conf.LocalAS, s.conf.HoldTime, s.conf.RouterId,
+		optParams)); err != nil {
+		return err
+	}
+
+	s.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer s.conn.SetReadDeadline(time.Time{})
+	msg, err := s.readMessage()
+	if err != nil {
+		return err
+	}
+	if msg.Header.Type != packet.BGPMsgTypeOpen {
+		return errors.New(fmt.Sprintf("Expected OPEN message, received message type %d", msg.Header.Type))
+	}
+	s.processOpen(msg.Body.(*packet.BGPOpen))
+
+	if err = s.SendMessage(packet.NewBGPKeepAliveMessage()); err != nil {
+		return err
+	}
+
+	msg, err = s.readMessage()
+	if err != nil {
+		return err
+	}
+	if msg.Header.Type == packet.BGPMsgTypeNotification {
+		notif := msg.Body.(*packet.BGPNotification)
+		s.notif = notif
+		return errors.New(fmt.Sprintf("Received NOTIFICATION code %d subcode %d", notif.ErrorCode,
+			notif.ErrorSubcode))
+	}
+	if msg.Header.Type != packet.BGPMsgTypeKeepAlive {
+		return errors.New(fmt.Sprintf("Expected KEEPALIVE message, received message type %d", msg.Header.Type))
+	}
+	return nil
+}
+
+func (s *Speaker) processOpen(openMsg *packet.BGPOpen) {
+	s.PeerOpen = openMsg
+	s.peerAttrs.ASSize = packet.GetASSize(openMsg)
+	s.peerAttrs.AddPathFamily = packet.GetAddPathFamily(openMsg)
+	s.peerAttrs.AddPathsRxActual = s.conf.AddPathsRx && packet.IsAddPathsTxEnabledForIPv4(s.peerAttrs.AddPathFamily)
+	s.peerAttrs.ExtendedMsg = packet.IsExtendedMsgEnabled(openMsg)
+}
+
+func (s *Speaker) getKeepAliveTime() time.Duration {
+	holdTime := s.conf.HoldTime
+	if s.PeerOpen != nil && s.PeerOpen.HoldTime < holdTime {
+		holdTime = s.PeerOpen.HoldTime
+	}
+	if holdTime == 0 {
+		return 0
+	}
+	return time.Duration(holdTime) * time.Second / 3
+}
+
+func (s *Speaker) readMessage() (*packet.BGPMessage, error) {
+	buf := make([]byte, packet.BGPMsgHeaderLen)
+	if _, err := io.ReadFull(s.conn, buf); err != nil {
+		return nil, err
+	}
+
+	header := packet.NewBGPHeader()
+	if err := header.Decode(buf); err != nil {
+		return nil, err
+	}
+	if err := header.ValidateLen(packet.GetMaxMsgLen(s.peerAttrs.ExtendedMsg)); err != nil {
+		return nil, err
+	}
+
+	buf = make([]byte, header.Len()-packet.BGPMsgHeaderLen)
+	if _, err := io.ReadFull(s.conn, buf); err != nil {
+		return nil, err
+	}
+
+	msg := packet.NewBGPMessage()
+	if err := msg.Decode(header, buf, s.peerAttrs); err != nil && !packet.IsUpdateAttrErrors(err) {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *Speaker) readMessages() {
+	defer close(s.doneCh)
+	for {
+		msg, err := s.readMessage()
+		if err != nil {
+			s.setError(err)
+			return
+		}
+
+		switch msg.Header.Type {
+		case packet.BGPMsgTypeUpdate:
+			s.processUpdate(msg.Body.(*packet.BGPUpdate))
+
+		case packet.BGPMsgTypeNotification:
+			notif := msg.Body.(*packet.BGPNotification)
+			s.mutex.Lock()
+			s.notif = notif
+			s.mutex.Unlock()
+			s.setError(errors.New(fmt.Sprintf("Received NOTIFICATION code %d subcode %d", notif.ErrorCode,
+				notif.ErrorSubcode)))
+			return
+		}
+	}
+}
+
+func (s *Speaker) sendKeepAlives(interval time.Duration) {
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.SendMessage(packet.NewBGPKeepAliveMessage()); err != nil {
+				return
+			}
+
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
+func (s *Speaker) setError(err error) {
+	s.mutex.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mutex.Unlock()
+	s.signalRx()
+}
+
+func (s *Speaker) signalRx() {
+	select {
+	case s.rxCh <- true:
+	default:
+	}
+}
+
+func (s *Speaker) processUpdate(update *packet.BGPUpdate) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ipv4Family := packet.GetProtocolFamily(packet.AfiIP, packet.SafiUnicast)
+	s.removeRoutes(ipv4Family, update.WithdrawnRoutes)
+	pathAttrs := make([]packet.BGPPathAttr, 0, len(update.PathAttributes))
+	for _, pa := range update.PathAttributes {
+		switch pa.(type) {
+		case *packet.BGPPathAttrMPUnreachNLRI:
+			mpUnreach := pa.(*packet.BGPPathAttrMPUnreachNLRI)
+			s.removeRoutes(packet.GetProtocolFamily(mpUnreach.AFI, mpUnreach.SAFI), mpUnreach.NLRI)
+
+		case *packet.BGPPathAttrMPReachNLRI:
+
+		default:
+			pathAttrs = append(pathAttrs, pa)
+		}
+	}
+
+	s.addRoutes(ipv4Family, update.NLRI, pathAttrs)
+	for _, pa := range update.PathAttributes {
+		if mpReach, ok := pa.(*packet.BGPPathAttrMPReachNLRI); ok {
+			s.addRoutes(packet.GetProtocolFamily(mpReach.AFI, mpReach.SAFI), mpReach.NLRI,
+				append(packet.CopyPathAttrs(pathAttrs), mpReach))
+		}
+	}
+
+	s.updates = append(s.updates, update)
+	s.signalRx()
+}
+
+func (s *Speaker) addRoutes(protoFamily uint32, nlris []packet.NLRI, pathAttrs []packet.BGPPathAttr) {
+	if len(nlris) == 0 {
+		return
+	}
+	if _, ok := s.ribIn[protoFamily]; !ok {
+		s.ribIn[protoFamily] = make(map[string]*Route)
+	}
+	for _, nlri := range nlris {
+		route := NewRoute(nlri, pathAttrs)
+		s.ribIn[protoFamily][route.key()] = route
+	}
+}
+
+func (s *Speaker) removeRoutes(protoFamily uint32, nlris []packet.NLRI) {
+	for _, nlri := range nlris {
+		route := NewRoute(nlri, nil)
+		delete(s.ribIn[protoFamily], route.key())
+	}
+}
+
+/*  SendMessage encodes and sends a message to the far end. It can be used to send malformed or
+ *  unusual messages that the other helpers don't construct.
+ */
+func (s *Speaker) SendMessage(msg *packet.BGPMessage) error {
+	pkt, err := msg.EncodeWithMaxLen(packet.GetMaxMsgLen(s.peerAttrs.ExtendedMsg))
+	if err != nil {
+		return err
+	}
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	_, err = s.conn.Write(pkt)
+	return err
+}
+
+/*  Announce sends IPv4 unicast NLRI with the path attributes in an UPDATE message.
+ */
+func (s *Speaker) Announce(pathAttrs []packet.BGPPathAttr, nlri ...packet.NLRI) error {
+	return s.SendMessage(packet.NewBGPUpdateMessage(make([]packet.NLRI, 0), pathAttrs, nlri))
+}
+
+/*  Withdraw sends IPv4 unicast withdrawn routes in an UPDATE message.
+ */
+func (s *Speaker) Withdraw(nlri ...packet.NLRI) error {
+	return s.SendMessage(packet.NewBGPUpdateMessage(nlri, make([]packet.BGPPathAttr, 0), make([]packet.NLRI, 0)))
+}
+
+/*  AnnounceMP sends NLRI of any family in the MP_REACH_NLRI attribute.
+ */
+func (s *Speaker) AnnounceMP(protoFamily uint32, nextHop net.IP, pathAttrs []packet.BGPPathAttr,
+	nlri ...packet.NLRI) error {
+	afi, safi := packet.GetAfiSafi(protoFamily)
+	mpReach := packet.NewBGPPathAttrMPReachNLRI()
+	mpReach.AFI = afi
+	mpReach.SAFI = safi
+	mpNextHop := packet.BGPGetMPNextHop(afi)
+	switch mpNextHop.(type) {
+	case *packet.MPNextHopIP:
+		mpNextHop.(*packet.MPNextHopIP).SetNextHop(nextHop)
+
+	case *packet.MPNextHopIP6:
+		mpNextHop.(*packet.MPNextHopIP6).SetGlobalNextHop(nextHop)
+	}
+	mpReach.SetNextHop(mpNextHop)
+	mpReach.SetNLRIList(nlri)
+
+	pa := packet.CopyPathAttrs(pathAttrs)
+	pa = append(pa, mpReach)
+	return s.SendMessage(packet.NewBGPUpdateMessage(make([]packet.NLRI, 0), pa, make([]packet.NLRI, 0)))
+}
+
+/*  WithdrawMP sends withdrawn routes of any family in the MP_UNREACH_NLRI attribute.
+ */
+func (s *Speaker) WithdrawMP(protoFamily uint32, nlri ...packet.NLRI) error {
+	afi, safi := packet.GetAfiSafi(protoFamily)
+	mpUnreach := packet.NewBGPPathAttrMPUnreachNLRI()
+	mpUnreach.AFI = afi
+	mpUnreach.SAFI = safi
+	mpUnreach.AddNLRIList(nlri)
+	return s.SendMessage(packet.NewBGPUpdateMessage(make([]packet.NLRI, 0), []packet.BGPPathAttr{mpUnreach},
+		make([]packet.NLRI, 0)))
+}
+
+/*  ReceiveUpdate returns the next UPDATE received from the far end, in the order they were received.
+ */
+func (s *Speaker) ReceiveUpdate(timeout time.Duration) (*packet.BGPUpdate, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mutex.Lock()
+		if len(s.updates) > 0 {
+			update := s.updates[0]
+			s.updates = s.updates[1:]
+			s.mutex.Unlock()
+			return update, nil
+		}
+		err := s.err
+		s.mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-s.rxCh:
+		case <-deadline:
+			return nil, errors.New("Timed out waiting for UPDATE message")
+		}
+	}
+}
+
+/*  WaitFor waits until check returns true for the routes received from the far end. It is the building
+ *  block for the route assertions.
+ */
+func (s *Speaker) WaitFor(timeout time.Duration, check func(ribIn map[uint32]map[string]*Route) bool) error {
+	deadline := time.After(timeout)
+	for {
+		s.mutex.Lock()
+		done := check(s.ribIn)
+		err := s.err
+		s.mutex.Unlock()
+		if done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-s.rxCh:
+		case <-deadline:
+			return errors.New("Timed out waiting for routes")
+		}
+	}
+}
+
+/*  WaitForRoute waits for the route to the prefix with the path id and returns it.
+ */
+func (s *Speaker) WaitForRoute(protoFamily uint32, prefix string, pathId uint32, timeout time.Duration) (*Route,
+	error) {
+	var route *Route
+	key := getRouteKey(prefix, pathId)
+	err := s.WaitFor(timeout, func(ribIn map[uint32]map[string]*Route) bool {
+		route = ribIn[protoFamily][key]
+		return route != nil
+	})
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Route %s path id %d not received, %s", prefix, pathId, err))
+	}
+	return route, nil
+}
+
+/*  WaitForWithdraw waits until the route to the prefix with the path id is withdrawn.
+ */
+func (s *Speaker) WaitForWithdraw(protoFamily uint32, prefix string, pathId uint32, timeout time.Duration) error {
+	key := getRouteKey(prefix, pathId)
+	err := s.WaitFor(timeout, func(ribIn map[uint32]map[string]*Route) bool {
+		_, ok := ribIn[protoFamily][key]
+		return !ok
+	})
+	if err != nil {
+		return errors.New(fmt.Sprintf("Route %s path id %d not withdrawn, %s", prefix, pathId, err))
+	}
+	return nil
+}
+
+/*  GetRoutes returns a copy of the routes received from the far end for the family.
+ */
+func (s *Speaker) GetRoutes(protoFamily uint32) []*Route {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	routes := make([]*Route, 0, len(s.ribIn[protoFamily]))
+	for _, route := range s.ribIn[protoFamily] {
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+func (s *Speaker) GetNotification() *packet.BGPNotification {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.notif
+}
+
+/*  Close sends a Cease NOTIFICATION and closes the session.
+ */
+func (s *Speaker) Close() {
+	if s.conn == nil {
+		return
+	}
+
+	s.SendMessage(packet.NewBGPNotificationMessage(packet.BGPCease, packet.BGPCeaseAdminShutdown, nil))
+	close(s.closeCh)
+	s.conn.Close()
+	<-s.doneCh
+	s.conn = nil
+}
@@ -0,0 +1,179 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// speaker_test.go
+package speaker
+
+import (
+	"l3/bgp/packet"
+	"l3/bgp/utils"
+	"net"
+	"testing"
+	"time"
+	"utils/logging"
+)
+
+const testTimeout = 5 * time.Second
+
+func startSpeakers(t *testing.T, conf1, conf2 Config) (*Speaker, *Speaker) {
+	logger, err := logging.NewLogger("bgpd", "BGP", true)
+	if err != nil {
+		t.Fatal("Failed to start the logger. Exiting!!")
+	}
+	utils.SetLogger(logger)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to listen on loopback with error:", err)
+	}
+	defer listener.Close()
+
+	s1 := NewSpeaker(logger, conf1)
+	s2 := NewSpeaker(logger, conf2)
+	errCh := make(chan error)
+	go func() {
+		errCh <- s1.Accept(listener, testTimeout)
+	}()
+
+	if err = s2.Dial(listener.Addr().String(), testTimeout); err != nil {
+		t.Fatal("Speaker failed to connect with error:", err)
+	}
+	if err = <-errCh; err != nil {
+		t.Fatal("Speaker failed to accept with error:", err)
+	}
+	return s1, s2
+}
+
+func TestSpeakerAnnounceAndWithdraw(t *testing.T) {
+	s1, s2 := startSpeakers(t, Config{LocalAS: 65001, RouterId: "1.1.1.1"},
+		Config{LocalAS: 65002, RouterId: "2.2.2.2"})
+	defer s1.Close()
+	defer s2.Close()
+
+	ipv4Family := packet.GetProtocolFamily(packet.AfiIP, packet.SafiUnicast)
+	tests := []struct {
+		prefix string
+		attrs  PathAttrs
+	}{
+		{"10.1.0.0/16", PathAttrs{ASPath: []uint32{65001}, NextHop: net.ParseIP("1.1.1.1")}},
+		{"10.2.1.0/24", PathAttrs{ASPath: []uint32{65001, 174, 70000}, NextHop: net.ParseIP("1.1.1.1"), MED: 50}},
+		{"10.3.0.0/16", PathAttrs{ASPath: []uint32{65001}, NextHop: net.ParseIP("1.1.1.2"), LocalPref: 200,
+			Communities: []uint32{packet.BGPCommunityNoExport}}},
+	}
+
+	for _, test := range tests {
+		nlri, err := packet.ConstructIPPrefixFromCIDR(test.prefix)
+		if err != nil {
+			t.Fatal("ConstructIPPrefixFromCIDR failed for", test.prefix, "with error:", err)
+		}
+		if err = s1.Announce(s1.ConstructPathAttrs(test.attrs), nlri); err != nil {
+			t.Fatal("Failed to announce", test.prefix, "with error:", err)
+		}
+
+		route, err := s2.WaitForRoute(ipv4Family, test.prefix, 0, testTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		asPath := route.GetASPath()
+		if len(asPath) != len(test.attrs.ASPath) {
+			t.Fatal("Route", test.prefix, "expected AS path", test.attrs.ASPath, "got", asPath)
+		}
+		for idx, as := range test.attrs.ASPath {
+			if asPath[idx] != as {
+				t.Error("Route", test.prefix, "expected AS path", test.attrs.ASPath, "got", asPath)
+			}
+		}
+		if !route.GetNextHop().Equal(test.attrs.NextHop) {
+			t.Error("Route", test.prefix, "expected next hop", test.attrs.NextHop, "got", route.GetNextHop())
+		}
+		if med, ok := route.GetMED(); ok != (test.attrs.MED != 0) || med != test.attrs.MED {
+			t.Error("Route", test.prefix, "expected MED", test.attrs.MED, "got", med, ok)
+		}
+		if localPref, ok := route.GetLocalPref(); ok != (test.attrs.LocalPref != 0) ||
+			localPref != test.attrs.LocalPref {
+			t.Error("Route", test.prefix, "expected local pref", test.attrs.LocalPref, "got", localPref, ok)
+		}
+		for _, community := range test.attrs.Communities {
+			if !route.HasCommunity(community) {
+				t.Error("Route", test.prefix, "community", community, "not found")
+			}
+		}
+	}
+
+	if routes := s2.GetRoutes(ipv4Family); len(routes) != len(tests) {
+		t.Fatal("Expected", len(tests), "routes, got", len(routes))
+	}
+
+	nlri, _ := packet.ConstructIPPrefixFromCIDR(tests[1].prefix)
+	if err := s1.Withdraw(nlri); err != nil {
+		t.Fatal("Failed to withdraw", tests[1].prefix, "with error:", err)
+	}
+	if err := s2.WaitForWithdraw(ipv4Family, tests[1].prefix, 0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if routes := s2.GetRoutes(ipv4Family); len(routes) != len(tests)-1 {
+		t.Fatal("Expected", len(tests)-1, "routes after withdraw, got", len(routes))
+	}
+}
+
+func TestSpeakerAddPaths(t *testing.T) {
+	s1, s2 := startSpeakers(t, Config{LocalAS: 65001, RouterId: "1.1.1.1", AddPathsMaxTx: 2},
+		Config{LocalAS: 65002, RouterId: "2.2.2.2", AddPathsRx: true})
+	defer s1.Close()
+	defer s2.Close()
+
+	ipv4Family := packet.GetProtocolFamily(packet.AfiIP, packet.SafiUnicast)
+	prefix, _ := packet.ConstructIPPrefixFromCIDR("20.1.0.0/16")
+	for pathId := uint32(1); pathId <= 2; pathId++ {
+		attrs := s1.ConstructPathAttrs(PathAttrs{ASPath: []uint32{65001, 65000 + pathId},
+			NextHop: net.ParseIP("1.1.1.1")})
+		if err := s1.Announce(attrs, packet.NewExtNLRI(pathId, prefix)); err != nil {
+			t.Fatal("Failed to announce path id", pathId, "with error:", err)
+		}
+	}
+
+	for pathId := uint32(1); pathId <= 2; pathId++ {
+		route, err := s2.WaitForRoute(ipv4Family, "20.1.0.0/16", pathId, testTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if asPath := route.GetASPath(); len(asPath) != 2 || asPath[1] != 65000+pathId {
+			t.Error("Path id", pathId, "expected AS path [65001", 65000+pathId, "] got", asPath)
+		}
+	}
+}
+
+func TestSpeakerNotification(t *testing.T) {
+	s1, s2 := startSpeakers(t, Config{LocalAS: 65001, RouterId: "1.1.1.1"},
+		Config{LocalAS: 65002, RouterId: "2.2.2.2"})
+	defer s2.Close()
+
+	s1.Close()
+	if _, err := s2.ReceiveUpdate(testTimeout); err == nil {
+		t.Fatal("Expected ReceiveUpdate to fail after the far end closed the session")
+	}
+	notif := s2.GetNotification()
+	if notif == nil || notif.ErrorCode != packet.BGPCease || notif.ErrorSubcode != packet.BGPCeaseAdminShutdown {
+		t.Fatal("Expected Cease/Administrative Shutdown notification, got", notif)
+	}
+}
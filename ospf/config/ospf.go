@@ -23,7 +23,9 @@
 
 package config
 
-import ()
+import (
+	"time"
+)
 
 type AreaId string
 type RouterId string
@@ -71,8 +73,36 @@ const (
 	SimplePassword AuthType = 1
 	Md5            AuthType = 2
 	Reserved       AuthType = 3
+	HmacSha        AuthType = 4
+)
+
+const (
+	HmacSha1   string = "hmac-sha-1"
+	HmacSha256 string = "hmac-sha-256"
+	HmacSha384 string = "hmac-sha-384"
+	HmacSha512 string = "hmac-sha-512"
 )
 
+type AuthMd5Key struct {
+	KeyId uint8
+	Key   string
+}
+
+type KeyChainKey struct {
+	KeyId               uint8
+	Algorithm           string
+	Key                 string
+	SendLifetimeStart   time.Time
+	SendLifetimeEnd     time.Time
+	AcceptLifetimeStart time.Time
+	AcceptLifetimeEnd   time.Time
+}
+
+type KeyChainConf struct {
+	Name string
+	Keys []KeyChainKey
+}
+
 type RestartSupport int
 
 const (
@@ -134,6 +164,7 @@ const (
 	UnnumberedP2P     IfType = 4
 	PointToMultipoint IfType = 5
 	Stub              IfType = 6
+	VirtualLink       IfType = 7
 )
 
 var IfTypeList = []string{
@@ -143,7 +174,8 @@ var IfTypeList = []string{
 	"NumberedP2P",
 	"UnnumberedP2P",
 	"PointToMultipoint",
-	"Stub"}
+	"Stub",
+	"VirtualLink"}
 
 type MulticastForwarding int
 
@@ -161,6 +193,15 @@ const (
 	UnplannedRestart RestartStatus = 3
 )
 
+type StubRouterMode int
+
+const (
+	StubRouterNone       StubRouterMode = 1
+	StubRouterAdmin      StubRouterMode = 2
+	StubRouterStartup    StubRouterMode = 3
+	StubRouterWaitForBgp StubRouterMode = 4
+)
+
 type RestartExitReason int
 
 const (
@@ -262,6 +303,19 @@ type GlobalConf struct {
 	RestartSupport     RestartSupport
 	RestartInterval    int32
 	ReferenceBandwidth uint32
+	// RFC 6987 stub router
+	StubRouterAdvertisement AdvertiseAction
+	StubRouterOnStartup     int32
+	StubRouterWaitForBgp    bool
+	// RFC 5250 opaque LSAs, needed by graceful restart helper mode
+	OpaqueLsaSupport bool
+	// SPF and LSA generation throttling in milliseconds
+	SpfInitialDelay int32
+	SpfHoldTime     int32
+	SpfMaxWait      int32
+	LsaInitialDelay int32
+	LsaHoldTime     int32
+	LsaMaxWait      int32
 }
 
 type GlobalState struct {
@@ -279,6 +333,8 @@ type GlobalState struct {
 	AsLsaCount        int32
 	AsLsaCksumSum     int32
 	StubRouterSupport bool
+	StubRouterMode    StubRouterMode
+	StubRouterAge     int32
 	//DiscontinuityTime        string
 	DiscontinuityTime int32 //This should be string
 }
@@ -287,6 +343,7 @@ type GlobalState struct {
 type AreaConf struct {
 	AreaId                 AreaId
 	AuthType               AuthType
+	AuthKeyChain           string
 	ImportAsExtern         ImportAsExtern
 	AreaSummary            AreaSummary
 	StubDefaultCost        int32
@@ -377,6 +434,8 @@ type InterfaceConf struct {
 	IfPollInterval    PositiveInteger
 	IfAuthKey         string
 	IfAuthType        AuthType
+	IfAuthMd5Keys     []AuthMd5Key
+	IfAuthKeyChain    string
 }
 
 type InterfaceState struct {
@@ -390,6 +449,7 @@ type InterfaceState struct {
 	IfLsaCksumSum              int32
 	IfDesignatedRouterId       RouterId
 	IfBackupDesignatedRouterId RouterId
+	IfAuthFailures             int32
 }
 
 // Indexed By  IfMetricIpAddress, IfMetricAddressLessIf, IfMetricTOS
@@ -417,6 +477,8 @@ type VirtIfConf struct {
 	VirtIfRtrDeadInterval PositiveInteger
 	VirtIfAuthKey         string
 	VirtIfAuthType        AuthType
+	VirtIfAuthMd5Keys     []AuthMd5Key
+	VirtIfAuthKeyChain    string
 }
 
 type VirtIfState struct {
@@ -434,6 +496,28 @@ type VirtIfState struct {
 	VirtIfLsaCksumSum     int
 }
 
+// OSPFv3 (RFC 5340) instance, shares areas with OSPFv2
+type Ospfv3GlobalConf struct {
+	RouterId           RouterId
+	AdminStat          Status
+	ReferenceBandwidth uint32
+}
+
+// Indexed By IfIndex
+type Ospfv3IntfConf struct {
+	IfIndex           int32
+	IfInstanceId      uint8
+	IfAreaId          AreaId
+	IfType            IfType
+	IfAdminStat       Status
+	IfRtrPriority     DesignatedRouterPriority
+	IfTransitDelay    UpToMaxAge
+	IfRetransInterval UpToMaxAge
+	IfHelloInterval   HelloRange
+	IfRtrDeadInterval PositiveInteger
+	IfCost            Metric
+}
+
 // Indexed by NbrIpAddress, NbrAddressLessIndex
 type NbrConf struct {
 	NbrIpAddress        IpAddress
@@ -572,6 +656,13 @@ type OspfIPv4Route struct {
 	LSOrigin        string
 }
 
+type SpfLogState struct {
+	Index     int32
+	TimeStamp string
+	Duration  int32 // microseconds
+	Trigger   string
+}
+
 type OspfEventState struct {
 	TimeStamp      string
 	EventType      string
@@ -0,0 +1,57 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package ospfdCommonDefs
+
+const (
+	PUB_SOCKET_ADDR = "ipc:///tmp/ospfd.ipc"
+	NOTIFY_LSA_ADD  = 1
+	NOTIFY_LSA_DEL  = 2
+	NOTIFY_LSA_SYNC = 3
+)
+
+type OspfdNotifyMsg struct {
+	MsgType uint16
+	MsgBuf  []byte
+}
+
+type OspfdLinkInfo struct {
+	LinkId   uint32
+	LinkData uint32
+	LinkType uint8
+	Metric   uint16
+}
+
+/*  Router and network LSAs published for the link state export to bgpd
+ */
+type OspfdLsaInfo struct {
+	AreaId      uint32
+	LSType      uint8
+	LSId        uint32
+	AdvRouter   uint32
+	BitE        bool
+	BitB        bool
+	Netmask     uint32
+	AttachedRtr []uint32
+	Links       []OspfdLinkInfo
+}
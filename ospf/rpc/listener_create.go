@@ -27,19 +27,30 @@ import (
 	"errors"
 	"fmt"
 	"l3/ospf/config"
+	"l3/ospf/server"
 	"ospfd"
 	"strings"
 )
 
 func (h *OSPFHandler) SendOspfGlobal(ospfGlobalConf *ospfd.OspfGlobal) error {
 	gConf := config.GlobalConf{
-		RouterId:           config.RouterId(ospfGlobalConf.RouterId),
-		AdminStat:          config.Status(ospfGlobalConf.AdminStat),
-		ASBdrRtrStatus:     ospfGlobalConf.ASBdrRtrStatus,
-		TOSSupport:         ospfGlobalConf.TOSSupport,
-		RestartSupport:     config.RestartSupport(ospfGlobalConf.RestartSupport),
-		RestartInterval:    ospfGlobalConf.RestartInterval,
-		ReferenceBandwidth: uint32(ospfGlobalConf.ReferenceBandwidth),
+		RouterId:                config.RouterId(ospfGlobalConf.RouterId),
+		AdminStat:               config.Status(ospfGlobalConf.AdminStat),
+		ASBdrRtrStatus:          ospfGlobalConf.ASBdrRtrStatus,
+		TOSSupport:              ospfGlobalConf.TOSSupport,
+		RestartSupport:          config.RestartSupport(ospfGlobalConf.RestartSupport),
+		RestartInterval:         ospfGlobalConf.RestartInterval,
+		ReferenceBandwidth:      uint32(ospfGlobalConf.ReferenceBandwidth),
+		StubRouterAdvertisement: config.AdvertiseAction(ospfGlobalConf.StubRouterAdvertisement),
+		StubRouterOnStartup:     ospfGlobalConf.StubRouterOnStartup,
+		StubRouterWaitForBgp:    ospfGlobalConf.StubRouterWaitForBgp,
+		OpaqueLsaSupport:        ospfGlobalConf.OpaqueLsaSupport,
+		SpfInitialDelay:         ospfGlobalConf.SpfInitialDelay,
+		SpfHoldTime:             ospfGlobalConf.SpfHoldTime,
+		SpfMaxWait:              ospfGlobalConf.SpfMaxWait,
+		LsaInitialDelay:         ospfGlobalConf.LsaInitialDelay,
+		LsaHoldTime:             ospfGlobalConf.LsaHoldTime,
+		LsaMaxWait:              ospfGlobalConf.LsaMaxWait,
 	}
 	h.server.GlobalConfigCh <- gConf
 	//	retMsg := <-h.server.GlobalConfigRetCh
@@ -61,6 +72,14 @@ func (h *OSPFHandler) SendOspfIfConf(ospfIfConf *ospfd.OspfIfEntry) error {
 		IfPollInterval:    config.PositiveInteger(ospfIfConf.IfPollInterval),
 		IfAuthKey:         ospfIfConf.IfAuthKey,
 		IfAuthType:        config.AuthType(ospfIfConf.IfAuthType),
+		IfAuthKeyChain:    ospfIfConf.IfAuthKeyChain,
+	}
+
+	for _, md5Key := range ospfIfConf.IfAuthMd5Keys {
+		ifConf.IfAuthMd5Keys = append(ifConf.IfAuthMd5Keys, config.AuthMd5Key{
+			KeyId: uint8(md5Key.KeyId),
+			Key:   md5Key.Key,
+		})
 	}
 
 	for index, ifName := range config.IfTypeList {
@@ -81,6 +100,7 @@ func (h *OSPFHandler) SendOspfAreaConf(ospfAreaConf *ospfd.OspfAreaEntry) error
 	areaConf := config.AreaConf{
 		AreaId:                 config.AreaId(ospfAreaConf.AreaId),
 		AuthType:               config.AuthType(ospfAreaConf.AuthType),
+		AuthKeyChain:           ospfAreaConf.AuthKeyChain,
 		ImportAsExtern:         config.ImportAsExtern(ospfAreaConf.ImportAsExtern),
 		AreaSummary:            config.AreaSummary(ospfAreaConf.AreaSummary),
 		StubDefaultCost:        ospfAreaConf.StubDefaultCost,
@@ -106,6 +126,33 @@ func (h *OSPFHandler) SendOspfIfMetricConf(ospfIfMetricConf *ospfd.OspfIfMetricE
 	return nil
 }
 
+func (h *OSPFHandler) SendOspfKeyChain(ospfKeyChain *ospfd.OspfKeyChain) error {
+	keyChainConf, err := server.ConvertOspfKeyChain(ospfKeyChain)
+	if err != nil {
+		return err
+	}
+
+	h.server.KeyChainConfigCh <- keyChainConf
+	return nil
+}
+
+func (h *OSPFHandler) SendOspfVirtIfConf(ospfVirtIfConf *ospfd.OspfVirtIfEntry) error {
+	virtIfConf := server.ConvertOspfVirtIfEntry(ospfVirtIfConf)
+	return h.server.SendVirtIfConfig(virtIfConf)
+}
+
+func (h *OSPFHandler) SendOspfv3Global(ospfv3GlobalConf *ospfd.Ospfv3Global) error {
+	gConf := server.ConvertOspfv3Global(ospfv3GlobalConf)
+	h.server.Ospfv3GlobalConfigCh <- gConf
+	return nil
+}
+
+func (h *OSPFHandler) SendOspfv3IntfConf(ospfv3IntfConf *ospfd.Ospfv3IntfEntry) error {
+	ifConf := server.ConvertOspfv3IntfEntry(ospfv3IntfConf)
+	h.server.Ospfv3IntfConfigCh <- ifConf
+	return nil
+}
+
 func (h *OSPFHandler) CreateOspfGlobal(ospfGlobalConf *ospfd.OspfGlobal) (bool, error) {
 	if ospfGlobalConf == nil {
 		err := errors.New("Invalid Global Configuration")
@@ -159,6 +206,53 @@ func (h *OSPFHandler) CreateOspfIfMetricEntry(ospfIfMetricConf *ospfd.OspfIfMetr
 }
 
 func (h *OSPFHandler) CreateOspfVirtIfEntry(ospfVirtIfConf *ospfd.OspfVirtIfEntry) (bool, error) {
+	if ospfVirtIfConf == nil {
+		err := errors.New("Invalid Virtual Interface Configuration")
+		return false, err
+	}
 	h.logger.Info(fmt.Sprintln("Create virtual interface config attrs:", ospfVirtIfConf))
+	err := h.SendOspfVirtIfConf(ospfVirtIfConf)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *OSPFHandler) CreateOspfKeyChain(ospfKeyChain *ospfd.OspfKeyChain) (bool, error) {
+	if ospfKeyChain == nil {
+		err := errors.New("Invalid Key Chain Configuration")
+		return false, err
+	}
+	h.logger.Info(fmt.Sprintln("Create key chain config:", ospfKeyChain.Name))
+	err := h.SendOspfKeyChain(ospfKeyChain)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *OSPFHandler) CreateOspfv3Global(ospfv3GlobalConf *ospfd.Ospfv3Global) (bool, error) {
+	if ospfv3GlobalConf == nil {
+		err := errors.New("Invalid OSPFv3 Global Configuration")
+		return false, err
+	}
+	h.logger.Info(fmt.Sprintln("Create OSPFv3 global config attrs:", ospfv3GlobalConf))
+	err := h.SendOspfv3Global(ospfv3GlobalConf)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *OSPFHandler) CreateOspfv3IntfEntry(ospfv3IntfConf *ospfd.Ospfv3IntfEntry) (bool, error) {
+	if ospfv3IntfConf == nil {
+		err := errors.New("Invalid OSPFv3 Interface Configuration")
+		return false, err
+	}
+	h.logger.Info(fmt.Sprintln("Create OSPFv3 interface config attrs:", ospfv3IntfConf))
+	err := h.SendOspfv3IntfConf(ospfv3IntfConf)
+	if err != nil {
+		return false, err
+	}
 	return true, nil
 }
@@ -25,9 +25,10 @@ package rpc
 
 import (
 	"fmt"
+	"l3/ospf/config"
+	"l3/ospf/server"
 	"ospfd"
 	//    "l3/ospf/config"
-	//    "l3/ospf/server"
 	//    "utils/logging"
 	//    "net"
 )
@@ -55,5 +56,26 @@ func (h *OSPFHandler) DeleteOspfIfMetricEntry(ospfIfMetricConf *ospfd.OspfIfMetr
 
 func (h *OSPFHandler) DeleteOspfVirtIfEntry(ospfVirtIfConf *ospfd.OspfVirtIfEntry) (bool, error) {
 	h.logger.Info(fmt.Sprintln("Delete virtual interface config attrs:", ospfVirtIfConf))
+	h.server.VirtIfDeleteCh <- server.ConvertOspfVirtIfEntry(ospfVirtIfConf)
+	return true, nil
+}
+
+func (h *OSPFHandler) DeleteOspfKeyChain(ospfKeyChain *ospfd.OspfKeyChain) (bool, error) {
+	h.logger.Info(fmt.Sprintln("Delete key chain config:", ospfKeyChain.Name))
+	h.server.KeyChainDeleteCh <- ospfKeyChain.Name
+	return true, nil
+}
+
+func (h *OSPFHandler) DeleteOspfv3Global(ospfv3GlobalConf *ospfd.Ospfv3Global) (bool, error) {
+	h.logger.Info(fmt.Sprintln("Delete OSPFv3 global config attrs:", ospfv3GlobalConf))
+	gConf := server.ConvertOspfv3Global(ospfv3GlobalConf)
+	gConf.AdminStat = config.Disabled
+	h.server.Ospfv3GlobalConfigCh <- gConf
+	return true, nil
+}
+
+func (h *OSPFHandler) DeleteOspfv3IntfEntry(ospfv3IntfConf *ospfd.Ospfv3IntfEntry) (bool, error) {
+	h.logger.Info(fmt.Sprintln("Delete OSPFv3 interface config attrs:", ospfv3IntfConf))
+	h.server.Ospfv3IntfDeleteCh <- ospfv3IntfConf.IfIndex
 	return true, nil
 }
@@ -101,3 +101,7 @@ func (h *OSPFHandler) GetOspfIPv4RouteState(destId string, addrMask string, dest
 func (h *OSPFHandler) GetOspfEventState(Index int32) (*ospfd.OspfEventState, error) {
 	return nil, nil
 }
+
+func (h *OSPFHandler) GetOspfSpfLogState(Index int32) (*ospfd.OspfSpfLogState, error) {
+	return nil, nil
+}
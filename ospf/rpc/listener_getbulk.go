@@ -70,6 +70,7 @@ func (h *OSPFHandler) convertIfEntryStateToThrift(ent config.InterfaceState) *os
 	ifEntry.IfLsaCount = int32(ent.IfLsaCount)
 	ifEntry.IfDesignatedRouterId = string(ent.IfDesignatedRouterId)
 	ifEntry.IfBackupDesignatedRouterId = string(ent.IfBackupDesignatedRouter)
+	ifEntry.IfAuthFailures = ent.IfAuthFailures
 
 	return ifEntry
 }
@@ -81,6 +82,9 @@ func (h *OSPFHandler) convertGlobalStateToThrift(ent config.GlobalState) *ospfd.
 	gState.AreaBdrRtrStatus = ent.AreaBdrRtrStatus
 	gState.ExternLsaCount = ent.ExternLsaCount
 	gState.OpaqueLsaSupport = ent.OpaqueLsaSupport
+	gState.StubRouterSupport = ent.StubRouterSupport
+	gState.StubRouterMode = int32(ent.StubRouterMode)
+	gState.StubRouterAge = ent.StubRouterAge
 
 	return gState
 }
@@ -214,6 +218,32 @@ func (h *OSPFHandler) GetBulkOspfIPv4RouteState(fromIdx ospfd.Int, count ospfd.I
 	return  nil, nil
 }
 
+func (h *OSPFHandler) convertSpfLogStateToThrift(ent config.SpfLogState) *ospfd.OspfSpfLogState {
+	spfLog := ospfd.NewOspfSpfLogState()
+	spfLog.Index = ent.Index
+	spfLog.TimeStamp = ent.TimeStamp
+	spfLog.Duration = ent.Duration
+	spfLog.Trigger = ent.Trigger
+
+	return spfLog
+}
+
+func (h *OSPFHandler) GetBulkOspfSpfLogState(fromIdx ospfd.Int, count ospfd.Int) (*ospfd.OspfSpfLogStateGetInfo, error) {
+	h.logger.Info(fmt.Sprintln("Get SPF log"))
+	nextIdx, currCount, ospfSpfLogStates := h.server.GetBulkOspfSpfLogState(int(fromIdx), int(count))
+	ospfSpfLogStateResponse := make([]*ospfd.OspfSpfLogState, len(ospfSpfLogStates))
+	for idx, item := range ospfSpfLogStates {
+		ospfSpfLogStateResponse[idx] = h.convertSpfLogStateToThrift(item)
+	}
+	ospfSpfLogStateGetInfo := ospfd.NewOspfSpfLogStateGetInfo()
+	ospfSpfLogStateGetInfo.Count = ospfd.Int(currCount)
+	ospfSpfLogStateGetInfo.StartIdx = ospfd.Int(fromIdx)
+	ospfSpfLogStateGetInfo.EndIdx = ospfd.Int(nextIdx)
+	ospfSpfLogStateGetInfo.More = (nextIdx != 0)
+	ospfSpfLogStateGetInfo.OspfSpfLogStateList = ospfSpfLogStateResponse
+	return ospfSpfLogStateGetInfo, nil
+}
+
 func (h *OSPFHandler) GetBulkOspfEventState(fromIdx ospfd.Int, count ospfd.Int) (*ospfd.OspfEventStateGetInfo, error) {
        /* This is template API. Events are stored in redis-db */
 	return nil, nil
@@ -59,6 +59,38 @@ func (h *OSPFHandler) UpdateOspfIfMetricEntry(origConf *ospfd.OspfIfMetricEntry,
 func (h *OSPFHandler) UpdateOspfVirtIfEntry(origConf *ospfd.OspfVirtIfEntry, newConf *ospfd.OspfVirtIfEntry, attrset []bool, op []*ospfd.PatchOpInfo) (bool, error) {
 	h.logger.Info(fmt.Sprintln("Original virtual interface config attrs:", origConf))
 	h.logger.Info(fmt.Sprintln("New virtual interface config attrs:", newConf))
+	err := h.SendOspfVirtIfConf(newConf)
+	if err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
+func (h *OSPFHandler) UpdateOspfKeyChain(origConf *ospfd.OspfKeyChain, newConf *ospfd.OspfKeyChain, attrset []bool, op []*ospfd.PatchOpInfo) (bool, error) {
+	h.logger.Info(fmt.Sprintln("Update key chain config:", newConf.Name))
+	err := h.SendOspfKeyChain(newConf)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *OSPFHandler) UpdateOspfv3Global(origConf *ospfd.Ospfv3Global, newConf *ospfd.Ospfv3Global, attrset []bool, op []*ospfd.PatchOpInfo) (bool, error) {
+	h.logger.Info(fmt.Sprintln("Original OSPFv3 global config attrs:", origConf))
+	h.logger.Info(fmt.Sprintln("New OSPFv3 global config attrs:", newConf))
+	err := h.SendOspfv3Global(newConf)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *OSPFHandler) UpdateOspfv3IntfEntry(origConf *ospfd.Ospfv3IntfEntry, newConf *ospfd.Ospfv3IntfEntry, attrset []bool, op []*ospfd.PatchOpInfo) (bool, error) {
+	h.logger.Info(fmt.Sprintln("Original OSPFv3 interface config attrs:", origConf))
+	h.logger.Info(fmt.Sprintln("New OSPFv3 interface config attrs:", newConf))
+	err := h.SendOspfv3IntfConf(newConf)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
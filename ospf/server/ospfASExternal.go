@@ -46,141 +46,211 @@ func (server *OSPFServer) HandleASExternalLsa(areaId uint32) {
 	}
 
 	for lsaKey, lsaEnt := range lsDbEnt.ASExternalLsaMap {
-		server.logger.Info(fmt.Sprintln("AS External LSAKey:", lsaKey, "lsaENt:", lsaEnt))
-		if lsaEnt.Metric == LSInfinity ||
-			lsaEnt.LsaMd.LSAge == config.MaxAge {
-			server.logger.Info("Ignoring AS External LSA...")
-			continue
-		}
-		rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
-		if lsaKey.AdvRouter == rtrId {
-			server.logger.Info("Self originated AS External LSA, so no need to process for routing table calc")
-			continue
-		}
+		server.calcASExternalRoute(areaId, lsaKey, lsaEnt)
+	}
+}
 
-		areaIdKey := AreaIdKey{
-			AreaId: areaId,
-		}
+func (server *OSPFServer) calcASExternalRoute(areaId uint32, lsaKey LsaKey, lsaEnt ASExternalLsa) {
+	server.logger.Info(fmt.Sprintln("AS External LSAKey:", lsaKey, "lsaENt:", lsaEnt))
+	if lsaEnt.Metric == LSInfinity ||
+		lsaEnt.LsaMd.LSAge == config.MaxAge {
+		server.logger.Info("Ignoring AS External LSA...")
+		return
+	}
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	if lsaKey.AdvRouter == rtrId {
+		server.logger.Info("Self originated AS External LSA, so no need to process for routing table calc")
+		return
+	}
 
-		var rKey RoutingTblEntryKey
-		var rEnt RoutingTblEntry
-		var exist bool
-		tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
-		if lsaEnt.FwdAddr == 0 {
-			//Packet should be sent to ASBr
+	areaIdKey := AreaIdKey{
+		AreaId: areaId,
+	}
+
+	var rKey RoutingTblEntryKey
+	var rEnt RoutingTblEntry
+	var exist bool
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	if lsaEnt.FwdAddr == 0 {
+		//Packet should be sent to ASBr
+		rKey = RoutingTblEntryKey{
+			DestId:   lsaKey.AdvRouter,
+			AddrMask: 0,
+			DestType: ASBdrRouter,
+		}
+		rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
+		if !exist {
+			server.logger.Info("AS Border Router routing table entry doesnot exists for AS External Lsa Advertising Router")
 			rKey = RoutingTblEntryKey{
 				DestId:   lsaKey.AdvRouter,
 				AddrMask: 0,
-				DestType: ASBdrRouter,
+				DestType: ASAreaBdrRouter,
 			}
 			rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
 			if !exist {
-				server.logger.Info("AS Border Router routing table entry doesnot exists for AS External Lsa Advertising Router")
-				rKey = RoutingTblEntryKey{
-					DestId:   lsaKey.AdvRouter,
-					AddrMask: 0,
-					DestType: ASAreaBdrRouter,
-				}
-				rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
-				if !exist {
-					server.logger.Info("AS Area Border Router routing table entry doesnot exists for AS External Lsa Advertising Router")
-					continue
-				}
+				server.logger.Info("AS Area Border Router routing table entry doesnot exists for AS External Lsa Advertising Router")
+				return
 			}
-		} else {
-			// Packet should be sent to forwarding address
+		}
+	} else {
+		// Packet should be sent to forwarding address
+		rKey = RoutingTblEntryKey{
+			DestId:   lsaEnt.FwdAddr,
+			AddrMask: 0,
+			DestType: ASBdrRouter,
+		}
+		rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
+		if !exist {
+			server.logger.Info("AS Border Router routing table entry doesnot exists for AS External Lsa Advertising Router")
 			rKey = RoutingTblEntryKey{
 				DestId:   lsaEnt.FwdAddr,
 				AddrMask: 0,
-				DestType: ASBdrRouter,
+				DestType: ASAreaBdrRouter,
 			}
 			rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
 			if !exist {
-				server.logger.Info("AS Border Router routing table entry doesnot exists for AS External Lsa Advertising Router")
-				rKey = RoutingTblEntryKey{
-					DestId:   lsaEnt.FwdAddr,
-					AddrMask: 0,
-					DestType: ASAreaBdrRouter,
-				}
-				rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
-				if !exist {
-					server.logger.Info("AS Area Border Router routing table entry doesnot exists for AS External Lsa Advertising Router")
-					continue
-				}
+				server.logger.Info("AS Area Border Router routing table entry doesnot exists for AS External Lsa Advertising Router")
+				return
 			}
 		}
-		if rEnt.NumOfPaths == 0 {
-			continue
+	}
+	server.installExternalRoute(areaIdKey, lsaKey, lsaEnt, rEnt)
+}
+
+/*
+@fn HandleNssaLsa
+RFC 3101 2.5: type-7 routes are calculated like AS external
+routes within the NSSA. A non zero forwarding address must be
+reachable through an intra-area route.
+*/
+func (server *OSPFServer) HandleNssaLsa(areaId uint32) {
+	if !server.isNssaArea(config.AreaId(convertUint32ToIPv4(areaId))) {
+		return
+	}
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		server.logger.Err(fmt.Sprintln("Unable to find Area Lsdb entry"))
+		return
+	}
+
+	for lsaKey, lsaEnt := range lsDbEnt.NSSALsaMap {
+		server.calcNssaRoute(areaId, lsaKey, lsaEnt)
+	}
+}
+
+func (server *OSPFServer) calcNssaRoute(areaId uint32, lsaKey LsaKey, lsaEnt ASExternalLsa) {
+	server.logger.Info(fmt.Sprintln("NSSA LSAKey:", lsaKey, "lsaENt:", lsaEnt))
+	if lsaEnt.Metric == LSInfinity ||
+		lsaEnt.LsaMd.LSAge == config.MaxAge {
+		server.logger.Info("Ignoring NSSA LSA...")
+		return
+	}
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	if lsaKey.AdvRouter == rtrId {
+		server.logger.Info("Self originated NSSA LSA, so no need to process for routing table calc")
+		return
+	}
+
+	areaIdKey := AreaIdKey{
+		AreaId: areaId,
+	}
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	var rEnt RoutingTblEntry
+	var exist bool
+	if lsaEnt.FwdAddr == 0 {
+		rKey := RoutingTblEntryKey{
+			DestId:   lsaKey.AdvRouter,
+			AddrMask: 0,
+			DestType: ASBdrRouter,
+		}
+		rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
+		if !exist {
+			rKey.DestType = ASAreaBdrRouter
+			rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
 		}
+	} else {
+		rEnt, exist = getFwdAddrRoute(tempAreaRoutingTbl, lsaEnt.FwdAddr)
+	}
+	if !exist {
+		server.logger.Info("Routing table entry doesnot exists for NSSA Lsa Advertising Router or Forwarding Address")
+		return
+	}
+	server.installExternalRoute(areaIdKey, lsaKey, lsaEnt, rEnt)
+}
 
-		cost := rEnt.Cost + uint16(lsaEnt.Metric)
-		nextHopMap := rEnt.NextHops
-		numOfNextHops := rEnt.NumOfPaths
-		rKey = RoutingTblEntryKey{
-			DestId:   lsaKey.LSId & lsaEnt.Netmask,
-			AddrMask: lsaEnt.Netmask,
-			DestType: Network, // TODO: Need to be revisited
+func getFwdAddrRoute(areaRoutingTbl AreaRoutingTbl, fwdAddr uint32) (RoutingTblEntry, bool) {
+	var rEnt RoutingTblEntry
+	found := false
+	var mask uint32
+	for key, ent := range areaRoutingTbl.RoutingTblMap {
+		if key.DestType != Network ||
+			ent.PathType != IntraArea ||
+			fwdAddr&key.AddrMask != key.DestId {
+			continue
+		}
+		if !found || key.AddrMask > mask {
+			rEnt = ent
+			mask = key.AddrMask
+			found = true
 		}
+	}
+	return rEnt, found
+}
 
-		tempAreaRoutingTbl = server.TempAreaRoutingTbl[areaIdKey]
-		rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
-		if exist {
-			if rEnt.PathType == IntraArea ||
-				rEnt.PathType == InterArea {
-				//IntraArea or InterArea Paths are always preferred
-				continue
-			}
-			if rEnt.PathType == Type1Ext &&
-				lsaEnt.BitE == true {
-				//Type1Ext path is always preferred over Type2Ext
-				continue
-			}
-			var pathType PathType
-			if lsaEnt.BitE == true {
-				pathType = Type2Ext
-			} else {
-				pathType = Type1Ext
-			}
-			if rEnt.Cost < cost &&
-				rEnt.PathType == pathType {
-				//Routing table entry cost is less and path type is same
-				server.logger.Info("Route already exists with lesser cost")
-				continue
-			} else if (rEnt.Cost > cost &&
-				rEnt.PathType == pathType) ||
-				(rEnt.Cost < cost &&
-					rEnt.PathType == Type2Ext) {
-				rEnt.OptCapabilities = 0 //TODO
-				//rEnt.PathType = InterArea
-				rEnt.PathType = pathType
-				rEnt.Cost = cost
-				rEnt.Type2Cost = uint16(lsaEnt.Metric)
-				//rEnt.LSOrigin = lsaKey
-				rEnt.NumOfPaths = numOfNextHops
-				rEnt.NextHops = make(map[NextHop]bool)
-				for key, _ := range nextHopMap {
-					key.AdvRtr = lsaKey.AdvRouter
-					rEnt.NextHops[key] = true
-				}
-			} else {
-				cnt := 0
-				for key, _ := range nextHopMap {
-					_, exist = rEnt.NextHops[key]
-					if !exist {
-						key.AdvRtr = lsaKey.AdvRouter
-						rEnt.NextHops[key] = true
-						cnt++
-					}
-				}
-				rEnt.NumOfPaths = numOfNextHops + cnt
-			}
+/*
+@fn installExternalRoute
+Add the path to an external destination described by AS
+external or NSSA LSA, rEnt is the route to the ASBR or
+forwarding address.
+*/
+func (server *OSPFServer) installExternalRoute(areaIdKey AreaIdKey, lsaKey LsaKey, lsaEnt ASExternalLsa, rEnt RoutingTblEntry) {
+	if rEnt.NumOfPaths == 0 {
+		return
+	}
+
+	cost := rEnt.Cost + uint16(lsaEnt.Metric)
+	nextHopMap := rEnt.NextHops
+	numOfNextHops := rEnt.NumOfPaths
+	rKey := RoutingTblEntryKey{
+		DestId:   lsaKey.LSId & lsaEnt.Netmask,
+		AddrMask: lsaEnt.Netmask,
+		DestType: Network, // TODO: Need to be revisited
+	}
+
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	rEnt, exist := tempAreaRoutingTbl.RoutingTblMap[rKey]
+	if exist {
+		if rEnt.PathType == IntraArea ||
+			rEnt.PathType == InterArea {
+			//IntraArea or InterArea Paths are always preferred
+			return
+		}
+		if rEnt.PathType == Type1Ext &&
+			lsaEnt.BitE == true {
+			//Type1Ext path is always preferred over Type2Ext
+			return
+		}
+		var pathType PathType
+		if lsaEnt.BitE == true {
+			pathType = Type2Ext
 		} else {
+			pathType = Type1Ext
+		}
+		if rEnt.Cost < cost &&
+			rEnt.PathType == pathType {
+			//Routing table entry cost is less and path type is same
+			server.logger.Info("Route already exists with lesser cost")
+			return
+		} else if (rEnt.Cost > cost &&
+			rEnt.PathType == pathType) ||
+			(rEnt.Cost < cost &&
+				rEnt.PathType == Type2Ext) {
 			rEnt.OptCapabilities = 0 //TODO
-			if lsaEnt.BitE == true {
-				rEnt.PathType = Type2Ext
-			} else {
-				rEnt.PathType = Type1Ext
-			}
+			//rEnt.PathType = InterArea
+			rEnt.PathType = pathType
 			rEnt.Cost = cost
 			rEnt.Type2Cost = uint16(lsaEnt.Metric)
 			//rEnt.LSOrigin = lsaKey
@@ -190,10 +260,37 @@ func (server *OSPFServer) HandleASExternalLsa(areaId uint32) {
 				key.AdvRtr = lsaKey.AdvRouter
 				rEnt.NextHops[key] = true
 			}
+		} else {
+			cnt := 0
+			for key, _ := range nextHopMap {
+				_, exist = rEnt.NextHops[key]
+				if !exist {
+					key.AdvRtr = lsaKey.AdvRouter
+					rEnt.NextHops[key] = true
+					cnt++
+				}
+			}
+			rEnt.NumOfPaths = numOfNextHops + cnt
+		}
+	} else {
+		rEnt.OptCapabilities = 0 //TODO
+		if lsaEnt.BitE == true {
+			rEnt.PathType = Type2Ext
+		} else {
+			rEnt.PathType = Type1Ext
+		}
+		rEnt.Cost = cost
+		rEnt.Type2Cost = uint16(lsaEnt.Metric)
+		//rEnt.LSOrigin = lsaKey
+		rEnt.NumOfPaths = numOfNextHops
+		rEnt.NextHops = make(map[NextHop]bool)
+		for key, _ := range nextHopMap {
+			key.AdvRtr = lsaKey.AdvRouter
+			rEnt.NextHops[key] = true
 		}
-		tempAreaRoutingTbl.RoutingTblMap[rKey] = rEnt
-		server.TempAreaRoutingTbl[areaIdKey] = tempAreaRoutingTbl
 	}
+	tempAreaRoutingTbl.RoutingTblMap[rKey] = rEnt
+	server.TempAreaRoutingTbl[areaIdKey] = tempAreaRoutingTbl
 }
 
 func (server *OSPFServer) CalcASBorderRoutes(areaId uint32) {
@@ -207,96 +304,77 @@ func (server *OSPFServer) CalcASBorderRoutes(areaId uint32) {
 	}
 
 	for lsaKey, lsaEnt := range lsDbEnt.Summary4LsaMap {
-		server.logger.Info(fmt.Sprintln("Summary LSAKey:", lsaKey, "lsaENt:", lsaEnt))
-		if lsaEnt.Metric == LSInfinity ||
-			lsaEnt.LsaMd.LSAge == config.MaxAge {
-			server.logger.Info("Ignoring Summary 4 LSA...")
-			continue
-		}
-		rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
-		if lsaKey.AdvRouter == rtrId {
-			server.logger.Info("Self originated summary 4 LSA, so no need to process for routing table calc")
-			continue
-		}
+		server.calcASBorderRoute(areaId, lsaKey, lsaEnt)
+	}
+}
 
-		areaIdKey := AreaIdKey{
-			AreaId: areaId,
-		}
-		// TODO: Handle Area Range Section 16.2 Point 3
-		//Network := lsaKey.LSId & lsaEnt.Netmask
-		//Mask := lsaEnt.Netmask
-		rKey := RoutingTblEntryKey{
+func (server *OSPFServer) calcASBorderRoute(areaId uint32, lsaKey LsaKey, lsaEnt SummaryLsa) {
+	server.logger.Info(fmt.Sprintln("Summary LSAKey:", lsaKey, "lsaENt:", lsaEnt))
+	if lsaEnt.Metric == LSInfinity ||
+		lsaEnt.LsaMd.LSAge == config.MaxAge {
+		server.logger.Info("Ignoring Summary 4 LSA...")
+		return
+	}
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	if lsaKey.AdvRouter == rtrId {
+		server.logger.Info("Self originated summary 4 LSA, so no need to process for routing table calc")
+		return
+	}
+
+	areaIdKey := AreaIdKey{
+		AreaId: areaId,
+	}
+	// TODO: Handle Area Range Section 16.2 Point 3
+	//Network := lsaKey.LSId & lsaEnt.Netmask
+	//Mask := lsaEnt.Netmask
+	rKey := RoutingTblEntryKey{
+		DestId:   lsaKey.AdvRouter,
+		AddrMask: 0,
+		DestType: AreaBdrRouter,
+	}
+
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	rEnt, exist := tempAreaRoutingTbl.RoutingTblMap[rKey]
+	if !exist {
+		server.logger.Info("Area Border Router routing table entry doesnot exists for Summary Lsa Advertising Router")
+		rKey = RoutingTblEntryKey{
 			DestId:   lsaKey.AdvRouter,
 			AddrMask: 0,
-			DestType: AreaBdrRouter,
+			DestType: ASAreaBdrRouter,
 		}
-
-		tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
-		rEnt, exist := tempAreaRoutingTbl.RoutingTblMap[rKey]
+		rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
 		if !exist {
-			server.logger.Info("Area Border Router routing table entry doesnot exists for Summary Lsa Advertising Router")
-			rKey = RoutingTblEntryKey{
-				DestId:   lsaKey.AdvRouter,
-				AddrMask: 0,
-				DestType: ASAreaBdrRouter,
-			}
-			rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
-			if !exist {
-				server.logger.Info("AS Area Border Router routing table entry doesnot exists for Summary Lsa Advertising Router")
-				continue
+			server.logger.Info("AS Area Border Router routing table entry doesnot exists for Summary Lsa Advertising Router")
+			return
 
-			}
-		}
-		if rEnt.NumOfPaths == 0 {
-			continue
-		}
-		cost := rEnt.Cost + uint16(lsaEnt.Metric)
-		nextHopMap := rEnt.NextHops
-		numOfNextHops := rEnt.NumOfPaths
-		rKey = RoutingTblEntryKey{
-			DestId:   lsaKey.LSId,
-			AddrMask: 0,
-			DestType: ASBdrRouter, // TODO: Need to be revisited
 		}
+	}
+	if rEnt.NumOfPaths == 0 {
+		return
+	}
+	cost := rEnt.Cost + uint16(lsaEnt.Metric)
+	nextHopMap := rEnt.NextHops
+	numOfNextHops := rEnt.NumOfPaths
+	rKey = RoutingTblEntryKey{
+		DestId:   lsaKey.LSId,
+		AddrMask: 0,
+		DestType: ASBdrRouter, // TODO: Need to be revisited
+	}
 
-		tempAreaRoutingTbl = server.TempAreaRoutingTbl[areaIdKey]
-		rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
-		if exist {
-			if rEnt.PathType == IntraArea {
-				continue
-			}
-			if rEnt.Cost < cost {
-				server.logger.Info("Route already exists with lesser cost")
-				continue
-			} else if rEnt.Cost > cost {
-				rEnt.OptCapabilities = 0 //TODO
-				//rEnt.PathType = InterArea
-				rEnt.Cost = cost
-				//rEnt.Type2Cost = 0
-				//rEnt.LSOrigin = lsaKey
-				rEnt.NumOfPaths = numOfNextHops
-				rEnt.NextHops = make(map[NextHop]bool)
-				for key, _ := range nextHopMap {
-					key.AdvRtr = 0
-					rEnt.NextHops[key] = true
-				}
-			} else {
-				cnt := 0
-				for key, _ := range nextHopMap {
-					_, exist = rEnt.NextHops[key]
-					if !exist {
-						key.AdvRtr = 0
-						rEnt.NextHops[key] = true
-						cnt++
-					}
-				}
-				rEnt.NumOfPaths = numOfNextHops + cnt
-			}
-		} else {
+	tempAreaRoutingTbl = server.TempAreaRoutingTbl[areaIdKey]
+	rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
+	if exist {
+		if rEnt.PathType == IntraArea {
+			return
+		}
+		if rEnt.Cost < cost {
+			server.logger.Info("Route already exists with lesser cost")
+			return
+		} else if rEnt.Cost > cost {
 			rEnt.OptCapabilities = 0 //TODO
-			rEnt.PathType = InterArea
+			//rEnt.PathType = InterArea
 			rEnt.Cost = cost
-			rEnt.Type2Cost = 0
+			//rEnt.Type2Cost = 0
 			//rEnt.LSOrigin = lsaKey
 			rEnt.NumOfPaths = numOfNextHops
 			rEnt.NextHops = make(map[NextHop]bool)
@@ -304,10 +382,33 @@ func (server *OSPFServer) CalcASBorderRoutes(areaId uint32) {
 				key.AdvRtr = 0
 				rEnt.NextHops[key] = true
 			}
+		} else {
+			cnt := 0
+			for key, _ := range nextHopMap {
+				_, exist = rEnt.NextHops[key]
+				if !exist {
+					key.AdvRtr = 0
+					rEnt.NextHops[key] = true
+					cnt++
+				}
+			}
+			rEnt.NumOfPaths = numOfNextHops + cnt
+		}
+	} else {
+		rEnt.OptCapabilities = 0 //TODO
+		rEnt.PathType = InterArea
+		rEnt.Cost = cost
+		rEnt.Type2Cost = 0
+		//rEnt.LSOrigin = lsaKey
+		rEnt.NumOfPaths = numOfNextHops
+		rEnt.NextHops = make(map[NextHop]bool)
+		for key, _ := range nextHopMap {
+			key.AdvRtr = 0
+			rEnt.NextHops[key] = true
 		}
-		tempAreaRoutingTbl.RoutingTblMap[rKey] = rEnt
-		server.TempAreaRoutingTbl[areaIdKey] = tempAreaRoutingTbl
 	}
+	tempAreaRoutingTbl.RoutingTblMap[rKey] = rEnt
+	server.TempAreaRoutingTbl[areaIdKey] = tempAreaRoutingTbl
 }
 
 func (server *OSPFServer) GenerateType4SummaryLSA(rKey RoutingTblEntryKey, rEnt GlobalRoutingTblEntry, lsDbKey LsdbKey) (LsaKey, SummaryLsa) {
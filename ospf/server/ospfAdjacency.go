@@ -0,0 +1,234 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"errors"
+	"l3/ospf/config"
+)
+
+/*
+Interface and neighbor state machine decisions of RFC 2328 which
+do not depend on the protocol version. They are shared by OSPFv2
+and OSPFv3 (RFC 5340 4.1). A router attached to a network is
+identified by the value other routers list in the DR and BDR
+fields of their hellos: the interface address for OSPFv2 and the
+router id for OSPFv3.
+*/
+
+/* RFC 2328 B MaxAgeDiff */
+const MAX_AGE_DIFF = 900
+
+type drCandidate struct {
+	id       uint32
+	rtrId    uint32
+	priority uint8
+	dr       uint32
+	bdr      uint32
+}
+
+func (c drCandidate) declaresDR() bool {
+	return c.dr == c.id
+}
+
+func (c drCandidate) declaresBDR() bool {
+	return c.bdr == c.id
+}
+
+func isBetterDRCandidate(c1 drCandidate, c2 drCandidate) bool {
+	if c1.priority != c2.priority {
+		return c1.priority > c2.priority
+	}
+	return c1.rtrId > c2.rtrId
+}
+
+/* RFC 2328 9.4 step 2 */
+func electBDR(candidates []drCandidate) drCandidate {
+	var best, bestAny drCandidate
+	found := false
+	foundAny := false
+	for _, c := range candidates {
+		if c.declaresDR() {
+			continue
+		}
+		if c.declaresBDR() && (!found || isBetterDRCandidate(c, best)) {
+			best = c
+			found = true
+		}
+		if !foundAny || isBetterDRCandidate(c, bestAny) {
+			bestAny = c
+			foundAny = true
+		}
+	}
+	if found {
+		return best
+	}
+	return bestAny
+}
+
+/* RFC 2328 9.4 step 3 */
+func electDR(candidates []drCandidate, bdr drCandidate) drCandidate {
+	var best drCandidate
+	found := false
+	for _, c := range candidates {
+		if c.declaresDR() && (!found || isBetterDRCandidate(c, best)) {
+			best = c
+			found = true
+		}
+	}
+	if found {
+		return best
+	}
+	return bdr
+}
+
+/*
+@fn electDRAndBDR
+RFC 2328 9.4. The candidates are the neighbors in state 2-Way or
+higher with a non zero priority, the calculating router takes part
+when its own priority is not 0. Steps 2 and 3 are repeated when the
+calculating router became or stopped being DR or BDR. A router is
+never both, the BDR is left empty in that case.
+*/
+func electDRAndBDR(self drCandidate, nbrs []drCandidate) (drCandidate, drCandidate) {
+	elect := func() (drCandidate, drCandidate) {
+		candidates := nbrs
+		if self.priority > 0 {
+			candidates = append(append([]drCandidate{}, nbrs...), self)
+		}
+		bdr := electBDR(candidates)
+		return electDR(candidates, bdr), bdr
+	}
+	dr, bdr := elect()
+	if (dr.id == self.id) != self.declaresDR() ||
+		(bdr.id == self.id) != self.declaresBDR() {
+		self.dr = dr.id
+		self.bdr = bdr.id
+		if self.declaresDR() && self.declaresBDR() {
+			self.bdr = 0
+		}
+		dr, bdr = elect()
+	}
+	if dr.id == bdr.id {
+		bdr = drCandidate{}
+	}
+	return dr, bdr
+}
+
+/*
+RFC 2328 9.2 BackupSeen: a neighbor declares itself BDR, or
+declares itself DR and that there is no BDR.
+*/
+func isBackupSeen(nbr drCandidate) bool {
+	return nbr.declaresBDR() || (nbr.declaresDR() && nbr.bdr == 0)
+}
+
+/*
+RFC 2328 10.5: a change of the priority or of a neighbor declaring
+itself DR or BDR is a NeighborChange event for the interface.
+*/
+func isDRNeighborChange(old drCandidate, new drCandidate) bool {
+	return old.priority != new.priority ||
+		old.declaresDR() != new.declaresDR() ||
+		old.declaresBDR() != new.declaresBDR()
+}
+
+/*
+RFC 2328 10.4: adjacencies are formed on point-to-point networks,
+and on broadcast and NBMA networks when either end is DR or BDR.
+*/
+func shouldFormAdjacency(ifType config.IfType, isRtrDRBDR bool, isNbrDRBDR bool) bool {
+	if ifType != config.Broadcast && ifType != config.Nbma {
+		return true
+	}
+	return isRtrDRBDR || isNbrDRBDR
+}
+
+/* RFC 2328 10.5: hello and dead intervals must match */
+func checkHelloIntervals(helloInterval uint16, deadInterval uint32,
+	rxHelloInterval uint16, rxDeadInterval uint32) error {
+	if helloInterval != rxHelloInterval {
+		return errors.New("Hello Interval mismatch")
+	}
+	if deadInterval != rxDeadInterval {
+		return errors.New("Router Dead Interval mismatch")
+	}
+	return nil
+}
+
+/*
+@fn checkDDSequence
+RFC 2328 10.6 SeqNumberMismatch checks in state Exchange: the MS
+bit must match the master/slave relation, the I bit must be off
+and the sequence number must be the expected one.
+*/
+func checkDDSequence(nbrIsMaster bool, msBit bool, iBit bool, seqNum uint32, expectedSeqNum uint32) error {
+	if msBit != nbrIsMaster {
+		return errors.New("SeqNumberMismatch. Master/slave bit mismatch")
+	}
+	if iBit {
+		return errors.New("SeqNumberMismatch. Initialize bit set")
+	}
+	if seqNum != expectedSeqNum {
+		return errors.New("SeqNumberMismatch. Unexpected DD sequence number")
+	}
+	return nil
+}
+
+/*
+@fn compareLsaInstance
+RFC 2328 13.1. Returns 1 when the first instance is more recent,
+-1 when the second one is and 0 when they are the same instance.
+Sequence numbers are signed.
+*/
+func compareLsaInstance(seq1 uint32, checksum1 uint16, age1 uint16,
+	seq2 uint32, checksum2 uint16, age2 uint16) int {
+	if int32(seq1) != int32(seq2) {
+		if int32(seq1) > int32(seq2) {
+			return 1
+		}
+		return -1
+	}
+	if checksum1 != checksum2 {
+		if checksum1 > checksum2 {
+			return 1
+		}
+		return -1
+	}
+	maxAge := config.MaxAge
+	if age1 >= maxAge && age2 < maxAge {
+		return 1
+	}
+	if age2 >= maxAge && age1 < maxAge {
+		return -1
+	}
+	ageDiff := int(age1) - int(age2)
+	if ageDiff > MAX_AGE_DIFF {
+		return -1
+	}
+	if ageDiff < -MAX_AGE_DIFF {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,121 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"testing"
+)
+
+func TestElectDRAndBDR(t *testing.T) {
+	self := drCandidate{
+		id:       1,
+		rtrId:    1,
+		priority: 3,
+	}
+	nbrs := []drCandidate{
+		{id: 2, rtrId: 2, priority: 1},
+		{id: 3, rtrId: 3, priority: 2},
+	}
+	/* Nobody declares itself DR or BDR: the router becoming DR runs the election again */
+	dr, bdr := electDRAndBDR(self, nbrs)
+	if dr.id != 1 || bdr.id != 3 {
+		t.Error("Unexpected election on a new network", dr.id, bdr.id)
+	}
+
+	/* An existing DR is kept even with a lower priority */
+	nbrs[0].dr = 2
+	nbrs[1].dr = 2
+	dr, bdr = electDRAndBDR(self, nbrs)
+	if dr.id != 2 || bdr.id != 1 {
+		t.Error("Existing DR not kept", dr.id, bdr.id)
+	}
+
+	/* Ineligible router */
+	self.priority = 0
+	nbrs = []drCandidate{{id: 2, rtrId: 2, priority: 1}}
+	dr, bdr = electDRAndBDR(self, nbrs)
+	if dr.id != 2 || bdr.id != 0 {
+		t.Error("Unexpected election with a single eligible router", dr.id, bdr.id)
+	}
+
+	/* Router id breaks priority ties */
+	self.priority = 1
+	nbrs = []drCandidate{
+		{id: 2, rtrId: 2, priority: 1, dr: 2},
+		{id: 4, rtrId: 4, priority: 1, dr: 2},
+	}
+	dr, bdr = electDRAndBDR(self, nbrs)
+	if dr.id != 2 || bdr.id != 4 {
+		t.Error("Router id did not break the tie", dr.id, bdr.id)
+	}
+}
+
+func TestIsBackupSeen(t *testing.T) {
+	if !isBackupSeen(drCandidate{id: 2, bdr: 2}) {
+		t.Error("Neighbor declaring itself BDR")
+	}
+	if !isBackupSeen(drCandidate{id: 2, dr: 2}) {
+		t.Error("Neighbor declaring itself DR without BDR")
+	}
+	if isBackupSeen(drCandidate{id: 2, dr: 2, bdr: 3}) {
+		t.Error("Neighbor declaring itself DR with a BDR")
+	}
+}
+
+func TestCheckDDSequence(t *testing.T) {
+	if checkDDSequence(true, true, false, 5, 5) != nil {
+		t.Error("Expected DD packet rejected")
+	}
+	if checkDDSequence(true, false, false, 5, 5) == nil {
+		t.Error("Master/slave bit mismatch accepted")
+	}
+	if checkDDSequence(false, false, true, 5, 5) == nil {
+		t.Error("Initialize bit accepted")
+	}
+	if checkDDSequence(false, false, false, 6, 5) == nil {
+		t.Error("Unexpected sequence number accepted")
+	}
+}
+
+func TestCompareLsaInstance(t *testing.T) {
+	initSeq := uint32(InitialSequenceNumber)
+	if compareLsaInstance(initSeq+1, 0, 0, initSeq, 0, 0) != 1 {
+		t.Error("Higher sequence number not more recent")
+	}
+	if compareLsaInstance(0, 0, 0, initSeq, 0, 0) != 1 {
+		t.Error("Sequence numbers not compared as signed")
+	}
+	if compareLsaInstance(initSeq, 1, 0, initSeq, 2, 0) != -1 {
+		t.Error("Higher checksum not more recent")
+	}
+	if compareLsaInstance(initSeq, 1, 3600, initSeq, 1, 10) != 1 {
+		t.Error("MaxAge instance not more recent")
+	}
+	if compareLsaInstance(initSeq, 1, 10, initSeq, 1, 1000) != 1 {
+		t.Error("Younger instance not more recent")
+	}
+	if compareLsaInstance(initSeq, 1, 10, initSeq, 1, 100) != 0 {
+		t.Error("Same instance not detected")
+	}
+}
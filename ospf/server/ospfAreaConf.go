@@ -24,6 +24,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"l3/ospf/config"
 	"time"
@@ -36,6 +37,7 @@ type AreaConfKey struct {
 /* TODO - Add list of interfaces for this Area */
 type AreaConf struct {
 	AuthType               config.AuthType
+	AuthKeyChain           *KeyChain
 	ImportAsExtern         config.ImportAsExtern
 	AreaSummary            config.AreaSummary
 	StubDefaultCost        int32
@@ -52,6 +54,7 @@ type AreaState struct {
 	AreaLsaCksumSum          int32
 	AreaNssaTranslatorState  config.NssaTranslatorState
 	AreaNssaTranslatorEvents int32
+	nssaTranslatorExpiry     time.Time
 }
 
 func (server *OSPFServer) processAreaConfig(areaConf config.AreaConf) error {
@@ -59,8 +62,17 @@ func (server *OSPFServer) processAreaConfig(areaConf config.AreaConf) error {
 		AreaId: areaConf.AreaId,
 	}
 
+	if areaConf.AuthType == config.HmacSha && areaConf.AuthKeyChain == "" {
+		server.logger.Err(fmt.Sprintln("No key chain configured for HMAC-SHA authentication in area", areaConf.AreaId))
+		return errors.New("No key chain configured for HMAC-SHA authentication")
+	}
+
 	ent, _ := server.AreaConfMap[areaConfKey]
 	ent.AuthType = areaConf.AuthType
+	ent.AuthKeyChain = nil
+	if areaConf.AuthKeyChain != "" {
+		ent.AuthKeyChain = server.getKeyChain(areaConf.AuthKeyChain)
+	}
 	ent.ImportAsExtern = areaConf.ImportAsExtern
 	ent.AreaSummary = areaConf.AreaSummary
 	ent.StubDefaultCost = areaConf.StubDefaultCost
@@ -221,3 +233,19 @@ func (server *OSPFServer) isStubArea(areaid config.AreaId) bool {
 	}
 	return false
 }
+
+func (server *OSPFServer) isNssaArea(areaid config.AreaId) bool {
+
+	areaConfKey := AreaConfKey{
+		AreaId: areaid,
+	}
+
+	conf, exist := server.AreaConfMap[areaConfKey]
+	if !exist {
+		return false
+	}
+	if conf.ImportAsExtern == config.ImportNssa {
+		return true
+	}
+	return false
+}
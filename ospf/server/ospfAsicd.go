@@ -93,6 +93,15 @@ func (server *OSPFServer) processAsicdNotification(asicdrxBuf []byte) {
 			return
 		}
 		server.UpdateIPv4Infra(NewIpv4IntfMsg, msg.MsgType)
+	} else if msg.MsgType == asicdCommonDefs.NOTIFY_IPV6INTF_CREATE ||
+		msg.MsgType == asicdCommonDefs.NOTIFY_IPV6INTF_DELETE {
+		var NewIpv6IntfMsg asicdCommonDefs.IPv6IntfNotifyMsg
+		err = json.Unmarshal(msg.Msg, &NewIpv6IntfMsg)
+		if err != nil {
+			server.logger.Err(fmt.Sprintln("Unable to unmarshal msg:", msg.Msg))
+			return
+		}
+		server.UpdateIPv6Infra(NewIpv6IntfMsg, msg.MsgType)
 	} else if msg.MsgType == asicdCommonDefs.NOTIFY_VLAN_CREATE ||
 		msg.MsgType == asicdCommonDefs.NOTIFY_VLAN_DELETE {
 		var vlanNotifyMsg asicdCommonDefs.VlanNotifyMsg
@@ -132,6 +141,19 @@ func (server *OSPFServer) initAsicdForRxMulticastPkt() (err error) {
 		server.logger.Info(fmt.Sprintln("Adding reserved mac failed", ALLDROUTERMAC))
 		return err
 	}
+
+	// OSPFv3 AllSPFRouters and AllDRouters
+	for _, mac := range []string{ALLSPFROUTERV6MAC.String(), ALLDROUTERV6MAC.String()} {
+		v6MacConf := asicdInt.RsvdProtocolMacConfig{
+			MacAddr:     mac,
+			MacAddrMask: MASKMAC,
+		}
+		ret, err = server.asicdClient.ClientHdl.EnablePacketReception(&v6MacConf)
+		if !ret {
+			server.logger.Info(fmt.Sprintln("Adding reserved mac failed", mac))
+			return err
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,368 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"l3/ospf/config"
+	"sync"
+	"time"
+)
+
+const (
+	OSPF_AUTH_KEY_LEN      = 8
+	OSPF_MD5_KEY_LEN       = 16
+	OSPF_MD5_DIGEST_LEN    = 16
+	OSPF_CRYPTO_KEY_ID_OFF = 18
+	OSPF_CRYPTO_LEN_OFF    = 19
+	OSPF_CRYPTO_SEQ_OFF    = 20
+)
+
+type IntfAuthKey struct {
+	KeyId uint8
+	Key   []byte
+}
+
+/*
+Authentication state of an interface. It is shared by all the copies of
+IntfConf, so it is kept behind a pointer and protected by its own mutex as
+packets are received and sent from different go routines.
+*/
+type IntfAuthState struct {
+	authMutex       sync.Mutex
+	cryptoSeqNum    uint32
+	nbrCryptoSeqMap map[NeighborConfKey]uint32
+	authFailures    int32
+}
+
+func newIntfAuthState() *IntfAuthState {
+	return &IntfAuthState{
+		/* Start from the current time so that the sequence number keeps increasing across restarts */
+		cryptoSeqNum:    uint32(time.Now().Unix()),
+		nbrCryptoSeqMap: make(map[NeighborConfKey]uint32),
+	}
+}
+
+func (authState *IntfAuthState) getNextCryptoSeqNum() uint32 {
+	authState.authMutex.Lock()
+	defer authState.authMutex.Unlock()
+	authState.cryptoSeqNum++
+	return authState.cryptoSeqNum
+}
+
+func (authState *IntfAuthState) updateNbrCryptoSeqNum(nbrKey NeighborConfKey, seqNum uint32) bool {
+	authState.authMutex.Lock()
+	defer authState.authMutex.Unlock()
+	if lastSeqNum, exist := authState.nbrCryptoSeqMap[nbrKey]; exist && seqNum < lastSeqNum {
+		return false
+	}
+	authState.nbrCryptoSeqMap[nbrKey] = seqNum
+	return true
+}
+
+func (authState *IntfAuthState) clearNbrCryptoSeqNum(nbrKey NeighborConfKey) {
+	authState.authMutex.Lock()
+	delete(authState.nbrCryptoSeqMap, nbrKey)
+	authState.authMutex.Unlock()
+}
+
+func (authState *IntfAuthState) incrAuthFailures() {
+	authState.authMutex.Lock()
+	authState.authFailures++
+	authState.authMutex.Unlock()
+}
+
+func (authState *IntfAuthState) getAuthFailures() int32 {
+	authState.authMutex.Lock()
+	defer authState.authMutex.Unlock()
+	return authState.authFailures
+}
+
+/*
+The simple password can either be given as 8 dotted octets or as a plain
+string of up to 8 characters.
+*/
+func convertSimpleAuthKey(s string) []byte {
+	if authKey := convertAuthKey(s); authKey != nil {
+		return authKey
+	}
+	if len(s) > OSPF_AUTH_KEY_LEN {
+		return nil
+	}
+	authKey := make([]byte, OSPF_AUTH_KEY_LEN)
+	copy(authKey, s)
+	return authKey
+}
+
+func convertCryptoAuthKeys(md5Keys []config.AuthMd5Key) ([]IntfAuthKey, error) {
+	authKeys := make([]IntfAuthKey, 0, len(md5Keys))
+	keyIdMap := make(map[uint8]bool)
+	for _, md5Key := range md5Keys {
+		if len(md5Key.Key) == 0 || len(md5Key.Key) > OSPF_MD5_KEY_LEN {
+			return nil, errors.New(fmt.Sprintln("Invalid length of MD5 key", md5Key.KeyId))
+		}
+		if keyIdMap[md5Key.KeyId] {
+			return nil, errors.New(fmt.Sprintln("Duplicate MD5 key id", md5Key.KeyId))
+		}
+		keyIdMap[md5Key.KeyId] = true
+		key := make([]byte, OSPF_MD5_KEY_LEN)
+		copy(key, md5Key.Key)
+		authKeys = append(authKeys, IntfAuthKey{
+			KeyId: md5Key.KeyId,
+			Key:   key,
+		})
+	}
+	return authKeys, nil
+}
+
+func validateIntfAuthConf(ifConf config.InterfaceConf) error {
+	switch ifConf.IfAuthType {
+	case config.NoAuth:
+	case config.SimplePassword:
+		if convertSimpleAuthKey(ifConf.IfAuthKey) == nil {
+			return errors.New("Invalid simple password authentication key")
+		}
+	case config.Md5:
+		if len(ifConf.IfAuthMd5Keys) == 0 {
+			return errors.New("No MD5 key configured for cryptographic authentication")
+		}
+	case config.HmacSha:
+		if ifConf.IfAuthKeyChain == "" {
+			return errors.New("No key chain configured for HMAC-SHA authentication")
+		}
+	default:
+		return errors.New(fmt.Sprintln("Invalid authentication type", ifConf.IfAuthType))
+	}
+	_, err := convertCryptoAuthKeys(ifConf.IfAuthMd5Keys)
+	return err
+}
+
+/*
+An interface without authentication uses the HMAC-SHA key chain of its area
+when one is configured.
+*/
+func (server *OSPFServer) getIntfAuthConf(ent IntfConf) IntfConf {
+	if config.AuthType(ent.IfAuthType) != config.NoAuth {
+		return ent
+	}
+	areaConfKey := AreaConfKey{
+		AreaId: config.AreaId(convertIPInByteToString(ent.IfAreaId)),
+	}
+	areaConf, exist := server.AreaConfMap[areaConfKey]
+	if exist && areaConf.AuthType == config.HmacSha && areaConf.AuthKeyChain != nil {
+		ent.IfAuthType = uint16(config.HmacSha)
+		ent.IfAuthKeyChain = areaConf.AuthKeyChain
+	}
+	return ent
+}
+
+/* HMAC-SHA is sent as cryptographic authentication (RFC 5709 3.1) */
+func getOspfAuthType(authType uint16) uint16 {
+	if config.AuthType(authType) == config.HmacSha {
+		return uint16(config.Md5)
+	}
+	return authType
+}
+
+/*
+RFC 2328 D.3: With multiple keys configured, the most recently configured
+key is used to generate packets while all the keys are accepted, so keys
+can be rolled over without bringing down the adjacencies.
+*/
+func getCryptoSendKey(ent IntfConf) *IntfAuthKey {
+	if len(ent.IfAuthCryptoKeys) == 0 {
+		return nil
+	}
+	return &ent.IfAuthCryptoKeys[len(ent.IfAuthCryptoKeys)-1]
+}
+
+func getCryptoAuthKey(ent IntfConf, keyId uint8) *IntfAuthKey {
+	for idx, _ := range ent.IfAuthCryptoKeys {
+		if ent.IfAuthCryptoKeys[idx].KeyId == keyId {
+			return &ent.IfAuthCryptoKeys[idx]
+		}
+	}
+	return nil
+}
+
+func computeMd5Digest(ospfPkt []byte, key []byte) []byte {
+	hash := md5.New()
+	hash.Write(ospfPkt)
+	hash.Write(key)
+	return hash.Sum(nil)
+}
+
+/*
+Fills the checksum and the authentication fields of an encoded ospf packet
+whose header length is already set. For cryptographic authentication the
+message digest is appended to the packet and is not part of the packet
+length (RFC 2328 D.4.3).
+*/
+func (server *OSPFServer) encodeOspfAuth(ent IntfConf, ospf []byte) []byte {
+	ent = server.getIntfAuthConf(ent)
+	binary.BigEndian.PutUint16(ospf[14:16], getOspfAuthType(ent.IfAuthType))
+	copy(ospf[16:OSPF_HEADER_SIZE], []byte{0, 0, 0, 0, 0, 0, 0, 0})
+	switch config.AuthType(ent.IfAuthType) {
+	case config.SimplePassword:
+		csum := computeCheckSum(ospf)
+		binary.BigEndian.PutUint16(ospf[12:14], csum)
+		copy(ospf[16:OSPF_HEADER_SIZE], ent.IfAuthKey)
+	case config.Md5:
+		key := getCryptoSendKey(ent)
+		if key == nil || ent.IfAuthState == nil {
+			server.logger.Err(fmt.Sprintln("AUTH: No MD5 key to authenticate packet on", ent.IfName))
+			return ospf
+		}
+		binary.BigEndian.PutUint16(ospf[12:14], 0)
+		ospf[OSPF_CRYPTO_KEY_ID_OFF] = key.KeyId
+		ospf[OSPF_CRYPTO_LEN_OFF] = OSPF_MD5_DIGEST_LEN
+		binary.BigEndian.PutUint32(ospf[OSPF_CRYPTO_SEQ_OFF:OSPF_HEADER_SIZE], ent.IfAuthState.getNextCryptoSeqNum())
+		ospf = append(ospf, computeMd5Digest(ospf, key.Key)...)
+	case config.HmacSha:
+		if ent.IfAuthKeyChain == nil || ent.IfAuthState == nil {
+			server.logger.Err(fmt.Sprintln("AUTH: No key chain to authenticate packet on", ent.IfName))
+			return ospf
+		}
+		key, found := ent.IfAuthKeyChain.getSendKey(time.Now())
+		if !found {
+			server.logger.Err(fmt.Sprintln("AUTH: No valid send key in key chain", ent.IfAuthKeyChain.Name,
+				"to authenticate packet on", ent.IfName))
+			return ospf
+		}
+		binary.BigEndian.PutUint16(ospf[12:14], 0)
+		ospf[OSPF_CRYPTO_KEY_ID_OFF] = key.KeyId
+		digestLen := getHmacShaDigestLen(key.Algorithm)
+		ospf[OSPF_CRYPTO_LEN_OFF] = uint8(digestLen)
+		binary.BigEndian.PutUint32(ospf[OSPF_CRYPTO_SEQ_OFF:OSPF_HEADER_SIZE], ent.IfAuthState.getNextCryptoSeqNum())
+		ospfLen := len(ospf)
+		ospf = append(ospf, GetHmacShaApad(digestLen)...)
+		copy(ospf[ospfLen:], ComputeHmacShaDigest(key.Algorithm, []byte(key.Key), ospf))
+	default:
+		csum := computeCheckSum(ospf)
+		binary.BigEndian.PutUint16(ospf[12:14], csum)
+	}
+	return ospf
+}
+
+/*
+RFC 2328 D.5: Verifies the authentication and the checksum of a received
+ospf packet. ospfPkt is truncated to the ospf packet length by the caller
+and the message digest, if any, is passed separately. The interface passed
+must already have the area authentication applied.
+*/
+func authenticateOspfPkt(ent IntfConf, ospfHdr *OSPFHeader, ospfPkt []byte, digest []byte, md *OspfHdrMetadata) error {
+	if getOspfAuthType(ent.IfAuthType) != ospfHdr.authType {
+		return errors.New(fmt.Sprintln("Authentication type", ospfHdr.authType, "not matching",
+			getOspfAuthType(ent.IfAuthType)))
+	}
+
+	switch config.AuthType(ent.IfAuthType) {
+	case config.SimplePassword:
+		if !bytes.Equal(ospfHdr.authKey, ent.IfAuthKey) {
+			return errors.New("Simple password not matching")
+		}
+	case config.Md5:
+		keyId := ospfPkt[OSPF_CRYPTO_KEY_ID_OFF]
+		key := getCryptoAuthKey(ent, keyId)
+		if key == nil {
+			return errors.New(fmt.Sprintln("No MD5 key with key id", keyId))
+		}
+		if ospfPkt[OSPF_CRYPTO_LEN_OFF] != OSPF_MD5_DIGEST_LEN || len(digest) < OSPF_MD5_DIGEST_LEN {
+			return errors.New("Invalid MD5 message digest length")
+		}
+		if subtle.ConstantTimeCompare(computeMd5Digest(ospfPkt, key.Key), digest[:OSPF_MD5_DIGEST_LEN]) != 1 {
+			return errors.New(fmt.Sprintln("MD5 message digest not matching for key id", keyId))
+		}
+		md.cryptoAuth = true
+		md.cryptoSeqNum = binary.BigEndian.Uint32(ospfPkt[OSPF_CRYPTO_SEQ_OFF:OSPF_HEADER_SIZE])
+		return nil
+	case config.HmacSha:
+		keyId := ospfPkt[OSPF_CRYPTO_KEY_ID_OFF]
+		if ent.IfAuthKeyChain == nil {
+			return errors.New("No key chain configured")
+		}
+		key, found := ent.IfAuthKeyChain.getAcceptKey(keyId, time.Now())
+		if !found {
+			return errors.New(fmt.Sprintln("No valid key with key id", keyId, "in key chain",
+				ent.IfAuthKeyChain.Name))
+		}
+		digestLen := getHmacShaDigestLen(key.Algorithm)
+		if int(ospfPkt[OSPF_CRYPTO_LEN_OFF]) != digestLen || len(digest) < digestLen {
+			return errors.New(fmt.Sprintln("Invalid", key.Algorithm, "message digest length"))
+		}
+		data := append(append([]byte{}, ospfPkt...), GetHmacShaApad(digestLen)...)
+		if subtle.ConstantTimeCompare(ComputeHmacShaDigest(key.Algorithm, []byte(key.Key), data),
+			digest[:digestLen]) != 1 {
+			return errors.New(fmt.Sprintln(key.Algorithm, "message digest not matching for key id", keyId))
+		}
+		md.cryptoAuth = true
+		md.cryptoSeqNum = binary.BigEndian.Uint32(ospfPkt[OSPF_CRYPTO_SEQ_OFF:OSPF_HEADER_SIZE])
+		return nil
+	}
+
+	binary.BigEndian.PutUint16(ospfPkt[12:14], 0)
+	copy(ospfPkt[16:OSPF_HEADER_SIZE], []byte{0, 0, 0, 0, 0, 0, 0, 0})
+	csum := computeCheckSum(ospfPkt)
+	if csum != ospfHdr.chksum {
+		return errors.New("Invalid checksum")
+	}
+	return nil
+}
+
+/*
+RFC 2328 D.5.2: The cryptographic sequence number of a neighbor must never
+decrease, otherwise the packet is a replay and is dropped.
+*/
+func (server *OSPFServer) checkCryptoSeqNum(key IntfConfKey, nbrKey NeighborConfKey, md *OspfHdrMetadata) error {
+	if !md.cryptoAuth {
+		return nil
+	}
+	ent, exist := server.IntfConfMap[key]
+	if !exist || ent.IfAuthState == nil {
+		return errors.New("Dropped because of interface no more valid")
+	}
+	if !ent.IfAuthState.updateNbrCryptoSeqNum(nbrKey, md.cryptoSeqNum) {
+		ent.IfAuthState.incrAuthFailures()
+		return errors.New(fmt.Sprintln("Dropped because of decreasing cryptographic sequence number",
+			md.cryptoSeqNum, "from", nbrKey.IPAddr))
+	}
+	return nil
+}
+
+func (server *OSPFServer) clearNbrCryptoSeqNum(nbrKey NeighborConfKey) {
+	nbrConf, exist := server.NeighborConfigMap[nbrKey]
+	if !exist {
+		return
+	}
+	ent, exist := server.IntfConfMap[nbrConf.intfConfKey]
+	if !exist || ent.IfAuthState == nil {
+		return
+	}
+	ent.IfAuthState.clearNbrCryptoSeqNum(nbrKey)
+}
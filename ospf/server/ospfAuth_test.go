@@ -0,0 +1,242 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"encoding/binary"
+	"l3/ospf/config"
+	"testing"
+	"time"
+)
+
+func buildAuthTestPkt(ent IntfConf) []byte {
+	ospfHdr := OSPFHeader{
+		ver:      OSPF_VERSION_2,
+		pktType:  uint8(HelloType),
+		pktlen:   uint16(OSPF_HEADER_SIZE + len(hello)),
+		routerId: []byte{10, 1, 1, 1},
+		areaId:   []byte{0, 0, 0, 1},
+		authType: ent.IfAuthType,
+	}
+	ospfPkt := append(encodeOspfHdr(ospfHdr), hello...)
+	return ospf.encodeOspfAuth(ent, ospfPkt)
+}
+
+func verifyAuthTestPkt(ent IntfConf, ospfPkt []byte, md *OspfHdrMetadata) error {
+	rxPkt := make([]byte, len(ospfPkt))
+	copy(rxPkt, ospfPkt)
+	ospfHdr := NewOSPFHeader()
+	decodeOspfHdr(rxPkt, ospfHdr)
+	return authenticateOspfPkt(ent, ospfHdr, rxPkt[:ospfHdr.pktlen], rxPkt[ospfHdr.pktlen:], md)
+}
+
+func TestOspfSimplePasswordAuth(t *testing.T) {
+	ospf = getServerObject()
+	initAttr()
+	ent := intf
+	ent.IfAuthType = uint16(config.SimplePassword)
+	ent.IfAuthKey = convertSimpleAuthKey("secret")
+	ospfPkt := buildAuthTestPkt(ent)
+	if err := verifyAuthTestPkt(ent, ospfPkt, NewOspfHdrMetadata()); err != nil {
+		t.Error("Failed to authenticate simple password packet", err)
+	}
+
+	wrongEnt := ent
+	wrongEnt.IfAuthKey = convertSimpleAuthKey("wrong")
+	if err := verifyAuthTestPkt(wrongEnt, ospfPkt, NewOspfHdrMetadata()); err == nil {
+		t.Error("Packet with wrong simple password was accepted")
+	}
+
+	if convertSimpleAuthKey("toolongpassword") != nil {
+		t.Error("Simple password longer than 8 octets was accepted")
+	}
+}
+
+func TestOspfMd5Auth(t *testing.T) {
+	ospf = getServerObject()
+	initAttr()
+	cryptoKeys, err := convertCryptoAuthKeys([]config.AuthMd5Key{
+		{KeyId: 1, Key: "oldkey"},
+		{KeyId: 2, Key: "newkey"},
+	})
+	if err != nil {
+		t.Fatal("Failed to convert MD5 keys", err)
+	}
+	ent := intf
+	ent.IfAuthType = uint16(config.Md5)
+	ent.IfAuthCryptoKeys = cryptoKeys
+	ent.IfAuthState = newIntfAuthState()
+
+	ospfPkt := buildAuthTestPkt(ent)
+	pktlen := binary.BigEndian.Uint16(ospfPkt[2:4])
+	if len(ospfPkt) != int(pktlen)+OSPF_MD5_DIGEST_LEN {
+		t.Error("MD5 digest is not appended to the packet, length", len(ospfPkt))
+	}
+	if ospfPkt[OSPF_CRYPTO_KEY_ID_OFF] != 2 {
+		t.Error("Packet is not sent with the most recent key, key id", ospfPkt[OSPF_CRYPTO_KEY_ID_OFF])
+	}
+
+	md := NewOspfHdrMetadata()
+	if err := verifyAuthTestPkt(ent, ospfPkt, md); err != nil {
+		t.Error("Failed to authenticate MD5 packet", err)
+	}
+	if !md.cryptoAuth || md.cryptoSeqNum != ent.IfAuthState.cryptoSeqNum {
+		t.Error("Cryptographic sequence number not decoded", md.cryptoSeqNum)
+	}
+
+	/* Packets sent with the old key are still accepted during rollover */
+	oldEnt := ent
+	oldEnt.IfAuthCryptoKeys = cryptoKeys[:1]
+	if err := verifyAuthTestPkt(ent, buildAuthTestPkt(oldEnt), NewOspfHdrMetadata()); err != nil {
+		t.Error("Failed to authenticate MD5 packet with the old key", err)
+	}
+
+	tamperedPkt := make([]byte, len(ospfPkt))
+	copy(tamperedPkt, ospfPkt)
+	tamperedPkt[OSPF_HEADER_SIZE] ^= 0xff
+	if err := verifyAuthTestPkt(ent, tamperedPkt, NewOspfHdrMetadata()); err == nil {
+		t.Error("Tampered MD5 packet was accepted")
+	}
+
+	unknownEnt := ent
+	unknownEnt.IfAuthCryptoKeys = cryptoKeys[:1]
+	if err := verifyAuthTestPkt(unknownEnt, ospfPkt, NewOspfHdrMetadata()); err == nil {
+		t.Error("MD5 packet with unknown key id was accepted")
+	}
+
+	if _, err := convertCryptoAuthKeys([]config.AuthMd5Key{{KeyId: 1, Key: "a"}, {KeyId: 1, Key: "b"}}); err == nil {
+		t.Error("Duplicate MD5 key ids were accepted")
+	}
+}
+
+func TestOspfCryptoSeqNum(t *testing.T) {
+	authState := newIntfAuthState()
+	if !authState.updateNbrCryptoSeqNum(nbrKey, 100) {
+		t.Error("First cryptographic sequence number was not accepted")
+	}
+	if !authState.updateNbrCryptoSeqNum(nbrKey, 100) {
+		t.Error("Same cryptographic sequence number was not accepted")
+	}
+	if authState.updateNbrCryptoSeqNum(nbrKey, 99) {
+		t.Error("Decreasing cryptographic sequence number was accepted")
+	}
+	authState.clearNbrCryptoSeqNum(nbrKey)
+	if !authState.updateNbrCryptoSeqNum(nbrKey, 1) {
+		t.Error("Cryptographic sequence number not reset with the neighbor")
+	}
+}
+
+func TestOspfHmacShaAuth(t *testing.T) {
+	ospf = getServerObject()
+	initAttr()
+	now := time.Now()
+	keyChain := newKeyChain("ospf-keys")
+	keyChain.setKeys([]config.KeyChainKey{
+		{
+			KeyId:             1,
+			Algorithm:         config.HmacSha256,
+			Key:               "expiring-key",
+			SendLifetimeStart: now.Add(-time.Hour),
+			SendLifetimeEnd:   now.Add(time.Hour),
+		},
+		{
+			KeyId:             2,
+			Algorithm:         config.HmacSha512,
+			Key:               "new-key",
+			SendLifetimeStart: now.Add(-time.Minute),
+		},
+		{
+			KeyId:             3,
+			Algorithm:         config.HmacSha1,
+			Key:               "future-key",
+			SendLifetimeStart: now.Add(time.Hour),
+		},
+	})
+
+	ent := intf
+	ent.IfAuthType = uint16(config.HmacSha)
+	ent.IfAuthKeyChain = keyChain
+	ent.IfAuthState = newIntfAuthState()
+
+	ospfPkt := buildAuthTestPkt(ent)
+	if binary.BigEndian.Uint16(ospfPkt[14:16]) != uint16(config.Md5) {
+		t.Error("HMAC-SHA packet is not sent with cryptographic authentication type")
+	}
+	if ospfPkt[OSPF_CRYPTO_KEY_ID_OFF] != 2 || ospfPkt[OSPF_CRYPTO_LEN_OFF] != 64 {
+		t.Error("Packet is not sent with the most recent send key", ospfPkt[OSPF_CRYPTO_KEY_ID_OFF])
+	}
+	pktlen := binary.BigEndian.Uint16(ospfPkt[2:4])
+	if len(ospfPkt) != int(pktlen)+64 {
+		t.Error("HMAC-SHA-512 digest is not appended to the packet, length", len(ospfPkt))
+	}
+	if err := verifyAuthTestPkt(ent, ospfPkt, NewOspfHdrMetadata()); err != nil {
+		t.Error("Failed to authenticate HMAC-SHA packet", err)
+	}
+
+	tamperedPkt := make([]byte, len(ospfPkt))
+	copy(tamperedPkt, ospfPkt)
+	tamperedPkt[len(tamperedPkt)-1] ^= 0xff
+	if err := verifyAuthTestPkt(ent, tamperedPkt, NewOspfHdrMetadata()); err == nil {
+		t.Error("Tampered HMAC-SHA packet was accepted")
+	}
+
+	/* Keys outside of their accept lifetime are not accepted */
+	keyChain.setKeys([]config.KeyChainKey{
+		{
+			KeyId:             2,
+			Algorithm:         config.HmacSha512,
+			Key:               "new-key",
+			AcceptLifetimeEnd: now.Add(-time.Second),
+		},
+	})
+	if err := verifyAuthTestPkt(ent, ospfPkt, NewOspfHdrMetadata()); err == nil {
+		t.Error("HMAC-SHA packet with expired key was accepted")
+	}
+
+	if err := validateKeyChainKey(config.KeyChainKey{KeyId: 1, Algorithm: "md4", Key: "key"}); err == nil {
+		t.Error("Key with invalid algorithm was accepted")
+	}
+}
+
+func TestOspfAreaKeyChain(t *testing.T) {
+	ospf = getServerObject()
+	initAttr()
+	keyChain := newKeyChain("area-keys")
+	keyChain.setKeys([]config.KeyChainKey{{KeyId: 5, Algorithm: config.HmacSha384, Key: "area-key"}})
+	ospf.AreaConfMap[AreaConfKey{AreaId: "0.0.0.1"}] = AreaConf{
+		AuthType:     config.HmacSha,
+		AuthKeyChain: keyChain,
+	}
+
+	ent := intf
+	ent.IfAuthState = newIntfAuthState()
+	authEnt := ospf.getIntfAuthConf(ent)
+	if config.AuthType(authEnt.IfAuthType) != config.HmacSha || authEnt.IfAuthKeyChain != keyChain {
+		t.Error("Interface did not inherit the area key chain")
+	}
+	ospfPkt := buildAuthTestPkt(ent)
+	if err := verifyAuthTestPkt(authEnt, ospfPkt, NewOspfHdrMetadata()); err != nil {
+		t.Error("Failed to authenticate packet with area key chain", err)
+	}
+}
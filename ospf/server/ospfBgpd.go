@@ -0,0 +1,76 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	nanomsg "github.com/op/go-nanomsg"
+	"l3/bgp/bgpdCommonDefs"
+)
+
+func (server *OSPFServer) createBGPdSubscriber() {
+	for {
+		bgpdrxBuf, err := server.bgpdSubSocket.Recv(0)
+		if err != nil {
+			server.logger.Err(fmt.Sprintln("Recv on BGPd subscriber socket failed with error:", err))
+			server.bgpdSubSocketErrCh <- err
+			continue
+		}
+		server.bgpdSubSocketCh <- bgpdrxBuf
+	}
+}
+
+func (server *OSPFServer) listenForBGPdUpdates(address string) error {
+	var err error
+	if server.bgpdSubSocket, err = nanomsg.NewSubSocket(); err != nil {
+		server.logger.Err(fmt.Sprintln("Failed to create BGPd subscribe socket, error:", err))
+		return err
+	}
+
+	if err = server.bgpdSubSocket.Subscribe(""); err != nil {
+		server.logger.Err(fmt.Sprintln("Failed to subscribe to \"\" on BGPd subscribe socket, error:", err))
+		return err
+	}
+
+	if _, err = server.bgpdSubSocket.Connect(address); err != nil {
+		server.logger.Err(fmt.Sprintln("Failed to connect to BGPd publisher socket, address:", address, "error:", err))
+		return err
+	}
+
+	server.logger.Info(fmt.Sprintln("Connected to BGPd publisher at address:", address))
+	return nil
+}
+
+func (server *OSPFServer) processBgpdNotification(bgpdrxBuf []byte) {
+	var msg bgpdCommonDefs.BgpdNotifyMsg
+	err := json.Unmarshal(bgpdrxBuf, &msg)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("Unable to unmarshal bgpdrxBuf:", bgpdrxBuf))
+		return
+	}
+	if msg.MsgType == bgpdCommonDefs.NOTIFY_BGP_CONVERGED {
+		server.BgpConverged()
+	}
+}
@@ -144,6 +144,13 @@ func (server *OSPFServer) GetBulkOspfLsdbEntryState(idx int, cnt int) (int, int,
 			}
 			lsaEnc = encodeASExternalLsa(lsa, lsaKey)
 			lsaMd = lsa.LsaMd
+		} else if lsdbSliceEnt.LSType == NSSALSA {
+			lsa, exist := lsDbEnt.NSSALsaMap[lsaKey]
+			if !exist {
+				continue
+			}
+			lsaEnc = encodeASExternalLsa(lsa, lsaKey)
+			lsaMd = lsa.LsaMd
 		}
 
 		server.logger.Info(fmt.Sprintln(lsaEnc))
@@ -205,6 +212,9 @@ func (server *OSPFServer) GetBulkOspfIfEntryState(idx int, cnt int) (int, int, [
 			result[i].IfLsaCksumSum = ent.IfLsaCksumSum
 			result[i].IfDesignatedRouterId = config.RouterId(convertUint32ToIPv4(ent.IfDRtrId))
 			result[i].IfBackupDesignatedRouterId = config.RouterId(convertUint32ToIPv4(ent.IfBDRtrId))
+			if ent.IfAuthState != nil {
+				result[i].IfAuthFailures = ent.IfAuthState.getAuthFailures()
+			}
 		} else {
 			result[i].IfState = 0
 			result[i].IfDesignatedRouter = "0.0.0.0"
@@ -214,6 +224,7 @@ func (server *OSPFServer) GetBulkOspfIfEntryState(idx int, cnt int) (int, int, [
 			result[i].IfLsaCksumSum = 0
 			result[i].IfDesignatedRouterId = "0.0.0.0"
 			result[i].IfBackupDesignatedRouterId = "0.0.0.0"
+			result[i].IfAuthFailures = 0
 		}
 	}
 
@@ -241,6 +252,8 @@ func (server *OSPFServer) GetOspfGlobalState() *config.GlobalState {
 	result.AsLsaCount = ent.AsLsaCount
 	result.AsLsaCksumSum = ent.AsLsaCksumSum
 	result.StubRouterSupport = ent.StubRouterSupport
+	result.StubRouterMode = ent.StubRouterMode
+	result.StubRouterAge = ent.StubRouterAge
 	result.DiscontinuityTime = ent.DiscontinuityTime
 	server.logger.Info(fmt.Sprintln("Global State:", result))
 	return result
@@ -283,9 +296,10 @@ func (server *OSPFServer) GetBulkOspfNbrEntryState(idx int, cnt int) (int, int,
 			result[i].NbrLsRetransQLen = 0
 			result[i].NbmaNbrPermanence = 0
 			result[i].NbrHelloSuppressed = false
-			result[i].NbrRestartHelperStatus = 0
-			result[i].NbrRestartHelperAge = 0
-			result[i].NbrRestartHelperExitReason = 0
+			helperStatus, helperAge, helperExitReason := server.getGraceHelperState(key)
+			result[i].NbrRestartHelperStatus = int(helperStatus)
+			result[i].NbrRestartHelperAge = helperAge
+			result[i].NbrRestartHelperExitReason = int(helperExitReason)
 		}
 
 	}
@@ -43,11 +43,13 @@ const (
 var LSInfinity uint32 = 0x00ffffff
 
 type OspfHdrMetadata struct {
-	pktType  OspfType
-	pktlen   uint16
-	backbone bool
-	routerId []byte
-	areaId   uint32
+	pktType      OspfType
+	pktlen       uint16
+	backbone     bool
+	routerId     []byte
+	areaId       uint32
+	cryptoAuth   bool
+	cryptoSeqNum uint32
 }
 
 func NewOspfHdrMetadata() *OspfHdrMetadata {
@@ -131,6 +133,7 @@ const (
 	NPOption = 0x08
 	EAOption = 0x20
 	DCOption = 0x40
+	OOption  = 0x40 /* RFC 5250 */
 )
 
 type IntfTxHandle struct {
@@ -106,8 +106,12 @@ func (server *OSPFServer) StartDBListener() {
 
 func (server *OSPFServer) ReadOspfCfgFromDB() {
 	server.readGlobalConfFromDB()
+	server.readKeyChainConfFromDB()
 	server.readAreaConfFromDB()
 	server.readIntfConfFromDB()
+	server.readVirtIfConfFromDB()
+	server.readOspfv3GlobalConfFromDB()
+	server.readOspfv3IntfConfFromDB()
 }
 
 func (server *OSPFServer) readGlobalConfFromDB() {
@@ -151,6 +155,45 @@ func (server *OSPFServer) applyOspfGlobalConf(conf *ospfd.OspfGlobal) error {
 	return nil
 }
 
+func (server *OSPFServer) readKeyChainConfFromDB() {
+	server.logger.Info("Reading key chain object from DB")
+	var dbObj objects.OspfKeyChain
+	if server.dbHdl == nil {
+		server.logger.Err("Null db handle. No key chain conf read from db.")
+		return
+	}
+
+	objList, err := server.dbHdl.GetAllObjFromDb(dbObj)
+	if err != nil {
+		server.logger.Err("DB query failed for OspfKeyChain")
+		return
+	}
+	for idx := 0; idx < len(objList); idx++ {
+		obj := ospfd.NewOspfKeyChain()
+		dbObject := objList[idx].(objects.OspfKeyChain)
+		objects.ConvertospfdOspfKeyChainObjToThrift(&dbObject, obj)
+		err := server.applyOspfKeyChainConf(obj)
+		if err != nil {
+			server.logger.Err("Error applying Ospf Key Chain Configuration")
+		}
+	}
+}
+
+func (server *OSPFServer) applyOspfKeyChainConf(conf *ospfd.OspfKeyChain) error {
+	keyChainConf, err := ConvertOspfKeyChain(conf)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("Invalid Ospf Key Chain Configuration", err))
+		return err
+	}
+	err = server.processKeyChainConfig(keyChainConf)
+	if err != nil {
+		server.logger.Err("Error Configuring Ospf Key Chain Configuration")
+		err := errors.New("Error Configuring Ospf Key Chain Configuration")
+		return err
+	}
+	return nil
+}
+
 func (server *OSPFServer) readAreaConfFromDB() {
 	server.logger.Info("Reading area object from DB")
 	var dbObj objects.OspfAreaEntry
@@ -179,6 +222,7 @@ func (server *OSPFServer) applyOspfAreaConf(conf *ospfd.OspfAreaEntry) error {
 	aConf := config.AreaConf{
 		AreaId:                 config.AreaId(conf.AreaId),
 		AuthType:               config.AuthType(conf.AuthType),
+		AuthKeyChain:           conf.AuthKeyChain,
 		ImportAsExtern:         config.ImportAsExtern(conf.ImportAsExtern),
 		AreaSummary:            config.AreaSummary(conf.AreaSummary),
 		AreaNssaTranslatorRole: config.NssaTranslatorRole(conf.AreaNssaTranslatorRole),
@@ -229,6 +273,14 @@ func (server *OSPFServer) applyOspfIntfConf(conf *ospfd.OspfIfEntry) error {
 		IfPollInterval:    config.PositiveInteger(conf.IfPollInterval),
 		IfAuthKey:         conf.IfAuthKey,
 		IfAuthType:        config.AuthType(conf.IfAuthType),
+		IfAuthKeyChain:    conf.IfAuthKeyChain,
+	}
+
+	for _, md5Key := range conf.IfAuthMd5Keys {
+		ifConf.IfAuthMd5Keys = append(ifConf.IfAuthMd5Keys, config.AuthMd5Key{
+			KeyId: uint8(md5Key.KeyId),
+			Key:   md5Key.Key,
+		})
 	}
 
 	for index, ifName := range config.IfTypeList {
@@ -248,6 +300,84 @@ func (server *OSPFServer) applyOspfIntfConf(conf *ospfd.OspfIfEntry) error {
 
 }
 
+func (server *OSPFServer) readVirtIfConfFromDB() {
+	server.logger.Info("Reading virtual interface object from DB")
+	var dbObj objects.OspfVirtIfEntry
+	if server.dbHdl == nil {
+		server.logger.Err("Null db handle. No Virtual Intf conf to be read from db.")
+		return
+	}
+	objList, err := server.dbHdl.GetAllObjFromDb(dbObj)
+	if err != nil {
+		server.logger.Err("DB query failed for OspfVirtIfEntry")
+		return
+	}
+	for idx := 0; idx < len(objList); idx++ {
+		obj := ospfd.NewOspfVirtIfEntry()
+		dbObject := objList[idx].(objects.OspfVirtIfEntry)
+		objects.ConvertospfdOspfVirtIfEntryObjToThrift(&dbObject, obj)
+		err := server.applyOspfVirtIfConf(obj)
+		if err != nil {
+			server.logger.Err("Error applying Ospf Virtual Interface Configuration")
+		}
+	}
+}
+
+func (server *OSPFServer) applyOspfVirtIfConf(conf *ospfd.OspfVirtIfEntry) error {
+	virtIfConf := ConvertOspfVirtIfEntry(conf)
+	err := server.SendVirtIfConfig(virtIfConf)
+	if err != nil {
+		server.logger.Err("Error Configuring Ospf Virtual Interface Configuration")
+		err := errors.New("Error Configuring Ospf Virtual Interface Configuration")
+		return err
+	}
+	return nil
+}
+
+/*
+OSPFv3 state belongs to the server main loop, hence the
+configuration is handed over through the config channels.
+*/
+func (server *OSPFServer) readOspfv3GlobalConfFromDB() {
+	server.logger.Info("Reading OSPFv3 global object from DB")
+	var dbObj objects.Ospfv3Global
+	if server.dbHdl == nil {
+		server.logger.Err("Null db handle. No OSPFv3 Global conf to be read from db.")
+		return
+	}
+	objList, err := server.dbHdl.GetAllObjFromDb(dbObj)
+	if err != nil {
+		server.logger.Err("DB query failed for Ospfv3Global")
+		return
+	}
+	for idx := 0; idx < len(objList); idx++ {
+		obj := ospfd.NewOspfv3Global()
+		dbObject := objList[idx].(objects.Ospfv3Global)
+		objects.ConvertospfdOspfv3GlobalObjToThrift(&dbObject, obj)
+		server.Ospfv3GlobalConfigCh <- ConvertOspfv3Global(obj)
+	}
+}
+
+func (server *OSPFServer) readOspfv3IntfConfFromDB() {
+	server.logger.Info("Reading OSPFv3 interface object from DB")
+	var dbObj objects.Ospfv3IntfEntry
+	if server.dbHdl == nil {
+		server.logger.Err("Null db handle. No OSPFv3 Intf conf to be read from db.")
+		return
+	}
+	objList, err := server.dbHdl.GetAllObjFromDb(dbObj)
+	if err != nil {
+		server.logger.Err("DB query failed for Ospfv3IntfEntry")
+		return
+	}
+	for idx := 0; idx < len(objList); idx++ {
+		obj := ospfd.NewOspfv3IntfEntry()
+		dbObject := objList[idx].(objects.Ospfv3IntfEntry)
+		objects.ConvertospfdOspfv3IntfEntryObjToThrift(&dbObject, obj)
+		server.Ospfv3IntfConfigCh <- ConvertOspfv3IntfEntry(obj)
+	}
+}
+
 func (server *OSPFServer) AddIPv4RoutesState(entry RoutingTblEntryKey) error {
 	server.logger.Info(fmt.Sprintln("DB: Add IPv4 entry to db. ", entry))
 	rEntry, exist := server.GlobalRoutingTbl[entry]
@@ -330,6 +460,67 @@ func (server *OSPFServer) DelIPv4RoutesState(entry RoutingTblEntryKey) error {
 	return nil
 }
 
+/*
+@fn readPreservedRoutesFromDB
+Routes installed before restart are loaded in the global
+routing table. The first SPF after graceful restart then
+updates only the changed routes.
+*/
+func (server *OSPFServer) readPreservedRoutesFromDB() int {
+	var dbObj objects.OspfIPv4RouteState
+	if server.dbHdl == nil {
+		return 0
+	}
+	objList, err := server.dbHdl.GetAllObjFromDb(dbObj)
+	if err != nil {
+		server.logger.Err("DB query failed for OspfIPv4RouteState")
+		return 0
+	}
+	numRoutes := 0
+	for idx := 0; idx < len(objList); idx++ {
+		obj := ospfd.NewOspfIPv4RouteState()
+		dbObject := objList[idx].(objects.OspfIPv4RouteState)
+		objects.ConvertospfdOspfIPv4RouteStateObjToThrift(&dbObject, obj)
+		if len(obj.DestType) != 1 || DestType(obj.DestType[0]) != Network {
+			continue
+		}
+		key := RoutingTblEntryKey{
+			DestId:   convertAreaOrRouterIdUint32(obj.DestId),
+			AddrMask: convertAreaOrRouterIdUint32(obj.AddrMask),
+			DestType: Network,
+		}
+		var rEntry GlobalRoutingTblEntry
+		rEntry.AreaId = convertAreaOrRouterIdUint32(obj.AreaId)
+		rEntry.RoutingTblEnt.OptCapabilities = uint8(obj.OptCapabilities)
+		if len(obj.PathType) == 1 {
+			rEntry.RoutingTblEnt.PathType = PathType(obj.PathType[0])
+		}
+		rEntry.RoutingTblEnt.Cost = uint16(obj.Cost)
+		rEntry.RoutingTblEnt.Type2Cost = uint16(obj.Type2Cost)
+		rEntry.RoutingTblEnt.NumOfPaths = int(obj.NumOfPaths)
+		rEntry.RoutingTblEnt.NextHops = make(map[NextHop]bool)
+		for _, nh := range obj.NextHops {
+			nextHop := NextHop{
+				IfIPAddr:  convertAreaOrRouterIdUint32(nh.IfIPAddr),
+				IfIdx:     uint32(nh.IfIdx),
+				NextHopIP: convertAreaOrRouterIdUint32(nh.NextHopIP),
+				AdvRtr:    convertAreaOrRouterIdUint32(nh.AdvRtr),
+			}
+			rEntry.RoutingTblEnt.NextHops[nextHop] = true
+		}
+		if obj.LSOrigin != nil {
+			rEntry.RoutingTblEnt.LSOrigin = LsaKey{
+				LSType:    uint8(obj.LSOrigin.LSType),
+				LSId:      uint32(obj.LSOrigin.LSId),
+				AdvRouter: uint32(obj.LSOrigin.AdvRouter),
+			}
+		}
+		server.GlobalRoutingTbl[key] = rEntry
+		numRoutes++
+	}
+	return numRoutes
+}
+
 func (server *OSPFServer) AddLsdbEntry(entry LsdbSliceEnt) error {
 	server.logger.Info(fmt.Sprintln("DB: Add lsdb entry. ", entry))
 	var lsaEnc []byte
@@ -387,6 +578,29 @@ func (server *OSPFServer) AddLsdbEntry(entry LsdbSliceEnt) error {
 		}
 		lsaEnc = encodeASExternalLsa(lsa, lsaKey)
 		lsaMd = lsa.LsaMd
+	} else if entry.LSType == NSSALSA {
+		lsa, exist := lsDbEnt.NSSALsaMap[lsaKey]
+		if !exist {
+			return nil
+		}
+		lsaEnc = encodeASExternalLsa(lsa, lsaKey)
+		lsaMd = lsa.LsaMd
+	} else if entry.LSType == AreaOpaqueLSA || entry.LSType == ASOpaqueLSA {
+		lsa, exist := lsDbEnt.OpaqueLsaMap[lsaKey]
+		if !exist {
+			return nil
+		}
+		lsaEnc = encodeOpaqueLsa(lsa, lsaKey)
+		lsaMd = lsa.LsaMd
+	} else if entry.LSType == LinkOpaqueLSA {
+		lsa, exist := server.getLinkOpaqueLsaInArea(entry.AreaId, lsaKey)
+		if !exist {
+			return nil
+		}
+		lsaEnc = encodeOpaqueLsa(lsa, lsaKey)
+		lsaMd = lsa.LsaMd
+	} else {
+		return nil
 	}
 	adv := convertByteToOctetString(lsaEnc[OSPF_LSA_HEADER_SIZE:])
 
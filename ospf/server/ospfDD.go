@@ -286,14 +286,12 @@ func (server *OSPFServer) BuildDBDPkt(intfKey IntfConfKey, ent IntfConf,
 
 	ospf := append(ospfEncHdr, dbdDataEnc...)
 	//server.logger.Info(fmt.Sprintln("OSPF DBD:", ospf))
-	csum := computeCheckSum(ospf)
-	binary.BigEndian.PutUint16(ospf[12:14], csum)
-	copy(ospf[16:24], ent.IfAuthKey)
+	ospf = server.encodeOspfAuth(ent, ospf)
 
 	var DstIP net.IP
 	var DstMAC net.HardwareAddr
 
-	ipPktlen := IP_HEADER_MIN_LEN + ospfHdr.pktlen
+	ipPktlen := IP_HEADER_MIN_LEN + len(ospf)
 	SrcIP := ent.IfIpAddr
 
 	if ent.IfType == config.NumberedP2P {
@@ -309,7 +307,7 @@ func (server *OSPFServer) BuildDBDPkt(intfKey IntfConfKey, ent IntfConf,
 		IHL:      uint8(IP_HEADER_MIN_LEN),
 		TOS:      uint8(0xc0),
 		Length:   uint16(ipPktlen),
-		TTL:      uint8(1),
+		TTL:      getOspfPktTTL(ent.IfType),
 		Protocol: layers.IPProtocol(OSPF_PROTO_ID),
 		SrcIP:    SrcIP,
 		DstIP:    DstIP,
@@ -394,7 +392,10 @@ func (server *OSPFServer) ConstructAndSendDbdPacket(nbrKey NeighborConfKey,
 	dbd_mdata.msbit = msbit
 
 	dbd_mdata.interface_mtu = INTF_MTU_MIN
-	dbd_mdata.options = options
+	dbd_mdata.options = options &^ OOption
+	if server.ospfGlobalConf.OpaqueLsaSupport {
+		dbd_mdata.options |= OOption
+	}
 	dbd_mdata.dd_sequence_number = seq
 
 	lsa_count_done := 0
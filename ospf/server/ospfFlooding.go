@@ -190,7 +190,7 @@ func (server *OSPFServer) processFloodMsg(lsa_data ospfFloodMsg) {
 		var lsaEncPkt []byte
 		for key, intf := range server.IntfConfMap {
 			areaid := convertIPv4ToUint32(intf.IfAreaId)
-			if intf.IfIpAddr.Equal(rxIntf.IfIpAddr) || lsa_data.areaId != areaid {
+			if key == nbrConf.intfConfKey || lsa_data.areaId != areaid {
 				server.logger.Info(fmt.Sprintln("LSASELFLOOD:Dont flood on rx intf ", rxIntf.IfIpAddr))
 				continue // dont flood the LSA on the interface it is received.
 			}
@@ -262,6 +262,13 @@ func (server *OSPFServer) processFloodMsg(lsa_data ospfFloodMsg) {
 		server.logger.Info(fmt.Sprintln("LSAEXTFLOOD: Flood external routes for lsa key ", lsa_data.lsaKey))
 		server.processAsExternalLSAFlood(lsa_data.lsaKey)
 
+	case LSANSSAFLOOD: //flood NSSA LSA
+		server.logger.Info(fmt.Sprintln("LSANSSAFLOOD: Flood NSSA LSA for lsa key ", lsa_data.lsaKey, " area ", lsa_data.areaId))
+		server.processNssaLSAFlood(lsa_data.areaId, lsa_data.lsaKey)
+
+	case LSAOPAQUEFLOOD: //flood opaque LSA within link, area or AS
+		server.processOpaqueLSAFlood(lsa_data)
+
 	case LSAAGE: // Flood aged LSAs
 		server.constructAndSendLsaAgeFlood()
 
@@ -475,8 +482,11 @@ func (server *OSPFServer) floodSummaryLsa(pkt []byte, areaid uint32) {
 */
 func (server *OSPFServer) processAsExternalLSAFlood(lsakey LsaKey) {
 	areaId := convertAreaOrRouterIdUint32("0.0.0.0")
-	for ent, _ := range server.AreaConfMap {
-		areaId = convertAreaOrRouterIdUint32(string(ent.AreaId))
+	for lsdbKey, lsDbEnt := range server.AreaLsdb {
+		if _, exist := lsDbEnt.ASExternalLsaMap[lsakey]; exist {
+			areaId = lsdbKey.AreaId
+			break
+		}
 	}
 	var lsaEncPkt []byte
 	LsaEnc := []byte{}
@@ -514,12 +524,21 @@ func (server *OSPFServer) floodASExternalLsa(pkt []byte) {
 		if !ok {
 			continue
 		}
+		if intf.IfType == config.VirtualLink {
+			server.logger.Info(fmt.Sprintln("ASBR: Dont flood AS external over virtual link ", intf.IfName))
+			continue
+		}
 		areaId := config.AreaId(convertIPInByteToString(intf.IfAreaId))
 		isStub := server.isStubArea(areaId)
 		if isStub {
 			server.logger.Info(fmt.Sprintln("ASBR: Dont flood AS external as area is stub ", areaId))
 			continue
 		}
+		isNssa := server.isNssaArea(areaId)
+		if isNssa {
+			server.logger.Info(fmt.Sprintln("ASBR: Dont flood AS external as area is NSSA ", areaId))
+			continue
+		}
 		nbrMdata, ok := ospfIntfToNbrMap[key]
 		if ok && len(nbrMdata.nbrList) > 0 {
 			send_pkt := server.BuildLsaUpdPkt(key, intf, dstMac, dstIp, len(pkt), pkt)
@@ -43,6 +43,14 @@ type GlobalConf struct {
 	RestartInterval          int32
 	RestartStrictLsaChecking bool
 	StubRouterAdvertisement  config.AdvertiseAction
+	StubRouterOnStartup      int32
+	StubRouterWaitForBgp     bool
+	SpfInitialDelay          int32
+	SpfHoldTime              int32
+	SpfMaxWait               int32
+	LsaInitialDelay          int32
+	LsaHoldTime              int32
+	LsaMaxWait               int32
 	Version                  uint8
 	AreaBdrRtrStatus         bool
 	ExternLsaCount           int32
@@ -56,6 +64,8 @@ type GlobalConf struct {
 	AsLsaCount               int32
 	AsLsaCksumSum            int32
 	StubRouterSupport        bool
+	StubRouterMode           config.StubRouterMode
+	StubRouterAge            int32
 	//DiscontinuityTime        string
 	DiscontinuityTime int32 // This should be string
 	isABR             bool
@@ -74,6 +84,16 @@ func (server *OSPFServer) updateGlobalConf(gConf config.GlobalConf) {
 	server.ospfGlobalConf.RestartSupport = gConf.RestartSupport
 	server.ospfGlobalConf.RestartInterval = gConf.RestartInterval
 	server.ospfGlobalConf.ReferenceBandwidth = uint32(gConf.ReferenceBandwidth)
+	server.ospfGlobalConf.StubRouterAdvertisement = gConf.StubRouterAdvertisement
+	server.ospfGlobalConf.StubRouterOnStartup = gConf.StubRouterOnStartup
+	server.ospfGlobalConf.StubRouterWaitForBgp = gConf.StubRouterWaitForBgp
+	server.ospfGlobalConf.OpaqueLsaSupport = gConf.OpaqueLsaSupport
+	server.ospfGlobalConf.SpfInitialDelay = gConf.SpfInitialDelay
+	server.ospfGlobalConf.SpfHoldTime = gConf.SpfHoldTime
+	server.ospfGlobalConf.SpfMaxWait = gConf.SpfMaxWait
+	server.ospfGlobalConf.LsaInitialDelay = gConf.LsaInitialDelay
+	server.ospfGlobalConf.LsaHoldTime = gConf.LsaHoldTime
+	server.ospfGlobalConf.LsaMaxWait = gConf.LsaMaxWait
 	server.logger.Err("Global configuration updated")
 }
 
@@ -96,6 +116,14 @@ func (server *OSPFServer) initOspfGlobalConfDefault() {
 	server.ospfGlobalConf.RestartInterval = 0
 	server.ospfGlobalConf.RestartStrictLsaChecking = false
 	server.ospfGlobalConf.StubRouterAdvertisement = config.DoNotAdvertise
+	server.ospfGlobalConf.StubRouterOnStartup = 0
+	server.ospfGlobalConf.StubRouterWaitForBgp = false
+	server.ospfGlobalConf.SpfInitialDelay = SpfInitialDelay
+	server.ospfGlobalConf.SpfHoldTime = SpfHoldTime
+	server.ospfGlobalConf.SpfMaxWait = SpfMaxWait
+	server.ospfGlobalConf.LsaInitialDelay = LsaInitialDelay
+	server.ospfGlobalConf.LsaHoldTime = LsaHoldTime
+	server.ospfGlobalConf.LsaMaxWait = LsaMaxWait
 	server.ospfGlobalConf.Version = uint8(OSPF_VERSION_2)
 	server.ospfGlobalConf.AreaBdrRtrStatus = false
 	server.ospfGlobalConf.ExternLsaCount = 0
@@ -108,7 +136,9 @@ func (server *OSPFServer) initOspfGlobalConfDefault() {
 	server.ospfGlobalConf.RestartExitReason = config.NoAttempt
 	server.ospfGlobalConf.AsLsaCount = 0
 	server.ospfGlobalConf.AsLsaCksumSum = 0
-	server.ospfGlobalConf.StubRouterSupport = false
+	server.ospfGlobalConf.StubRouterSupport = true
+	server.ospfGlobalConf.StubRouterMode = config.StubRouterNone
+	server.ospfGlobalConf.StubRouterAge = 0
 	//server.ospfGlobalConf.DiscontinuityTime = "0"
 	server.ospfGlobalConf.DiscontinuityTime = 0 //This should be string
 	server.ospfGlobalConf.isABR = false
@@ -145,6 +175,8 @@ func (server *OSPFServer) processGlobalConfig(gConf config.GlobalConf) error {
 
 	if server.ospfGlobalConf.AdminStat == config.Enabled {
 		//server.NeighborListMap = make(map[IntfConfKey]list.List)
+		server.startGracefulRestart()
+		server.startStubRouter()
 		server.logger.Info(fmt.Sprintln("Spawn Neighbor state machine"))
 		server.InitNeighborStateMachine()
 		go server.UpdateNeighborConf()
@@ -153,6 +185,8 @@ func (server *OSPFServer) processGlobalConfig(gConf config.GlobalConf) error {
 		go server.ProcessRxNbrPkt()
 		server.StartLSDatabase()
 
+	} else {
+		server.stopStubRouter()
 	}
 	server.processASBdrRtrStatus(server.ospfGlobalConf.AreaBdrRtrStatus)
 	for key, ent := range localIntfStateMap {
@@ -0,0 +1,908 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"l3/ospf/config"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+/* RFC 3623: grace-LSA is the link local opaque LSA with opaque type 3 */
+const (
+	GraceLsaOpaqueType  uint8  = 3
+	GraceLsaLinkStateId uint32 = uint32(GraceLsaOpaqueType) << 24
+
+	GraceTlvPeriod   uint16 = 1
+	GraceTlvReason   uint16 = 2
+	GraceTlvIntfAddr uint16 = 3
+
+	GraceReasonUnknown    uint8 = 0
+	GraceReasonSwRestart  uint8 = 1
+	GraceReasonSwUpgrade  uint8 = 2
+	GraceReasonSwitchover uint8 = 3
+
+	GraceDefaultPeriod   uint32 = 120 // seconds
+	GraceLsaTxCount      int    = 3
+	GraceLsaTxInterval          = time.Second
+	GracefulRestartDbKey        = "OspfGracefulRestart"
+)
+
+/* LS Type 9, opaque type 3 */
+type GraceLsa struct {
+	LsaMd         LsaMetadata
+	GracePeriod   uint32
+	RestartReason uint8
+	IntfIpAddr    uint32
+}
+
+func NewGraceLsa() *GraceLsa {
+	return &GraceLsa{}
+}
+
+/* Helper mode state for a restarting neighbor */
+type GraceHelperEnt struct {
+	Status      config.NbrRestartHelperStatus
+	NbrRtrId    uint32
+	AreaId      uint32
+	Reason      uint8
+	GraceExpiry time.Time
+	ExitReason  config.RestartExitReason
+	graceTimer  *time.Timer
+}
+
+type graceEventType uint8
+
+const (
+	graceHelperTimeout graceEventType = iota
+	gracePrepareRestart
+)
+
+/*
+Events of the grace timers and of the signal handler. They are
+queued in order and applied by the server main loop. doneCh is
+signalled once the event was processed.
+*/
+type GraceEvent struct {
+	eventType   graceEventType
+	nbrKey      NeighborConfKey
+	graceExpiry time.Time
+	doneCh      chan bool
+}
+
+/* Stored in redis before a planned restart */
+type GracefulRestartRecord struct {
+	RestartReason int
+	GraceExpiry   int64
+}
+
+/*
+   0                   1                   2                   3
+   0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |            LS age             |     Options   |       9       |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |       3       |                    Opaque ID                  |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                     Advertising Router                        |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                     LS sequence number                        |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |         LS checksum           |             length            |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |              Type             |             Length            |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                            Value...                           |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+func encodeGraceTlv(tlvType uint16, value []byte) []byte {
+	tlv := make([]byte, 4+(len(value)+3)/4*4)
+	binary.BigEndian.PutUint16(tlv[0:2], tlvType)
+	binary.BigEndian.PutUint16(tlv[2:4], uint16(len(value)))
+	copy(tlv[4:], value)
+	return tlv
+}
+
+func encodeGraceLsa(lsa GraceLsa, lsakey LsaKey) []byte {
+	period := make([]byte, 4)
+	binary.BigEndian.PutUint32(period, lsa.GracePeriod)
+	body := encodeGraceTlv(GraceTlvPeriod, period)
+	body = append(body, encodeGraceTlv(GraceTlvReason, []byte{lsa.RestartReason})...)
+	if lsa.IntfIpAddr != 0 {
+		ipAddr := make([]byte, 4)
+		binary.BigEndian.PutUint32(ipAddr, lsa.IntfIpAddr)
+		body = append(body, encodeGraceTlv(GraceTlvIntfAddr, ipAddr)...)
+	}
+	lsa.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + len(body))
+	lsaHdr := encodeLsaHeader(lsa.LsaMd, lsakey)
+	return append(lsaHdr, body...)
+}
+
+func decodeGraceLsa(data []byte, lsa *GraceLsa, lsakey *LsaKey) {
+	lsa.LsaMd.LSAge = binary.BigEndian.Uint16(data[0:2])
+	lsa.LsaMd.Options = uint8(data[2])
+	lsakey.LSType = uint8(data[3])
+	lsakey.LSId = binary.BigEndian.Uint32(data[4:8])
+	lsakey.AdvRouter = binary.BigEndian.Uint32(data[8:12])
+	lsa.LsaMd.LSSequenceNum = int(binary.BigEndian.Uint32(data[12:16]))
+	lsa.LsaMd.LSChecksum = binary.BigEndian.Uint16(data[16:18])
+	lsa.LsaMd.LSLen = binary.BigEndian.Uint16(data[18:20])
+
+	end := int(lsa.LsaMd.LSLen)
+	if end > len(data) {
+		end = len(data)
+	}
+	for index := OSPF_LSA_HEADER_SIZE; index+4 <= end; {
+		tlvType := binary.BigEndian.Uint16(data[index : index+2])
+		tlvLen := int(binary.BigEndian.Uint16(data[index+2 : index+4]))
+		value := index + 4
+		if value+tlvLen > end {
+			return
+		}
+		switch {
+		case tlvType == GraceTlvPeriod && tlvLen == 4:
+			lsa.GracePeriod = binary.BigEndian.Uint32(data[value : value+4])
+		case tlvType == GraceTlvReason && tlvLen == 1:
+			lsa.RestartReason = data[value]
+		case tlvType == GraceTlvIntfAddr && tlvLen == 4:
+			lsa.IntfIpAddr = binary.BigEndian.Uint32(data[value : value+4])
+		}
+		index = value + (tlvLen+3)/4*4
+	}
+}
+
+func (server *OSPFServer) gracefulRestartEnabled() bool {
+	return server.ospfGlobalConf.RestartSupport == config.PlannedOnly ||
+		server.ospfGlobalConf.RestartSupport == config.PlannedAndUnplanned
+}
+
+func (server *OSPFServer) isGracefulRestarting() bool {
+	return server.ospfGlobalConf.RestartStatus == config.PlannedRestart ||
+		server.ospfGlobalConf.RestartStatus == config.UnplannedRestart
+}
+
+func (server *OSPFServer) getGracePeriod() uint32 {
+	if server.ospfGlobalConf.RestartInterval > 0 {
+		return uint32(server.ospfGlobalConf.RestartInterval)
+	}
+	return GraceDefaultPeriod
+}
+
+/*
+@fn sendGraceLsa
+Send grace-LSA on the interface. lsAge set to MaxAge
+flushes the grace-LSA once restart is over.
+*/
+func (server *OSPFServer) sendGraceLsa(key IntfConfKey, lsAge uint16) {
+	intf, exist := server.IntfConfMap[key]
+	if !exist {
+		return
+	}
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	lsaKey := LsaKey{
+		LSType:    LinkOpaqueLSA,
+		LSId:      GraceLsaLinkStateId,
+		AdvRouter: rtrId,
+	}
+	lsa := GraceLsa{
+		GracePeriod:   server.getGracePeriod(),
+		RestartReason: server.graceRestartReason,
+	}
+	if intf.IfType == config.Broadcast {
+		lsa.IntfIpAddr = convertAreaOrRouterIdUint32(intf.IfIpAddr.String())
+	}
+	lsa.LsaMd.LSAge = lsAge
+	lsa.LsaMd.Options = INTF_OPTIONS
+	lsa.LsaMd.LSSequenceNum = InitialSequenceNumber
+	lsaEnc := encodeGraceLsa(lsa, lsaKey)
+	checkSum := computeFletcherChecksum(lsaEnc[2:], uint16(14))
+	binary.BigEndian.PutUint16(lsaEnc[16:18], checkSum)
+
+	lsaUpd := make([]byte, 4)
+	binary.BigEndian.PutUint32(lsaUpd, 1)
+	lsaUpd = append(lsaUpd, lsaEnc...)
+	dstMac := net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x05}
+	dstIp := net.IP{224, 0, 0, 5}
+	pkt := server.BuildLsaUpdPkt(key, intf, dstMac, dstIp, len(lsaUpd), lsaUpd)
+	server.logger.Info(fmt.Sprintln("GR: Send grace LSA on intf ", intf.IfIpAddr, " age ", lsAge,
+		" reason ", lsa.RestartReason))
+	server.SendOspfPkt(key, pkt)
+}
+
+/* Interfaces with a full neighbor are the ones the grace-LSA has to reach. */
+func (server *OSPFServer) graceIntfCheck(key IntfConfKey) bool {
+	nbrData, exist := ospfIntfToNbrMap[key]
+	if !exist {
+		return false
+	}
+	for _, nbrKey := range nbrData.nbrList {
+		if server.NeighborConfigMap[nbrKey].OspfNbrState == config.NbrFull {
+			return true
+		}
+	}
+	return false
+}
+
+func (server *OSPFServer) sendGraceLsaAllIntf(lsAge uint16) {
+	for key, _ := range server.IntfConfMap {
+		if server.graceIntfCheck(key) {
+			server.sendGraceLsa(key, lsAge)
+		}
+	}
+}
+
+/*
+@fn processRecvdGraceLsa
+Helper mode entry/exit (RFC 3623 3.1, 3.2) on receipt of grace-LSA.
+*/
+func (server *OSPFServer) processRecvdGraceLsa(nbrKey NeighborConfKey, areaId uint32, data []byte) {
+	lsa := NewGraceLsa()
+	lsaKey := NewLsaKey()
+	decodeGraceLsa(data, lsa, lsaKey)
+	if lsaKey.LSId != GraceLsaLinkStateId {
+		server.logger.Info(fmt.Sprintln("GR: Ignore link opaque LSA ", convertUint32ToIPv4(lsaKey.LSId)))
+		return
+	}
+	if lsa.IntfIpAddr != 0 {
+		nbrKey.IPAddr = config.IpAddress(convertUint32ToIPv4(lsa.IntfIpAddr))
+	}
+	nbr, exist := server.NeighborConfigMap[nbrKey]
+	if !exist || nbr.OspfNbrRtrId != lsaKey.AdvRouter {
+		server.logger.Info(fmt.Sprintln("GR: Grace LSA from unknown neighbor ", nbrKey.IPAddr,
+			" adv router ", convertUint32ToIPv4(lsaKey.AdvRouter)))
+		return
+	}
+	if lsa.LsaMd.LSAge >= config.MaxAge {
+		server.exitGraceHelper(nbrKey, config.Completed)
+		return
+	}
+	err := server.graceHelperCheck(nbrKey, nbr, *lsa)
+	if err != nil {
+		server.logger.Info(fmt.Sprintln("GR: Dont help neighbor ", nbrKey.IPAddr, err))
+		server.exitGraceHelper(nbrKey, config.NoAttempt)
+		return
+	}
+
+	gracePeriod := time.Duration(lsa.GracePeriod-uint32(lsa.LsaMd.LSAge)) * time.Second
+	server.graceHelperMutex.Lock()
+	ent := server.GraceHelperMap[nbrKey]
+	if ent.graceTimer != nil {
+		ent.graceTimer.Stop()
+	}
+	ent.Status = config.Helping
+	ent.NbrRtrId = nbr.OspfNbrRtrId
+	ent.AreaId = areaId
+	ent.Reason = lsa.RestartReason
+	ent.GraceExpiry = time.Now().Add(gracePeriod)
+	ent.ExitReason = config.InProgress
+	graceExpiry := ent.GraceExpiry
+	ent.graceTimer = time.AfterFunc(gracePeriod, func() {
+		server.postGraceEvent(GraceEvent{
+			eventType:   graceHelperTimeout,
+			nbrKey:      nbrKey,
+			graceExpiry: graceExpiry,
+		})
+	})
+	server.GraceHelperMap[nbrKey] = ent
+	server.graceHelperMutex.Unlock()
+
+	server.logger.Info(fmt.Sprintln("GR: Helping neighbor ", nbrKey.IPAddr, " grace period ", gracePeriod))
+	msg := DbEventMsg{
+		eventType: config.ADJACENCY,
+		eventInfo: "Graceful restart helper start " + nbr.OspfNbrIPAddr.String(),
+	}
+	server.DbEventOp <- msg
+}
+
+/* Registered opaque application for opaque type 3 */
+func (server *OSPFServer) processGraceLsaEvent(event OpaqueLsaEvent) {
+	server.processRecvdGraceLsa(event.NbrKey, event.AreaId, event.Pkt)
+}
+
+func (server *OSPFServer) graceHelperCheck(nbrKey NeighborConfKey, nbr OspfNeighborEntry, lsa GraceLsa) error {
+	if !server.gracefulRestartEnabled() {
+		return errors.New("Graceful restart support disabled")
+	}
+	if server.ospfGlobalConf.RestartSupport == config.PlannedOnly &&
+		lsa.RestartReason != GraceReasonSwRestart && lsa.RestartReason != GraceReasonSwUpgrade {
+		return errors.New("Unplanned restart not supported")
+	}
+	if server.isGracefulRestarting() {
+		return errors.New("Router is restarting")
+	}
+	if nbr.OspfNbrState != config.NbrFull {
+		return errors.New("Neighbor is not full")
+	}
+	if uint32(lsa.LsaMd.LSAge) >= lsa.GracePeriod {
+		return errors.New("Grace period expired")
+	}
+	if nbr.retx_list_mutex != nil {
+		nbr.retx_list_mutex.Lock()
+		defer nbr.retx_list_mutex.Unlock()
+	}
+	for _, retx := range ospfNeighborRetx_list[nbrKey] {
+		if retx.valid {
+			return errors.New("Retransmission list not empty")
+		}
+	}
+	return nil
+}
+
+/*
+@fn exitGraceHelper
+Leave helper mode and re-originate LSAs with the actual
+adjacency state of the neighbor.
+*/
+func (server *OSPFServer) exitGraceHelper(nbrKey NeighborConfKey, reason config.RestartExitReason) {
+	server.graceHelperMutex.Lock()
+	ent, exist := server.GraceHelperMap[nbrKey]
+	if !exist || ent.Status != config.Helping {
+		if reason == config.NoAttempt {
+			ent.Status = config.NotHelping
+			ent.ExitReason = reason
+			server.GraceHelperMap[nbrKey] = ent
+		}
+		server.graceHelperMutex.Unlock()
+		return
+	}
+	if ent.graceTimer != nil {
+		ent.graceTimer.Stop()
+		ent.graceTimer = nil
+	}
+	ent.Status = config.NotHelping
+	ent.ExitReason = reason
+	server.GraceHelperMap[nbrKey] = ent
+	server.graceHelperMutex.Unlock()
+
+	server.logger.Info(fmt.Sprintln("GR: Exit helper mode for neighbor ", nbrKey.IPAddr, " reason ", reason))
+	nbr, exist := server.NeighborConfigMap[nbrKey]
+	if !exist {
+		return
+	}
+	msg := DbEventMsg{
+		eventType: config.ADJACENCY,
+		eventInfo: "Graceful restart helper exit " + nbr.OspfNbrIPAddr.String(),
+	}
+	server.DbEventOp <- msg
+	server.NetworkDRChangeCh <- DrChangeMsg{
+		areaId:  ent.AreaId,
+		intfKey: nbr.intfConfKey,
+	}
+}
+
+/*
+@fn postGraceEvent
+Called from the grace timers and the signal handler. The event is
+queued and the main loop is woken up without blocking.
+*/
+func (server *OSPFServer) postGraceEvent(event GraceEvent) {
+	server.graceEventMutex.Lock()
+	server.graceEvents = append(server.graceEvents, event)
+	server.graceEventMutex.Unlock()
+	select {
+	case server.GraceEventCh <- true:
+	default:
+	}
+}
+
+func (server *OSPFServer) processGraceEvents() {
+	server.graceEventMutex.Lock()
+	events := server.graceEvents
+	server.graceEvents = nil
+	server.graceEventMutex.Unlock()
+	for _, event := range events {
+		server.processGraceEvent(event)
+	}
+}
+
+func (server *OSPFServer) processGraceEvent(event GraceEvent) {
+	switch event.eventType {
+	case graceHelperTimeout:
+		server.graceHelperMutex.Lock()
+		ent, exist := server.GraceHelperMap[event.nbrKey]
+		server.graceHelperMutex.Unlock()
+		/* A newer grace-LSA restarted the grace period */
+		if !exist || ent.Status != config.Helping || !ent.GraceExpiry.Equal(event.graceExpiry) {
+			return
+		}
+		server.exitGraceHelper(event.nbrKey, config.TimeedOut)
+	case gracePrepareRestart:
+		server.prepareGracefulRestart()
+	}
+	if event.doneCh != nil {
+		event.doneCh <- true
+	}
+}
+
+func (server *OSPFServer) isGraceHelping(nbrKey NeighborConfKey) bool {
+	server.graceHelperMutex.Lock()
+	defer server.graceHelperMutex.Unlock()
+	ent, exist := server.GraceHelperMap[nbrKey]
+	return exist && ent.Status == config.Helping
+}
+
+func (server *OSPFServer) getGraceHelperState(nbrKey NeighborConfKey) (status config.NbrRestartHelperStatus,
+	age uint32, exitReason config.RestartExitReason) {
+	server.graceHelperMutex.Lock()
+	defer server.graceHelperMutex.Unlock()
+	ent, exist := server.GraceHelperMap[nbrKey]
+	if !exist {
+		return config.NotHelping, 0, config.NoAttempt
+	}
+	if ent.Status == config.Helping {
+		remaining := ent.GraceExpiry.Sub(time.Now())
+		if remaining > 0 {
+			age = uint32(remaining / time.Second)
+		}
+	}
+	return ent.Status, age, ent.ExitReason
+}
+
+/*
+@fn graceHelperTopologyCheck
+Changed LSA which would be flooded to a restarting neighbor
+terminates helper mode (RFC 3623 3.2).
+*/
+func (server *OSPFServer) graceHelperTopologyCheck(nbrKey NeighborConfKey, areaId uint32, lsaKey LsaKey, data []byte) {
+	var exitList []NeighborConfKey
+	server.graceHelperMutex.Lock()
+	for key, ent := range server.GraceHelperMap {
+		if ent.Status != config.Helping || key == nbrKey || ent.NbrRtrId == lsaKey.AdvRouter {
+			continue
+		}
+		if lsaKey.LSType != ASExternalLSA && ent.AreaId != areaId {
+			continue
+		}
+		exitList = append(exitList, key)
+	}
+	server.graceHelperMutex.Unlock()
+	if len(exitList) == 0 || !server.lsaContentChanged(areaId, lsaKey, data) {
+		return
+	}
+	for _, key := range exitList {
+		server.exitGraceHelper(key, config.TopologyChanged)
+	}
+}
+
+func (server *OSPFServer) lsaContentChanged(areaId uint32, lsaKey LsaKey, data []byte) bool {
+	lsaLen := int(binary.BigEndian.Uint16(data[18:20]))
+	if lsaLen > len(data) || binary.BigEndian.Uint16(data[0:2]) >= config.MaxAge {
+		return true
+	}
+	var lsaEnc []byte
+	switch lsaKey.LSType {
+	case RouterLSA:
+		lsa, ret := server.getRouterLsaFromLsdb(areaId, lsaKey)
+		if ret == LsdbEntryFound {
+			lsaEnc = encodeRouterLsa(lsa, lsaKey)
+		}
+	case NetworkLSA:
+		lsa, ret := server.getNetworkLsaFromLsdb(areaId, lsaKey)
+		if ret == LsdbEntryFound {
+			lsaEnc = encodeNetworkLsa(lsa, lsaKey)
+		}
+	case Summary3LSA, Summary4LSA:
+		lsa, ret := server.getSummaryLsaFromLsdb(areaId, lsaKey)
+		if ret == LsdbEntryFound {
+			lsaEnc = encodeSummaryLsa(lsa, lsaKey)
+		}
+	case ASExternalLSA:
+		lsa, ret := server.getASExternalLsaFromLsdb(areaId, lsaKey)
+		if ret == LsdbEntryFound {
+			lsaEnc = encodeASExternalLsa(lsa, lsaKey)
+		}
+	case NSSALSA:
+		lsa, ret := server.getNSSALsaFromLsdb(areaId, lsaKey)
+		if ret == LsdbEntryFound {
+			lsaEnc = encodeASExternalLsa(lsa, lsaKey)
+		}
+	}
+	if lsaEnc == nil || len(lsaEnc) != lsaLen {
+		return true
+	}
+	if lsaEnc[2] != data[2] {
+		return true
+	}
+	return !bytes.Equal(lsaEnc[OSPF_LSA_HEADER_SIZE:], data[OSPF_LSA_HEADER_SIZE:lsaLen])
+}
+
+func (server *OSPFServer) sigHandler(sigChan <-chan os.Signal) {
+	signal := <-sigChan
+	switch signal {
+	case syscall.SIGHUP:
+		server.logger.Info("Received SIGHUP signal")
+		doneCh := make(chan bool, 1)
+		server.postGraceEvent(GraceEvent{
+			eventType: gracePrepareRestart,
+			doneCh:    doneCh,
+		})
+		<-doneCh
+		if server.dbHdl != nil {
+			server.dbHdl.Disconnect()
+		}
+		os.Exit(0)
+	default:
+		server.logger.Err(fmt.Sprintln("Unhandled signal : ", signal))
+	}
+}
+
+/*
+@fn prepareGracefulRestart
+Planned restart. Save the grace period in db and tell the
+neighbors with grace-LSA before going down. Runs on the main
+loop, which is held until the process exits.
+*/
+func (server *OSPFServer) prepareGracefulRestart() {
+	if server.ospfGlobalConf.AdminStat != config.Enabled || !server.gracefulRestartEnabled() {
+		return
+	}
+	server.graceRestartReason = GraceReasonSwRestart
+	gracePeriod := time.Duration(server.getGracePeriod()) * time.Second
+	record := GracefulRestartRecord{
+		RestartReason: int(server.graceRestartReason),
+		GraceExpiry:   time.Now().Add(gracePeriod).Unix(),
+	}
+	err := server.storeGracefulRestartRecord(record)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("GR: Failed to store restart record ", err))
+		return
+	}
+	/* No ack processing for grace-LSA, send it a few times instead */
+	for i := 0; i < GraceLsaTxCount; i++ {
+		server.sendGraceLsaAllIntf(0)
+		time.Sleep(GraceLsaTxInterval)
+	}
+}
+
+func (server *OSPFServer) storeGracefulRestartRecord(record GracefulRestartRecord) error {
+	if server.dbHdl == nil {
+		return errors.New("Nil db handle")
+	}
+	_, err := server.dbHdl.Do("HMSET", redis.Args{}.Add(GracefulRestartDbKey).AddFlat(&record)...)
+	return err
+}
+
+func (server *OSPFServer) readGracefulRestartRecord() (record GracefulRestartRecord, err error) {
+	if server.dbHdl == nil {
+		return record, errors.New("Nil db handle")
+	}
+	val, err := redis.Values(server.dbHdl.Do("HGETALL", GracefulRestartDbKey))
+	if err != nil {
+		return record, err
+	}
+	if len(val) == 0 {
+		return record, errors.New("No graceful restart record")
+	}
+	err = redis.ScanStruct(val, &record)
+	return record, err
+}
+
+func (server *OSPFServer) delGracefulRestartRecord() {
+	if server.dbHdl == nil {
+		return
+	}
+	_, err := server.dbHdl.Do("DEL", GracefulRestartDbKey)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("GR: Failed to delete restart record ", err))
+	}
+}
+
+/*
+@fn startGracefulRestart
+Called once when OSPF is enabled. Enter restarter mode if a planned
+restart was recorded, or on unplanned restart with preserved routes.
+*/
+func (server *OSPFServer) startGracefulRestart() {
+	if server.graceRestartChecked {
+		return
+	}
+	server.graceRestartChecked = true
+	if !server.gracefulRestartEnabled() {
+		return
+	}
+	status := config.NotRestarting
+	now := time.Now()
+	record, err := server.readGracefulRestartRecord()
+	if err == nil && record.GraceExpiry > now.Unix() {
+		status = config.PlannedRestart
+		server.graceRestartReason = uint8(record.RestartReason)
+		server.graceRestartExpiry = time.Unix(record.GraceExpiry, 0)
+	} else if server.ospfGlobalConf.RestartSupport == config.PlannedAndUnplanned {
+		status = config.UnplannedRestart
+		server.graceRestartReason = GraceReasonUnknown
+		server.graceRestartExpiry = now.Add(time.Duration(server.getGracePeriod()) * time.Second)
+	}
+	server.delGracefulRestartRecord()
+	if status == config.NotRestarting {
+		return
+	}
+	numRoutes := server.readPreservedRoutesFromDB()
+	if status == config.UnplannedRestart && numRoutes == 0 {
+		server.logger.Info("GR: No preserved routes. Cold start.")
+		return
+	}
+	server.ospfGlobalConf.RestartStatus = status
+	server.ospfGlobalConf.RestartExitReason = config.InProgress
+	server.ospfGlobalConf.RestartAge = int32(server.graceRestartExpiry.Sub(now) / time.Second)
+	server.logger.Info(fmt.Sprintln("GR: Restarting, status ", status, " preserved routes ", numRoutes,
+		" grace period ", server.ospfGlobalConf.RestartAge))
+}
+
+/*
+@fn processGracefulRestartTick
+Visited every LSDB tick while restarting. Exit restart on
+grace period expiry, topology change or after all the
+pre-restart adjacencies are full again.
+*/
+func (server *OSPFServer) processGracefulRestartTick() {
+	if !server.isGracefulRestarting() {
+		return
+	}
+	remaining := server.graceRestartExpiry.Sub(time.Now())
+	if remaining <= 0 {
+		server.exitGracefulRestart(config.TimeedOut)
+		return
+	}
+	server.ospfGlobalConf.RestartAge = int32(remaining / time.Second)
+	if server.graceRestartTopologyChanged() {
+		server.exitGracefulRestart(config.TopologyChanged)
+	} else if server.graceRestartSynced() {
+		server.exitGracefulRestart(config.Completed)
+	}
+}
+
+func (server *OSPFServer) getSelfRouterLsa(areaId uint32) (RouterLsa, bool) {
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	lsaKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      rtrId,
+		AdvRouter: rtrId,
+	}
+	lsa, ret := server.getRouterLsaFromLsdb(areaId, lsaKey)
+	return lsa, ret == LsdbEntryFound
+}
+
+func (server *OSPFServer) isNbrFull(rtrId uint32, ipAddr uint32) bool {
+	for _, nbr := range server.NeighborConfigMap {
+		if nbr.OspfNbrState != config.NbrFull {
+			continue
+		}
+		if (rtrId != 0 && nbr.OspfNbrRtrId == rtrId) ||
+			(ipAddr != 0 && convertAreaOrRouterIdUint32(nbr.OspfNbrIPAddr.String()) == ipAddr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (server *OSPFServer) isLocalIntfAddr(ipAddr uint32) bool {
+	for _, intf := range server.IntfConfMap {
+		if intf.IfIpAddr != nil && convertAreaOrRouterIdUint32(intf.IfIpAddr.String()) == ipAddr {
+			return true
+		}
+	}
+	return false
+}
+
+func (server *OSPFServer) areaHasNeighbors(areaId uint32) bool {
+	for _, nbr := range server.NeighborConfigMap {
+		intf, exist := server.IntfConfMap[nbr.intfConfKey]
+		if exist && convertIPv4ToUint32(intf.IfAreaId) == areaId {
+			return true
+		}
+	}
+	return false
+}
+
+/* All the links of the pre-restart router-LSA are full again (RFC 3623 2.2) */
+func (server *OSPFServer) graceRestartSynced() bool {
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	synced := false
+	for key, _ := range server.AreaConfMap {
+		areaId := convertAreaOrRouterIdUint32(string(key.AreaId))
+		rlsa, exist := server.getSelfRouterLsa(areaId)
+		if !exist {
+			if server.areaHasNeighbors(areaId) {
+				return false
+			}
+			continue
+		}
+		for _, link := range rlsa.LinkDetails {
+			switch link.LinkType {
+			case P2PLink, VirtualLink:
+				if !server.isNbrFull(link.LinkId, 0) {
+					return false
+				}
+			case TransitLink:
+				if !server.isLocalIntfAddr(link.LinkId) {
+					if !server.isNbrFull(0, link.LinkId) {
+						return false
+					}
+					continue
+				}
+				/* I was DR. Wait for all the routers in my network LSA */
+				lsaKey := LsaKey{
+					LSType:    NetworkLSA,
+					LSId:      link.LinkId,
+					AdvRouter: rtrId,
+				}
+				nlsa, ret := server.getNetworkLsaFromLsdb(areaId, lsaKey)
+				if ret != LsdbEntryFound {
+					return false
+				}
+				for _, attachedRtr := range nlsa.AttachedRtr {
+					if attachedRtr != rtrId && !server.isNbrFull(attachedRtr, 0) {
+						return false
+					}
+				}
+			}
+		}
+		synced = true
+	}
+	return synced
+}
+
+/* A neighbor no longer advertises its link to us (RFC 3623 2.2) */
+func (server *OSPFServer) graceRestartTopologyChanged() bool {
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	for key, _ := range server.AreaConfMap {
+		areaId := convertAreaOrRouterIdUint32(string(key.AreaId))
+		rlsa, exist := server.getSelfRouterLsa(areaId)
+		if !exist {
+			continue
+		}
+		lsDbEnt := server.AreaLsdb[LsdbKey{AreaId: areaId}]
+		for _, link := range rlsa.LinkDetails {
+			switch link.LinkType {
+			case P2PLink:
+				lsaKey := LsaKey{
+					LSType:    RouterLSA,
+					LSId:      link.LinkId,
+					AdvRouter: link.LinkId,
+				}
+				nbrLsa, ret := server.getRouterLsaFromLsdb(areaId, lsaKey)
+				if ret != LsdbEntryFound {
+					continue
+				}
+				linkFound := false
+				for _, nbrLink := range nbrLsa.LinkDetails {
+					if nbrLink.LinkType == P2PLink && nbrLink.LinkId == rtrId {
+						linkFound = true
+						break
+					}
+				}
+				if !linkFound {
+					server.logger.Info(fmt.Sprintln("GR: Router LSA without link to us ",
+						convertUint32ToIPv4(link.LinkId)))
+					return true
+				}
+			case TransitLink:
+				if server.isLocalIntfAddr(link.LinkId) {
+					continue
+				}
+				for lsaKey, nlsa := range lsDbEnt.NetworkLsaMap {
+					if lsaKey.LSId != link.LinkId || lsaKey.AdvRouter == rtrId {
+						continue
+					}
+					attached := false
+					for _, attachedRtr := range nlsa.AttachedRtr {
+						if attachedRtr == rtrId {
+							attached = true
+							break
+						}
+					}
+					if !attached {
+						server.logger.Info(fmt.Sprintln("GR: Network LSA without us ",
+							convertUint32ToIPv4(link.LinkId)))
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+/*
+@fn exitGracefulRestart
+Re-originate LSAs, flush the stale self originated ones
+and install routes computed from the resynchronised LSDB.
+*/
+func (server *OSPFServer) exitGracefulRestart(reason config.RestartExitReason) {
+	server.logger.Info(fmt.Sprintln("GR: Exit graceful restart, reason ", reason))
+	server.ospfGlobalConf.RestartStatus = config.NotRestarting
+	server.ospfGlobalConf.RestartExitReason = reason
+	server.ospfGlobalConf.RestartAge = 0
+	server.delGracefulRestartRecord()
+	msg := DbEventMsg{
+		eventType: config.LSA,
+		eventInfo: "Graceful restart exit",
+	}
+	server.DbEventOp <- msg
+
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	nbr := NeighborConfKey{}
+	for key, _ := range server.AreaConfMap {
+		areaId := convertAreaOrRouterIdUint32(string(key.AreaId))
+		server.generateRouterLSA(areaId)
+		var floodKey IntfConfKey
+		isDR := false
+		for intfKey, intf := range server.IntfConfMap {
+			if convertIPv4ToUint32(intf.IfAreaId) != areaId {
+				continue
+			}
+			if intf.IfType == config.Broadcast && intf.IfDRtrId == rtrId && len(intf.NeighborMap) != 0 {
+				server.generateNetworkLSA(areaId, intfKey, true)
+				floodKey = intfKey
+				isDR = true
+			} else if !isDR {
+				floodKey = intfKey
+			}
+		}
+		server.flushStaleSelfLsa(areaId)
+		server.sendLsdbToNeighborEvent(floodKey, nbr, areaId, 0, 0, LsaKey{}, LSAFLOOD)
+	}
+	extRoutes := server.graceExtRouteQueue
+	server.graceExtRouteQueue = nil
+	for _, route := range extRoutes {
+		server.processExtRouteUpd(route)
+	}
+
+	server.scheduleSpf(SpfTrigGraceExit)
+	server.sendGraceLsaAllIntf(config.MaxAge)
+}
+
+/* Pre-restart LSAs not originated again are aged out */
+func (server *OSPFServer) flushStaleSelfLsa(areaId uint32) {
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		return
+	}
+	selfOrigLsaEnt := server.AreaSelfOrigLsa[lsdbKey]
+	for lsaKey, lsa := range lsDbEnt.RouterLsaMap {
+		if lsaKey.AdvRouter == rtrId && !selfOrigLsaEnt[lsaKey] {
+			lsa.LsaMd.LSAge = config.MaxAge
+			lsDbEnt.RouterLsaMap[lsaKey] = lsa
+		}
+	}
+	for lsaKey, lsa := range lsDbEnt.NetworkLsaMap {
+		if lsaKey.AdvRouter == rtrId && !selfOrigLsaEnt[lsaKey] {
+			server.logger.Info(fmt.Sprintln("GR: Flush stale network LSA ", convertUint32ToIPv4(lsaKey.LSId)))
+			lsa.LsaMd.LSAge = config.MaxAge
+			lsDbEnt.NetworkLsaMap[lsaKey] = lsa
+		}
+	}
+}
@@ -0,0 +1,278 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"l3/ospf/config"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	grTestAreaId     = uint32(0)
+	grTestRtrId      = uint32(0x0a010101)
+	grTestNbrRtrId   = uint32(0x0a010102)
+	grTestOtherRtrId = uint32(0x0a010103)
+	grTestLocalIp    = uint32(0x14010101)
+	grTestNbrIp      = uint32(0x14010102)
+)
+
+func initGracefulRestartTestParams() NeighborConfKey {
+	ospf = getServerObject()
+	ospf.DbLsdbOp = make(chan DbLsdbMsg)
+	ospf.DbEventOp = make(chan DbEventMsg)
+	ospf.ospfGlobalConf.RouterId = []byte{10, 1, 1, 1}
+	ospf.ospfGlobalConf.RestartSupport = config.PlannedAndUnplanned
+	ospf.ospfGlobalConf.RestartStatus = config.NotRestarting
+	ospfIntfToNbrMap = make(map[IntfConfKey]ospfNbrMdata)
+	ospfNeighborRetx_list = make(map[NeighborConfKey][]*ospfNeighborRetx)
+	areaKey := AreaConfKey{
+		AreaId: config.AreaId(convertUint32ToIPv4(grTestAreaId)),
+	}
+	ospf.AreaConfMap[areaKey] = AreaConf{
+		IntfListMap: make(map[IntfConfKey]bool),
+	}
+	ospf.initLSDatabase(grTestAreaId)
+	intfKey := IntfConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(grTestLocalIp)),
+		IntfIdx: 1,
+	}
+	ospf.IntfConfMap[intfKey] = IntfConf{
+		IfAreaId:  convertAreaOrRouterId(convertUint32ToIPv4(grTestAreaId)),
+		IfType:    config.Broadcast,
+		IfIpAddr:  net.ParseIP(convertUint32ToIPv4(grTestLocalIp)),
+		IfNetmask: []byte{255, 255, 255, 0},
+	}
+	nbrKey := NeighborConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(grTestNbrIp)),
+		IntfIdx: 1,
+	}
+	ospf.NeighborConfigMap[nbrKey] = OspfNeighborEntry{
+		OspfNbrRtrId:  grTestNbrRtrId,
+		OspfNbrIPAddr: net.ParseIP(convertUint32ToIPv4(grTestNbrIp)),
+		intfConfKey:   intfKey,
+		OspfNbrState:  config.NbrFull,
+	}
+	go startDummyChannels(ospf)
+	return nbrKey
+}
+
+func getGraceTestLsa(age uint16, reason uint8) []byte {
+	lsaKey := LsaKey{
+		LSType:    LinkOpaqueLSA,
+		LSId:      GraceLsaLinkStateId,
+		AdvRouter: grTestNbrRtrId,
+	}
+	lsa := GraceLsa{
+		GracePeriod:   60,
+		RestartReason: reason,
+		IntfIpAddr:    grTestNbrIp,
+	}
+	lsa.LsaMd.LSAge = age
+	lsa.LsaMd.LSSequenceNum = InitialSequenceNumber
+	return encodeGraceLsa(lsa, lsaKey)
+}
+
+func getRouterTestLsa(links []LinkDetail) RouterLsa {
+	lsa := RouterLsa{
+		NumOfLinks:  uint16(len(links)),
+		LinkDetails: links,
+	}
+	lsa.LsaMd.LSSequenceNum = InitialSequenceNumber
+	lsa.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + 4 + 12*len(links))
+	return lsa
+}
+
+func TestGraceLsaEncodeDecode(t *testing.T) {
+	data := getGraceTestLsa(5, GraceReasonSwUpgrade)
+	if len(data) != OSPF_LSA_HEADER_SIZE+24 {
+		t.Fatal("Unexpected grace LSA length", len(data))
+	}
+	/* trailing bytes past the LSA length are ignored */
+	data = append(data, 0, 0, 0, 0)
+	lsa := NewGraceLsa()
+	lsaKey := NewLsaKey()
+	decodeGraceLsa(data, lsa, lsaKey)
+	if lsaKey.LSType != LinkOpaqueLSA || lsaKey.LSId != GraceLsaLinkStateId ||
+		lsaKey.AdvRouter != grTestNbrRtrId {
+		t.Error("Unexpected grace LSA key", lsaKey)
+	}
+	if lsa.LsaMd.LSAge != 5 || lsa.GracePeriod != 60 ||
+		lsa.RestartReason != GraceReasonSwUpgrade || lsa.IntfIpAddr != grTestNbrIp {
+		t.Error("Unexpected grace LSA", lsa)
+	}
+}
+
+func TestGraceHelper(t *testing.T) {
+	nbrKey := initGracefulRestartTestParams()
+
+	ospf.processRecvdGraceLsa(nbrKey, grTestAreaId, getGraceTestLsa(0, GraceReasonSwRestart))
+	status, age, exitReason := ospf.getGraceHelperState(nbrKey)
+	if status != config.Helping || exitReason != config.InProgress || age == 0 || age > 60 {
+		t.Fatal("Helper mode not entered", status, age, exitReason)
+	}
+
+	/* Refresh of an unchanged LSA keeps helping */
+	otherKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      grTestOtherRtrId,
+		AdvRouter: grTestOtherRtrId,
+	}
+	otherLsa := getRouterTestLsa([]LinkDetail{
+		{
+			LinkId:     0x1e010100,
+			LinkData:   0xffffff00,
+			LinkType:   StubLink,
+			LinkMetric: 10,
+		},
+	})
+	ospf.AreaLsdb[LsdbKey{AreaId: grTestAreaId}].RouterLsaMap[otherKey] = otherLsa
+	otherNbrKey := NeighborConfKey{
+		IPAddr:  "20.1.1.3",
+		IntfIdx: 1,
+	}
+	otherLsa.LsaMd.LSSequenceNum++
+	ospf.graceHelperTopologyCheck(otherNbrKey, grTestAreaId, otherKey, encodeRouterLsa(otherLsa, otherKey))
+	if !ospf.isGraceHelping(nbrKey) {
+		t.Fatal("Helper mode terminated on LSA refresh")
+	}
+
+	otherLsa.LinkDetails[0].LinkMetric = 20
+	ospf.graceHelperTopologyCheck(otherNbrKey, grTestAreaId, otherKey, encodeRouterLsa(otherLsa, otherKey))
+	status, _, exitReason = ospf.getGraceHelperState(nbrKey)
+	if status != config.NotHelping || exitReason != config.TopologyChanged {
+		t.Error("Helper mode not terminated on topology change", status, exitReason)
+	}
+
+	ospf.processRecvdGraceLsa(nbrKey, grTestAreaId, getGraceTestLsa(0, GraceReasonSwRestart))
+	ospf.processRecvdGraceLsa(nbrKey, grTestAreaId, getGraceTestLsa(config.MaxAge, GraceReasonSwRestart))
+	status, _, exitReason = ospf.getGraceHelperState(nbrKey)
+	if status != config.NotHelping || exitReason != config.Completed {
+		t.Error("Helper mode not completed on grace LSA flush", status, exitReason)
+	}
+
+	ospf.ospfGlobalConf.RestartSupport = config.PlannedOnly
+	ospf.processRecvdGraceLsa(nbrKey, grTestAreaId, getGraceTestLsa(0, GraceReasonUnknown))
+	if ospf.isGraceHelping(nbrKey) {
+		t.Error("Helping unplanned restart with planned only support")
+	}
+}
+
+func TestGraceHelperTimeout(t *testing.T) {
+	nbrKey := initGracefulRestartTestParams()
+
+	ospf.processRecvdGraceLsa(nbrKey, grTestAreaId, getGraceTestLsa(0, GraceReasonSwRestart))
+	graceExpiry := ospf.GraceHelperMap[nbrKey].GraceExpiry
+	/* Timer of an earlier grace period */
+	ospf.postGraceEvent(GraceEvent{
+		eventType:   graceHelperTimeout,
+		nbrKey:      nbrKey,
+		graceExpiry: graceExpiry.Add(-time.Second),
+	})
+	ospf.processGraceEvents()
+	if !ospf.isGraceHelping(nbrKey) {
+		t.Fatal("Helper mode terminated by a stale grace timer")
+	}
+
+	ospf.postGraceEvent(GraceEvent{
+		eventType:   graceHelperTimeout,
+		nbrKey:      nbrKey,
+		graceExpiry: graceExpiry,
+	})
+	if !ospf.isGraceHelping(nbrKey) {
+		t.Error("Grace timer processed outside of the main loop")
+	}
+	ospf.processGraceEvents()
+	status, _, exitReason := ospf.getGraceHelperState(nbrKey)
+	if status != config.NotHelping || exitReason != config.TimeedOut {
+		t.Error("Helper mode not terminated on grace period expiry", status, exitReason)
+	}
+	if ospf.GraceHelperMap[nbrKey].graceTimer != nil {
+		t.Error("Grace timer not stopped")
+	}
+	if len(ospf.graceEvents) != 0 {
+		t.Error("Grace events not consumed", ospf.graceEvents)
+	}
+}
+
+func TestGracefulRestartSync(t *testing.T) {
+	nbrKey := initGracefulRestartTestParams()
+	ospf.ospfGlobalConf.RestartStatus = config.PlannedRestart
+	lsdbKey := LsdbKey{
+		AreaId: grTestAreaId,
+	}
+	selfKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      grTestRtrId,
+		AdvRouter: grTestRtrId,
+	}
+	selfLsa := getRouterTestLsa([]LinkDetail{
+		{
+			LinkId:     grTestNbrIp,
+			LinkData:   grTestLocalIp,
+			LinkType:   TransitLink,
+			LinkMetric: 10,
+		},
+	})
+	ospf.AreaLsdb[lsdbKey].RouterLsaMap[selfKey] = selfLsa
+
+	/* Pre-restart router LSA is kept while restarting */
+	ospf.generateRouterLSA(grTestAreaId)
+	if ospf.AreaLsdb[lsdbKey].RouterLsaMap[selfKey].LsaMd.LSSequenceNum != InitialSequenceNumber {
+		t.Error("Router LSA originated during graceful restart")
+	}
+
+	nbrConf := ospf.NeighborConfigMap[nbrKey]
+	nbrConf.OspfNbrState = config.NbrExchange
+	ospf.NeighborConfigMap[nbrKey] = nbrConf
+	if ospf.graceRestartSynced() {
+		t.Error("Restart completed before adjacency is full")
+	}
+	nbrConf.OspfNbrState = config.NbrFull
+	ospf.NeighborConfigMap[nbrKey] = nbrConf
+	if !ospf.graceRestartSynced() {
+		t.Error("Restart not completed with full adjacency")
+	}
+
+	netKey := LsaKey{
+		LSType:    NetworkLSA,
+		LSId:      grTestNbrIp,
+		AdvRouter: grTestNbrRtrId,
+	}
+	ospf.AreaLsdb[lsdbKey].NetworkLsaMap[netKey] = NetworkLsa{
+		Netmask:     0xffffff00,
+		AttachedRtr: []uint32{grTestNbrRtrId, grTestRtrId},
+	}
+	if ospf.graceRestartTopologyChanged() {
+		t.Error("Topology change with consistent network LSA")
+	}
+	ospf.AreaLsdb[lsdbKey].NetworkLsaMap[netKey] = NetworkLsa{
+		Netmask:     0xffffff00,
+		AttachedRtr: []uint32{grTestNbrRtrId},
+	}
+	if !ospf.graceRestartTopologyChanged() {
+		t.Error("Topology change not detected")
+	}
+}
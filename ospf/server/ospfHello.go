@@ -83,7 +83,6 @@ func (server *OSPFServer) BuildHelloPkt(ent IntfConf) []byte {
 		areaId:   ent.IfAreaId,
 		chksum:   0,
 		authType: ent.IfAuthType,
-		//authKey:        ent.IfAuthKey,
 	}
 
 	/*
@@ -96,6 +95,9 @@ func (server *OSPFServer) BuildHelloPkt(ent IntfConf) []byte {
 	           consistent configuration of stub areas, all routers
 	           interfacing to such an area must have the E-bit clear in
 	           their Hello packets
+	   Rfc 3101 2.1
+	           Routers attached to an NSSA set the N-bit and clear the
+	           E-bit in their Hello packets
 	*/
 	if ent.IfAreaId == nil {
 		server.logger.Info(fmt.Sprintln("HELLO: Null area id for intfkey ", ent))
@@ -103,9 +105,15 @@ func (server *OSPFServer) BuildHelloPkt(ent IntfConf) []byte {
 	}
 	areaId := config.AreaId(convertIPInByteToString(ent.IfAreaId))
 	isStub := server.isStubArea(areaId)
+	isNssa := server.isNssaArea(areaId)
 	option := uint8(2)
 	if isStub {
 		option = uint8(0)
+	} else if isNssa {
+		option = uint8(NPOption)
+	}
+	if server.ospfGlobalConf.OpaqueLsaSupport {
+		option |= OOption
 	}
 	helloData := OSPFHelloData{
 		netmask:             ent.IfNetmask,
@@ -144,25 +152,29 @@ func (server *OSPFServer) BuildHelloPkt(ent IntfConf) []byte {
 
 	ospf := append(ospfEncHdr, helloDataNbrEnc...)
 	//server.logger.Info(fmt.Sprintln("ospf:", ospf))
-	csum := computeCheckSum(ospf)
-	binary.BigEndian.PutUint16(ospf[12:14], csum)
-	copy(ospf[16:24], ent.IfAuthKey)
+	ospf = server.encodeOspfAuth(ent, ospf)
+
+	dstIp := net.IP{224, 0, 0, 5}
+	dstMac := net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x05}
+	if ent.IfType == config.VirtualLink {
+		dstMac, dstIp = server.getVirtualLinkDst(ent)
+	}
 
-	ipPktlen := IP_HEADER_MIN_LEN + ospfHdr.pktlen
+	ipPktlen := IP_HEADER_MIN_LEN + len(ospf)
 	ipLayer := layers.IPv4{
 		Version:  uint8(4),
 		IHL:      uint8(IP_HEADER_MIN_LEN),
 		TOS:      uint8(0xc0),
 		Length:   uint16(ipPktlen),
-		TTL:      uint8(1),
+		TTL:      getOspfPktTTL(ent.IfType),
 		Protocol: layers.IPProtocol(OSPF_PROTO_ID),
 		SrcIP:    ent.IfIpAddr,
-		DstIP:    net.IP{224, 0, 0, 5},
+		DstIP:    dstIp,
 	}
 
 	ethLayer := layers.Ethernet{
 		SrcMAC:       ent.IfMacAddr,
-		DstMAC:       net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x05},
+		DstMAC:       dstMac,
 		EthernetType: layers.EthernetTypeIPv4,
 	}
 
@@ -188,8 +200,9 @@ func (server *OSPFServer) processRxHelloPkt(data []byte, ospfHdrMd *OspfHdrMetad
 	}
 	decodeOspfHelloData(data, ospfHelloData)
 
-	//  Todo: Sec 10.5 RFC2328 Need to add check for Virtual links
-	if ent.IfType != config.NumberedP2P || ent.IfType != config.UnnumberedP2P {
+	// Sec 10.5 RFC2328: network mask is not checked on point-to-point and virtual links
+	if ent.IfType != config.NumberedP2P && ent.IfType != config.UnnumberedP2P &&
+		ent.IfType != config.VirtualLink {
 		if bytesEqual(ent.IfNetmask, ospfHelloData.netmask) == false {
 			server.logger.Info(fmt.Sprintln("HELLO: Netmask mismatch. Int mask", ent.IfNetmask, " Hello mask ", ospfHelloData.netmask, " ip ", ipHdrMd.srcIP))
 			err := errors.New("Netmask mismatch")
@@ -197,13 +210,9 @@ func (server *OSPFServer) processRxHelloPkt(data []byte, ospfHdrMd *OspfHdrMetad
 		}
 	}
 
-	if ent.IfHelloInterval != ospfHelloData.helloInterval {
-		err := errors.New("Hello Interval mismatch")
-		return err
-	}
-
-	if ent.IfRtrDeadInterval != ospfHelloData.rtrDeadInterval {
-		err := errors.New("Router Dead Interval mismatch")
+	err := checkHelloIntervals(ent.IfHelloInterval, ent.IfRtrDeadInterval,
+		ospfHelloData.helloInterval, ospfHelloData.rtrDeadInterval)
+	if err != nil {
 		return err
 	}
 
@@ -215,6 +224,14 @@ func (server *OSPFServer) processRxHelloPkt(data []byte, ospfHdrMd *OspfHdrMetad
 		}
 	}
 
+	if ent.IfAreaId != nil {
+		isNssa := server.isNssaArea(config.AreaId(convertIPInByteToString(ent.IfAreaId)))
+		if isNssa != ((ospfHelloData.options & NPOption) != 0) {
+			err := errors.New("NSSA Capability mismatch")
+			return err
+		}
+	}
+
 	//Todo: Find whether one way or two way
 	TwoWayStatus := false
 	/*
@@ -313,30 +330,20 @@ func (server *OSPFServer) processOspfHelloNeighbor(TwoWayStatus bool, ospfHelloD
 		ent.IfType, TwoWayStatus, ospfHelloData.rtrPrio, key)
 
 	var backupSeenMsg BackupSeenMsg
-	if TwoWayStatus == true && ent.IfFSMState == config.Waiting {
-		if bytesEqual(ipHdrMd.srcIP, ospfHelloData.designatedRtr) == true {
-			if bytesEqual(ospfHelloData.backupDesignatedRtr, []byte{0, 0, 0, 0}) == false {
-				ret := ent.WaitTimer.Stop()
-				server.logger.Info("DIE")
-
-				if ret == true {
-					backupSeenMsg.RouterId = routerId
-					backupSeenMsg.DRId = append(backupSeenMsg.DRId, ipHdrMd.srcIP...)
-					backupSeenMsg.BDRId = append(backupSeenMsg.BDRId, ospfHelloData.backupDesignatedRtr...)
-					server.logger.Info("Neigbor choose itself as Designated Router")
-					server.logger.Info("Backup Designated Router also exist")
-					ent.BackupSeenCh <- backupSeenMsg
-				}
-			}
-		} else if bytesEqual(ipHdrMd.srcIP, ospfHelloData.backupDesignatedRtr) == true {
-			ret := ent.WaitTimer.Stop()
-			if ret == true {
-				server.logger.Info("Neigbor choose itself as Backup Designated Router")
-				backupSeenMsg.RouterId = routerId
-				backupSeenMsg.DRId = append(backupSeenMsg.DRId, ospfHelloData.designatedRtr...)
-				backupSeenMsg.BDRId = append(backupSeenMsg.BDRId, ipHdrMd.srcIP...)
-				ent.BackupSeenCh <- backupSeenMsg
-			}
+	nbrCandidate := drCandidate{
+		id:  NbrIP,
+		dr:  getDRIdFromIP(ospfHelloData.designatedRtr),
+		bdr: getDRIdFromIP(ospfHelloData.backupDesignatedRtr),
+	}
+	if TwoWayStatus == true && ent.IfFSMState == config.Waiting && isBackupSeen(nbrCandidate) {
+		ret := ent.WaitTimer.Stop()
+		if ret == true {
+			server.logger.Info(fmt.Sprintln("Backup seen. Neighbor DR", ospfHelloData.designatedRtr,
+				"BDR", ospfHelloData.backupDesignatedRtr))
+			backupSeenMsg.RouterId = routerId
+			backupSeenMsg.DRId = append(backupSeenMsg.DRId, ospfHelloData.designatedRtr...)
+			backupSeenMsg.BDRId = append(backupSeenMsg.BDRId, ospfHelloData.backupDesignatedRtr...)
+			ent.BackupSeenCh <- backupSeenMsg
 		}
 	}
 }
@@ -351,10 +358,11 @@ func (server *OSPFServer) CreateAndSendHelloRecvdMsg(routerId uint32,
 	if ifType == config.Broadcast ||
 		ifType == config.Nbma ||
 		ifType == config.PointToMultipoint ||
-		ifType == config.NumberedP2P {
+		ifType == config.NumberedP2P ||
+		ifType == config.VirtualLink {
 		msg.NeighborIP = net.IPv4(ipHdrMd.srcIP[0], ipHdrMd.srcIP[1], ipHdrMd.srcIP[2], ipHdrMd.srcIP[3])
 		//copy(msg.NeighborIP, ipHdrMd.srcIP)
-	} else { //Check for Virtual Links and unnumbered p2p
+	} else { //Check for unnumbered p2p
 		msg.NeighborIP = net.IPv4(ospfHdrMd.routerId[0], ospfHdrMd.routerId[1], ospfHdrMd.routerId[2], ospfHdrMd.routerId[3])
 		//copy(msg.NeighborIP, ospfHdrMd.routerId)
 	}
@@ -111,6 +111,7 @@ func (server *OSPFServer) BuildOspfInfra() {
 	server.constructPortInfra()
 	server.constructVlanInfra()
 	server.constructL3Infra()
+	server.constructL3v6Infra()
 }
 
 func (server *OSPFServer) constructPortInfra() {
@@ -92,6 +92,9 @@ type IntfConf struct {
 	IfMulticastForwarding config.MulticastForwarding
 	IfDemand              bool
 	IfAuthType            uint16
+	IfAuthCryptoKeys      []IntfAuthKey
+	IfAuthKeyChain        *KeyChain
+	IfAuthState           *IntfAuthState
 	FSMCtrlCh             chan bool
 	FSMCtrlStatusCh       chan bool
 	HelloIntervalTicker   *time.Ticker
@@ -119,6 +122,7 @@ type IntfConf struct {
 	IfMtu          int32
 	IfCost         uint32
 	IfMetricTOSMap map[uint8]uint32 // Key: TOS Value, Value: TOS Metric
+	IfVirtLinkKey  VirtualLinkKey   // Only for virtual links
 }
 
 func (server *OSPFServer) initDefaultIntfConf(key IntfConfKey, ipIntfProp IPIntfProperty, ifType int) {
@@ -167,6 +171,9 @@ func (server *OSPFServer) initDefaultIntfConf(key IntfConfKey, ipIntfProp IPIntf
 		ent.IfMulticastForwarding = config.Blocked
 		ent.IfDemand = false
 		ent.IfAuthType = uint16(config.NoAuth)
+		ent.IfAuthCryptoKeys = nil
+		ent.IfAuthKeyChain = nil
+		ent.IfAuthState = newIntfAuthState()
 		ent.FSMCtrlCh = make(chan bool)
 		ent.FSMCtrlStatusCh = make(chan bool)
 		ent.BackupSeenCh = make(chan BackupSeenMsg)
@@ -388,13 +395,29 @@ func (server *OSPFServer) updateIPIntfConfMap(ifConf config.InterfaceConf) {
 		ent.IfHelloInterval = uint16(ifConf.IfHelloInterval)
 		ent.IfRtrDeadInterval = uint32(ifConf.IfRtrDeadInterval)
 		ent.IfPollInterval = ifConf.IfPollInterval
-		//authKey := convertAuthKey(string(ifConf.IfAuthKey))
-		//if authKey == nil {
-		//	server.logger.Err("Invalid authKey")
-		//	return
-		//}
-		//ent.IfAuthKey = authKey
+		authKey := make([]byte, OSPF_AUTH_KEY_LEN)
+		if ifConf.IfAuthType == config.SimplePassword {
+			authKey = convertSimpleAuthKey(ifConf.IfAuthKey)
+			if authKey == nil {
+				server.logger.Err("Invalid authKey")
+				return
+			}
+		}
+		cryptoKeys, err := convertCryptoAuthKeys(ifConf.IfAuthMd5Keys)
+		if err != nil {
+			server.logger.Err(fmt.Sprintln("Invalid MD5 keys", err))
+			return
+		}
+		ent.IfAuthKey = authKey
 		ent.IfAuthType = uint16(ifConf.IfAuthType)
+		ent.IfAuthCryptoKeys = cryptoKeys
+		ent.IfAuthKeyChain = nil
+		if ifConf.IfAuthKeyChain != "" {
+			ent.IfAuthKeyChain = server.getKeyChain(ifConf.IfAuthKeyChain)
+		}
+		if ent.IfAuthState == nil {
+			ent.IfAuthState = newIntfAuthState()
+		}
 		/* Re initiate the Interface State */
 		ent.IfDRIp = []byte{0, 0, 0, 0}
 		ent.IfBDRIp = []byte{0, 0, 0, 0}
@@ -419,6 +442,16 @@ func (server *OSPFServer) processIntfConfig(ifConf config.InterfaceConf) error {
 		err := errors.New("No such L3 interface exists")
 		return err
 	}
+	if ifConf.IfType == config.VirtualLink || ent.IfType == config.VirtualLink {
+		server.logger.Err(fmt.Sprintln("Virtual links are configured through virtual interfaces", intfConfKey.IPAddr))
+		err := errors.New("Invalid interface type")
+		return err
+	}
+	err := validateIntfAuthConf(ifConf)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("Invalid authentication configuration", intfConfKey.IPAddr, err))
+		return err
+	}
 	if intfConfKey.IPAddr == "0.0.0.0" &&
 		ifConf.IfType == config.NumberedP2P || ifConf.IfType == config.UnnumberedP2P {
 		flag := false
@@ -454,11 +487,18 @@ func (server *OSPFServer) processIntfConfig(ifConf config.InterfaceConf) error {
 }
 
 func (server *OSPFServer) StopSendRecvPkts(intfConfKey IntfConfKey) {
+	ent, _ := server.IntfConfMap[intfConfKey]
+	if ent.IfType == config.VirtualLink && ent.IfFSMState <= config.Down {
+		return
+	}
 	server.logger.Info("Stop Sending Hello Pkt")
 	server.StopOspfIntfFSM(intfConfKey)
-	server.logger.Info("Stop Receiving Hello Pkt")
-	server.StopOspfRecvPkts(intfConfKey)
-	ent, _ := server.IntfConfMap[intfConfKey]
+	// Virtual links receive through the transit interface
+	if ent.IfType != config.VirtualLink {
+		server.logger.Info("Stop Receiving Hello Pkt")
+		server.StopOspfRecvPkts(intfConfKey)
+	}
+	ent, _ = server.IntfConfMap[intfConfKey]
 	ent.NeighborMap = nil
 	ent.IfEvents = ent.IfEvents + 1
 	ent.IfFSMState = config.Down
@@ -467,6 +507,11 @@ func (server *OSPFServer) StopSendRecvPkts(intfConfKey IntfConfKey) {
 
 func (server *OSPFServer) StartSendRecvPkts(intfConfKey IntfConfKey) {
 	ent, _ := server.IntfConfMap[intfConfKey]
+	if ent.IfType == config.VirtualLink &&
+		!server.VirtualLinkMap[ent.IfVirtLinkKey].Reachable {
+		server.logger.Info(fmt.Sprintln("Virtual link is not reachable through transit area", ent.IfName))
+		return
+	}
 	helloInterval := time.Duration(ent.IfHelloInterval) * time.Second
 	ent.HelloIntervalTicker = time.NewTicker(helloInterval)
 	if ent.IfType == config.Broadcast {
@@ -478,14 +523,17 @@ func (server *OSPFServer) StartSendRecvPkts(intfConfKey IntfConfKey) {
 	ent.IfEvents = ent.IfEvents + 1
 	if ent.IfType == config.Broadcast {
 		ent.IfFSMState = config.Waiting
-	} else if ent.IfType == config.NumberedP2P || ent.IfType == config.UnnumberedP2P {
+	} else if ent.IfType == config.NumberedP2P || ent.IfType == config.UnnumberedP2P ||
+		ent.IfType == config.VirtualLink {
 		ent.IfFSMState = config.P2P
 	}
 	server.IntfConfMap[intfConfKey] = ent
 	server.logger.Info("Start Sending Hello Pkt")
 	go server.StartOspfIntfFSM(intfConfKey)
-	server.logger.Info("Start Receiving Hello Pkt")
-	go server.StartOspfRecvPkts(intfConfKey)
+	if ent.IfType != config.VirtualLink {
+		server.logger.Info("Start Receiving Hello Pkt")
+		go server.StartOspfRecvPkts(intfConfKey)
+	}
 }
 
 func (server *OSPFServer) initIntfStateSlice() {
@@ -41,11 +41,16 @@ func (server *OSPFServer) StartOspfIntfFSM(key IntfConfKey) {
 		areaId:  areaId,
 		intfKey: key,
 	}
+	if server.ospfGlobalConf.RestartStatus == config.UnplannedRestart {
+		// RFC 3623 2.1: grace-LSA goes out before the first hello
+		server.sendGraceLsa(key, 0)
+	}
 
 	server.logger.Info("Sending msg for router LSA generation")
 	server.IntfStateChangeCh <- msg
 
-	if ent.IfType == config.NumberedP2P || ent.IfType == config.UnnumberedP2P {
+	if ent.IfType == config.NumberedP2P || ent.IfType == config.UnnumberedP2P ||
+		ent.IfType == config.VirtualLink {
 		server.StartOspfP2PIntfFSM(key)
 	} else if ent.IfType == config.Broadcast {
 		server.StartOspfBroadcastIntfFSM(key)
@@ -173,12 +178,18 @@ func (server *OSPFServer) StartOspfBroadcastIntfFSM(key IntfConfKey) {
 			if exist {
 				server.logger.Info(fmt.Sprintln("Change msg: ", changeMsg, "neighbor entry:", neighborEntry, "neighbor key:", ospfNbrConfKey))
 				//rtrId := changeMsg.RouterId
-				NbrIP := changeMsg.NbrIP
-				oldRtrPrio := neighborEntry.RtrPrio
-				oldDRtr := binary.BigEndian.Uint32(neighborEntry.DRtr)
-				oldBDRtr := binary.BigEndian.Uint32(neighborEntry.BDRtr)
-				newDRtr := binary.BigEndian.Uint32(changeMsg.DRtr)
-				newBDRtr := binary.BigEndian.Uint32(changeMsg.BDRtr)
+				oldCandidate := drCandidate{
+					id:       changeMsg.NbrIP,
+					priority: neighborEntry.RtrPrio,
+					dr:       getDRIdFromIP(neighborEntry.DRtr),
+					bdr:      getDRIdFromIP(neighborEntry.BDRtr),
+				}
+				newCandidate := drCandidate{
+					id:       changeMsg.NbrIP,
+					priority: changeMsg.RtrPrio,
+					dr:       getDRIdFromIP(changeMsg.DRtr),
+					bdr:      getDRIdFromIP(changeMsg.BDRtr),
+				}
 				oldTwoWayStatus := neighborEntry.TwoWayStatus
 				neighborEntry.NbrIP = changeMsg.NbrIP
 				neighborEntry.TwoWayStatus = changeMsg.TwoWayStatus
@@ -190,12 +201,8 @@ func (server *OSPFServer) StartOspfBroadcastIntfFSM(key IntfConfKey) {
 				server.logger.Info(fmt.Sprintln("2 IntfConf neighbor entry", server.IntfConfMap[key].NeighborMap))
 				if ent.IfFSMState > config.Waiting {
 					// RFC2328 Section 9.2 (Neighbor Change Event)
-					if (oldDRtr == NbrIP && newDRtr != NbrIP && oldTwoWayStatus == true) ||
-						(oldDRtr != NbrIP && newDRtr == NbrIP && oldTwoWayStatus == true) ||
-						(oldBDRtr == NbrIP && newBDRtr != NbrIP && oldTwoWayStatus == true) ||
-						(oldBDRtr != NbrIP && newBDRtr == NbrIP && oldTwoWayStatus == true) ||
-						(oldTwoWayStatus != changeMsg.TwoWayStatus) ||
-						(oldRtrPrio != changeMsg.RtrPrio && oldTwoWayStatus == true) {
+					if (oldTwoWayStatus && isDRNeighborChange(oldCandidate, newCandidate)) ||
+						oldTwoWayStatus != changeMsg.TwoWayStatus {
 
 						// Update Neighbor and Re-elect BDR And DR
 						server.ElectBDRAndDR(key)
@@ -284,144 +291,72 @@ func (server *OSPFServer) processNbrFullStateMsg(msg NbrFullStateMsg,
 	}
 }
 
-func (server *OSPFServer) ElectBDR(key IntfConfKey) ([]byte, uint32) {
-	ent, _ := server.IntfConfMap[key]
-	electedBDR := []byte{0, 0, 0, 0}
-	var electedRtrPrio uint8
-	var electedRtrId uint32
-	var MaxRtrPrio uint8
-	var RtrIdWithMaxPrio uint32
-	var NbrIPWithMaxPrio uint32
-
-	for nbrkey, nbrEntry := range ent.NeighborMap {
-		nbrConf := server.NeighborConfigMap[nbrkey]
-		if nbrEntry.TwoWayStatus == true &&
-			nbrEntry.RtrPrio > 0 &&
-			nbrEntry.NbrIP != 0 {
-			tempDR := binary.BigEndian.Uint32(nbrEntry.DRtr)
-			if tempDR == nbrEntry.NbrIP {
-				continue
-			}
-			tempBDR := binary.BigEndian.Uint32(nbrEntry.BDRtr)
-			if tempBDR == nbrEntry.NbrIP {
-				if nbrEntry.RtrPrio > electedRtrPrio {
-					electedRtrPrio = nbrEntry.RtrPrio
-					electedRtrId = nbrConf.OspfNbrRtrId
-					electedBDR = nbrEntry.BDRtr
-				} else if nbrEntry.RtrPrio == electedRtrPrio {
-					if electedRtrId < nbrConf.OspfNbrRtrId {
-						electedRtrPrio = nbrEntry.RtrPrio
-						electedRtrId = nbrConf.OspfNbrRtrId
-						electedBDR = nbrEntry.BDRtr
-					}
-				}
-			}
-			if MaxRtrPrio < nbrEntry.RtrPrio {
-				MaxRtrPrio = nbrEntry.RtrPrio
-				RtrIdWithMaxPrio = nbrConf.OspfNbrRtrId
-				NbrIPWithMaxPrio = nbrEntry.NbrIP
-			} else if MaxRtrPrio == nbrEntry.RtrPrio {
-				if RtrIdWithMaxPrio < nbrConf.OspfNbrRtrId {
-					MaxRtrPrio = nbrEntry.RtrPrio
-					RtrIdWithMaxPrio = nbrConf.OspfNbrRtrId
-					NbrIPWithMaxPrio = nbrEntry.NbrIP
-				}
-			}
-		}
+func getDRIdFromIP(ip []byte) uint32 {
+	if len(ip) != 4 {
+		return 0
 	}
+	return binary.BigEndian.Uint32(ip)
+}
 
-	if ent.IfRtrPriority != 0 &&
-		bytesEqual(ent.IfIpAddr.To4(), []byte{0, 0, 0, 0}) == false {
-		if bytesEqual(ent.IfIpAddr.To4(), ent.IfDRIp) == false {
-			if bytesEqual(ent.IfIpAddr.To4(), ent.IfBDRIp) == true {
-				rtrId := binary.BigEndian.Uint32(server.ospfGlobalConf.RouterId)
-				if ent.IfRtrPriority > electedRtrPrio {
-					electedRtrPrio = ent.IfRtrPriority
-					electedRtrId = rtrId
-					electedBDR = ent.IfIpAddr.To4()
-				} else if ent.IfRtrPriority == electedRtrPrio {
-					if electedRtrId < rtrId {
-						electedRtrPrio = ent.IfRtrPriority
-						electedRtrId = rtrId
-						electedBDR = ent.IfIpAddr.To4()
-					}
-				}
-			}
-
-			tempRtrId := binary.BigEndian.Uint32(server.ospfGlobalConf.RouterId)
-			if MaxRtrPrio < ent.IfRtrPriority {
-				MaxRtrPrio = ent.IfRtrPriority
-				NbrIPWithMaxPrio = binary.BigEndian.Uint32(ent.IfIpAddr.To4())
-				RtrIdWithMaxPrio = tempRtrId
-			} else if MaxRtrPrio == ent.IfRtrPriority {
-				if RtrIdWithMaxPrio < tempRtrId {
-					MaxRtrPrio = ent.IfRtrPriority
-					NbrIPWithMaxPrio = binary.BigEndian.Uint32(ent.IfIpAddr.To4())
-					RtrIdWithMaxPrio = tempRtrId
-				}
-			}
+func getIPFromDRId(id uint32) []byte {
+	ip := make([]byte, 4)
+	binary.BigEndian.PutUint32(ip, id)
+	return ip
+}
 
+/*
+@fn getDRCandidates
+Routers are identified by their interface address on OSPFv2
+networks. The calculating router is not eligible without an
+address.
+*/
+func (server *OSPFServer) getDRCandidates(key IntfConfKey) (drCandidate, []drCandidate) {
+	ent, _ := server.IntfConfMap[key]
+	var candidates []drCandidate
+	for nbrKey, nbrEntry := range ent.NeighborMap {
+		if nbrEntry.TwoWayStatus && nbrEntry.RtrPrio > 0 && nbrEntry.NbrIP != 0 {
+			candidates = append(candidates, drCandidate{
+				id:       nbrEntry.NbrIP,
+				rtrId:    server.NeighborConfigMap[nbrKey].OspfNbrRtrId,
+				priority: nbrEntry.RtrPrio,
+				dr:       getDRIdFromIP(nbrEntry.DRtr),
+				bdr:      getDRIdFromIP(nbrEntry.BDRtr),
+			})
 		}
 	}
-	if bytesEqual(electedBDR, []byte{0, 0, 0, 0}) == true {
-		binary.BigEndian.PutUint32(electedBDR, NbrIPWithMaxPrio)
-		electedRtrId = RtrIdWithMaxPrio
+	self := drCandidate{
+		id:       getDRIdFromIP(ent.IfIpAddr.To4()),
+		rtrId:    binary.BigEndian.Uint32(server.ospfGlobalConf.RouterId),
+		priority: ent.IfRtrPriority,
+		dr:       getDRIdFromIP(ent.IfDRIp),
+		bdr:      getDRIdFromIP(ent.IfBDRIp),
 	}
-
-	return electedBDR, electedRtrId
+	if self.id == 0 {
+		self.priority = 0
+	}
+	return self, candidates
 }
 
-func (server *OSPFServer) ElectDR(key IntfConfKey, electedBDR []byte, electedBDRtrId uint32) ([]byte, uint32) {
-	ent, _ := server.IntfConfMap[key]
-	electedDR := []byte{0, 0, 0, 0}
-	var electedRtrPrio uint8
-	var electedDRtrId uint32
-
-	for key, nbrEntry := range ent.NeighborMap {
-		nbrConf := server.NeighborConfigMap[key]
-		if nbrEntry.TwoWayStatus == true &&
-			nbrEntry.RtrPrio > 0 &&
-			nbrEntry.NbrIP != 0 {
-			tempDR := binary.BigEndian.Uint32(nbrEntry.DRtr)
-			if tempDR == nbrEntry.NbrIP {
-				if nbrEntry.RtrPrio > electedRtrPrio {
-					electedRtrPrio = nbrEntry.RtrPrio
-					electedDRtrId = nbrConf.OspfNbrRtrId
-					electedDR = nbrEntry.DRtr
-				} else if nbrEntry.RtrPrio == electedRtrPrio {
-					if electedDRtrId < nbrConf.OspfNbrRtrId {
-						electedRtrPrio = nbrEntry.RtrPrio
-						electedDRtrId = nbrConf.OspfNbrRtrId
-						electedDR = nbrEntry.DRtr
-					}
-				}
-			}
-		}
+func (server *OSPFServer) ElectBDR(key IntfConfKey) ([]byte, uint32) {
+	self, candidates := server.getDRCandidates(key)
+	if self.priority > 0 {
+		candidates = append(candidates, self)
 	}
+	bdr := electBDR(candidates)
+	return getIPFromDRId(bdr.id), bdr.rtrId
+}
 
-	if ent.IfRtrPriority > 0 &&
-		bytesEqual(ent.IfIpAddr.To4(), []byte{0, 0, 0, 0}) == false {
-		if bytesEqual(ent.IfIpAddr.To4(), ent.IfDRIp) == true {
-			rtrId := binary.BigEndian.Uint32(server.ospfGlobalConf.RouterId)
-			if ent.IfRtrPriority > electedRtrPrio {
-				electedRtrPrio = ent.IfRtrPriority
-				electedDRtrId = rtrId
-				electedDR = ent.IfIpAddr.To4()
-			} else if ent.IfRtrPriority == electedRtrPrio {
-				if electedDRtrId < rtrId {
-					electedRtrPrio = ent.IfRtrPriority
-					electedDRtrId = rtrId
-					electedDR = ent.IfIpAddr.To4()
-				}
-			}
-		}
+func (server *OSPFServer) ElectDR(key IntfConfKey, electedBDR []byte, electedBDRtrId uint32) ([]byte, uint32) {
+	self, candidates := server.getDRCandidates(key)
+	if self.priority > 0 {
+		candidates = append(candidates, self)
 	}
-
-	if bytesEqual(electedDR, []byte{0, 0, 0, 0}) == true {
-		electedDR = electedBDR
-		electedDRtrId = electedBDRtrId
+	bdr := drCandidate{
+		id:    getDRIdFromIP(electedBDR),
+		rtrId: electedBDRtrId,
 	}
-	return electedDR, electedDRtrId
+	dr := electDR(candidates, bdr)
+	return getIPFromDRId(dr.id), dr.rtrId
 }
 
 func (server *OSPFServer) ElectBDRAndDR(key IntfConfKey) {
@@ -430,48 +365,26 @@ func (server *OSPFServer) ElectBDRAndDR(key IntfConfKey) {
 
 	oldDRtrId := ent.IfDRtrId
 	oldBDRtrId := ent.IfBDRtrId
-	//oldBDR := ent.IfBDRIp
 	oldState := ent.IfFSMState
 	var newState config.IfState
 
-	electedBDR, electedBDRtrId := server.ElectBDR(key)
-	ent.IfBDRIp = electedBDR
-	ent.IfBDRtrId = electedBDRtrId
-	electedDR, electedDRtrId := server.ElectDR(key, electedBDR, electedBDRtrId)
-	ent.IfDRIp = electedDR
-	ent.IfDRtrId = electedDRtrId
-	if bytesEqual(ent.IfDRIp, ent.IfIpAddr.To4()) == true {
+	self, candidates := server.getDRCandidates(key)
+	dr, bdr := electDRAndBDR(self, candidates)
+	ent.IfBDRIp = getIPFromDRId(bdr.id)
+	ent.IfBDRtrId = bdr.rtrId
+	ent.IfDRIp = getIPFromDRId(dr.id)
+	ent.IfDRtrId = dr.rtrId
+	if self.id != 0 && dr.id == self.id {
 		newState = config.DesignatedRouter
-	} else if bytesEqual(ent.IfBDRIp, ent.IfIpAddr.To4()) == true {
+	} else if self.id != 0 && bdr.id == self.id {
 		newState = config.BackupDesignatedRouter
 	} else {
 		newState = config.OtherDesignatedRouter
 	}
 
-	server.logger.Info(fmt.Sprintln("1. Election of BDR:", ent.IfBDRIp, " and DR:", ent.IfDRIp, "new State:", newState, "DR Id:", ent.IfDRtrId, "BDR Id:", ent.IfBDRtrId))
+	server.logger.Info(fmt.Sprintln("Election of BDR:", ent.IfBDRIp, " and DR:", ent.IfDRIp, "new State:", newState, "DR Id:", ent.IfDRtrId, "BDR Id:", ent.IfBDRtrId))
 	server.IntfConfMap[key] = ent
 
-	if newState != oldState &&
-		!(newState == config.OtherDesignatedRouter &&
-			oldState < config.OtherDesignatedRouter) {
-		ent, _ = server.IntfConfMap[key]
-		electedBDR, electedBDRtrId = server.ElectBDR(key)
-		ent.IfBDRIp = electedBDR
-		ent.IfBDRtrId = electedBDRtrId
-		electedDR, electedDRtrId = server.ElectDR(key, electedBDR, electedBDRtrId)
-		ent.IfDRIp = electedDR
-		ent.IfDRtrId = electedDRtrId
-		if bytesEqual(ent.IfDRIp, ent.IfIpAddr.To4()) == true {
-			newState = config.DesignatedRouter
-		} else if bytesEqual(ent.IfBDRIp, ent.IfIpAddr.To4()) == true {
-			newState = config.BackupDesignatedRouter
-		} else {
-			newState = config.OtherDesignatedRouter
-		}
-		server.logger.Info(fmt.Sprintln("2. Election of BDR:", ent.IfBDRIp, " and DR:", ent.IfDRIp, "new State:", newState, "DR Id:", ent.IfDRtrId, "BDR Id:", ent.IfBDRtrId))
-		server.IntfConfMap[key] = ent
-	}
-
 	server.createAndSendEventsIntfFSM(key, oldState, newState, oldDRtrId, oldBDRtrId)
 }
 
@@ -0,0 +1,250 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"l3/ospf/config"
+	"ospfd"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* RFC 5709 3.3: Apad is 0x878FE1F3 repeated to the length of the hash */
+var OSPF_HMAC_APAD = []byte{0x87, 0x8f, 0xe1, 0xf3}
+
+var HmacShaHashMap = map[string]func() hash.Hash{
+	config.HmacSha1:   sha1.New,
+	config.HmacSha256: sha256.New,
+	config.HmacSha384: sha512.New384,
+	config.HmacSha512: sha512.New,
+}
+
+type KeyChain struct {
+	Name     string
+	keyMutex sync.RWMutex
+	keys     []config.KeyChainKey
+}
+
+func newKeyChain(name string) *KeyChain {
+	return &KeyChain{
+		Name: name,
+		keys: make([]config.KeyChainKey, 0),
+	}
+}
+
+func (keyChain *KeyChain) setKeys(keys []config.KeyChainKey) {
+	keyChain.keyMutex.Lock()
+	defer keyChain.keyMutex.Unlock()
+	keyChain.keys = make([]config.KeyChainKey, len(keys))
+	copy(keyChain.keys, keys)
+}
+
+/* A zero start or end time leaves the lifetime open on that side */
+func isKeyLifetimeActive(start time.Time, end time.Time, now time.Time) bool {
+	if !start.IsZero() && now.Before(start) {
+		return false
+	}
+	if !end.IsZero() && !now.Before(end) {
+		return false
+	}
+	return true
+}
+
+/*
+The key with the most recent send lifetime start is used to send packets,
+the highest key id is used if more than one key started at the same time.
+*/
+func (keyChain *KeyChain) getSendKey(now time.Time) (key config.KeyChainKey, found bool) {
+	keyChain.keyMutex.RLock()
+	defer keyChain.keyMutex.RUnlock()
+	for _, chainKey := range keyChain.keys {
+		if !isKeyLifetimeActive(chainKey.SendLifetimeStart, chainKey.SendLifetimeEnd, now) {
+			continue
+		}
+		if !found || chainKey.SendLifetimeStart.After(key.SendLifetimeStart) ||
+			(chainKey.SendLifetimeStart.Equal(key.SendLifetimeStart) && chainKey.KeyId > key.KeyId) {
+			key = chainKey
+			found = true
+		}
+	}
+	return key, found
+}
+
+func (keyChain *KeyChain) getAcceptKey(keyId uint8, now time.Time) (key config.KeyChainKey, found bool) {
+	keyChain.keyMutex.RLock()
+	defer keyChain.keyMutex.RUnlock()
+	for _, chainKey := range keyChain.keys {
+		if chainKey.KeyId == keyId &&
+			isKeyLifetimeActive(chainKey.AcceptLifetimeStart, chainKey.AcceptLifetimeEnd, now) {
+			return chainKey, true
+		}
+	}
+	return key, false
+}
+
+func getHmacShaDigestLen(algorithm string) int {
+	hashFunc, exist := HmacShaHashMap[algorithm]
+	if !exist {
+		return 0
+	}
+	return hashFunc().Size()
+}
+
+func GetHmacShaApad(digestLen int) []byte {
+	apad := make([]byte, digestLen)
+	for idx := 0; idx < digestLen; idx += len(OSPF_HMAC_APAD) {
+		copy(apad[idx:], OSPF_HMAC_APAD)
+	}
+	return apad
+}
+
+/*
+RFC 5709 3.3: The key is padded with zeros to the hash length or hashed when
+it is longer. The data is the ospf packet with its authentication fields
+filled and followed by Apad.
+*/
+func ComputeHmacShaDigest(algorithm string, key []byte, data []byte) []byte {
+	hashFunc, exist := HmacShaHashMap[algorithm]
+	if !exist {
+		return nil
+	}
+	digestLen := hashFunc().Size()
+	authKey := make([]byte, digestLen)
+	if len(key) > digestLen {
+		keyHash := hashFunc()
+		keyHash.Write(key)
+		authKey = keyHash.Sum(nil)
+	} else {
+		copy(authKey, key)
+	}
+
+	mac := hmac.New(hashFunc, authKey)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func validateKeyChainKey(key config.KeyChainKey) error {
+	if _, exist := HmacShaHashMap[key.Algorithm]; !exist {
+		return errors.New(fmt.Sprintln("Invalid authentication algorithm", key.Algorithm, "for key id", key.KeyId))
+	}
+	if len(key.Key) == 0 {
+		return errors.New(fmt.Sprintln("Empty authentication key for key id", key.KeyId))
+	}
+	if !key.SendLifetimeEnd.IsZero() && !key.SendLifetimeEnd.After(key.SendLifetimeStart) {
+		return errors.New(fmt.Sprintln("Invalid send lifetime for key id", key.KeyId))
+	}
+	if !key.AcceptLifetimeEnd.IsZero() && !key.AcceptLifetimeEnd.After(key.AcceptLifetimeStart) {
+		return errors.New(fmt.Sprintln("Invalid accept lifetime for key id", key.KeyId))
+	}
+	return nil
+}
+
+func convertKeyLifetime(lifetime string) (time.Time, error) {
+	if strings.TrimSpace(lifetime) == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(lifetime))
+}
+
+func ConvertOspfKeyChain(conf *ospfd.OspfKeyChain) (keyChain config.KeyChainConf, err error) {
+	keyChain.Name = conf.Name
+	keyIdMap := make(map[uint8]bool)
+	for _, confKey := range conf.Keys {
+		if confKey.KeyId < 0 || confKey.KeyId > 255 {
+			return keyChain, errors.New(fmt.Sprintln("Invalid key id", confKey.KeyId))
+		}
+		key := config.KeyChainKey{
+			KeyId:     uint8(confKey.KeyId),
+			Algorithm: strings.ToLower(confKey.Algorithm),
+			Key:       confKey.Key,
+		}
+		if keyIdMap[key.KeyId] {
+			return keyChain, errors.New(fmt.Sprintln("Duplicate key id", key.KeyId))
+		}
+		keyIdMap[key.KeyId] = true
+
+		lifetimes := []*time.Time{&key.SendLifetimeStart, &key.SendLifetimeEnd,
+			&key.AcceptLifetimeStart, &key.AcceptLifetimeEnd}
+		for idx, lifetime := range []string{confKey.SendLifetimeStart, confKey.SendLifetimeEnd,
+			confKey.AcceptLifetimeStart, confKey.AcceptLifetimeEnd} {
+			*lifetimes[idx], err = convertKeyLifetime(lifetime)
+			if err != nil {
+				return keyChain, errors.New(fmt.Sprintln("Invalid lifetime", lifetime, "for key id", key.KeyId))
+			}
+		}
+
+		err = validateKeyChainKey(key)
+		if err != nil {
+			return keyChain, err
+		}
+		keyChain.Keys = append(keyChain.Keys, key)
+	}
+	return keyChain, nil
+}
+
+/* Key chains can be referenced before they are configured */
+func (server *OSPFServer) getKeyChain(name string) *KeyChain {
+	keyChain, exist := server.KeyChainMap[name]
+	if !exist {
+		keyChain = newKeyChain(name)
+		server.KeyChainMap[name] = keyChain
+	}
+	return keyChain
+}
+
+func (server *OSPFServer) processKeyChainConfig(keyChainConf config.KeyChainConf) error {
+	for _, key := range keyChainConf.Keys {
+		err := validateKeyChainKey(key)
+		if err != nil {
+			server.logger.Err(fmt.Sprintln("Invalid key chain", keyChainConf.Name, err))
+			return err
+		}
+	}
+	keyChain := server.getKeyChain(keyChainConf.Name)
+	keyChain.setKeys(keyChainConf.Keys)
+	server.logger.Info(fmt.Sprintln("Key chain", keyChainConf.Name, "updated with", len(keyChainConf.Keys), "keys"))
+	return nil
+}
+
+/*
+The key chain object is kept as interfaces and areas may still refer to it,
+packets on them can not be authenticated until the key chain is configured
+again.
+*/
+func (server *OSPFServer) processKeyChainDelete(name string) {
+	keyChain, exist := server.KeyChainMap[name]
+	if !exist {
+		return
+	}
+	keyChain.setKeys(nil)
+	server.logger.Info(fmt.Sprintln("Key chain", name, "deleted"))
+}
@@ -188,11 +188,9 @@ func (server *OSPFServer) EncodeLSAReqPkt(intfKey IntfConfKey, ent IntfConf,
 
 	ospf := append(ospfEncHdr, lsaDataEnc...)
 	server.logger.Info(fmt.Sprintln("OSPF LSA REQ:", ospf))
-	csum := computeCheckSum(ospf)
-	binary.BigEndian.PutUint16(ospf[12:14], csum)
-	copy(ospf[16:24], ent.IfAuthKey)
+	ospf = server.encodeOspfAuth(ent, ospf)
 
-	ipPktlen := IP_HEADER_MIN_LEN + ospfHdr.pktlen
+	ipPktlen := IP_HEADER_MIN_LEN + len(ospf)
 	var dstIp net.IP
 	if ent.IfType == config.NumberedP2P {
 		dstIp = net.ParseIP(config.AllSPFRouters)
@@ -205,7 +203,7 @@ func (server *OSPFServer) EncodeLSAReqPkt(intfKey IntfConfKey, ent IntfConf,
 		IHL:      uint8(IP_HEADER_MIN_LEN),
 		TOS:      uint8(0xc0),
 		Length:   uint16(ipPktlen),
-		TTL:      uint8(1),
+		TTL:      getOspfPktTTL(ent.IfType),
 		Protocol: layers.IPProtocol(OSPF_PROTO_ID),
 		SrcIP:    ent.IfIpAddr,
 		DstIP:    dstIp,
@@ -325,7 +323,6 @@ func (server *OSPFServer) BuildLsaUpdPkt(intfKey IntfConfKey, ent IntfConf,
 		areaId:   ent.IfAreaId,
 		chksum:   0,
 		authType: ent.IfAuthType,
-		//authKey:        ent.IfAuthKey,
 	}
 
 	ospfPktlen := OSPF_HEADER_SIZE
@@ -340,22 +337,22 @@ func (server *OSPFServer) BuildLsaUpdPkt(intfKey IntfConfKey, ent IntfConf,
 
 	ospf := append(ospfEncHdr, lsaUpdEnc...)
 	//server.logger.Info(fmt.Sprintln("OSPF LSA UPD:", ospf))
-	csum := computeCheckSum(ospf)
-	binary.BigEndian.PutUint16(ospf[12:14], csum)
-	copy(ospf[16:24], ent.IfAuthKey)
+	ospf = server.encodeOspfAuth(ent, ospf)
 
 	if ent.IfType == config.NumberedP2P {
 		dstIp = net.ParseIP(config.AllSPFRouters)
 		dstMAC, _ = net.ParseMAC(config.McastMAC)
+	} else if ent.IfType == config.VirtualLink {
+		dstMAC, dstIp = server.getVirtualLinkDst(ent)
 	}
 
-	ipPktlen := IP_HEADER_MIN_LEN + ospfHdr.pktlen
+	ipPktlen := IP_HEADER_MIN_LEN + len(ospf)
 	ipLayer := layers.IPv4{
 		Version:  uint8(4),
 		IHL:      uint8(IP_HEADER_MIN_LEN),
 		TOS:      uint8(0xc0),
 		Length:   uint16(ipPktlen),
-		TTL:      uint8(1),
+		TTL:      getOspfPktTTL(ent.IfType),
 		Protocol: layers.IPProtocol(OSPF_PROTO_ID),
 		SrcIP:    ent.IfIpAddr,
 		DstIP:    dstIp,
@@ -495,6 +492,28 @@ func (server *OSPFServer) DecodeLSAUpd(msg ospfNeighborLSAUpdMsg) {
 			dalsa, ret := server.getASExternalLsaFromLsdb(msg.areaId, *lsa_key)
 			discard, op = server.sanityCheckASExternalLsa(*alsa, dalsa, nbr, intf, intf.IfAreaId, ret, lsa_max_age)
 
+		case NSSALSA:
+			nlsa := NewASExternalLsa()
+			decodeASExternalLsa(lsdb_msg.Data, nlsa, lsa_key)
+			dnlsa, ret := server.getNSSALsaFromLsdb(msg.areaId, *lsa_key)
+			discard, op = server.sanityCheckNssaLsa(*nlsa, dnlsa, nbr, intf, intf.IfAreaId, ret, lsa_max_age)
+
+		case LinkOpaqueLSA, AreaOpaqueLSA, ASOpaqueLSA:
+			olsa := NewOpaqueLsa()
+			decodeOpaqueLsa(lsdb_msg.Data, olsa, lsa_key)
+			dolsa, ret := server.getOpaqueLsaFromLsdb(msg.areaId, nbr.intfConfKey, *lsa_key)
+			discard, op = server.sanityCheckOpaqueLsa(*lsa_key, *olsa, dolsa, nbr, intf, ret, lsa_max_age)
+			lsdb_msg.IntfKey = nbr.intfConfKey
+		}
+		if !discard && op == FloodLsa && !server.lsaArrivalCheck(msg.areaId, *lsa_key) {
+			// RFC 2328 13 (5a): discard without acknowledging
+			server.logger.Info(fmt.Sprintln("LSAUPD: Discard. Received within MinLSArrival ", lsa_key))
+			index = end_index
+			server.UpdateNeighborList(msg.nbrKey)
+			continue
+		}
+		if !discard && op == FloodLsa && !isOpaqueLsa(lsa_header.LSType) {
+			server.graceHelperTopologyCheck(msg.nbrKey, msg.areaId, *lsa_key, lsdb_msg.Data)
 		}
 		lsid := convertUint32ToIPv4(lsa_header.LinkId)
 		router_id := convertUint32ToIPv4(lsa_header.Adv_router)
@@ -505,8 +524,12 @@ func (server *OSPFServer) DecodeLSAUpd(msg ospfNeighborLSAUpdMsg) {
 			server.logger.Info(fmt.Sprintln("LSAUPD: discard . Received self generated. ", lsa_key))
 
 		}
+		if !discard && !self_gen && isOpaqueLsa(lsa_header.LSType) {
+			server.notifyOpaqueLsaApp(msg.nbrKey, msg.areaId, nbr.intfConfKey, lsdb_msg.Data)
+		}
 
-		if !discard && !self_gen && op == FloodLsa {
+		// while restarting, pre-restart self LSAs are learnt back from the neighbors
+		if !discard && (!self_gen || server.isGracefulRestarting()) && op == FloodLsa {
 			server.logger.Info(fmt.Sprintln("LSAUPD: add to lsdb lsid ", lsid, " router_id ", router_id, " lstype ", lsa_header.LSType))
 			lsdb_msg.MsgType = LsdbAdd
 			server.LsdbUpdateCh <- *lsdb_msg
@@ -522,7 +545,11 @@ func (server *OSPFServer) DecodeLSAUpd(msg ospfNeighborLSAUpdMsg) {
 		}
 		flood_pkt.pkt = make([]byte, end_index-index)
 		copy(flood_pkt.pkt, lsdb_msg.Data)
-		if lsop != LSASUMMARYFLOOD && !self_gen { // for ABR summary lsa is flooded after LSDB/SPF changes are done.
+		if isOpaqueLsa(lsa_header.LSType) {
+			flood_pkt.lsOp = LSAOPAQUEFLOOD
+			flood_pkt.intfKey = nbr.intfConfKey
+		}
+		if lsop != LSASUMMARYFLOOD && !self_gen && (!isOpaqueLsa(lsa_header.LSType) || !discard) { // for ABR summary lsa is flooded after LSDB/SPF changes are done.
 			server.ospfNbrLsaUpdSendCh <- flood_pkt
 		}
 
@@ -593,7 +620,6 @@ func (server *OSPFServer) sanityCheckRouterLsa(rlsa RouterLsa, drlsa RouterLsa,
 		return discard, op
 	} else {
 		isNew := server.validateLsaIsNew(rlsa.LsaMd, drlsa.LsaMd)
-		// TODO check if lsa is installed before MinLSArrival
 		if isNew {
 			op = FloodLsa
 			discard = false
@@ -665,7 +691,11 @@ func (server *OSPFServer) sanityCheckSummaryLsa(slsa SummaryLsa, dslsa SummaryLs
 func (server *OSPFServer) sanityCheckASExternalLsa(alsa ASExternalLsa, dalsa ASExternalLsa, nbr OspfNeighborEntry, intf IntfConf, areaid []byte, exist int, lsa_max_age bool) (discard bool, op uint8) {
 	discard = false
 	op = LsdbAdd
-	// TODO Reject this lsa if area is configured as stub area.
+	areaId := config.AreaId(convertIPInByteToString(areaid))
+	if server.isStubArea(areaId) || server.isNssaArea(areaId) {
+		server.logger.Info(fmt.Sprintln("LSAUPD: As external LSA Discard. Area doesnt accept external LSA ", areaId))
+		return true, LsdbNoAction
+	}
 	send_ack := server.lsAgeCheck(nbr.intfConfKey, lsa_max_age, exist)
 	if send_ack {
 		op = LsdbNoAction
@@ -685,6 +715,33 @@ func (server *OSPFServer) sanityCheckASExternalLsa(alsa ASExternalLsa, dalsa ASE
 	return discard, op
 }
 
+func (server *OSPFServer) sanityCheckNssaLsa(nlsa ASExternalLsa, dnlsa ASExternalLsa, nbr OspfNeighborEntry, intf IntfConf, areaid []byte, exist int, lsa_max_age bool) (discard bool, op uint8) {
+	discard = false
+	op = LsdbAdd
+	areaId := config.AreaId(convertIPInByteToString(areaid))
+	if !server.isNssaArea(areaId) {
+		server.logger.Info(fmt.Sprintln("LSAUPD: NSSA LSA Discard. Area is not NSSA ", areaId))
+		return true, LsdbNoAction
+	}
+	send_ack := server.lsAgeCheck(nbr.intfConfKey, lsa_max_age, exist)
+	if send_ack {
+		op = LsdbNoAction
+		discard = true
+		server.logger.Info(fmt.Sprintln("LSAUPD: NSSA LSA Discard.", " nbr ", nbr))
+		return discard, op
+	} else {
+		isNew := server.validateLsaIsNew(nlsa.LsaMd, dnlsa.LsaMd)
+		if isNew {
+			op = FloodLsa
+			discard = false
+		} else {
+			discard = true
+			op = LsdbNoAction
+		}
+	}
+	return discard, op
+}
+
 func validateChecksum(data []byte) bool {
 
 	csum := computeFletcherChecksum(data[2:], FLETCHER_CHECKSUM_VALIDATE)
@@ -770,21 +827,21 @@ func (server *OSPFServer) BuildLSAAckPkt(intfKey IntfConfKey, ent IntfConf,
 
 	ospf := append(ospfEncHdr, lsaAckEnc...)
 	//server.logger.Info(fmt.Sprintln("OSPF LSA ACK:", ospf))
-	csum := computeCheckSum(ospf)
-	binary.BigEndian.PutUint16(ospf[12:14], csum)
-	copy(ospf[16:24], ent.IfAuthKey)
+	ospf = server.encodeOspfAuth(ent, ospf)
 
-	ipPktlen := IP_HEADER_MIN_LEN + ospfHdr.pktlen
+	ipPktlen := IP_HEADER_MIN_LEN + len(ospf)
 	if ent.IfType == config.NumberedP2P {
 		dstIp = net.ParseIP(config.AllSPFRouters)
 		dstMAC, _ = net.ParseMAC(config.McastMAC)
+	} else if ent.IfType == config.VirtualLink {
+		dstMAC, dstIp = server.getVirtualLinkDst(ent)
 	}
 	ipLayer := layers.IPv4{
 		Version:  uint8(4),
 		IHL:      uint8(IP_HEADER_MIN_LEN),
 		TOS:      uint8(0xc0),
 		Length:   uint16(ipPktlen),
-		TTL:      uint8(1),
+		TTL:      getOspfPktTTL(ent.IfType),
 		Protocol: layers.IPProtocol(OSPF_PROTO_ID),
 		SrcIP:    ent.IfIpAddr,
 		DstIP:    dstIp,
@@ -999,6 +1056,24 @@ func (server *OSPFServer) generateLsaUpdUnicast(req ospfLSAReq, nbrKey NeighborC
 			server.logger.Info(fmt.Sprintln("LSAREQ: AS external lsa not fount. lsaid ",
 				req.link_state_id, " lstype ", lsa_key.LSType, " adv_router ", lsa_key.AdvRouter, " areaid ", areaid))
 		}
+	case NSSALSA:
+		dnlsa, ret := server.getNSSALsaFromLsdb(areaid, *lsa_key)
+		if ret == LsdbEntryFound {
+			lsa_pkt = encodeASExternalLsa(dnlsa, *lsa_key)
+			flood = true
+		} else {
+			server.logger.Info(fmt.Sprintln("LSAREQ: NSSA lsa not found. lsaid ",
+				req.link_state_id, " lstype ", lsa_key.LSType, " adv_router ", lsa_key.AdvRouter, " areaid ", areaid))
+		}
+	case LinkOpaqueLSA, AreaOpaqueLSA, ASOpaqueLSA:
+		dolsa, ret := server.getOpaqueLsaFromLsdb(areaid, nbrConf.intfConfKey, *lsa_key)
+		if ret == LsdbEntryFound {
+			lsa_pkt = encodeOpaqueLsa(dolsa, *lsa_key)
+			flood = true
+		} else {
+			server.logger.Info(fmt.Sprintln("LSAREQ: Opaque lsa not found. lsaid ",
+				req.link_state_id, " lstype ", lsa_key.LSType, " adv_router ", lsa_key.AdvRouter, " areaid ", areaid))
+		}
 	}
 	lsid := convertUint32ToIPv4(req.link_state_id)
 	router_id := convertUint32ToIPv4(req.adv_router_id)
@@ -1096,6 +1171,16 @@ func (server *OSPFServer) lsaAddCheck(lsaheader ospfLSAHeader,
 		dalsa, ret := server.getASExternalLsaFromLsdb(areaId, *lsa_key)
 		discard, op = server.sanityCheckASExternalLsa(*alsa, dalsa, nbr, intf, intf.IfAreaId, ret, lsa_max_age)
 
+	case NSSALSA:
+		nlsa := NewASExternalLsa()
+		dnlsa, ret := server.getNSSALsaFromLsdb(areaId, *lsa_key)
+		discard, op = server.sanityCheckNssaLsa(*nlsa, dnlsa, nbr, intf, intf.IfAreaId, ret, lsa_max_age)
+
+	case LinkOpaqueLSA, AreaOpaqueLSA, ASOpaqueLSA:
+		olsa := NewOpaqueLsa()
+		dolsa, ret := server.getOpaqueLsaFromLsdb(areaId, nbr.intfConfKey, *lsa_key)
+		discard, op = server.sanityCheckOpaqueLsa(*lsa_key, *olsa, dolsa, nbr, intf, ret, lsa_max_age)
+
 	}
 	if discard {
 		server.logger.Info(fmt.Sprintln("DBD: LSA is not added in the request list. Adv router ", adv_router,
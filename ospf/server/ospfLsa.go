@@ -35,6 +35,10 @@ const (
 	Summary3LSA   uint8 = 3
 	Summary4LSA   uint8 = 4
 	ASExternalLSA uint8 = 5
+	NSSALSA       uint8 = 7
+	LinkOpaqueLSA uint8 = 9
+	AreaOpaqueLSA uint8 = 10
+	ASOpaqueLSA   uint8 = 11
 )
 
 type LsaKey struct {
@@ -87,6 +91,7 @@ func NewLsaHeader() *LsaHeader {
 /* LS Type 1 */
 type RouterLsa struct {
 	LsaMd       LsaMetadata
+	BitNt       bool         /* Nt Bit */
 	BitV        bool         /* V Bit */
 	BitE        bool         /* Bit E */
 	BitB        bool         /* Bit B */
@@ -134,7 +139,7 @@ type ASExtTOSDetail struct {
 	TOSExtRouteTag uint32
 }
 
-/* LS Type 5 */
+/* LS Type 5, also used for LS Type 7 */
 type ASExternalLsa struct {
 	LsaMd           LsaMetadata
 	Netmask         uint32 /* Network Mask */
@@ -155,6 +160,8 @@ type LSDatabase struct {
 	Summary3LsaMap   map[LsaKey]SummaryLsa
 	Summary4LsaMap   map[LsaKey]SummaryLsa
 	ASExternalLsaMap map[LsaKey]ASExternalLsa
+	NSSALsaMap       map[LsaKey]ASExternalLsa /* LS Type 7, RFC 3101 */
+	OpaqueLsaMap     map[LsaKey]OpaqueLsa     /* LS Type 10 and 11, RFC 5250 */
 }
 
 type maxAgeLsaMsg struct {
@@ -260,6 +267,11 @@ func decodeRouterLsa(data []byte, lsa *RouterLsa, lsakey *LsaKey) {
 	lsa.LsaMd.LSSequenceNum = int(binary.BigEndian.Uint32(data[12:16]))
 	lsa.LsaMd.LSChecksum = binary.BigEndian.Uint16(data[16:18])
 	lsa.LsaMd.LSLen = binary.BigEndian.Uint16(data[18:20])
+	if data[20]&0x10 != 0 {
+		lsa.BitNt = true
+	} else {
+		lsa.BitNt = false
+	}
 	if data[20]&0x04 != 0 {
 		lsa.BitV = true
 	} else {
@@ -332,6 +344,9 @@ func encodeRouterLsa(lsa RouterLsa, lsakey LsaKey) []byte {
 	lsaHdr := encodeLsaHeader(lsa.LsaMd, lsakey)
 	copy(rtrLsa[0:20], lsaHdr)
 	var val uint8 = 0
+	if lsa.BitNt == true {
+		val = val | 1<<4
+	}
 	if lsa.BitV == true {
 		val = val | 1<<2
 	}
@@ -668,6 +683,18 @@ func (server *OSPFServer) getASExternalLsaFromLsdb(areaId uint32, lsaKey LsaKey)
 	return lsa, LsdbEntryFound
 }
 
+func (server *OSPFServer) getNSSALsaFromLsdb(areaId uint32, lsaKey LsaKey) (lsa ASExternalLsa, retVal int) {
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, _ := server.AreaLsdb[lsdbKey]
+	lsa, exist := lsDbEnt.NSSALsaMap[lsaKey]
+	if !exist {
+		return lsa, LsdbEntryNotFound
+	}
+	return lsa, LsdbEntryFound
+}
+
 func (server *OSPFServer) processMaxAgeLSA(lsdbKey LsdbKey, lsdbEnt LSDatabase) {
 	flood_lsa := false
 	/* Router LSA */
@@ -683,6 +710,7 @@ func (server *OSPFServer) processMaxAgeLSA(lsdbKey LsdbKey, lsdbEnt LSDatabase)
 			server.logger.Info(fmt.Sprintln("DELETE: Max age reached. adv_router ",
 				advRouter, " lstype ", lsakey.LSType, " lsid ", lsid))
 			delete(lsdbEnt.RouterLsaMap, lsakey)
+			server.markLsaExportDirty(lsdbKey.AreaId, lsakey)
 			flood_lsa = true
 		} else {
 			lsa.LsaMd.LSAge++
@@ -697,6 +725,7 @@ func (server *OSPFServer) processMaxAgeLSA(lsdbKey LsdbKey, lsdbEnt LSDatabase)
 			maxAgeLsaMap[lsakey] = lsa_pkt
 			// delete LSA
 			delete(lsdbEnt.NetworkLsaMap, lsakey)
+			server.markLsaExportDirty(lsdbKey.AreaId, lsakey)
 			advRouter := convertUint32ToIPv4(lsakey.AdvRouter)
 			lsid := convertUint32ToIPv4(lsakey.LSId)
 			server.logger.Info(fmt.Sprintln("DELETE: Max age reached. adv_router ",
@@ -727,6 +756,25 @@ func (server *OSPFServer) processMaxAgeLSA(lsdbKey LsdbKey, lsdbEnt LSDatabase)
 			lsdbEnt.ASExternalLsaMap[lsakey] = lsa_ex
 		}
 	}
+	/* NSSA LSA */
+	for lsakey, lsa_nssa := range lsdbEnt.NSSALsaMap {
+		if lsa_nssa.LsaMd.LSAge == config.MaxAge {
+			// add to flood list
+			lsa_pkt := encodeASExternalLsa(lsa_nssa, lsakey)
+			maxAgeLsaMap[lsakey] = lsa_pkt
+			// delete LSA
+			delete(lsdbEnt.NSSALsaMap, lsakey)
+			advRouter := convertUint32ToIPv4(lsakey.AdvRouter)
+			lsid := convertUint32ToIPv4(lsakey.LSId)
+			server.logger.Info(fmt.Sprintln("DELETE: Max age reached. adv_router ",
+				advRouter, " lstype ", lsakey.LSType, " lsid ", lsid))
+			flood_lsa = true
+
+		} else {
+			lsa_nssa.LsaMd.LSAge++
+			lsdbEnt.NSSALsaMap[lsakey] = lsa_nssa
+		}
+	}
 	/* Summary 3 */
 	for lsakey, lsa_sum := range lsdbEnt.Summary3LsaMap {
 		if lsa_sum.LsaMd.LSAge == config.MaxAge {
@@ -764,6 +812,25 @@ func (server *OSPFServer) processMaxAgeLSA(lsdbKey LsdbKey, lsdbEnt LSDatabase)
 			lsdbEnt.Summary4LsaMap[lsakey] = lsa_sum4
 		}
 	}
+	/* Area and AS opaque LSA */
+	for lsakey, lsa_opaque := range lsdbEnt.OpaqueLsaMap {
+		if lsa_opaque.LsaMd.LSAge == config.MaxAge {
+			// add to flood list
+			lsa_pkt := encodeOpaqueLsa(lsa_opaque, lsakey)
+			maxAgeLsaMap[lsakey] = lsa_pkt
+			// delete LSA
+			delete(lsdbEnt.OpaqueLsaMap, lsakey)
+			advRouter := convertUint32ToIPv4(lsakey.AdvRouter)
+			lsid := convertUint32ToIPv4(lsakey.LSId)
+			server.logger.Info(fmt.Sprintln("DELETE: Max age reached. adv_router ",
+				advRouter, " lstype ", lsakey.LSType, " lsid ", lsid))
+			flood_lsa = true
+
+		} else {
+			lsa_opaque.LsaMd.LSAge++
+			lsdbEnt.OpaqueLsaMap[lsakey] = lsa_opaque
+		}
+	}
 	if flood_lsa {
 		/* send msg to ospfNbrLsaUpdSendCh */
 		flood_pkt := ospfFloodMsg{
@@ -33,6 +33,7 @@ import (
 type LsdbUpdateMsg struct {
 	MsgType uint8
 	AreaId  uint32
+	IntfKey IntfConfKey /* receiving interface for link local LSAs */
 	Data    []byte
 }
 
@@ -85,6 +86,8 @@ func (server *OSPFServer) initLSDatabase(areaId uint32) {
 		lsDbEnt.Summary3LsaMap = make(map[LsaKey]SummaryLsa)
 		lsDbEnt.Summary4LsaMap = make(map[LsaKey]SummaryLsa)
 		lsDbEnt.ASExternalLsaMap = make(map[LsaKey]ASExternalLsa)
+		lsDbEnt.NSSALsaMap = make(map[LsaKey]ASExternalLsa)
+		lsDbEnt.OpaqueLsaMap = make(map[LsaKey]OpaqueLsa)
 		server.AreaLsdb[lsdbKey] = lsDbEnt
 	}
 	selfOrigLsaEnt, exist := server.AreaSelfOrigLsa[lsdbKey]
@@ -107,6 +110,12 @@ func (server *OSPFServer) StartLSDatabase() {
 	// start LSDB aging ticker
 	lsdbTickerCh = time.NewTimer(time.Second * 1)
 	lsdbRefreshTickerCh = time.NewTimer(time.Second * time.Duration(config.LSRefreshTime))
+	server.spfTimer = time.NewTimer(time.Second)
+	server.spfTimer.Stop()
+	server.spfPending = false
+	server.spfChange = spfChangeSet{}
+	server.AreaRoutingTbl = nil
+	server.lsdbExportSyncPending = true
 	go server.processLSDatabaseUpdates()
 	return
 }
@@ -114,6 +123,9 @@ func (server *OSPFServer) StartLSDatabase() {
 func (server *OSPFServer) StopLSDatabase() {
 	lsdbTickerCh.Stop()
 	lsdbRefreshTickerCh.Stop()
+	if server.spfTimer != nil {
+		server.spfTimer.Stop()
+	}
 }
 
 func (server *OSPFServer) compareSummaryLsa(lsdbKey LsdbKey, lsaKey LsaKey, lsaEnt SummaryLsa) bool {
@@ -265,6 +277,7 @@ func (server *OSPFServer) installSummaryLsa() {
 		oldSelfOrigSummaryLsa = nil
 	}
 	server.SummaryLsDb = nil
+	server.installNssaTranslatedLsa()
 }
 
 func (server *OSPFServer) flushNetworkLSA(areaId uint32, key IntfConfKey) {
@@ -307,12 +320,17 @@ func (server *OSPFServer) flushNetworkLSA(areaId uint32, key IntfConfKey) {
 	delete(selfOrigLsaEnt, lsaKey)
 	server.AreaSelfOrigLsa[lsdbKey] = selfOrigLsaEnt
 	server.AreaLsdb[lsdbKey] = lsDbEnt
+	server.markLsaExportDirty(areaId, lsaKey)
 
 }
 
 func (server *OSPFServer) generateNetworkLSA(areaId uint32, key IntfConfKey, isDR bool) {
 
 	//routerId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	if server.isGracefulRestarting() {
+		server.logger.Info(fmt.Sprintln("LSDB: Graceful restart. Dont generate network LSA ", key))
+		return
+	}
 	ent := server.IntfConfMap[key]
 	AreaId := convertIPv4ToUint32(ent.IfAreaId)
 	nbrmdata := ospfIntfToNbrMap[key]
@@ -393,6 +411,7 @@ func (server *OSPFServer) generateNetworkLSA(areaId uint32, key IntfConfKey, isD
 	entry.LsaMd.LSAge = uint16(LSAge)
 	lsDbEnt.NetworkLsaMap[lsaKey] = entry
 	server.AreaLsdb[lsdbKey] = lsDbEnt
+	server.markLsaExportDirty(areaId, lsaKey)
 	selfOrigLsaEnt[lsaKey] = true
 	server.AreaSelfOrigLsa[lsdbKey] = selfOrigLsaEnt
 
@@ -453,6 +472,11 @@ func (server *OSPFServer) constructStubLinkP2P(ent IntfConf, likType config.IfTy
 
 func (server *OSPFServer) generateRouterLSA(areaId uint32) {
 	var linkDetails []LinkDetail = nil
+	if server.isGracefulRestarting() {
+		/* RFC 3623 2.2: keep the pre-restart router LSA until restart is over */
+		server.logger.Info(fmt.Sprintln("LSDB: Graceful restart. Dont generate router LSA area ", areaId))
+		return
+	}
 	for key, ent := range server.IntfConfMap {
 		AreaId := convertIPv4ToUint32(ent.IfAreaId)
 		if areaId != AreaId {
@@ -553,6 +577,27 @@ func (server *OSPFServer) generateRouterLSA(areaId uint32) {
 			linkDetail.LinkType = P2PLink
 			linkDetail.NumOfTOS = 0
 			linkDetail.LinkMetric = uint16(ent.IfCost)
+
+		case config.VirtualLink:
+			/* RFC 2328 12.4.1.3: a virtual link is added once the
+			   virtual neighbor is fully adjacent. Link ID is the
+			   neighbor's router ID, Link Data the IP address of the
+			   virtual interface and the cost comes from the transit
+			   area's SPF. */
+			nbr, full := server.getVirtualLinkFullNbr(key)
+			if !full {
+				server.logger.Info(fmt.Sprintln("LSDB: Virtual neighbor not full ", ent.IfName))
+				continue
+			}
+			linkDetail.LinkId = nbr.OspfNbrRtrId
+			linkDetail.LinkData = convertAreaOrRouterIdUint32(ent.IfIpAddr.String())
+			linkDetail.LinkType = VirtualLink
+			linkDetail.NumOfTOS = 0
+			linkDetail.LinkMetric = uint16(ent.IfCost)
+		}
+		if linkDetail.LinkType != StubLink && server.isStubRouter() {
+			// RFC 6987: only stub links keep their cost
+			linkDetail.LinkMetric = MaxLinkMetric
 		}
 		linkDetails = append(linkDetails, linkDetail)
 	}
@@ -564,10 +609,23 @@ func (server *OSPFServer) generateRouterLSA(areaId uint32) {
 	Options := uint8(2) // Need to be revisited
 	LSAge := 0
 	AdvRouter := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
-	BitE := false //not an AS boundary router (Todo)
+	BitE := false
 	BitB := false
+	BitNt := false
+	BitV := server.isVirtualLinkEndpoint(areaId)
+	areaConfId := config.AreaId(convertUint32ToIPv4(areaId))
+	if server.ospfGlobalConf.ASBdrRtrStatus == true &&
+		!server.isStubArea(areaConfId) {
+		BitE = true
+	}
 	if server.ospfGlobalConf.AreaBdrRtrStatus == true {
 		BitB = true
+		// RFC 3101 3.1: unconditional translators set the Nt bit
+		areaConf, _ := server.AreaConfMap[AreaConfKey{AreaId: areaConfId}]
+		if server.isNssaArea(areaConfId) &&
+			areaConf.AreaNssaTranslatorRole == config.Always {
+			BitNt = true
+		}
 	}
 	lsaKey := LsaKey{
 		LSType:    LSType,
@@ -590,6 +648,7 @@ func (server *OSPFServer) generateRouterLSA(areaId uint32) {
 		delete(selfOrigLsaEnt, lsaKey)
 		server.AreaSelfOrigLsa[lsdbKey] = selfOrigLsaEnt
 		server.AreaLsdb[lsdbKey] = lsDbEnt
+		server.markLsaExportDirty(areaId, lsaKey)
 		return
 	}
 	ent, exist := lsDbEnt.RouterLsaMap[lsaKey]
@@ -604,6 +663,8 @@ func (server *OSPFServer) generateRouterLSA(areaId uint32) {
 	// Length of Per Link Details = 12 bytes
 	// Length of Router LSA Metadata (BitE, BitB, NumofLinks)  = 4 bytes
 	ent.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + 4 + (12 * numOfLinks))
+	ent.BitNt = BitNt
+	ent.BitV = BitV
 	ent.BitE = BitE
 	ent.BitB = BitB
 	ent.NumOfLinks = uint16(numOfLinks)
@@ -616,6 +677,7 @@ func (server *OSPFServer) generateRouterLSA(areaId uint32) {
 	ent.LsaMd.LSAge = uint16(LSAge)
 	lsDbEnt.RouterLsaMap[lsaKey] = ent
 	server.AreaLsdb[lsdbKey] = lsDbEnt
+	server.markLsaExportDirty(areaId, lsaKey)
 
 	selfOrigLsaEnt[lsaKey] = true
 	server.AreaSelfOrigLsa[lsdbKey] = selfOrigLsaEnt
@@ -651,6 +713,11 @@ func (server *OSPFServer) generateASExternalLsa(route RouteMdata) LsaKey {
 
 	BitE := true
 	for lsdbKey, _ := range server.AreaLsdb {
+		areaId := config.AreaId(convertUint32ToIPv4(lsdbKey.AreaId))
+		if server.isStubArea(areaId) || server.isNssaArea(areaId) {
+			// RFC 3101: external routes are carried by type-7 LSAs in NSSA
+			continue
+		}
 		lsDbEnt, _ := server.AreaLsdb[lsdbKey]
 		ent, exist := lsDbEnt.ASExternalLsaMap[lsaKey]
 		LSAge := 0
@@ -747,6 +814,7 @@ func (server *OSPFServer) processDeleteRouterLsa(data []byte, areaId uint32) boo
 	lsDbEnt, _ := server.AreaLsdb[lsdbKey]
 	delete(lsDbEnt.RouterLsaMap, *lsakey)
 	server.AreaLsdb[lsdbKey] = lsDbEnt
+	server.markLsaExportDirty(areaId, *lsakey)
 	return true
 }
 
@@ -776,6 +844,7 @@ func (server *OSPFServer) processRecvdRouterLsa(data []byte, areaId uint32) bool
 	//Add entry in LSADatabase
 	lsDbEnt.RouterLsaMap[*lsakey] = *routerLsa
 	server.AreaLsdb[lsdbKey] = lsDbEnt
+	server.markLsaExportDirty(areaId, *lsakey)
 	server.printRouterLsa()
 	if !exist {
 		var val LsdbSliceEnt
@@ -812,6 +881,7 @@ func (server *OSPFServer) processDeleteNetworkLsa(data []byte, areaId uint32) bo
 	lsDbEnt, _ := server.AreaLsdb[lsdbKey]
 	delete(lsDbEnt.NetworkLsaMap, *lsakey)
 	server.AreaLsdb[lsdbKey] = lsDbEnt
+	server.markLsaExportDirty(areaId, *lsakey)
 
 	return true
 }
@@ -849,6 +919,7 @@ func (server *OSPFServer) processRecvdNetworkLsa(data []byte, areaId uint32) boo
 	//Add entry in LSADatabase
 	lsDbEnt.NetworkLsaMap[*lsakey] = *networkLsa
 	server.AreaLsdb[lsdbKey] = lsDbEnt
+	server.markLsaExportDirty(areaId, *lsakey)
 	if !exist {
 		var val LsdbSliceEnt
 		val.AreaId = lsdbKey.AreaId
@@ -1027,6 +1098,77 @@ func (server *OSPFServer) processRecvdASExternalLsa(data []byte, areaId uint32)
 	return true
 }
 
+func (server *OSPFServer) processDeleteNssaLsa(data []byte, areaId uint32) bool {
+	lsakey := NewLsaKey()
+	var val LsdbSliceEnt
+	nssaLsa := NewASExternalLsa()
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	decodeASExternalLsa(data, nssaLsa, lsakey)
+	lsDbEnt, _ := server.AreaLsdb[lsdbKey]
+	delete(lsDbEnt.NSSALsaMap, *lsakey)
+	server.AreaLsdb[lsdbKey] = lsDbEnt
+
+	val.AreaId = lsdbKey.AreaId
+	val.LSType = lsakey.LSType
+	val.LSId = lsakey.LSId
+	val.AdvRtr = lsakey.AdvRouter
+	err := server.DelLsdbEntry(val)
+	if err != nil {
+		server.logger.Info(fmt.Sprintln("DB: Failed to delete entry from db ", lsakey))
+	}
+	return true
+}
+
+func (server *OSPFServer) processRecvdNssaLsa(data []byte, areaId uint32) bool {
+	lsakey := NewLsaKey()
+	nssaLsa := NewASExternalLsa()
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	decodeASExternalLsa(data, nssaLsa, lsakey)
+	selfOrigLsaEnt, _ := server.AreaSelfOrigLsa[lsdbKey]
+	_, exist := selfOrigLsaEnt[*lsakey]
+	if exist {
+		server.logger.Info("Recvd a self generated NSSA LSA")
+		return false
+	}
+
+	//Check Checksum
+	csum := computeFletcherChecksum(data[2:], FLETCHER_CHECKSUM_VALIDATE)
+	if csum != 0 {
+		server.logger.Err("Invalid NSSA LSA Checksum")
+		return false
+	}
+	lsDbEnt, _ := server.AreaLsdb[lsdbKey]
+	ent, exist := lsDbEnt.NSSALsaMap[*lsakey]
+	if exist {
+		if ent.LsaMd.LSSequenceNum >= nssaLsa.LsaMd.LSSequenceNum {
+			server.logger.Err("Old instance of NSSA LSA Recvd")
+			return false
+		}
+	}
+	//Add entry in LSADatabase
+	lsDbEnt.NSSALsaMap[*lsakey] = *nssaLsa
+	server.AreaLsdb[lsdbKey] = lsDbEnt
+	if !exist {
+		var val LsdbSliceEnt
+		val.AreaId = lsdbKey.AreaId
+		val.LSType = lsakey.LSType
+		val.LSId = lsakey.LSId
+		val.AdvRtr = lsakey.AdvRouter
+		server.LsdbSlice = append(server.LsdbSlice, val)
+		msg := DbLsdbMsg{
+			entry: val,
+			op:    true,
+		}
+		server.DbLsdbOp <- msg
+	}
+
+	return true
+}
+
 func (server *OSPFServer) processRecvdLsa(data []byte, areaId uint32) bool {
 	LSType := uint8(data[3])
 	if LSType == RouterLSA {
@@ -1043,6 +1185,9 @@ func (server *OSPFServer) processRecvdLsa(data []byte, areaId uint32) bool {
 		return server.processRecvdSummaryLsa(data, areaId, LSType)
 	} else if LSType == ASExternalLSA {
 		return server.processRecvdASExternalLsa(data, areaId)
+	} else if LSType == NSSALSA {
+		server.logger.Info("LSDB: Received NSSA lsa")
+		return server.processRecvdNssaLsa(data, areaId)
 	} else {
 		server.logger.Info("LSDB: Invalid LSA packet from nbr")
 		return false
@@ -1062,6 +1207,8 @@ func (server *OSPFServer) processDeleteLsa(data []byte, areaId uint32) bool {
 		return server.processDeleteSummaryLsa(data, areaId, LSType)
 	} else if LSType == ASExternalLSA {
 		return server.processDeleteASExternalLsa(data, areaId)
+	} else if LSType == NSSALSA {
+		return server.processDeleteNssaLsa(data, areaId)
 	} else {
 		return false
 	}
@@ -1071,63 +1218,50 @@ func (server *OSPFServer) processLSDatabaseUpdates() {
 	for {
 		select {
 		case msg := <-server.LsdbUpdateCh:
-			if msg.MsgType == LsdbAdd {
+			if msg.MsgType == LsdbAdd && isOpaqueLsa(uint8(msg.Data[3])) {
+				ret := server.processRecvdOpaqueLsa(msg.Data, msg.AreaId, msg.IntfKey)
+				server.logger.Info(fmt.Sprintln("Opaque LSA Return Code:", ret))
+			} else if msg.MsgType == LsdbAdd {
 				server.logger.Info("Adding LS in the Lsdb")
 				server.logger.Info("Received New LSA")
+				lsaKey, old := server.getLsaSnapshot(msg.Data, msg.AreaId)
 				ret := server.processRecvdLsa(msg.Data, msg.AreaId)
 				server.logger.Info(fmt.Sprintln("Return Code:", ret))
 				//server.LsaUpdateRetCodeCh <- ret
-				server.StartCalcSPFCh <- true
-				spfStatus := <-server.DoneCalcSPFCh
-				server.logger.Info(fmt.Sprintln("SPF Calculation Return Status", spfStatus))
-				if server.ospfGlobalConf.AreaBdrRtrStatus == true {
-					server.installSummaryLsa()
+				if server.recordLsaChange(msg.AreaId, lsaKey, old) {
+					server.scheduleRouteCalc(SpfTrigLsaUpdate)
 				}
 			} else if msg.MsgType == LsdbDel {
 				server.logger.Info("Deleting LS in the Lsdb")
+				lsaKey, old := server.getLsaSnapshot(msg.Data, msg.AreaId)
 				ret := server.processDeleteLsa(msg.Data, msg.AreaId)
 				//server.LsaUpdateRetCodeCh <- ret
 				server.logger.Info(fmt.Sprintln("Return Code:", ret))
-				server.StartCalcSPFCh <- true
-				spfStatus := <-server.DoneCalcSPFCh
-				server.logger.Info(fmt.Sprintln("SPF Calculation Return Status", spfStatus))
-				if server.ospfGlobalConf.AreaBdrRtrStatus == true {
-					server.installSummaryLsa()
+				if server.recordLsaChange(msg.AreaId, lsaKey, old) {
+					server.scheduleRouteCalc(SpfTrigLsaDelete)
 				}
 			} else if msg.MsgType == LsdbUpdate {
 				server.logger.Info("Deleting LS in the Lsdb")
+				lsaKey, old := server.getLsaSnapshot(msg.Data, msg.AreaId)
 				ret := server.processRecvdLsa(msg.Data, msg.AreaId)
 				//server.LsaUpdateRetCodeCh <- ret
 				server.logger.Info(fmt.Sprintln("Return Code:", ret))
-				server.StartCalcSPFCh <- true
-				spfStatus := <-server.DoneCalcSPFCh
-				server.logger.Info(fmt.Sprintln("SPF Calculation Return Status", spfStatus))
-				if server.ospfGlobalConf.AreaBdrRtrStatus == true {
-					server.installSummaryLsa()
+				if server.recordLsaChange(msg.AreaId, lsaKey, old) {
+					server.scheduleRouteCalc(SpfTrigLsaUpdate)
 				}
 			}
 		case msg := <-server.IntfStateChangeCh:
 			server.logger.Info(fmt.Sprintf("Interface State change msg", msg))
-			server.generateRouterLSA(msg.areaId)
+			server.generateRouterLsaThrottled(msg.areaId)
 			//server.logger.Info(fmt.Sprintln("LS Database", server.AreaLsdb))
-			server.StartCalcSPFCh <- true
-			spfStatus := <-server.DoneCalcSPFCh
-			server.logger.Info(fmt.Sprintln("SPF Calculation Return Status", spfStatus))
 			server.processInterfaceChangeMsg(msg)
-			if server.ospfGlobalConf.AreaBdrRtrStatus == true {
-				server.installSummaryLsa()
-			}
+			server.scheduleSpf(SpfTrigIntfChange)
 		case msg := <-server.NetworkDRChangeCh:
 			server.logger.Info(fmt.Sprintf("Network DR change msg", msg))
 			// Create a new router LSA
 			//server.logger.Info(fmt.Sprintln("LS Database", server.AreaLsdb))
 			server.processDrBdrChangeMsg(msg)
-			server.StartCalcSPFCh <- true
-			spfStatus := <-server.DoneCalcSPFCh
-			server.logger.Info(fmt.Sprintln("SPF Calculation Return Status", spfStatus))
-			if server.ospfGlobalConf.AreaBdrRtrStatus == true {
-				server.installSummaryLsa()
-			}
+			server.scheduleSpf(SpfTrigDrChange)
 		case msg := <-server.CreateNetworkLSACh:
 			server.logger.Info(fmt.Sprintf("Create Network LSA msg", msg))
 			server.processNeighborFullEvent(msg)
@@ -1137,22 +1271,27 @@ func (server *OSPFServer) processLSDatabaseUpdates() {
 			// If link is broadcast
 			// Create Network LSA
 			//server.logger.Info(fmt.Sprintln("LS Database", server.AreaLsdb))
-			server.StartCalcSPFCh <- true
-			spfStatus := <-server.DoneCalcSPFCh
-			server.logger.Info(fmt.Sprintln("SPF Calculation Return Status", spfStatus))
-			if server.ospfGlobalConf.AreaBdrRtrStatus == true {
-				server.installSummaryLsa()
-			}
+			server.scheduleSpf(SpfTrigNbrFull)
 
 		case msg := <-server.ExternalRouteNotif: //Generate external LSA
 			server.processExtRouteUpd(msg)
 
+		case msg := <-server.OpaqueLsaCh: //Originate / flush self opaque LSA
+			msg.RetCh <- server.processOpaqueLsaMsg(msg)
+
+		case <-server.spfTimer.C: //Throttled SPF
+			server.runSpf()
+
+		case <-server.BgpConvergedCh: //Leave wait for BGP stub router mode
+			server.processBgpConverged()
+
 		case msg := <-server.maxAgeLsaCh: //Flood MaxAge LSA
 			server.processMaxAgeLsaMsg(msg)
 
 		case <-lsdbTickerCh.C: //Increment LSA AGE
 			lsdbTickerCh.Stop()
 			server.processLSDatabaseTicker()
+			server.processLsdbExportTicker()
 			lsdbTickerCh.Reset(time.Duration(1) * time.Second)
 
 		case <-lsdbRefreshTickerCh.C: //Regenerate LSA
@@ -1160,20 +1299,37 @@ func (server *OSPFServer) processLSDatabaseUpdates() {
 			server.lsdbSelfLsaRefresh()
 			lsdbRefreshTickerCh.Reset(time.Duration(config.LSRefreshTime) * time.Second)
 		}
+		server.publishLsdbChanges()
 	}
 }
 
 /*@fn processExtRouteUpd
 Generate / delete As external LSA.
+Generate / delete NSSA LSA for every NSSA.
 Send flood message if new route is added.
 */
 func (server *OSPFServer) processExtRouteUpd(msg RouteMdata) {
+	if server.isGracefulRestarting() {
+		server.graceExtRouteQueue = append(server.graceExtRouteQueue, msg)
+		return
+	}
 	ifkey := IntfConfKey{}
 	nbr := NeighborConfKey{}
 	lsaKey := server.generateASExternalLsa(msg)
 	if !msg.isDel {
+		delete(server.NssaTranslatedLsa, lsaKey)
 		server.sendLsdbToNeighborEvent(ifkey, nbr, 0, 0, 0, lsaKey, LSAEXTFLOOD)
 	}
+	for key, _ := range server.AreaConfMap {
+		if !server.isNssaArea(key.AreaId) {
+			continue
+		}
+		areaId := convertAreaOrRouterIdUint32(string(key.AreaId))
+		nssaKey := server.generateNssaLsa(msg, areaId)
+		if !msg.isDel {
+			server.sendLsdbToNeighborEvent(ifkey, nbr, areaId, 0, 0, nssaKey, LSANSSAFLOOD)
+		}
+	}
 }
 
 /*
@@ -1201,11 +1357,13 @@ func (server *OSPFServer) processInterfaceChangeMsg(msg NetworkLSAChangeMsg) {
 /* @fn processNeighborFullEvent
 Generate network LSA if the router is DR.
 Send message for LSAFLOOD which will flood
-router (and network) LSA
+router (and network) LSA if one was generated.
+Throttled LSAs are flooded when generated later.
 */
 func (server *OSPFServer) processNeighborFullEvent(msg ospfNbrMdata) {
 	lsaKey := LsaKey{}
 	nbr := NeighborConfKey{}
+	generated := false
 
 	rtr_id := binary.BigEndian.Uint32(server.ospfGlobalConf.RouterId)
 	intConf := server.IntfConfMap[msg.intf]
@@ -1213,10 +1371,23 @@ func (server *OSPFServer) processNeighborFullEvent(msg ospfNbrMdata) {
 		msg.areaId, " intf ", intConf.IfIpAddr))
 	if intConf.IfDRtrId == rtr_id && intConf.IfType == config.Broadcast {
 		server.logger.Info(fmt.Sprintln("Generate network LSA ", msg.intf))
-		server.generateNetworkLSA(msg.areaId, msg.intf, true)
+		generated = server.generateNetworkLsaThrottled(msg.areaId, msg.intf)
+	}
+	if server.generateRouterLsaThrottled(msg.areaId) || generated {
+		server.sendLsdbToNeighborEvent(msg.intf, nbr, msg.areaId, 0, 0, lsaKey, LSAFLOOD)
+	}
+	if intConf.IfType == config.VirtualLink {
+		// V bit of the router-LSA in the transit area
+		transitAreaId := intConf.IfVirtLinkKey.TransitAreaId
+		lsaKey = LsaKey{
+			LSType:    RouterLSA,
+			LSId:      rtr_id,
+			AdvRouter: rtr_id,
+		}
+		if server.generateRouterLsaThrottled(transitAreaId) {
+			server.sendLsdbToNeighborEvent(msg.intf, nbr, transitAreaId, 0, 0, lsaKey, LSAROUTERFLOOD)
+		}
 	}
-	server.generateRouterLSA(msg.areaId)
-	server.sendLsdbToNeighborEvent(msg.intf, nbr, msg.areaId, 0, 0, lsaKey, LSAFLOOD)
 }
 
 /* @fn processDrBdrChangeMsg
@@ -1234,6 +1405,7 @@ func (server *OSPFServer) processDrBdrChangeMsg(msg DrChangeMsg) {
 	server.logger.Info(fmt.Sprintln("LSDB: received DR BDR change message ",
 		intf.IfIpAddr, "dr ip ", intf.IfDRIp, " bdr ip ", intf.IfBDRIp))
 	nbrExists := false
+	generated := false
 	for range intf.NeighborMap {
 		nbrExists = true
 		break
@@ -1242,10 +1414,11 @@ func (server *OSPFServer) processDrBdrChangeMsg(msg DrChangeMsg) {
 		rtr_id := binary.BigEndian.Uint32(server.ospfGlobalConf.RouterId)
 		if intf.IfDRtrId == rtr_id {
 			server.logger.Info(fmt.Sprintln("Generate network LSA ", intf.IfIpAddr))
-			server.generateNetworkLSA(msg.areaId, msg.intfKey, true)
+			generated = server.generateNetworkLsaThrottled(msg.areaId, msg.intfKey)
 		}
 	}
-	server.generateRouterLSA(msg.areaId)
-	server.sendLsdbToNeighborEvent(msg.intfKey, nbr, msg.areaId, 0, 0, lsaKey, LSAFLOOD)
+	if server.generateRouterLsaThrottled(msg.areaId) || generated {
+		server.sendLsdbToNeighborEvent(msg.intfKey, nbr, msg.areaId, 0, 0, lsaKey, LSAFLOOD)
+	}
 
 }
@@ -0,0 +1,282 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	nanomsg "github.com/op/go-nanomsg"
+	"l3/ospf/ospfdCommonDefs"
+	"syscall"
+)
+
+const (
+	LSDB_EXPORT_SYNC_INTERVAL = 60 // seconds
+	LSDB_EXPORT_MAX_PENDING   = 256
+)
+
+type lsdbExportKey struct {
+	AreaId uint32
+	LsaKey LsaKey
+}
+
+type lsdbExportEnt struct {
+	LSSequenceNum int
+	LSChecksum    uint16
+}
+
+func (server *OSPFServer) initLsdbPublisher(address string) *nanomsg.PubSocket {
+	server.logger.Info(fmt.Sprintln("Setting up", address, "publisher"))
+	pub, err := nanomsg.NewPubSocket()
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("Failed to open pub socket", err))
+		return nil
+	}
+	_, err = pub.Bind(address)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("Failed to bind pub socket", address, err))
+		return nil
+	}
+	err = pub.SetSendBuffer(1024 * 1024)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("Failed to set send buffer size", err))
+		return nil
+	}
+	return pub
+}
+
+/*
+@fn markLsaExportDirty
+Router and network LSAs that were added, updated or
+removed from the LSDB are published on the next
+call to publishLsdbChanges.
+*/
+func (server *OSPFServer) markLsaExportDirty(areaId uint32, lsaKey LsaKey) {
+	if lsaKey.LSType != RouterLSA && lsaKey.LSType != NetworkLSA {
+		return
+	}
+	server.lsdbExportDirty[lsdbExportKey{areaId, lsaKey}] = true
+}
+
+/*
+@fn flushLsdbExportPending
+Send the queued notifications. The ones that can't be
+sent because the socket buffer is full stay in the
+queue and are retried on the next LSDB tick.
+*/
+func (server *OSPFServer) flushLsdbExportPending() {
+	for len(server.lsdbExportPending) > 0 {
+		_, err := server.lsdbPubSocket.Send(server.lsdbExportPending[0], nanomsg.DontWait)
+		if err == syscall.EAGAIN {
+			break
+		}
+		if err != nil {
+			server.logger.Err(fmt.Sprintln("Failed to publish LSA export notification", err))
+		}
+		server.lsdbExportPending = server.lsdbExportPending[1:]
+	}
+
+	if len(server.lsdbExportPending) > LSDB_EXPORT_MAX_PENDING {
+		// Too far behind, the full sync replaces the queued notifications
+		server.logger.Err(fmt.Sprintln("LSDB export: dropped", len(server.lsdbExportPending),
+			"pending notifications, schedule full sync"))
+		server.lsdbExportPending = nil
+		server.lsdbExportSyncPending = true
+	}
+}
+
+func (server *OSPFServer) publishLsaInfo(msgType uint16, lsaList []ospfdCommonDefs.OspfdLsaInfo) {
+	if server.lsdbPubSocket == nil || (len(lsaList) == 0 && msgType != ospfdCommonDefs.NOTIFY_LSA_SYNC) {
+		return
+	}
+
+	msgBuf, err := json.Marshal(lsaList)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("Failed to marshal LSA export msg", err))
+		return
+	}
+	msg := ospfdCommonDefs.OspfdNotifyMsg{
+		MsgType: msgType,
+		MsgBuf:  msgBuf,
+	}
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("Failed to marshal LSA export notification", err))
+		return
+	}
+	server.lsdbExportPending = append(server.lsdbExportPending, buf)
+	server.flushLsdbExportPending()
+}
+
+func convertRouterLsaToLsaInfo(areaId uint32, lsaKey LsaKey, lsa RouterLsa) ospfdCommonDefs.OspfdLsaInfo {
+	lsaInfo := ospfdCommonDefs.OspfdLsaInfo{
+		AreaId:    areaId,
+		LSType:    lsaKey.LSType,
+		LSId:      lsaKey.LSId,
+		AdvRouter: lsaKey.AdvRouter,
+		BitE:      lsa.BitE,
+		BitB:      lsa.BitB,
+	}
+	for _, link := range lsa.LinkDetails {
+		lsaInfo.Links = append(lsaInfo.Links, ospfdCommonDefs.OspfdLinkInfo{
+			LinkId:   link.LinkId,
+			LinkData: link.LinkData,
+			LinkType: link.LinkType,
+			Metric:   link.LinkMetric,
+		})
+	}
+	return lsaInfo
+}
+
+func convertNetworkLsaToLsaInfo(areaId uint32, lsaKey LsaKey, lsa NetworkLsa) ospfdCommonDefs.OspfdLsaInfo {
+	return ospfdCommonDefs.OspfdLsaInfo{
+		AreaId:      areaId,
+		LSType:      lsaKey.LSType,
+		LSId:        lsaKey.LSId,
+		AdvRouter:   lsaKey.AdvRouter,
+		Netmask:     lsa.Netmask,
+		AttachedRtr: lsa.AttachedRtr,
+	}
+}
+
+func (server *OSPFServer) getExportLsaInfo(key lsdbExportKey) (ospfdCommonDefs.OspfdLsaInfo, lsdbExportEnt, bool) {
+	lsDbEnt, exist := server.AreaLsdb[LsdbKey{key.AreaId}]
+	if !exist {
+		return ospfdCommonDefs.OspfdLsaInfo{}, lsdbExportEnt{}, false
+	}
+	if key.LsaKey.LSType == RouterLSA {
+		lsa, exist := lsDbEnt.RouterLsaMap[key.LsaKey]
+		if !exist {
+			return ospfdCommonDefs.OspfdLsaInfo{}, lsdbExportEnt{}, false
+		}
+		return convertRouterLsaToLsaInfo(key.AreaId, key.LsaKey, lsa),
+			lsdbExportEnt{lsa.LsaMd.LSSequenceNum, lsa.LsaMd.LSChecksum}, true
+	}
+	lsa, exist := lsDbEnt.NetworkLsaMap[key.LsaKey]
+	if !exist {
+		return ospfdCommonDefs.OspfdLsaInfo{}, lsdbExportEnt{}, false
+	}
+	return convertNetworkLsaToLsaInfo(key.AreaId, key.LsaKey, lsa),
+		lsdbExportEnt{lsa.LsaMd.LSSequenceNum, lsa.LsaMd.LSChecksum}, true
+}
+
+/*
+@fn publishLsdbSync
+Publish all the router and network LSAs in the LSDB.
+bgpd replaces its copy of the LSDB with the ones in
+the sync, so a subscriber that connected late or
+missed notifications catches up.
+*/
+func (server *OSPFServer) publishLsdbSync() {
+	lsaList := make([]ospfdCommonDefs.OspfdLsaInfo, 0)
+	server.lsdbExportMap = make(map[lsdbExportKey]lsdbExportEnt)
+	for lsdbKey, lsDbEnt := range server.AreaLsdb {
+		for lsaKey, _ := range lsDbEnt.RouterLsaMap {
+			server.lsdbExportDirty[lsdbExportKey{lsdbKey.AreaId, lsaKey}] = true
+		}
+		for lsaKey, _ := range lsDbEnt.NetworkLsaMap {
+			server.lsdbExportDirty[lsdbExportKey{lsdbKey.AreaId, lsaKey}] = true
+		}
+	}
+	for key, _ := range server.lsdbExportDirty {
+		lsaInfo, ent, exist := server.getExportLsaInfo(key)
+		if exist {
+			lsaList = append(lsaList, lsaInfo)
+			server.lsdbExportMap[key] = ent
+		}
+	}
+	server.lsdbExportDirty = make(map[lsdbExportKey]bool)
+	server.lsdbExportSyncPending = false
+	server.lsdbExportSyncCnt = 0
+
+	server.logger.Info(fmt.Sprintln("LSDB export: full sync", len(lsaList)))
+	// Queued notifications are older than the sync
+	server.lsdbExportPending = nil
+	server.publishLsaInfo(ospfdCommonDefs.NOTIFY_LSA_SYNC, lsaList)
+}
+
+/*
+@fn processLsdbExportTicker
+Called every second from the LSDB ticker. Retries the
+queued notifications and publishes the full LSDB
+every LSDB_EXPORT_SYNC_INTERVAL seconds.
+*/
+func (server *OSPFServer) processLsdbExportTicker() {
+	if server.lsdbPubSocket == nil {
+		return
+	}
+	server.lsdbExportSyncCnt++
+	if server.lsdbExportSyncCnt >= LSDB_EXPORT_SYNC_INTERVAL {
+		server.lsdbExportSyncPending = true
+	}
+	server.flushLsdbExportPending()
+}
+
+/*
+@fn publishLsdbChanges
+Publish the router and network LSAs that changed
+since the last call. LSAs that were removed from the
+LSDB (including aged out ones) are published as
+deleted.
+*/
+func (server *OSPFServer) publishLsdbChanges() {
+	if server.lsdbPubSocket == nil {
+		return
+	}
+	if server.lsdbExportSyncPending {
+		server.publishLsdbSync()
+		return
+	}
+	if len(server.lsdbExportDirty) == 0 {
+		return
+	}
+
+	added := make([]ospfdCommonDefs.OspfdLsaInfo, 0)
+	deleted := make([]ospfdCommonDefs.OspfdLsaInfo, 0)
+	for key, _ := range server.lsdbExportDirty {
+		lsaInfo, ent, exist := server.getExportLsaInfo(key)
+		oldEnt, exported := server.lsdbExportMap[key]
+		if exist {
+			if !exported || oldEnt != ent {
+				added = append(added, lsaInfo)
+				server.lsdbExportMap[key] = ent
+			}
+		} else if exported {
+			deleted = append(deleted, ospfdCommonDefs.OspfdLsaInfo{
+				AreaId:    key.AreaId,
+				LSType:    key.LsaKey.LSType,
+				LSId:      key.LsaKey.LSId,
+				AdvRouter: key.LsaKey.AdvRouter,
+			})
+			delete(server.lsdbExportMap, key)
+		}
+	}
+	server.lsdbExportDirty = make(map[lsdbExportKey]bool)
+
+	if len(added) > 0 || len(deleted) > 0 {
+		server.logger.Info(fmt.Sprintln("LSDB export: added/updated", len(added), "deleted", len(deleted)))
+	}
+	server.publishLsaInfo(ospfdCommonDefs.NOTIFY_LSA_DEL, deleted)
+	server.publishLsaInfo(ospfdCommonDefs.NOTIFY_LSA_ADD, added)
+}
@@ -81,6 +81,33 @@ func (server *OSPFServer) lsdbStateRefresh() {
 				val.AdvRtr = lsakey.AdvRouter
 				server.LsdbSlice = append(server.LsdbSlice, val)
 			}
+			for lsakey, _ := range lsdbEnt.NSSALsaMap {
+				var val LsdbSliceEnt
+				val.AreaId = lsdbkey.AreaId
+				val.LSType = lsakey.LSType
+				val.LSId = lsakey.LSId
+				val.AdvRtr = lsakey.AdvRouter
+				server.LsdbSlice = append(server.LsdbSlice, val)
+			}
+			for lsakey, _ := range lsdbEnt.OpaqueLsaMap {
+				var val LsdbSliceEnt
+				val.AreaId = lsdbkey.AreaId
+				val.LSType = lsakey.LSType
+				val.LSId = lsakey.LSId
+				val.AdvRtr = lsakey.AdvRouter
+				server.LsdbSlice = append(server.LsdbSlice, val)
+			}
+		}
+		for intfKey, lsdb := range server.LinkOpaqueLsdb {
+			areaId := convertIPv4ToUint32(server.IntfConfMap[intfKey].IfAreaId)
+			for lsakey, _ := range lsdb {
+				var val LsdbSliceEnt
+				val.AreaId = areaId
+				val.LSType = lsakey.LSType
+				val.LSId = lsakey.LSId
+				val.AdvRtr = lsakey.AdvRouter
+				server.LsdbSlice = append(server.LsdbSlice, val)
+			}
 		}
 		server.logger.Info(fmt.Sprintln("The new Lsdb Slice after refresh", server.LsdbSlice))
 		server.LsdbStateTimer.Reset(server.RefreshDuration)
@@ -113,6 +140,9 @@ func (server *OSPFServer) lsdbSelfLsaRefresh() {
 				if floodAsExt == 0 && lsaKey.LSType == ASExternalLSA {
 					server.sendLsdbToNeighborEvent(ifkey, nbr, 0, 0, 0, lsaKey, LSAEXTFLOOD)
 				}
+				if lsaKey.LSType == NSSALSA {
+					server.sendLsdbToNeighborEvent(ifkey, nbr, lsdbKey.AreaId, 0, 0, lsaKey, LSANSSAFLOOD)
+				}
 				if err != nil {
 					server.logger.Warning(fmt.Sprintln("LSDB: Failed to regenerate LSA ", lsaKey, " Area ", lsdbKey))
 				}
@@ -122,6 +152,7 @@ func (server *OSPFServer) lsdbSelfLsaRefresh() {
 	}
 	// generate Summary LSAs
 	server.GenerateSummaryLsa()
+	server.refreshSelfOpaqueLsa()
 	lsaKey := LsaKey{}
 
 	for entKey, ent := range server.IntfConfMap {
@@ -158,6 +189,9 @@ func (server *OSPFServer) regenerateLsa(lsdbKey LsdbKey, lsaKey LsaKey) error {
 	case ASExternalLSA:
 		server.updateAsExternalLSA(lsdbKey, lsaKey)
 
+	case NSSALSA:
+		server.updateNssaLsa(lsdbKey, lsaKey)
+
 	}
 	return nil
 }
@@ -174,6 +208,10 @@ func (server *OSPFServer) processLSDatabaseTicker() {
 		server.processMaxAgeLSA(lsdbKey, lsDbEnt)
 
 	}
+	server.processMaxAgeLinkOpaqueLsa()
+	server.processGracefulRestartTick()
+	server.processStubRouterTick()
+	server.processLsaThrottleTick()
 
 }
 
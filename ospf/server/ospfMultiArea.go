@@ -35,6 +35,7 @@ func (server *OSPFServer) HandleSummaryLsa(areaId uint32) {
 	server.HandleSummaryType3Lsa(areaId)
 	server.HandleSummaryType4Lsa(areaId)
 	server.HandleASExternalLsa(areaId)
+	server.HandleNssaLsa(areaId)
 }
 
 func (server *OSPFServer) HandleSummaryType3Lsa(areaId uint32) {
@@ -58,96 +59,77 @@ func (server *OSPFServer) CalcInterAreaRoutes(areaId uint32) {
 	}
 
 	for lsaKey, lsaEnt := range lsDbEnt.Summary3LsaMap {
-		server.logger.Info(fmt.Sprintln("Summary LSAKey:", lsaKey, "lsaENt:", lsaEnt))
-		if lsaEnt.Metric == LSInfinity ||
-			lsaEnt.LsaMd.LSAge == config.MaxAge {
-			server.logger.Info("Ignoring Summary LSA...")
-			continue
-		}
-		rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
-		if lsaKey.AdvRouter == rtrId {
-			server.logger.Info("Self originated summary 3 LSA, so no need to process for routing table calc")
-			continue
-		}
+		server.calcInterAreaRoute(areaId, lsaKey, lsaEnt)
+	}
+}
 
-		areaIdKey := AreaIdKey{
-			AreaId: areaId,
-		}
-		// TODO: Handle Area Range Section 16.2 Point 3
-		//Network := lsaKey.LSId & lsaEnt.Netmask
-		//Mask := lsaEnt.Netmask
-		rKey := RoutingTblEntryKey{
+func (server *OSPFServer) calcInterAreaRoute(areaId uint32, lsaKey LsaKey, lsaEnt SummaryLsa) {
+	server.logger.Info(fmt.Sprintln("Summary LSAKey:", lsaKey, "lsaENt:", lsaEnt))
+	if lsaEnt.Metric == LSInfinity ||
+		lsaEnt.LsaMd.LSAge == config.MaxAge {
+		server.logger.Info("Ignoring Summary LSA...")
+		return
+	}
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	if lsaKey.AdvRouter == rtrId {
+		server.logger.Info("Self originated summary 3 LSA, so no need to process for routing table calc")
+		return
+	}
+
+	areaIdKey := AreaIdKey{
+		AreaId: areaId,
+	}
+	// TODO: Handle Area Range Section 16.2 Point 3
+	//Network := lsaKey.LSId & lsaEnt.Netmask
+	//Mask := lsaEnt.Netmask
+	rKey := RoutingTblEntryKey{
+		DestId:   lsaKey.AdvRouter,
+		AddrMask: 0,
+		DestType: AreaBdrRouter,
+	}
+
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	rEnt, exist := tempAreaRoutingTbl.RoutingTblMap[rKey]
+	if !exist {
+		server.logger.Info("Area Router routing table entry doesnot exists for Summary Lsa Advertising Router")
+		rKey = RoutingTblEntryKey{
 			DestId:   lsaKey.AdvRouter,
 			AddrMask: 0,
-			DestType: AreaBdrRouter,
+			DestType: ASAreaBdrRouter,
 		}
-
-		tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
-		rEnt, exist := tempAreaRoutingTbl.RoutingTblMap[rKey]
+		rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
 		if !exist {
-			server.logger.Info("Area Router routing table entry doesnot exists for Summary Lsa Advertising Router")
-			rKey = RoutingTblEntryKey{
-				DestId:   lsaKey.AdvRouter,
-				AddrMask: 0,
-				DestType: ASAreaBdrRouter,
-			}
-			rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
-			if !exist {
-				server.logger.Info("AS Area Border Router routing table entry doesnot exists for Summary Lsa Advertising Router")
-				continue
-			}
-		}
-		if rEnt.NumOfPaths == 0 {
-			continue
-		}
-		cost := rEnt.Cost + uint16(lsaEnt.Metric)
-		nextHopMap := rEnt.NextHops
-		numOfNextHops := rEnt.NumOfPaths
-		rKey = RoutingTblEntryKey{
-			DestId:   lsaKey.LSId & lsaEnt.Netmask,
-			AddrMask: lsaEnt.Netmask,
-			DestType: Network,
+			server.logger.Info("AS Area Border Router routing table entry doesnot exists for Summary Lsa Advertising Router")
+			return
 		}
+	}
+	if rEnt.NumOfPaths == 0 {
+		return
+	}
+	cost := rEnt.Cost + uint16(lsaEnt.Metric)
+	nextHopMap := rEnt.NextHops
+	numOfNextHops := rEnt.NumOfPaths
+	rKey = RoutingTblEntryKey{
+		DestId:   lsaKey.LSId & lsaEnt.Netmask,
+		AddrMask: lsaEnt.Netmask,
+		DestType: Network,
+	}
 
-		tempAreaRoutingTbl = server.TempAreaRoutingTbl[areaIdKey]
-		rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
-		if exist {
-			if rEnt.PathType == IntraArea {
-				continue
-			}
+	tempAreaRoutingTbl = server.TempAreaRoutingTbl[areaIdKey]
+	rEnt, exist = tempAreaRoutingTbl.RoutingTblMap[rKey]
+	if exist {
+		if rEnt.PathType == IntraArea {
+			return
+		}
 
-			if rEnt.Cost < cost {
-				server.logger.Info("Route already exists with lesser cost")
-				continue
-			} else if rEnt.Cost > cost {
-				rEnt.OptCapabilities = 0 //TODO
-				//rEnt.PathType = InterArea
-				rEnt.Cost = cost
-				//rEnt.Type2Cost = 0
-				//rEnt.LSOrigin = lsaKey
-				rEnt.NumOfPaths = numOfNextHops
-				rEnt.NextHops = make(map[NextHop]bool)
-				for key, _ := range nextHopMap {
-					key.AdvRtr = lsaKey.AdvRouter
-					rEnt.NextHops[key] = true
-				}
-			} else {
-				cnt := 0
-				for key, _ := range nextHopMap {
-					_, exist = rEnt.NextHops[key]
-					if !exist {
-						key.AdvRtr = lsaKey.AdvRouter
-						rEnt.NextHops[key] = true
-						cnt++
-					}
-				}
-				rEnt.NumOfPaths = numOfNextHops + cnt
-			}
-		} else {
+		if rEnt.Cost < cost {
+			server.logger.Info("Route already exists with lesser cost")
+			return
+		} else if rEnt.Cost > cost {
 			rEnt.OptCapabilities = 0 //TODO
-			rEnt.PathType = InterArea
+			//rEnt.PathType = InterArea
 			rEnt.Cost = cost
-			rEnt.Type2Cost = 0
+			//rEnt.Type2Cost = 0
 			//rEnt.LSOrigin = lsaKey
 			rEnt.NumOfPaths = numOfNextHops
 			rEnt.NextHops = make(map[NextHop]bool)
@@ -155,10 +137,33 @@ func (server *OSPFServer) CalcInterAreaRoutes(areaId uint32) {
 				key.AdvRtr = lsaKey.AdvRouter
 				rEnt.NextHops[key] = true
 			}
+		} else {
+			cnt := 0
+			for key, _ := range nextHopMap {
+				_, exist = rEnt.NextHops[key]
+				if !exist {
+					key.AdvRtr = lsaKey.AdvRouter
+					rEnt.NextHops[key] = true
+					cnt++
+				}
+			}
+			rEnt.NumOfPaths = numOfNextHops + cnt
+		}
+	} else {
+		rEnt.OptCapabilities = 0 //TODO
+		rEnt.PathType = InterArea
+		rEnt.Cost = cost
+		rEnt.Type2Cost = 0
+		//rEnt.LSOrigin = lsaKey
+		rEnt.NumOfPaths = numOfNextHops
+		rEnt.NextHops = make(map[NextHop]bool)
+		for key, _ := range nextHopMap {
+			key.AdvRtr = lsaKey.AdvRouter
+			rEnt.NextHops[key] = true
 		}
-		tempAreaRoutingTbl.RoutingTblMap[rKey] = rEnt
-		server.TempAreaRoutingTbl[areaIdKey] = tempAreaRoutingTbl
 	}
+	tempAreaRoutingTbl.RoutingTblMap[rKey] = rEnt
+	server.TempAreaRoutingTbl[areaIdKey] = tempAreaRoutingTbl
 }
 
 func (server *OSPFServer) GenerateSummaryLsa() {
@@ -174,6 +179,7 @@ func (server *OSPFServer) GenerateSummaryLsa() {
 			AreaId: areaId,
 		}
 		isStub := server.isStubArea(aKey.AreaId)
+		isNssa := server.isNssaArea(aKey.AreaId)
 		sEnt, _ := server.SummaryLsDb[lsDbKey]
 		sEnt = make(map[LsaKey]SummaryLsa)
 		for rKey, rEnt := range server.GlobalRoutingTbl {
@@ -210,7 +216,7 @@ func (server *OSPFServer) GenerateSummaryLsa() {
 			*/
 
 			if (rKey.DestType == ASAreaBdrRouter ||
-				rKey.DestType == ASBdrRouter) && !isStub {
+				rKey.DestType == ASBdrRouter) && !isStub && !isNssa {
 				lsaKey, summaryLsa := server.GenerateType4SummaryLSA(rKey, rEnt, lsDbKey)
 				sEnt[lsaKey] = summaryLsa
 			}
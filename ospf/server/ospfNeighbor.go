@@ -39,19 +39,9 @@ func (server *OSPFServer) exchangePacketDiscardCheck(nbrConf OspfNeighborEntry,
 		eventType: config.ADJACENCY,
 	}
 
-	if nbrDbPkt.msbit != nbrConf.isMaster {
-		msg.eventInfo = "SeqNumberMismatch. Nbr should be master " + nbrConf.OspfNbrIPAddr.String()
-		server.logger.Info(fmt.Sprintln("NBREVENT: SeqNumberMismatch. Nbr should be master  dbdmsbit ", nbrDbPkt.msbit,
-			" isMaster ", nbrConf.isMaster))
-		server.DbEventOp <- msg
-		return true
-	}
-
-	if nbrDbPkt.ibit == true {
-		server.logger.Info("NBREVENT:SeqNumberMismatch . Nbr ibit is true ")
-		msg.eventInfo = "SeqNumberMismatch . Nbr ibit is true " + nbrConf.OspfNbrIPAddr.String()
-		server.DbEventOp <- msg
-		return true
+	if nbrDbPkt.msbit == nbrConf.isMaster && !nbrDbPkt.ibit &&
+		server.verifyDuplicatePacket(nbrConf, nbrDbPkt) {
+		return false
 	}
 	/*
 		if nbrDbPkt.options != INTF_OPTIONS {
@@ -59,29 +49,15 @@ func (server *OSPFServer) exchangePacketDiscardCheck(nbrConf OspfNeighborEntry,
 				" dbd oackts options", nbrDbPkt.options))
 			return true
 		}*/
-
-	if nbrConf.isMaster {
-		if nbrDbPkt.dd_sequence_number != nbrConf.ospfNbrSeqNum {
-			if nbrDbPkt.dd_sequence_number+1 == nbrConf.ospfNbrSeqNum {
-				server.logger.Info(fmt.Sprintln("Duplicate: This is db duplicate packet. Ignore."))
-				return false
-			}
-			server.logger.Info(fmt.Sprintln("NBREVENT:SeqNumberMismatch : Nbr is master but dbd packet seq no doesnt match. dbd seq ",
-				nbrDbPkt.dd_sequence_number, "nbr seq ", nbrConf.ospfNbrSeqNum))
-			msg.eventInfo = "SeqNumberMismatch . " + nbrConf.OspfNbrIPAddr.String()
-			server.DbEventOp <- msg
-			return true
-		}
-	} else {
-		if nbrDbPkt.dd_sequence_number != nbrConf.ospfNbrSeqNum {
-			server.logger.Info(fmt.Sprintln("NBREVENT:SeqNumberMismatch : Nbr is slave but dbd packet seq no doesnt match.dbd seq ",
-				nbrDbPkt.dd_sequence_number, "nbr seq ", nbrConf.ospfNbrSeqNum))
-			msg.eventInfo = "SeqNumberMismatch . " + nbrConf.OspfNbrIPAddr.String()
-			server.DbEventOp <- msg
-			return true
-		}
+	err := checkDDSequence(nbrConf.isMaster, nbrDbPkt.msbit, nbrDbPkt.ibit,
+		nbrDbPkt.dd_sequence_number, nbrConf.ospfNbrSeqNum)
+	if err != nil {
+		server.logger.Info(fmt.Sprintln("NBREVENT:", err, "dbd msbit ", nbrDbPkt.msbit, " isMaster ",
+			nbrConf.isMaster, " dbd seq ", nbrDbPkt.dd_sequence_number, " nbr seq ", nbrConf.ospfNbrSeqNum))
+		msg.eventInfo = err.Error() + " " + nbrConf.OspfNbrIPAddr.String()
+		server.DbEventOp <- msg
+		return true
 	}
-
 	return false
 }
 
@@ -98,11 +74,9 @@ func (server *OSPFServer) verifyDuplicatePacket(nbrConf OspfNeighborEntry, nbrDb
 	return
 }
 func (server *OSPFServer) adjacancyEstablishementCheck(isNbrDRBDR bool, isRtrDRBDR bool) (result bool) {
-	if isNbrDRBDR || isRtrDRBDR {
-		return true
-	}
-	/* TODO - check if n/w is p2p , p2mp, virtual link */
-	return false
+	/* TODO - pass the network type for p2p , p2mp. Virtual links use
+	   the point-to-point interface FSM and always form adjacencies */
+	return shouldFormAdjacency(config.Broadcast, isRtrDRBDR, isNbrDRBDR)
 }
 
 func (server *OSPFServer) processNeighborExstart(nbrKey NeighborConfKey, nbrConf OspfNeighborEntry, nbrDbPkt ospfDatabaseDescriptionData) {
@@ -172,6 +146,9 @@ func (server *OSPFServer) processNeighborExstart(nbrKey NeighborConfKey, nbrConf
 
 	var lsa_attach uint8
 	if negotiationDone {
+		/* RFC 5250 4: neighbor's O-bit decides if opaque LSAs are exchanged */
+		nbrConf.OspfNbrOptions = int(nbrDbPkt.options)
+		server.NeighborConfigMap[nbrKey] = nbrConf
 		//server.logger.Info(fmt.Sprintln("DBD: (Exstart) lsa_headers = ", len(nbrDbPkt.lsa_headers)))
 		server.generateDbSummaryList(nbrKey)
 		if nbrConf.isMaster != true { // i am the master
@@ -475,7 +452,7 @@ func (server *OSPFServer) ProcessNbrStateMachine() {
 							isStateUpdate = true
 						}
 					}
-				} else {
+				} else if !server.isGraceHelping(nbrKey) {
 					nbrConf.OspfNbrState = config.NbrInit
 					isStateUpdate = true
 				}
@@ -749,9 +726,23 @@ func (server *OSPFServer) generateDbSummaryList(nbrConfKey NeighborConfKey) {
 		db_list = append(db_list, summary4_list...)
 	}
 
-	asExternal_list := server.generateDbasExternalList(areaId)
-	if asExternal_list != nil {
-		db_list = append(db_list, asExternal_list...)
+	/* RFC 2328 10.3: AS-external-LSAs are omitted from virtual
+	   neighbor's database summary list */
+	if intf.IfType != config.VirtualLink {
+		asExternal_list := server.generateDbasExternalList(areaId)
+		if asExternal_list != nil {
+			db_list = append(db_list, asExternal_list...)
+		}
+	}
+
+	nssa_list := server.generateDbNssaLsaList(areaId)
+	if nssa_list != nil {
+		db_list = append(db_list, nssa_list...)
+	}
+
+	opaque_list := server.generateDbOpaqueLsaList(areaId, nbrConf, intf)
+	if opaque_list != nil {
+		db_list = append(db_list, opaque_list...)
 	}
 
 	for lsa := range db_list {
@@ -802,6 +793,43 @@ func (server *OSPFServer) generateDbasExternalList(self_areaId uint32) []*ospfNe
 	return db_list
 }
 
+/*@fn generateDbNssaLsaList
+This function generates NSSA LSA list if the area is NSSA
+*/
+func (server *OSPFServer) generateDbNssaLsaList(self_areaId uint32) []*ospfNeighborDBSummary {
+	if !server.isNssaArea(config.AreaId(convertUint32ToIPv4(self_areaId))) {
+		return nil
+	}
+	db_list := []*ospfNeighborDBSummary{}
+	lsdbKey := LsdbKey{
+		AreaId: self_areaId,
+	}
+
+	area_lsa, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		server.logger.Err(fmt.Sprintln("negotiation: NSSA LSA doesnt exist"))
+		return nil
+	}
+
+	for lsaKey, _ := range area_lsa.NSSALsaMap {
+		db_nssa := newospfNeighborDBSummary()
+		dnlsa, ret := server.getNSSALsaFromLsdb(self_areaId, lsaKey)
+		if ret == LsdbEntryNotFound {
+			continue
+		}
+		db_nssa.lsa_headers = getLsaHeaderFromLsa(dnlsa.LsaMd.LSAge, dnlsa.LsaMd.Options,
+			NSSALSA, lsaKey.LSId, lsaKey.AdvRouter,
+			uint32(dnlsa.LsaMd.LSSequenceNum), dnlsa.LsaMd.LSChecksum,
+			dnlsa.LsaMd.LSLen)
+		db_nssa.valid = true
+		/* add entry to the db summary list  */
+		db_list = append(db_list, db_nssa)
+		lsid := convertUint32ToIPv4(lsaKey.LSId)
+		server.logger.Info(fmt.Sprintln("negotiation: db_list NSSA append lsid  ", lsid))
+	}
+	return db_list
+}
+
 /* @fn generateDbsummaryLsaList
 This function will attach summary LSAs if the router is ABR
 */
@@ -917,6 +945,12 @@ func (server *OSPFServer) neighborDeadTimerEvent(nbrConfKey NeighborConfKey) {
 		server.logger.Info(fmt.Sprintln("NBRSCAN: DEAD ", nbrConfKey.IPAddr))
 
 		_, exists := server.NeighborConfigMap[nbrConfKey]
+		if exists && server.isGraceHelping(nbrConfKey) {
+			server.logger.Info(fmt.Sprintln("NBRSCAN: Neighbor is restarting. Keep adjacency ", nbrConfKey.IPAddr))
+			nbrConf := server.NeighborConfigMap[nbrConfKey]
+			nbrConf.NbrDeadTimer.Reset(nbrConf.OspfNbrDeadTimer)
+			return
+		}
 		if exists {
 			nbrConf := server.NeighborConfigMap[nbrConfKey]
 			msg := DbEventMsg{
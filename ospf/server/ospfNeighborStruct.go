@@ -54,6 +54,8 @@ const (
 	LSASUMMARYFLOOD = 4 //flood summary LSAs in different areas.
 	LSAEXTFLOOD     = 5 //flood AS External summary LSA
 	LSAROUTERFLOOD  = 6 //flood only router LSA
+	LSANSSAFLOOD    = 7 //flood NSSA LSA within the area
+	LSAOPAQUEFLOOD  = 8 //flood opaque LSA within its scope
 )
 
 type NeighborConfKey struct {
@@ -196,6 +198,7 @@ func (server *OSPFServer) UpdateNeighborConf() {
 			var nbrConf OspfNeighborEntry
 			//server.logger.Info(fmt.Sprintln("Update neighbor conf.  received"))
 			if nbrMsg.nbrMsgType == NBRDEL {
+				server.clearNbrCryptoSeqNum(nbrMsg.ospfNbrConfKey)
 				delete(server.NeighborConfigMap, nbrMsg.ospfNbrConfKey)
 				server.logger.Info(fmt.Sprintln("DELETE neighbor with nbr id - ",
 					nbrMsg.ospfNbrConfKey.IPAddr, nbrMsg.ospfNbrConfKey.IntfIdx))
@@ -0,0 +1,467 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"l3/ospf/config"
+	"time"
+)
+
+/* RFC 3101 TranslatorStabilityInterval in seconds */
+const NssaTranslatorStabilityInterval = 40
+
+/*
+@fn getNssaFwdAddr
+RFC 3101 2.3: type-7 LSAs with the P-bit set carry the
+address of one of the router's active interfaces in the
+NSSA as forwarding address. Highest address is picked so
+that refreshes keep the same forwarding address.
+*/
+func (server *OSPFServer) getNssaFwdAddr(areaId uint32) uint32 {
+	fwdAddr := uint32(0)
+	for _, ent := range server.IntfConfMap {
+		if ent.IfAreaId == nil || ent.IfIpAddr == nil {
+			continue
+		}
+		if convertIPv4ToUint32(ent.IfAreaId) != areaId ||
+			ent.IfFSMState <= config.Down {
+			continue
+		}
+		ipAddr := convertAreaOrRouterIdUint32(ent.IfIpAddr.String())
+		if ipAddr > fwdAddr {
+			fwdAddr = ipAddr
+		}
+	}
+	return fwdAddr
+}
+
+func (server *OSPFServer) generateNssaLsa(route RouteMdata, areaId uint32) LsaKey {
+	server.logger.Info(fmt.Sprintln("LSDB: Generating NSSA LSA routemdata ", route, " area ", areaId))
+
+	AdvRouter := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	lsaKey := LsaKey{
+		LSType:    NSSALSA,
+		LSId:      route.ipaddr & route.mask,
+		AdvRouter: AdvRouter,
+	}
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		server.logger.Err(fmt.Sprintln("LSDB: Area LSDB doesnt exist. No NSSA LSA will be generated .. ", lsdbKey))
+		return lsaKey
+	}
+	selfOrigLsaEnt, _ := server.AreaSelfOrigLsa[lsdbKey]
+	ent, exist := lsDbEnt.NSSALsaMap[lsaKey]
+	if route.isDel {
+		if exist {
+			ent.LsaMd.LSAge = config.MaxAge
+			lsDbEnt.NSSALsaMap[lsaKey] = ent
+			server.AreaLsdb[lsdbKey] = lsDbEnt
+			delete(selfOrigLsaEnt, lsaKey)
+		}
+		return lsaKey
+	}
+
+	/* RFC 3101 2.4: NSSA border routers originate type-7 LSAs
+	with the P-bit clear. The P-bit needs a forwarding address. */
+	var options uint8
+	fwdAddr := uint32(0)
+	if !server.ospfGlobalConf.AreaBdrRtrStatus {
+		fwdAddr = server.getNssaFwdAddr(areaId)
+		if fwdAddr != 0 {
+			options = NPOption
+		}
+	}
+	if !exist {
+		ent.LsaMd.LSSequenceNum = InitialSequenceNumber
+	} else {
+		ent.LsaMd.LSSequenceNum = ent.LsaMd.LSSequenceNum + 1
+	}
+	ent.LsaMd.LSChecksum = 0
+	ent.LsaMd.Options = options
+	ent.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + 16)
+	ent.BitE = true
+	ent.FwdAddr = fwdAddr
+	ent.Metric = route.metric
+	ent.Netmask = route.mask
+	ent.ExtRouteTag = 0
+
+	LsaEnc := encodeASExternalLsa(ent, lsaKey)
+	checksumOffset := uint16(14)
+	ent.LsaMd.LSChecksum = computeFletcherChecksum(LsaEnc[2:], checksumOffset)
+	ent.LsaMd.LSAge = 0
+	lsDbEnt.NSSALsaMap[lsaKey] = ent
+	server.AreaLsdb[lsdbKey] = lsDbEnt
+
+	selfOrigLsaEnt[lsaKey] = true
+	server.AreaSelfOrigLsa[lsdbKey] = selfOrigLsaEnt
+	server.logger.Info(fmt.Sprintln("NSSA: Added LSA to area ", lsdbKey, " lsaKey ", lsaKey))
+	if !exist {
+		var val LsdbSliceEnt
+		val.AreaId = lsdbKey.AreaId
+		val.LSType = lsaKey.LSType
+		val.LSId = lsaKey.LSId
+		val.AdvRtr = lsaKey.AdvRouter
+		server.LsdbSlice = append(server.LsdbSlice, val)
+		msg := DbLsdbMsg{
+			entry: val,
+			op:    true,
+		}
+		server.DbLsdbOp <- msg
+	}
+	return lsaKey
+}
+
+func (server *OSPFServer) updateNssaLsa(lsdbKey LsdbKey, lsaKey LsaKey) {
+	lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		return
+	}
+	ent, valid := lsDbEnt.NSSALsaMap[lsaKey]
+	if !valid {
+		server.logger.Warning(fmt.Sprintln("LSDB: NSSA LSA doesnt exist lsdb ", lsdbKey, lsaKey))
+		return
+	}
+	ent.LsaMd.LSSequenceNum = ent.LsaMd.LSSequenceNum + 1
+	ent.LsaMd.LSChecksum = 0
+	LsaEnc := encodeASExternalLsa(ent, lsaKey)
+	checksumOffset := uint16(14)
+	ent.LsaMd.LSChecksum = computeFletcherChecksum(LsaEnc[2:], checksumOffset)
+	ent.LsaMd.LSAge = 0
+	lsDbEnt.NSSALsaMap[lsaKey] = ent
+	server.AreaLsdb[lsdbKey] = lsDbEnt
+}
+
+/*
+@fn processNssaLSAFlood
+Type-7 LSAs are flooded only within the NSSA they
+were originated in.
+*/
+func (server *OSPFServer) processNssaLSAFlood(areaId uint32, lsakey LsaKey) {
+	var lsaEncPkt []byte
+
+	entry, ret := server.getNSSALsaFromLsdb(areaId, lsakey)
+	if ret == LsdbEntryNotFound {
+		server.logger.Info(fmt.Sprintln("NSSA: Lsa not found . Area",
+			areaId, " LSA key ", lsakey))
+		return
+	}
+	LsaEnc := encodeASExternalLsa(entry, lsakey)
+	pktLen := len(LsaEnc)
+	checksumOffset := uint16(14)
+	checkSum := computeFletcherChecksum(LsaEnc[2:], checksumOffset)
+	binary.BigEndian.PutUint16(LsaEnc[16:18], checkSum)
+	binary.BigEndian.PutUint16(LsaEnc[18:20], uint16(pktLen))
+
+	no_lsas := uint32(1)
+	lsas_enc := make([]byte, 4)
+	binary.BigEndian.PutUint32(lsas_enc, no_lsas)
+	lsaEncPkt = append(lsaEncPkt, lsas_enc...)
+	lsaEncPkt = append(lsaEncPkt, LsaEnc...)
+	lsid := convertUint32ToIPv4(lsakey.LSId)
+	server.logger.Info(fmt.Sprintln("NSSA: flood lsid ", lsid, " area ", areaId))
+	server.floodSummaryLsa(lsaEncPkt, areaId)
+}
+
+/*
+@fn isNssaTranslatorCandidateElected
+RFC 3101 3.1: a Candidate translates if no other reachable
+NSSA border router has the Nt bit set and it has the highest
+router id among the reachable NSSA border routers.
+Must be called while the area routing table is populated.
+*/
+func (server *OSPFServer) isNssaTranslatorCandidateElected(areaId uint32) bool {
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		return false
+	}
+	areaIdKey := AreaIdKey{
+		AreaId: areaId,
+	}
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	for lsaKey, lsaEnt := range lsDbEnt.RouterLsaMap {
+		if lsaKey.AdvRouter == rtrId ||
+			lsaEnt.LsaMd.LSAge == config.MaxAge {
+			continue
+		}
+		if !lsaEnt.BitB && !lsaEnt.BitNt {
+			continue
+		}
+		rKey := RoutingTblEntryKey{
+			DestId:   lsaKey.AdvRouter,
+			AddrMask: 0,
+			DestType: AreaBdrRouter,
+		}
+		_, reachable := tempAreaRoutingTbl.RoutingTblMap[rKey]
+		if !reachable {
+			rKey.DestType = ASAreaBdrRouter
+			_, reachable = tempAreaRoutingTbl.RoutingTblMap[rKey]
+		}
+		if !reachable {
+			continue
+		}
+		if lsaEnt.BitNt || lsaKey.AdvRouter > rtrId {
+			server.logger.Info(fmt.Sprintln("NSSA: Translator election lost to ", convertUint32ToIPv4(lsaKey.AdvRouter), " area ", areaId))
+			return false
+		}
+	}
+	return true
+}
+
+/*
+@fn nssaTranslatorElection
+Update the translator state of an NSSA after its SPF run.
+A translator which loses the election keeps translating for
+NssaTranslatorStabilityInterval.
+*/
+func (server *OSPFServer) nssaTranslatorElection(areaKey AreaConfKey, areaId uint32) {
+	areaConf, exist := server.AreaConfMap[areaKey]
+	if !exist {
+		return
+	}
+	isNssaAbr := server.ospfGlobalConf.AreaBdrRtrStatus &&
+		areaConf.ImportAsExtern == config.ImportNssa
+	state := config.NssaTranslatorDisabled
+	if isNssaAbr {
+		if areaConf.AreaNssaTranslatorRole == config.Always {
+			state = config.NssaTranslatorEnabled
+		} else if server.isNssaTranslatorCandidateElected(areaId) {
+			state = config.NssaTranslatorElected
+		}
+	}
+
+	areaState, _ := server.AreaStateMap[areaKey]
+	if state != config.NssaTranslatorDisabled {
+		areaState.nssaTranslatorExpiry = time.Time{}
+	} else if isNssaAbr &&
+		areaState.AreaNssaTranslatorState == config.NssaTranslatorElected {
+		if areaState.nssaTranslatorExpiry.IsZero() {
+			areaState.nssaTranslatorExpiry = time.Now().Add(time.Duration(NssaTranslatorStabilityInterval) * time.Second)
+		}
+		if time.Now().Before(areaState.nssaTranslatorExpiry) {
+			state = config.NssaTranslatorElected
+		}
+	}
+	if state == areaState.AreaNssaTranslatorState {
+		server.AreaStateMap[areaKey] = areaState
+		return
+	}
+	server.logger.Info(fmt.Sprintln("NSSA: Translator state change area ", areaKey.AreaId,
+		" old ", areaState.AreaNssaTranslatorState, " new ", state))
+	areaState.AreaNssaTranslatorState = state
+	areaState.AreaNssaTranslatorEvents++
+	areaState.nssaTranslatorExpiry = time.Time{}
+	server.AreaStateMap[areaKey] = areaState
+}
+
+/*
+@fn isPreferredNssaLsa
+Choose between type-7 LSAs for the same destination (RFC 3101 2.5).
+Type 1 metric is preferred over type 2, then lower metric and
+then the larger forwarding address.
+*/
+func isPreferredNssaLsa(lsa ASExternalLsa, curLsa ASExternalLsa) bool {
+	if lsa.BitE != curLsa.BitE {
+		return !lsa.BitE
+	}
+	if lsa.Metric != curLsa.Metric {
+		return lsa.Metric < curLsa.Metric
+	}
+	return lsa.FwdAddr > curLsa.FwdAddr
+}
+
+/*
+@fn GenerateNssaTranslatedLsa
+RFC 3101 3.2: the translator of an NSSA translates type-7
+LSAs which have the P-bit set and a non zero forwarding
+address into type-5 LSAs.
+*/
+func (server *OSPFServer) GenerateNssaTranslatedLsa() {
+	server.NssaTranslatedLsDb = make(map[LsaKey]ASExternalLsa)
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	for areaKey, areaState := range server.AreaStateMap {
+		if areaState.AreaNssaTranslatorState != config.NssaTranslatorEnabled &&
+			areaState.AreaNssaTranslatorState != config.NssaTranslatorElected {
+			continue
+		}
+		if !server.isNssaArea(areaKey.AreaId) {
+			continue
+		}
+		lsdbKey := LsdbKey{
+			AreaId: convertAreaOrRouterIdUint32(string(areaKey.AreaId)),
+		}
+		lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+		if !exist {
+			continue
+		}
+		for lsaKey, lsaEnt := range lsDbEnt.NSSALsaMap {
+			if lsaKey.AdvRouter == rtrId ||
+				lsaEnt.LsaMd.Options&NPOption == 0 ||
+				lsaEnt.FwdAddr == 0 ||
+				lsaEnt.Metric >= LSInfinity ||
+				lsaEnt.LsaMd.LSAge == config.MaxAge {
+				continue
+			}
+			tKey := LsaKey{
+				LSType:    ASExternalLSA,
+				LSId:      lsaKey.LSId & lsaEnt.Netmask,
+				AdvRouter: rtrId,
+			}
+			tEnt, exist := server.NssaTranslatedLsDb[tKey]
+			if exist && !isPreferredNssaLsa(lsaEnt, tEnt) {
+				continue
+			}
+			tEnt.LsaMd.Options = EOption
+			tEnt.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + 16)
+			tEnt.Netmask = lsaEnt.Netmask
+			tEnt.BitE = lsaEnt.BitE
+			tEnt.Metric = lsaEnt.Metric
+			tEnt.FwdAddr = lsaEnt.FwdAddr
+			tEnt.ExtRouteTag = lsaEnt.ExtRouteTag
+			server.NssaTranslatedLsDb[tKey] = tEnt
+		}
+	}
+}
+
+func isTranslatedLsaChanged(lsa ASExternalLsa, curLsa ASExternalLsa) bool {
+	return curLsa.LsaMd.LSAge == config.MaxAge ||
+		lsa.Netmask != curLsa.Netmask ||
+		lsa.BitE != curLsa.BitE ||
+		lsa.Metric != curLsa.Metric ||
+		lsa.FwdAddr != curLsa.FwdAddr ||
+		lsa.ExtRouteTag != curLsa.ExtRouteTag
+}
+
+/*
+@fn insertNssaTranslatedLsa
+Install translated type-5 LSA in all areas which accept
+AS external LSAs. Returns true if the LSA needs to be flooded.
+*/
+func (server *OSPFServer) insertNssaTranslatedLsa(lsaKey LsaKey, lsaEnt ASExternalLsa) bool {
+	changed := false
+	for lsdbKey, lsDbEnt := range server.AreaLsdb {
+		areaId := config.AreaId(convertUint32ToIPv4(lsdbKey.AreaId))
+		if server.isStubArea(areaId) || server.isNssaArea(areaId) {
+			continue
+		}
+		ent, exist := lsDbEnt.ASExternalLsaMap[lsaKey]
+		if exist && !isTranslatedLsaChanged(lsaEnt, ent) {
+			continue
+		}
+		if exist {
+			lsaEnt.LsaMd.LSSequenceNum = ent.LsaMd.LSSequenceNum + 1
+		} else {
+			lsaEnt.LsaMd.LSSequenceNum = InitialSequenceNumber
+		}
+		lsaEnt.LsaMd.LSChecksum = 0
+		LsaEnc := encodeASExternalLsa(lsaEnt, lsaKey)
+		checksumOffset := uint16(14)
+		lsaEnt.LsaMd.LSChecksum = computeFletcherChecksum(LsaEnc[2:], checksumOffset)
+		lsaEnt.LsaMd.LSAge = 0
+		lsDbEnt.ASExternalLsaMap[lsaKey] = lsaEnt
+		server.AreaLsdb[lsdbKey] = lsDbEnt
+
+		selfOrigLsaEnt, _ := server.AreaSelfOrigLsa[lsdbKey]
+		selfOrigLsaEnt[lsaKey] = true
+		server.AreaSelfOrigLsa[lsdbKey] = selfOrigLsaEnt
+		changed = true
+		if !exist {
+			var val LsdbSliceEnt
+			val.AreaId = lsdbKey.AreaId
+			val.LSType = lsaKey.LSType
+			val.LSId = lsaKey.LSId
+			val.AdvRtr = lsaKey.AdvRouter
+			server.LsdbSlice = append(server.LsdbSlice, val)
+			msg := DbLsdbMsg{
+				entry: val,
+				op:    true,
+			}
+			server.DbLsdbOp <- msg
+		}
+	}
+	return changed
+}
+
+/*
+@fn flushNssaTranslatedLsa
+Translated LSAs are flushed by setting them to MaxAge,
+the LSDB ticker floods and deletes them.
+*/
+func (server *OSPFServer) flushNssaTranslatedLsa(lsaKey LsaKey) {
+	server.logger.Info(fmt.Sprintln("NSSA: Flush translated LSA ", lsaKey))
+	for lsdbKey, lsDbEnt := range server.AreaLsdb {
+		ent, exist := lsDbEnt.ASExternalLsaMap[lsaKey]
+		if !exist {
+			continue
+		}
+		ent.LsaMd.LSAge = config.MaxAge
+		lsDbEnt.ASExternalLsaMap[lsaKey] = ent
+		server.AreaLsdb[lsdbKey] = lsDbEnt
+		selfOrigLsaEnt, _ := server.AreaSelfOrigLsa[lsdbKey]
+		delete(selfOrigLsaEnt, lsaKey)
+	}
+	delete(server.NssaTranslatedLsa, lsaKey)
+}
+
+func (server *OSPFServer) installNssaTranslatedLsa() {
+	if server.NssaTranslatedLsDb == nil {
+		return
+	}
+	ifkey := IntfConfKey{}
+	nbr := NeighborConfKey{}
+	for lsaKey, _ := range server.NssaTranslatedLsa {
+		if _, exist := server.NssaTranslatedLsDb[lsaKey]; !exist {
+			server.flushNssaTranslatedLsa(lsaKey)
+		}
+	}
+	for lsaKey, lsaEnt := range server.NssaTranslatedLsDb {
+		if !server.NssaTranslatedLsa[lsaKey] {
+			// Locally redistributed route takes precedence
+			redistributed := false
+			for _, selfOrigLsaEnt := range server.AreaSelfOrigLsa {
+				if selfOrigLsaEnt[lsaKey] {
+					redistributed = true
+					break
+				}
+			}
+			if redistributed {
+				continue
+			}
+		}
+		server.NssaTranslatedLsa[lsaKey] = true
+		if server.insertNssaTranslatedLsa(lsaKey, lsaEnt) {
+			server.logger.Info(fmt.Sprintln("NSSA: Send message to flood translated LSA ", lsaKey))
+			server.sendLsdbToNeighborEvent(ifkey, nbr, 0, 0, 0, lsaKey, LSAEXTFLOOD)
+		}
+	}
+	server.NssaTranslatedLsDb = nil
+}
@@ -0,0 +1,237 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"l3/ospf/config"
+	"testing"
+)
+
+const (
+	nssaTestRtrId  = uint32(0x0a010101)
+	nssaTestAreaId = uint32(1)
+)
+
+func initNssaTestParams(role config.NssaTranslatorRole) AreaConfKey {
+	ospf = getServerObject()
+	ospf.DbLsdbOp = make(chan DbLsdbMsg)
+	ospf.ospfGlobalConf.RouterId = []byte{10, 1, 1, 1}
+	ospf.ospfGlobalConf.AreaBdrRtrStatus = true
+	backboneKey := AreaConfKey{
+		AreaId: "0.0.0.0",
+	}
+	nssaKey := AreaConfKey{
+		AreaId: config.AreaId(convertUint32ToIPv4(nssaTestAreaId)),
+	}
+	ospf.AreaConfMap[backboneKey] = AreaConf{
+		ImportAsExtern: config.ImportExternal,
+	}
+	ospf.AreaConfMap[nssaKey] = AreaConf{
+		ImportAsExtern:         config.ImportNssa,
+		AreaNssaTranslatorRole: role,
+	}
+	ospf.AreaStateMap[nssaKey] = AreaState{
+		AreaNssaTranslatorState: config.NssaTranslatorDisabled,
+	}
+	ospf.initLSDatabase(0)
+	ospf.initLSDatabase(nssaTestAreaId)
+	ospf.TempAreaRoutingTbl[AreaIdKey{AreaId: nssaTestAreaId}] = AreaRoutingTbl{
+		RoutingTblMap: make(map[RoutingTblEntryKey]RoutingTblEntry),
+	}
+	go startDummyChannels(ospf)
+	return nssaKey
+}
+
+func addNssaTestAbr(advRtr uint32, bitNt bool) {
+	lsdbKey := LsdbKey{
+		AreaId: nssaTestAreaId,
+	}
+	lsaKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      advRtr,
+		AdvRouter: advRtr,
+	}
+	lsDbEnt := ospf.AreaLsdb[lsdbKey]
+	lsDbEnt.RouterLsaMap[lsaKey] = RouterLsa{
+		BitB:  true,
+		BitNt: bitNt,
+	}
+	rKey := RoutingTblEntryKey{
+		DestId:   advRtr,
+		AddrMask: 0,
+		DestType: AreaBdrRouter,
+	}
+	areaIdKey := AreaIdKey{
+		AreaId: nssaTestAreaId,
+	}
+	ospf.TempAreaRoutingTbl[areaIdKey].RoutingTblMap[rKey] = RoutingTblEntry{
+		PathType:   IntraArea,
+		NumOfPaths: 1,
+	}
+}
+
+func addNssaTestLsa(lsId uint32, advRtr uint32, options uint8, fwdAddr uint32, metric uint32) LsaKey {
+	lsaKey := LsaKey{
+		LSType:    NSSALSA,
+		LSId:      lsId,
+		AdvRouter: advRtr,
+	}
+	lsa := ASExternalLsa{
+		Netmask: 0xffffff00,
+		BitE:    true,
+		Metric:  metric,
+		FwdAddr: fwdAddr,
+	}
+	lsa.LsaMd.Options = options
+	lsa.LsaMd.LSSequenceNum = InitialSequenceNumber
+	lsa.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + 16)
+	lsdbKey := LsdbKey{
+		AreaId: nssaTestAreaId,
+	}
+	ospf.AreaLsdb[lsdbKey].NSSALsaMap[lsaKey] = lsa
+	return lsaKey
+}
+
+func TestOspfNssaLsaEncodeDecode(t *testing.T) {
+	lsaKey := LsaKey{
+		LSType:    NSSALSA,
+		LSId:      0x14010100,
+		AdvRouter: 0x0a010102,
+	}
+	lsa := ASExternalLsa{
+		Netmask:     0xffffff00,
+		BitE:        true,
+		Metric:      20,
+		FwdAddr:     0x0a010102,
+		ExtRouteTag: 7,
+	}
+	lsa.LsaMd.Options = NPOption
+	lsa.LsaMd.LSSequenceNum = InitialSequenceNumber
+	lsa.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + 16)
+	decLsa := NewASExternalLsa()
+	decKey := NewLsaKey()
+	decodeASExternalLsa(encodeASExternalLsa(lsa, lsaKey), decLsa, decKey)
+	if *decKey != lsaKey {
+		t.Error("NSSA LSA key mismatch", *decKey, lsaKey)
+	}
+	if decLsa.LsaMd.Options&NPOption == 0 || decLsa.Netmask != lsa.Netmask ||
+		!decLsa.BitE || decLsa.Metric != lsa.Metric ||
+		decLsa.FwdAddr != lsa.FwdAddr || decLsa.ExtRouteTag != lsa.ExtRouteTag {
+		t.Error("NSSA LSA mismatch", *decLsa, lsa)
+	}
+
+	rtrKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      0x0a010102,
+		AdvRouter: 0x0a010102,
+	}
+	rtrLsa := RouterLsa{
+		BitNt: true,
+		BitB:  true,
+	}
+	rtrLsa.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + 4)
+	decRtrLsa := NewRouterLsa()
+	decodeRouterLsa(encodeRouterLsa(rtrLsa, rtrKey), decRtrLsa, decKey)
+	if !decRtrLsa.BitNt || !decRtrLsa.BitB || decRtrLsa.BitE || decRtrLsa.BitV {
+		t.Error("Router LSA Nt bit mismatch", *decRtrLsa)
+	}
+}
+
+func TestOspfNssaTranslatorElection(t *testing.T) {
+	nssaKey := initNssaTestParams(config.Candidate)
+	addNssaTestAbr(nssaTestRtrId-1, false)
+	ospf.nssaTranslatorElection(nssaKey, nssaTestAreaId)
+	state := ospf.AreaStateMap[nssaKey]
+	if state.AreaNssaTranslatorState != config.NssaTranslatorElected ||
+		state.AreaNssaTranslatorEvents != 1 {
+		t.Error("Candidate with highest router id is not elected", state)
+	}
+
+	// A higher router id wins, the stability interval keeps translating
+	addNssaTestAbr(nssaTestRtrId+1, false)
+	ospf.nssaTranslatorElection(nssaKey, nssaTestAreaId)
+	state = ospf.AreaStateMap[nssaKey]
+	if state.AreaNssaTranslatorState != config.NssaTranslatorElected ||
+		state.nssaTranslatorExpiry.IsZero() {
+		t.Error("Translator stopped before stability interval", state)
+	}
+
+	initNssaTestParams(config.Candidate)
+	addNssaTestAbr(nssaTestRtrId-1, true)
+	ospf.nssaTranslatorElection(nssaKey, nssaTestAreaId)
+	state = ospf.AreaStateMap[nssaKey]
+	if state.AreaNssaTranslatorState != config.NssaTranslatorDisabled {
+		t.Error("Candidate elected while Nt bit router is reachable", state)
+	}
+
+	initNssaTestParams(config.Always)
+	addNssaTestAbr(nssaTestRtrId+1, true)
+	ospf.nssaTranslatorElection(nssaKey, nssaTestAreaId)
+	state = ospf.AreaStateMap[nssaKey]
+	if state.AreaNssaTranslatorState != config.NssaTranslatorEnabled {
+		t.Error("Always translator is not enabled", state)
+	}
+}
+
+func TestOspfNssaTranslation(t *testing.T) {
+	nssaKey := initNssaTestParams(config.Always)
+	ospf.nssaTranslatorElection(nssaKey, nssaTestAreaId)
+	addNssaTestLsa(0x14010100, 0x0a010102, NPOption, 0x0a010102, 30)
+	addNssaTestLsa(0x14010100, 0x0a010103, NPOption, 0x0a010103, 20)
+	addNssaTestLsa(0x14020200, 0x0a010102, 0, 0x0a010102, 20)
+	addNssaTestLsa(0x14030300, 0x0a010102, NPOption, 0, 20)
+
+	ospf.GenerateNssaTranslatedLsa()
+	tKey := LsaKey{
+		LSType:    ASExternalLSA,
+		LSId:      0x14010100,
+		AdvRouter: nssaTestRtrId,
+	}
+	if len(ospf.NssaTranslatedLsDb) != 1 {
+		t.Error("Unexpected translated LSAs", ospf.NssaTranslatedLsDb)
+	}
+	tLsa, exist := ospf.NssaTranslatedLsDb[tKey]
+	if !exist || tLsa.Metric != 20 || tLsa.FwdAddr != 0x0a010103 {
+		t.Error("Preferred NSSA LSA is not translated", tLsa)
+	}
+
+	ospf.installNssaTranslatedLsa()
+	if _, ret := ospf.getASExternalLsaFromLsdb(0, tKey); ret != LsdbEntryFound {
+		t.Error("Translated LSA not installed in backbone")
+	}
+	if _, ret := ospf.getASExternalLsaFromLsdb(nssaTestAreaId, tKey); ret != LsdbEntryNotFound {
+		t.Error("Translated LSA installed in NSSA")
+	}
+
+	// Translator disabled, translated LSA is flushed
+	ospf.AreaStateMap[nssaKey] = AreaState{
+		AreaNssaTranslatorState: config.NssaTranslatorDisabled,
+	}
+	ospf.GenerateNssaTranslatedLsa()
+	ospf.installNssaTranslatedLsa()
+	aLsa, _ := ospf.getASExternalLsaFromLsdb(0, tKey)
+	if aLsa.LsaMd.LSAge != config.MaxAge || ospf.NssaTranslatedLsa[tKey] {
+		t.Error("Translated LSA is not flushed", aLsa)
+	}
+}
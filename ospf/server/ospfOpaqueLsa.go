@@ -0,0 +1,756 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"l3/ospf/config"
+	"net"
+)
+
+/* RFC 5250: link state id is the opaque type followed by 24 bit opaque id */
+const (
+	OpaqueIdMask uint32 = 0x00ffffff
+
+	OpaqueLsaOriginate uint8 = 0
+	OpaqueLsaFlush     uint8 = 1
+
+	OpaqueLsaRecvd   uint8 = 0
+	OpaqueLsaFlushed uint8 = 1
+)
+
+/* LS Type 9, 10 or 11 */
+type OpaqueLsa struct {
+	LsaMd LsaMetadata
+	Data  []byte /* Opaque Information */
+}
+
+func NewOpaqueLsa() *OpaqueLsa {
+	return &OpaqueLsa{}
+}
+
+type OpaqueAppKey struct {
+	LSType     uint8
+	OpaqueType uint8
+}
+
+/* Passed to the registered application on receipt of its opaque LSA */
+type OpaqueLsaEvent struct {
+	EventType uint8
+	AreaId    uint32
+	IntfKey   IntfConfKey
+	NbrKey    NeighborConfKey
+	LsaKey    LsaKey
+	Lsa       OpaqueLsa
+	Pkt       []byte
+}
+
+/* Called from the packet rx thread. Must not block. */
+type OpaqueLsaHandler func(event OpaqueLsaEvent)
+
+/* The result of the request is returned on RetCh */
+type OpaqueLsaMsg struct {
+	MsgType    uint8
+	LSType     uint8
+	OpaqueType uint8
+	OpaqueId   uint32
+	AreaId     uint32
+	IntfKey    IntfConfKey
+	Data       []byte
+	RetCh      chan error
+}
+
+type OpaqueLsaEnt struct {
+	AreaId  uint32
+	IntfKey IntfConfKey
+	LsaKey  LsaKey
+	Lsa     OpaqueLsa
+}
+
+func isOpaqueLsa(lsType uint8) bool {
+	return lsType == LinkOpaqueLSA || lsType == AreaOpaqueLSA || lsType == ASOpaqueLSA
+}
+
+func getOpaqueType(lsId uint32) uint8 {
+	return uint8(lsId >> 24)
+}
+
+func getOpaqueLsId(opaqueType uint8, opaqueId uint32) uint32 {
+	return uint32(opaqueType)<<24 | (opaqueId & OpaqueIdMask)
+}
+
+func encodeOpaqueLsa(lsa OpaqueLsa, lsakey LsaKey) []byte {
+	lsa.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + len(lsa.Data))
+	lsaHdr := encodeLsaHeader(lsa.LsaMd, lsakey)
+	return append(lsaHdr, lsa.Data...)
+}
+
+func decodeOpaqueLsa(data []byte, lsa *OpaqueLsa, lsakey *LsaKey) {
+	lsa.LsaMd.LSAge = binary.BigEndian.Uint16(data[0:2])
+	lsa.LsaMd.Options = uint8(data[2])
+	lsakey.LSType = uint8(data[3])
+	lsakey.LSId = binary.BigEndian.Uint32(data[4:8])
+	lsakey.AdvRouter = binary.BigEndian.Uint32(data[8:12])
+	lsa.LsaMd.LSSequenceNum = int(binary.BigEndian.Uint32(data[12:16]))
+	lsa.LsaMd.LSChecksum = binary.BigEndian.Uint16(data[16:18])
+	lsa.LsaMd.LSLen = binary.BigEndian.Uint16(data[18:20])
+
+	end := int(lsa.LsaMd.LSLen)
+	if end > len(data) {
+		end = len(data)
+	}
+	if end < OSPF_LSA_HEADER_SIZE {
+		end = OSPF_LSA_HEADER_SIZE
+	}
+	lsa.Data = make([]byte, end-OSPF_LSA_HEADER_SIZE)
+	copy(lsa.Data, data[OSPF_LSA_HEADER_SIZE:end])
+}
+
+/*
+@fn getOpaqueLsaFromLsdb
+Link local opaque LSAs are looked up on the interface,
+area and AS scope ones in the area LSDB.
+*/
+func (server *OSPFServer) getOpaqueLsaFromLsdb(areaId uint32, intfKey IntfConfKey, lsaKey LsaKey) (lsa OpaqueLsa, retVal int) {
+	if lsaKey.LSType == LinkOpaqueLSA {
+		lsa, exist := server.LinkOpaqueLsdb[intfKey][lsaKey]
+		if !exist {
+			return lsa, LsdbEntryNotFound
+		}
+		return lsa, LsdbEntryFound
+	}
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		return lsa, LsdbEntryNotFound
+	}
+	lsa, exist = lsDbEnt.OpaqueLsaMap[lsaKey]
+	if !exist {
+		return lsa, LsdbEntryNotFound
+	}
+	return lsa, LsdbEntryFound
+}
+
+func (server *OSPFServer) getLinkOpaqueLsaInArea(areaId uint32, lsaKey LsaKey) (OpaqueLsa, bool) {
+	for intfKey, lsdb := range server.LinkOpaqueLsdb {
+		if convertIPv4ToUint32(server.IntfConfMap[intfKey].IfAreaId) != areaId {
+			continue
+		}
+		if lsa, exist := lsdb[lsaKey]; exist {
+			return lsa, true
+		}
+	}
+	return OpaqueLsa{}, false
+}
+
+/* AS scope opaque LSAs are kept in every area which accepts AS external LSAs */
+func (server *OSPFServer) isAsOpaqueArea(areaId uint32) bool {
+	areaIdStr := config.AreaId(convertUint32ToIPv4(areaId))
+	return !server.isStubArea(areaIdStr) && !server.isNssaArea(areaIdStr)
+}
+
+func (server *OSPFServer) installOpaqueLsa(areaId uint32, intfKey IntfConfKey, lsaKey LsaKey, lsa OpaqueLsa) {
+	switch lsaKey.LSType {
+	case LinkOpaqueLSA:
+		intf, exist := server.IntfConfMap[intfKey]
+		if !exist {
+			return
+		}
+		lsdb, exist := server.LinkOpaqueLsdb[intfKey]
+		if !exist {
+			lsdb = make(map[LsaKey]OpaqueLsa)
+			server.LinkOpaqueLsdb[intfKey] = lsdb
+		}
+		_, exist = lsdb[lsaKey]
+		lsdb[lsaKey] = lsa
+		if !exist {
+			server.addOpaqueLsdbSliceEnt(convertIPv4ToUint32(intf.IfAreaId), lsaKey)
+		}
+
+	case AreaOpaqueLSA:
+		server.installAreaOpaqueLsa(areaId, lsaKey, lsa)
+
+	case ASOpaqueLSA:
+		for lsdbKey, _ := range server.AreaLsdb {
+			if server.isAsOpaqueArea(lsdbKey.AreaId) {
+				server.installAreaOpaqueLsa(lsdbKey.AreaId, lsaKey, lsa)
+			}
+		}
+	}
+}
+
+func (server *OSPFServer) installAreaOpaqueLsa(areaId uint32, lsaKey LsaKey, lsa OpaqueLsa) {
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		return
+	}
+	_, exist = lsDbEnt.OpaqueLsaMap[lsaKey]
+	lsDbEnt.OpaqueLsaMap[lsaKey] = lsa
+	server.AreaLsdb[lsdbKey] = lsDbEnt
+	if !exist {
+		server.addOpaqueLsdbSliceEnt(areaId, lsaKey)
+	}
+}
+
+func (server *OSPFServer) addOpaqueLsdbSliceEnt(areaId uint32, lsaKey LsaKey) {
+	var val LsdbSliceEnt
+	val.AreaId = areaId
+	val.LSType = lsaKey.LSType
+	val.LSId = lsaKey.LSId
+	val.AdvRtr = lsaKey.AdvRouter
+	server.LsdbSlice = append(server.LsdbSlice, val)
+	msg := DbLsdbMsg{
+		entry: val,
+		op:    true,
+	}
+	server.DbLsdbOp <- msg
+}
+
+func (server *OSPFServer) deleteOpaqueLsa(areaId uint32, intfKey IntfConfKey, lsaKey LsaKey) {
+	var val LsdbSliceEnt
+	val.LSType = lsaKey.LSType
+	val.LSId = lsaKey.LSId
+	val.AdvRtr = lsaKey.AdvRouter
+	switch lsaKey.LSType {
+	case LinkOpaqueLSA:
+		lsdb, exist := server.LinkOpaqueLsdb[intfKey]
+		if !exist {
+			return
+		}
+		delete(lsdb, lsaKey)
+		if intf, exist := server.IntfConfMap[intfKey]; exist {
+			val.AreaId = convertIPv4ToUint32(intf.IfAreaId)
+			if err := server.DelLsdbEntry(val); err != nil {
+				server.logger.Info(fmt.Sprintln("DB: Failed to delete entry from db ", lsaKey))
+			}
+		}
+
+	case AreaOpaqueLSA, ASOpaqueLSA:
+		for lsdbKey, lsDbEnt := range server.AreaLsdb {
+			if lsaKey.LSType == AreaOpaqueLSA && lsdbKey.AreaId != areaId {
+				continue
+			}
+			if _, exist := lsDbEnt.OpaqueLsaMap[lsaKey]; !exist {
+				continue
+			}
+			delete(lsDbEnt.OpaqueLsaMap, lsaKey)
+			val.AreaId = lsdbKey.AreaId
+			if err := server.DelLsdbEntry(val); err != nil {
+				server.logger.Info(fmt.Sprintln("DB: Failed to delete entry from db ", lsaKey))
+			}
+		}
+	}
+}
+
+/*
+@fn processRecvdOpaqueLsa
+Install or flush opaque LSA received from the neighbor.
+Opaque LSAs do not take part in the SPF calculation.
+*/
+func (server *OSPFServer) processRecvdOpaqueLsa(data []byte, areaId uint32, intfKey IntfConfKey) bool {
+	lsakey := NewLsaKey()
+	lsa := NewOpaqueLsa()
+	decodeOpaqueLsa(data, lsa, lsakey)
+	csum := computeFletcherChecksum(data[2:], FLETCHER_CHECKSUM_VALIDATE)
+	if csum != 0 {
+		server.logger.Err("Invalid opaque LSA Checksum")
+		return false
+	}
+	if lsa.LsaMd.LSAge >= config.MaxAge {
+		server.logger.Info(fmt.Sprintln("OPAQUE: Flush opaque LSA ", lsakey))
+		server.deleteOpaqueLsa(areaId, intfKey, *lsakey)
+		return true
+	}
+	server.installOpaqueLsa(areaId, intfKey, *lsakey, *lsa)
+	return true
+}
+
+/*
+@fn RegisterOpaqueLsaApp
+Applications (TE, grace-LSA, router information) register
+for an LS type and opaque type. The handler is told about every
+new instance of the opaque LSA received from the neighbors.
+*/
+func (server *OSPFServer) RegisterOpaqueLsaApp(lsType uint8, opaqueType uint8, handler OpaqueLsaHandler) error {
+	if !isOpaqueLsa(lsType) {
+		return errors.New(fmt.Sprintln("Invalid opaque LS type ", lsType))
+	}
+	if handler == nil {
+		return errors.New("Nil opaque LSA handler")
+	}
+	appKey := OpaqueAppKey{
+		LSType:     lsType,
+		OpaqueType: opaqueType,
+	}
+	server.opaqueAppMutex.Lock()
+	defer server.opaqueAppMutex.Unlock()
+	if _, exist := server.OpaqueAppMap[appKey]; exist {
+		return errors.New(fmt.Sprintln("Opaque application already registered. LS type ", lsType,
+			" opaque type ", opaqueType))
+	}
+	server.OpaqueAppMap[appKey] = handler
+	server.logger.Info(fmt.Sprintln("OPAQUE: Registered application. LS type ", lsType, " opaque type ", opaqueType))
+	return nil
+}
+
+func (server *OSPFServer) UnregisterOpaqueLsaApp(lsType uint8, opaqueType uint8) {
+	appKey := OpaqueAppKey{
+		LSType:     lsType,
+		OpaqueType: opaqueType,
+	}
+	server.opaqueAppMutex.Lock()
+	delete(server.OpaqueAppMap, appKey)
+	server.opaqueAppMutex.Unlock()
+}
+
+func (server *OSPFServer) getOpaqueLsaApp(lsType uint8, opaqueType uint8) (OpaqueLsaHandler, bool) {
+	appKey := OpaqueAppKey{
+		LSType:     lsType,
+		OpaqueType: opaqueType,
+	}
+	server.opaqueAppMutex.RLock()
+	handler, exist := server.OpaqueAppMap[appKey]
+	server.opaqueAppMutex.RUnlock()
+	return handler, exist
+}
+
+func (server *OSPFServer) notifyOpaqueLsaApp(nbrKey NeighborConfKey, areaId uint32, intfKey IntfConfKey, data []byte) {
+	event := OpaqueLsaEvent{
+		EventType: OpaqueLsaRecvd,
+		AreaId:    areaId,
+		IntfKey:   intfKey,
+		NbrKey:    nbrKey,
+		Pkt:       data,
+	}
+	decodeOpaqueLsa(data, &event.Lsa, &event.LsaKey)
+	handler, exist := server.getOpaqueLsaApp(event.LsaKey.LSType, getOpaqueType(event.LsaKey.LSId))
+	if !exist {
+		return
+	}
+	if event.Lsa.LsaMd.LSAge >= config.MaxAge {
+		event.EventType = OpaqueLsaFlushed
+	}
+	handler(event)
+}
+
+/*
+@fn OriginateOpaqueLsa
+Originate or update self opaque LSA. areaId is used for area
+scope LSAs, intfKey for link local ones. Waits for the LSDB
+thread to validate the request. Must not be called from the LSDB
+thread.
+*/
+func (server *OSPFServer) OriginateOpaqueLsa(lsType uint8, opaqueType uint8, opaqueId uint32,
+	areaId uint32, intfKey IntfConfKey, data []byte) error {
+	msg := OpaqueLsaMsg{
+		MsgType:    OpaqueLsaOriginate,
+		LSType:     lsType,
+		OpaqueType: opaqueType,
+		OpaqueId:   opaqueId,
+		AreaId:     areaId,
+		IntfKey:    intfKey,
+		Data:       make([]byte, len(data)),
+		RetCh:      make(chan error, 1),
+	}
+	copy(msg.Data, data)
+	server.OpaqueLsaCh <- msg
+	return <-msg.RetCh
+}
+
+/*
+@fn FlushOpaqueLsa
+Flush self opaque LSA from the routing domain.
+Must not be called from the LSDB thread.
+*/
+func (server *OSPFServer) FlushOpaqueLsa(lsType uint8, opaqueType uint8, opaqueId uint32,
+	areaId uint32, intfKey IntfConfKey) error {
+	msg := OpaqueLsaMsg{
+		MsgType:    OpaqueLsaFlush,
+		LSType:     lsType,
+		OpaqueType: opaqueType,
+		OpaqueId:   opaqueId,
+		AreaId:     areaId,
+		IntfKey:    intfKey,
+		RetCh:      make(chan error, 1),
+	}
+	server.OpaqueLsaCh <- msg
+	return <-msg.RetCh
+}
+
+func (server *OSPFServer) opaqueLsaMsgCheck(msg OpaqueLsaMsg) error {
+	if !server.ospfGlobalConf.OpaqueLsaSupport {
+		return errors.New("Opaque LSA support disabled")
+	}
+	if !isOpaqueLsa(msg.LSType) {
+		return errors.New(fmt.Sprintln("Invalid opaque LS type ", msg.LSType))
+	}
+	if msg.OpaqueId > OpaqueIdMask {
+		return errors.New(fmt.Sprintln("Invalid opaque id ", msg.OpaqueId))
+	}
+	if _, exist := server.getOpaqueLsaApp(msg.LSType, msg.OpaqueType); !exist {
+		return errors.New(fmt.Sprintln("Opaque application not registered. LS type ", msg.LSType,
+			" opaque type ", msg.OpaqueType))
+	}
+	switch msg.LSType {
+	case LinkOpaqueLSA:
+		if _, exist := server.IntfConfMap[msg.IntfKey]; !exist {
+			return errors.New(fmt.Sprintln("Interface doesnt exist ", msg.IntfKey))
+		}
+	case AreaOpaqueLSA:
+		lsdbKey := LsdbKey{
+			AreaId: msg.AreaId,
+		}
+		if _, exist := server.AreaLsdb[lsdbKey]; !exist {
+			return errors.New(fmt.Sprintln("Area doesnt exist ", convertUint32ToIPv4(msg.AreaId)))
+		}
+	}
+	return nil
+}
+
+/*
+@fn processOpaqueLsaMsg
+Runs on the LSDB thread, which owns the interface and LSDB maps
+the request is validated against.
+*/
+func (server *OSPFServer) processOpaqueLsaMsg(msg OpaqueLsaMsg) error {
+	err := server.opaqueLsaMsgCheck(msg)
+	if err != nil {
+		server.logger.Info(fmt.Sprintln("OPAQUE: Discard request ", err))
+		return err
+	}
+	lsaKey := LsaKey{
+		LSType:    msg.LSType,
+		LSId:      getOpaqueLsId(msg.OpaqueType, msg.OpaqueId),
+		AdvRouter: convertIPv4ToUint32(server.ospfGlobalConf.RouterId),
+	}
+	switch msg.MsgType {
+	case OpaqueLsaOriginate:
+		server.originateOpaqueLsa(msg.AreaId, msg.IntfKey, lsaKey, msg.Data)
+	case OpaqueLsaFlush:
+		server.flushOpaqueLsa(msg.AreaId, msg.IntfKey, lsaKey)
+	}
+	return nil
+}
+
+/* AS scope LSAs are looked up in any area holding them */
+func (server *OSPFServer) getSelfOpaqueLsa(areaId uint32, intfKey IntfConfKey, lsaKey LsaKey) (OpaqueLsa, int) {
+	if lsaKey.LSType == ASOpaqueLSA {
+		for lsdbKey, lsDbEnt := range server.AreaLsdb {
+			if _, exist := lsDbEnt.OpaqueLsaMap[lsaKey]; exist {
+				return server.getOpaqueLsaFromLsdb(lsdbKey.AreaId, intfKey, lsaKey)
+			}
+		}
+		return OpaqueLsa{}, LsdbEntryNotFound
+	}
+	return server.getOpaqueLsaFromLsdb(areaId, intfKey, lsaKey)
+}
+
+func (server *OSPFServer) originateOpaqueLsa(areaId uint32, intfKey IntfConfKey, lsaKey LsaKey, data []byte) {
+	lsa := OpaqueLsa{
+		Data: data,
+	}
+	lsa.LsaMd.LSAge = 0
+	lsa.LsaMd.Options = INTF_OPTIONS
+	lsa.LsaMd.LSSequenceNum = InitialSequenceNumber
+	oldLsa, ret := server.getSelfOpaqueLsa(areaId, intfKey, lsaKey)
+	if ret == LsdbEntryFound {
+		lsa.LsaMd.LSSequenceNum = oldLsa.LsaMd.LSSequenceNum + 1
+	}
+	lsa.LsaMd.LSLen = uint16(OSPF_LSA_HEADER_SIZE + len(data))
+	lsaEnc := encodeOpaqueLsa(lsa, lsaKey)
+	lsa.LsaMd.LSChecksum = computeFletcherChecksum(lsaEnc[2:], uint16(14))
+	binary.BigEndian.PutUint16(lsaEnc[16:18], lsa.LsaMd.LSChecksum)
+
+	server.logger.Info(fmt.Sprintln("OPAQUE: Originate LSA type ", lsaKey.LSType,
+		" lsid ", convertUint32ToIPv4(lsaKey.LSId), " seq ", lsa.LsaMd.LSSequenceNum))
+	server.installOpaqueLsa(areaId, intfKey, lsaKey, lsa)
+	server.sendOpaqueLsaFloodMsg(areaId, intfKey, lsaKey, lsaEnc)
+}
+
+/*
+@fn flushOpaqueLsa
+RFC 5250 7: flush by flooding the LSA with MaxAge.
+*/
+func (server *OSPFServer) flushOpaqueLsa(areaId uint32, intfKey IntfConfKey, lsaKey LsaKey) {
+	lsa, ret := server.getSelfOpaqueLsa(areaId, intfKey, lsaKey)
+	if ret == LsdbEntryNotFound {
+		server.logger.Info(fmt.Sprintln("OPAQUE: Flush. LSA doesnt exist ", lsaKey))
+		return
+	}
+	lsa.LsaMd.LSAge = config.MaxAge
+	lsaEnc := encodeOpaqueLsa(lsa, lsaKey)
+	checkSum := computeFletcherChecksum(lsaEnc[2:], uint16(14))
+	binary.BigEndian.PutUint16(lsaEnc[16:18], checkSum)
+
+	server.logger.Info(fmt.Sprintln("OPAQUE: Flush LSA type ", lsaKey.LSType,
+		" lsid ", convertUint32ToIPv4(lsaKey.LSId)))
+	server.deleteOpaqueLsa(areaId, intfKey, lsaKey)
+	server.sendOpaqueLsaFloodMsg(areaId, intfKey, lsaKey, lsaEnc)
+}
+
+func (server *OSPFServer) sendOpaqueLsaFloodMsg(areaId uint32, intfKey IntfConfKey, lsaKey LsaKey, lsaEnc []byte) {
+	flood_pkt := ospfFloodMsg{
+		intfKey: intfKey,
+		areaId:  areaId,
+		lsType:  lsaKey.LSType,
+		linkid:  lsaKey.LSId,
+		lsaKey:  lsaKey,
+		lsOp:    LSAOPAQUEFLOOD,
+		pkt:     lsaEnc,
+	}
+	server.ospfNbrLsaUpdSendCh <- flood_pkt
+}
+
+/*
+@fn refreshSelfOpaqueLsa
+Re-originate self opaque LSAs every LSRefreshTime.
+*/
+func (server *OSPFServer) refreshSelfOpaqueLsa() {
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	var refreshList []OpaqueLsaEnt
+	for intfKey, lsdb := range server.LinkOpaqueLsdb {
+		for lsaKey, lsa := range lsdb {
+			if lsaKey.AdvRouter == rtrId {
+				refreshList = append(refreshList, OpaqueLsaEnt{IntfKey: intfKey, LsaKey: lsaKey, Lsa: lsa})
+			}
+		}
+	}
+	asLsa := make(map[LsaKey]bool)
+	for lsdbKey, lsDbEnt := range server.AreaLsdb {
+		for lsaKey, lsa := range lsDbEnt.OpaqueLsaMap {
+			if lsaKey.AdvRouter != rtrId || asLsa[lsaKey] {
+				continue
+			}
+			if lsaKey.LSType == ASOpaqueLSA {
+				asLsa[lsaKey] = true
+			}
+			refreshList = append(refreshList, OpaqueLsaEnt{AreaId: lsdbKey.AreaId, LsaKey: lsaKey, Lsa: lsa})
+		}
+	}
+	for _, ent := range refreshList {
+		server.originateOpaqueLsa(ent.AreaId, ent.IntfKey, ent.LsaKey, ent.Lsa.Data)
+	}
+}
+
+/*
+@fn processMaxAgeLinkOpaqueLsa
+Link local opaque LSAs are aged per interface. They are
+only known on the link so they are removed without flooding.
+*/
+func (server *OSPFServer) processMaxAgeLinkOpaqueLsa() {
+	for intfKey, lsdb := range server.LinkOpaqueLsdb {
+		for lsaKey, lsa := range lsdb {
+			if lsa.LsaMd.LSAge >= config.MaxAge {
+				server.logger.Info(fmt.Sprintln("DELETE: Max age reached. link opaque LSA ",
+					convertUint32ToIPv4(lsaKey.LSId), " adv_router ", convertUint32ToIPv4(lsaKey.AdvRouter)))
+				server.deleteOpaqueLsa(0, intfKey, lsaKey)
+				continue
+			}
+			lsa.LsaMd.LSAge++
+			lsdb[lsaKey] = lsa
+		}
+	}
+}
+
+/*
+@fn GetOpaqueLsa
+LSDB get API for a single opaque LSA.
+*/
+func (server *OSPFServer) GetOpaqueLsa(areaId uint32, intfKey IntfConfKey, lsaKey LsaKey) (OpaqueLsa, error) {
+	if !isOpaqueLsa(lsaKey.LSType) {
+		return OpaqueLsa{}, errors.New(fmt.Sprintln("Invalid opaque LS type ", lsaKey.LSType))
+	}
+	lsa, ret := server.getSelfOpaqueLsa(areaId, intfKey, lsaKey)
+	if ret == LsdbEntryNotFound {
+		return lsa, errors.New(fmt.Sprintln("Opaque LSA doesnt exist ", lsaKey))
+	}
+	return lsa, nil
+}
+
+/*
+@fn GetOpaqueLsaList
+LSDB get API returning all the opaque LSAs of given LS type
+and opaque type. AS scope LSAs are returned once.
+*/
+func (server *OSPFServer) GetOpaqueLsaList(lsType uint8, opaqueType uint8) []OpaqueLsaEnt {
+	var lsaList []OpaqueLsaEnt
+	switch lsType {
+	case LinkOpaqueLSA:
+		for intfKey, lsdb := range server.LinkOpaqueLsdb {
+			areaId := convertIPv4ToUint32(server.IntfConfMap[intfKey].IfAreaId)
+			for lsaKey, lsa := range lsdb {
+				if getOpaqueType(lsaKey.LSId) == opaqueType {
+					lsaList = append(lsaList, OpaqueLsaEnt{AreaId: areaId, IntfKey: intfKey, LsaKey: lsaKey, Lsa: lsa})
+				}
+			}
+		}
+	case AreaOpaqueLSA, ASOpaqueLSA:
+		asLsa := make(map[LsaKey]bool)
+		for lsdbKey, lsDbEnt := range server.AreaLsdb {
+			for lsaKey, lsa := range lsDbEnt.OpaqueLsaMap {
+				if lsaKey.LSType != lsType || getOpaqueType(lsaKey.LSId) != opaqueType || asLsa[lsaKey] {
+					continue
+				}
+				if lsType == ASOpaqueLSA {
+					asLsa[lsaKey] = true
+				}
+				lsaList = append(lsaList, OpaqueLsaEnt{AreaId: lsdbKey.AreaId, LsaKey: lsaKey, Lsa: lsa})
+			}
+		}
+	}
+	return lsaList
+}
+
+/*
+@fn generateDbOpaqueLsaList
+Opaque LSAs are described only to opaque capable neighbors.
+*/
+func (server *OSPFServer) generateDbOpaqueLsaList(areaId uint32, nbrConf OspfNeighborEntry, intf IntfConf) []*ospfNeighborDBSummary {
+	if !server.isNbrOpaqueCapable(nbrConf) {
+		return nil
+	}
+	db_list := []*ospfNeighborDBSummary{}
+	var lsaList []OpaqueLsaEnt
+	for lsaKey, lsa := range server.LinkOpaqueLsdb[nbrConf.intfConfKey] {
+		lsaList = append(lsaList, OpaqueLsaEnt{LsaKey: lsaKey, Lsa: lsa})
+	}
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	for lsaKey, lsa := range server.AreaLsdb[lsdbKey].OpaqueLsaMap {
+		/* RFC 5250 3.2: AS scope LSAs follow AS-external-LSA rules */
+		if lsaKey.LSType == ASOpaqueLSA && intf.IfType == config.VirtualLink {
+			continue
+		}
+		lsaList = append(lsaList, OpaqueLsaEnt{LsaKey: lsaKey, Lsa: lsa})
+	}
+	for _, ent := range lsaList {
+		db_opaque := newospfNeighborDBSummary()
+		db_opaque.lsa_headers = getLsaHeaderFromLsa(ent.Lsa.LsaMd.LSAge, ent.Lsa.LsaMd.Options,
+			ent.LsaKey.LSType, ent.LsaKey.LSId, ent.LsaKey.AdvRouter,
+			uint32(ent.Lsa.LsaMd.LSSequenceNum), ent.Lsa.LsaMd.LSChecksum,
+			ent.Lsa.LsaMd.LSLen)
+		db_opaque.valid = true
+		db_list = append(db_list, db_opaque)
+	}
+	return db_list
+}
+
+func (server *OSPFServer) isNbrOpaqueCapable(nbrConf OspfNeighborEntry) bool {
+	return server.ospfGlobalConf.OpaqueLsaSupport && (nbrConf.OspfNbrOptions&OOption) != 0
+}
+
+/* Flood opaque LSA only on the interfaces with an opaque capable neighbor */
+func (server *OSPFServer) opaqueIntfFloodCheck(key IntfConfKey) bool {
+	nbrData, exist := ospfIntfToNbrMap[key]
+	if !exist {
+		return false
+	}
+	for _, nbrKey := range nbrData.nbrList {
+		nbrConf := server.NeighborConfigMap[nbrKey]
+		if nbrConf.OspfNbrState >= config.NbrExchange && server.isNbrOpaqueCapable(nbrConf) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+@fn opaqueFloodScopeCheck
+RFC 5250 3.1: type 9 is flooded on the link, type 10 within
+the area and type 11 throughout the AS except stub areas.
+*/
+func (server *OSPFServer) opaqueFloodScopeCheck(lsa_data ospfFloodMsg, key IntfConfKey, intf IntfConf) bool {
+	switch lsa_data.lsType {
+	case LinkOpaqueLSA:
+		return key == lsa_data.intfKey
+	case AreaOpaqueLSA:
+		return convertIPv4ToUint32(intf.IfAreaId) == lsa_data.areaId
+	case ASOpaqueLSA:
+		if intf.IfType == config.VirtualLink {
+			return false
+		}
+		return server.isAsOpaqueArea(convertIPv4ToUint32(intf.IfAreaId))
+	}
+	return false
+}
+
+/*
+@fn processOpaqueLSAFlood
+Flood self originated or received opaque LSA within its scope.
+Received LSAs are not sent back on the receiving interface.
+*/
+func (server *OSPFServer) processOpaqueLSAFlood(lsa_data ospfFloodMsg) {
+	if lsa_data.pkt == nil {
+		return
+	}
+	dstMac := net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x05}
+	dstIp := net.IP{224, 0, 0, 5}
+	rxNbr, rxExist := server.NeighborConfigMap[lsa_data.nbrKey]
+
+	lsas_enc := make([]byte, 4)
+	binary.BigEndian.PutUint32(lsas_enc, 1)
+	lsaEncPkt := append(lsas_enc, lsa_data.pkt...)
+	for key, intf := range server.IntfConfMap {
+		if rxExist && key == rxNbr.intfConfKey {
+			continue
+		}
+		if !server.opaqueFloodScopeCheck(lsa_data, key, intf) || !server.opaqueIntfFloodCheck(key) {
+			continue
+		}
+		server.logger.Info(fmt.Sprintln("OPAQUE: Flood LSA type ", lsa_data.lsType, " lsid ",
+			convertUint32ToIPv4(lsa_data.linkid), " on intf ", intf.IfIpAddr))
+		pkt := server.BuildLsaUpdPkt(key, intf, dstMac, dstIp, len(lsaEncPkt), lsaEncPkt)
+		server.SendOspfPkt(key, pkt)
+	}
+}
+
+func (server *OSPFServer) sanityCheckOpaqueLsa(lsaKey LsaKey, olsa OpaqueLsa, dolsa OpaqueLsa, nbr OspfNeighborEntry, intf IntfConf, exist int, lsa_max_age bool) (discard bool, op uint8) {
+	if !server.ospfGlobalConf.OpaqueLsaSupport {
+		server.logger.Info(fmt.Sprintln("LSAUPD: Opaque LSA Discard. Opaque LSA support disabled"))
+		return true, LsdbNoAction
+	}
+	if lsaKey.LSType == ASOpaqueLSA && !server.isAsOpaqueArea(convertIPv4ToUint32(intf.IfAreaId)) {
+		server.logger.Info(fmt.Sprintln("LSAUPD: AS opaque LSA Discard. Area doesnt accept AS scope LSA ",
+			convertIPv4ToUint32(intf.IfAreaId)))
+		return true, LsdbNoAction
+	}
+	send_ack := server.lsAgeCheck(nbr.intfConfKey, lsa_max_age, exist)
+	if send_ack {
+		server.logger.Info(fmt.Sprintln("LSAUPD: Opaque LSA Discard.", " nbr ", nbr.OspfNbrIPAddr))
+		return true, LsdbNoAction
+	}
+	isNew := server.validateLsaIsNew(olsa.LsaMd, dolsa.LsaMd)
+	if !isNew {
+		return true, LsdbNoAction
+	}
+	return false, FloodLsa
+}
@@ -0,0 +1,248 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"l3/ospf/config"
+	"net"
+	"testing"
+)
+
+const (
+	opaqueTestRtrId    = uint32(0x0a010101)
+	opaqueTestNbrRtrId = uint32(0x0a010102)
+	opaqueTestStubArea = uint32(1)
+	opaqueTestType     = uint8(4) /* router information */
+)
+
+func initOpaqueLsaTestParams() (IntfConfKey, NeighborConfKey) {
+	ospf = getServerObject()
+	ospf.DbLsdbOp = make(chan DbLsdbMsg)
+	ospf.ospfGlobalConf.RouterId = []byte{10, 1, 1, 1}
+	ospf.ospfGlobalConf.OpaqueLsaSupport = true
+	ospfIntfToNbrMap = make(map[IntfConfKey]ospfNbrMdata)
+	backboneKey := AreaConfKey{
+		AreaId: "0.0.0.0",
+	}
+	stubKey := AreaConfKey{
+		AreaId: config.AreaId(convertUint32ToIPv4(opaqueTestStubArea)),
+	}
+	ospf.AreaConfMap[backboneKey] = AreaConf{
+		ImportAsExtern: config.ImportExternal,
+	}
+	ospf.AreaConfMap[stubKey] = AreaConf{
+		ImportAsExtern: config.ImportNoExternal,
+	}
+	ospf.initLSDatabase(0)
+	ospf.initLSDatabase(opaqueTestStubArea)
+	intfKey := IntfConfKey{
+		IPAddr:  "20.1.1.1",
+		IntfIdx: 1,
+	}
+	ospf.IntfConfMap[intfKey] = IntfConf{
+		IfAreaId: []byte{0, 0, 0, 0},
+		IfType:   config.Broadcast,
+		IfIpAddr: net.ParseIP("20.1.1.1"),
+	}
+	nbrKey := NeighborConfKey{
+		IPAddr:  "20.1.1.2",
+		IntfIdx: 1,
+	}
+	ospf.NeighborConfigMap[nbrKey] = OspfNeighborEntry{
+		OspfNbrRtrId:   opaqueTestNbrRtrId,
+		OspfNbrIPAddr:  net.ParseIP("20.1.1.2"),
+		OspfNbrOptions: INTF_OPTIONS,
+		intfConfKey:    intfKey,
+		OspfNbrState:   config.NbrFull,
+	}
+	ospfIntfToNbrMap[intfKey] = ospfNbrMdata{
+		nbrList: []NeighborConfKey{nbrKey},
+	}
+	go startDummyChannels(ospf)
+	return intfKey, nbrKey
+}
+
+func getOpaqueTestLsa(lsType uint8, advRtr uint32, seq int, lsAge uint16) (LsaKey, []byte) {
+	lsaKey := LsaKey{
+		LSType:    lsType,
+		LSId:      getOpaqueLsId(opaqueTestType, 0),
+		AdvRouter: advRtr,
+	}
+	lsa := OpaqueLsa{
+		Data: []byte{0, 1, 0, 4, 0x80, 0, 0, 0},
+	}
+	lsa.LsaMd.LSAge = lsAge
+	lsa.LsaMd.Options = INTF_OPTIONS
+	lsa.LsaMd.LSSequenceNum = seq
+	lsaEnc := encodeOpaqueLsa(lsa, lsaKey)
+	checkSum := computeFletcherChecksum(lsaEnc[2:], uint16(14))
+	lsaEnc[16] = uint8(checkSum >> 8)
+	lsaEnc[17] = uint8(checkSum)
+	return lsaKey, lsaEnc
+}
+
+func TestOpaqueLsaEncodeDecode(t *testing.T) {
+	lsId := getOpaqueLsId(opaqueTestType, 0x123456)
+	if getOpaqueType(lsId) != opaqueTestType || lsId&OpaqueIdMask != 0x123456 {
+		t.Error("Failed to build opaque link state id ", lsId)
+	}
+	lsaKey, lsaEnc := getOpaqueTestLsa(AreaOpaqueLSA, opaqueTestNbrRtrId, InitialSequenceNumber, 10)
+	if !validateChecksum(lsaEnc) {
+		t.Error("Invalid opaque LSA checksum")
+	}
+	lsa := NewOpaqueLsa()
+	key := NewLsaKey()
+	decodeOpaqueLsa(lsaEnc, lsa, key)
+	if *key != lsaKey || lsa.LsaMd.LSAge != 10 || len(lsa.Data) != 8 || lsa.Data[4] != 0x80 {
+		t.Error("Failed to decode opaque LSA ", key, lsa)
+	}
+	if int(lsa.LsaMd.LSLen) != len(lsaEnc) {
+		t.Error("Wrong opaque LSA length ", lsa.LsaMd.LSLen)
+	}
+}
+
+func TestOpaqueLsaApp(t *testing.T) {
+	intfKey, nbrKey := initOpaqueLsaTestParams()
+	var events []OpaqueLsaEvent
+	handler := func(event OpaqueLsaEvent) {
+		events = append(events, event)
+	}
+	if ospf.RegisterOpaqueLsaApp(RouterLSA, opaqueTestType, handler) == nil {
+		t.Error("Registered opaque application for router LSA")
+	}
+	if ospf.RegisterOpaqueLsaApp(AreaOpaqueLSA, opaqueTestType, handler) != nil {
+		t.Error("Failed to register opaque application")
+	}
+	if ospf.RegisterOpaqueLsaApp(AreaOpaqueLSA, opaqueTestType, handler) == nil {
+		t.Error("Registered opaque application twice")
+	}
+	msg := OpaqueLsaMsg{
+		MsgType:    OpaqueLsaOriginate,
+		LSType:     ASOpaqueLSA,
+		OpaqueType: opaqueTestType,
+		IntfKey:    intfKey,
+	}
+	if ospf.processOpaqueLsaMsg(msg) == nil {
+		t.Error("Originated opaque LSA for unregistered application")
+	}
+
+	/* self originated */
+	msg = OpaqueLsaMsg{
+		MsgType:    OpaqueLsaOriginate,
+		LSType:     AreaOpaqueLSA,
+		OpaqueType: opaqueTestType,
+		Data:       []byte{1, 2, 3, 4},
+	}
+	if ospf.processOpaqueLsaMsg(msg) != nil || ospf.processOpaqueLsaMsg(msg) != nil {
+		t.Error("Failed to originate opaque LSA")
+	}
+	lsaKey := LsaKey{
+		LSType:    AreaOpaqueLSA,
+		LSId:      getOpaqueLsId(opaqueTestType, 0),
+		AdvRouter: opaqueTestRtrId,
+	}
+	lsa, err := ospf.GetOpaqueLsa(0, intfKey, lsaKey)
+	if err != nil || lsa.LsaMd.LSSequenceNum != InitialSequenceNumber+1 {
+		t.Error("Self opaque LSA not updated ", lsa, err)
+	}
+
+	/* received from neighbor */
+	nbrLsaKey, lsaEnc := getOpaqueTestLsa(AreaOpaqueLSA, opaqueTestNbrRtrId, InitialSequenceNumber, 1)
+	ospf.notifyOpaqueLsaApp(nbrKey, 0, intfKey, lsaEnc)
+	ospf.processRecvdOpaqueLsa(lsaEnc, 0, intfKey)
+	if len(events) != 1 || events[0].EventType != OpaqueLsaRecvd || events[0].LsaKey != nbrLsaKey {
+		t.Error("Opaque application not notified ", events)
+	}
+	if len(ospf.GetOpaqueLsaList(AreaOpaqueLSA, opaqueTestType)) != 2 {
+		t.Error("Wrong opaque LSA list ", ospf.GetOpaqueLsaList(AreaOpaqueLSA, opaqueTestType))
+	}
+
+	_, lsaEnc = getOpaqueTestLsa(AreaOpaqueLSA, opaqueTestNbrRtrId, InitialSequenceNumber+1, config.MaxAge)
+	ospf.notifyOpaqueLsaApp(nbrKey, 0, intfKey, lsaEnc)
+	ospf.processRecvdOpaqueLsa(lsaEnc, 0, intfKey)
+	if len(events) != 2 || events[1].EventType != OpaqueLsaFlushed {
+		t.Error("Opaque application not notified of flush ", events)
+	}
+	if _, err := ospf.GetOpaqueLsa(0, intfKey, nbrLsaKey); err == nil {
+		t.Error("Flushed opaque LSA still in LSDB")
+	}
+
+	msg.MsgType = OpaqueLsaFlush
+	ospf.processOpaqueLsaMsg(msg)
+	if _, err := ospf.GetOpaqueLsa(0, intfKey, lsaKey); err == nil {
+		t.Error("Self opaque LSA not flushed")
+	}
+	ospf.ospfGlobalConf.OpaqueLsaSupport = false
+	msg.MsgType = OpaqueLsaOriginate
+	if ospf.processOpaqueLsaMsg(msg) == nil {
+		t.Error("Originated opaque LSA with opaque LSA support disabled")
+	}
+	ospf.ospfGlobalConf.OpaqueLsaSupport = true
+	ospf.UnregisterOpaqueLsaApp(AreaOpaqueLSA, opaqueTestType)
+	if _, exist := ospf.getOpaqueLsaApp(AreaOpaqueLSA, opaqueTestType); exist {
+		t.Error("Opaque application not unregistered")
+	}
+}
+
+func TestOpaqueLsaScope(t *testing.T) {
+	intfKey, nbrKey := initOpaqueLsaTestParams()
+
+	/* AS scope LSAs are not installed in the stub area */
+	_, lsaEnc := getOpaqueTestLsa(ASOpaqueLSA, opaqueTestNbrRtrId, InitialSequenceNumber, 1)
+	ospf.processRecvdOpaqueLsa(lsaEnc, 0, intfKey)
+	if len(ospf.AreaLsdb[LsdbKey{AreaId: 0}].OpaqueLsaMap) != 1 ||
+		len(ospf.AreaLsdb[LsdbKey{AreaId: opaqueTestStubArea}].OpaqueLsaMap) != 0 {
+		t.Error("AS opaque LSA installed in wrong areas")
+	}
+
+	/* link local LSAs are kept per interface */
+	linkLsaKey, lsaEnc := getOpaqueTestLsa(LinkOpaqueLSA, opaqueTestNbrRtrId, InitialSequenceNumber, 1)
+	ospf.processRecvdOpaqueLsa(lsaEnc, 0, intfKey)
+	if _, ret := ospf.getOpaqueLsaFromLsdb(0, intfKey, linkLsaKey); ret != LsdbEntryFound {
+		t.Error("Link opaque LSA not installed on the interface")
+	}
+
+	nbrConf := ospf.NeighborConfigMap[nbrKey]
+	intf := ospf.IntfConfMap[intfKey]
+	if len(ospf.generateDbOpaqueLsaList(0, nbrConf, intf)) != 2 {
+		t.Error("Opaque LSAs missing from db summary list")
+	}
+	nbrConf.OspfNbrOptions = EOption
+	if ospf.generateDbOpaqueLsaList(0, nbrConf, intf) != nil {
+		t.Error("Opaque LSAs described to neighbor without O-bit")
+	}
+
+	flood_pkt := ospfFloodMsg{
+		intfKey: intfKey,
+		areaId:  opaqueTestStubArea,
+		lsType:  AreaOpaqueLSA,
+	}
+	if ospf.opaqueFloodScopeCheck(flood_pkt, intfKey, intf) {
+		t.Error("Area opaque LSA flooded outside its area")
+	}
+	flood_pkt.lsType = ASOpaqueLSA
+	if !ospf.opaqueFloodScopeCheck(flood_pkt, intfKey, intf) {
+		t.Error("AS opaque LSA not flooded in the backbone")
+	}
+}
@@ -0,0 +1,591 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"fmt"
+	"l3/ospf/config"
+)
+
+/*
+Changes recorded by the LSDB thread between two route
+calculations. Type 3, 4, 5 and 7 LSAs and stub links of
+router LSAs do not change the shortest path tree, only the
+affected destinations are recalculated for them.
+*/
+type spfChangeSet struct {
+	full     bool
+	prefixes map[RoutingTblEntryKey]bool
+	asbrs    map[uint32]bool
+}
+
+type lsaSnapshot struct {
+	exist  bool
+	rtrLsa RouterLsa
+	netLsa NetworkLsa
+	sumLsa SummaryLsa
+	extLsa ASExternalLsa
+}
+
+type routerLinkKey struct {
+	LinkId   uint32
+	LinkData uint32
+	LinkType uint8
+}
+
+func (c *spfChangeSet) addPrefix(rKey RoutingTblEntryKey) {
+	if c.prefixes == nil {
+		c.prefixes = make(map[RoutingTblEntryKey]bool)
+	}
+	c.prefixes[rKey] = true
+}
+
+func (c *spfChangeSet) addAsbr(asbr uint32) {
+	if c.asbrs == nil {
+		c.asbrs = make(map[uint32]bool)
+	}
+	c.asbrs[asbr] = true
+}
+
+func networkRouteKey(network uint32, netmask uint32) RoutingTblEntryKey {
+	return RoutingTblEntryKey{
+		DestId:   network & netmask,
+		AddrMask: netmask,
+		DestType: Network,
+	}
+}
+
+func stubRouteKey(link LinkDetail) RoutingTblEntryKey {
+	return RoutingTblEntryKey{
+		DestId:   link.LinkId,
+		AddrMask: link.LinkData,
+		DestType: Network,
+	}
+}
+
+func routerDestType(lsaEnt RouterLsa) DestType {
+	if lsaEnt.BitB == true &&
+		lsaEnt.BitE == true {
+		return ASAreaBdrRouter
+	} else if lsaEnt.BitB == true {
+		return AreaBdrRouter
+	} else if lsaEnt.BitE == true {
+		return ASBdrRouter
+	}
+	return InternalRouter
+}
+
+/*
+@fn getLsaSnapshot
+Copy of the LSDB entry which is going to be replaced
+by the received LSA.
+*/
+func (server *OSPFServer) getLsaSnapshot(data []byte, areaId uint32) (LsaKey, lsaSnapshot) {
+	var header LsaHeader
+	decodeLsaHeader(data, &header)
+	lsaKey := LsaKey{
+		LSType:    header.LSType,
+		LSId:      header.LinkId,
+		AdvRouter: header.Adv_router,
+	}
+	return lsaKey, server.findLsaSnapshot(areaId, lsaKey)
+}
+
+func (server *OSPFServer) findLsaSnapshot(areaId uint32, lsaKey LsaKey) lsaSnapshot {
+	var snap lsaSnapshot
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		return snap
+	}
+	switch lsaKey.LSType {
+	case RouterLSA:
+		snap.rtrLsa, snap.exist = lsDbEnt.RouterLsaMap[lsaKey]
+	case NetworkLSA:
+		snap.netLsa, snap.exist = lsDbEnt.NetworkLsaMap[lsaKey]
+	case Summary3LSA:
+		snap.sumLsa, snap.exist = lsDbEnt.Summary3LsaMap[lsaKey]
+	case Summary4LSA:
+		snap.sumLsa, snap.exist = lsDbEnt.Summary4LsaMap[lsaKey]
+	case ASExternalLSA:
+		snap.extLsa, snap.exist = lsDbEnt.ASExternalLsaMap[lsaKey]
+	case NSSALSA:
+		snap.extLsa, snap.exist = lsDbEnt.NSSALsaMap[lsaKey]
+	}
+	return snap
+}
+
+func isMaxAge(lsaMd LsaMetadata) bool {
+	return lsaMd.LSAge == config.MaxAge
+}
+
+func networkLsaEqual(a NetworkLsa, b NetworkLsa) bool {
+	if isMaxAge(a.LsaMd) != isMaxAge(b.LsaMd) ||
+		a.Netmask != b.Netmask ||
+		len(a.AttachedRtr) != len(b.AttachedRtr) {
+		return false
+	}
+	for i, rtr := range a.AttachedRtr {
+		if b.AttachedRtr[i] != rtr {
+			return false
+		}
+	}
+	return true
+}
+
+func summaryLsaEqual(a SummaryLsa, b SummaryLsa) bool {
+	return isMaxAge(a.LsaMd) == isMaxAge(b.LsaMd) &&
+		a.Netmask == b.Netmask &&
+		a.Metric == b.Metric
+}
+
+func externalLsaEqual(a ASExternalLsa, b ASExternalLsa) bool {
+	return isMaxAge(a.LsaMd) == isMaxAge(b.LsaMd) &&
+		a.Netmask == b.Netmask &&
+		a.BitE == b.BitE &&
+		a.Metric == b.Metric &&
+		a.FwdAddr == b.FwdAddr
+}
+
+/*
+@fn recordLsaChange
+Compare the LSDB entry before and after the update and
+record what the next route calculation has to look at.
+Returns false if the change does not affect routing, e.g.
+a refresh of the same LSA.
+*/
+func (server *OSPFServer) recordLsaChange(areaId uint32, lsaKey LsaKey, old lsaSnapshot) bool {
+	curr := server.findLsaSnapshot(areaId, lsaKey)
+	if !old.exist && !curr.exist {
+		return false
+	}
+	change := &server.spfChange
+	switch lsaKey.LSType {
+	case RouterLSA:
+		return server.recordRouterLsaChange(areaId, lsaKey, old, curr)
+	case NetworkLSA:
+		if old.exist && curr.exist && networkLsaEqual(old.netLsa, curr.netLsa) {
+			return false
+		}
+		change.full = true
+	case Summary3LSA:
+		if old.exist && curr.exist && summaryLsaEqual(old.sumLsa, curr.sumLsa) {
+			return false
+		}
+		if old.exist {
+			change.addPrefix(networkRouteKey(lsaKey.LSId, old.sumLsa.Netmask))
+		}
+		if curr.exist {
+			change.addPrefix(networkRouteKey(lsaKey.LSId, curr.sumLsa.Netmask))
+		}
+	case Summary4LSA:
+		if old.exist && curr.exist && summaryLsaEqual(old.sumLsa, curr.sumLsa) {
+			return false
+		}
+		change.addAsbr(lsaKey.LSId)
+	case ASExternalLSA, NSSALSA:
+		if old.exist && curr.exist && externalLsaEqual(old.extLsa, curr.extLsa) {
+			return false
+		}
+		if old.exist {
+			change.addPrefix(networkRouteKey(lsaKey.LSId, old.extLsa.Netmask))
+		}
+		if curr.exist {
+			change.addPrefix(networkRouteKey(lsaKey.LSId, curr.extLsa.Netmask))
+		}
+	default:
+		change.full = true
+	}
+	return true
+}
+
+/*
+@fn recordRouterLsaChange
+Stub link changes only touch the stub prefixes. A single
+transit, point-to-point link cost change is checked against
+the last shortest path tree. Anything else needs full SPF.
+*/
+func (server *OSPFServer) recordRouterLsaChange(areaId uint32, lsaKey LsaKey, old lsaSnapshot, curr lsaSnapshot) bool {
+	change := &server.spfChange
+	if !old.exist || !curr.exist {
+		change.full = true
+		return true
+	}
+	oldLsa := old.rtrLsa
+	newLsa := curr.rtrLsa
+	if isMaxAge(oldLsa.LsaMd) != isMaxAge(newLsa.LsaMd) ||
+		oldLsa.BitB != newLsa.BitB ||
+		oldLsa.BitE != newLsa.BitE ||
+		oldLsa.BitV != newLsa.BitV ||
+		oldLsa.BitNt != newLsa.BitNt {
+		change.full = true
+		return true
+	}
+	oldLinks := make(map[routerLinkKey]uint16)
+	for _, link := range oldLsa.LinkDetails {
+		key := routerLinkKey{
+			LinkId:   link.LinkId,
+			LinkData: link.LinkData,
+			LinkType: link.LinkType,
+		}
+		oldLinks[key] = link.LinkMetric
+	}
+	changed := false
+	var costChange []LinkDetail
+	var oldCost []uint16
+	for _, link := range newLsa.LinkDetails {
+		key := routerLinkKey{
+			LinkId:   link.LinkId,
+			LinkData: link.LinkData,
+			LinkType: link.LinkType,
+		}
+		metric, exist := oldLinks[key]
+		delete(oldLinks, key)
+		if exist && metric == link.LinkMetric {
+			continue
+		}
+		changed = true
+		if link.LinkType == StubLink {
+			change.addPrefix(stubRouteKey(link))
+			continue
+		}
+		if !exist {
+			change.full = true
+			return true
+		}
+		costChange = append(costChange, link)
+		oldCost = append(oldCost, metric)
+	}
+	for key, _ := range oldLinks {
+		changed = true
+		if key.LinkType != StubLink {
+			change.full = true
+			return true
+		}
+		change.addPrefix(RoutingTblEntryKey{
+			DestId:   key.LinkId,
+			AddrMask: key.LinkData,
+			DestType: Network,
+		})
+	}
+	if len(costChange) > 1 {
+		change.full = true
+		return true
+	}
+	if len(costChange) == 1 &&
+		server.linkCostChangeAffectsSpf(areaId, lsaKey, costChange[0], oldCost[0]) {
+		change.full = true
+		return true
+	}
+	return changed
+}
+
+/*
+@fn linkCostChangeAffectsSpf
+Incremental SPF for a single link cost change from router u
+to vertex v. The shortest path tree stays the same if the link
+is not part of it before the change and does not become part
+of it after the change, i.e. both dist(u) + oldCost and
+dist(u) + newCost are greater than dist(v). A link from an unreachable router is never part of the tree.
+*/
+func (server *OSPFServer) linkCostChangeAffectsSpf(areaId uint32, lsaKey LsaKey, link LinkDetail, oldCost uint16) bool {
+	if link.LinkType == VirtualLink {
+		return true
+	}
+	areaIdKey := AreaIdKey{
+		AreaId: areaId,
+	}
+	dist, exist := server.areaSpfDist[areaIdKey]
+	if !exist {
+		return true
+	}
+	uKey := VertexKey{
+		Type:   RouterVertex,
+		ID:     lsaKey.LSId,
+		AdvRtr: lsaKey.AdvRouter,
+	}
+	uDist, exist := dist[uKey]
+	if !exist {
+		server.logger.Info(fmt.Sprintln("SPF: Link cost change from unreachable router ", uKey))
+		return false
+	}
+	var vKey VertexKey
+	if link.LinkType == TransitLink {
+		nLsaKey, err := server.findNetworkLsa(areaId, link.LinkId)
+		if err != nil {
+			return true
+		}
+		vKey = VertexKey{
+			Type:   TNetworkVertex,
+			ID:     link.LinkId,
+			AdvRtr: nLsaKey.AdvRouter,
+		}
+	} else {
+		vKey = VertexKey{
+			Type:   RouterVertex,
+			ID:     link.LinkId,
+			AdvRtr: link.LinkId,
+		}
+	}
+	vDist, exist := dist[vKey]
+	if !exist {
+		return true
+	}
+	if uint32(uDist)+uint32(oldCost) <= uint32(vDist) ||
+		uint32(uDist)+uint32(link.LinkMetric) <= uint32(vDist) {
+		return true
+	}
+	server.logger.Info(fmt.Sprintln("SPF: Link cost change ", uKey, " -> ", vKey,
+		" does not change the shortest path tree"))
+	return false
+}
+
+func (server *OSPFServer) partialRouteCalcAllowed() bool {
+	return server.AreaRoutingTbl != nil &&
+		!server.isGracefulRestarting()
+}
+
+/*
+@fn partialRouteCalc
+Recalculate the recorded destinations using the area routing
+tables of the last SPF run and install the differences.
+*/
+func (server *OSPFServer) partialRouteCalc(change spfChangeSet) {
+	prefixes := make(map[RoutingTblEntryKey]bool)
+	for rKey, _ := range change.prefixes {
+		prefixes[rKey] = true
+	}
+	server.TempAreaRoutingTbl = server.AreaRoutingTbl
+	rKeys := make(map[RoutingTblEntryKey]bool)
+	for asbr, _ := range change.asbrs {
+		rKey := RoutingTblEntryKey{
+			DestId:   asbr,
+			AddrMask: 0,
+			DestType: ASBdrRouter,
+		}
+		rKeys[rKey] = true
+		for areaIdKey, _ := range server.TempAreaRoutingTbl {
+			server.calcAsbrRoute(areaIdKey, rKey)
+		}
+		server.addExternalPrefixes(asbr, prefixes)
+	}
+	server.addNssaFwdAddrPrefixes(prefixes)
+	for rKey, _ := range prefixes {
+		rKeys[rKey] = true
+		for areaIdKey, _ := range server.TempAreaRoutingTbl {
+			server.calcPrefixRoute(areaIdKey, rKey)
+		}
+	}
+	server.logger.Info(fmt.Sprintln("Partial route calculation for ", len(rKeys), " destinations"))
+
+	server.OldGlobalRoutingTbl = make(map[RoutingTblEntryKey]GlobalRoutingTblEntry)
+	server.TempGlobalRoutingTbl = make(map[RoutingTblEntryKey]GlobalRoutingTblEntry)
+	for rKey, _ := range rKeys {
+		oldEnt, exist := server.GlobalRoutingTbl[rKey]
+		if exist {
+			server.OldGlobalRoutingTbl[rKey] = oldEnt
+		}
+		newEnt, exist := server.consolidateRoute(rKey)
+		if exist {
+			server.TempGlobalRoutingTbl[rKey] = newEnt
+		}
+	}
+	server.installRoutingTblChanges()
+	for rKey, _ := range rKeys {
+		newEnt, exist := server.TempGlobalRoutingTbl[rKey]
+		if exist {
+			server.GlobalRoutingTbl[rKey] = newEnt
+		} else {
+			delete(server.GlobalRoutingTbl, rKey)
+		}
+	}
+	server.TempAreaRoutingTbl = nil
+	server.OldGlobalRoutingTbl = nil
+	server.TempGlobalRoutingTbl = nil
+	if server.ospfGlobalConf.AreaBdrRtrStatus == true {
+		server.HandleTransitAreaSummaryLsa()
+		server.GenerateSummaryLsa()
+		server.GenerateNssaTranslatedLsa()
+	}
+}
+
+/*
+@fn calcAsbrRoute
+Recalculate the inter-area route to an AS boundary router
+from the type 4 summary LSAs of the area.
+*/
+func (server *OSPFServer) calcAsbrRoute(areaIdKey AreaIdKey, rKey RoutingTblEntryKey) {
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	rEnt, exist := tempAreaRoutingTbl.RoutingTblMap[rKey]
+	if exist && rEnt.PathType == IntraArea {
+		return
+	}
+	delete(tempAreaRoutingTbl.RoutingTblMap, rKey)
+	lsdbKey := LsdbKey{
+		AreaId: areaIdKey.AreaId,
+	}
+	lsDbEnt, _ := server.AreaLsdb[lsdbKey]
+	for lsaKey, lsaEnt := range lsDbEnt.Summary4LsaMap {
+		if lsaKey.LSId == rKey.DestId {
+			server.calcASBorderRoute(areaIdKey.AreaId, lsaKey, lsaEnt)
+		}
+	}
+}
+
+/*
+@fn addExternalPrefixes
+External destinations reached through the AS boundary router.
+*/
+func (server *OSPFServer) addExternalPrefixes(asbr uint32, prefixes map[RoutingTblEntryKey]bool) {
+	for _, lsDbEnt := range server.AreaLsdb {
+		for lsaKey, lsaEnt := range lsDbEnt.ASExternalLsaMap {
+			if lsaKey.AdvRouter == asbr || lsaEnt.FwdAddr == asbr {
+				prefixes[networkRouteKey(lsaKey.LSId, lsaEnt.Netmask)] = true
+			}
+		}
+		for lsaKey, lsaEnt := range lsDbEnt.NSSALsaMap {
+			if lsaKey.AdvRouter == asbr {
+				prefixes[networkRouteKey(lsaKey.LSId, lsaEnt.Netmask)] = true
+			}
+		}
+	}
+}
+
+/*
+@fn addNssaFwdAddrPrefixes
+Type 7 routes whose forwarding address is resolved through
+one of the recalculated intra-area routes.
+*/
+func (server *OSPFServer) addNssaFwdAddrPrefixes(prefixes map[RoutingTblEntryKey]bool) {
+	var nssaPrefixes []RoutingTblEntryKey
+	for _, lsDbEnt := range server.AreaLsdb {
+		for lsaKey, lsaEnt := range lsDbEnt.NSSALsaMap {
+			if lsaEnt.FwdAddr == 0 {
+				continue
+			}
+			for rKey, _ := range prefixes {
+				if lsaEnt.FwdAddr&rKey.AddrMask == rKey.DestId {
+					nssaPrefixes = append(nssaPrefixes, networkRouteKey(lsaKey.LSId, lsaEnt.Netmask))
+					break
+				}
+			}
+		}
+	}
+	for _, rKey := range nssaPrefixes {
+		prefixes[rKey] = true
+	}
+}
+
+/*
+@fn calcPrefixRoute
+Recalculate one network destination of the area in the same
+order as the full calculation: stub links, type 3 summary,
+AS external and NSSA LSAs. Transit network routes come from
+the shortest path tree and are left as they are.
+*/
+func (server *OSPFServer) calcPrefixRoute(areaIdKey AreaIdKey, rKey RoutingTblEntryKey) {
+	areaId := areaIdKey.AreaId
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	if tempAreaRoutingTbl.RoutingTblMap == nil {
+		return
+	}
+	rEnt, exist := tempAreaRoutingTbl.RoutingTblMap[rKey]
+	if exist && rEnt.PathType == IntraArea &&
+		rEnt.LSOrigin.LSType == NetworkLSA {
+		return
+	}
+	delete(tempAreaRoutingTbl.RoutingTblMap, rKey)
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, _ := server.AreaLsdb[lsdbKey]
+	server.calcStubRoute(areaIdKey, rKey, lsDbEnt)
+	for lsaKey, lsaEnt := range lsDbEnt.Summary3LsaMap {
+		if networkRouteKey(lsaKey.LSId, lsaEnt.Netmask) == rKey {
+			server.calcInterAreaRoute(areaId, lsaKey, lsaEnt)
+		}
+	}
+	for lsaKey, lsaEnt := range lsDbEnt.ASExternalLsaMap {
+		if networkRouteKey(lsaKey.LSId, lsaEnt.Netmask) == rKey {
+			server.calcASExternalRoute(areaId, lsaKey, lsaEnt)
+		}
+	}
+	if !server.isNssaArea(config.AreaId(convertUint32ToIPv4(areaId))) {
+		return
+	}
+	for lsaKey, lsaEnt := range lsDbEnt.NSSALsaMap {
+		if networkRouteKey(lsaKey.LSId, lsaEnt.Netmask) == rKey {
+			server.calcNssaRoute(areaId, lsaKey, lsaEnt)
+		}
+	}
+}
+
+/*
+@fn calcStubRoute
+Intra-area route to a stub network using the routes to the
+routers advertising it. Lowest cost path is preferred.
+*/
+func (server *OSPFServer) calcStubRoute(areaIdKey AreaIdKey, rKey RoutingTblEntryKey, lsDbEnt LSDatabase) {
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	var rEnt RoutingTblEntry
+	found := false
+	for lsaKey, lsaEnt := range lsDbEnt.RouterLsaMap {
+		for _, link := range lsaEnt.LinkDetails {
+			if link.LinkType != StubLink ||
+				stubRouteKey(link) != rKey {
+				continue
+			}
+			pKey := RoutingTblEntryKey{
+				DestType: routerDestType(lsaEnt),
+				AddrMask: 0,
+				DestId:   lsaKey.LSId,
+			}
+			pREnt, exist := tempAreaRoutingTbl.RoutingTblMap[pKey]
+			if !exist || pREnt.PathType != IntraArea {
+				continue
+			}
+			cost := pREnt.Cost + link.LinkMetric
+			if found && rEnt.Cost <= cost {
+				continue
+			}
+			found = true
+			rEnt.OptCapabilities = pREnt.OptCapabilities
+			rEnt.PathType = IntraArea
+			rEnt.Cost = cost
+			rEnt.Type2Cost = 0
+			rEnt.LSOrigin = lsaKey
+			rEnt.NumOfPaths = pREnt.NumOfPaths
+			rEnt.NextHops = make(map[NextHop]bool, pREnt.NumOfPaths)
+			for key, _ := range pREnt.NextHops {
+				rEnt.NextHops[key] = true
+			}
+		}
+	}
+	if found {
+		tempAreaRoutingTbl.RoutingTblMap[rKey] = rEnt
+		server.TempAreaRoutingTbl[areaIdKey] = tempAreaRoutingTbl
+	}
+}
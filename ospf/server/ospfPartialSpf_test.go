@@ -0,0 +1,353 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"l3/ospf/config"
+	"strings"
+	"testing"
+)
+
+const (
+	partialTestAreaId  = uint32(0)
+	partialTestAbrId   = uint32(0x0a010102)
+	partialTestRtr3Id  = uint32(0x0a010103)
+	partialTestIfIp    = uint32(0x14010101)
+	partialTestNextHop = uint32(0x14010102)
+	partialTestNetwork = uint32(0x28010100)
+	partialTestNetmask = uint32(0xffffff00)
+)
+
+func initPartialSpfTestParams() {
+	ospf = getServerObject()
+	ospf.initOspfGlobalConfDefault()
+	ospf.DbLsdbOp = make(chan DbLsdbMsg)
+	ospf.DbEventOp = make(chan DbEventMsg)
+	ospf.ospfGlobalConf.RouterId = []byte{10, 1, 1, 1}
+	areaKey := AreaConfKey{
+		AreaId: config.AreaId(convertUint32ToIPv4(partialTestAreaId)),
+	}
+	ospf.AreaConfMap[areaKey] = AreaConf{
+		IntfListMap: make(map[IntfConfKey]bool),
+	}
+	ospf.initLSDatabase(partialTestAreaId)
+	go startDummyChannels(ospf)
+}
+
+/* Router LSA with a point-to-point link to nbrId and a stub network */
+func setPartialTestRouterLsa(rtrId uint32, nbrId uint32, cost uint16, stubCost uint16) (LsaKey, RoutingTblEntryKey) {
+	lsdbKey := LsdbKey{
+		AreaId: partialTestAreaId,
+	}
+	lsaKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      rtrId,
+		AdvRouter: rtrId,
+	}
+	stubLink := LinkDetail{
+		LinkId:     0x1e000000 | (rtrId&0xff)<<8,
+		LinkData:   partialTestNetmask,
+		LinkType:   StubLink,
+		LinkMetric: stubCost,
+	}
+	lsa := RouterLsa{
+		NumOfLinks: 2,
+	}
+	lsa.LinkDetails = []LinkDetail{
+		LinkDetail{
+			LinkId:     nbrId,
+			LinkData:   rtrId,
+			LinkType:   P2PLink,
+			LinkMetric: cost,
+		},
+		stubLink,
+	}
+	ospf.AreaLsdb[lsdbKey].RouterLsaMap[lsaKey] = lsa
+	return lsaKey, stubRouteKey(stubLink)
+}
+
+func addPartialTestRouterRoute(tbl AreaRoutingTbl, rKey RoutingTblEntryKey, cost uint16) {
+	nextHops := make(map[NextHop]bool)
+	nextHop := NextHop{
+		IfIPAddr:  partialTestIfIp,
+		NextHopIP: partialTestNextHop,
+	}
+	nextHops[nextHop] = true
+	tbl.RoutingTblMap[rKey] = RoutingTblEntry{
+		PathType:   IntraArea,
+		Cost:       cost,
+		NumOfPaths: 1,
+		NextHops:   nextHops,
+	}
+}
+
+func TestRecordLsaChange(t *testing.T) {
+	initPartialSpfTestParams()
+	lsdbKey := LsdbKey{
+		AreaId: partialTestAreaId,
+	}
+	sumKey := LsaKey{
+		LSType:    Summary3LSA,
+		LSId:      partialTestNetwork,
+		AdvRouter: partialTestAbrId,
+	}
+	sumLsa := SummaryLsa{
+		Netmask: partialTestNetmask,
+		Metric:  5,
+	}
+	old := ospf.findLsaSnapshot(partialTestAreaId, sumKey)
+	ospf.AreaLsdb[lsdbKey].Summary3LsaMap[sumKey] = sumLsa
+	rKey := networkRouteKey(partialTestNetwork, partialTestNetmask)
+	if !ospf.recordLsaChange(partialTestAreaId, sumKey, old) ||
+		ospf.spfChange.full || !ospf.spfChange.prefixes[rKey] {
+		t.Error("Summary LSA change not recorded ", ospf.spfChange)
+	}
+
+	/* refresh of the same LSA */
+	ospf.spfChange = spfChangeSet{}
+	old = ospf.findLsaSnapshot(partialTestAreaId, sumKey)
+	sumLsa.LsaMd.LSSequenceNum++
+	ospf.AreaLsdb[lsdbKey].Summary3LsaMap[sumKey] = sumLsa
+	if ospf.recordLsaChange(partialTestAreaId, sumKey, old) {
+		t.Error("LSA refresh needs route calculation ", ospf.spfChange)
+	}
+
+	/* network LSA changes the SPF tree */
+	netKey := LsaKey{
+		LSType:    NetworkLSA,
+		LSId:      partialTestNextHop,
+		AdvRouter: partialTestAbrId,
+	}
+	old = ospf.findLsaSnapshot(partialTestAreaId, netKey)
+	ospf.AreaLsdb[lsdbKey].NetworkLsaMap[netKey] = NetworkLsa{
+		Netmask:     partialTestNetmask,
+		AttachedRtr: []uint32{partialTestAbrId, partialTestRtr3Id},
+	}
+	if !ospf.recordLsaChange(partialTestAreaId, netKey, old) || !ospf.spfChange.full {
+		t.Error("Network LSA change does not need full SPF ", ospf.spfChange)
+	}
+}
+
+func TestRouterLsaLinkCostChange(t *testing.T) {
+	initPartialSpfTestParams()
+	rtrId := convertIPv4ToUint32(ospf.ospfGlobalConf.RouterId)
+	/* 10.1.1.1 -10- 10.1.1.2 -10- 10.1.1.3 */
+	dist := make(map[VertexKey]uint16)
+	for i, id := range []uint32{rtrId, partialTestAbrId, partialTestRtr3Id} {
+		vKey := VertexKey{
+			Type:   RouterVertex,
+			ID:     id,
+			AdvRtr: id,
+		}
+		dist[vKey] = uint16(i * 10)
+	}
+	ospf.areaSpfDist = make(map[AreaIdKey]map[VertexKey]uint16)
+	ospf.areaSpfDist[AreaIdKey{AreaId: partialTestAreaId}] = dist
+	abrKey, _ := setPartialTestRouterLsa(partialTestAbrId, partialTestRtr3Id, 10, 1)
+	rtr3Key, _ := setPartialTestRouterLsa(partialTestRtr3Id, partialTestAbrId, 10, 1)
+
+	/* link not in the SPF tree */
+	old := ospf.findLsaSnapshot(partialTestAreaId, rtr3Key)
+	setPartialTestRouterLsa(partialTestRtr3Id, partialTestAbrId, 15, 1)
+	if ospf.recordLsaChange(partialTestAreaId, rtr3Key, old) || ospf.spfChange.full {
+		t.Error("Link cost change outside SPF tree needs route calculation ", ospf.spfChange)
+	}
+
+	/* stub link cost */
+	old = ospf.findLsaSnapshot(partialTestAreaId, rtr3Key)
+	_, stubRKey := setPartialTestRouterLsa(partialTestRtr3Id, partialTestAbrId, 15, 2)
+	if !ospf.recordLsaChange(partialTestAreaId, rtr3Key, old) ||
+		ospf.spfChange.full || !ospf.spfChange.prefixes[stubRKey] {
+		t.Error("Stub link change not recorded ", ospf.spfChange)
+	}
+
+	/* link in the SPF tree */
+	ospf.spfChange = spfChangeSet{}
+	old = ospf.findLsaSnapshot(partialTestAreaId, abrKey)
+	setPartialTestRouterLsa(partialTestAbrId, partialTestRtr3Id, 15, 1)
+	if !ospf.recordLsaChange(partialTestAreaId, abrKey, old) || !ospf.spfChange.full {
+		t.Error("Link cost change in SPF tree does not need full SPF ", ospf.spfChange)
+	}
+}
+
+func TestPartialRouteCalc(t *testing.T) {
+	initPartialSpfTestParams()
+	lsdbKey := LsdbKey{
+		AreaId: partialTestAreaId,
+	}
+	areaIdKey := AreaIdKey{
+		AreaId: partialTestAreaId,
+	}
+	tbl := AreaRoutingTbl{
+		RoutingTblMap: make(map[RoutingTblEntryKey]RoutingTblEntry),
+	}
+	abrRKey := RoutingTblEntryKey{
+		DestId:   partialTestAbrId,
+		DestType: AreaBdrRouter,
+	}
+	rtr3RKey := RoutingTblEntryKey{
+		DestId:   partialTestRtr3Id,
+		DestType: InternalRouter,
+	}
+	addPartialTestRouterRoute(tbl, abrRKey, 10)
+	addPartialTestRouterRoute(tbl, rtr3RKey, 20)
+	ospf.AreaRoutingTbl = make(map[AreaIdKey]AreaRoutingTbl)
+	ospf.AreaRoutingTbl[areaIdKey] = tbl
+
+	_, stubRKey := setPartialTestRouterLsa(partialTestRtr3Id, partialTestAbrId, 10, 1)
+	sumKey := LsaKey{
+		LSType:    Summary3LSA,
+		LSId:      partialTestNetwork,
+		AdvRouter: partialTestAbrId,
+	}
+	ospf.AreaLsdb[lsdbKey].Summary3LsaMap[sumKey] = SummaryLsa{
+		Netmask: partialTestNetmask,
+		Metric:  5,
+	}
+	sumRKey := networkRouteKey(partialTestNetwork, partialTestNetmask)
+	var change spfChangeSet
+	change.addPrefix(stubRKey)
+	change.addPrefix(sumRKey)
+	ospf.partialRouteCalc(change)
+	stubEnt, exist := ospf.GlobalRoutingTbl[stubRKey]
+	if !exist || stubEnt.RoutingTblEnt.PathType != IntraArea ||
+		stubEnt.RoutingTblEnt.Cost != 21 ||
+		len(stubEnt.RoutingTblEnt.NextHops) != 1 {
+		t.Error("Wrong stub route ", stubEnt)
+	}
+	sumEnt, exist := ospf.GlobalRoutingTbl[sumRKey]
+	if !exist || sumEnt.RoutingTblEnt.PathType != InterArea ||
+		sumEnt.RoutingTblEnt.Cost != 15 {
+		t.Error("Wrong inter-area route ", sumEnt)
+	}
+
+	/* summary LSA withdrawn */
+	delete(ospf.AreaLsdb[lsdbKey].Summary3LsaMap, sumKey)
+	ospf.spfChange.addPrefix(sumRKey)
+	ospf.spfTriggers = []string{SpfTrigLsaDelete}
+	ospf.runSpf()
+	if _, exist := ospf.GlobalRoutingTbl[sumRKey]; exist {
+		t.Error("Inter-area route not deleted")
+	}
+	if _, exist := ospf.GlobalRoutingTbl[stubRKey]; !exist {
+		t.Error("Stub route deleted")
+	}
+	_, _, spfLog := ospf.GetBulkOspfSpfLogState(0, 1)
+	if len(spfLog) != 1 || !strings.HasSuffix(spfLog[0].Trigger, SpfLogPartial) {
+		t.Error("Partial route calculation not logged ", spfLog)
+	}
+}
+
+const (
+	benchGridSize   = 20
+	benchNumSummary = 1000
+)
+
+func initSpfBenchmark() {
+	ospf = getServerObject()
+	initSyntheticTopology(ospf, benchGridSize, benchNumSummary)
+	go ospf.spfCalculation()
+	ospf.spfChange.full = true
+	ospf.runSpf()
+}
+
+func BenchmarkSpfFull(b *testing.B) {
+	initSpfBenchmark()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ospf.spfChange.full = true
+		ospf.runSpf()
+	}
+}
+
+func BenchmarkPartialRouteCalc(b *testing.B) {
+	initSpfBenchmark()
+	lsdbKey := LsdbKey{
+		AreaId: 0,
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lsaKey := syntheticSummaryKey(i % benchNumSummary)
+		old := ospf.findLsaSnapshot(0, lsaKey)
+		lsa := old.sumLsa
+		lsa.Metric++
+		ospf.AreaLsdb[lsdbKey].Summary3LsaMap[lsaKey] = lsa
+		if !ospf.recordLsaChange(0, lsaKey, old) || ospf.spfChange.full {
+			b.Fatal("Summary LSA change not recorded ", ospf.spfChange)
+		}
+		ospf.runSpf()
+	}
+}
+
+func BenchmarkLinkCostChange(b *testing.B) {
+	initSpfBenchmark()
+	lsdbKey := LsdbKey{
+		AreaId: 0,
+	}
+	/* link from the last router towards the first row */
+	last := benchGridSize*benchGridSize - 1
+	nbr := last - benchGridSize
+	lsaKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      syntheticRtrId(last),
+		AdvRouter: syntheticRtrId(last),
+	}
+	dist := ospf.areaSpfDist[AreaIdKey{AreaId: 0}]
+	uKey := VertexKey{
+		Type:   RouterVertex,
+		ID:     syntheticRtrId(last),
+		AdvRtr: syntheticRtrId(last),
+	}
+	vKey := VertexKey{
+		Type:   RouterVertex,
+		ID:     syntheticRtrId(nbr),
+		AdvRtr: syntheticRtrId(nbr),
+	}
+	cost := syntheticLinkCost(last, nbr)
+	if dist[uKey]+cost <= dist[vKey] {
+		b.Fatal("Link is part of the SPF tree")
+	}
+	linkIdx := -1
+	for i, link := range ospf.findLsaSnapshot(0, lsaKey).rtrLsa.LinkDetails {
+		if link.LinkType == P2PLink && link.LinkId == syntheticRtrId(nbr) {
+			linkIdx = i
+			break
+		}
+	}
+	if linkIdx < 0 {
+		b.Fatal("Link to ", convertUint32ToIPv4(syntheticRtrId(nbr)), " not found")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		old := ospf.findLsaSnapshot(0, lsaKey)
+		lsa := old.rtrLsa
+		lsa.LinkDetails = make([]LinkDetail, len(old.rtrLsa.LinkDetails))
+		copy(lsa.LinkDetails, old.rtrLsa.LinkDetails)
+		lsa.LinkDetails[linkIdx].LinkMetric = cost + uint16(i%2)
+		ospf.AreaLsdb[lsdbKey].RouterLsaMap[lsaKey] = lsa
+		if ospf.recordLsaChange(0, lsaKey, old) {
+			ospf.runSpf()
+		}
+	}
+}
@@ -214,6 +214,9 @@ func (server *OSPFServer) findP2PNextHopIP(vFirst VertexKey, vSecond VertexKey,
 	} else {
 		flag = false
 	}
+	if firstLink.LinkType == VirtualLink {
+		return server.getVirtualLinkNextHop(vSecond.AdvRtr)
+	}
 	for _, link := range secondLsa.LinkDetails {
 		if link.LinkId == vFirst.AdvRtr &&
 			link.LinkType == P2PLink {
@@ -764,11 +767,45 @@ func (server *OSPFServer) ConsolidatingRoutingTbl() {
 	}
 }
 
+/*
+@fn consolidateRoute
+Same as ConsolidatingRoutingTbl for a single destination.
+*/
+func (server *OSPFServer) consolidateRoute(rKey RoutingTblEntryKey) (GlobalRoutingTblEntry, bool) {
+	var ent GlobalRoutingTblEntry
+	for key, _ := range server.AreaConfMap {
+		areaId := convertAreaOrRouterIdUint32(string(key.AreaId))
+		areaIdKey := AreaIdKey{
+			AreaId: areaId,
+		}
+		tempAreaRoutingTbl, exist := server.TempAreaRoutingTbl[areaIdKey]
+		if !exist {
+			continue
+		}
+		rEnt, exist := tempAreaRoutingTbl.RoutingTblMap[rKey]
+		if !exist {
+			continue
+		}
+		ent.AreaId = areaId
+		ent.RoutingTblEnt = rEnt
+		return ent, true
+	}
+	return ent, false
+}
+
 func (server *OSPFServer) InstallRoutingTbl() {
 	server.logger.Info(fmt.Sprintln("Routing Table Consolidation:"))
 	server.ConsolidatingRoutingTbl()
 	server.logger.Info(fmt.Sprintln("Installing Routing Table "))
+	server.installRoutingTblChanges()
+}
 
+/*
+@fn installRoutingTblChanges
+Install, update or delete the routes which differ
+between OldGlobalRoutingTbl and TempGlobalRoutingTbl.
+*/
+func (server *OSPFServer) installRoutingTblChanges() {
 	OldRoutingTblKeys := make(map[RoutingTblEntryKey]bool)
 	NewRoutingTblKeys := make(map[RoutingTblEntryKey]bool)
 
@@ -98,6 +98,11 @@ func (server *OSPFServer) processOspfHeader(ospfPkt []byte, key IntfConfKey, md
 
 	decodeOspfHdr(ospfPkt, ospfHdr)
 
+	if int(ospfHdr.pktlen) < OSPF_HEADER_SIZE || int(ospfHdr.pktlen) > len(ospfPkt) {
+		err := errors.New("Dropped because of invalid Ospf packet length")
+		return err
+	}
+
 	if server.ospfGlobalConf.Version != ospfHdr.ver {
 		err := errors.New("Dropped because of Ospf Version not matching")
 		return err
@@ -118,18 +123,14 @@ func (server *OSPFServer) processOspfHeader(ospfPkt []byte, key IntfConfKey, md
 		md.backbone = false
 	}
 
-	//OSPF Auth Type
-	if ent.IfAuthType != ospfHdr.authType {
-		err := errors.New("Dropped because of Router Id not matching")
-		return err
-	}
-
-	//OSPF Header CheckSum
-	binary.BigEndian.PutUint16(ospfPkt[12:14], 0)
-	copy(ospfPkt[16:OSPF_HEADER_SIZE], []byte{0, 0, 0, 0, 0, 0, 0, 0})
-	csum := computeCheckSum(ospfPkt)
-	if csum != ospfHdr.chksum {
-		err := errors.New("Dropped because of invalid checksum")
+	//OSPF Authentication and Header CheckSum
+	ent = server.getIntfAuthConf(ent)
+	err := authenticateOspfPkt(ent, ospfHdr, ospfPkt[:ospfHdr.pktlen], ospfPkt[ospfHdr.pktlen:], md)
+	if err != nil {
+		if ent.IfAuthState != nil {
+			ent.IfAuthState.incrAuthFailures()
+		}
+		err = errors.New(fmt.Sprintln("Dropped because of authentication failure:", err))
 		return err
 	}
 
@@ -137,7 +138,6 @@ func (server *OSPFServer) processOspfHeader(ospfPkt []byte, key IntfConfKey, md
 	   ToDo:
 	   RFC 2328 Section 8.2
 	   1. Complete AreaID check
-	   2. Authentication
 	*/
 	md.pktType = OspfType(ospfHdr.pktType)
 	md.pktlen = ospfHdr.pktlen
@@ -182,6 +182,7 @@ func (server *OSPFServer) ProcessOspfRecvPkt(key IntfConfKey, pkt gopacket.Packe
 
 	ospfHdrMd := NewOspfHdrMetadata()
 	ospfPkt := ipLayer.LayerPayload()
+	key = server.getVirtualLinkRxIntfKey(key, ent, ospfPkt)
 	err = server.processOspfHeader(ospfPkt, key, ospfHdrMd)
 	if err != nil {
 		server.logger.Err(fmt.Sprintln("Dropped because of Ospf Header processing", err))
@@ -190,7 +191,17 @@ func (server *OSPFServer) ProcessOspfRecvPkt(key IntfConfKey, pkt gopacket.Packe
 		//server.logger.Info("Ospfv2 Header is processed successfully")
 	}
 
-	ospfData := ospfPkt[OSPF_HEADER_SIZE:]
+	nbrKey := NeighborConfKey{
+		IPAddr:  config.IpAddress(net.IP(ipHdrMd.srcIP).String()),
+		IntfIdx: key.IntfIdx,
+	}
+	err = server.checkCryptoSeqNum(key, nbrKey, ospfHdrMd)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("Dropped because of Ospf Header processing", err))
+		return
+	}
+
+	ospfData := ospfPkt[OSPF_HEADER_SIZE:ospfHdrMd.pktlen]
 	err = server.processOspfData(ospfData, ethHdrMd, ipHdrMd, ospfHdrMd, key)
 	if err != nil {
 		server.logger.Err(fmt.Sprintln("Dropped because of Ospf Header processing", err))
@@ -26,7 +26,6 @@ package server
 import (
 	"errors"
 	"fmt"
-	"l3/ospf/config"
 	"sort"
 )
 
@@ -295,17 +294,6 @@ func (server *OSPFServer) UpdateAreaGraphRouterLsa(lsaEnt RouterLsa, lsaKey LsaK
 		server.logger.Info(fmt.Sprintln("SPF Graph:", server.AreaGraph))
 		return nil
 	}
-	if lsaEnt.BitV == true {
-		area := config.AreaId(convertUint32ToIPv4(areaId))
-		areaConfKey := AreaConfKey{
-			AreaId: area,
-		}
-		aEnt, exist := server.AreaConfMap[areaConfKey]
-		if exist && aEnt.TransitCapability == false {
-			aEnt.TransitCapability = true
-			server.AreaConfMap[areaConfKey] = aEnt
-		}
-	}
 	ent.NbrVertexKey = make([]VertexKey, 0)
 	ent.NbrVertexCost = make([]uint16, 0)
 	ent.LinkData = make(map[VertexKey]uint32)
@@ -354,8 +342,9 @@ func (server *OSPFServer) UpdateAreaGraphRouterLsa(lsaEnt RouterLsa, lsaKey LsaK
 			sentry.LsaKey = lsaKey
 			sentry.LinkStateId = lsaKey.LSId
 			server.AreaStubs[vKey] = sentry
-		} else if linkDetail.LinkType == P2PLink {
-			server.logger.Info("===It is P2PLink===")
+		} else if linkDetail.LinkType == P2PLink ||
+			linkDetail.LinkType == VirtualLink {
+			server.logger.Info("===It is P2PLink or VirtualLink===")
 			vKey = VertexKey{
 				Type:   RouterVertex,
 				ID:     linkDetail.LinkId,
@@ -795,14 +784,17 @@ func (server *OSPFServer) spfCalculation() {
 		server.OldGlobalRoutingTbl = server.GlobalRoutingTbl
 		server.TempAreaRoutingTbl = nil
 		server.TempAreaRoutingTbl = make(map[AreaIdKey]AreaRoutingTbl)
+		spfDist := make(map[AreaIdKey]map[VertexKey]uint16)
 		for key, aEnt := range server.AreaConfMap {
 
 			//server.logger.Info(fmt.Sprintln("===========Area Id : ", key.AreaId, "Area Bdr Status:", server.ospfGlobalConf.isABR, "======================================================="))
 			if len(aEnt.IntfListMap) == 0 {
 				continue
 			}
-			aEnt.TransitCapability = false
 			areaId := convertAreaOrRouterIdUint32(string(key.AreaId))
+			areaState, _ := server.AreaStateMap[key]
+			areaState.SpfRuns++
+			server.AreaStateMap[key] = areaState
 			server.initialiseSPFStructs()
 			areaIdKey := AreaIdKey{
 				AreaId: areaId,
@@ -816,6 +808,7 @@ func (server *OSPFServer) spfCalculation() {
 			if err != nil {
 				server.logger.Err(fmt.Sprintln("Error while creating graph for areaId:", areaId))
 				//flag = true
+				server.updateVirtualLinks(areaId)
 				continue
 			}
 			//server.logger.Info("=========================Start before Dijkstra=================")
@@ -827,6 +820,7 @@ func (server *OSPFServer) spfCalculation() {
 			if err != nil {
 				server.logger.Err(fmt.Sprintln("Error while executing Dijkstra for areaId:", areaId))
 				//flag = true
+				server.updateVirtualLinks(areaId)
 				continue
 			}
 			server.logger.Info("=========================Start after Dijkstra=================")
@@ -835,9 +829,17 @@ func (server *OSPFServer) spfCalculation() {
 			//	server.dumpSPFTree()
 			server.logger.Info("=========================End after Dijkstra=================")
 			server.UpdateRoutingTbl(vKey, areaId)
+			dist := make(map[VertexKey]uint16, len(server.SPFTree))
+			for tKey, tEnt := range server.SPFTree {
+				dist[tKey] = tEnt.Distance
+			}
+			spfDist[areaIdKey] = dist
 			server.logger.Info("==============Handling Stub links...====================")
 			server.HandleStubs(vKey, areaId)
 			server.HandleSummaryLsa(areaId)
+			server.nssaTranslatorElection(key, areaId)
+			server.updateTransitCapability(key, areaId)
+			server.updateVirtualLinks(areaId)
 			server.AreaGraph = nil
 			server.AreaStubs = nil
 			server.SPFTree = nil
@@ -847,32 +849,34 @@ func (server *OSPFServer) spfCalculation() {
 		*/
 		server.TempGlobalRoutingTbl = nil
 		server.TempGlobalRoutingTbl = make(map[RoutingTblEntryKey]GlobalRoutingTblEntry)
-		/* Summarize and Install/Delete Routes In Routing Table */
-		server.InstallRoutingTbl()
-		// Copy the Summarize Routing Table in Global Routing Table
-		server.GlobalRoutingTbl = nil
-		server.GlobalRoutingTbl = make(map[RoutingTblEntryKey]GlobalRoutingTblEntry)
-		server.GlobalRoutingTbl = server.TempGlobalRoutingTbl
-		//server.dumpGlobalRoutingTbl()
-		for key, _ := range server.AreaConfMap {
-			areaId := convertAreaOrRouterIdUint32(string(key.AreaId))
-			areaIdKey := AreaIdKey{
-				AreaId: areaId,
-			}
-			tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
-			tempAreaRoutingTbl.RoutingTblMap = nil
-			server.TempAreaRoutingTbl[areaIdKey] = tempAreaRoutingTbl
+		restarting := server.isGracefulRestarting()
+		if !restarting {
+			/* Summarize and Install/Delete Routes In Routing Table */
+			server.InstallRoutingTbl()
+			// Copy the Summarize Routing Table in Global Routing Table
+			server.GlobalRoutingTbl = nil
+			server.GlobalRoutingTbl = make(map[RoutingTblEntryKey]GlobalRoutingTblEntry)
+			server.GlobalRoutingTbl = server.TempGlobalRoutingTbl
+		} else {
+			server.logger.Info("Graceful restart. Keep the preserved routes.")
 		}
+		//server.dumpGlobalRoutingTbl()
+		// Keep the area routing tables and SPF distances
+		// for partial route calculation
+		server.AreaRoutingTbl = server.TempAreaRoutingTbl
+		server.areaSpfDist = spfDist
 		server.TempAreaRoutingTbl = nil
 		server.OldGlobalRoutingTbl = nil
 		server.TempGlobalRoutingTbl = nil
 		//server.dumpGlobalRoutingTbl()
-		if server.ospfGlobalConf.AreaBdrRtrStatus == true {
+		if server.ospfGlobalConf.AreaBdrRtrStatus == true && !restarting {
 			server.logger.Info("Examine transit areas, Summary LSA...")
 			server.HandleTransitAreaSummaryLsa()
 			server.logger.Info("Generate Summary LSA...")
 			server.GenerateSummaryLsa()
 			server.logger.Info(fmt.Sprintln("========", server.SummaryLsDb, "=========="))
+			server.logger.Info("Generate NSSA translated LSA...")
+			server.GenerateNssaTranslatedLsa()
 		}
 		server.DoneCalcSPFCh <- true
 	}
@@ -0,0 +1,180 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"fmt"
+	"l3/ospf/config"
+	"time"
+)
+
+/*
+RFC 6987 stub router advertisement.
+While in stub router mode all non stub links of the
+self originated router LSAs are advertised with
+MaxLinkMetric so that transit traffic avoids this router.
+*/
+const (
+	MaxLinkMetric        = 0xffff
+	StubRouterBgpMaxWait = 600 // seconds
+)
+
+func (server *OSPFServer) isStubRouter() bool {
+	return server.ospfGlobalConf.StubRouterMode != config.StubRouterNone &&
+		server.ospfGlobalConf.StubRouterMode != 0
+}
+
+/*
+@fn startStubRouter
+Called whenever the global config is applied with OSPF
+enabled. The on startup stub router period is started
+the first time after OSPF got enabled, the administrative
+mode follows the current configuration.
+*/
+func (server *OSPFServer) startStubRouter() {
+	if !server.stubRouterChecked {
+		server.stubRouterChecked = true
+		wait := server.ospfGlobalConf.StubRouterOnStartup
+		if server.ospfGlobalConf.StubRouterWaitForBgp {
+			/* max time to wait for BGP to converge */
+			if wait <= 0 {
+				wait = StubRouterBgpMaxWait
+			}
+			server.stubRouterWaitBgp = true
+		}
+		if wait > 0 {
+			server.stubRouterExpiry = time.Now().Add(time.Duration(wait) * time.Second)
+			server.ospfGlobalConf.StubRouterAge = wait
+		}
+		server.logger.Info(fmt.Sprintln("STUBRTR: Startup period ", wait,
+			" wait for bgp ", server.stubRouterWaitBgp))
+	}
+	server.ospfGlobalConf.StubRouterMode = server.getStubRouterMode()
+	server.logger.Info(fmt.Sprintln("STUBRTR: Mode ", server.ospfGlobalConf.StubRouterMode))
+}
+
+/*
+@fn stopStubRouter
+Called when OSPF is disabled. The startup period is
+started again the next time OSPF is enabled.
+*/
+func (server *OSPFServer) stopStubRouter() {
+	server.stubRouterChecked = false
+	server.stubRouterExpiry = time.Time{}
+	server.stubRouterWaitBgp = false
+	server.stubRouterBgpConverged = false
+	server.ospfGlobalConf.StubRouterMode = config.StubRouterNone
+	server.ospfGlobalConf.StubRouterAge = 0
+}
+
+/*
+@fn getStubRouterMode
+Administrative stub router takes precedence over
+the startup modes.
+*/
+func (server *OSPFServer) getStubRouterMode() config.StubRouterMode {
+	if server.ospfGlobalConf.StubRouterAdvertisement == config.Advertise {
+		return config.StubRouterAdmin
+	}
+	if server.stubRouterExpiry.IsZero() {
+		return config.StubRouterNone
+	}
+	if server.stubRouterWaitBgp {
+		return config.StubRouterWaitForBgp
+	}
+	return config.StubRouterStartup
+}
+
+/*
+@fn processStubRouterTick
+Visited every LSDB tick. Expire the startup period and
+re-originate router LSAs when the stub router mode changes.
+*/
+func (server *OSPFServer) processStubRouterTick() {
+	if !server.stubRouterExpiry.IsZero() {
+		remaining := server.stubRouterExpiry.Sub(time.Now())
+		if remaining <= 0 ||
+			(server.stubRouterWaitBgp && server.stubRouterBgpConverged) {
+			server.logger.Info(fmt.Sprintln("STUBRTR: Startup period over. bgp converged ",
+				server.stubRouterBgpConverged))
+			server.stubRouterExpiry = time.Time{}
+			server.stubRouterWaitBgp = false
+			server.ospfGlobalConf.StubRouterAge = 0
+		} else {
+			server.ospfGlobalConf.StubRouterAge = int32(remaining / time.Second)
+		}
+	}
+	mode := server.getStubRouterMode()
+	if mode == server.ospfGlobalConf.StubRouterMode {
+		return
+	}
+	server.logger.Info(fmt.Sprintln("STUBRTR: Mode changed from ",
+		server.ospfGlobalConf.StubRouterMode, " to ", mode))
+	server.ospfGlobalConf.StubRouterMode = mode
+	msg := DbEventMsg{
+		eventType: config.LSA,
+		eventInfo: fmt.Sprintln("Stub router mode ", mode),
+	}
+	server.DbEventOp <- msg
+	server.regenerateRouterLsaAllAreas()
+}
+
+/*
+@fn BgpConverged
+Called on the convergence notification published by
+bgpd. Ends the wait for BGP stub router period.
+*/
+func (server *OSPFServer) BgpConverged() {
+	select {
+	case server.BgpConvergedCh <- true:
+	default:
+	}
+}
+
+func (server *OSPFServer) processBgpConverged() {
+	server.logger.Info("STUBRTR: BGP converged.")
+	server.stubRouterBgpConverged = true
+	server.processStubRouterTick()
+}
+
+/*
+@fn regenerateRouterLsaAllAreas
+Originate and flood the router LSA of every area
+and recalculate the routes.
+*/
+func (server *OSPFServer) regenerateRouterLsaAllAreas() {
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	lsaKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      rtrId,
+		AdvRouter: rtrId,
+	}
+	nbr := NeighborConfKey{}
+	for key, _ := range server.AreaConfMap {
+		areaId := convertAreaOrRouterIdUint32(string(key.AreaId))
+		server.generateRouterLSA(areaId)
+		server.sendLsdbToNeighborEvent(IntfConfKey{}, nbr, areaId, 0, 0, lsaKey, LSAROUTERFLOOD)
+	}
+	server.scheduleSpf(SpfTrigStubRouter)
+}
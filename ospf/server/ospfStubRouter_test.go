@@ -0,0 +1,266 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"encoding/json"
+	"l3/bgp/bgpdCommonDefs"
+	"l3/ospf/config"
+	"net"
+	"testing"
+)
+
+const (
+	stubTestAreaId   = uint32(0)
+	stubTestRtrId    = uint32(0x0a010101)
+	stubTestNbrRtrId = uint32(0x0a010102)
+	stubTestLocalIp  = uint32(0x14010101)
+	stubTestNbrIp    = uint32(0x14010102)
+	stubTestStubIp   = uint32(0x1e010101)
+	stubTestCost     = 10
+)
+
+func initStubRouterTestParams() LsaKey {
+	ospf = getServerObject()
+	ospf.initOspfGlobalConfDefault()
+	ospf.DbLsdbOp = make(chan DbLsdbMsg)
+	ospf.DbEventOp = make(chan DbEventMsg)
+	ospf.ospfGlobalConf.RouterId = []byte{10, 1, 1, 1}
+	ospfIntfToNbrMap = make(map[IntfConfKey]ospfNbrMdata)
+	areaKey := AreaConfKey{
+		AreaId: config.AreaId(convertUint32ToIPv4(stubTestAreaId)),
+	}
+	ospf.AreaConfMap[areaKey] = AreaConf{
+		IntfListMap: make(map[IntfConfKey]bool),
+	}
+	ospf.initLSDatabase(stubTestAreaId)
+
+	/* transit network */
+	intfKey := IntfConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(stubTestLocalIp)),
+		IntfIdx: 1,
+	}
+	nbrKey := NeighborConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(stubTestNbrIp)),
+		IntfIdx: 1,
+	}
+	nbrMap := make(map[NeighborConfKey]NeighborData)
+	nbrMap[nbrKey] = NeighborData{
+		TwoWayStatus: true,
+		NbrIP:        stubTestNbrIp,
+	}
+	ospf.IntfConfMap[intfKey] = IntfConf{
+		IfAreaId:    convertAreaOrRouterId(convertUint32ToIPv4(stubTestAreaId)),
+		IfType:      config.Broadcast,
+		IfIpAddr:    net.ParseIP(convertUint32ToIPv4(stubTestLocalIp)),
+		IfNetmask:   []byte{255, 255, 255, 0},
+		IfDRIp:      []byte{20, 1, 1, 2},
+		IfFSMState:  config.OtherDesignatedRouter,
+		IfCost:      stubTestCost,
+		NeighborMap: nbrMap,
+	}
+
+	/* stub network */
+	stubKey := IntfConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(stubTestStubIp)),
+		IntfIdx: 2,
+	}
+	ospf.IntfConfMap[stubKey] = IntfConf{
+		IfAreaId:    convertAreaOrRouterId(convertUint32ToIPv4(stubTestAreaId)),
+		IfType:      config.Broadcast,
+		IfIpAddr:    net.ParseIP(convertUint32ToIPv4(stubTestStubIp)),
+		IfNetmask:   []byte{255, 255, 255, 0},
+		IfFSMState:  config.DesignatedRouter,
+		IfCost:      stubTestCost,
+		NeighborMap: make(map[NeighborConfKey]NeighborData),
+	}
+	go startDummyChannels(ospf)
+	return LsaKey{
+		LSType:    RouterLSA,
+		LSId:      stubTestRtrId,
+		AdvRouter: stubTestRtrId,
+	}
+}
+
+func checkStubRouterLinkMetric(t *testing.T, lsaKey LsaKey, transitMetric uint16) {
+	lsdbKey := LsdbKey{
+		AreaId: stubTestAreaId,
+	}
+	lsa, exist := ospf.AreaLsdb[lsdbKey].RouterLsaMap[lsaKey]
+	if !exist || len(lsa.LinkDetails) != 2 {
+		t.Error("Router LSA not generated ", lsa)
+		return
+	}
+	for _, link := range lsa.LinkDetails {
+		switch link.LinkType {
+		case TransitLink:
+			if link.LinkMetric != transitMetric {
+				t.Error("Wrong transit link metric ", link.LinkMetric, " expected ", transitMetric)
+			}
+		case StubLink:
+			if link.LinkMetric != stubTestCost {
+				t.Error("Stub link metric changed ", link.LinkMetric)
+			}
+		}
+	}
+}
+
+func TestStubRouterStartup(t *testing.T) {
+	lsaKey := initStubRouterTestParams()
+	ospf.generateRouterLSA(stubTestAreaId)
+	checkStubRouterLinkMetric(t, lsaKey, stubTestCost)
+
+	ospf.ospfGlobalConf.StubRouterOnStartup = 30
+	ospf.startStubRouter()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterStartup ||
+		ospf.ospfGlobalConf.StubRouterAge != 30 {
+		t.Error("Stub router not started ", ospf.ospfGlobalConf.StubRouterMode)
+	}
+	ospf.generateRouterLSA(stubTestAreaId)
+	checkStubRouterLinkMetric(t, lsaKey, MaxLinkMetric)
+
+	/* BGP has no effect on startup mode */
+	ospf.processBgpConverged()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterStartup {
+		t.Error("Stub router startup ended by BGP")
+	}
+
+	/* startup period expires */
+	ospf.stubRouterExpiry = ospf.stubRouterExpiry.AddDate(0, 0, -1)
+	ospf.processStubRouterTick()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterNone ||
+		ospf.ospfGlobalConf.StubRouterAge != 0 {
+		t.Error("Stub router startup not expired ", ospf.ospfGlobalConf.StubRouterMode)
+	}
+	checkStubRouterLinkMetric(t, lsaKey, stubTestCost)
+}
+
+func TestStubRouterWaitForBgp(t *testing.T) {
+	lsaKey := initStubRouterTestParams()
+	ospf.ospfGlobalConf.StubRouterWaitForBgp = true
+	ospf.startStubRouter()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterWaitForBgp ||
+		ospf.ospfGlobalConf.StubRouterAge != StubRouterBgpMaxWait {
+		t.Error("Stub router not waiting for BGP ", ospf.ospfGlobalConf.StubRouterMode)
+	}
+	ospf.generateRouterLSA(stubTestAreaId)
+	checkStubRouterLinkMetric(t, lsaKey, MaxLinkMetric)
+
+	ospf.processStubRouterTick()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterWaitForBgp {
+		t.Error("Stub router ended before BGP converged")
+	}
+	ospf.BgpConverged()
+	<-ospf.BgpConvergedCh
+	ospf.processBgpConverged()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterNone {
+		t.Error("Stub router not ended after BGP converged")
+	}
+	checkStubRouterLinkMetric(t, lsaKey, stubTestCost)
+}
+
+func TestStubRouterAdmin(t *testing.T) {
+	lsaKey := initStubRouterTestParams()
+	ospf.startStubRouter()
+	if ospf.isStubRouter() {
+		t.Error("Stub router without configuration")
+	}
+	ospf.ospfGlobalConf.StubRouterAdvertisement = config.Advertise
+	ospf.processStubRouterTick()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterAdmin {
+		t.Error("Admin stub router not set ", ospf.ospfGlobalConf.StubRouterMode)
+	}
+	checkStubRouterLinkMetric(t, lsaKey, MaxLinkMetric)
+
+	ospf.ospfGlobalConf.StubRouterAdvertisement = config.DoNotAdvertise
+	ospf.processStubRouterTick()
+	if ospf.isStubRouter() {
+		t.Error("Admin stub router not cleared")
+	}
+	checkStubRouterLinkMetric(t, lsaKey, stubTestCost)
+
+	/* config applied again while enabled */
+	ospf.ospfGlobalConf.StubRouterAdvertisement = config.Advertise
+	ospf.startStubRouter()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterAdmin {
+		t.Error("Admin stub router not set again ", ospf.ospfGlobalConf.StubRouterMode)
+	}
+	ospf.ospfGlobalConf.StubRouterAdvertisement = config.DoNotAdvertise
+	ospf.startStubRouter()
+
+	state := ospf.GetOspfGlobalState()
+	if !state.StubRouterSupport || state.StubRouterMode != config.StubRouterNone {
+		t.Error("Wrong stub router state ", state)
+	}
+}
+
+func TestStubRouterRestart(t *testing.T) {
+	initStubRouterTestParams()
+	ospf.ospfGlobalConf.StubRouterWaitForBgp = true
+	ospf.startStubRouter()
+	ospf.processBgpConverged()
+	if ospf.isStubRouter() {
+		t.Error("Stub router not ended after BGP converged")
+	}
+
+	/* startup period is not started again while enabled */
+	ospf.startStubRouter()
+	if ospf.isStubRouter() {
+		t.Error("Stub router startup period started again ", ospf.ospfGlobalConf.StubRouterMode)
+	}
+
+	/* OSPF disabled and enabled again */
+	ospf.stopStubRouter()
+	if ospf.stubRouterChecked || ospf.stubRouterBgpConverged {
+		t.Error("Stub router state not cleared")
+	}
+	ospf.startStubRouter()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterWaitForBgp {
+		t.Error("Stub router not waiting for BGP after restart ", ospf.ospfGlobalConf.StubRouterMode)
+	}
+	ospf.processStubRouterTick()
+	if ospf.ospfGlobalConf.StubRouterMode != config.StubRouterWaitForBgp {
+		t.Error("Stub router ended by an old BGP convergence")
+	}
+}
+
+func TestBgpdNotification(t *testing.T) {
+	initStubRouterTestParams()
+	buf, _ := json.Marshal(bgpdCommonDefs.BgpdNotifyMsg{
+		MsgType: bgpdCommonDefs.NOTIFY_BGP_CONVERGED,
+	})
+	ospf.processBgpdNotification(buf)
+	select {
+	case <-ospf.BgpConvergedCh:
+	default:
+		t.Error("BGP converged notification not processed")
+	}
+
+	ospf.processBgpdNotification([]byte("garbage"))
+	select {
+	case <-ospf.BgpConvergedCh:
+		t.Error("BGP converged on an invalid notification")
+	default:
+	}
+}
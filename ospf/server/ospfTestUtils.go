@@ -905,3 +905,121 @@ func getServerObject() *OSPFServer {
 	ospf = ospfServer
 	return ospfServer
 }
+
+/*
+Synthetic area 0 topology for the SPF benchmarks. gridSize x
+gridSize routers connected by point-to-point links. Every router
+has a stub network, the first router is the local router and the
+second one is an ABR advertising numSummary type 3 summary LSAs.
+Link costs vary so that the number of equal cost paths stays small.
+*/
+const (
+	syntheticRtrBase     = uint32(0x0b000000) // 11.0.0.0
+	syntheticLinkBase    = uint32(0x14000000) // 20.0.0.0
+	syntheticStubBase    = uint32(0x1e000000) // 30.0.0.0
+	syntheticSummaryBase = uint32(0x28000000) // 40.0.0.0
+	syntheticNetmask     = uint32(0xffffff00)
+	syntheticStubCost    = 1
+	syntheticSummaryCost = 5
+)
+
+func syntheticRtrId(idx int) uint32 {
+	return syntheticRtrBase + uint32(idx) + 1
+}
+
+func syntheticLinkCost(idx1 int, idx2 int) uint16 {
+	if idx1 > idx2 {
+		idx1, idx2 = idx2, idx1
+	}
+	return uint16(10 + (idx1*31+idx2*17)%89)
+}
+
+func syntheticSummaryKey(idx int) LsaKey {
+	return LsaKey{
+		LSType:    Summary3LSA,
+		LSId:      syntheticSummaryBase + uint32(idx)<<8,
+		AdvRouter: syntheticRtrId(1),
+	}
+}
+
+func initSyntheticTopology(server *OSPFServer, gridSize int, numSummary int) {
+	areaId := uint32(0)
+	server.initOspfGlobalConfDefault()
+	server.ospfGlobalConf.RouterId = net.ParseIP(convertUint32ToIPv4(syntheticRtrId(0))).To4()
+	areaKey := AreaConfKey{
+		AreaId: config.AreaId(convertUint32ToIPv4(areaId)),
+	}
+	intfKey := IntfConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(syntheticLinkBase)),
+		IntfIdx: 1,
+	}
+	intfList := make(map[IntfConfKey]bool)
+	intfList[intfKey] = true
+	server.AreaConfMap[areaKey] = AreaConf{
+		IntfListMap: intfList,
+	}
+	server.initLSDatabase(areaId)
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt := server.AreaLsdb[lsdbKey]
+	lsaMd := LsaMetadata{
+		LSAge:         1,
+		LSSequenceNum: 1,
+	}
+	for row := 0; row < gridSize; row++ {
+		for col := 0; col < gridSize; col++ {
+			idx := row*gridSize + col
+			rtrId := syntheticRtrId(idx)
+			var nbrs []int
+			if row > 0 {
+				nbrs = append(nbrs, idx-gridSize)
+			}
+			if row < gridSize-1 {
+				nbrs = append(nbrs, idx+gridSize)
+			}
+			if col > 0 {
+				nbrs = append(nbrs, idx-1)
+			}
+			if col < gridSize-1 {
+				nbrs = append(nbrs, idx+1)
+			}
+			lsa := RouterLsa{
+				LsaMd: lsaMd,
+				BitB:  idx == 1,
+			}
+			for i, nbr := range nbrs {
+				lsa.LinkDetails = append(lsa.LinkDetails, LinkDetail{
+					LinkId:     syntheticRtrId(nbr),
+					LinkData:   syntheticLinkBase + uint32(idx)<<4 + uint32(i),
+					LinkType:   P2PLink,
+					LinkMetric: syntheticLinkCost(idx, nbr),
+				})
+			}
+			lsa.LinkDetails = append(lsa.LinkDetails, LinkDetail{
+				LinkId:     syntheticStubBase + uint32(idx)<<8,
+				LinkData:   syntheticNetmask,
+				LinkType:   StubLink,
+				LinkMetric: syntheticStubCost,
+			})
+			lsa.NumOfLinks = uint16(len(lsa.LinkDetails))
+			lsaKey := LsaKey{
+				LSType:    RouterLSA,
+				LSId:      rtrId,
+				AdvRouter: rtrId,
+			}
+			lsDbEnt.RouterLsaMap[lsaKey] = lsa
+			if idx == 0 {
+				server.AreaSelfOrigLsa[lsdbKey][lsaKey] = true
+			}
+		}
+	}
+	for i := 0; i < numSummary; i++ {
+		lsDbEnt.Summary3LsaMap[syntheticSummaryKey(i)] = SummaryLsa{
+			LsaMd:   lsaMd,
+			Netmask: syntheticNetmask,
+			Metric:  syntheticSummaryCost,
+		}
+	}
+	server.AreaLsdb[lsdbKey] = lsDbEnt
+}
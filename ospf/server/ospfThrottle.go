@@ -0,0 +1,358 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"fmt"
+	"l3/ospf/config"
+	"strings"
+	"time"
+)
+
+/* Default SPF and LSA generation throttle timers in milliseconds */
+const (
+	SpfInitialDelay = 50
+	SpfHoldTime     = 200
+	SpfMaxWait      = 5000
+	LsaInitialDelay = 0
+	LsaHoldTime     = 5000 // MinLSInterval
+	LsaMaxWait      = 5000
+)
+
+const (
+	MinLSArrival     = time.Second
+	SpfLogMaxEntries = 64
+)
+
+/* SPF trigger reasons */
+const (
+	SpfTrigLsaUpdate   = "LSA update"
+	SpfTrigLsaDelete   = "LSA delete"
+	SpfTrigIntfChange  = "Interface change"
+	SpfTrigDrChange    = "DR change"
+	SpfTrigNbrFull     = "Neighbor full"
+	SpfTrigGraceExit   = "Graceful restart exit"
+	SpfTrigStubRouter  = "Stub router change"
+	SpfTrigLsaThrottle = "Throttled LSA"
+	SpfLogPartial      = " (partial)"
+)
+
+type ospfThrottle struct {
+	currHold time.Duration
+	lastRun  time.Time
+}
+
+type lsaThrottleKey struct {
+	AreaId  uint32
+	LSType  uint8
+	IntfKey IntfConfKey
+}
+
+type lsaThrottleEnt struct {
+	throttle ospfThrottle
+	pending  bool
+	due      time.Time
+}
+
+type lsaArrivalKey struct {
+	AreaId uint32
+	LsaKey LsaKey
+}
+
+func msToDuration(ms int32) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+/*
+@fn nextDelay
+The first event after a quiet period waits for the initial delay.
+Events within the hold time wait for the hold time to expire and
+the hold time is doubled up to max wait.
+*/
+func (t *ospfThrottle) nextDelay(now time.Time, initial time.Duration,
+	hold time.Duration, maxWait time.Duration) time.Duration {
+	if t.currHold < hold {
+		t.currHold = hold
+	}
+	since := now.Sub(t.lastRun)
+	if t.lastRun.IsZero() || since >= 2*t.currHold {
+		t.currHold = hold
+		return initial
+	}
+	delay := t.currHold - since
+	if delay < initial {
+		delay = initial
+	}
+	t.currHold = 2 * t.currHold
+	if t.currHold > maxWait {
+		t.currHold = maxWait
+	}
+	return delay
+}
+
+/*
+@fn scheduleSpf
+Called from the LSDB thread instead of running SPF
+on every change. SPF runs when the throttle timer fires.
+*/
+func (server *OSPFServer) scheduleSpf(trigger string) {
+	server.spfChange.full = true
+	server.scheduleRouteCalc(trigger)
+}
+
+/*
+@fn scheduleRouteCalc
+Same as scheduleSpf but a full SPF is run only if one of
+the recorded LSA changes needs it.
+*/
+func (server *OSPFServer) scheduleRouteCalc(trigger string) {
+	found := false
+	for _, t := range server.spfTriggers {
+		if t == trigger {
+			found = true
+			break
+		}
+	}
+	if !found {
+		server.spfTriggers = append(server.spfTriggers, trigger)
+	}
+	if server.spfPending {
+		return
+	}
+	conf := server.ospfGlobalConf
+	delay := server.spfThrottle.nextDelay(time.Now(), msToDuration(conf.SpfInitialDelay),
+		msToDuration(conf.SpfHoldTime), msToDuration(conf.SpfMaxWait))
+	if delay <= 0 {
+		server.runSpf()
+		return
+	}
+	server.logger.Info(fmt.Sprintln("SPF: Scheduled after ", delay, " trigger ", trigger))
+	server.spfPending = true
+	if server.spfTimer == nil {
+		server.spfTimer = time.NewTimer(delay)
+	} else {
+		server.spfTimer.Reset(delay)
+	}
+}
+
+func (server *OSPFServer) runSpf() {
+	server.spfPending = false
+	trigger := strings.Join(server.spfTriggers, ", ")
+	server.spfTriggers = nil
+	change := server.spfChange
+	server.spfChange = spfChangeSet{}
+	start := time.Now()
+	if !change.full && server.partialRouteCalcAllowed() {
+		server.partialRouteCalc(change)
+		server.spfThrottle.lastRun = time.Now()
+		duration := server.spfThrottle.lastRun.Sub(start)
+		server.logger.Info(fmt.Sprintln("Partial route calculation trigger ", trigger,
+			" duration ", duration))
+		server.addSpfLog(start, duration, trigger+SpfLogPartial)
+		if server.ospfGlobalConf.AreaBdrRtrStatus == true {
+			server.installSummaryLsa()
+		}
+		return
+	}
+	server.StartCalcSPFCh <- true
+	spfStatus := <-server.DoneCalcSPFCh
+	server.spfThrottle.lastRun = time.Now()
+	duration := server.spfThrottle.lastRun.Sub(start)
+	server.logger.Info(fmt.Sprintln("SPF Calculation Return Status", spfStatus,
+		" trigger ", trigger, " duration ", duration))
+	server.addSpfLog(start, duration, trigger)
+	if server.ospfGlobalConf.AreaBdrRtrStatus == true {
+		server.installSummaryLsa()
+	}
+}
+
+func (server *OSPFServer) addSpfLog(start time.Time, duration time.Duration, trigger string) {
+	ent := config.SpfLogState{
+		Index:     server.spfLogSeq,
+		TimeStamp: start.String(),
+		Duration:  int32(duration / time.Microsecond),
+		Trigger:   trigger,
+	}
+	server.spfLogSeq++
+	server.spfLogMutex.Lock()
+	server.SpfLog = append(server.SpfLog, ent)
+	if len(server.SpfLog) > SpfLogMaxEntries {
+		server.SpfLog = server.SpfLog[len(server.SpfLog)-SpfLogMaxEntries:]
+	}
+	server.spfLogMutex.Unlock()
+}
+
+func (server *OSPFServer) GetBulkOspfSpfLogState(idx int, cnt int) (int, int, []config.SpfLogState) {
+	server.spfLogMutex.RLock()
+	defer server.spfLogMutex.RUnlock()
+	length := len(server.SpfLog)
+	if idx < 0 || idx >= length || cnt <= 0 {
+		return 0, 0, nil
+	}
+	count := cnt
+	nextIdx := idx + cnt
+	if nextIdx >= length {
+		count = length - idx
+		nextIdx = 0
+	}
+	result := make([]config.SpfLogState, count)
+	copy(result, server.SpfLog[idx:idx+count])
+	return nextIdx, count, result
+}
+
+/*
+@fn lsaThrottleCheck
+Returns true if the LSA can be originated now. Otherwise
+it is originated from the LSDB tick once the throttle expires.
+*/
+func (server *OSPFServer) lsaThrottleCheck(key lsaThrottleKey) bool {
+	ent, _ := server.lsaThrottleMap[key]
+	if ent.pending {
+		return false
+	}
+	now := time.Now()
+	conf := server.ospfGlobalConf
+	delay := ent.throttle.nextDelay(now, msToDuration(conf.LsaInitialDelay),
+		msToDuration(conf.LsaHoldTime), msToDuration(conf.LsaMaxWait))
+	if delay <= 0 {
+		ent.throttle.lastRun = now
+		server.lsaThrottleMap[key] = ent
+		return true
+	}
+	server.logger.Info(fmt.Sprintln("LSDB: Throttle LSA origination ", key, " delay ", delay))
+	ent.pending = true
+	ent.due = now.Add(delay)
+	server.lsaThrottleMap[key] = ent
+	return false
+}
+
+/*
+@fn generateRouterLsaThrottled
+Returns true if the router LSA was originated and needs
+to be flooded. A throttled LSA is flooded from the tick.
+*/
+func (server *OSPFServer) generateRouterLsaThrottled(areaId uint32) bool {
+	key := lsaThrottleKey{
+		AreaId: areaId,
+		LSType: RouterLSA,
+	}
+	if !server.lsaThrottleCheck(key) {
+		return false
+	}
+	server.generateRouterLSA(areaId)
+	return true
+}
+
+func (server *OSPFServer) generateNetworkLsaThrottled(areaId uint32, intfKey IntfConfKey) bool {
+	key := lsaThrottleKey{
+		AreaId:  areaId,
+		LSType:  NetworkLSA,
+		IntfKey: intfKey,
+	}
+	if !server.lsaThrottleCheck(key) {
+		return false
+	}
+	server.generateNetworkLSA(areaId, intfKey, true)
+	return true
+}
+
+/*
+@fn processLsaThrottleTick
+Visited every LSDB tick. Originate and flood the
+throttled LSAs whose hold time expired.
+*/
+func (server *OSPFServer) processLsaThrottleTick() {
+	now := time.Now()
+	server.pruneLsaArrivalMap(now)
+	rtrId := convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	nbr := NeighborConfKey{}
+	generated := false
+	for key, ent := range server.lsaThrottleMap {
+		if !ent.pending || now.Before(ent.due) {
+			continue
+		}
+		ent.pending = false
+		ent.throttle.lastRun = now
+		server.lsaThrottleMap[key] = ent
+		switch key.LSType {
+		case RouterLSA:
+			lsaKey := LsaKey{
+				LSType:    RouterLSA,
+				LSId:      rtrId,
+				AdvRouter: rtrId,
+			}
+			server.generateRouterLSA(key.AreaId)
+			server.sendLsdbToNeighborEvent(IntfConfKey{}, nbr, key.AreaId, 0, 0, lsaKey, LSAROUTERFLOOD)
+		case NetworkLSA:
+			intf, exist := server.IntfConfMap[key.IntfKey]
+			if !exist || intf.IfDRtrId != rtrId || len(intf.NeighborMap) == 0 {
+				continue
+			}
+			server.generateNetworkLSA(key.AreaId, key.IntfKey, true)
+			server.sendLsdbToNeighborEvent(key.IntfKey, nbr, key.AreaId, 0, 0, LsaKey{}, LSAFLOOD)
+		}
+		generated = true
+	}
+	if generated {
+		server.scheduleSpf(SpfTrigLsaThrottle)
+	}
+}
+
+/*
+@fn lsaArrivalCheck
+RFC 2328 13 (5a): an LSA instance arriving less than
+MinLSArrival after the previous one is discarded.
+Returns false if the LSA should be discarded.
+*/
+func (server *OSPFServer) lsaArrivalCheck(areaId uint32, lsaKey LsaKey) bool {
+	key := lsaArrivalKey{
+		AreaId: areaId,
+		LsaKey: lsaKey,
+	}
+	now := time.Now()
+	server.lsaArrivalMutex.Lock()
+	defer server.lsaArrivalMutex.Unlock()
+	last, exist := server.lsaArrivalMap[key]
+	if exist && now.Sub(last) < MinLSArrival {
+		return false
+	}
+	server.lsaArrivalMap[key] = now
+	return true
+}
+
+/*
+@fn pruneLsaArrivalMap
+Entries older than MinLSArrival no longer discard
+anything, remove them so that the map does not keep
+every LSA ever received.
+*/
+func (server *OSPFServer) pruneLsaArrivalMap(now time.Time) {
+	server.lsaArrivalMutex.Lock()
+	defer server.lsaArrivalMutex.Unlock()
+	for key, last := range server.lsaArrivalMap {
+		if now.Sub(last) >= MinLSArrival {
+			delete(server.lsaArrivalMap, key)
+		}
+	}
+}
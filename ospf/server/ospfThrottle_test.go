@@ -0,0 +1,175 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOspfThrottleBackoff(t *testing.T) {
+	var throttle ospfThrottle
+	initial := 50 * time.Millisecond
+	hold := 200 * time.Millisecond
+	maxWait := time.Second
+	now := time.Now()
+
+	if delay := throttle.nextDelay(now, initial, hold, maxWait); delay != initial {
+		t.Error("First event not delayed by initial delay ", delay)
+	}
+	throttle.lastRun = now
+	expected := []time.Duration{hold, 2 * hold, 4 * hold, maxWait, maxWait}
+	for _, exp := range expected {
+		if delay := throttle.nextDelay(now, initial, hold, maxWait); delay != exp {
+			t.Error("Wrong backoff delay ", delay, " expected ", exp)
+		}
+	}
+
+	/* quiet period resets the backoff */
+	later := now.Add(2 * maxWait)
+	if delay := throttle.nextDelay(later, initial, hold, maxWait); delay != initial {
+		t.Error("Backoff not reset after quiet period ", delay)
+	}
+	if throttle.currHold != hold {
+		t.Error("Hold time not reset ", throttle.currHold)
+	}
+}
+
+func TestScheduleSpf(t *testing.T) {
+	initStubRouterTestParams()
+	ospf.scheduleSpf(SpfTrigLsaUpdate)
+	if !ospf.spfPending {
+		t.Error("SPF not throttled by initial delay")
+	}
+	ospf.scheduleSpf(SpfTrigIntfChange)
+	ospf.scheduleSpf(SpfTrigLsaUpdate)
+	if len(ospf.spfTriggers) != 2 {
+		t.Error("Wrong SPF triggers ", ospf.spfTriggers)
+	}
+	<-ospf.spfTimer.C
+	ospf.runSpf()
+	if ospf.spfPending || ospf.spfTriggers != nil {
+		t.Error("SPF still pending after run")
+	}
+	nextIdx, count, spfLog := ospf.GetBulkOspfSpfLogState(0, 10)
+	if nextIdx != 0 || count != 1 ||
+		spfLog[0].Trigger != SpfTrigLsaUpdate+", "+SpfTrigIntfChange {
+		t.Error("Wrong SPF log ", spfLog)
+	}
+
+	/* SPF within the hold time is delayed */
+	ospf.scheduleSpf(SpfTrigNbrFull)
+	if !ospf.spfPending {
+		t.Error("SPF not throttled within hold time")
+	}
+
+	for i := 0; i < SpfLogMaxEntries+1; i++ {
+		ospf.runSpf()
+	}
+	if len(ospf.SpfLog) != SpfLogMaxEntries ||
+		ospf.SpfLog[SpfLogMaxEntries-1].Index != SpfLogMaxEntries+1 {
+		t.Error("SPF log not bounded ", len(ospf.SpfLog))
+	}
+}
+
+func TestLsaThrottle(t *testing.T) {
+	lsaKey := initStubRouterTestParams()
+	lsdbKey := LsdbKey{
+		AreaId: stubTestAreaId,
+	}
+	if !ospf.generateRouterLsaThrottled(stubTestAreaId) ||
+		ospf.AreaLsdb[lsdbKey].RouterLsaMap[lsaKey].LsaMd.LSSequenceNum != InitialSequenceNumber {
+		t.Error("Router LSA not originated")
+	}
+
+	/* origination within MinLSInterval is deferred */
+	if ospf.generateRouterLsaThrottled(stubTestAreaId) {
+		t.Error("Throttled router LSA reported as originated")
+	}
+	if ospf.AreaLsdb[lsdbKey].RouterLsaMap[lsaKey].LsaMd.LSSequenceNum != InitialSequenceNumber {
+		t.Error("Router LSA originated within MinLSInterval")
+	}
+	key := lsaThrottleKey{
+		AreaId: stubTestAreaId,
+		LSType: RouterLSA,
+	}
+	ent := ospf.lsaThrottleMap[key]
+	if !ent.pending {
+		t.Error("Router LSA origination not pending")
+	}
+	ospf.processLsaThrottleTick()
+	if ospf.AreaLsdb[lsdbKey].RouterLsaMap[lsaKey].LsaMd.LSSequenceNum != InitialSequenceNumber {
+		t.Error("Router LSA originated before throttle expiry")
+	}
+
+	ent.due = time.Now().Add(-time.Second)
+	ospf.lsaThrottleMap[key] = ent
+	ospf.processLsaThrottleTick()
+	if ospf.AreaLsdb[lsdbKey].RouterLsaMap[lsaKey].LsaMd.LSSequenceNum != InitialSequenceNumber+1 {
+		t.Error("Throttled router LSA not originated")
+	}
+	if ospf.lsaThrottleMap[key].pending {
+		t.Error("Router LSA origination still pending")
+	}
+}
+
+func TestMinLSArrival(t *testing.T) {
+	initStubRouterTestParams()
+	lsaKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      stubTestNbrRtrId,
+		AdvRouter: stubTestNbrRtrId,
+	}
+	if !ospf.lsaArrivalCheck(stubTestAreaId, lsaKey) {
+		t.Error("First LSA instance discarded")
+	}
+	if ospf.lsaArrivalCheck(stubTestAreaId, lsaKey) {
+		t.Error("LSA accepted within MinLSArrival")
+	}
+	if !ospf.lsaArrivalCheck(stubTestAreaId+1, lsaKey) {
+		t.Error("LSA in other area discarded")
+	}
+	arrivalKey := lsaArrivalKey{
+		AreaId: stubTestAreaId,
+		LsaKey: lsaKey,
+	}
+	ospf.lsaArrivalMap[arrivalKey] = time.Now().Add(-MinLSArrival)
+	if !ospf.lsaArrivalCheck(stubTestAreaId, lsaKey) {
+		t.Error("LSA discarded after MinLSArrival")
+	}
+
+	/* old entries are removed on the LSDB tick */
+	ospf.lsaArrivalMap[arrivalKey] = time.Now().Add(-MinLSArrival)
+	ospf.processLsaThrottleTick()
+	if _, exist := ospf.lsaArrivalMap[arrivalKey]; exist {
+		t.Error("Old LSA arrival entry not removed")
+	}
+	otherKey := lsaArrivalKey{
+		AreaId: stubTestAreaId + 1,
+		LsaKey: lsaKey,
+	}
+	if _, exist := ospf.lsaArrivalMap[otherKey]; !exist {
+		t.Error("Recent LSA arrival entry removed")
+	}
+}
@@ -0,0 +1,697 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"l3/ospf/config"
+	"net"
+	"ospfd"
+	"sort"
+)
+
+/*
+Virtual links leave the router as unicast IP packets and may
+cross several routers of the transit area.
+*/
+const OSPF_VIRTUAL_LINK_TTL = 64
+
+type VirtualLinkKey struct {
+	TransitAreaId uint32
+	NbrRtrId      uint32
+}
+
+/*
+Virtual link state derived from the transit area's SPF.
+Reachable is set when the other endpoint is an intra-area
+destination of the transit area.
+*/
+type VirtualLinkEnt struct {
+	IntfKey        IntfConfKey
+	TransitIntfKey IntfConfKey
+	Reachable      bool
+	Cost           uint16
+	LocalIpAddr    uint32
+	NbrIpAddr      uint32
+	NextHopIpAddr  uint32
+}
+
+/*
+Virtual link state computed by the SPF of the transit area. The
+events are queued in order and applied by the server main loop,
+which owns VirtualLinkMap.
+*/
+type VirtualLinkEvent struct {
+	vlKey VirtualLinkKey
+	state VirtualLinkEnt
+}
+
+/* The result of the configuration is returned on RetCh */
+type VirtIfConfigMsg struct {
+	Conf  config.VirtIfConf
+	RetCh chan error
+}
+
+func ConvertOspfVirtIfEntry(conf *ospfd.OspfVirtIfEntry) config.VirtIfConf {
+	virtIfConf := config.VirtIfConf{
+		VirtIfAreaId:          config.AreaId(conf.VirtIfAreaId),
+		VirtIfNeighbor:        config.RouterId(conf.VirtIfNeighbor),
+		VirtIfTransitDelay:    config.UpToMaxAge(conf.VirtIfTransitDelay),
+		VirtIfRetransInterval: config.UpToMaxAge(conf.VirtIfRetransInterval),
+		VirtIfHelloInterval:   config.HelloRange(conf.VirtIfHelloInterval),
+		VirtIfRtrDeadInterval: config.PositiveInteger(conf.VirtIfRtrDeadInterval),
+		VirtIfAuthKey:         conf.VirtIfAuthKey,
+		VirtIfAuthType:        config.AuthType(conf.VirtIfAuthType),
+		VirtIfAuthKeyChain:    conf.VirtIfAuthKeyChain,
+	}
+	for _, md5Key := range conf.VirtIfAuthMd5Keys {
+		virtIfConf.VirtIfAuthMd5Keys = append(virtIfConf.VirtIfAuthMd5Keys, config.AuthMd5Key{
+			KeyId: uint8(md5Key.KeyId),
+			Key:   md5Key.Key,
+		})
+	}
+	return virtIfConf
+}
+
+func getOspfPktTTL(ifType config.IfType) uint8 {
+	if ifType == config.VirtualLink {
+		return uint8(OSPF_VIRTUAL_LINK_TTL)
+	}
+	return uint8(1)
+}
+
+func getVirtualLinkKey(virtIfConf config.VirtIfConf) VirtualLinkKey {
+	return VirtualLinkKey{
+		TransitAreaId: convertAreaOrRouterIdUint32(string(virtIfConf.VirtIfAreaId)),
+		NbrRtrId:      convertAreaOrRouterIdUint32(string(virtIfConf.VirtIfNeighbor)),
+	}
+}
+
+/*
+@fn validateVirtIfConf
+RFC 2328 15: virtual links are configured through a non backbone
+area that is neither stub nor NSSA, and belong to the backbone.
+*/
+func (server *OSPFServer) validateVirtIfConf(virtIfConf config.VirtIfConf) error {
+	if convertAreaOrRouterId(string(virtIfConf.VirtIfAreaId)) == nil ||
+		convertAreaOrRouterId(string(virtIfConf.VirtIfNeighbor)) == nil {
+		return errors.New("Invalid transit area or neighbor router id")
+	}
+	vlKey := getVirtualLinkKey(virtIfConf)
+	if vlKey.TransitAreaId == 0 {
+		return errors.New("Backbone cannot be a transit area")
+	}
+	if vlKey.NbrRtrId == 0 ||
+		vlKey.NbrRtrId == convertIPv4ToUint32(server.ospfGlobalConf.RouterId) {
+		return errors.New("Invalid virtual neighbor router id")
+	}
+	backboneKey := AreaConfKey{
+		AreaId: config.AreaId("0.0.0.0"),
+	}
+	if _, exist := server.AreaConfMap[backboneKey]; !exist {
+		return errors.New("Backbone area is not configured")
+	}
+	transitKey := AreaConfKey{
+		AreaId: virtIfConf.VirtIfAreaId,
+	}
+	if _, exist := server.AreaConfMap[transitKey]; !exist {
+		return errors.New("Transit area is not configured")
+	}
+	if server.isStubArea(virtIfConf.VirtIfAreaId) ||
+		server.isNssaArea(virtIfConf.VirtIfAreaId) {
+		return errors.New("Transit area cannot be stub or NSSA")
+	}
+	ifConf := config.InterfaceConf{
+		IfAuthKey:      virtIfConf.VirtIfAuthKey,
+		IfAuthType:     virtIfConf.VirtIfAuthType,
+		IfAuthMd5Keys:  virtIfConf.VirtIfAuthMd5Keys,
+		IfAuthKeyChain: virtIfConf.VirtIfAuthKeyChain,
+	}
+	return validateIntfAuthConf(ifConf)
+}
+
+/*
+Virtual interfaces have no L3 interface of their own. They are
+keyed by 0.0.0.0 and a negative index so they never collide with
+numbered or unnumbered interfaces.
+*/
+func (server *OSPFServer) allocVirtualLinkIntfKey() IntfConfKey {
+	key := IntfConfKey{
+		IPAddr:  config.IpAddress("0.0.0.0"),
+		IntfIdx: config.InterfaceIndexOrZero(-1),
+	}
+	for {
+		if _, exist := server.IntfConfMap[key]; !exist {
+			return key
+		}
+		key.IntfIdx--
+	}
+}
+
+/*
+@fn SendVirtIfConfig
+Hands the configuration over to the server main loop and waits for
+the result.
+*/
+func (server *OSPFServer) SendVirtIfConfig(virtIfConf config.VirtIfConf) error {
+	retCh := make(chan error)
+	server.VirtIfConfigCh <- VirtIfConfigMsg{
+		Conf:  virtIfConf,
+		RetCh: retCh,
+	}
+	return <-retCh
+}
+
+func (server *OSPFServer) processVirtIfConfig(virtIfConf config.VirtIfConf) error {
+	err := server.validateVirtIfConf(virtIfConf)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("VLINK: Invalid virtual interface configuration",
+			virtIfConf.VirtIfAreaId, virtIfConf.VirtIfNeighbor, err))
+		return err
+	}
+	authKey := make([]byte, OSPF_AUTH_KEY_LEN)
+	if virtIfConf.VirtIfAuthType == config.SimplePassword {
+		authKey = convertSimpleAuthKey(virtIfConf.VirtIfAuthKey)
+	}
+	cryptoKeys, _ := convertCryptoAuthKeys(virtIfConf.VirtIfAuthMd5Keys)
+
+	vlKey := getVirtualLinkKey(virtIfConf)
+	vl, exist := server.VirtualLinkMap[vlKey]
+	if !exist {
+		vl.IntfKey = server.allocVirtualLinkIntfKey()
+	}
+	ent, intfExist := server.IntfConfMap[vl.IntfKey]
+	if intfExist && ent.IfFSMState > config.Down {
+		server.StopSendRecvPkts(vl.IntfKey)
+	}
+	if !intfExist {
+		server.updateIntfToAreaMap(vl.IntfKey, "none", "0.0.0.0")
+		ent.IfAreaId = convertAreaOrRouterId("0.0.0.0")
+		ent.IfType = config.VirtualLink
+		ent.IfVirtLinkKey = vlKey
+		ent.IfAdminStat = config.Enabled
+		ent.IfRtrPriority = 0
+		ent.IfPollInterval = config.PositiveInteger(120)
+		ent.IfMulticastForwarding = config.Blocked
+		ent.IfDemand = false
+		ent.IfAuthState = newIntfAuthState()
+		ent.FSMCtrlCh = make(chan bool)
+		ent.FSMCtrlStatusCh = make(chan bool)
+		ent.BackupSeenCh = make(chan BackupSeenMsg)
+		ent.NeighCreateCh = make(chan NeighCreateMsg)
+		ent.NeighChangeCh = make(chan NeighChangeMsg)
+		ent.NbrStateChangeCh = make(chan NbrStateChangeMsg)
+		ent.NbrFullStateCh = make(chan NbrFullStateMsg)
+		ent.NeighborMap = make(map[NeighborConfKey]NeighborData)
+		ent.IfName = fmt.Sprintf("vlink-%s-%s", virtIfConf.VirtIfAreaId, virtIfConf.VirtIfNeighbor)
+		ent.IfNetmask = []byte{0, 0, 0, 0}
+		ent.IfIpAddr = net.IPv4zero
+		ent.IfDRIp = []byte{0, 0, 0, 0}
+		ent.IfBDRIp = []byte{0, 0, 0, 0}
+		ent.IfMetricTOSMap = make(map[uint8]uint32)
+		ent.IfFSMState = config.Down
+	}
+	ent.IfTransitDelay = virtIfConf.VirtIfTransitDelay
+	ent.IfRetransInterval = virtIfConf.VirtIfRetransInterval
+	ent.IfHelloInterval = uint16(virtIfConf.VirtIfHelloInterval)
+	ent.IfRtrDeadInterval = uint32(virtIfConf.VirtIfRtrDeadInterval)
+	ent.IfAuthKey = authKey
+	ent.IfAuthType = uint16(virtIfConf.VirtIfAuthType)
+	ent.IfAuthCryptoKeys = cryptoKeys
+	ent.IfAuthKeyChain = nil
+	if virtIfConf.VirtIfAuthKeyChain != "" {
+		ent.IfAuthKeyChain = server.getKeyChain(virtIfConf.VirtIfAuthKeyChain)
+	}
+	server.IntfConfMap[vl.IntfKey] = ent
+	server.virtualLinkMutex.Lock()
+	server.VirtualLinkMap[vlKey] = vl
+	server.virtualLinkMutex.Unlock()
+	server.logger.Info(fmt.Sprintln("VLINK: Virtual interface configured", ent.IfName, vl.IntfKey))
+
+	if vl.Reachable && server.ospfGlobalConf.AdminStat == config.Enabled {
+		server.startVirtualLink(vlKey)
+	}
+	return nil
+}
+
+func (server *OSPFServer) processVirtIfDelete(virtIfConf config.VirtIfConf) {
+	vlKey := getVirtualLinkKey(virtIfConf)
+	vl, exist := server.VirtualLinkMap[vlKey]
+	if !exist {
+		server.logger.Err(fmt.Sprintln("VLINK: No such virtual interface", virtIfConf.VirtIfAreaId,
+			virtIfConf.VirtIfNeighbor))
+		return
+	}
+	ent, _ := server.IntfConfMap[vl.IntfKey]
+	wasUp := ent.IfFSMState > config.Down
+	if wasUp {
+		server.StopSendRecvPkts(vl.IntfKey)
+	}
+	server.updateIntfToAreaMap(vl.IntfKey, "0.0.0.0", "none")
+	delete(server.IntfTxMap, vl.IntfKey)
+	delete(server.IntfConfMap, vl.IntfKey)
+	server.virtualLinkMutex.Lock()
+	delete(server.VirtualLinkMap, vlKey)
+	server.virtualLinkMutex.Unlock()
+	if wasUp {
+		server.sendVirtualLinkDownMsg(vlKey, vl.IntfKey)
+	}
+}
+
+/*
+Virtual interfaces send through the pcap handle of the transit
+interface towards the next hop and receive through it as well.
+*/
+func (server *OSPFServer) startVirtualLink(vlKey VirtualLinkKey) {
+	vl := server.VirtualLinkMap[vlKey]
+	ent, exist := server.IntfConfMap[vl.IntfKey]
+	if !exist || ent.IfAdminStat != config.Enabled {
+		return
+	}
+	transitEnt, exist := server.IntfConfMap[vl.TransitIntfKey]
+	if !exist {
+		return
+	}
+	txEntry, exist := server.IntfTxMap[vl.TransitIntfKey]
+	if !exist {
+		server.logger.Err(fmt.Sprintln("VLINK: No tx handle on transit interface", vl.TransitIntfKey))
+		return
+	}
+	server.IntfTxMap[vl.IntfKey] = txEntry
+	ent.IfIpAddr = transitEnt.IfIpAddr
+	ent.IfMacAddr = transitEnt.IfMacAddr
+	ent.IfMtu = transitEnt.IfMtu
+	ent.IfCost = uint32(vl.Cost)
+	server.IntfConfMap[vl.IntfKey] = ent
+	server.logger.Info(fmt.Sprintln("VLINK: Virtual link up", ent.IfName, "via", transitEnt.IfIpAddr))
+	server.StartSendRecvPkts(vl.IntfKey)
+}
+
+func (server *OSPFServer) stopVirtualLink(vlKey VirtualLinkKey) {
+	vl := server.VirtualLinkMap[vlKey]
+	ent, exist := server.IntfConfMap[vl.IntfKey]
+	if !exist || ent.IfFSMState <= config.Down {
+		return
+	}
+	server.logger.Info(fmt.Sprintln("VLINK: Virtual link down", ent.IfName))
+	server.StopSendRecvPkts(vl.IntfKey)
+	delete(server.IntfTxMap, vl.IntfKey)
+	server.sendVirtualLinkDownMsg(vlKey, vl.IntfKey)
+}
+
+/*
+Once a virtual link goes down both the backbone router-LSA and the
+transit area router-LSA (V bit) have to be reoriginated.
+*/
+func (server *OSPFServer) sendVirtualLinkDownMsg(vlKey VirtualLinkKey, intfKey IntfConfKey) {
+	for _, areaId := range []uint32{0, vlKey.TransitAreaId} {
+		msg := NetworkLSAChangeMsg{
+			areaId:  areaId,
+			intfKey: intfKey,
+		}
+		server.IntfStateChangeCh <- msg
+	}
+}
+
+/*
+@fn postVirtualLinkEvent
+Called from the SPF goroutine. The event is queued and the main
+loop is woken up without blocking, so the SPF never waits for the
+main loop and the events keep the order of the SPF runs.
+*/
+func (server *OSPFServer) postVirtualLinkEvent(vlKey VirtualLinkKey, state VirtualLinkEnt) {
+	server.virtualLinkEventMutex.Lock()
+	server.virtualLinkEvents = append(server.virtualLinkEvents, VirtualLinkEvent{
+		vlKey: vlKey,
+		state: state,
+	})
+	server.virtualLinkEventMutex.Unlock()
+	select {
+	case server.VirtualLinkEventCh <- true:
+	default:
+	}
+}
+
+func (server *OSPFServer) processVirtualLinkEvents() {
+	server.virtualLinkEventMutex.Lock()
+	events := server.virtualLinkEvents
+	server.virtualLinkEvents = nil
+	server.virtualLinkEventMutex.Unlock()
+	for _, event := range events {
+		server.processVirtualLinkEvent(event)
+	}
+}
+
+/*
+@fn processVirtualLinkEvent
+SPF of the transit area computed the virtual link. If it changed
+bring the virtual interface up or down, or reoriginate the
+backbone router-LSA when only the cost changed.
+*/
+func (server *OSPFServer) processVirtualLinkEvent(event VirtualLinkEvent) {
+	vlKey := event.vlKey
+	oldVl, exist := server.VirtualLinkMap[vlKey]
+	if !exist {
+		return
+	}
+	vl := event.state
+	vl.IntfKey = oldVl.IntfKey
+	if vl == oldVl {
+		return
+	}
+	server.logger.Info(fmt.Sprintln("VLINK: Virtual link to", convertUint32ToIPv4(vlKey.NbrRtrId),
+		"through area", convertUint32ToIPv4(vlKey.TransitAreaId), "reachable", vl.Reachable, "cost", vl.Cost))
+	server.virtualLinkMutex.Lock()
+	server.VirtualLinkMap[vlKey] = vl
+	server.virtualLinkMutex.Unlock()
+	ent, exist := server.IntfConfMap[vl.IntfKey]
+	if !exist {
+		return
+	}
+	isUp := ent.IfFSMState > config.Down
+	if !vl.Reachable {
+		server.stopVirtualLink(vlKey)
+		return
+	}
+	if server.ospfGlobalConf.AdminStat != config.Enabled {
+		return
+	}
+	localIp := convertUint32ToIPv4(vl.LocalIpAddr)
+	if isUp && ent.IfIpAddr.String() == localIp {
+		if ent.IfCost != uint32(vl.Cost) {
+			ent.IfCost = uint32(vl.Cost)
+			server.IntfConfMap[vl.IntfKey] = ent
+			msg := NetworkLSAChangeMsg{
+				areaId:  0,
+				intfKey: vl.IntfKey,
+			}
+			server.IntfStateChangeCh <- msg
+		}
+		return
+	}
+	server.stopVirtualLink(vlKey)
+	server.startVirtualLink(vlKey)
+}
+
+/*
+@fn findVirtualNbrIpAddr
+RFC 2328 16.1: the virtual neighbor's IP address is the address
+of the neighbor's interface into the transit area. Use the link
+of its router-LSA that points back to its parent in the SPF tree.
+*/
+func (server *OSPFServer) findVirtualNbrIpAddr(areaId uint32, vKey VertexKey, tVertex TreeVertex) (uint32, error) {
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, exist := server.AreaLsdb[lsdbKey]
+	if !exist {
+		return 0, errors.New("No LS Database found")
+	}
+	lsaKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      vKey.ID,
+		AdvRouter: vKey.AdvRtr,
+	}
+	lsaEnt, exist := lsDbEnt.RouterLsaMap[lsaKey]
+	if !exist {
+		return 0, errors.New("Unable to find the Router Lsa of virtual neighbor")
+	}
+	if tVertex.NumOfPaths == 0 || len(tVertex.Paths[0]) == 0 {
+		return 0, errors.New("Virtual neighbor is not reachable")
+	}
+	parent := tVertex.Paths[0][len(tVertex.Paths[0])-1]
+	for _, link := range lsaEnt.LinkDetails {
+		if link.LinkId != parent.ID {
+			continue
+		}
+		if (parent.Type == TNetworkVertex && link.LinkType == TransitLink) ||
+			(parent.Type == RouterVertex && link.LinkType == P2PLink) {
+			return link.LinkData, nil
+		}
+	}
+	return 0, errors.New("Unable to find the link of virtual neighbor towards its parent")
+}
+
+func (server *OSPFServer) getVirtualLinkRoute(areaId uint32, rtrId uint32) (RoutingTblEntry, bool) {
+	areaIdKey := AreaIdKey{
+		AreaId: areaId,
+	}
+	tempAreaRoutingTbl := server.TempAreaRoutingTbl[areaIdKey]
+	for _, destType := range []DestType{AreaBdrRouter, ASAreaBdrRouter} {
+		rKey := RoutingTblEntryKey{
+			DestType: destType,
+			AddrMask: 0,
+			DestId:   rtrId,
+		}
+		rEnt, exist := tempAreaRoutingTbl.RoutingTblMap[rKey]
+		if exist && len(rEnt.NextHops) > 0 {
+			return rEnt, true
+		}
+	}
+	return RoutingTblEntry{}, false
+}
+
+func (server *OSPFServer) findTransitIntfKey(areaId uint32, ipAddr uint32) (IntfConfKey, bool) {
+	for key, ent := range server.IntfConfMap {
+		if ent.IfType == config.VirtualLink || ent.IfAreaId == nil || ent.IfIpAddr == nil {
+			continue
+		}
+		if convertIPv4ToUint32(ent.IfAreaId) == areaId &&
+			convertAreaOrRouterIdUint32(ent.IfIpAddr.String()) == ipAddr {
+			return key, true
+		}
+	}
+	return IntfConfKey{}, false
+}
+
+type nextHopSlice []NextHop
+
+func (n nextHopSlice) Len() int      { return len(n) }
+func (n nextHopSlice) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n nextHopSlice) Less(i, j int) bool {
+	if n[i].IfIPAddr == n[j].IfIPAddr {
+		return n[i].NextHopIP < n[j].NextHopIP
+	}
+	return n[i].IfIPAddr < n[j].IfIPAddr
+}
+
+/*
+@fn updateVirtualLinks
+Called on the SPF goroutine while the SPF tree of the transit area
+is available. RFC 2328 16.1: a virtual link is up when the other
+endpoint is reachable through the transit area, its cost is the
+intra-area distance and its interface address is the one of the
+outgoing interface towards the endpoint. The state of every
+virtual link through the area is posted to the main loop, which
+ignores the unchanged ones.
+*/
+func (server *OSPFServer) updateVirtualLinks(areaId uint32) {
+	var vlKeys []VirtualLinkKey
+	server.virtualLinkMutex.RLock()
+	for vlKey, _ := range server.VirtualLinkMap {
+		if vlKey.TransitAreaId == areaId {
+			vlKeys = append(vlKeys, vlKey)
+		}
+	}
+	server.virtualLinkMutex.RUnlock()
+	for _, vlKey := range vlKeys {
+		newVl := VirtualLinkEnt{}
+		vKey := VertexKey{
+			Type:   RouterVertex,
+			ID:     vlKey.NbrRtrId,
+			AdvRtr: vlKey.NbrRtrId,
+		}
+		tVertex, exist := server.SPFTree[vKey]
+		rEnt, found := server.getVirtualLinkRoute(areaId, vlKey.NbrRtrId)
+		if exist && found {
+			var nextHops nextHopSlice
+			for nextHop, _ := range rEnt.NextHops {
+				nextHops = append(nextHops, nextHop)
+			}
+			sort.Sort(nextHops)
+			transitKey, ok := server.findTransitIntfKey(areaId, nextHops[0].IfIPAddr)
+			nbrIpAddr, err := server.findVirtualNbrIpAddr(areaId, vKey, tVertex)
+			if ok && err == nil {
+				newVl.TransitIntfKey = transitKey
+				newVl.Reachable = true
+				newVl.Cost = rEnt.Cost
+				newVl.LocalIpAddr = nextHops[0].IfIPAddr
+				newVl.NbrIpAddr = nbrIpAddr
+				newVl.NextHopIpAddr = nextHops[0].NextHopIP
+			}
+		}
+		server.postVirtualLinkEvent(vlKey, newVl)
+	}
+}
+
+/*
+RFC 2328 16.3: next hops of destinations reached over a virtual
+link are the next hops towards the virtual neighbor in the transit
+area.
+*/
+func (server *OSPFServer) getVirtualLinkNextHop(nbrRtrId uint32) (ifIPAddr uint32, nextHopIP uint32, err error) {
+	server.virtualLinkMutex.RLock()
+	defer server.virtualLinkMutex.RUnlock()
+	for vlKey, vl := range server.VirtualLinkMap {
+		if vlKey.NbrRtrId == nbrRtrId && vl.Reachable {
+			return vl.LocalIpAddr, vl.NextHopIpAddr, nil
+		}
+	}
+	err = errors.New("Virtual neighbor is not reachable through any transit area")
+	return 0, 0, err
+}
+
+/*
+@fn updateTransitCapability
+RFC 2328 16.1: an area is a transit area when one of the routers
+reachable through it has set the V bit in its router-LSA.
+*/
+func (server *OSPFServer) updateTransitCapability(key AreaConfKey, areaId uint32) {
+	aEnt, exist := server.AreaConfMap[key]
+	if !exist {
+		return
+	}
+	lsdbKey := LsdbKey{
+		AreaId: areaId,
+	}
+	lsDbEnt, _ := server.AreaLsdb[lsdbKey]
+	transitCapability := false
+	for vKey, _ := range server.SPFTree {
+		if vKey.Type != RouterVertex {
+			continue
+		}
+		lsaKey := LsaKey{
+			LSType:    RouterLSA,
+			LSId:      vKey.ID,
+			AdvRouter: vKey.AdvRtr,
+		}
+		lsaEnt, exist := lsDbEnt.RouterLsaMap[lsaKey]
+		if exist && lsaEnt.BitV {
+			transitCapability = true
+			break
+		}
+	}
+	if aEnt.TransitCapability != transitCapability {
+		server.logger.Info(fmt.Sprintln("SPF: Area", key.AreaId, "transit capability", transitCapability))
+		aEnt.TransitCapability = transitCapability
+		server.AreaConfMap[key] = aEnt
+	}
+}
+
+/*
+The V bit of the transit area router-LSA is set while at least
+one virtual link through the area is fully adjacent.
+*/
+func (server *OSPFServer) isVirtualLinkEndpoint(areaId uint32) bool {
+	server.virtualLinkMutex.RLock()
+	defer server.virtualLinkMutex.RUnlock()
+	for vlKey, vl := range server.VirtualLinkMap {
+		if vlKey.TransitAreaId != areaId {
+			continue
+		}
+		if _, full := server.getVirtualLinkFullNbr(vl.IntfKey); full {
+			return true
+		}
+	}
+	return false
+}
+
+func (server *OSPFServer) getVirtualLinkFullNbr(intfKey IntfConfKey) (OspfNeighborEntry, bool) {
+	ent, exist := server.IntfConfMap[intfKey]
+	if !exist || ent.IfFSMState <= config.Down {
+		return OspfNeighborEntry{}, false
+	}
+	nbrData, exist := ospfIntfToNbrMap[intfKey]
+	if !exist {
+		return OspfNeighborEntry{}, false
+	}
+	for _, nbrKey := range nbrData.nbrList {
+		nbr, exist := server.NeighborConfigMap[nbrKey]
+		if exist && nbr.OspfNbrState == config.NbrFull {
+			return nbr, true
+		}
+	}
+	return OspfNeighborEntry{}, false
+}
+
+/*
+@fn getVirtualLinkDst
+Packets over a virtual link are unicast to the virtual neighbor
+through the next hop of the transit area.
+*/
+func (server *OSPFServer) getVirtualLinkDst(ent IntfConf) (net.HardwareAddr, net.IP) {
+	vl, _ := server.getVirtualLink(ent.IfVirtLinkKey)
+	dstIp := net.ParseIP(convertUint32ToIPv4(vl.NbrIpAddr))
+	nextHopKey := NeighborConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(vl.NextHopIpAddr)),
+		IntfIdx: vl.TransitIntfKey.IntfIdx,
+	}
+	dstMac, exist := ospfNeighborIPToMAC[nextHopKey]
+	if !exist {
+		nbrKey := NeighborConfKey{
+			IPAddr:  config.IpAddress(convertUint32ToIPv4(vl.NbrIpAddr)),
+			IntfIdx: vl.TransitIntfKey.IntfIdx,
+		}
+		dstMac, _ = ospfNeighborIPToMAC[nbrKey]
+	}
+	return dstMac, dstIp
+}
+
+/*
+@fn getVirtualLinkRxIntfKey
+RFC 2328 8.2: a backbone packet received on a non backbone
+interface belongs to the virtual link whose transit area is the
+area of the receiving interface and whose other endpoint is the
+sender. Other packets stay on the receiving interface.
+*/
+func (server *OSPFServer) getVirtualLinkRxIntfKey(key IntfConfKey, ent IntfConf, ospfPkt []byte) IntfConfKey {
+	if len(ospfPkt) < OSPF_HEADER_SIZE || ent.IfAreaId == nil ||
+		ent.IfType == config.VirtualLink {
+		return key
+	}
+	ospfHdr := NewOSPFHeader()
+	decodeOspfHdr(ospfPkt, ospfHdr)
+	if !bytesEqual(ospfHdr.areaId, []byte{0, 0, 0, 0}) ||
+		bytesEqual(ent.IfAreaId, ospfHdr.areaId) {
+		return key
+	}
+	vlKey := VirtualLinkKey{
+		TransitAreaId: convertIPv4ToUint32(ent.IfAreaId),
+		NbrRtrId:      convertIPv4ToUint32(ospfHdr.routerId),
+	}
+	vl, exist := server.getVirtualLink(vlKey)
+	if !exist || !vl.Reachable {
+		return key
+	}
+	return vl.IntfKey
+}
+
+/* VirtualLinkMap is read under the lock outside of the main loop */
+func (server *OSPFServer) getVirtualLink(vlKey VirtualLinkKey) (VirtualLinkEnt, bool) {
+	server.virtualLinkMutex.RLock()
+	defer server.virtualLinkMutex.RUnlock()
+	vl, exist := server.VirtualLinkMap[vlKey]
+	return vl, exist
+}
@@ -0,0 +1,345 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"l3/ospf/config"
+	"net"
+	"testing"
+)
+
+const (
+	vlinkTestAreaId    = uint32(1)
+	vlinkTestNbrRtrId  = uint32(0x0a010103)
+	vlinkTestNetworkId = uint32(0x14010102)
+	vlinkTestLocalIp   = uint32(0x14010101)
+	vlinkTestNbrIp     = uint32(0x14010103)
+)
+
+func initVirtualLinkTestParams() config.VirtIfConf {
+	ospf = getServerObject()
+	ospf.DbLsdbOp = make(chan DbLsdbMsg)
+	ospf.DbEventOp = make(chan DbEventMsg)
+	ospf.ospfGlobalConf.RouterId = []byte{10, 1, 1, 1}
+	ospf.ospfGlobalConf.AreaBdrRtrStatus = true
+	ospfIntfToNbrMap = make(map[IntfConfKey]ospfNbrMdata)
+	for _, areaId := range []uint32{0, vlinkTestAreaId} {
+		areaKey := AreaConfKey{
+			AreaId: config.AreaId(convertUint32ToIPv4(areaId)),
+		}
+		ospf.AreaConfMap[areaKey] = AreaConf{
+			ImportAsExtern: config.ImportExternal,
+			IntfListMap:    make(map[IntfConfKey]bool),
+		}
+		ospf.initLSDatabase(areaId)
+	}
+	ospf.TempAreaRoutingTbl[AreaIdKey{AreaId: vlinkTestAreaId}] = AreaRoutingTbl{
+		RoutingTblMap: make(map[RoutingTblEntryKey]RoutingTblEntry),
+	}
+	go startDummyChannels(ospf)
+	return config.VirtIfConf{
+		VirtIfAreaId:          config.AreaId(convertUint32ToIPv4(vlinkTestAreaId)),
+		VirtIfNeighbor:        config.RouterId(convertUint32ToIPv4(vlinkTestNbrRtrId)),
+		VirtIfTransitDelay:    config.UpToMaxAge(1),
+		VirtIfRetransInterval: config.UpToMaxAge(5),
+		VirtIfHelloInterval:   config.HelloRange(10),
+		VirtIfRtrDeadInterval: config.PositiveInteger(40),
+		VirtIfAuthType:        config.NoAuth,
+	}
+}
+
+/* Transit area: we and the virtual neighbor share a broadcast network. */
+func addVirtualLinkTestTransitNetwork(bitV bool) IntfConfKey {
+	transitKey := IntfConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(vlinkTestLocalIp)),
+		IntfIdx: 0,
+	}
+	ospf.IntfConfMap[transitKey] = IntfConf{
+		IfAreaId:  convertAreaOrRouterId(convertUint32ToIPv4(vlinkTestAreaId)),
+		IfType:    config.Broadcast,
+		IfIpAddr:  net.ParseIP(convertUint32ToIPv4(vlinkTestLocalIp)),
+		IfNetmask: []byte{255, 255, 255, 0},
+	}
+	lsdbKey := LsdbKey{
+		AreaId: vlinkTestAreaId,
+	}
+	lsaKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      vlinkTestNbrRtrId,
+		AdvRouter: vlinkTestNbrRtrId,
+	}
+	ospf.AreaLsdb[lsdbKey].RouterLsaMap[lsaKey] = RouterLsa{
+		BitB:       true,
+		BitV:       bitV,
+		NumOfLinks: 1,
+		LinkDetails: []LinkDetail{
+			{
+				LinkId:     vlinkTestNetworkId,
+				LinkData:   vlinkTestNbrIp,
+				LinkType:   TransitLink,
+				LinkMetric: 10,
+			},
+		},
+	}
+	rootKey := VertexKey{
+		Type:   RouterVertex,
+		ID:     0x0a010101,
+		AdvRtr: 0x0a010101,
+	}
+	networkKey := VertexKey{
+		Type:   TNetworkVertex,
+		ID:     vlinkTestNetworkId,
+		AdvRtr: vlinkTestNbrRtrId,
+	}
+	nbrKey := VertexKey{
+		Type:   RouterVertex,
+		ID:     vlinkTestNbrRtrId,
+		AdvRtr: vlinkTestNbrRtrId,
+	}
+	ospf.SPFTree = make(map[VertexKey]TreeVertex)
+	ospf.SPFTree[rootKey] = TreeVertex{}
+	ospf.SPFTree[nbrKey] = TreeVertex{
+		Paths:      []Path{{rootKey, networkKey}},
+		Distance:   10,
+		NumOfPaths: 1,
+	}
+	rKey := RoutingTblEntryKey{
+		DestId:   vlinkTestNbrRtrId,
+		AddrMask: 0,
+		DestType: AreaBdrRouter,
+	}
+	nextHop := NextHop{
+		IfIPAddr:  vlinkTestLocalIp,
+		NextHopIP: vlinkTestNbrIp,
+		AdvRtr:    vlinkTestNbrRtrId,
+	}
+	ospf.TempAreaRoutingTbl[AreaIdKey{AreaId: vlinkTestAreaId}].RoutingTblMap[rKey] = RoutingTblEntry{
+		PathType:   IntraArea,
+		Cost:       10,
+		NumOfPaths: 1,
+		NextHops:   map[NextHop]bool{nextHop: true},
+	}
+	return transitKey
+}
+
+func TestOspfVirtualLinkConfig(t *testing.T) {
+	virtIfConf := initVirtualLinkTestParams()
+
+	backboneConf := virtIfConf
+	backboneConf.VirtIfAreaId = "0.0.0.0"
+	if ospf.processVirtIfConfig(backboneConf) == nil {
+		t.Error("Virtual link through the backbone accepted")
+	}
+
+	stubKey := AreaConfKey{
+		AreaId: "0.0.0.2",
+	}
+	ospf.AreaConfMap[stubKey] = AreaConf{
+		ImportAsExtern: config.ImportNoExternal,
+		IntfListMap:    make(map[IntfConfKey]bool),
+	}
+	stubConf := virtIfConf
+	stubConf.VirtIfAreaId = stubKey.AreaId
+	if ospf.processVirtIfConfig(stubConf) == nil {
+		t.Error("Virtual link through a stub area accepted")
+	}
+
+	err := ospf.processVirtIfConfig(virtIfConf)
+	if err != nil {
+		t.Fatal("Virtual link configuration failed", err)
+	}
+	vlKey := getVirtualLinkKey(virtIfConf)
+	vl, exist := ospf.VirtualLinkMap[vlKey]
+	if !exist {
+		t.Fatal("Virtual link not created")
+	}
+	if vl.IntfKey.IPAddr != "0.0.0.0" || vl.IntfKey.IntfIdx >= 0 {
+		t.Error("Unexpected virtual interface key", vl.IntfKey)
+	}
+	ent := ospf.IntfConfMap[vl.IntfKey]
+	if ent.IfType != config.VirtualLink || convertIPv4ToUint32(ent.IfAreaId) != 0 ||
+		ent.IfVirtLinkKey != vlKey || ent.IfFSMState != config.Down {
+		t.Error("Unexpected virtual interface", ent.IfType, ent.IfAreaId, ent.IfFSMState)
+	}
+	if !ospf.AreaConfMap[AreaConfKey{AreaId: "0.0.0.0"}].IntfListMap[vl.IntfKey] {
+		t.Error("Virtual interface not attached to the backbone")
+	}
+
+	otherConf := virtIfConf
+	otherConf.VirtIfNeighbor = "10.1.1.4"
+	ospf.processVirtIfConfig(otherConf)
+	otherVl := ospf.VirtualLinkMap[getVirtualLinkKey(otherConf)]
+	if otherVl.IntfKey == vl.IntfKey {
+		t.Error("Virtual interfaces share the same key", vl.IntfKey)
+	}
+
+	ospf.processVirtIfDelete(virtIfConf)
+	if _, exist := ospf.IntfConfMap[vl.IntfKey]; exist {
+		t.Error("Virtual interface not deleted")
+	}
+	if _, exist := ospf.VirtualLinkMap[vlKey]; exist {
+		t.Error("Virtual link not deleted")
+	}
+}
+
+func TestOspfVirtualLinkTransitSPF(t *testing.T) {
+	virtIfConf := initVirtualLinkTestParams()
+	ospf.processVirtIfConfig(virtIfConf)
+	vlKey := getVirtualLinkKey(virtIfConf)
+
+	ospf.SPFTree = make(map[VertexKey]TreeVertex)
+	ospf.updateVirtualLinks(vlinkTestAreaId)
+	ospf.processVirtualLinkEvents()
+	if ospf.VirtualLinkMap[vlKey].Reachable {
+		t.Error("Virtual link reachable without a route to the neighbor")
+	}
+
+	transitKey := addVirtualLinkTestTransitNetwork(true)
+	ospf.updateVirtualLinks(vlinkTestAreaId)
+	ospf.processVirtualLinkEvents()
+	vl := ospf.VirtualLinkMap[vlKey]
+	if !vl.Reachable || vl.Cost != 10 || vl.TransitIntfKey != transitKey {
+		t.Error("Unexpected virtual link state", vl)
+	}
+	if vl.NbrIpAddr != vlinkTestNbrIp || vl.LocalIpAddr != vlinkTestLocalIp ||
+		vl.NextHopIpAddr != vlinkTestNbrIp {
+		t.Error("Unexpected virtual link addresses", vl)
+	}
+	ifIPAddr, nextHopIP, err := ospf.getVirtualLinkNextHop(vlinkTestNbrRtrId)
+	if err != nil || ifIPAddr != vlinkTestLocalIp || nextHopIP != vlinkTestNbrIp {
+		t.Error("Unexpected next hop over virtual link", ifIPAddr, nextHopIP, err)
+	}
+
+	transitAreaKey := AreaConfKey{
+		AreaId: config.AreaId(convertUint32ToIPv4(vlinkTestAreaId)),
+	}
+	ospf.updateTransitCapability(transitAreaKey, vlinkTestAreaId)
+	if !ospf.AreaConfMap[transitAreaKey].TransitCapability {
+		t.Error("Transit capability not set for reachable router with V bit")
+	}
+	delete(ospf.SPFTree, VertexKey{Type: RouterVertex, ID: vlinkTestNbrRtrId, AdvRtr: vlinkTestNbrRtrId})
+	ospf.updateTransitCapability(transitAreaKey, vlinkTestAreaId)
+	if ospf.AreaConfMap[transitAreaKey].TransitCapability {
+		t.Error("Transit capability set for unreachable router with V bit")
+	}
+}
+
+func TestOspfVirtualLinkEventOrder(t *testing.T) {
+	virtIfConf := initVirtualLinkTestParams()
+	ospf.processVirtIfConfig(virtIfConf)
+	vlKey := getVirtualLinkKey(virtIfConf)
+
+	addVirtualLinkTestTransitNetwork(true)
+	ospf.updateVirtualLinks(vlinkTestAreaId)
+	ospf.SPFTree = make(map[VertexKey]TreeVertex)
+	ospf.updateVirtualLinks(vlinkTestAreaId)
+	if ospf.VirtualLinkMap[vlKey].Reachable {
+		t.Error("Virtual link changed before the main loop processed the events")
+	}
+	ospf.processVirtualLinkEvents()
+	if ospf.VirtualLinkMap[vlKey].Reachable {
+		t.Error("Virtual link reachable after the last SPF lost the neighbor")
+	}
+	if len(ospf.virtualLinkEvents) != 0 {
+		t.Error("Virtual link events not drained", ospf.virtualLinkEvents)
+	}
+}
+
+func TestOspfVirtualLinkDst(t *testing.T) {
+	virtIfConf := initVirtualLinkTestParams()
+	ospf.processVirtIfConfig(virtIfConf)
+	vlKey := getVirtualLinkKey(virtIfConf)
+	transitKey := addVirtualLinkTestTransitNetwork(true)
+	ospf.updateVirtualLinks(vlinkTestAreaId)
+	ospf.processVirtualLinkEvents()
+
+	vl := ospf.VirtualLinkMap[vlKey]
+	vl.NextHopIpAddr = vlinkTestNbrIp + 1
+	ospf.VirtualLinkMap[vlKey] = vl
+	nbrMac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	ospfNeighborIPToMAC = make(map[NeighborConfKey]net.HardwareAddr)
+	ospfNeighborIPToMAC[NeighborConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(vlinkTestNbrIp)),
+		IntfIdx: transitKey.IntfIdx,
+	}] = nbrMac
+
+	dstMac, dstIp := ospf.getVirtualLinkDst(ospf.IntfConfMap[vl.IntfKey])
+	if dstMac.String() != nbrMac.String() {
+		t.Error("Unexpected destination MAC over virtual link", dstMac)
+	}
+	if dstIp.String() != convertUint32ToIPv4(vlinkTestNbrIp) {
+		t.Error("Unexpected destination IP over virtual link", dstIp)
+	}
+}
+
+func TestOspfVirtualLinkRouterLsa(t *testing.T) {
+	virtIfConf := initVirtualLinkTestParams()
+	ospf.processVirtIfConfig(virtIfConf)
+	vlKey := getVirtualLinkKey(virtIfConf)
+	addVirtualLinkTestTransitNetwork(false)
+	ospf.updateVirtualLinks(vlinkTestAreaId)
+	ospf.processVirtualLinkEvents()
+
+	vl := ospf.VirtualLinkMap[vlKey]
+	ent := ospf.IntfConfMap[vl.IntfKey]
+	ent.IfFSMState = config.P2P
+	ent.IfIpAddr = net.ParseIP(convertUint32ToIPv4(vl.LocalIpAddr))
+	ent.IfCost = uint32(vl.Cost)
+	ospf.IntfConfMap[vl.IntfKey] = ent
+	nbrKey := NeighborConfKey{
+		IPAddr:  config.IpAddress(convertUint32ToIPv4(vlinkTestNbrIp)),
+		IntfIdx: vl.IntfKey.IntfIdx,
+	}
+	ospf.NeighborConfigMap[nbrKey] = OspfNeighborEntry{
+		OspfNbrRtrId: vlinkTestNbrRtrId,
+		OspfNbrState: config.NbrFull,
+		intfConfKey:  vl.IntfKey,
+	}
+	ospfIntfToNbrMap[vl.IntfKey] = ospfNbrMdata{
+		intf:    vl.IntfKey,
+		nbrList: []NeighborConfKey{nbrKey},
+	}
+
+	rtrLsaKey := LsaKey{
+		LSType:    RouterLSA,
+		LSId:      0x0a010101,
+		AdvRouter: 0x0a010101,
+	}
+	ospf.generateRouterLSA(0)
+	lsa := ospf.AreaLsdb[LsdbKey{AreaId: 0}].RouterLsaMap[rtrLsaKey]
+	if lsa.NumOfLinks != 1 {
+		t.Fatal("Unexpected number of backbone links", lsa.NumOfLinks)
+	}
+	link := lsa.LinkDetails[0]
+	if link.LinkType != VirtualLink || link.LinkId != vlinkTestNbrRtrId ||
+		link.LinkData != vlinkTestLocalIp || link.LinkMetric != 10 {
+		t.Error("Unexpected virtual link in backbone router-LSA", link)
+	}
+
+	ospf.generateRouterLSA(vlinkTestAreaId)
+	lsa = ospf.AreaLsdb[LsdbKey{AreaId: vlinkTestAreaId}].RouterLsaMap[rtrLsaKey]
+	if !lsa.BitV {
+		t.Error("V bit not set in transit area router-LSA")
+	}
+}
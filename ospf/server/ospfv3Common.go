@@ -0,0 +1,259 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"encoding/binary"
+	"l3/ospf/config"
+	"net"
+	"ospfd"
+	"time"
+)
+
+/*
+OSPFv3 (RFC 5340) runs as a separate instance next to OSPFv2. It
+shares the area configuration, the interface and neighbor state
+definitions and the ribd client with OSPFv2, and keeps its own
+interfaces, neighbors and link state databases keyed by router id
+and interface id since v3 has no addresses in its topology.
+All of its state is owned by the server main loop.
+*/
+const (
+	OSPF_VERSION_3          = 3
+	OSPFV3_HEADER_SIZE      = 16
+	OSPFV3_HELLO_MIN_SIZE   = 20
+	OSPFV3_DBD_MIN_SIZE     = 12
+	OSPFV3_LSA_REQ_SIZE     = 12
+	OSPFV3_LSA_HEADER_SIZE  = 20
+	OSPFV3_LSU_MIN_SIZE     = 4
+	IPV6_HEADER_LEN         = 40
+	OSPFV3_HOP_LIMIT        = 1
+	OSPFV3_MIN_MTU          = 1280
+	OSPFV3_MAX_LSA_HEADERS  = 50
+	OSPFV3_MAX_LSA_REQ      = 50
+	OSPFV3_SPF_HOLD_TIME    = 1
+	OSPFV3_MIN_LS_ARRIVAL   = 1
+	OSPFV3_MIN_LS_INTERVAL  = 5
+	OSPFV3_DEFAULT_INSTANCE = 0
+)
+
+var ALLSPFROUTERV6 net.IP = net.ParseIP("ff02::5")
+var ALLDROUTERV6 net.IP = net.ParseIP("ff02::6")
+var ALLSPFROUTERV6MAC net.HardwareAddr = net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x05}
+var ALLDROUTERV6MAC net.HardwareAddr = net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x06}
+
+/* RFC 5340 A.2 Options field */
+const (
+	Ospfv3V6Option = 0x01
+	Ospfv3EOption  = 0x02
+	Ospfv3NOption  = 0x08
+	Ospfv3ROption  = 0x10
+	Ospfv3DCOption = 0x20
+)
+
+/* RFC 5340 A.4.2.1 LS type: U bit, scope bits and function code */
+const (
+	Ospfv3RouterLSA          uint16 = 0x2001
+	Ospfv3NetworkLSA         uint16 = 0x2002
+	Ospfv3InterAreaPrefixLSA uint16 = 0x2003
+	Ospfv3InterAreaRouterLSA uint16 = 0x2004
+	Ospfv3ASExternalLSA      uint16 = 0x4005
+	Ospfv3LinkLSA            uint16 = 0x0008
+	Ospfv3IntraAreaPrefixLSA uint16 = 0x2009
+)
+
+const (
+	Ospfv3LinkScope     uint8  = 0
+	Ospfv3AreaScope     uint8  = 1
+	Ospfv3ASScope       uint8  = 2
+	Ospfv3ReservedScope uint8  = 3
+	Ospfv3UBit          uint16 = 0x8000
+)
+
+func getOspfv3LsaScope(lsType uint16) uint8 {
+	return uint8((lsType >> 13) & 0x3)
+}
+
+type Ospfv3LsaKey struct {
+	LSType    uint16
+	LSId      uint32
+	AdvRouter uint32
+}
+
+type Ospfv3LsaHeader struct {
+	LSAge         uint16
+	LSType        uint16
+	LSId          uint32
+	AdvRouter     uint32
+	LSSequenceNum uint32
+	LSChecksum    uint16
+	LSLen         uint16
+}
+
+func (hdr Ospfv3LsaHeader) key() Ospfv3LsaKey {
+	return Ospfv3LsaKey{
+		LSType:    hdr.LSType,
+		LSId:      hdr.LSId,
+		AdvRouter: hdr.AdvRouter,
+	}
+}
+
+/*
+LSAs are kept encoded as received or originated. The age is
+derived from the install time instead of being decremented.
+*/
+type Ospfv3LsaEnt struct {
+	Hdr         Ospfv3LsaHeader
+	Data        []byte
+	InstallTime time.Time
+	MaxAgeFlood bool
+}
+
+type Ospfv3Lsdb map[Ospfv3LsaKey]*Ospfv3LsaEnt
+
+type Ospfv3GlobalConf struct {
+	RouterId           uint32
+	AdminStat          config.Status
+	ReferenceBandwidth uint32
+	isABR              bool
+	lsaGenPending      bool
+	spfPending         bool
+	spfHoldTimer       int
+}
+
+type Ospfv3NextHop struct {
+	IfIndex   int32
+	NextHopIp string
+}
+
+type Ospfv3Intf struct {
+	IfIndex           int32
+	IfName            string
+	IfMacAddr         net.HardwareAddr
+	IfMtu             int32
+	IfInstanceId      uint8
+	IfAreaId          uint32
+	IfType            config.IfType
+	IfAdminStat       config.Status
+	IfRtrPriority     uint8
+	IfTransitDelay    uint16
+	IfRetransInterval uint16
+	IfHelloInterval   uint16
+	IfRtrDeadInterval uint16
+	IfCost            uint16
+	IfConfigured      bool
+	IfLinkLocalAddr   net.IP
+	IfPrefixes        map[string]*net.IPNet
+	IfFSMState        config.IfState
+	IfDRtrId          uint32
+	IfBDRtrId         uint32
+	IfEvents          int32
+	HelloTimer        int
+	WaitTimer         int
+	Nbrs              map[uint32]*Ospfv3Nbr
+	LinkLsdb          Ospfv3Lsdb
+	DelayedAcks       []Ospfv3LsaHeader
+	TxHdl             IntfTxHandle
+	RxHdl             IntfRxHandle
+}
+
+type Ospfv3Nbr struct {
+	RtrId        uint32
+	IfId         uint32
+	Addr         net.IP
+	MacAddr      net.HardwareAddr
+	Priority     uint8
+	Options      uint32
+	DRtrId       uint32
+	BDRtrId      uint32
+	State        config.NbrState
+	Events       int32
+	DeadTimer    int
+	IsMaster     bool
+	DDSeqNum     uint32
+	LastRxDD     Ospfv3DDPkt
+	LastTxDD     []byte
+	DDRetxTimer  int
+	SummaryList  []Ospfv3LsaHeader
+	RequestList  map[Ospfv3LsaKey]Ospfv3LsaHeader
+	LastTxLsr    []Ospfv3LsaKey
+	LsrRetxTimer int
+	RetxList     map[Ospfv3LsaKey]uint32
+	LsuRetxTimer int
+}
+
+type ospfv3RxPktMsg struct {
+	ifIndex int32
+	srcIp   net.IP
+	dstIp   net.IP
+	srcMac  net.HardwareAddr
+	data    []byte
+}
+
+func ConvertOspfv3Global(conf *ospfd.Ospfv3Global) config.Ospfv3GlobalConf {
+	return config.Ospfv3GlobalConf{
+		RouterId:           config.RouterId(conf.RouterId),
+		AdminStat:          config.Status(conf.AdminStat),
+		ReferenceBandwidth: uint32(conf.ReferenceBandwidth),
+	}
+}
+
+func ConvertOspfv3IntfEntry(conf *ospfd.Ospfv3IntfEntry) config.Ospfv3IntfConf {
+	return config.Ospfv3IntfConf{
+		IfIndex:           conf.IfIndex,
+		IfInstanceId:      uint8(conf.IfInstanceId),
+		IfAreaId:          config.AreaId(conf.IfAreaId),
+		IfType:            config.IfType(conf.IfType),
+		IfAdminStat:       config.Status(conf.IfAdminStat),
+		IfRtrPriority:     config.DesignatedRouterPriority(conf.IfRtrPriority),
+		IfTransitDelay:    config.UpToMaxAge(conf.IfTransitDelay),
+		IfRetransInterval: config.UpToMaxAge(conf.IfRetransInterval),
+		IfHelloInterval:   config.HelloRange(conf.IfHelloInterval),
+		IfRtrDeadInterval: config.PositiveInteger(conf.IfRtrDeadInterval),
+		IfCost:            config.Metric(conf.IfCost),
+	}
+}
+
+/*
+@fn computeOspfv3Checksum
+RFC 5340 A.3.1: the checksum covers the packet and the IPv6
+pseudo header of RFC 2460 8.1.
+*/
+func computeOspfv3Checksum(srcIp net.IP, dstIp net.IP, pkt []byte) uint16 {
+	buf := make([]byte, IPV6_HEADER_LEN, IPV6_HEADER_LEN+len(pkt)+1)
+	copy(buf[0:16], srcIp.To16())
+	copy(buf[16:32], dstIp.To16())
+	binary.BigEndian.PutUint32(buf[32:36], uint32(len(pkt)))
+	buf[39] = OSPF_PROTO_ID
+	buf = append(buf, pkt...)
+	if len(buf)%2 != 0 {
+		buf = append(buf, 0)
+	}
+	return computeCheckSum(buf)
+}
+
+func ospfv3MulticastMac(ip net.IP) net.HardwareAddr {
+	ip = ip.To16()
+	return net.HardwareAddr{0x33, 0x33, ip[12], ip[13], ip[14], ip[15]}
+}
@@ -0,0 +1,622 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"asicd/asicdCommonDefs"
+	"asicdServices"
+	"errors"
+	"fmt"
+	"github.com/google/gopacket/pcap"
+	"l3/ospf/config"
+	"net"
+	"sync"
+	"time"
+)
+
+func (server *OSPFServer) initOspfv3GlobalConfDefault() {
+	server.ospfv3GlobalConf.RouterId = 0
+	server.ospfv3GlobalConf.AdminStat = config.Disabled
+	server.ospfv3GlobalConf.ReferenceBandwidth = 100000 // Default value 100 Gbps
+}
+
+/*
+@fn UpdateIPv6Infra
+IPv6 interfaces come from asicd. The link local address is used
+as source of all packets, the other addresses are advertised as
+prefixes of the link.
+*/
+func (server *OSPFServer) UpdateIPv6Infra(msg asicdCommonDefs.IPv6IntfNotifyMsg, msgType uint8) {
+	ip, ipNet, err := net.ParseCIDR(msg.IpAddr)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("OSPFV3: Unable to parse IPv6 address", msg.IpAddr))
+		return
+	}
+	if msgType == asicdCommonDefs.NOTIFY_IPV6INTF_CREATE {
+		server.logger.Info(fmt.Sprintln("OSPFV3: Receive IPV6INTF_CREATE", msg.IpAddr, msg.IfIndex))
+		intf := server.createOspfv3Intf(msg.IfIndex)
+		if intf == nil {
+			return
+		}
+		if ip.IsLinkLocalUnicast() {
+			intf.IfLinkLocalAddr = ip
+		} else {
+			intf.IfPrefixes[msg.IpAddr] = ipNet
+		}
+	} else {
+		server.logger.Info(fmt.Sprintln("OSPFV3: Receive IPV6INTF_DELETE", msg.IpAddr, msg.IfIndex))
+		intf, exist := server.Ospfv3IntfMap[msg.IfIndex]
+		if !exist {
+			return
+		}
+		if ip.IsLinkLocalUnicast() {
+			if intf.IfLinkLocalAddr.Equal(ip) {
+				server.stopOspfv3Intf(intf)
+				intf.IfLinkLocalAddr = nil
+			}
+		} else {
+			delete(intf.IfPrefixes, msg.IpAddr)
+		}
+		if intf.IfLinkLocalAddr == nil && len(intf.IfPrefixes) == 0 && !intf.IfConfigured {
+			delete(server.Ospfv3IntfMap, msg.IfIndex)
+			return
+		}
+	}
+	server.ospfv3GlobalConf.lsaGenPending = true
+	server.startOspfv3IntfIfReady(msg.IfIndex)
+}
+
+func (server *OSPFServer) constructL3v6Infra() {
+	curMark := 0
+	server.logger.Info("Calling Asicd for getting L3 IPv6 Interfaces")
+	count := 100
+	for {
+		if server.asicdClient.ClientHdl == nil {
+			server.logger.Err("Infra: Null asicd client handle")
+			return
+		}
+		bulkInfo, _ := server.asicdClient.ClientHdl.GetBulkIPv6IntfState(asicdServices.Int(curMark), asicdServices.Int(count))
+		if bulkInfo == nil {
+			break
+		}
+		objCnt := int(bulkInfo.Count)
+		more := bool(bulkInfo.More)
+		curMark = int(bulkInfo.EndIdx)
+		for i := 0; i < objCnt; i++ {
+			msg := asicdCommonDefs.IPv6IntfNotifyMsg{
+				IpAddr:  bulkInfo.IPv6IntfStateList[i].IpAddr,
+				IfIndex: bulkInfo.IPv6IntfStateList[i].IfIndex,
+			}
+			server.UpdateIPv6Infra(msg, asicdCommonDefs.NOTIFY_IPV6INTF_CREATE)
+		}
+		if more == false {
+			break
+		}
+	}
+}
+
+func (server *OSPFServer) createOspfv3Intf(ifIndex int32) *Ospfv3Intf {
+	intf, exist := server.Ospfv3IntfMap[ifIndex]
+	if exist {
+		return intf
+	}
+	ifType := uint8(asicdCommonDefs.GetIntfTypeFromIfIndex(ifIndex))
+	ifId := uint16(asicdCommonDefs.GetIntfIdFromIfIndex(ifIndex))
+	ifName, err := server.getLinuxIntfName(ifId, ifType)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("OSPFV3: No Such Interface exists", ifIndex))
+		return nil
+	}
+	ifCost, _ := server.getIntfCost(ifId, ifType)
+	if ifCost > 0xffff {
+		ifCost = 0xffff
+	}
+	macAddr, _ := getMacAddrIntfName(ifName)
+	mtu := server.computeMinMTU(IPv4IntfNotifyMsg{
+		IfId:   ifId,
+		IfType: ifType,
+	})
+	intf = &Ospfv3Intf{
+		IfIndex:           ifIndex,
+		IfName:            ifName,
+		IfMacAddr:         macAddr,
+		IfMtu:             mtu,
+		IfInstanceId:      OSPFV3_DEFAULT_INSTANCE,
+		IfType:            config.Broadcast,
+		IfAdminStat:       config.Disabled,
+		IfRtrPriority:     uint8(config.DesignatedRouterPriority(1)),
+		IfTransitDelay:    1,
+		IfRetransInterval: 5,
+		IfHelloInterval:   10,
+		IfRtrDeadInterval: 40,
+		IfCost:            uint16(ifCost),
+		IfPrefixes:        make(map[string]*net.IPNet),
+		IfFSMState:        config.Down,
+		Nbrs:              make(map[uint32]*Ospfv3Nbr),
+		LinkLsdb:          make(Ospfv3Lsdb),
+	}
+	server.Ospfv3IntfMap[ifIndex] = intf
+	return intf
+}
+
+/*
+@fn processOspfv3GlobalConfig
+OSPFv3 falls back to the OSPFv2 router id when none is given.
+*/
+func (server *OSPFServer) processOspfv3GlobalConfig(gConf config.Ospfv3GlobalConf) error {
+	routerId := convertAreaOrRouterIdUint32(string(gConf.RouterId))
+	if gConf.RouterId == "" || routerId == 0 {
+		routerId = convertIPv4ToUint32(server.ospfGlobalConf.RouterId)
+	}
+	if gConf.AdminStat == config.Enabled && routerId == 0 {
+		server.logger.Err("OSPFV3: Router id is required to enable OSPFv3")
+		return errors.New("Invalid Router Id")
+	}
+	if server.ospfv3GlobalConf.AdminStat == config.Enabled {
+		server.stopOspfv3()
+	}
+	server.ospfv3GlobalConf.RouterId = routerId
+	server.ospfv3GlobalConf.AdminStat = gConf.AdminStat
+	if gConf.ReferenceBandwidth != 0 {
+		server.ospfv3GlobalConf.ReferenceBandwidth = gConf.ReferenceBandwidth
+	}
+	server.logger.Info(fmt.Sprintln("OSPFV3: Global configuration updated", convertUint32ToIPv4(routerId),
+		gConf.AdminStat))
+	if server.ospfv3GlobalConf.AdminStat == config.Enabled {
+		server.startOspfv3()
+	}
+	return nil
+}
+
+func (server *OSPFServer) startOspfv3() {
+	server.Ospfv3AreaLsdb = make(map[uint32]Ospfv3Lsdb)
+	server.Ospfv3ASLsdb = make(Ospfv3Lsdb)
+	server.ospfv3Ticker = time.NewTicker(time.Second)
+	server.ospfv3TickCh = server.ospfv3Ticker.C
+	for ifIndex, _ := range server.Ospfv3IntfMap {
+		server.startOspfv3IntfIfReady(ifIndex)
+	}
+	server.ospfv3GlobalConf.lsaGenPending = true
+}
+
+func (server *OSPFServer) stopOspfv3() {
+	for _, intf := range server.Ospfv3IntfMap {
+		server.stopOspfv3Intf(intf)
+	}
+	if server.ospfv3Ticker != nil {
+		server.ospfv3Ticker.Stop()
+		server.ospfv3Ticker = nil
+	}
+	server.ospfv3TickCh = nil
+	server.ospfv3GlobalConf.lsaGenPending = false
+	server.ospfv3GlobalConf.spfPending = false
+	server.Ospfv3AreaLsdb = make(map[uint32]Ospfv3Lsdb)
+	server.Ospfv3ASLsdb = make(Ospfv3Lsdb)
+	server.installOspfv3Routes(make(map[string]*Ospfv3RouteEnt))
+}
+
+func validateOspfv3IntfConf(ifConf config.Ospfv3IntfConf) error {
+	if convertAreaOrRouterId(string(ifConf.IfAreaId)) == nil {
+		return errors.New("Invalid area id")
+	}
+	switch ifConf.IfType {
+	case config.Broadcast, config.NumberedP2P, config.UnnumberedP2P:
+	default:
+		return errors.New("Unsupported OSPFv3 interface type")
+	}
+	if ifConf.IfHelloInterval == 0 || ifConf.IfRtrDeadInterval == 0 ||
+		ifConf.IfRtrDeadInterval > 0xffff || ifConf.IfCost > 0xffff {
+		return errors.New("Invalid interface timers or cost")
+	}
+	return nil
+}
+
+func (server *OSPFServer) processOspfv3IntfConfig(ifConf config.Ospfv3IntfConf) error {
+	err := validateOspfv3IntfConf(ifConf)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("OSPFV3: Invalid interface configuration", ifConf.IfIndex, err))
+		return err
+	}
+	intf := server.createOspfv3Intf(ifConf.IfIndex)
+	if intf == nil {
+		return errors.New("No such L3 interface exists")
+	}
+	server.stopOspfv3Intf(intf)
+	intf.IfConfigured = true
+	intf.IfInstanceId = ifConf.IfInstanceId
+	intf.IfAreaId = convertAreaOrRouterIdUint32(string(ifConf.IfAreaId))
+	intf.IfType = ifConf.IfType
+	intf.IfAdminStat = ifConf.IfAdminStat
+	intf.IfRtrPriority = uint8(ifConf.IfRtrPriority)
+	intf.IfTransitDelay = uint16(ifConf.IfTransitDelay)
+	intf.IfRetransInterval = uint16(ifConf.IfRetransInterval)
+	intf.IfHelloInterval = uint16(ifConf.IfHelloInterval)
+	intf.IfRtrDeadInterval = uint16(ifConf.IfRtrDeadInterval)
+	if ifConf.IfCost != 0 {
+		intf.IfCost = uint16(ifConf.IfCost)
+	}
+	server.logger.Info(fmt.Sprintln("OSPFV3: Interface configured", intf.IfName,
+		convertUint32ToIPv4(intf.IfAreaId)))
+	server.ospfv3GlobalConf.lsaGenPending = true
+	server.startOspfv3IntfIfReady(ifConf.IfIndex)
+	return nil
+}
+
+func (server *OSPFServer) processOspfv3IntfDelete(ifIndex int32) {
+	intf, exist := server.Ospfv3IntfMap[ifIndex]
+	if !exist {
+		return
+	}
+	server.stopOspfv3Intf(intf)
+	intf.IfConfigured = false
+	intf.IfAdminStat = config.Disabled
+	server.ospfv3GlobalConf.lsaGenPending = true
+}
+
+func (server *OSPFServer) startOspfv3IntfIfReady(ifIndex int32) {
+	intf, exist := server.Ospfv3IntfMap[ifIndex]
+	if !exist || intf.IfFSMState > config.Down ||
+		server.ospfv3GlobalConf.AdminStat != config.Enabled ||
+		!intf.IfConfigured || intf.IfAdminStat != config.Enabled {
+		return
+	}
+	if intf.IfLinkLocalAddr == nil {
+		intf.IfLinkLocalAddr = getLinkLocalAddrIntfName(intf.IfName)
+		if intf.IfLinkLocalAddr == nil {
+			server.logger.Info(fmt.Sprintln("OSPFV3: No link local address on", intf.IfName))
+			return
+		}
+	}
+	err := server.openOspfv3PcapHdl(intf)
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("OSPFV3: Unable to open", intf.IfName, err))
+		return
+	}
+	server.startOspfv3Intf(intf)
+}
+
+func getLinkLocalAddrIntfName(ifName string) net.IP {
+	ifi, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return nil
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if ok && ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+			return ipNet.IP
+		}
+	}
+	return nil
+}
+
+func (server *OSPFServer) openOspfv3PcapHdl(intf *Ospfv3Intf) error {
+	if intf.TxHdl.SendPcapHdl == nil {
+		sendHdl, err := pcap.OpenLive(intf.IfName, snapshot_len, promiscuous, timeout_pcap)
+		if sendHdl == nil {
+			return err
+		}
+		intf.TxHdl.SendPcapHdl = sendHdl
+		intf.TxHdl.SendMutex = &sync.Mutex{}
+	}
+	if intf.RxHdl.RecvPcapHdl == nil {
+		recvHdl, err := pcap.OpenLive(intf.IfName, snapshot_len, promiscuous, timeout_pcap)
+		if recvHdl == nil {
+			return err
+		}
+		filter := fmt.Sprintln("ip6 proto ospf and not src host", intf.IfLinkLocalAddr.String())
+		err = recvHdl.SetBPFFilter(filter)
+		if err != nil {
+			recvHdl.Close()
+			return err
+		}
+		intf.RxHdl.RecvPcapHdl = recvHdl
+		intf.RxHdl.PktRecvCh = make(chan bool)
+		intf.RxHdl.PktRecvStatusCh = make(chan bool)
+	}
+	return nil
+}
+
+/*
+@fn startOspfv3Intf
+InterfaceUp event, RFC 2328 9.3.
+*/
+func (server *OSPFServer) startOspfv3Intf(intf *Ospfv3Intf) {
+	intf.IfEvents++
+	intf.Nbrs = make(map[uint32]*Ospfv3Nbr)
+	intf.LinkLsdb = make(Ospfv3Lsdb)
+	intf.DelayedAcks = nil
+	intf.IfDRtrId = 0
+	intf.IfBDRtrId = 0
+	intf.HelloTimer = 0
+	if intf.IfType == config.Broadcast {
+		intf.IfFSMState = config.Waiting
+		intf.WaitTimer = int(intf.IfRtrDeadInterval)
+		if intf.IfRtrPriority == 0 {
+			intf.IfFSMState = config.OtherDesignatedRouter
+			intf.WaitTimer = 0
+		}
+	} else {
+		intf.IfFSMState = config.P2P
+	}
+	if _, exist := server.Ospfv3AreaLsdb[intf.IfAreaId]; !exist {
+		server.Ospfv3AreaLsdb[intf.IfAreaId] = make(Ospfv3Lsdb)
+	}
+	server.logger.Info(fmt.Sprintln("OSPFV3: Interface up", intf.IfName, "state", intf.IfFSMState))
+	go server.StartOspfv3RecvPkts(intf.IfIndex, intf.RxHdl)
+	server.sendOspfv3Hello(intf)
+	server.ospfv3GlobalConf.lsaGenPending = true
+}
+
+/*
+@fn stopOspfv3Intf
+InterfaceDown event: neighbors are killed and the interface
+returns to Down.
+*/
+func (server *OSPFServer) stopOspfv3Intf(intf *Ospfv3Intf) {
+	if intf.IfFSMState <= config.Down {
+		return
+	}
+	server.logger.Info(fmt.Sprintln("OSPFV3: Interface down", intf.IfName))
+	for _, nbr := range intf.Nbrs {
+		server.killOspfv3Nbr(intf, nbr)
+	}
+	if intf.RxHdl.RecvPcapHdl != nil {
+		server.StopOspfv3RecvPkts(intf.RxHdl)
+		intf.RxHdl.RecvPcapHdl.Close()
+		intf.RxHdl = IntfRxHandle{}
+	}
+	if intf.TxHdl.SendPcapHdl != nil {
+		intf.TxHdl.SendPcapHdl.Close()
+		intf.TxHdl = IntfTxHandle{}
+	}
+	intf.IfEvents++
+	intf.IfFSMState = config.Down
+	intf.IfDRtrId = 0
+	intf.IfBDRtrId = 0
+	intf.Nbrs = make(map[uint32]*Ospfv3Nbr)
+	intf.LinkLsdb = make(Ospfv3Lsdb)
+	intf.DelayedAcks = nil
+	server.ospfv3GlobalConf.lsaGenPending = true
+	server.ospfv3GlobalConf.spfPending = true
+}
+
+func (server *OSPFServer) getOspfv3Options(areaId uint32) uint32 {
+	options := uint32(Ospfv3V6Option | Ospfv3ROption)
+	aId := config.AreaId(convertUint32ToIPv4(areaId))
+	if !server.isStubArea(aId) && !server.isNssaArea(aId) {
+		options |= Ospfv3EOption
+	}
+	return options
+}
+
+func (server *OSPFServer) sendOspfv3Hello(intf *Ospfv3Intf) {
+	hello := Ospfv3HelloPkt{
+		IfId:            uint32(intf.IfIndex),
+		RtrPriority:     intf.IfRtrPriority,
+		Options:         server.getOspfv3Options(intf.IfAreaId),
+		HelloInterval:   intf.IfHelloInterval,
+		RtrDeadInterval: intf.IfRtrDeadInterval,
+		DRtrId:          intf.IfDRtrId,
+		BDRtrId:         intf.IfBDRtrId,
+	}
+	for rtrId, nbr := range intf.Nbrs {
+		if nbr.State >= config.NbrInit {
+			hello.Nbrs = append(hello.Nbrs, rtrId)
+		}
+	}
+	server.sendOspfv3Pkt(intf, HelloType, encodeOspfv3HelloPkt(hello), ALLSPFROUTERV6, ALLSPFROUTERV6MAC)
+	intf.HelloTimer = int(intf.IfHelloInterval)
+}
+
+/*
+@fn processOspfv3Hello
+RFC 2328 10.5 with the RFC 5340 changes: neighbors are identified
+by router id, there is no network mask and DR and BDR are router
+ids.
+*/
+func (server *OSPFServer) processOspfv3Hello(intf *Ospfv3Intf, hdr Ospfv3Header,
+	msg ospfv3RxPktMsg, body []byte) error {
+	hello, err := decodeOspfv3HelloPkt(body)
+	if err != nil {
+		return err
+	}
+	err = checkHelloIntervals(intf.IfHelloInterval, uint32(intf.IfRtrDeadInterval),
+		hello.HelloInterval, uint32(hello.RtrDeadInterval))
+	if err != nil {
+		return err
+	}
+	if (hello.Options^server.getOspfv3Options(intf.IfAreaId))&Ospfv3EOption != 0 {
+		return errors.New("External routing capability mismatch")
+	}
+	rtrId := hdr.routerId
+	nbr, exist := intf.Nbrs[rtrId]
+	if !exist {
+		nbr = &Ospfv3Nbr{
+			RtrId: rtrId,
+			State: config.NbrDown,
+		}
+		intf.Nbrs[rtrId] = nbr
+		server.logger.Info(fmt.Sprintln("OSPFV3: New neighbor", convertUint32ToIPv4(rtrId), "on", intf.IfName))
+	}
+	oldCandidate := getOspfv3DRCandidate(nbr)
+	nbr.IfId = hello.IfId
+	nbr.Addr = msg.srcIp
+	nbr.MacAddr = msg.srcMac
+	nbr.Priority = hello.RtrPriority
+	nbr.Options = hello.Options
+	nbr.DRtrId = hello.DRtrId
+	nbr.BDRtrId = hello.BDRtrId
+	nbr.DeadTimer = int(intf.IfRtrDeadInterval)
+	if nbr.State == config.NbrDown {
+		server.setOspfv3NbrState(intf, nbr, config.NbrInit)
+	}
+
+	twoWay := false
+	for _, id := range hello.Nbrs {
+		if id == server.ospfv3GlobalConf.RouterId {
+			twoWay = true
+			break
+		}
+	}
+	if !twoWay {
+		if nbr.State >= config.NbrTwoWay {
+			server.resetOspfv3Nbr(intf, nbr, config.NbrInit)
+			server.ospfv3NbrChange(intf)
+		}
+		return nil
+	}
+	if nbr.State == config.NbrInit {
+		server.setOspfv3NbrState(intf, nbr, config.NbrTwoWay)
+		server.ospfv3NbrChange(intf)
+		server.checkOspfv3Adjacency(intf, nbr)
+	}
+	if intf.IfType != config.Broadcast {
+		return nil
+	}
+	candidate := getOspfv3DRCandidate(nbr)
+	if intf.IfFSMState == config.Waiting && isBackupSeen(candidate) {
+		intf.WaitTimer = 0
+		server.electOspfv3DR(intf)
+		return nil
+	}
+	if isDRNeighborChange(oldCandidate, candidate) {
+		server.ospfv3NbrChange(intf)
+	}
+	return nil
+}
+
+/* NeighborChange event, RFC 2328 9.2 */
+func (server *OSPFServer) ospfv3NbrChange(intf *Ospfv3Intf) {
+	if intf.IfType != config.Broadcast {
+		return
+	}
+	if intf.IfFSMState == config.DesignatedRouter ||
+		intf.IfFSMState == config.BackupDesignatedRouter ||
+		intf.IfFSMState == config.OtherDesignatedRouter {
+		server.electOspfv3DR(intf)
+	}
+}
+
+func getOspfv3DRCandidate(nbr *Ospfv3Nbr) drCandidate {
+	return drCandidate{
+		id:       nbr.RtrId,
+		rtrId:    nbr.RtrId,
+		priority: nbr.Priority,
+		dr:       nbr.DRtrId,
+		bdr:      nbr.BDRtrId,
+	}
+}
+
+/*
+@fn electOspfv3DR
+RFC 2328 9.4, routers are identified by their router id.
+*/
+func (server *OSPFServer) electOspfv3DR(intf *Ospfv3Intf) {
+	rtrId := server.ospfv3GlobalConf.RouterId
+	oldDRtrId := intf.IfDRtrId
+	oldBDRtrId := intf.IfBDRtrId
+	var candidates []drCandidate
+	for _, nbr := range intf.Nbrs {
+		if nbr.State >= config.NbrTwoWay && nbr.Priority > 0 {
+			candidates = append(candidates, getOspfv3DRCandidate(nbr))
+		}
+	}
+	self := drCandidate{
+		id:       rtrId,
+		rtrId:    rtrId,
+		priority: intf.IfRtrPriority,
+		dr:       intf.IfDRtrId,
+		bdr:      intf.IfBDRtrId,
+	}
+	dr, bdr := electDRAndBDR(self, candidates)
+	dRtrId := dr.id
+	bDRtrId := bdr.id
+	intf.IfDRtrId = dRtrId
+	intf.IfBDRtrId = bDRtrId
+	switch rtrId {
+	case dRtrId:
+		intf.IfFSMState = config.DesignatedRouter
+	case bDRtrId:
+		intf.IfFSMState = config.BackupDesignatedRouter
+	default:
+		intf.IfFSMState = config.OtherDesignatedRouter
+	}
+	if dRtrId != oldDRtrId || bDRtrId != oldBDRtrId {
+		server.logger.Info(fmt.Sprintln("OSPFV3: DR", convertUint32ToIPv4(dRtrId), "BDR",
+			convertUint32ToIPv4(bDRtrId), "on", intf.IfName))
+		intf.IfEvents++
+		for _, nbr := range intf.Nbrs {
+			server.checkOspfv3Adjacency(intf, nbr)
+		}
+		server.ospfv3GlobalConf.lsaGenPending = true
+	}
+}
+
+/*
+@fn processOspfv3IntfTimers
+Runs every second: hello and wait timers of the interface and
+the timers of its neighbors, then flushes delayed acks.
+*/
+func (server *OSPFServer) processOspfv3IntfTimers(intf *Ospfv3Intf) {
+	if intf.IfFSMState <= config.Down {
+		return
+	}
+	intf.HelloTimer--
+	if intf.HelloTimer <= 0 {
+		server.sendOspfv3Hello(intf)
+	}
+	if intf.IfFSMState == config.Waiting {
+		intf.WaitTimer--
+		if intf.WaitTimer <= 0 {
+			server.electOspfv3DR(intf)
+		}
+	}
+	for _, nbr := range intf.Nbrs {
+		server.processOspfv3NbrTimers(intf, nbr)
+	}
+	server.sendOspfv3DelayedAcks(intf)
+}
+
+func (server *OSPFServer) processOspfv3Tick() {
+	for _, intf := range server.Ospfv3IntfMap {
+		server.processOspfv3IntfTimers(intf)
+	}
+	server.ageOspfv3Lsdb()
+	if server.ospfv3GlobalConf.lsaGenPending {
+		server.ospfv3GlobalConf.lsaGenPending = false
+		server.originateOspfv3SelfLsas()
+	}
+	if server.ospfv3GlobalConf.spfHoldTimer > 0 {
+		server.ospfv3GlobalConf.spfHoldTimer--
+	}
+	if server.ospfv3GlobalConf.spfPending && server.ospfv3GlobalConf.spfHoldTimer == 0 {
+		server.ospfv3GlobalConf.spfPending = false
+		server.ospfv3GlobalConf.spfHoldTimer = OSPFV3_SPF_HOLD_TIME
+		server.calcOspfv3Spf()
+	}
+}
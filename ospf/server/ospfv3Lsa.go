@@ -0,0 +1,475 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"l3/ospf/config"
+	"net"
+)
+
+/* Router-LSA link types, RFC 5340 A.4.3 */
+const (
+	Ospfv3P2PLink     uint8 = 1
+	Ospfv3TransitLink uint8 = 2
+	Ospfv3VirtualLink uint8 = 4
+)
+
+/* Router-LSA flags */
+const (
+	Ospfv3BBit = 0x01
+	Ospfv3EBit = 0x02
+	Ospfv3VBit = 0x04
+)
+
+/* Prefix options, RFC 5340 A.4.1.1 */
+const (
+	Ospfv3PrefixNU = 0x01
+	Ospfv3PrefixLA = 0x02
+	Ospfv3PrefixP  = 0x08
+	Ospfv3PrefixDN = 0x10
+)
+
+/* AS-external-LSA flags */
+const (
+	Ospfv3ExtTBit = 0x01
+	Ospfv3ExtFBit = 0x02
+	Ospfv3ExtEBit = 0x04
+)
+
+type Ospfv3Prefix struct {
+	PrefixLen     uint8
+	PrefixOptions uint8
+	Metric        uint16
+	Prefix        net.IP
+}
+
+type Ospfv3RouterLink struct {
+	LinkType uint8
+	Metric   uint16
+	IfId     uint32
+	NbrIfId  uint32
+	NbrRtrId uint32
+}
+
+type Ospfv3RouterLsa struct {
+	Flags   uint8
+	Options uint32
+	Links   []Ospfv3RouterLink
+}
+
+type Ospfv3NetworkLsa struct {
+	Options     uint32
+	AttachedRtr []uint32
+}
+
+type Ospfv3InterAreaPrefixLsa struct {
+	Metric uint32
+	Prefix Ospfv3Prefix
+}
+
+type Ospfv3InterAreaRouterLsa struct {
+	Options uint32
+	Metric  uint32
+	DestRtr uint32
+}
+
+type Ospfv3ASExternalLsa struct {
+	Flags       uint8
+	Metric      uint32
+	Prefix      Ospfv3Prefix
+	RefLSType   uint16
+	FwdAddr     net.IP
+	ExtRouteTag uint32
+	RefLSId     uint32
+}
+
+type Ospfv3LinkLsa struct {
+	RtrPriority   uint8
+	Options       uint32
+	LinkLocalAddr net.IP
+	Prefixes      []Ospfv3Prefix
+}
+
+type Ospfv3IntraAreaPrefixLsa struct {
+	RefLSType    uint16
+	RefLSId      uint32
+	RefAdvRouter uint32
+	Prefixes     []Ospfv3Prefix
+}
+
+func encodeOspfv3LsaHeader(hdr Ospfv3LsaHeader) []byte {
+	data := make([]byte, OSPFV3_LSA_HEADER_SIZE)
+	binary.BigEndian.PutUint16(data[0:2], hdr.LSAge)
+	binary.BigEndian.PutUint16(data[2:4], hdr.LSType)
+	binary.BigEndian.PutUint32(data[4:8], hdr.LSId)
+	binary.BigEndian.PutUint32(data[8:12], hdr.AdvRouter)
+	binary.BigEndian.PutUint32(data[12:16], hdr.LSSequenceNum)
+	binary.BigEndian.PutUint16(data[16:18], hdr.LSChecksum)
+	binary.BigEndian.PutUint16(data[18:20], hdr.LSLen)
+	return data
+}
+
+func decodeOspfv3LsaHeader(data []byte) Ospfv3LsaHeader {
+	return Ospfv3LsaHeader{
+		LSAge:         binary.BigEndian.Uint16(data[0:2]),
+		LSType:        binary.BigEndian.Uint16(data[2:4]),
+		LSId:          binary.BigEndian.Uint32(data[4:8]),
+		AdvRouter:     binary.BigEndian.Uint32(data[8:12]),
+		LSSequenceNum: binary.BigEndian.Uint32(data[12:16]),
+		LSChecksum:    binary.BigEndian.Uint16(data[16:18]),
+		LSLen:         binary.BigEndian.Uint16(data[18:20]),
+	}
+}
+
+/*
+@fn buildOspfv3Lsa
+Prepend the header to an encoded body and fill in length and
+Fletcher checksum the same way as OSPFv2 does.
+*/
+func buildOspfv3Lsa(hdr Ospfv3LsaHeader, body []byte) []byte {
+	hdr.LSLen = uint16(OSPFV3_LSA_HEADER_SIZE + len(body))
+	hdr.LSChecksum = 0
+	lsa := append(encodeOspfv3LsaHeader(hdr), body...)
+	checksumOffset := uint16(14)
+	checkSum := computeFletcherChecksum(lsa[2:], checksumOffset)
+	binary.BigEndian.PutUint16(lsa[16:18], checkSum)
+	return lsa
+}
+
+/* RFC 2328 13.1 on the OSPFv3 LSA header */
+func compareOspfv3Lsa(hdr1 Ospfv3LsaHeader, hdr2 Ospfv3LsaHeader) int {
+	return compareLsaInstance(hdr1.LSSequenceNum, hdr1.LSChecksum, hdr1.LSAge,
+		hdr2.LSSequenceNum, hdr2.LSChecksum, hdr2.LSAge)
+}
+
+func ospfv3PrefixSize(prefixLen uint8) int {
+	return ((int(prefixLen) + 31) / 32) * 4
+}
+
+/*
+Prefixes are encoded as prefix length, prefix options, a 16 bit
+field whose meaning depends on the LSA, and the address padded
+to a 32 bit boundary.
+*/
+func encodeOspfv3Prefix(prefix Ospfv3Prefix, field uint16) []byte {
+	size := ospfv3PrefixSize(prefix.PrefixLen)
+	data := make([]byte, 4+size)
+	data[0] = prefix.PrefixLen
+	data[1] = prefix.PrefixOptions
+	binary.BigEndian.PutUint16(data[2:4], field)
+	copy(data[4:], prefix.Prefix.To16()[:size])
+	return data
+}
+
+func decodeOspfv3Prefix(data []byte) (prefix Ospfv3Prefix, field uint16, length int, err error) {
+	if len(data) < 4 {
+		return prefix, 0, 0, errors.New("Truncated prefix")
+	}
+	prefix.PrefixLen = data[0]
+	prefix.PrefixOptions = data[1]
+	field = binary.BigEndian.Uint16(data[2:4])
+	if prefix.PrefixLen > 128 {
+		return prefix, 0, 0, errors.New("Invalid prefix length")
+	}
+	size := ospfv3PrefixSize(prefix.PrefixLen)
+	if len(data) < 4+size {
+		return prefix, 0, 0, errors.New("Truncated prefix")
+	}
+	prefix.Prefix = make(net.IP, net.IPv6len)
+	copy(prefix.Prefix, data[4:4+size])
+	prefix.Prefix = prefix.Prefix.Mask(net.CIDRMask(int(prefix.PrefixLen), 128))
+	return prefix, field, 4 + size, nil
+}
+
+func (prefix Ospfv3Prefix) ipNet() net.IPNet {
+	return net.IPNet{
+		IP:   prefix.Prefix.Mask(net.CIDRMask(int(prefix.PrefixLen), 128)),
+		Mask: net.CIDRMask(int(prefix.PrefixLen), 128),
+	}
+}
+
+func putUint24(data []byte, val uint32) {
+	data[0] = byte(val >> 16)
+	data[1] = byte(val >> 8)
+	data[2] = byte(val)
+}
+
+func getUint24(data []byte) uint32 {
+	return uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])
+}
+
+func encodeOspfv3RouterLsa(lsa Ospfv3RouterLsa) []byte {
+	data := make([]byte, 4+16*len(lsa.Links))
+	data[0] = lsa.Flags
+	putUint24(data[1:4], lsa.Options)
+	for i, link := range lsa.Links {
+		off := 4 + 16*i
+		data[off] = link.LinkType
+		binary.BigEndian.PutUint16(data[off+2:off+4], link.Metric)
+		binary.BigEndian.PutUint32(data[off+4:off+8], link.IfId)
+		binary.BigEndian.PutUint32(data[off+8:off+12], link.NbrIfId)
+		binary.BigEndian.PutUint32(data[off+12:off+16], link.NbrRtrId)
+	}
+	return data
+}
+
+func decodeOspfv3RouterLsa(body []byte) (lsa Ospfv3RouterLsa, err error) {
+	if len(body) < 4 || (len(body)-4)%16 != 0 {
+		return lsa, errors.New("Invalid router-LSA length")
+	}
+	lsa.Flags = body[0]
+	lsa.Options = getUint24(body[1:4])
+	for off := 4; off < len(body); off += 16 {
+		lsa.Links = append(lsa.Links, Ospfv3RouterLink{
+			LinkType: body[off],
+			Metric:   binary.BigEndian.Uint16(body[off+2 : off+4]),
+			IfId:     binary.BigEndian.Uint32(body[off+4 : off+8]),
+			NbrIfId:  binary.BigEndian.Uint32(body[off+8 : off+12]),
+			NbrRtrId: binary.BigEndian.Uint32(body[off+12 : off+16]),
+		})
+	}
+	return lsa, nil
+}
+
+func encodeOspfv3NetworkLsa(lsa Ospfv3NetworkLsa) []byte {
+	data := make([]byte, 4+4*len(lsa.AttachedRtr))
+	putUint24(data[1:4], lsa.Options)
+	for i, rtrId := range lsa.AttachedRtr {
+		binary.BigEndian.PutUint32(data[4+4*i:8+4*i], rtrId)
+	}
+	return data
+}
+
+func decodeOspfv3NetworkLsa(body []byte) (lsa Ospfv3NetworkLsa, err error) {
+	if len(body) < 4 || (len(body)-4)%4 != 0 {
+		return lsa, errors.New("Invalid network-LSA length")
+	}
+	lsa.Options = getUint24(body[1:4])
+	for off := 4; off < len(body); off += 4 {
+		lsa.AttachedRtr = append(lsa.AttachedRtr, binary.BigEndian.Uint32(body[off:off+4]))
+	}
+	return lsa, nil
+}
+
+func encodeOspfv3InterAreaPrefixLsa(lsa Ospfv3InterAreaPrefixLsa) []byte {
+	data := make([]byte, 4)
+	putUint24(data[1:4], lsa.Metric)
+	return append(data, encodeOspfv3Prefix(lsa.Prefix, 0)...)
+}
+
+func decodeOspfv3InterAreaPrefixLsa(body []byte) (lsa Ospfv3InterAreaPrefixLsa, err error) {
+	if len(body) < 4 {
+		return lsa, errors.New("Invalid inter-area-prefix-LSA length")
+	}
+	lsa.Metric = getUint24(body[1:4])
+	lsa.Prefix, _, _, err = decodeOspfv3Prefix(body[4:])
+	return lsa, err
+}
+
+func encodeOspfv3InterAreaRouterLsa(lsa Ospfv3InterAreaRouterLsa) []byte {
+	data := make([]byte, 12)
+	putUint24(data[1:4], lsa.Options)
+	putUint24(data[5:8], lsa.Metric)
+	binary.BigEndian.PutUint32(data[8:12], lsa.DestRtr)
+	return data
+}
+
+func decodeOspfv3InterAreaRouterLsa(body []byte) (lsa Ospfv3InterAreaRouterLsa, err error) {
+	if len(body) < 12 {
+		return lsa, errors.New("Invalid inter-area-router-LSA length")
+	}
+	lsa.Options = getUint24(body[1:4])
+	lsa.Metric = getUint24(body[5:8])
+	lsa.DestRtr = binary.BigEndian.Uint32(body[8:12])
+	return lsa, nil
+}
+
+func encodeOspfv3ASExternalLsa(lsa Ospfv3ASExternalLsa) []byte {
+	data := make([]byte, 4)
+	flags := lsa.Flags &^ (Ospfv3ExtFBit | Ospfv3ExtTBit)
+	if lsa.FwdAddr != nil && !lsa.FwdAddr.IsUnspecified() {
+		flags |= Ospfv3ExtFBit
+	}
+	if lsa.ExtRouteTag != 0 {
+		flags |= Ospfv3ExtTBit
+	}
+	data[0] = flags
+	putUint24(data[1:4], lsa.Metric)
+	data = append(data, encodeOspfv3Prefix(lsa.Prefix, lsa.RefLSType)...)
+	if flags&Ospfv3ExtFBit != 0 {
+		data = append(data, lsa.FwdAddr.To16()...)
+	}
+	if flags&Ospfv3ExtTBit != 0 {
+		tag := make([]byte, 4)
+		binary.BigEndian.PutUint32(tag, lsa.ExtRouteTag)
+		data = append(data, tag...)
+	}
+	if lsa.RefLSType != 0 {
+		refId := make([]byte, 4)
+		binary.BigEndian.PutUint32(refId, lsa.RefLSId)
+		data = append(data, refId...)
+	}
+	return data
+}
+
+func decodeOspfv3ASExternalLsa(body []byte) (lsa Ospfv3ASExternalLsa, err error) {
+	if len(body) < 4 {
+		return lsa, errors.New("Invalid AS-external-LSA length")
+	}
+	lsa.Flags = body[0]
+	lsa.Metric = getUint24(body[1:4])
+	prefix, refLSType, length, err := decodeOspfv3Prefix(body[4:])
+	if err != nil {
+		return lsa, err
+	}
+	lsa.Prefix = prefix
+	lsa.RefLSType = refLSType
+	off := 4 + length
+	if lsa.Flags&Ospfv3ExtFBit != 0 {
+		if len(body) < off+16 {
+			return lsa, errors.New("Truncated forwarding address")
+		}
+		lsa.FwdAddr = make(net.IP, net.IPv6len)
+		copy(lsa.FwdAddr, body[off:off+16])
+		off += 16
+	}
+	if lsa.Flags&Ospfv3ExtTBit != 0 {
+		if len(body) < off+4 {
+			return lsa, errors.New("Truncated external route tag")
+		}
+		lsa.ExtRouteTag = binary.BigEndian.Uint32(body[off : off+4])
+		off += 4
+	}
+	if lsa.RefLSType != 0 {
+		if len(body) < off+4 {
+			return lsa, errors.New("Truncated referenced link state id")
+		}
+		lsa.RefLSId = binary.BigEndian.Uint32(body[off : off+4])
+	}
+	return lsa, nil
+}
+
+func encodeOspfv3LinkLsa(lsa Ospfv3LinkLsa) []byte {
+	data := make([]byte, 24)
+	data[0] = lsa.RtrPriority
+	putUint24(data[1:4], lsa.Options)
+	copy(data[4:20], lsa.LinkLocalAddr.To16())
+	binary.BigEndian.PutUint32(data[20:24], uint32(len(lsa.Prefixes)))
+	for _, prefix := range lsa.Prefixes {
+		data = append(data, encodeOspfv3Prefix(prefix, 0)...)
+	}
+	return data
+}
+
+func decodeOspfv3LinkLsa(body []byte) (lsa Ospfv3LinkLsa, err error) {
+	if len(body) < 24 {
+		return lsa, errors.New("Invalid link-LSA length")
+	}
+	lsa.RtrPriority = body[0]
+	lsa.Options = getUint24(body[1:4])
+	lsa.LinkLocalAddr = make(net.IP, net.IPv6len)
+	copy(lsa.LinkLocalAddr, body[4:20])
+	numPrefixes := binary.BigEndian.Uint32(body[20:24])
+	off := 24
+	for i := uint32(0); i < numPrefixes; i++ {
+		prefix, _, length, err := decodeOspfv3Prefix(body[off:])
+		if err != nil {
+			return lsa, err
+		}
+		lsa.Prefixes = append(lsa.Prefixes, prefix)
+		off += length
+	}
+	return lsa, nil
+}
+
+func encodeOspfv3IntraAreaPrefixLsa(lsa Ospfv3IntraAreaPrefixLsa) []byte {
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint16(data[0:2], uint16(len(lsa.Prefixes)))
+	binary.BigEndian.PutUint16(data[2:4], lsa.RefLSType)
+	binary.BigEndian.PutUint32(data[4:8], lsa.RefLSId)
+	binary.BigEndian.PutUint32(data[8:12], lsa.RefAdvRouter)
+	for _, prefix := range lsa.Prefixes {
+		data = append(data, encodeOspfv3Prefix(prefix, prefix.Metric)...)
+	}
+	return data
+}
+
+func decodeOspfv3IntraAreaPrefixLsa(body []byte) (lsa Ospfv3IntraAreaPrefixLsa, err error) {
+	if len(body) < 12 {
+		return lsa, errors.New("Invalid intra-area-prefix-LSA length")
+	}
+	numPrefixes := binary.BigEndian.Uint16(body[0:2])
+	lsa.RefLSType = binary.BigEndian.Uint16(body[2:4])
+	lsa.RefLSId = binary.BigEndian.Uint32(body[4:8])
+	lsa.RefAdvRouter = binary.BigEndian.Uint32(body[8:12])
+	off := 12
+	for i := uint16(0); i < numPrefixes; i++ {
+		prefix, metric, length, err := decodeOspfv3Prefix(body[off:])
+		if err != nil {
+			return lsa, err
+		}
+		prefix.Metric = metric
+		lsa.Prefixes = append(lsa.Prefixes, prefix)
+		off += length
+	}
+	return lsa, nil
+}
+
+/*
+@fn validateOspfv3Lsa
+Checks the length and checksum of a received LSA and that its
+body can be parsed for the known function codes.
+*/
+func validateOspfv3Lsa(data []byte) (hdr Ospfv3LsaHeader, err error) {
+	if len(data) < OSPFV3_LSA_HEADER_SIZE {
+		return hdr, errors.New("Truncated LSA header")
+	}
+	hdr = decodeOspfv3LsaHeader(data)
+	if int(hdr.LSLen) < OSPFV3_LSA_HEADER_SIZE || int(hdr.LSLen) > len(data) {
+		return hdr, errors.New("Invalid LSA length")
+	}
+	if !validateChecksum(data[:hdr.LSLen]) {
+		return hdr, errors.New("Invalid LSA checksum")
+	}
+	body := data[OSPFV3_LSA_HEADER_SIZE:hdr.LSLen]
+	switch hdr.LSType &^ Ospfv3UBit {
+	case Ospfv3RouterLSA:
+		_, err = decodeOspfv3RouterLsa(body)
+	case Ospfv3NetworkLSA:
+		_, err = decodeOspfv3NetworkLsa(body)
+	case Ospfv3InterAreaPrefixLSA:
+		_, err = decodeOspfv3InterAreaPrefixLsa(body)
+	case Ospfv3InterAreaRouterLSA:
+		_, err = decodeOspfv3InterAreaRouterLsa(body)
+	case Ospfv3ASExternalLSA:
+		_, err = decodeOspfv3ASExternalLsa(body)
+	case Ospfv3LinkLSA:
+		_, err = decodeOspfv3LinkLsa(body)
+	case Ospfv3IntraAreaPrefixLSA:
+		_, err = decodeOspfv3IntraAreaPrefixLsa(body)
+	}
+	return hdr, err
+}
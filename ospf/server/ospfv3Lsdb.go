@@ -0,0 +1,752 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"l3/ospf/config"
+	"net"
+	"sort"
+	"time"
+)
+
+func (ent *Ospfv3LsaEnt) currentHdr() Ospfv3LsaHeader {
+	hdr := ent.Hdr
+	age := uint32(hdr.LSAge) + uint32(time.Since(ent.InstallTime)/time.Second)
+	if age > uint32(config.MaxAge) {
+		age = uint32(config.MaxAge)
+	}
+	hdr.LSAge = uint16(age)
+	return hdr
+}
+
+func (ent *Ospfv3LsaEnt) currentData() []byte {
+	data := make([]byte, len(ent.Data))
+	copy(data, ent.Data)
+	binary.BigEndian.PutUint16(data[0:2], ent.currentHdr().LSAge)
+	return data
+}
+
+func (server *OSPFServer) isOspfv3StubArea(areaId uint32) bool {
+	aId := config.AreaId(convertUint32ToIPv4(areaId))
+	return server.isStubArea(aId) || server.isNssaArea(aId)
+}
+
+func isKnownOspfv3LsType(lsType uint16) bool {
+	switch lsType &^ Ospfv3UBit {
+	case Ospfv3RouterLSA, Ospfv3NetworkLSA, Ospfv3InterAreaPrefixLSA,
+		Ospfv3InterAreaRouterLSA, Ospfv3ASExternalLSA, Ospfv3LinkLSA,
+		Ospfv3IntraAreaPrefixLSA:
+		return true
+	}
+	return false
+}
+
+/*
+@fn getOspfv3FloodScope
+RFC 5340 4.5.1: unknown LSAs without the U bit are handled as
+link local.
+*/
+func getOspfv3FloodScope(lsType uint16) uint8 {
+	if !isKnownOspfv3LsType(lsType) && lsType&Ospfv3UBit == 0 {
+		return Ospfv3LinkScope
+	}
+	return getOspfv3LsaScope(lsType)
+}
+
+func (server *OSPFServer) getOspfv3Lsdb(lsType uint16, areaId uint32, intf *Ospfv3Intf) Ospfv3Lsdb {
+	switch getOspfv3FloodScope(lsType) {
+	case Ospfv3LinkScope:
+		if intf == nil {
+			return nil
+		}
+		return intf.LinkLsdb
+	case Ospfv3AreaScope:
+		return server.Ospfv3AreaLsdb[areaId]
+	case Ospfv3ASScope:
+		return server.Ospfv3ASLsdb
+	}
+	return nil
+}
+
+func (server *OSPFServer) lookupOspfv3Lsa(intf *Ospfv3Intf, key Ospfv3LsaKey) *Ospfv3LsaEnt {
+	lsdb := server.getOspfv3Lsdb(key.LSType, intf.IfAreaId, intf)
+	if lsdb == nil {
+		return nil
+	}
+	return lsdb[key]
+}
+
+/* Interfaces an LSA of the given scope is flooded on */
+func (server *OSPFServer) getOspfv3FloodIntfs(lsType uint16, areaId uint32, intf *Ospfv3Intf) []*Ospfv3Intf {
+	var intfs []*Ospfv3Intf
+	scope := getOspfv3FloodScope(lsType)
+	if scope == Ospfv3LinkScope {
+		if intf != nil && intf.IfFSMState > config.Down {
+			intfs = append(intfs, intf)
+		}
+		return intfs
+	}
+	for _, ent := range server.Ospfv3IntfMap {
+		if ent.IfFSMState <= config.Down {
+			continue
+		}
+		if scope == Ospfv3AreaScope && ent.IfAreaId != areaId {
+			continue
+		}
+		if scope == Ospfv3ASScope && server.isOspfv3StubArea(ent.IfAreaId) {
+			continue
+		}
+		intfs = append(intfs, ent)
+	}
+	return intfs
+}
+
+func (server *OSPFServer) removeOspfv3LsaFromRetxLists(intfs []*Ospfv3Intf, key Ospfv3LsaKey) {
+	for _, intf := range intfs {
+		for _, nbr := range intf.Nbrs {
+			delete(nbr.RetxList, key)
+		}
+	}
+}
+
+/*
+@fn floodOspfv3Lsa
+RFC 2328 13.3. Returns true when the LSA was flooded back out of
+the receiving interface.
+*/
+func (server *OSPFServer) floodOspfv3Lsa(hdr Ospfv3LsaHeader, data []byte, intfs []*Ospfv3Intf,
+	rxIntf *Ospfv3Intf, rxNbr *Ospfv3Nbr) bool {
+	floodedBack := false
+	key := hdr.key()
+	for _, intf := range intfs {
+		added := false
+		for _, nbr := range intf.Nbrs {
+			if nbr.State < config.NbrExchange {
+				continue
+			}
+			if nbr.State < config.NbrFull {
+				if req, exist := nbr.RequestList[key]; exist {
+					ret := compareOspfv3Lsa(hdr, req)
+					if ret < 0 {
+						continue
+					}
+					server.ospfv3RequestSatisfied(intf, nbr, key)
+					if ret == 0 {
+						continue
+					}
+				}
+			}
+			if nbr == rxNbr {
+				continue
+			}
+			if len(nbr.RetxList) == 0 {
+				nbr.LsuRetxTimer = int(intf.IfRetransInterval)
+			}
+			nbr.RetxList[key] = hdr.LSSequenceNum
+			added = true
+		}
+		if !added {
+			continue
+		}
+		if intf == rxIntf && rxNbr != nil &&
+			(rxNbr.RtrId == intf.IfDRtrId || rxNbr.RtrId == intf.IfBDRtrId) {
+			continue
+		}
+		if intf == rxIntf && intf.IfFSMState == config.BackupDesignatedRouter {
+			continue
+		}
+		server.sendOspfv3LSUpd(intf, nil, [][]byte{data})
+		if intf == rxIntf {
+			floodedBack = true
+		}
+	}
+	return floodedBack
+}
+
+/*
+@fn sendOspfv3LSUpd
+Sends LSAs to a neighbor, or floods them when nbr is nil. The
+age of each LSA is incremented by the interface transit delay.
+*/
+func (server *OSPFServer) sendOspfv3LSUpd(intf *Ospfv3Intf, nbr *Ospfv3Nbr, lsas [][]byte) {
+	maxLen := int(intf.IfMtu) - IPV6_HEADER_LEN - OSPFV3_HEADER_SIZE - OSPFV3_LSU_MIN_SIZE
+	var pkt [][]byte
+	pktLen := 0
+	send := func() {
+		if len(pkt) == 0 {
+			return
+		}
+		body := encodeOspfv3LSUpdPkt(pkt)
+		if nbr == nil {
+			dstIp, dstMac := server.getOspfv3FloodDst(intf)
+			server.sendOspfv3Pkt(intf, LSUpdateType, body, dstIp, dstMac)
+		} else {
+			server.sendOspfv3Unicast(intf, nbr, LSUpdateType, body)
+		}
+		pkt = nil
+		pktLen = 0
+	}
+	for _, lsa := range lsas {
+		data := make([]byte, len(lsa))
+		copy(data, lsa)
+		age := uint32(binary.BigEndian.Uint16(data[0:2])) + uint32(intf.IfTransitDelay)
+		if age > uint32(config.MaxAge) {
+			age = uint32(config.MaxAge)
+		}
+		binary.BigEndian.PutUint16(data[0:2], uint16(age))
+		if pktLen+len(data) > maxLen {
+			send()
+		}
+		pkt = append(pkt, data)
+		pktLen += len(data)
+	}
+	send()
+}
+
+func (server *OSPFServer) retransmitOspfv3Lsas(intf *Ospfv3Intf, nbr *Ospfv3Nbr) {
+	var lsas [][]byte
+	for key, seq := range nbr.RetxList {
+		ent := server.lookupOspfv3Lsa(intf, key)
+		if ent == nil || ent.Hdr.LSSequenceNum != seq {
+			delete(nbr.RetxList, key)
+			continue
+		}
+		lsas = append(lsas, ent.currentData())
+	}
+	nbr.LsuRetxTimer = int(intf.IfRetransInterval)
+	server.sendOspfv3LSUpd(intf, nbr, lsas)
+}
+
+func (server *OSPFServer) isOspfv3DBExchangeInProgress() bool {
+	for _, intf := range server.Ospfv3IntfMap {
+		for _, nbr := range intf.Nbrs {
+			if nbr.State == config.NbrExchange || nbr.State == config.NbrLoading {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (server *OSPFServer) isOspfv3LsaOnRetxList(intfs []*Ospfv3Intf, key Ospfv3LsaKey) bool {
+	for _, intf := range intfs {
+		for _, nbr := range intf.Nbrs {
+			if _, exist := nbr.RetxList[key]; exist {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (server *OSPFServer) installOspfv3Lsa(lsdb Ospfv3Lsdb, hdr Ospfv3LsaHeader, data []byte) {
+	key := hdr.key()
+	old, exist := lsdb[key]
+	changed := !exist || hdr.LSAge >= config.MaxAge ||
+		old.Hdr.LSAge >= config.MaxAge ||
+		!bytes.Equal(old.Data[OSPFV3_LSA_HEADER_SIZE:], data[OSPFV3_LSA_HEADER_SIZE:hdr.LSLen])
+	lsa := make([]byte, hdr.LSLen)
+	copy(lsa, data)
+	lsdb[key] = &Ospfv3LsaEnt{
+		Hdr:         hdr,
+		Data:        lsa,
+		InstallTime: time.Now(),
+		MaxAgeFlood: hdr.LSAge >= config.MaxAge,
+	}
+	if changed {
+		server.ospfv3GlobalConf.spfPending = true
+		if hdr.LSType == Ospfv3LinkLSA {
+			/* Network intra-area-prefix-LSA is built from Link-LSAs */
+			server.ospfv3GlobalConf.lsaGenPending = true
+		}
+	}
+}
+
+/*
+@fn processOspfv3LSUpd
+RFC 2328 13 with the flooding scopes of RFC 5340 4.5.2.
+*/
+func (server *OSPFServer) processOspfv3LSUpd(intf *Ospfv3Intf, nbr *Ospfv3Nbr, body []byte) error {
+	if nbr.State < config.NbrExchange {
+		return nil
+	}
+	lsas, err := decodeOspfv3LSUpdPkt(body)
+	if err != nil {
+		return err
+	}
+	rtrId := server.ospfv3GlobalConf.RouterId
+	for _, data := range lsas {
+		hdr, err := validateOspfv3Lsa(data)
+		if err != nil {
+			server.logger.Info(fmt.Sprintln("OSPFV3: Discard LSA from", convertUint32ToIPv4(nbr.RtrId), err))
+			continue
+		}
+		scope := getOspfv3FloodScope(hdr.LSType)
+		if scope == Ospfv3ReservedScope {
+			continue
+		}
+		if scope == Ospfv3ASScope && server.isOspfv3StubArea(intf.IfAreaId) {
+			continue
+		}
+		lsdb := server.getOspfv3Lsdb(hdr.LSType, intf.IfAreaId, intf)
+		if lsdb == nil {
+			continue
+		}
+		key := hdr.key()
+		ent := lsdb[key]
+		if hdr.LSAge >= config.MaxAge && ent == nil && !server.isOspfv3DBExchangeInProgress() {
+			server.sendOspfv3Unicast(intf, nbr, LSAckType, encodeOspfv3LSAckPkt([]Ospfv3LsaHeader{hdr}))
+			continue
+		}
+		ret := 1
+		if ent != nil {
+			ret = compareOspfv3Lsa(hdr, ent.currentHdr())
+		}
+		if ret > 0 {
+			if ent != nil && time.Since(ent.InstallTime) < OSPFV3_MIN_LS_ARRIVAL*time.Second &&
+				ent.Hdr.AdvRouter != rtrId {
+				continue
+			}
+			intfs := server.getOspfv3FloodIntfs(hdr.LSType, intf.IfAreaId, intf)
+			server.removeOspfv3LsaFromRetxLists(intfs, key)
+			floodedBack := server.floodOspfv3Lsa(hdr, data[:hdr.LSLen], intfs, intf, nbr)
+			server.installOspfv3Lsa(lsdb, hdr, data)
+			if hdr.AdvRouter == rtrId {
+				/* RFC 2328 13.4: reoriginate or flush our own LSA */
+				server.ospfv3GlobalConf.lsaGenPending = true
+			}
+			if !floodedBack {
+				if intf.IfFSMState != config.BackupDesignatedRouter || nbr.RtrId == intf.IfDRtrId {
+					intf.DelayedAcks = append(intf.DelayedAcks, hdr)
+				}
+			}
+			continue
+		}
+		if _, exist := nbr.RequestList[key]; exist {
+			server.resetOspfv3Nbr(intf, nbr, config.NbrExchangeStart)
+			return errors.New("Bad link state request")
+		}
+		if ret == 0 {
+			if seq, exist := nbr.RetxList[key]; exist && seq == hdr.LSSequenceNum {
+				delete(nbr.RetxList, key)
+				if intf.IfFSMState == config.BackupDesignatedRouter && nbr.RtrId == intf.IfDRtrId {
+					intf.DelayedAcks = append(intf.DelayedAcks, hdr)
+				}
+				continue
+			}
+			server.sendOspfv3Unicast(intf, nbr, LSAckType, encodeOspfv3LSAckPkt([]Ospfv3LsaHeader{hdr}))
+			continue
+		}
+		cur := ent.currentHdr()
+		if cur.LSAge >= config.MaxAge && cur.LSSequenceNum == uint32(MaxSequenceNumber) {
+			continue
+		}
+		server.sendOspfv3LSUpd(intf, nbr, [][]byte{ent.currentData()})
+	}
+	return nil
+}
+
+func (server *OSPFServer) processOspfv3LSAck(intf *Ospfv3Intf, nbr *Ospfv3Nbr, body []byte) error {
+	if nbr.State < config.NbrExchange {
+		return nil
+	}
+	hdrs, err := decodeOspfv3LSAckPkt(body)
+	if err != nil {
+		return err
+	}
+	for _, hdr := range hdrs {
+		if seq, exist := nbr.RetxList[hdr.key()]; exist && seq == hdr.LSSequenceNum {
+			delete(nbr.RetxList, hdr.key())
+		}
+	}
+	return nil
+}
+
+func (server *OSPFServer) sendOspfv3DelayedAcks(intf *Ospfv3Intf) {
+	if len(intf.DelayedAcks) == 0 {
+		return
+	}
+	maxHdrs := (int(intf.IfMtu) - IPV6_HEADER_LEN - OSPFV3_HEADER_SIZE) / OSPFV3_LSA_HEADER_SIZE
+	if maxHdrs <= 0 {
+		maxHdrs = OSPFV3_MAX_LSA_HEADERS
+	}
+	dstIp, dstMac := server.getOspfv3FloodDst(intf)
+	for len(intf.DelayedAcks) > 0 {
+		cnt := len(intf.DelayedAcks)
+		if cnt > maxHdrs {
+			cnt = maxHdrs
+		}
+		server.sendOspfv3Pkt(intf, LSAckType, encodeOspfv3LSAckPkt(intf.DelayedAcks[:cnt]), dstIp, dstMac)
+		intf.DelayedAcks = intf.DelayedAcks[cnt:]
+	}
+	intf.DelayedAcks = nil
+}
+
+/*
+@fn installOspfv3SelfLsa
+Builds, installs and floods a new instance of one of our own
+LSAs.
+*/
+func (server *OSPFServer) installOspfv3SelfLsa(lsdb Ospfv3Lsdb, key Ospfv3LsaKey, seq uint32, age uint16,
+	body []byte, areaId uint32, intf *Ospfv3Intf) {
+	hdr := Ospfv3LsaHeader{
+		LSAge:         age,
+		LSType:        key.LSType,
+		LSId:          key.LSId,
+		AdvRouter:     key.AdvRouter,
+		LSSequenceNum: seq,
+	}
+	data := buildOspfv3Lsa(hdr, body)
+	hdr = decodeOspfv3LsaHeader(data)
+	intfs := server.getOspfv3FloodIntfs(key.LSType, areaId, intf)
+	server.removeOspfv3LsaFromRetxLists(intfs, key)
+	server.installOspfv3Lsa(lsdb, hdr, data)
+	server.floodOspfv3Lsa(hdr, data, intfs, nil, nil)
+}
+
+/*
+@fn ospfv3OriginateLsa
+Originates an LSA unless the database already holds the same
+contents. New instances are rate limited by MinLSInterval.
+*/
+func (server *OSPFServer) ospfv3OriginateLsa(lsType uint16, lsId uint32, body []byte,
+	areaId uint32, intf *Ospfv3Intf) {
+	lsdb := server.getOspfv3Lsdb(lsType, areaId, intf)
+	if lsdb == nil {
+		return
+	}
+	key := Ospfv3LsaKey{
+		LSType:    lsType,
+		LSId:      lsId,
+		AdvRouter: server.ospfv3GlobalConf.RouterId,
+	}
+	seq := uint32(InitialSequenceNumber)
+	if ent, exist := lsdb[key]; exist {
+		cur := ent.currentHdr()
+		if cur.LSAge < config.MaxAge && bytes.Equal(ent.Data[OSPFV3_LSA_HEADER_SIZE:], body) {
+			return
+		}
+		if time.Since(ent.InstallTime) < OSPFV3_MIN_LS_INTERVAL*time.Second {
+			if lsType == Ospfv3InterAreaPrefixLSA || lsType == Ospfv3InterAreaRouterLSA {
+				/* summaries are originated by the SPF */
+				server.ospfv3GlobalConf.spfPending = true
+			} else {
+				server.ospfv3GlobalConf.lsaGenPending = true
+			}
+			return
+		}
+		seq = cur.LSSequenceNum + 1
+		if cur.LSSequenceNum == uint32(MaxSequenceNumber) {
+			server.ospfv3FlushLsa(lsdb, ent, areaId, intf)
+			server.ospfv3GlobalConf.lsaGenPending = true
+			return
+		}
+	}
+	server.installOspfv3SelfLsa(lsdb, key, seq, 0, body, areaId, intf)
+}
+
+/* Premature aging, RFC 2328 14.1 */
+func (server *OSPFServer) ospfv3FlushLsa(lsdb Ospfv3Lsdb, ent *Ospfv3LsaEnt, areaId uint32, intf *Ospfv3Intf) {
+	if ent.currentHdr().LSAge >= config.MaxAge && ent.MaxAgeFlood {
+		return
+	}
+	hdr := ent.Hdr
+	hdr.LSAge = config.MaxAge
+	data := make([]byte, len(ent.Data))
+	copy(data, ent.Data)
+	binary.BigEndian.PutUint16(data[0:2], config.MaxAge)
+	intfs := server.getOspfv3FloodIntfs(hdr.LSType, areaId, intf)
+	server.removeOspfv3LsaFromRetxLists(intfs, hdr.key())
+	server.installOspfv3Lsa(lsdb, hdr, data)
+	server.floodOspfv3Lsa(hdr, data, intfs, nil, nil)
+}
+
+/*
+@fn ageOspfv3Lsdb
+Refreshes our own LSAs, floods LSAs which reached MaxAge and
+removes them once they are acknowledged, RFC 2328 14.
+*/
+func (server *OSPFServer) ageOspfv3Lsdb() {
+	for _, intf := range server.Ospfv3IntfMap {
+		if intf.IfFSMState > config.Down {
+			server.ageOspfv3LsdbScope(intf.LinkLsdb, intf.IfAreaId, intf)
+		}
+	}
+	for areaId, lsdb := range server.Ospfv3AreaLsdb {
+		server.ageOspfv3LsdbScope(lsdb, areaId, nil)
+	}
+	server.ageOspfv3LsdbScope(server.Ospfv3ASLsdb, 0, nil)
+}
+
+func (server *OSPFServer) ageOspfv3LsdbScope(lsdb Ospfv3Lsdb, areaId uint32, intf *Ospfv3Intf) {
+	rtrId := server.ospfv3GlobalConf.RouterId
+	exchange := server.isOspfv3DBExchangeInProgress()
+	for key, ent := range lsdb {
+		hdr := ent.currentHdr()
+		if hdr.LSAge >= config.MaxAge {
+			if !ent.MaxAgeFlood {
+				server.ospfv3FlushLsa(lsdb, ent, areaId, intf)
+				continue
+			}
+			intfs := server.getOspfv3FloodIntfs(key.LSType, areaId, intf)
+			if !exchange && !server.isOspfv3LsaOnRetxList(intfs, key) {
+				delete(lsdb, key)
+				server.ospfv3GlobalConf.spfPending = true
+			}
+			continue
+		}
+		if key.AdvRouter == rtrId && uint32(hdr.LSAge) >= config.LSRefreshTime {
+			server.installOspfv3SelfLsa(lsdb, key, hdr.LSSequenceNum+1, 0,
+				ent.Data[OSPFV3_LSA_HEADER_SIZE:], areaId, intf)
+		}
+	}
+}
+
+func ospfv3PrefixFromIPNet(ipNet *net.IPNet) Ospfv3Prefix {
+	ones, _ := ipNet.Mask.Size()
+	return Ospfv3Prefix{
+		PrefixLen: uint8(ones),
+		Prefix:    ipNet.IP.Mask(ipNet.Mask).To16(),
+	}
+}
+
+/*
+Returns the DR and its interface id when the interface is a
+transit network: it has a DR and we are fully adjacent to it, or
+we are the DR and fully adjacent to some other router.
+*/
+func (server *OSPFServer) getOspfv3TransitDR(intf *Ospfv3Intf) (uint32, uint32, bool) {
+	if intf.IfType != config.Broadcast || intf.IfFSMState == config.Waiting || intf.IfDRtrId == 0 {
+		return 0, 0, false
+	}
+	if intf.IfFSMState == config.DesignatedRouter {
+		for _, nbr := range intf.Nbrs {
+			if nbr.State == config.NbrFull {
+				return intf.IfDRtrId, uint32(intf.IfIndex), true
+			}
+		}
+		return 0, 0, false
+	}
+	nbr, exist := intf.Nbrs[intf.IfDRtrId]
+	if exist && nbr.State == config.NbrFull {
+		return intf.IfDRtrId, nbr.IfId, true
+	}
+	return 0, 0, false
+}
+
+func (server *OSPFServer) getOspfv3ActiveAreas() map[uint32]bool {
+	areas := make(map[uint32]bool)
+	for _, intf := range server.Ospfv3IntfMap {
+		if intf.IfFSMState > config.Down {
+			areas[intf.IfAreaId] = true
+		}
+	}
+	return areas
+}
+
+/*
+@fn originateOspfv3SelfLsas
+Builds the Router, Network, Link and Intra-Area-Prefix LSAs this
+router should originate and flushes the ones it no longer does,
+RFC 5340 4.4.3. Summary LSAs are handled by the SPF.
+*/
+func (server *OSPFServer) originateOspfv3SelfLsas() {
+	rtrId := server.ospfv3GlobalConf.RouterId
+	areas := server.getOspfv3ActiveAreas()
+	server.ospfv3GlobalConf.isABR = len(areas) > 1
+	for areaId, _ := range server.Ospfv3AreaLsdb {
+		if !areas[areaId] {
+			delete(server.Ospfv3AreaLsdb, areaId)
+			server.ospfv3GlobalConf.spfPending = true
+		}
+	}
+	for areaId, _ := range areas {
+		if _, exist := server.Ospfv3AreaLsdb[areaId]; !exist {
+			server.Ospfv3AreaLsdb[areaId] = make(Ospfv3Lsdb)
+		}
+		desired := make(map[Ospfv3LsaKey]bool)
+		options := server.getOspfv3Options(areaId)
+		rtrLsa := Ospfv3RouterLsa{
+			Options: options,
+		}
+		if server.ospfv3GlobalConf.isABR {
+			rtrLsa.Flags |= Ospfv3BBit
+		}
+		rtrPrefixes := Ospfv3IntraAreaPrefixLsa{
+			RefLSType:    Ospfv3RouterLSA,
+			RefAdvRouter: rtrId,
+		}
+		for _, intf := range server.Ospfv3IntfMap {
+			if intf.IfFSMState <= config.Down || intf.IfAreaId != areaId {
+				continue
+			}
+			linkLsa := Ospfv3LinkLsa{
+				RtrPriority:   intf.IfRtrPriority,
+				Options:       options,
+				LinkLocalAddr: intf.IfLinkLocalAddr,
+			}
+			for _, ipNet := range intf.IfPrefixes {
+				linkLsa.Prefixes = append(linkLsa.Prefixes, ospfv3PrefixFromIPNet(ipNet))
+			}
+			server.ospfv3OriginateLsa(Ospfv3LinkLSA, uint32(intf.IfIndex), encodeOspfv3LinkLsa(linkLsa),
+				areaId, intf)
+			server.flushOspfv3UndesiredLsas(intf.LinkLsdb, map[Ospfv3LsaKey]bool{
+				Ospfv3LsaKey{Ospfv3LinkLSA, uint32(intf.IfIndex), rtrId}: true,
+			}, areaId, intf)
+
+			if intf.IfType != config.Broadcast {
+				for _, nbr := range intf.Nbrs {
+					if nbr.State == config.NbrFull {
+						rtrLsa.Links = append(rtrLsa.Links, Ospfv3RouterLink{
+							LinkType: Ospfv3P2PLink,
+							Metric:   intf.IfCost,
+							IfId:     uint32(intf.IfIndex),
+							NbrIfId:  nbr.IfId,
+							NbrRtrId: nbr.RtrId,
+						})
+					}
+				}
+			}
+			dRtrId, dRtrIfId, transit := server.getOspfv3TransitDR(intf)
+			if transit {
+				rtrLsa.Links = append(rtrLsa.Links, Ospfv3RouterLink{
+					LinkType: Ospfv3TransitLink,
+					Metric:   intf.IfCost,
+					IfId:     uint32(intf.IfIndex),
+					NbrIfId:  dRtrIfId,
+					NbrRtrId: dRtrId,
+				})
+				if dRtrId == rtrId {
+					server.originateOspfv3NetworkLsas(intf, options, desired)
+				}
+				continue
+			}
+			for _, prefix := range linkLsa.Prefixes {
+				prefix.Metric = intf.IfCost
+				rtrPrefixes.Prefixes = append(rtrPrefixes.Prefixes, prefix)
+			}
+		}
+		server.ospfv3OriginateLsa(Ospfv3RouterLSA, 0, encodeOspfv3RouterLsa(rtrLsa), areaId, nil)
+		desired[Ospfv3LsaKey{Ospfv3RouterLSA, 0, rtrId}] = true
+		if len(rtrPrefixes.Prefixes) > 0 {
+			server.ospfv3OriginateLsa(Ospfv3IntraAreaPrefixLSA, 0,
+				encodeOspfv3IntraAreaPrefixLsa(rtrPrefixes), areaId, nil)
+			desired[Ospfv3LsaKey{Ospfv3IntraAreaPrefixLSA, 0, rtrId}] = true
+		}
+		for key, ent := range server.Ospfv3AreaLsdb[areaId] {
+			if key.AdvRouter == rtrId && (key.LSType == Ospfv3InterAreaPrefixLSA ||
+				key.LSType == Ospfv3InterAreaRouterLSA) && ent.Hdr.LSAge < config.MaxAge {
+				desired[key] = true
+			}
+		}
+		server.flushOspfv3UndesiredLsas(server.Ospfv3AreaLsdb[areaId], desired, areaId, nil)
+	}
+}
+
+/*
+As DR, the Network-LSA lists the fully adjacent routers and its
+Intra-Area-Prefix-LSA carries the prefixes of their Link-LSAs.
+*/
+func (server *OSPFServer) originateOspfv3NetworkLsas(intf *Ospfv3Intf, options uint32,
+	desired map[Ospfv3LsaKey]bool) {
+	rtrId := server.ospfv3GlobalConf.RouterId
+	lsId := uint32(intf.IfIndex)
+	netLsa := Ospfv3NetworkLsa{
+		AttachedRtr: []uint32{rtrId},
+	}
+	for _, nbr := range intf.Nbrs {
+		if nbr.State == config.NbrFull {
+			netLsa.AttachedRtr = append(netLsa.AttachedRtr, nbr.RtrId)
+		}
+	}
+	sort.Sort(ospfv3RtrIdList(netLsa.AttachedRtr[1:]))
+	prefixes := make(map[string]Ospfv3Prefix)
+	for key, ent := range intf.LinkLsdb {
+		if key.LSType != Ospfv3LinkLSA || ent.currentHdr().LSAge >= config.MaxAge {
+			continue
+		}
+		if key.AdvRouter != rtrId {
+			nbr, exist := intf.Nbrs[key.AdvRouter]
+			if !exist || nbr.State != config.NbrFull {
+				continue
+			}
+		}
+		linkLsa, err := decodeOspfv3LinkLsa(ent.Data[OSPFV3_LSA_HEADER_SIZE:])
+		if err != nil {
+			continue
+		}
+		netLsa.Options |= linkLsa.Options
+		for _, prefix := range linkLsa.Prefixes {
+			if prefix.PrefixOptions&(Ospfv3PrefixNU|Ospfv3PrefixLA) != 0 {
+				continue
+			}
+			prefix.PrefixOptions = 0
+			prefix.Metric = 0
+			ipNet := prefix.ipNet()
+			prefixes[ipNet.String()] = prefix
+		}
+	}
+	netLsa.Options |= options
+	server.ospfv3OriginateLsa(Ospfv3NetworkLSA, lsId, encodeOspfv3NetworkLsa(netLsa), intf.IfAreaId, nil)
+	desired[Ospfv3LsaKey{Ospfv3NetworkLSA, lsId, rtrId}] = true
+	if len(prefixes) == 0 {
+		return
+	}
+	netPrefixes := Ospfv3IntraAreaPrefixLsa{
+		RefLSType:    Ospfv3NetworkLSA,
+		RefLSId:      lsId,
+		RefAdvRouter: rtrId,
+	}
+	var keys []string
+	for key, _ := range prefixes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		netPrefixes.Prefixes = append(netPrefixes.Prefixes, prefixes[key])
+	}
+	server.ospfv3OriginateLsa(Ospfv3IntraAreaPrefixLSA, lsId, encodeOspfv3IntraAreaPrefixLsa(netPrefixes),
+		intf.IfAreaId, nil)
+	desired[Ospfv3LsaKey{Ospfv3IntraAreaPrefixLSA, lsId, rtrId}] = true
+}
+
+func (server *OSPFServer) flushOspfv3UndesiredLsas(lsdb Ospfv3Lsdb, desired map[Ospfv3LsaKey]bool,
+	areaId uint32, intf *Ospfv3Intf) {
+	rtrId := server.ospfv3GlobalConf.RouterId
+	for key, ent := range lsdb {
+		if key.AdvRouter == rtrId && !desired[key] {
+			server.ospfv3FlushLsa(lsdb, ent, areaId, intf)
+		}
+	}
+}
+
+type ospfv3RtrIdList []uint32
+
+func (l ospfv3RtrIdList) Len() int           { return len(l) }
+func (l ospfv3RtrIdList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l ospfv3RtrIdList) Less(i, j int) bool { return l[i] < l[j] }
@@ -0,0 +1,375 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"l3/ospf/config"
+	"time"
+)
+
+func (server *OSPFServer) setOspfv3NbrState(intf *Ospfv3Intf, nbr *Ospfv3Nbr, state config.NbrState) {
+	if nbr.State == state {
+		return
+	}
+	server.logger.Info(fmt.Sprintln("OSPFV3: Neighbor", convertUint32ToIPv4(nbr.RtrId), "on", intf.IfName,
+		config.NbrStateList[nbr.State-1], "->", config.NbrStateList[state-1]))
+	if nbr.State == config.NbrFull || state == config.NbrFull {
+		server.ospfv3GlobalConf.lsaGenPending = true
+		server.ospfv3GlobalConf.spfPending = true
+	}
+	nbr.State = state
+	nbr.Events++
+}
+
+func (server *OSPFServer) clearOspfv3NbrLists(nbr *Ospfv3Nbr) {
+	nbr.SummaryList = nil
+	nbr.RequestList = make(map[Ospfv3LsaKey]Ospfv3LsaHeader)
+	nbr.RetxList = make(map[Ospfv3LsaKey]uint32)
+	nbr.LastTxLsr = nil
+	nbr.LastTxDD = nil
+	nbr.LastRxDD = Ospfv3DDPkt{}
+	nbr.DDRetxTimer = 0
+	nbr.LsrRetxTimer = 0
+	nbr.LsuRetxTimer = 0
+}
+
+/*
+@fn resetOspfv3Nbr
+Used for SeqNumberMismatch, BadLSReq, 1-WayReceived and AdjOK?
+events: the database exchange state is dropped and, for ExStart,
+a new exchange is started.
+*/
+func (server *OSPFServer) resetOspfv3Nbr(intf *Ospfv3Intf, nbr *Ospfv3Nbr, state config.NbrState) {
+	server.clearOspfv3NbrLists(nbr)
+	server.setOspfv3NbrState(intf, nbr, state)
+	if state == config.NbrExchangeStart {
+		server.startOspfv3DDExchange(intf, nbr)
+	}
+}
+
+func (server *OSPFServer) killOspfv3Nbr(intf *Ospfv3Intf, nbr *Ospfv3Nbr) {
+	server.clearOspfv3NbrLists(nbr)
+	server.setOspfv3NbrState(intf, nbr, config.NbrDown)
+	delete(intf.Nbrs, nbr.RtrId)
+}
+
+func (server *OSPFServer) checkOspfv3Adjacency(intf *Ospfv3Intf, nbr *Ospfv3Nbr) {
+	adj := shouldFormAdjacency(intf.IfType,
+		intf.IfFSMState == config.DesignatedRouter || intf.IfFSMState == config.BackupDesignatedRouter,
+		nbr.RtrId == intf.IfDRtrId || nbr.RtrId == intf.IfBDRtrId)
+	if nbr.State == config.NbrTwoWay && adj {
+		server.resetOspfv3Nbr(intf, nbr, config.NbrExchangeStart)
+	} else if nbr.State >= config.NbrExchangeStart && !adj {
+		server.resetOspfv3Nbr(intf, nbr, config.NbrTwoWay)
+	}
+}
+
+func (server *OSPFServer) startOspfv3DDExchange(intf *Ospfv3Intf, nbr *Ospfv3Nbr) {
+	nbr.IsMaster = false
+	if nbr.DDSeqNum == 0 {
+		nbr.DDSeqNum = uint32(time.Now().Unix())
+	} else {
+		nbr.DDSeqNum++
+	}
+	server.sendOspfv3DD(intf, nbr, Ospfv3DDIBit|Ospfv3DDMBit|Ospfv3DDMSBit)
+}
+
+/*
+@fn buildOspfv3SummaryList
+RFC 2328 10.3: MaxAge LSAs go to the retransmission list instead
+of the summary list.
+*/
+func (server *OSPFServer) buildOspfv3SummaryList(intf *Ospfv3Intf, nbr *Ospfv3Nbr) {
+	nbr.SummaryList = nil
+	lsdbs := []Ospfv3Lsdb{intf.LinkLsdb, server.Ospfv3AreaLsdb[intf.IfAreaId]}
+	if !server.isOspfv3StubArea(intf.IfAreaId) {
+		lsdbs = append(lsdbs, server.Ospfv3ASLsdb)
+	}
+	for _, lsdb := range lsdbs {
+		for key, ent := range lsdb {
+			hdr := ent.currentHdr()
+			if hdr.LSAge >= config.MaxAge {
+				nbr.RetxList[key] = hdr.LSSequenceNum
+				continue
+			}
+			nbr.SummaryList = append(nbr.SummaryList, hdr)
+		}
+	}
+}
+
+func (server *OSPFServer) sendOspfv3DD(intf *Ospfv3Intf, nbr *Ospfv3Nbr, flags uint8) {
+	dd := Ospfv3DDPkt{
+		Options: server.getOspfv3Options(intf.IfAreaId),
+		Mtu:     uint16(intf.IfMtu),
+		Flags:   flags,
+		SeqNum:  nbr.DDSeqNum,
+	}
+	if flags&Ospfv3DDIBit == 0 {
+		maxHdrs := (int(intf.IfMtu) - IPV6_HEADER_LEN - OSPFV3_HEADER_SIZE - OSPFV3_DBD_MIN_SIZE) /
+			OSPFV3_LSA_HEADER_SIZE
+		if maxHdrs > OSPFV3_MAX_LSA_HEADERS || maxHdrs <= 0 {
+			maxHdrs = OSPFV3_MAX_LSA_HEADERS
+		}
+		if maxHdrs > len(nbr.SummaryList) {
+			maxHdrs = len(nbr.SummaryList)
+		}
+		dd.LsaHdrs = nbr.SummaryList[:maxHdrs]
+		nbr.SummaryList = nbr.SummaryList[maxHdrs:]
+		if len(nbr.SummaryList) > 0 {
+			dd.Flags |= Ospfv3DDMBit
+		}
+	}
+	nbr.LastTxDD = encodeOspfv3DDPkt(dd)
+	nbr.DDRetxTimer = int(intf.IfRetransInterval)
+	server.sendOspfv3Unicast(intf, nbr, DBDescriptionType, nbr.LastTxDD)
+}
+
+func isOspfv3DDDuplicate(dd Ospfv3DDPkt, last Ospfv3DDPkt) bool {
+	return dd.Flags == last.Flags && dd.Options == last.Options && dd.SeqNum == last.SeqNum
+}
+
+/*
+@fn processOspfv3DD
+RFC 2328 10.6 and 10.8.
+*/
+func (server *OSPFServer) processOspfv3DD(intf *Ospfv3Intf, nbr *Ospfv3Nbr, body []byte) error {
+	dd, err := decodeOspfv3DDPkt(body)
+	if err != nil {
+		return err
+	}
+	if int32(dd.Mtu) > intf.IfMtu {
+		return errors.New("Neighbor MTU is larger than interface MTU")
+	}
+	switch nbr.State {
+	case config.NbrDown, config.NbrTwoWay:
+		return nil
+	case config.NbrInit:
+		server.setOspfv3NbrState(intf, nbr, config.NbrTwoWay)
+		server.checkOspfv3Adjacency(intf, nbr)
+		if nbr.State != config.NbrExchangeStart {
+			return nil
+		}
+	}
+	myRtrId := server.ospfv3GlobalConf.RouterId
+	switch nbr.State {
+	case config.NbrExchangeStart:
+		initFlags := uint8(Ospfv3DDIBit | Ospfv3DDMBit | Ospfv3DDMSBit)
+		if dd.Flags&initFlags == initFlags && len(dd.LsaHdrs) == 0 && nbr.RtrId > myRtrId {
+			nbr.IsMaster = true
+			nbr.DDSeqNum = dd.SeqNum
+		} else if dd.Flags&(Ospfv3DDIBit|Ospfv3DDMSBit) == 0 &&
+			dd.SeqNum == nbr.DDSeqNum && nbr.RtrId < myRtrId {
+			nbr.IsMaster = false
+		} else {
+			return nil
+		}
+		server.setOspfv3NbrState(intf, nbr, config.NbrExchange)
+		server.buildOspfv3SummaryList(intf, nbr)
+		nbr.LastRxDD = Ospfv3DDPkt{}
+		if nbr.IsMaster {
+			nbr.LastRxDD = dd
+			nbr.LastRxDD.LsaHdrs = nil
+			server.sendOspfv3DD(intf, nbr, 0)
+			return nil
+		}
+		return server.processOspfv3DDExchange(intf, nbr, dd)
+	case config.NbrExchange:
+		if isOspfv3DDDuplicate(dd, nbr.LastRxDD) {
+			if nbr.IsMaster {
+				server.sendOspfv3Unicast(intf, nbr, DBDescriptionType, nbr.LastTxDD)
+			}
+			return nil
+		}
+		expectedSeqNum := nbr.DDSeqNum
+		if nbr.IsMaster {
+			expectedSeqNum++
+		}
+		err = checkDDSequence(nbr.IsMaster, dd.Flags&Ospfv3DDMSBit != 0, dd.Flags&Ospfv3DDIBit != 0,
+			dd.SeqNum, expectedSeqNum)
+		if err == nil && nbr.LastRxDD.SeqNum != 0 && dd.Options != nbr.LastRxDD.Options {
+			err = errors.New("SeqNumberMismatch. Options changed")
+		}
+		if err != nil {
+			server.resetOspfv3Nbr(intf, nbr, config.NbrExchangeStart)
+			return err
+		}
+		return server.processOspfv3DDExchange(intf, nbr, dd)
+	case config.NbrLoading, config.NbrFull:
+		if isOspfv3DDDuplicate(dd, nbr.LastRxDD) {
+			if nbr.IsMaster {
+				server.sendOspfv3Unicast(intf, nbr, DBDescriptionType, nbr.LastTxDD)
+			}
+			return nil
+		}
+		server.resetOspfv3Nbr(intf, nbr, config.NbrExchangeStart)
+		return errors.New("Unexpected database description")
+	}
+	return nil
+}
+
+/* The sequence number of dd was checked by the caller */
+func (server *OSPFServer) processOspfv3DDExchange(intf *Ospfv3Intf, nbr *Ospfv3Nbr, dd Ospfv3DDPkt) error {
+	stub := server.isOspfv3StubArea(intf.IfAreaId)
+	for _, hdr := range dd.LsaHdrs {
+		if getOspfv3LsaScope(hdr.LSType) == Ospfv3ASScope && stub {
+			server.resetOspfv3Nbr(intf, nbr, config.NbrExchangeStart)
+			return errors.New("AS scope LSA in stub area")
+		}
+		ent := server.lookupOspfv3Lsa(intf, hdr.key())
+		if ent == nil || compareOspfv3Lsa(hdr, ent.currentHdr()) > 0 {
+			nbr.RequestList[hdr.key()] = hdr
+		}
+	}
+	nbr.LastRxDD = dd
+	nbr.LastRxDD.LsaHdrs = nil
+	if nbr.IsMaster {
+		nbr.DDSeqNum = dd.SeqNum
+		server.sendOspfv3DD(intf, nbr, 0)
+		if dd.Flags&Ospfv3DDMBit == 0 && nbr.LastTxDD[7]&Ospfv3DDMBit == 0 {
+			server.ospfv3ExchangeDone(intf, nbr)
+		}
+	} else {
+		nbr.DDSeqNum++
+		if dd.Flags&Ospfv3DDMBit == 0 && nbr.LastTxDD[7]&Ospfv3DDMBit == 0 {
+			nbr.DDRetxTimer = 0
+			server.ospfv3ExchangeDone(intf, nbr)
+		} else {
+			server.sendOspfv3DD(intf, nbr, Ospfv3DDMSBit)
+		}
+	}
+	if nbr.State >= config.NbrExchange && len(nbr.LastTxLsr) == 0 {
+		server.sendOspfv3LSReq(intf, nbr)
+	}
+	return nil
+}
+
+func (server *OSPFServer) ospfv3ExchangeDone(intf *Ospfv3Intf, nbr *Ospfv3Nbr) {
+	if len(nbr.RequestList) == 0 {
+		server.setOspfv3NbrState(intf, nbr, config.NbrFull)
+		return
+	}
+	server.setOspfv3NbrState(intf, nbr, config.NbrLoading)
+}
+
+func (server *OSPFServer) sendOspfv3LSReq(intf *Ospfv3Intf, nbr *Ospfv3Nbr) {
+	nbr.LastTxLsr = nil
+	for key, _ := range nbr.RequestList {
+		if len(nbr.LastTxLsr) >= OSPFV3_MAX_LSA_REQ {
+			break
+		}
+		nbr.LastTxLsr = append(nbr.LastTxLsr, key)
+	}
+	if len(nbr.LastTxLsr) == 0 {
+		nbr.LsrRetxTimer = 0
+		return
+	}
+	nbr.LsrRetxTimer = int(intf.IfRetransInterval)
+	server.sendOspfv3Unicast(intf, nbr, LSRequestType, encodeOspfv3LSAReqPkt(nbr.LastTxLsr))
+}
+
+/*
+@fn ospfv3RequestSatisfied
+Called when an LSA on the request list was received. The next
+request goes out once the previous one is fully answered.
+*/
+func (server *OSPFServer) ospfv3RequestSatisfied(intf *Ospfv3Intf, nbr *Ospfv3Nbr, key Ospfv3LsaKey) {
+	if _, exist := nbr.RequestList[key]; !exist {
+		return
+	}
+	delete(nbr.RequestList, key)
+	if len(nbr.RequestList) == 0 {
+		nbr.LastTxLsr = nil
+		nbr.LsrRetxTimer = 0
+		if nbr.State == config.NbrLoading {
+			server.setOspfv3NbrState(intf, nbr, config.NbrFull)
+		}
+		return
+	}
+	for _, k := range nbr.LastTxLsr {
+		if _, exist := nbr.RequestList[k]; exist {
+			return
+		}
+	}
+	server.sendOspfv3LSReq(intf, nbr)
+}
+
+/* RFC 2328 10.7 */
+func (server *OSPFServer) processOspfv3LSReq(intf *Ospfv3Intf, nbr *Ospfv3Nbr, body []byte) error {
+	if nbr.State < config.NbrExchange {
+		return nil
+	}
+	keys, err := decodeOspfv3LSAReqPkt(body)
+	if err != nil {
+		return err
+	}
+	var lsas [][]byte
+	for _, key := range keys {
+		ent := server.lookupOspfv3Lsa(intf, key)
+		if ent == nil {
+			server.resetOspfv3Nbr(intf, nbr, config.NbrExchangeStart)
+			return errors.New("Bad link state request")
+		}
+		lsas = append(lsas, ent.currentData())
+	}
+	server.sendOspfv3LSUpd(intf, nbr, lsas)
+	return nil
+}
+
+/*
+@fn processOspfv3NbrTimers
+Inactivity timer and the retransmission of DD, LSR and LSU
+packets, RFC 2328 10.2 and 13.6.
+*/
+func (server *OSPFServer) processOspfv3NbrTimers(intf *Ospfv3Intf, nbr *Ospfv3Nbr) {
+	nbr.DeadTimer--
+	if nbr.DeadTimer <= 0 {
+		server.logger.Info(fmt.Sprintln("OSPFV3: Neighbor", convertUint32ToIPv4(nbr.RtrId), "dead on",
+			intf.IfName))
+		server.killOspfv3Nbr(intf, nbr)
+		server.ospfv3NbrChange(intf)
+		return
+	}
+	if nbr.DDRetxTimer > 0 {
+		nbr.DDRetxTimer--
+		if nbr.DDRetxTimer == 0 && nbr.LastTxDD != nil && !nbr.IsMaster &&
+			(nbr.State == config.NbrExchangeStart || nbr.State == config.NbrExchange) {
+			server.sendOspfv3Unicast(intf, nbr, DBDescriptionType, nbr.LastTxDD)
+			nbr.DDRetxTimer = int(intf.IfRetransInterval)
+		}
+	}
+	if nbr.LsrRetxTimer > 0 {
+		nbr.LsrRetxTimer--
+		if nbr.LsrRetxTimer == 0 && nbr.State >= config.NbrExchange {
+			server.sendOspfv3LSReq(intf, nbr)
+		}
+	}
+	if len(nbr.RetxList) > 0 && nbr.State >= config.NbrExchange {
+		nbr.LsuRetxTimer--
+		if nbr.LsuRetxTimer <= 0 {
+			server.retransmitOspfv3Lsas(intf, nbr)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"l3/ospf/config"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	v3TestOtherRtrId   = uint32(0x04040404)
+	v3TestOtherIfIndex = int32(11)
+)
+
+func initOspfv3NbrTestIntf(ifIndex int32) *Ospfv3Intf {
+	intf := &Ospfv3Intf{
+		IfIndex:           ifIndex,
+		IfName:            "fpPort" + convertUint32ToIPv4(uint32(ifIndex)),
+		IfMtu:             1500,
+		IfType:            config.NumberedP2P,
+		IfFSMState:        config.P2P,
+		IfCost:            10,
+		IfTransitDelay:    1,
+		IfRetransInterval: 5,
+		IfHelloInterval:   10,
+		IfRtrDeadInterval: 40,
+		IfLinkLocalAddr:   net.ParseIP("fe80::1"),
+		IfPrefixes:        make(map[string]*net.IPNet),
+		Nbrs:              make(map[uint32]*Ospfv3Nbr),
+		LinkLsdb:          make(Ospfv3Lsdb),
+	}
+	ospf.Ospfv3IntfMap[ifIndex] = intf
+	return intf
+}
+
+func initOspfv3NbrTestParams() *Ospfv3Intf {
+	ospf = getServerObject()
+	ospf.ospfv3GlobalConf.RouterId = v3TestRtrId
+	ospf.ospfv3GlobalConf.AdminStat = config.Enabled
+	ospf.Ospfv3AreaLsdb = make(map[uint32]Ospfv3Lsdb)
+	ospf.Ospfv3AreaLsdb[0] = make(Ospfv3Lsdb)
+	ospf.Ospfv3ASLsdb = make(Ospfv3Lsdb)
+	return initOspfv3NbrTestIntf(v3TestIfIndex)
+}
+
+/* A neighbor which already completed the database exchange */
+func addOspfv3FullTestNbr(intf *Ospfv3Intf, rtrId uint32) *Ospfv3Nbr {
+	nbr := &Ospfv3Nbr{
+		RtrId:       rtrId,
+		Addr:        net.ParseIP("fe80::2"),
+		State:       config.NbrFull,
+		DeadTimer:   int(intf.IfRtrDeadInterval),
+		RequestList: make(map[Ospfv3LsaKey]Ospfv3LsaHeader),
+		RetxList:    make(map[Ospfv3LsaKey]uint32),
+	}
+	intf.Nbrs[rtrId] = nbr
+	return nbr
+}
+
+func getOspfv3TestRouterLsa(advRtr uint32, seq uint32, metric uint16) []byte {
+	hdr := Ospfv3LsaHeader{
+		LSType:        Ospfv3RouterLSA,
+		AdvRouter:     advRtr,
+		LSSequenceNum: seq,
+	}
+	return buildOspfv3Lsa(hdr, encodeOspfv3RouterLsa(Ospfv3RouterLsa{
+		Options: Ospfv3V6Option | Ospfv3ROption,
+		Links: []Ospfv3RouterLink{
+			{Ospfv3P2PLink, metric, v3TestNbrIfId, uint32(v3TestIfIndex), v3TestRtrId},
+		},
+	}))
+}
+
+func getOspfv3TestHello(intf *Ospfv3Intf, nbrs []uint32) []byte {
+	return encodeOspfv3HelloPkt(Ospfv3HelloPkt{
+		IfId:            v3TestNbrIfId,
+		RtrPriority:     1,
+		Options:         ospf.getOspfv3Options(intf.IfAreaId),
+		HelloInterval:   intf.IfHelloInterval,
+		RtrDeadInterval: intf.IfRtrDeadInterval,
+		Nbrs:            nbrs,
+	})
+}
+
+func TestOspfv3NbrAdjacency(t *testing.T) {
+	intf := initOspfv3NbrTestParams()
+	addOspfv3TestLsa(ospf.Ospfv3AreaLsdb[0], Ospfv3RouterLSA, 0, v3TestRtrId,
+		encodeOspfv3RouterLsa(Ospfv3RouterLsa{Options: Ospfv3V6Option | Ospfv3ROption}))
+	hdr := Ospfv3Header{
+		pktType:  HelloType,
+		routerId: v3TestNbrRtrId,
+	}
+	msg := ospfv3RxPktMsg{
+		ifIndex: v3TestIfIndex,
+		srcIp:   net.ParseIP("fe80::2"),
+	}
+
+	badHello, _ := decodeOspfv3HelloPkt(getOspfv3TestHello(intf, nil))
+	badHello.RtrDeadInterval = 30
+	if ospf.processOspfv3Hello(intf, hdr, msg, encodeOspfv3HelloPkt(badHello)) == nil {
+		t.Error("Hello with a different dead interval accepted")
+	}
+	ospf.processOspfv3Hello(intf, hdr, msg, getOspfv3TestHello(intf, nil))
+	nbr := intf.Nbrs[v3TestNbrRtrId]
+	if nbr == nil || nbr.State != config.NbrInit {
+		t.Fatal("Neighbor not in Init after one way hello", nbr)
+	}
+	ospf.processOspfv3Hello(intf, hdr, msg, getOspfv3TestHello(intf, []uint32{v3TestRtrId}))
+	if nbr.State != config.NbrExchangeStart || nbr.LastTxDD == nil || nbr.DDSeqNum == 0 {
+		t.Fatal("Adjacency not started on point-to-point link", nbr.State)
+	}
+
+	/* The neighbor has the higher router id and becomes master */
+	masterSeq := uint32(1000)
+	err := ospf.processOspfv3DD(intf, nbr, encodeOspfv3DDPkt(Ospfv3DDPkt{
+		Options: ospf.getOspfv3Options(0),
+		Mtu:     1500,
+		Flags:   Ospfv3DDIBit | Ospfv3DDMBit | Ospfv3DDMSBit,
+		SeqNum:  masterSeq,
+	}))
+	if err != nil || nbr.State != config.NbrExchange || !nbr.IsMaster || nbr.DDSeqNum != masterSeq {
+		t.Fatal("Negotiation as slave failed", nbr.State, nbr.IsMaster, nbr.DDSeqNum, err)
+	}
+	if len(nbr.SummaryList) != 0 {
+		t.Error("Database summary not sent", nbr.SummaryList)
+	}
+
+	nbrLsa := getOspfv3TestRouterLsa(v3TestNbrRtrId, uint32(InitialSequenceNumber), 10)
+	nbrHdr := decodeOspfv3LsaHeader(nbrLsa)
+	dd := Ospfv3DDPkt{
+		Options: ospf.getOspfv3Options(0),
+		Mtu:     1500,
+		Flags:   Ospfv3DDMSBit,
+		SeqNum:  masterSeq + 2,
+		LsaHdrs: []Ospfv3LsaHeader{nbrHdr},
+	}
+	if ospf.processOspfv3DD(intf, nbr, encodeOspfv3DDPkt(dd)) == nil ||
+		nbr.State != config.NbrExchangeStart {
+		t.Fatal("Unexpected DD sequence number accepted", nbr.State)
+	}
+
+	/* Restart the exchange, then the master describes its database */
+	ospf.processOspfv3DD(intf, nbr, encodeOspfv3DDPkt(Ospfv3DDPkt{
+		Options: ospf.getOspfv3Options(0),
+		Mtu:     1500,
+		Flags:   Ospfv3DDIBit | Ospfv3DDMBit | Ospfv3DDMSBit,
+		SeqNum:  masterSeq,
+	}))
+	dd.SeqNum = masterSeq + 1
+	err = ospf.processOspfv3DD(intf, nbr, encodeOspfv3DDPkt(dd))
+	if err != nil || nbr.State != config.NbrLoading {
+		t.Fatal("Exchange not done", nbr.State, err)
+	}
+	if _, exist := nbr.RequestList[nbrHdr.key()]; !exist || len(nbr.LastTxLsr) != 1 {
+		t.Error("Neighbor LSA not requested", nbr.RequestList, nbr.LastTxLsr)
+	}
+	/* Duplicate from the master is answered and ignored */
+	if ospf.processOspfv3DD(intf, nbr, encodeOspfv3DDPkt(dd)) != nil || nbr.State != config.NbrLoading {
+		t.Error("Duplicate DD not ignored", nbr.State)
+	}
+
+	err = ospf.processOspfv3LSUpd(intf, nbr, encodeOspfv3LSUpdPkt([][]byte{nbrLsa}))
+	if err != nil || nbr.State != config.NbrFull {
+		t.Fatal("Neighbor not full after the requested LSA was received", nbr.State, err)
+	}
+	if _, exist := ospf.Ospfv3AreaLsdb[0][nbrHdr.key()]; !exist {
+		t.Error("Requested LSA not installed")
+	}
+	if len(intf.DelayedAcks) != 1 || intf.DelayedAcks[0].key() != nbrHdr.key() {
+		t.Error("Received LSA not acknowledged", intf.DelayedAcks)
+	}
+	if len(nbr.RetxList) != 0 {
+		t.Error("LSA flooded back to the sending neighbor", nbr.RetxList)
+	}
+
+	ospf.processOspfv3Hello(intf, hdr, msg, getOspfv3TestHello(intf, nil))
+	if nbr.State != config.NbrInit || len(nbr.RequestList) != 0 {
+		t.Error("Adjacency not torn down by one way hello", nbr.State)
+	}
+	nbr.DeadTimer = 1
+	ospf.processOspfv3NbrTimers(intf, nbr)
+	if _, exist := intf.Nbrs[v3TestNbrRtrId]; exist {
+		t.Error("Neighbor not removed when the dead timer expired")
+	}
+}
+
+func TestOspfv3Flooding(t *testing.T) {
+	intf := initOspfv3NbrTestParams()
+	otherIntf := initOspfv3NbrTestIntf(v3TestOtherIfIndex)
+	nbr := addOspfv3FullTestNbr(intf, v3TestNbrRtrId)
+	otherNbr := addOspfv3FullTestNbr(otherIntf, v3TestOtherRtrId)
+
+	lsa := getOspfv3TestRouterLsa(v3TestNbrRtrId, uint32(InitialSequenceNumber)+1, 10)
+	hdr := decodeOspfv3LsaHeader(lsa)
+	key := hdr.key()
+	ospf.processOspfv3LSUpd(intf, nbr, encodeOspfv3LSUpdPkt([][]byte{lsa}))
+	ent, exist := ospf.Ospfv3AreaLsdb[0][key]
+	if !exist || ent.Hdr.LSSequenceNum != hdr.LSSequenceNum {
+		t.Fatal("LSA not installed")
+	}
+	if seq, exist := otherNbr.RetxList[key]; !exist || seq != hdr.LSSequenceNum ||
+		otherNbr.LsuRetxTimer != int(otherIntf.IfRetransInterval) {
+		t.Error("LSA not flooded to the other neighbor", otherNbr.RetxList)
+	}
+	if _, exist := nbr.RetxList[key]; exist {
+		t.Error("LSA flooded back to the sending neighbor")
+	}
+
+	/* Older and same instances do not replace the database copy */
+	older := getOspfv3TestRouterLsa(v3TestNbrRtrId, uint32(InitialSequenceNumber), 20)
+	ospf.processOspfv3LSUpd(intf, nbr, encodeOspfv3LSUpdPkt([][]byte{older}))
+	if ospf.Ospfv3AreaLsdb[0][key].Hdr.LSSequenceNum != hdr.LSSequenceNum {
+		t.Error("Older LSA instance installed")
+	}
+	/* A copy from the neighbor is an implied acknowledgment */
+	ospf.processOspfv3LSUpd(otherIntf, otherNbr, encodeOspfv3LSUpdPkt([][]byte{lsa}))
+	if _, exist := otherNbr.RetxList[key]; exist {
+		t.Error("Implied acknowledgment not processed")
+	}
+
+	/* Retransmission until acknowledged */
+	otherNbr.RetxList[key] = hdr.LSSequenceNum
+	otherNbr.LsuRetxTimer = 1
+	ospf.processOspfv3NbrTimers(otherIntf, otherNbr)
+	if otherNbr.LsuRetxTimer != int(otherIntf.IfRetransInterval) || len(otherNbr.RetxList) != 1 {
+		t.Error("LSA not retransmitted", otherNbr.LsuRetxTimer, otherNbr.RetxList)
+	}
+	staleHdr := hdr
+	staleHdr.LSSequenceNum--
+	ospf.processOspfv3LSAck(otherIntf, otherNbr, encodeOspfv3LSAckPkt([]Ospfv3LsaHeader{staleHdr}))
+	if len(otherNbr.RetxList) != 1 {
+		t.Error("Acknowledgment of another instance accepted")
+	}
+	ospf.processOspfv3LSAck(otherIntf, otherNbr, encodeOspfv3LSAckPkt([]Ospfv3LsaHeader{hdr}))
+	if len(otherNbr.RetxList) != 0 {
+		t.Error("Acknowledged LSA still on the retransmission list")
+	}
+
+	/* MaxAge LSAs are flooded and removed once acknowledged */
+	ent = ospf.Ospfv3AreaLsdb[0][key]
+	ent.InstallTime = time.Now().Add(-time.Duration(config.MaxAge) * time.Second)
+	ospf.ageOspfv3Lsdb()
+	ent = ospf.Ospfv3AreaLsdb[0][key]
+	if ent == nil || !ent.MaxAgeFlood || ent.currentHdr().LSAge != config.MaxAge {
+		t.Fatal("MaxAge LSA not flushed", ent)
+	}
+	if _, exist := otherNbr.RetxList[key]; !exist {
+		t.Error("MaxAge LSA not flooded")
+	}
+	ospf.ageOspfv3Lsdb()
+	if _, exist := ospf.Ospfv3AreaLsdb[0][key]; !exist {
+		t.Error("MaxAge LSA removed before it was acknowledged")
+	}
+	for _, n := range []*Ospfv3Nbr{nbr, otherNbr} {
+		n.RetxList = make(map[Ospfv3LsaKey]uint32)
+	}
+	ospf.ageOspfv3Lsdb()
+	if _, exist := ospf.Ospfv3AreaLsdb[0][key]; exist {
+		t.Error("Acknowledged MaxAge LSA not removed")
+	}
+}
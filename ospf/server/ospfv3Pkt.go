@@ -0,0 +1,453 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"l3/ospf/config"
+	"net"
+	"time"
+)
+
+/*
+    0                   1                   2                   3
+    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |   Version #   |     Type      |         Packet length         |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                         Router ID                             |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                          Area ID                              |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |          Checksum             |  Instance ID  |      0        |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+type Ospfv3Header struct {
+	pktType    OspfType
+	pktLen     uint16
+	routerId   uint32
+	areaId     uint32
+	checksum   uint16
+	instanceId uint8
+}
+
+type Ospfv3HelloPkt struct {
+	IfId            uint32
+	RtrPriority     uint8
+	Options         uint32
+	HelloInterval   uint16
+	RtrDeadInterval uint16
+	DRtrId          uint32
+	BDRtrId         uint32
+	Nbrs            []uint32
+}
+
+/* Database description flags */
+const (
+	Ospfv3DDMSBit = 0x01
+	Ospfv3DDMBit  = 0x02
+	Ospfv3DDIBit  = 0x04
+)
+
+type Ospfv3DDPkt struct {
+	Options uint32
+	Mtu     uint16
+	Flags   uint8
+	SeqNum  uint32
+	LsaHdrs []Ospfv3LsaHeader
+}
+
+func encodeOspfv3Header(hdr Ospfv3Header) []byte {
+	data := make([]byte, OSPFV3_HEADER_SIZE)
+	data[0] = OSPF_VERSION_3
+	data[1] = uint8(hdr.pktType)
+	binary.BigEndian.PutUint16(data[2:4], hdr.pktLen)
+	binary.BigEndian.PutUint32(data[4:8], hdr.routerId)
+	binary.BigEndian.PutUint32(data[8:12], hdr.areaId)
+	binary.BigEndian.PutUint16(data[12:14], hdr.checksum)
+	data[14] = hdr.instanceId
+	return data
+}
+
+func decodeOspfv3Header(data []byte) (hdr Ospfv3Header, err error) {
+	if len(data) < OSPFV3_HEADER_SIZE {
+		return hdr, errors.New("Truncated OSPFv3 header")
+	}
+	if data[0] != OSPF_VERSION_3 {
+		return hdr, errors.New("Invalid OSPF version")
+	}
+	hdr.pktType = OspfType(data[1])
+	hdr.pktLen = binary.BigEndian.Uint16(data[2:4])
+	hdr.routerId = binary.BigEndian.Uint32(data[4:8])
+	hdr.areaId = binary.BigEndian.Uint32(data[8:12])
+	hdr.checksum = binary.BigEndian.Uint16(data[12:14])
+	hdr.instanceId = data[14]
+	if int(hdr.pktLen) < OSPFV3_HEADER_SIZE || int(hdr.pktLen) > len(data) {
+		return hdr, errors.New("Invalid OSPFv3 packet length")
+	}
+	return hdr, nil
+}
+
+func encodeOspfv3HelloPkt(hello Ospfv3HelloPkt) []byte {
+	data := make([]byte, OSPFV3_HELLO_MIN_SIZE+4*len(hello.Nbrs))
+	binary.BigEndian.PutUint32(data[0:4], hello.IfId)
+	data[4] = hello.RtrPriority
+	putUint24(data[5:8], hello.Options)
+	binary.BigEndian.PutUint16(data[8:10], hello.HelloInterval)
+	binary.BigEndian.PutUint16(data[10:12], hello.RtrDeadInterval)
+	binary.BigEndian.PutUint32(data[12:16], hello.DRtrId)
+	binary.BigEndian.PutUint32(data[16:20], hello.BDRtrId)
+	for i, nbr := range hello.Nbrs {
+		off := OSPFV3_HELLO_MIN_SIZE + 4*i
+		binary.BigEndian.PutUint32(data[off:off+4], nbr)
+	}
+	return data
+}
+
+func decodeOspfv3HelloPkt(data []byte) (hello Ospfv3HelloPkt, err error) {
+	if len(data) < OSPFV3_HELLO_MIN_SIZE || (len(data)-OSPFV3_HELLO_MIN_SIZE)%4 != 0 {
+		return hello, errors.New("Invalid hello length")
+	}
+	hello.IfId = binary.BigEndian.Uint32(data[0:4])
+	hello.RtrPriority = data[4]
+	hello.Options = getUint24(data[5:8])
+	hello.HelloInterval = binary.BigEndian.Uint16(data[8:10])
+	hello.RtrDeadInterval = binary.BigEndian.Uint16(data[10:12])
+	hello.DRtrId = binary.BigEndian.Uint32(data[12:16])
+	hello.BDRtrId = binary.BigEndian.Uint32(data[16:20])
+	for off := OSPFV3_HELLO_MIN_SIZE; off < len(data); off += 4 {
+		hello.Nbrs = append(hello.Nbrs, binary.BigEndian.Uint32(data[off:off+4]))
+	}
+	return hello, nil
+}
+
+func encodeOspfv3DDPkt(dd Ospfv3DDPkt) []byte {
+	data := make([]byte, OSPFV3_DBD_MIN_SIZE)
+	putUint24(data[1:4], dd.Options)
+	binary.BigEndian.PutUint16(data[4:6], dd.Mtu)
+	data[7] = dd.Flags
+	binary.BigEndian.PutUint32(data[8:12], dd.SeqNum)
+	for _, hdr := range dd.LsaHdrs {
+		data = append(data, encodeOspfv3LsaHeader(hdr)...)
+	}
+	return data
+}
+
+func decodeOspfv3DDPkt(data []byte) (dd Ospfv3DDPkt, err error) {
+	if len(data) < OSPFV3_DBD_MIN_SIZE ||
+		(len(data)-OSPFV3_DBD_MIN_SIZE)%OSPFV3_LSA_HEADER_SIZE != 0 {
+		return dd, errors.New("Invalid database description length")
+	}
+	dd.Options = getUint24(data[1:4])
+	dd.Mtu = binary.BigEndian.Uint16(data[4:6])
+	dd.Flags = data[7]
+	dd.SeqNum = binary.BigEndian.Uint32(data[8:12])
+	for off := OSPFV3_DBD_MIN_SIZE; off < len(data); off += OSPFV3_LSA_HEADER_SIZE {
+		dd.LsaHdrs = append(dd.LsaHdrs, decodeOspfv3LsaHeader(data[off:off+OSPFV3_LSA_HEADER_SIZE]))
+	}
+	return dd, nil
+}
+
+func encodeOspfv3LSAReqPkt(keys []Ospfv3LsaKey) []byte {
+	data := make([]byte, OSPFV3_LSA_REQ_SIZE*len(keys))
+	for i, key := range keys {
+		off := OSPFV3_LSA_REQ_SIZE * i
+		binary.BigEndian.PutUint16(data[off+2:off+4], key.LSType)
+		binary.BigEndian.PutUint32(data[off+4:off+8], key.LSId)
+		binary.BigEndian.PutUint32(data[off+8:off+12], key.AdvRouter)
+	}
+	return data
+}
+
+func decodeOspfv3LSAReqPkt(data []byte) (keys []Ospfv3LsaKey, err error) {
+	if len(data)%OSPFV3_LSA_REQ_SIZE != 0 {
+		return nil, errors.New("Invalid link state request length")
+	}
+	for off := 0; off < len(data); off += OSPFV3_LSA_REQ_SIZE {
+		keys = append(keys, Ospfv3LsaKey{
+			LSType:    binary.BigEndian.Uint16(data[off+2 : off+4]),
+			LSId:      binary.BigEndian.Uint32(data[off+4 : off+8]),
+			AdvRouter: binary.BigEndian.Uint32(data[off+8 : off+12]),
+		})
+	}
+	return keys, nil
+}
+
+func encodeOspfv3LSUpdPkt(lsas [][]byte) []byte {
+	data := make([]byte, OSPFV3_LSU_MIN_SIZE)
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(lsas)))
+	for _, lsa := range lsas {
+		data = append(data, lsa...)
+	}
+	return data
+}
+
+func decodeOspfv3LSUpdPkt(data []byte) (lsas [][]byte, err error) {
+	if len(data) < OSPFV3_LSU_MIN_SIZE {
+		return nil, errors.New("Invalid link state update length")
+	}
+	numLsa := binary.BigEndian.Uint32(data[0:4])
+	off := OSPFV3_LSU_MIN_SIZE
+	for i := uint32(0); i < numLsa; i++ {
+		if len(data) < off+OSPFV3_LSA_HEADER_SIZE {
+			return lsas, errors.New("Truncated link state update")
+		}
+		lsaLen := int(binary.BigEndian.Uint16(data[off+18 : off+20]))
+		if lsaLen < OSPFV3_LSA_HEADER_SIZE || len(data) < off+lsaLen {
+			return lsas, errors.New("Invalid LSA length in link state update")
+		}
+		lsas = append(lsas, data[off:off+lsaLen])
+		off += lsaLen
+	}
+	return lsas, nil
+}
+
+func encodeOspfv3LSAckPkt(hdrs []Ospfv3LsaHeader) []byte {
+	var data []byte
+	for _, hdr := range hdrs {
+		data = append(data, encodeOspfv3LsaHeader(hdr)...)
+	}
+	return data
+}
+
+func decodeOspfv3LSAckPkt(data []byte) (hdrs []Ospfv3LsaHeader, err error) {
+	if len(data)%OSPFV3_LSA_HEADER_SIZE != 0 {
+		return nil, errors.New("Invalid link state ack length")
+	}
+	for off := 0; off < len(data); off += OSPFV3_LSA_HEADER_SIZE {
+		hdrs = append(hdrs, decodeOspfv3LsaHeader(data[off:off+OSPFV3_LSA_HEADER_SIZE]))
+	}
+	return hdrs, nil
+}
+
+/*
+@fn buildOspfv3Pkt
+Adds the OSPFv3 header with the pseudo header checksum and the
+IPv6 and Ethernet headers. OSPFv3 has no authentication of its
+own and relies on IPv6.
+*/
+func (server *OSPFServer) buildOspfv3Pkt(intf *Ospfv3Intf, pktType OspfType, body []byte,
+	dstIp net.IP, dstMac net.HardwareAddr) []byte {
+	hdr := Ospfv3Header{
+		pktType:    pktType,
+		pktLen:     uint16(OSPFV3_HEADER_SIZE + len(body)),
+		routerId:   server.ospfv3GlobalConf.RouterId,
+		areaId:     intf.IfAreaId,
+		instanceId: intf.IfInstanceId,
+	}
+	ospf := append(encodeOspfv3Header(hdr), body...)
+	checksum := computeOspfv3Checksum(intf.IfLinkLocalAddr, dstIp, ospf)
+	binary.BigEndian.PutUint16(ospf[12:14], checksum)
+
+	ipLayer := layers.IPv6{
+		Version:      uint8(6),
+		TrafficClass: uint8(0xc0),
+		Length:       uint16(len(ospf)),
+		NextHeader:   layers.IPProtocol(OSPF_PROTO_ID),
+		HopLimit:     uint8(OSPFV3_HOP_LIMIT),
+		SrcIP:        intf.IfLinkLocalAddr,
+		DstIP:        dstIp,
+	}
+	ethLayer := layers.Ethernet{
+		SrcMAC:       intf.IfMacAddr,
+		DstMAC:       dstMac,
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{
+		FixLengths: true,
+	}
+	gopacket.SerializeLayers(buffer, options, &ethLayer, &ipLayer, gopacket.Payload(ospf))
+	return buffer.Bytes()
+}
+
+func (server *OSPFServer) sendOspfv3Pkt(intf *Ospfv3Intf, pktType OspfType, body []byte,
+	dstIp net.IP, dstMac net.HardwareAddr) {
+	if intf.TxHdl.SendPcapHdl == nil || intf.IfLinkLocalAddr == nil {
+		server.logger.Err(fmt.Sprintln("OSPFV3: No tx handle or link local address on", intf.IfName))
+		return
+	}
+	pkt := server.buildOspfv3Pkt(intf, pktType, body, dstIp, dstMac)
+	intf.TxHdl.SendMutex.Lock()
+	err := intf.TxHdl.SendPcapHdl.WritePacketData(pkt)
+	intf.TxHdl.SendMutex.Unlock()
+	if err != nil {
+		server.logger.Err(fmt.Sprintln("OSPFV3: Failed to send packet on", intf.IfName, err))
+	}
+}
+
+/*
+Flooded packets go to AllSPFRouters from the DR, the BDR and on
+point-to-point links, and to AllDRouters from everybody else.
+*/
+func (server *OSPFServer) getOspfv3FloodDst(intf *Ospfv3Intf) (net.IP, net.HardwareAddr) {
+	if intf.IfFSMState == config.OtherDesignatedRouter {
+		return ALLDROUTERV6, ALLDROUTERV6MAC
+	}
+	return ALLSPFROUTERV6, ALLSPFROUTERV6MAC
+}
+
+func (server *OSPFServer) sendOspfv3Unicast(intf *Ospfv3Intf, nbr *Ospfv3Nbr, pktType OspfType, body []byte) {
+	if intf.IfType == config.NumberedP2P || intf.IfType == config.UnnumberedP2P {
+		server.sendOspfv3Pkt(intf, pktType, body, ALLSPFROUTERV6, ALLSPFROUTERV6MAC)
+		return
+	}
+	server.sendOspfv3Pkt(intf, pktType, body, nbr.Addr, nbr.MacAddr)
+}
+
+func (server *OSPFServer) StartOspfv3RecvPkts(ifIndex int32, rxHdl IntfRxHandle) {
+	recv := gopacket.NewPacketSource(rxHdl.RecvPcapHdl, layers.LayerTypeEthernet)
+	in := recv.Packets()
+	for {
+		select {
+		case packet, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			msg, err := decodeOspfv3RecvPkt(ifIndex, packet)
+			if err != nil {
+				continue
+			}
+			select {
+			case server.Ospfv3RxPktCh <- msg:
+			case <-rxHdl.PktRecvCh:
+				server.logger.Info("OSPFV3: Stopping the Recv packet thread")
+				rxHdl.PktRecvStatusCh <- false
+				return
+			}
+		case state := <-rxHdl.PktRecvCh:
+			if state == false {
+				server.logger.Info("OSPFV3: Stopping the Recv packet thread")
+				rxHdl.PktRecvStatusCh <- false
+				return
+			}
+		}
+	}
+}
+
+func (server *OSPFServer) StopOspfv3RecvPkts(rxHdl IntfRxHandle) {
+	select {
+	case rxHdl.PktRecvCh <- false:
+	case <-time.After(time.Second):
+		server.logger.Err("OSPFV3: Unable to stop the Rx thread")
+		return
+	}
+	select {
+	case <-rxHdl.PktRecvStatusCh:
+		server.logger.Info("OSPFV3: Stopped Recv Pkt thread")
+	case <-time.After(time.Second):
+		server.logger.Err("OSPFV3: Unable to stop the Rx thread")
+	}
+}
+
+/*
+Runs on the receive thread; only strips the L2 and IPv6 headers,
+the main loop does the rest.
+*/
+func decodeOspfv3RecvPkt(ifIndex int32, pkt gopacket.Packet) (msg ospfv3RxPktMsg, err error) {
+	ethLayer := pkt.Layer(layers.LayerTypeEthernet)
+	if ethLayer == nil {
+		return msg, errors.New("Not an Ethernet frame")
+	}
+	eth := ethLayer.(*layers.Ethernet)
+	ipLayer := pkt.Layer(layers.LayerTypeIPv6)
+	if ipLayer == nil {
+		return msg, errors.New("Not an IPv6 packet")
+	}
+	ip6 := ipLayer.(*layers.IPv6)
+	if ip6.NextHeader != layers.IPProtocol(OSPF_PROTO_ID) {
+		return msg, errors.New("Not an OSPF packet")
+	}
+	msg = ospfv3RxPktMsg{
+		ifIndex: ifIndex,
+		srcIp:   ip6.SrcIP,
+		dstIp:   ip6.DstIP,
+		srcMac:  eth.SrcMAC,
+		data:    ip6.LayerPayload(),
+	}
+	return msg, nil
+}
+
+/*
+@fn processOspfv3RxPkt
+RFC 5340 4.2.2: validate the header and dispatch the packet.
+*/
+func (server *OSPFServer) processOspfv3RxPkt(msg ospfv3RxPktMsg) error {
+	intf, exist := server.Ospfv3IntfMap[msg.ifIndex]
+	if !exist || intf.IfFSMState <= config.Down {
+		return errors.New("Interface is not running OSPFv3")
+	}
+	hdr, err := decodeOspfv3Header(msg.data)
+	if err != nil {
+		return err
+	}
+	data := msg.data[:hdr.pktLen]
+	if computeOspfv3Checksum(msg.srcIp, msg.dstIp, data) != 0 {
+		return errors.New("Invalid OSPFv3 checksum")
+	}
+	if hdr.instanceId != intf.IfInstanceId {
+		return errors.New("Instance id mismatch")
+	}
+	if hdr.areaId != intf.IfAreaId {
+		return errors.New("Area id mismatch")
+	}
+	if hdr.routerId == server.ospfv3GlobalConf.RouterId {
+		return errors.New("Packet sent by this router")
+	}
+	if !msg.srcIp.IsLinkLocalUnicast() {
+		return errors.New("Source address is not link local")
+	}
+	if msg.dstIp.Equal(ALLDROUTERV6) &&
+		intf.IfFSMState != config.DesignatedRouter &&
+		intf.IfFSMState != config.BackupDesignatedRouter {
+		return errors.New("AllDRouters packet on non DR interface")
+	}
+	body := data[OSPFV3_HEADER_SIZE:]
+	if hdr.pktType == HelloType {
+		return server.processOspfv3Hello(intf, hdr, msg, body)
+	}
+	nbr, exist := intf.Nbrs[hdr.routerId]
+	if !exist {
+		return errors.New("No such neighbor")
+	}
+	switch hdr.pktType {
+	case DBDescriptionType:
+		err = server.processOspfv3DD(intf, nbr, body)
+	case LSRequestType:
+		err = server.processOspfv3LSReq(intf, nbr, body)
+	case LSUpdateType:
+		err = server.processOspfv3LSUpd(intf, nbr, body)
+	case LSAckType:
+		err = server.processOspfv3LSAck(intf, nbr, body)
+	default:
+		err = errors.New("Invalid Ospf packet type")
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func TestOspfv3PktEncodeDecode(t *testing.T) {
+	hdr := Ospfv3Header{
+		pktType:    HelloType,
+		pktLen:     OSPFV3_HEADER_SIZE + OSPFV3_HELLO_MIN_SIZE + 4,
+		routerId:   0x01010101,
+		areaId:     1,
+		instanceId: 0,
+	}
+	hello := Ospfv3HelloPkt{
+		IfId:            5,
+		RtrPriority:     1,
+		Options:         Ospfv3V6Option | Ospfv3EOption | Ospfv3ROption,
+		HelloInterval:   10,
+		RtrDeadInterval: 40,
+		DRtrId:          0x02020202,
+		Nbrs:            []uint32{0x02020202},
+	}
+	pkt := append(encodeOspfv3Header(hdr), encodeOspfv3HelloPkt(hello)...)
+	rxHdr, err := decodeOspfv3Header(pkt)
+	if err != nil || rxHdr != hdr {
+		t.Error("Failed to decode OSPFv3 header", rxHdr, err)
+	}
+	rxHello, err := decodeOspfv3HelloPkt(pkt[OSPFV3_HEADER_SIZE:])
+	if err != nil || rxHello.IfId != hello.IfId || rxHello.Options != hello.Options ||
+		rxHello.DRtrId != hello.DRtrId || len(rxHello.Nbrs) != 1 || rxHello.Nbrs[0] != 0x02020202 {
+		t.Error("Failed to decode OSPFv3 hello", rxHello, err)
+	}
+
+	pkt[0] = 2
+	_, err = decodeOspfv3Header(pkt)
+	if err == nil {
+		t.Error("OSPFv2 packet accepted as OSPFv3")
+	}
+
+	dd := Ospfv3DDPkt{
+		Options: Ospfv3V6Option | Ospfv3ROption,
+		Mtu:     1500,
+		Flags:   Ospfv3DDMBit | Ospfv3DDMSBit,
+		SeqNum:  100,
+		LsaHdrs: []Ospfv3LsaHeader{
+			{LSAge: 1, LSType: Ospfv3RouterLSA, LSId: 0, AdvRouter: 0x01010101,
+				LSSequenceNum: 0x80000001, LSChecksum: 0x1234, LSLen: 40},
+		},
+	}
+	rxDD, err := decodeOspfv3DDPkt(encodeOspfv3DDPkt(dd))
+	if err != nil || rxDD.Mtu != dd.Mtu || rxDD.Flags != dd.Flags || rxDD.SeqNum != dd.SeqNum ||
+		len(rxDD.LsaHdrs) != 1 || rxDD.LsaHdrs[0] != dd.LsaHdrs[0] {
+		t.Error("Failed to decode OSPFv3 database description", rxDD, err)
+	}
+
+	keys := []Ospfv3LsaKey{dd.LsaHdrs[0].key()}
+	rxKeys, err := decodeOspfv3LSAReqPkt(encodeOspfv3LSAReqPkt(keys))
+	if err != nil || len(rxKeys) != 1 || rxKeys[0] != keys[0] {
+		t.Error("Failed to decode OSPFv3 link state request", rxKeys, err)
+	}
+	rxHdrs, err := decodeOspfv3LSAckPkt(encodeOspfv3LSAckPkt(dd.LsaHdrs))
+	if err != nil || len(rxHdrs) != 1 || rxHdrs[0] != dd.LsaHdrs[0] {
+		t.Error("Failed to decode OSPFv3 link state ack", rxHdrs, err)
+	}
+}
+
+func TestOspfv3Checksum(t *testing.T) {
+	srcIp := net.ParseIP("fe80::1")
+	hdr := Ospfv3Header{
+		pktType:  HelloType,
+		pktLen:   OSPFV3_HEADER_SIZE + OSPFV3_HELLO_MIN_SIZE,
+		routerId: 0x01010101,
+	}
+	hello := Ospfv3HelloPkt{
+		IfId:            5,
+		HelloInterval:   10,
+		RtrDeadInterval: 40,
+	}
+	pkt := append(encodeOspfv3Header(hdr), encodeOspfv3HelloPkt(hello)...)
+	checksum := computeOspfv3Checksum(srcIp, ALLSPFROUTERV6, pkt)
+	pkt[12] = byte(checksum >> 8)
+	pkt[13] = byte(checksum)
+	if computeOspfv3Checksum(srcIp, ALLSPFROUTERV6, pkt) != 0 {
+		t.Error("OSPFv3 checksum does not verify")
+	}
+	if computeOspfv3Checksum(net.ParseIP("fe80::2"), ALLSPFROUTERV6, pkt) == 0 {
+		t.Error("OSPFv3 checksum does not cover the pseudo header")
+	}
+}
+
+func TestOspfv3LsaEncodeDecode(t *testing.T) {
+	_, ipNet, _ := net.ParseCIDR("2001:db8:1::/64")
+	prefix := ospfv3PrefixFromIPNet(ipNet)
+	prefix.Metric = 10
+	body := encodeOspfv3IntraAreaPrefixLsa(Ospfv3IntraAreaPrefixLsa{
+		RefLSType:    Ospfv3RouterLSA,
+		RefAdvRouter: 0x01010101,
+		Prefixes:     []Ospfv3Prefix{prefix},
+	})
+	hdr := Ospfv3LsaHeader{
+		LSType:        Ospfv3IntraAreaPrefixLSA,
+		AdvRouter:     0x01010101,
+		LSSequenceNum: uint32(InitialSequenceNumber),
+	}
+	data := buildOspfv3Lsa(hdr, body)
+	rxHdr, err := validateOspfv3Lsa(data)
+	if err != nil || int(rxHdr.LSLen) != len(data) {
+		t.Error("Failed to validate OSPFv3 LSA", rxHdr, err)
+	}
+	lsa, err := decodeOspfv3IntraAreaPrefixLsa(data[OSPFV3_LSA_HEADER_SIZE:])
+	if err != nil || len(lsa.Prefixes) != 1 || lsa.Prefixes[0].Metric != 10 {
+		t.Error("Failed to decode intra-area-prefix-LSA", lsa, err)
+	}
+	rxNet := lsa.Prefixes[0].ipNet()
+	if rxNet.String() != ipNet.String() {
+		t.Error("Prefix mismatch", rxNet.String(), ipNet.String())
+	}
+
+	data[len(data)-1] ^= 0xff
+	_, err = validateOspfv3Lsa(data)
+	if err == nil {
+		t.Error("LSA with bad checksum accepted")
+	}
+
+	newer := rxHdr
+	newer.LSSequenceNum++
+	if compareOspfv3Lsa(newer, rxHdr) != 1 || compareOspfv3Lsa(rxHdr, newer) != -1 {
+		t.Error("Sequence number comparison failed")
+	}
+	maxAge := rxHdr
+	maxAge.LSAge = 3600
+	if compareOspfv3Lsa(maxAge, rxHdr) != 1 || compareOspfv3Lsa(rxHdr, rxHdr) != 0 {
+		t.Error("Age comparison failed")
+	}
+}
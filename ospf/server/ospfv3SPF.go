@@ -0,0 +1,696 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"fmt"
+	"l3/ospf/config"
+	"net"
+	"ribd"
+	"strconv"
+)
+
+const OSPFV3_LS_INFINITY = 0xffffff
+
+type ospfv3Vertex struct {
+	key      VertexKey
+	distance uint32
+	flags    uint8
+	options  uint32
+	links    []Ospfv3RouterLink
+	attached []uint32
+	direct   bool
+	nextHops map[Ospfv3NextHop]bool
+}
+
+type Ospfv3RouteEnt struct {
+	Prefix    net.IPNet
+	PathType  PathType
+	AreaId    uint32
+	Cost      uint32
+	Type2Cost uint32
+	NextHops  map[Ospfv3NextHop]bool
+}
+
+func copyOspfv3NextHops(nextHops map[Ospfv3NextHop]bool) map[Ospfv3NextHop]bool {
+	newNextHops := make(map[Ospfv3NextHop]bool)
+	for nh, _ := range nextHops {
+		newNextHops[nh] = true
+	}
+	return newNextHops
+}
+
+func (server *OSPFServer) getOspfv3NbrLinkLocal(intf *Ospfv3Intf, rtrId uint32) string {
+	for key, ent := range intf.LinkLsdb {
+		if key.LSType != Ospfv3LinkLSA || key.AdvRouter != rtrId ||
+			ent.currentHdr().LSAge >= config.MaxAge {
+			continue
+		}
+		lsa, err := decodeOspfv3LinkLsa(ent.Data[OSPFV3_LSA_HEADER_SIZE:])
+		if err == nil {
+			return lsa.LinkLocalAddr.String()
+		}
+	}
+	if nbr, exist := intf.Nbrs[rtrId]; exist && nbr.Addr != nil {
+		return nbr.Addr.String()
+	}
+	return ""
+}
+
+/*
+@fn calcOspfv3NextHops
+RFC 2328 16.1.1: the root uses its own interfaces, routers on a
+network attached to the root are reached through their link
+local address and everything else inherits from the parent.
+*/
+func (server *OSPFServer) calcOspfv3NextHops(v *ospfv3Vertex, w *ospfv3Vertex,
+	link *Ospfv3RouterLink) map[Ospfv3NextHop]bool {
+	nextHops := make(map[Ospfv3NextHop]bool)
+	rtrId := server.ospfv3GlobalConf.RouterId
+	if v.key.Type == RouterVertex && v.key.ID == rtrId {
+		intf, exist := server.Ospfv3IntfMap[int32(link.IfId)]
+		if !exist {
+			return nextHops
+		}
+		nh := Ospfv3NextHop{
+			IfIndex: intf.IfIndex,
+		}
+		if w.key.Type == RouterVertex {
+			nh.NextHopIp = server.getOspfv3NbrLinkLocal(intf, w.key.ID)
+		}
+		nextHops[nh] = true
+		return nextHops
+	}
+	if v.key.Type == TNetworkVertex && v.direct {
+		for nh, _ := range v.nextHops {
+			intf, exist := server.Ospfv3IntfMap[nh.IfIndex]
+			if !exist {
+				continue
+			}
+			nextHops[Ospfv3NextHop{
+				IfIndex:   nh.IfIndex,
+				NextHopIp: server.getOspfv3NbrLinkLocal(intf, w.key.ID),
+			}] = true
+		}
+		return nextHops
+	}
+	return copyOspfv3NextHops(v.nextHops)
+}
+
+/*
+@fn runOspfv3Spf
+Dijkstra over the Router and Network LSAs of one area, RFC 5340
+4.8.1. Links are only used when both ends advertise them.
+*/
+func (server *OSPFServer) runOspfv3Spf(areaId uint32) map[VertexKey]*ospfv3Vertex {
+	spt := make(map[VertexKey]*ospfv3Vertex)
+	lsdb := server.Ospfv3AreaLsdb[areaId]
+	rtrId := server.ospfv3GlobalConf.RouterId
+	rtrLsas := make(map[uint32][]Ospfv3RouterLsa)
+	for key, ent := range lsdb {
+		if key.LSType != Ospfv3RouterLSA || ent.currentHdr().LSAge >= config.MaxAge {
+			continue
+		}
+		lsa, err := decodeOspfv3RouterLsa(ent.Data[OSPFV3_LSA_HEADER_SIZE:])
+		if err != nil {
+			continue
+		}
+		rtrLsas[key.AdvRouter] = append(rtrLsas[key.AdvRouter], lsa)
+	}
+	candidates := make(map[VertexKey]*ospfv3Vertex)
+	getRouterVertex := func(id uint32) *ospfv3Vertex {
+		vKey := VertexKey{
+			Type:   RouterVertex,
+			ID:     id,
+			AdvRtr: id,
+		}
+		if v, exist := candidates[vKey]; exist {
+			return v
+		}
+		lsas, exist := rtrLsas[id]
+		if !exist {
+			return nil
+		}
+		v := &ospfv3Vertex{
+			key: vKey,
+		}
+		for _, lsa := range lsas {
+			v.flags |= lsa.Flags
+			v.options |= lsa.Options
+			v.links = append(v.links, lsa.Links...)
+		}
+		return v
+	}
+	getNetworkVertex := func(dRtrId uint32, ifId uint32) *ospfv3Vertex {
+		vKey := VertexKey{
+			Type:   TNetworkVertex,
+			ID:     ifId,
+			AdvRtr: dRtrId,
+		}
+		if v, exist := candidates[vKey]; exist {
+			return v
+		}
+		ent, exist := lsdb[Ospfv3LsaKey{Ospfv3NetworkLSA, ifId, dRtrId}]
+		if !exist || ent.currentHdr().LSAge >= config.MaxAge {
+			return nil
+		}
+		lsa, err := decodeOspfv3NetworkLsa(ent.Data[OSPFV3_LSA_HEADER_SIZE:])
+		if err != nil {
+			return nil
+		}
+		return &ospfv3Vertex{
+			key:      vKey,
+			options:  lsa.Options,
+			attached: lsa.AttachedRtr,
+		}
+	}
+	relax := func(v *ospfv3Vertex, w *ospfv3Vertex, distance uint32, link *Ospfv3RouterLink) {
+		cur, exist := candidates[w.key]
+		if exist && distance > cur.distance {
+			return
+		}
+		nextHops := server.calcOspfv3NextHops(v, w, link)
+		if !exist || distance < cur.distance {
+			w.distance = distance
+			w.nextHops = nextHops
+			w.direct = v.key.Type == RouterVertex && v.key.ID == rtrId && w.key.Type == TNetworkVertex
+			candidates[w.key] = w
+			return
+		}
+		for nh, _ := range nextHops {
+			cur.nextHops[nh] = true
+		}
+	}
+
+	root := getRouterVertex(rtrId)
+	if root == nil {
+		return spt
+	}
+	root.nextHops = make(map[Ospfv3NextHop]bool)
+	candidates[root.key] = root
+	for len(candidates) > 0 {
+		var v *ospfv3Vertex
+		for _, c := range candidates {
+			if v == nil || c.distance < v.distance ||
+				(c.distance == v.distance && c.key.Type > v.key.Type) ||
+				(c.distance == v.distance && c.key.Type == v.key.Type && c.key.ID < v.key.ID) {
+				v = c
+			}
+		}
+		delete(candidates, v.key)
+		spt[v.key] = v
+		if v.key.Type == TNetworkVertex {
+			for _, id := range v.attached {
+				if _, done := spt[VertexKey{RouterVertex, id, id}]; done {
+					continue
+				}
+				w := getRouterVertex(id)
+				if w == nil {
+					continue
+				}
+				for _, link := range w.links {
+					if link.LinkType == Ospfv3TransitLink && link.NbrRtrId == v.key.AdvRtr &&
+						link.NbrIfId == v.key.ID {
+						relax(v, w, v.distance, nil)
+						break
+					}
+				}
+			}
+			continue
+		}
+		for i, link := range v.links {
+			var w *ospfv3Vertex
+			switch link.LinkType {
+			case Ospfv3P2PLink:
+				if _, done := spt[VertexKey{RouterVertex, link.NbrRtrId, link.NbrRtrId}]; done {
+					continue
+				}
+				w = getRouterVertex(link.NbrRtrId)
+				if w == nil {
+					continue
+				}
+				linkBack := false
+				for _, l := range w.links {
+					if l.LinkType == Ospfv3P2PLink && l.NbrRtrId == v.key.ID {
+						linkBack = true
+						break
+					}
+				}
+				if !linkBack {
+					continue
+				}
+			case Ospfv3TransitLink:
+				if _, done := spt[VertexKey{TNetworkVertex, link.NbrIfId, link.NbrRtrId}]; done {
+					continue
+				}
+				w = getNetworkVertex(link.NbrRtrId, link.NbrIfId)
+				if w == nil {
+					continue
+				}
+				attached := false
+				for _, id := range w.attached {
+					if id == v.key.ID {
+						attached = true
+						break
+					}
+				}
+				if !attached {
+					continue
+				}
+			default:
+				continue
+			}
+			relax(v, w, v.distance+uint32(link.Metric), &v.links[i])
+		}
+	}
+	return spt
+}
+
+func isBetterOspfv3Route(r1 *Ospfv3RouteEnt, r2 *Ospfv3RouteEnt) bool {
+	if r1.PathType != r2.PathType {
+		return r1.PathType > r2.PathType
+	}
+	if r1.PathType == Type2Ext && r1.Type2Cost != r2.Type2Cost {
+		return r1.Type2Cost < r2.Type2Cost
+	}
+	return r1.Cost < r2.Cost
+}
+
+/* Keeps the better route, equal cost paths are merged */
+func mergeOspfv3Route(cur *Ospfv3RouteEnt, ent *Ospfv3RouteEnt) *Ospfv3RouteEnt {
+	if cur == nil || isBetterOspfv3Route(ent, cur) {
+		return ent
+	}
+	if isBetterOspfv3Route(cur, ent) {
+		return cur
+	}
+	for nh, _ := range ent.NextHops {
+		cur.NextHops[nh] = true
+	}
+	return cur
+}
+
+func (server *OSPFServer) addOspfv3IntraAreaRoutes(routes map[string]*Ospfv3RouteEnt, areaId uint32,
+	spt map[VertexKey]*ospfv3Vertex) {
+	for key, ent := range server.Ospfv3AreaLsdb[areaId] {
+		if key.LSType != Ospfv3IntraAreaPrefixLSA || ent.currentHdr().LSAge >= config.MaxAge {
+			continue
+		}
+		lsa, err := decodeOspfv3IntraAreaPrefixLsa(ent.Data[OSPFV3_LSA_HEADER_SIZE:])
+		if err != nil || lsa.RefAdvRouter != key.AdvRouter {
+			continue
+		}
+		var vKey VertexKey
+		switch lsa.RefLSType {
+		case Ospfv3RouterLSA:
+			vKey = VertexKey{RouterVertex, lsa.RefAdvRouter, lsa.RefAdvRouter}
+		case Ospfv3NetworkLSA:
+			vKey = VertexKey{TNetworkVertex, lsa.RefLSId, lsa.RefAdvRouter}
+		default:
+			continue
+		}
+		v, exist := spt[vKey]
+		if !exist {
+			continue
+		}
+		for _, prefix := range lsa.Prefixes {
+			if prefix.PrefixOptions&Ospfv3PrefixNU != 0 {
+				continue
+			}
+			route := &Ospfv3RouteEnt{
+				Prefix:   prefix.ipNet(),
+				PathType: IntraArea,
+				AreaId:   areaId,
+				Cost:     v.distance + uint32(prefix.Metric),
+				NextHops: copyOspfv3NextHops(v.nextHops),
+			}
+			routes[route.Prefix.String()] = mergeOspfv3Route(routes[route.Prefix.String()], route)
+		}
+	}
+}
+
+/*
+@fn addOspfv3InterAreaRoutes
+RFC 2328 16.2: summaries are only examined in the backbone when
+we are an ABR.
+*/
+func (server *OSPFServer) addOspfv3InterAreaRoutes(routes map[string]*Ospfv3RouteEnt,
+	asbrs map[uint32]*Ospfv3RouteEnt, areaId uint32, spt map[VertexKey]*ospfv3Vertex) {
+	rtrId := server.ospfv3GlobalConf.RouterId
+	for key, ent := range server.Ospfv3AreaLsdb[areaId] {
+		if key.AdvRouter == rtrId || ent.currentHdr().LSAge >= config.MaxAge {
+			continue
+		}
+		if key.LSType != Ospfv3InterAreaPrefixLSA && key.LSType != Ospfv3InterAreaRouterLSA {
+			continue
+		}
+		abr, exist := spt[VertexKey{RouterVertex, key.AdvRouter, key.AdvRouter}]
+		if !exist || abr.flags&Ospfv3BBit == 0 {
+			continue
+		}
+		body := ent.Data[OSPFV3_LSA_HEADER_SIZE:]
+		if key.LSType == Ospfv3InterAreaPrefixLSA {
+			lsa, err := decodeOspfv3InterAreaPrefixLsa(body)
+			if err != nil || lsa.Metric >= OSPFV3_LS_INFINITY ||
+				lsa.Prefix.PrefixOptions&Ospfv3PrefixNU != 0 {
+				continue
+			}
+			route := &Ospfv3RouteEnt{
+				Prefix:   lsa.Prefix.ipNet(),
+				PathType: InterArea,
+				AreaId:   areaId,
+				Cost:     abr.distance + lsa.Metric,
+				NextHops: copyOspfv3NextHops(abr.nextHops),
+			}
+			routes[route.Prefix.String()] = mergeOspfv3Route(routes[route.Prefix.String()], route)
+			continue
+		}
+		lsa, err := decodeOspfv3InterAreaRouterLsa(body)
+		if err != nil || lsa.Metric >= OSPFV3_LS_INFINITY || lsa.DestRtr == rtrId {
+			continue
+		}
+		route := &Ospfv3RouteEnt{
+			PathType: InterArea,
+			AreaId:   areaId,
+			Cost:     abr.distance + lsa.Metric,
+			NextHops: copyOspfv3NextHops(abr.nextHops),
+		}
+		asbrs[lsa.DestRtr] = mergeOspfv3Route(asbrs[lsa.DestRtr], route)
+	}
+}
+
+func lookupOspfv3Route(routes map[string]*Ospfv3RouteEnt, ip net.IP) *Ospfv3RouteEnt {
+	var best *Ospfv3RouteEnt
+	bestLen := -1
+	for _, route := range routes {
+		if route.PathType != IntraArea && route.PathType != InterArea {
+			continue
+		}
+		ones, _ := route.Prefix.Mask.Size()
+		if ones > bestLen && route.Prefix.Contains(ip) {
+			best = route
+			bestLen = ones
+		}
+	}
+	return best
+}
+
+/* RFC 2328 16.4 */
+func (server *OSPFServer) addOspfv3ExternalRoutes(routes map[string]*Ospfv3RouteEnt,
+	asbrs map[uint32]*Ospfv3RouteEnt) {
+	rtrId := server.ospfv3GlobalConf.RouterId
+	var extRoutes []*Ospfv3RouteEnt
+	for key, ent := range server.Ospfv3ASLsdb {
+		if key.LSType != Ospfv3ASExternalLSA || key.AdvRouter == rtrId ||
+			ent.currentHdr().LSAge >= config.MaxAge {
+			continue
+		}
+		lsa, err := decodeOspfv3ASExternalLsa(ent.Data[OSPFV3_LSA_HEADER_SIZE:])
+		if err != nil || lsa.Metric >= OSPFV3_LS_INFINITY ||
+			lsa.Prefix.PrefixOptions&Ospfv3PrefixNU != 0 {
+			continue
+		}
+		asbr, exist := asbrs[key.AdvRouter]
+		if !exist {
+			continue
+		}
+		cost := asbr.Cost
+		nextHops := copyOspfv3NextHops(asbr.NextHops)
+		if lsa.Flags&Ospfv3ExtFBit != 0 && lsa.FwdAddr != nil && !lsa.FwdAddr.IsUnspecified() {
+			fwd := lookupOspfv3Route(routes, lsa.FwdAddr)
+			if fwd == nil {
+				continue
+			}
+			cost = fwd.Cost
+			nextHops = make(map[Ospfv3NextHop]bool)
+			for nh, _ := range fwd.NextHops {
+				if nh.NextHopIp == "" {
+					nh.NextHopIp = lsa.FwdAddr.String()
+				}
+				nextHops[nh] = true
+			}
+		}
+		route := &Ospfv3RouteEnt{
+			Prefix:   lsa.Prefix.ipNet(),
+			NextHops: nextHops,
+		}
+		if lsa.Flags&Ospfv3ExtEBit != 0 {
+			route.PathType = Type2Ext
+			route.Cost = cost
+			route.Type2Cost = lsa.Metric
+		} else {
+			route.PathType = Type1Ext
+			route.Cost = cost + lsa.Metric
+		}
+		extRoutes = append(extRoutes, route)
+	}
+	for _, route := range extRoutes {
+		routes[route.Prefix.String()] = mergeOspfv3Route(routes[route.Prefix.String()], route)
+	}
+}
+
+/*
+@fn calcOspfv3Spf
+Full routing table calculation: intra-area routes for every area,
+inter-area and AS external routes, then RIB update and summary
+origination.
+*/
+func (server *OSPFServer) calcOspfv3Spf() {
+	rtrId := server.ospfv3GlobalConf.RouterId
+	routes := make(map[string]*Ospfv3RouteEnt)
+	asbrs := make(map[uint32]*Ospfv3RouteEnt)
+	areas := server.getOspfv3ActiveAreas()
+	areaSpt := make(map[uint32]map[VertexKey]*ospfv3Vertex)
+	for areaId, _ := range areas {
+		spt := server.runOspfv3Spf(areaId)
+		areaSpt[areaId] = spt
+		server.addOspfv3IntraAreaRoutes(routes, areaId, spt)
+		for vKey, v := range spt {
+			if vKey.Type != RouterVertex || vKey.ID == rtrId || v.flags&Ospfv3EBit == 0 {
+				continue
+			}
+			asbr := &Ospfv3RouteEnt{
+				PathType: IntraArea,
+				AreaId:   areaId,
+				Cost:     v.distance,
+				NextHops: copyOspfv3NextHops(v.nextHops),
+			}
+			asbrs[vKey.ID] = mergeOspfv3Route(asbrs[vKey.ID], asbr)
+		}
+	}
+	for areaId, spt := range areaSpt {
+		if server.ospfv3GlobalConf.isABR && areaId != 0 {
+			continue
+		}
+		server.addOspfv3InterAreaRoutes(routes, asbrs, areaId, spt)
+	}
+	server.addOspfv3ExternalRoutes(routes, asbrs)
+	server.logger.Info(fmt.Sprintln("OSPFV3: SPF done, number of routes", len(routes)))
+	server.installOspfv3Routes(routes)
+	server.originateOspfv3Summaries(routes, asbrs, areas)
+}
+
+func isSameOspfv3Route(r1 *Ospfv3RouteEnt, r2 *Ospfv3RouteEnt) bool {
+	if r1.PathType != r2.PathType || r1.Cost != r2.Cost || r1.Type2Cost != r2.Type2Cost ||
+		len(r1.NextHops) != len(r2.NextHops) {
+		return false
+	}
+	for nh, _ := range r1.NextHops {
+		if !r2.NextHops[nh] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Routes towards our own prefixes or directly attached networks
+are left to the connected routes.
+*/
+func isOspfv3RouteInstallable(route *Ospfv3RouteEnt) bool {
+	if len(route.NextHops) == 0 {
+		return false
+	}
+	for nh, _ := range route.NextHops {
+		if nh.NextHopIp == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (server *OSPFServer) getOspfv3RibRoute(route *Ospfv3RouteEnt, nh Ospfv3NextHop) ribd.IPv6Route {
+	cost := route.Cost
+	if route.PathType == Type2Ext {
+		cost = route.Type2Cost
+	}
+	cfg := ribd.IPv6Route{
+		DestinationNw: route.Prefix.IP.String(),
+		Protocol:      "OSPF",
+		Cost:          int32(cost),
+		NetworkMask:   net.IP(route.Prefix.Mask).String(),
+	}
+	nextHopInfo := ribd.NextHopInfo{
+		NextHopIp:     nh.NextHopIp,
+		NextHopIntRef: strconv.Itoa(int(nh.IfIndex)),
+	}
+	cfg.NextHop = make([]*ribd.NextHopInfo, 0)
+	cfg.NextHop = append(cfg.NextHop, &nextHopInfo)
+	return cfg
+}
+
+func (server *OSPFServer) deleteOspfv3Route(route *Ospfv3RouteEnt) {
+	if !isOspfv3RouteInstallable(route) {
+		return
+	}
+	if server.ribdClient.ClientHdl == nil {
+		server.logger.Err("OSPFV3: Nil ribd handle. Can not delete route.")
+		return
+	}
+	for nh, _ := range route.NextHops {
+		cfg := server.getOspfv3RibRoute(route, nh)
+		server.logger.Info(fmt.Sprintln("OSPFV3: Deleting route", route.Prefix.String(), "nextHop", nh.NextHopIp))
+		_, err := server.ribdClient.ClientHdl.DeleteIPv6Route(&cfg)
+		if err != nil {
+			server.logger.Err(fmt.Sprintln("OSPFV3: Error deleting route:", err))
+		}
+	}
+}
+
+func (server *OSPFServer) installOspfv3Route(route *Ospfv3RouteEnt) {
+	if !isOspfv3RouteInstallable(route) {
+		return
+	}
+	if server.ribdClient.ClientHdl == nil {
+		server.logger.Err("OSPFV3: Nil ribd handle. Can not install route.")
+		return
+	}
+	for nh, _ := range route.NextHops {
+		cfg := server.getOspfv3RibRoute(route, nh)
+		server.logger.Info(fmt.Sprintln("OSPFV3: Installing route", route.Prefix.String(), "cost", cfg.Cost,
+			"nextHop", nh.NextHopIp, "ifIndex", nh.IfIndex))
+		_, err := server.ribdClient.ClientHdl.CreateIPv6Route(&cfg)
+		if err != nil {
+			server.logger.Err(fmt.Sprintln("OSPFV3: Error installing route:", err))
+		}
+	}
+}
+
+func (server *OSPFServer) installOspfv3Routes(routes map[string]*Ospfv3RouteEnt) {
+	for key, old := range server.Ospfv3RoutingTbl {
+		route, exist := routes[key]
+		if exist && isSameOspfv3Route(old, route) {
+			continue
+		}
+		server.deleteOspfv3Route(old)
+	}
+	for key, route := range routes {
+		old, exist := server.Ospfv3RoutingTbl[key]
+		if exist && isSameOspfv3Route(old, route) {
+			continue
+		}
+		server.installOspfv3Route(route)
+	}
+	server.Ospfv3RoutingTbl = routes
+}
+
+/* Link state ids of inter-area-prefix-LSAs stay the same for a prefix */
+func (server *OSPFServer) getOspfv3SummaryLsId(prefix string) uint32 {
+	if lsId, exist := server.ospfv3SummaryLsIdMap[prefix]; exist {
+		return lsId
+	}
+	server.ospfv3NextSummaryLsId++
+	server.ospfv3SummaryLsIdMap[prefix] = server.ospfv3NextSummaryLsId
+	return server.ospfv3NextSummaryLsId
+}
+
+/*
+@fn originateOspfv3Summaries
+RFC 2328 12.4.3 with the OSPFv3 LSA types. Stub areas get a
+default route and, with NoAreaSummary, nothing else.
+*/
+func (server *OSPFServer) originateOspfv3Summaries(routes map[string]*Ospfv3RouteEnt,
+	asbrs map[uint32]*Ospfv3RouteEnt, areas map[uint32]bool) {
+	rtrId := server.ospfv3GlobalConf.RouterId
+	for areaId, _ := range areas {
+		desired := make(map[Ospfv3LsaKey]bool)
+		if server.ospfv3GlobalConf.isABR {
+			server.originateOspfv3AreaSummaries(areaId, routes, asbrs, desired)
+		}
+		lsdb := server.Ospfv3AreaLsdb[areaId]
+		for key, ent := range lsdb {
+			if key.AdvRouter == rtrId && !desired[key] &&
+				(key.LSType == Ospfv3InterAreaPrefixLSA || key.LSType == Ospfv3InterAreaRouterLSA) {
+				server.ospfv3FlushLsa(lsdb, ent, areaId, nil)
+			}
+		}
+	}
+}
+
+func (server *OSPFServer) originateOspfv3InterAreaPrefix(areaId uint32, prefix net.IPNet, metric uint32,
+	desired map[Ospfv3LsaKey]bool) {
+	lsa := Ospfv3InterAreaPrefixLsa{
+		Metric: metric,
+		Prefix: ospfv3PrefixFromIPNet(&prefix),
+	}
+	lsId := server.getOspfv3SummaryLsId(prefix.String())
+	server.ospfv3OriginateLsa(Ospfv3InterAreaPrefixLSA, lsId, encodeOspfv3InterAreaPrefixLsa(lsa), areaId, nil)
+	desired[Ospfv3LsaKey{Ospfv3InterAreaPrefixLSA, lsId, server.ospfv3GlobalConf.RouterId}] = true
+}
+
+func (server *OSPFServer) originateOspfv3AreaSummaries(areaId uint32, routes map[string]*Ospfv3RouteEnt,
+	asbrs map[uint32]*Ospfv3RouteEnt, desired map[Ospfv3LsaKey]bool) {
+	stub := server.isOspfv3StubArea(areaId)
+	if stub {
+		conf := server.AreaConfMap[AreaConfKey{config.AreaId(convertUint32ToIPv4(areaId))}]
+		_, defRoute, _ := net.ParseCIDR("::/0")
+		server.originateOspfv3InterAreaPrefix(areaId, *defRoute, uint32(conf.StubDefaultCost), desired)
+		if conf.AreaSummary == config.NoAreaSummary {
+			return
+		}
+	}
+	for _, route := range routes {
+		if (route.PathType != IntraArea && route.PathType != InterArea) ||
+			route.AreaId == areaId || route.Cost >= OSPFV3_LS_INFINITY {
+			continue
+		}
+		server.originateOspfv3InterAreaPrefix(areaId, route.Prefix, route.Cost, desired)
+	}
+	if stub {
+		return
+	}
+	for asbrId, asbr := range asbrs {
+		if asbr.AreaId == areaId || asbr.Cost >= OSPFV3_LS_INFINITY {
+			continue
+		}
+		lsa := Ospfv3InterAreaRouterLsa{
+			Options: Ospfv3V6Option | Ospfv3EOption | Ospfv3ROption,
+			Metric:  asbr.Cost,
+			DestRtr: asbrId,
+		}
+		server.ospfv3OriginateLsa(Ospfv3InterAreaRouterLSA, asbrId, encodeOspfv3InterAreaRouterLsa(lsa),
+			areaId, nil)
+		desired[Ospfv3LsaKey{Ospfv3InterAreaRouterLSA, asbrId, server.ospfv3GlobalConf.RouterId}] = true
+	}
+}
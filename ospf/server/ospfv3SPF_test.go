@@ -0,0 +1,229 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"l3/ospf/config"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	v3TestRtrId    = uint32(0x01010101)
+	v3TestNbrRtrId = uint32(0x02020202)
+	v3TestDRtrId   = uint32(0x03030303)
+	v3TestIfIndex  = int32(10)
+	v3TestNbrIfId  = uint32(7)
+	v3TestNetIfId  = uint32(5)
+)
+
+func addOspfv3TestLsa(lsdb Ospfv3Lsdb, lsType uint16, lsId uint32, advRtr uint32, body []byte) {
+	hdr := Ospfv3LsaHeader{
+		LSType:        lsType,
+		LSId:          lsId,
+		AdvRouter:     advRtr,
+		LSSequenceNum: uint32(InitialSequenceNumber),
+	}
+	data := buildOspfv3Lsa(hdr, body)
+	lsdb[hdr.key()] = &Ospfv3LsaEnt{
+		Hdr:         decodeOspfv3LsaHeader(data),
+		Data:        data,
+		InstallTime: time.Now(),
+	}
+}
+
+func getOspfv3TestPrefix(cidr string, metric uint16) Ospfv3Prefix {
+	_, ipNet, _ := net.ParseCIDR(cidr)
+	prefix := ospfv3PrefixFromIPNet(ipNet)
+	prefix.Metric = metric
+	return prefix
+}
+
+/*
+We have a point-to-point link to the neighbor, which is attached
+to a broadcast network whose DR is a third router.
+*/
+func initOspfv3TestTopology() *Ospfv3Intf {
+	ospf = getServerObject()
+	ospf.ospfv3GlobalConf.RouterId = v3TestRtrId
+	ospf.ospfv3GlobalConf.AdminStat = config.Enabled
+	intf := &Ospfv3Intf{
+		IfIndex:         v3TestIfIndex,
+		IfName:          "fpPort10",
+		IfMtu:           1500,
+		IfType:          config.NumberedP2P,
+		IfFSMState:      config.P2P,
+		IfCost:          10,
+		IfLinkLocalAddr: net.ParseIP("fe80::1"),
+		IfPrefixes:      make(map[string]*net.IPNet),
+		Nbrs:            make(map[uint32]*Ospfv3Nbr),
+		LinkLsdb:        make(Ospfv3Lsdb),
+	}
+	intf.Nbrs[v3TestNbrRtrId] = &Ospfv3Nbr{
+		RtrId: v3TestNbrRtrId,
+		IfId:  v3TestNbrIfId,
+		Addr:  net.ParseIP("fe80::2"),
+		State: config.NbrFull,
+	}
+	ospf.Ospfv3IntfMap[v3TestIfIndex] = intf
+	addOspfv3TestLsa(intf.LinkLsdb, Ospfv3LinkLSA, v3TestNbrIfId, v3TestNbrRtrId,
+		encodeOspfv3LinkLsa(Ospfv3LinkLsa{
+			Options:       Ospfv3V6Option | Ospfv3ROption,
+			LinkLocalAddr: net.ParseIP("fe80::2"),
+		}))
+
+	lsdb := make(Ospfv3Lsdb)
+	ospf.Ospfv3AreaLsdb[0] = lsdb
+	addOspfv3TestLsa(lsdb, Ospfv3RouterLSA, 0, v3TestRtrId, encodeOspfv3RouterLsa(Ospfv3RouterLsa{
+		Options: Ospfv3V6Option | Ospfv3ROption,
+		Links: []Ospfv3RouterLink{
+			{Ospfv3P2PLink, 10, uint32(v3TestIfIndex), v3TestNbrIfId, v3TestNbrRtrId},
+		},
+	}))
+	addOspfv3TestLsa(lsdb, Ospfv3RouterLSA, 0, v3TestNbrRtrId, encodeOspfv3RouterLsa(Ospfv3RouterLsa{
+		Options: Ospfv3V6Option | Ospfv3ROption,
+		Links: []Ospfv3RouterLink{
+			{Ospfv3P2PLink, 10, v3TestNbrIfId, uint32(v3TestIfIndex), v3TestRtrId},
+			{Ospfv3TransitLink, 10, 8, v3TestNetIfId, v3TestDRtrId},
+		},
+	}))
+	addOspfv3TestLsa(lsdb, Ospfv3RouterLSA, 0, v3TestDRtrId, encodeOspfv3RouterLsa(Ospfv3RouterLsa{
+		Flags:   Ospfv3EBit,
+		Options: Ospfv3V6Option | Ospfv3ROption | Ospfv3EOption,
+		Links: []Ospfv3RouterLink{
+			{Ospfv3TransitLink, 1, v3TestNetIfId, v3TestNetIfId, v3TestDRtrId},
+		},
+	}))
+	addOspfv3TestLsa(lsdb, Ospfv3NetworkLSA, v3TestNetIfId, v3TestDRtrId, encodeOspfv3NetworkLsa(Ospfv3NetworkLsa{
+		Options:     Ospfv3V6Option | Ospfv3ROption,
+		AttachedRtr: []uint32{v3TestDRtrId, v3TestNbrRtrId},
+	}))
+	addOspfv3TestLsa(lsdb, Ospfv3IntraAreaPrefixLSA, 0, v3TestNbrRtrId,
+		encodeOspfv3IntraAreaPrefixLsa(Ospfv3IntraAreaPrefixLsa{
+			RefLSType:    Ospfv3RouterLSA,
+			RefAdvRouter: v3TestNbrRtrId,
+			Prefixes:     []Ospfv3Prefix{getOspfv3TestPrefix("2001:db8:2::/64", 1)},
+		}))
+	addOspfv3TestLsa(lsdb, Ospfv3IntraAreaPrefixLSA, v3TestNetIfId, v3TestDRtrId,
+		encodeOspfv3IntraAreaPrefixLsa(Ospfv3IntraAreaPrefixLsa{
+			RefLSType:    Ospfv3NetworkLSA,
+			RefLSId:      v3TestNetIfId,
+			RefAdvRouter: v3TestDRtrId,
+			Prefixes:     []Ospfv3Prefix{getOspfv3TestPrefix("2001:db8:3::/64", 0)},
+		}))
+	return intf
+}
+
+func TestOspfv3Spf(t *testing.T) {
+	initOspfv3TestTopology()
+	spt := ospf.runOspfv3Spf(0)
+	if len(spt) != 4 {
+		t.Error("Unexpected number of vertices in the SPF tree", len(spt))
+	}
+	nextHop := Ospfv3NextHop{
+		IfIndex:   v3TestIfIndex,
+		NextHopIp: "fe80::2",
+	}
+	v, exist := spt[VertexKey{RouterVertex, v3TestDRtrId, v3TestDRtrId}]
+	if !exist || v.distance != 20 || len(v.nextHops) != 1 || !v.nextHops[nextHop] {
+		t.Error("Wrong path to router behind the transit network", v)
+	}
+
+	ospf.calcOspfv3Spf()
+	expected := map[string]uint32{
+		"2001:db8:2::/64": 11,
+		"2001:db8:3::/64": 20,
+	}
+	for prefix, cost := range expected {
+		route, exist := ospf.Ospfv3RoutingTbl[prefix]
+		if !exist {
+			t.Error("No route for", prefix)
+			continue
+		}
+		if route.PathType != IntraArea || route.Cost != cost || !route.NextHops[nextHop] {
+			t.Error("Wrong route for", prefix, route)
+		}
+	}
+}
+
+func TestOspfv3SpfExternalRoute(t *testing.T) {
+	initOspfv3TestTopology()
+	addOspfv3TestLsa(ospf.Ospfv3ASLsdb, Ospfv3ASExternalLSA, 1, v3TestDRtrId,
+		encodeOspfv3ASExternalLsa(Ospfv3ASExternalLsa{
+			Flags:  Ospfv3ExtEBit,
+			Metric: 20,
+			Prefix: getOspfv3TestPrefix("2001:db8:100::/48", 0),
+		}))
+	ospf.calcOspfv3Spf()
+	route, exist := ospf.Ospfv3RoutingTbl["2001:db8:100::/48"]
+	if !exist || route.PathType != Type2Ext || route.Cost != 20 || route.Type2Cost != 20 {
+		t.Error("Wrong external route", route)
+	}
+
+	/* The link back from the neighbor is gone: nothing is reachable */
+	lsdb := ospf.Ospfv3AreaLsdb[0]
+	addOspfv3TestLsa(lsdb, Ospfv3RouterLSA, 0, v3TestNbrRtrId, encodeOspfv3RouterLsa(Ospfv3RouterLsa{
+		Options: Ospfv3V6Option | Ospfv3ROption,
+	}))
+	ospf.calcOspfv3Spf()
+	if len(ospf.Ospfv3RoutingTbl) != 0 {
+		t.Error("Routes installed without a bidirectional link", ospf.Ospfv3RoutingTbl)
+	}
+}
+
+func TestOspfv3DRElection(t *testing.T) {
+	ospf = getServerObject()
+	ospf.ospfv3GlobalConf.RouterId = v3TestRtrId
+	intf := &Ospfv3Intf{
+		IfIndex:       v3TestIfIndex,
+		IfType:        config.Broadcast,
+		IfFSMState:    config.Waiting,
+		IfRtrPriority: 1,
+		Nbrs:          make(map[uint32]*Ospfv3Nbr),
+		LinkLsdb:      make(Ospfv3Lsdb),
+	}
+	intf.Nbrs[v3TestNbrRtrId] = &Ospfv3Nbr{
+		RtrId:    v3TestNbrRtrId,
+		Priority: 1,
+		DRtrId:   v3TestNbrRtrId,
+		State:    config.NbrTwoWay,
+	}
+	intf.Nbrs[v3TestDRtrId] = &Ospfv3Nbr{
+		RtrId:    v3TestDRtrId,
+		Priority: 0,
+		State:    config.NbrTwoWay,
+	}
+	ospf.electOspfv3DR(intf)
+	if intf.IfDRtrId != v3TestNbrRtrId || intf.IfBDRtrId != v3TestRtrId ||
+		intf.IfFSMState != config.BackupDesignatedRouter {
+		t.Error("Wrong DR election result", convertUint32ToIPv4(intf.IfDRtrId),
+			convertUint32ToIPv4(intf.IfBDRtrId), intf.IfFSMState)
+	}
+	for _, nbr := range intf.Nbrs {
+		if nbr.State != config.NbrExchangeStart {
+			t.Error("BDR did not start forming an adjacency with", convertUint32ToIPv4(nbr.RtrId))
+		}
+	}
+}
@@ -32,10 +32,15 @@ import (
 	"git.apache.org/thrift.git/lib/go/thrift"
 	nanomsg "github.com/op/go-nanomsg"
 	"io/ioutil"
+	"l3/bgp/bgpdCommonDefs"
 	"l3/ospf/config"
+	"l3/ospf/ospfdCommonDefs"
+	"os"
+	"os/signal"
 	"ribd"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 	"utils/dbutils"
 	"utils/ipcutils"
@@ -81,6 +86,10 @@ type OSPFServer struct {
 	AreaConfigCh       chan config.AreaConf
 	IntfConfigCh       chan config.InterfaceConf
 	IfMetricConfCh     chan config.IfMetricConf
+	KeyChainConfigCh   chan config.KeyChainConf
+	KeyChainDeleteCh   chan string
+	VirtIfConfigCh     chan VirtIfConfigMsg
+	VirtIfDeleteCh     chan config.VirtIfConf
 	GlobalConfigRetCh  chan error
 	AreaConfigRetCh    chan error
 	IntfConfigRetCh    chan error
@@ -106,8 +115,23 @@ type OSPFServer struct {
 	asicdSubSocket        *nanomsg.SubSocket
 	asicdSubSocketCh      chan []byte
 	asicdSubSocketErrCh   chan error
+	bgpdSubSocket         *nanomsg.SubSocket
+	bgpdSubSocketCh       chan []byte
+	bgpdSubSocketErrCh    chan error
+	lsdbPubSocket         *nanomsg.PubSocket
+	lsdbExportMap         map[lsdbExportKey]lsdbExportEnt
+	lsdbExportDirty       map[lsdbExportKey]bool
+	lsdbExportPending     [][]byte
+	lsdbExportSyncPending bool
+	lsdbExportSyncCnt     int
 	AreaConfMap           map[AreaConfKey]AreaConf
 	IntfConfMap           map[IntfConfKey]IntfConf
+	KeyChainMap           map[string]*KeyChain
+	VirtualLinkMap        map[VirtualLinkKey]VirtualLinkEnt
+	virtualLinkMutex      sync.RWMutex
+	VirtualLinkEventCh    chan bool
+	virtualLinkEvents     []VirtualLinkEvent
+	virtualLinkEventMutex sync.Mutex
 	IntfTxMap             map[IntfConfKey]IntfTxHandle
 	IntfRxMap             map[IntfConfKey]IntfRxHandle
 	NeighborConfigMap     map[NeighborConfKey]OspfNeighborEntry
@@ -155,6 +179,59 @@ type OSPFServer struct {
 
 	SummaryLsDb map[LsdbKey]SummaryLsaMap
 
+	NssaTranslatedLsDb map[LsaKey]ASExternalLsa
+	NssaTranslatedLsa  map[LsaKey]bool
+
+	GraceHelperMap      map[NeighborConfKey]GraceHelperEnt
+	graceHelperMutex    sync.Mutex
+	graceRestartChecked bool
+	graceRestartReason  uint8
+	graceRestartExpiry  time.Time
+	graceExtRouteQueue  []RouteMdata
+	GraceEventCh        chan bool
+	graceEvents         []GraceEvent
+	graceEventMutex     sync.Mutex
+
+	LinkOpaqueLsdb map[IntfConfKey]map[LsaKey]OpaqueLsa
+	OpaqueAppMap   map[OpaqueAppKey]OpaqueLsaHandler
+	opaqueAppMutex sync.RWMutex
+	OpaqueLsaCh    chan OpaqueLsaMsg
+
+	stubRouterChecked      bool
+	stubRouterExpiry       time.Time
+	stubRouterWaitBgp      bool
+	stubRouterBgpConverged bool
+	BgpConvergedCh         chan bool
+
+	spfThrottle     ospfThrottle
+	spfTimer        *time.Timer
+	spfPending      bool
+	spfTriggers     []string
+	spfLogSeq       int32
+	SpfLog          []config.SpfLogState
+	spfLogMutex     sync.RWMutex
+	lsaThrottleMap  map[lsaThrottleKey]lsaThrottleEnt
+	lsaArrivalMap   map[lsaArrivalKey]time.Time
+	lsaArrivalMutex sync.Mutex
+
+	AreaRoutingTbl map[AreaIdKey]AreaRoutingTbl
+	areaSpfDist    map[AreaIdKey]map[VertexKey]uint16
+	spfChange      spfChangeSet
+
+	Ospfv3GlobalConfigCh  chan config.Ospfv3GlobalConf
+	Ospfv3IntfConfigCh    chan config.Ospfv3IntfConf
+	Ospfv3IntfDeleteCh    chan int32
+	Ospfv3RxPktCh         chan ospfv3RxPktMsg
+	ospfv3Ticker          *time.Ticker
+	ospfv3TickCh          <-chan time.Time
+	ospfv3GlobalConf      Ospfv3GlobalConf
+	Ospfv3IntfMap         map[int32]*Ospfv3Intf
+	Ospfv3AreaLsdb        map[uint32]Ospfv3Lsdb
+	Ospfv3ASLsdb          Ospfv3Lsdb
+	Ospfv3RoutingTbl      map[string]*Ospfv3RouteEnt
+	ospfv3SummaryLsIdMap  map[string]uint32
+	ospfv3NextSummaryLsId uint32
+
 	StartCalcSPFCh chan bool
 	DoneCalcSPFCh  chan bool
 	AreaGraph      map[VertexKey]Vertex
@@ -175,6 +252,10 @@ func NewOSPFServer(logger *logging.Writer) *OSPFServer {
 	ospfServer.AreaConfigCh = make(chan config.AreaConf)
 	ospfServer.IntfConfigCh = make(chan config.InterfaceConf)
 	ospfServer.IfMetricConfCh = make(chan config.IfMetricConf)
+	ospfServer.KeyChainConfigCh = make(chan config.KeyChainConf)
+	ospfServer.KeyChainDeleteCh = make(chan string)
+	ospfServer.VirtIfConfigCh = make(chan VirtIfConfigMsg)
+	ospfServer.VirtIfDeleteCh = make(chan config.VirtIfConf)
 	ospfServer.GlobalConfigRetCh = make(chan error)
 	ospfServer.AreaConfigRetCh = make(chan error)
 	ospfServer.IntfConfigRetCh = make(chan error)
@@ -183,6 +264,9 @@ func NewOSPFServer(logger *logging.Writer) *OSPFServer {
 	ospfServer.ipPropertyMap = make(map[uint32]IpProperty)
 	ospfServer.AreaConfMap = make(map[AreaConfKey]AreaConf)
 	ospfServer.IntfConfMap = make(map[IntfConfKey]IntfConf)
+	ospfServer.KeyChainMap = make(map[string]*KeyChain)
+	ospfServer.VirtualLinkMap = make(map[VirtualLinkKey]VirtualLinkEnt)
+	ospfServer.VirtualLinkEventCh = make(chan bool, 1)
 	ospfServer.IntfTxMap = make(map[IntfConfKey]IntfTxHandle)
 	ospfServer.IntfRxMap = make(map[IntfConfKey]IntfRxHandle)
 	ospfServer.AreaLsdb = make(map[LsdbKey]LSDatabase)
@@ -234,15 +318,39 @@ func NewOSPFServer(logger *logging.Writer) *OSPFServer {
 
 	ospfServer.asicdSubSocketCh = make(chan []byte)
 	ospfServer.asicdSubSocketErrCh = make(chan error)
+	ospfServer.bgpdSubSocketCh = make(chan []byte)
+	ospfServer.bgpdSubSocketErrCh = make(chan error)
+	ospfServer.lsdbExportMap = make(map[lsdbExportKey]lsdbExportEnt)
+	ospfServer.lsdbExportDirty = make(map[lsdbExportKey]bool)
 
 	ospfServer.GlobalRoutingTbl = make(map[RoutingTblEntryKey]GlobalRoutingTblEntry)
 	ospfServer.OldGlobalRoutingTbl = make(map[RoutingTblEntryKey]GlobalRoutingTblEntry)
 	ospfServer.TempGlobalRoutingTbl = make(map[RoutingTblEntryKey]GlobalRoutingTblEntry)
 	//ospfServer.OldRoutingTbl = make(map[AreaIdKey]AreaRoutingTbl)
 	ospfServer.TempAreaRoutingTbl = make(map[AreaIdKey]AreaRoutingTbl)
+	ospfServer.NssaTranslatedLsa = make(map[LsaKey]bool)
+	ospfServer.GraceHelperMap = make(map[NeighborConfKey]GraceHelperEnt)
+	ospfServer.LinkOpaqueLsdb = make(map[IntfConfKey]map[LsaKey]OpaqueLsa)
+	ospfServer.OpaqueAppMap = make(map[OpaqueAppKey]OpaqueLsaHandler)
+	ospfServer.GraceEventCh = make(chan bool, 1)
+	ospfServer.OpaqueLsaCh = make(chan OpaqueLsaMsg)
+	ospfServer.BgpConvergedCh = make(chan bool, 1)
+	ospfServer.lsaThrottleMap = make(map[lsaThrottleKey]lsaThrottleEnt)
+	ospfServer.lsaArrivalMap = make(map[lsaArrivalKey]time.Time)
+	ospfServer.RegisterOpaqueLsaApp(LinkOpaqueLSA, GraceLsaOpaqueType, ospfServer.processGraceLsaEvent)
 	ospfServer.StartCalcSPFCh = make(chan bool)
 	ospfServer.DoneCalcSPFCh = make(chan bool)
 
+	ospfServer.Ospfv3GlobalConfigCh = make(chan config.Ospfv3GlobalConf)
+	ospfServer.Ospfv3IntfConfigCh = make(chan config.Ospfv3IntfConf)
+	ospfServer.Ospfv3IntfDeleteCh = make(chan int32)
+	ospfServer.Ospfv3RxPktCh = make(chan ospfv3RxPktMsg, 100)
+	ospfServer.Ospfv3IntfMap = make(map[int32]*Ospfv3Intf)
+	ospfServer.Ospfv3AreaLsdb = make(map[uint32]Ospfv3Lsdb)
+	ospfServer.Ospfv3ASLsdb = make(Ospfv3Lsdb)
+	ospfServer.Ospfv3RoutingTbl = make(map[string]*Ospfv3RouteEnt)
+	ospfServer.ospfv3SummaryLsIdMap = make(map[string]uint32)
+
 	return ospfServer
 }
 
@@ -317,6 +425,7 @@ func (server *OSPFServer) InitServer(paramFile string) {
 	server.logger.Info(fmt.Sprintln("Starting Ospf Server"))
 	server.initOspfGlobalConfDefault()
 	server.logger.Info(fmt.Sprintln("GlobalConf:", server.ospfGlobalConf))
+	server.initOspfv3GlobalConfDefault()
 	server.initAreaConfDefault()
 	server.logger.Info(fmt.Sprintln("AreaConf:", server.AreaConfMap))
 	server.initIntfStateSlice()
@@ -324,6 +433,11 @@ func (server *OSPFServer) InitServer(paramFile string) {
 	server.logger.Info("Listen for ASICd updates")
 	server.listenForASICdUpdates(asicdCommonDefs.PUB_SOCKET_ADDR)
 	go server.createASICdSubscriber()
+	server.logger.Info("Listen for BGPd updates")
+	if err := server.listenForBGPdUpdates(bgpdCommonDefs.PUB_SOCKET_ADDR); err == nil {
+		go server.createBGPdSubscriber()
+	}
+	server.lsdbPubSocket = server.initLsdbPublisher(ospfdCommonDefs.PUB_SOCKET_ADDR)
 
 	server.BuildOspfInfra()
 	err := server.InitializeDB()
@@ -331,6 +445,10 @@ func (server *OSPFServer) InitServer(paramFile string) {
 		server.logger.Err(fmt.Sprintln("DB Initialization faliure err:", err))
 	}
 	go server.StartDBListener()
+	sigChan := make(chan os.Signal, 1)
+	signalList := []os.Signal{syscall.SIGHUP}
+	signal.Notify(sigChan, signalList...)
+	go server.sigHandler(sigChan)
 	/*
 	   server.logger.Info("Listen for RIBd updates")
 	   server.listenForRIBUpdates(ribdCommonDefs.PUB_SOCKET_ADDR)
@@ -380,10 +498,46 @@ func (server *OSPFServer) StartServer(paramFile string) {
 			if err == nil {
 
 			}
+		case keyChainConf := <-server.KeyChainConfigCh:
+			server.logger.Info(fmt.Sprintln("Received call for performing Key Chain Configuration", keyChainConf.Name))
+			server.processKeyChainConfig(keyChainConf)
+		case keyChainName := <-server.KeyChainDeleteCh:
+			server.logger.Info(fmt.Sprintln("Received call for deleting Key Chain", keyChainName))
+			server.processKeyChainDelete(keyChainName)
+		case msg := <-server.VirtIfConfigCh:
+			server.logger.Info(fmt.Sprintln("Received call for performing Virtual Intf Configuration", msg.Conf))
+			msg.RetCh <- server.processVirtIfConfig(msg.Conf)
+		case virtIfConf := <-server.VirtIfDeleteCh:
+			server.logger.Info(fmt.Sprintln("Received call for deleting Virtual Intf", virtIfConf))
+			server.processVirtIfDelete(virtIfConf)
+		case <-server.VirtualLinkEventCh:
+			server.processVirtualLinkEvents()
+		case <-server.GraceEventCh:
+			server.processGraceEvents()
+		case gConf := <-server.Ospfv3GlobalConfigCh:
+			server.logger.Info(fmt.Sprintln("Received call for performing OSPFv3 Global Configuration", gConf))
+			server.processOspfv3GlobalConfig(gConf)
+		case ifConf := <-server.Ospfv3IntfConfigCh:
+			server.logger.Info(fmt.Sprintln("Received call for performing OSPFv3 Intf Configuration", ifConf))
+			server.processOspfv3IntfConfig(ifConf)
+		case ifIndex := <-server.Ospfv3IntfDeleteCh:
+			server.logger.Info(fmt.Sprintln("Received call for deleting OSPFv3 Intf", ifIndex))
+			server.processOspfv3IntfDelete(ifIndex)
+		case msg := <-server.Ospfv3RxPktCh:
+			err := server.processOspfv3RxPkt(msg)
+			if err != nil {
+				server.logger.Info(fmt.Sprintln("OSPFV3: Dropped packet on", msg.ifIndex, err))
+			}
+		case <-server.ospfv3TickCh:
+			server.processOspfv3Tick()
 		case asicdrxBuf := <-server.asicdSubSocketCh:
 			server.processAsicdNotification(asicdrxBuf)
 		case <-server.asicdSubSocketErrCh:
 
+		case bgpdrxBuf := <-server.bgpdSubSocketCh:
+			server.processBgpdNotification(bgpdrxBuf)
+		case <-server.bgpdSubSocketErrCh:
+
 		case ribrxBuf := <-server.ribSubSocketCh:
 			server.processRibdNotification(ribrxBuf)
 		/*
@@ -27,11 +27,13 @@ Ospf_packet.go
 package packettest
 
 import (
-	//  "encoding/hex"
+	"bytes"
+	"encoding/hex"
 	"fmt"
 	"l3/ospf/config"
 	"l3/ospf/server"
 	"net"
+	"strings"
 	"testing"
 	"utils/logging"
 )
@@ -52,3 +54,122 @@ func _TestOSPFDBDecode(t *testing.T) {
 	ospfServer.ProcessRxDbdPkt(data, ospfHeader, ipHdrMd, ifkey, srcmac)
 	fmt.Printf("Decode DB: Success")
 }
+
+/*
+HMAC-SHA test vectors from RFC 2202 and RFC 4231 which RFC 5709 uses for the
+cryptographic authentication.
+*/
+var hmacShaTestVectors = []struct {
+	algorithm string
+	key       string
+	data      string
+	digest    string
+}{
+	{config.HmacSha1, hex.EncodeToString([]byte("Jefe")), hex.EncodeToString([]byte("what do ya want for nothing?")),
+		"effcdf6ae5eb2fa2d27416d5f184df9c259a7c79"},
+	{config.HmacSha1, "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b", hex.EncodeToString([]byte("Hi There")),
+		"b617318655057264e28bc0b6fb378c8ef146be00"},
+	{config.HmacSha256, hex.EncodeToString([]byte("Jefe")), hex.EncodeToString([]byte("what do ya want for nothing?")),
+		"5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+	{config.HmacSha256, "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b", hex.EncodeToString([]byte("Hi There")),
+		"b0344c61d8db38535ca8afceaf0bf12b881dc200c9833da726e9376c2e32cff7"},
+	{config.HmacSha384, hex.EncodeToString([]byte("Jefe")), hex.EncodeToString([]byte("what do ya want for nothing?")),
+		"af45d2e376484031617f78d2b58a6b1b9c7ef464f5a01b47e42ec3736322445e8e2240ca5e69e2c78b3239ecfab21649"},
+	{config.HmacSha512, hex.EncodeToString([]byte("Jefe")), hex.EncodeToString([]byte("what do ya want for nothing?")),
+		"164b7a7bfcf819e2e395fbe73b56e0a387bd64222e831fd610270cd7ea250554" +
+			"9758bf75c05a994a6d034f65f8f0e6fdcaeab1a34d4a6b4b636e070a38bce737"},
+}
+
+/*
+RFC 5709 3.3 key vectors. A key as long as the hash is used as is, a longer
+key is replaced by its hash. The longer keys are shorter than the hash block
+size so the digests differ from plain HMAC, which only hashes keys longer
+than the block size.
+*/
+var hmacShaKeyTestVectors = []struct {
+	algorithm string
+	key       string
+	digest    string
+}{
+	{config.HmacSha1, "0102030405060708090a0b0c0d0e0f1011121314",
+		"4678a5e8b741181cbba299a2b8eedd4c0176b685"},
+	{config.HmacSha1, strings.Repeat("aa", 31),
+		"cb99b95889b608972823441883448d5c262e654a"},
+	{config.HmacSha256, "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20",
+		"8799776d00278ae6faae4414e4caa79554f7416ed8175f80af0f58ba959376d5"},
+	{config.HmacSha256, strings.Repeat("aa", 43),
+		"321e9e576c34d16f0dbabe9db1cc7177ab00ca183f85712affd82fc378f0a281"},
+	{config.HmacSha384, "0102030405060708090a0b0c0d0e0f101112131415161718" +
+		"191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f30",
+		"1abac11325bac6bd795fddd324185eeeb0a537f5045d01fe027c5d34c064f0fc68461ba799558f6235a637058f41ff85"},
+	{config.HmacSha384, strings.Repeat("aa", 59),
+		"eef3ea70b137e0b2e9524e689a852890d65e941e1bb79abc7f5bc2799f7dcb3dd94de24ca588a80aa35b4f4736c966a0"},
+	{config.HmacSha512, "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20" +
+		"2122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f40",
+		"1b586ed9157f15aa958108be11e9686067fcf7195eb5d149e0b2eaa85879dd1e" +
+			"99c91f6fa9b562567d7d3d6d88095c7eec3cf377281fdc2e20b554d3fd06f8ae"},
+	{config.HmacSha512, strings.Repeat("aa", 75),
+		"3b631391bd1ed1fffa8785e4c905a6235b03795aff123c81c5dabe38d3577d84" +
+			"e22233976ba91218c346edb1008fc04ec2119d07571a9b620eaef076379f0850"},
+}
+
+/*
+Hello packets authenticated with the key "ospf-key", key id 1 and sequence
+number 1. The digest is computed over the packet followed by Apad.
+*/
+var hmacShaApadTestVectors = []struct {
+	algorithm string
+	packet    string
+	digest    string
+}{
+	{config.HmacSha1, "0201002c0101010100000000000000020000011400000001ffffff00000a0201000000280000000000000000",
+		"b1fb28b2126cdea9eae2b04194ed8b8e9c89eabb"},
+	{config.HmacSha256, "0201002c0101010100000000000000020000012000000001ffffff00000a0201000000280000000000000000",
+		"026233927600efa592a360a3ef7289b509c7512045f9223ef811f9fbfa8631d4"},
+	{config.HmacSha384, "0201002c0101010100000000000000020000013000000001ffffff00000a0201000000280000000000000000",
+		"6ab0e814149536ec8f7c462df91cc78985f8c81b4639bf57498d6c8e2eb7b7ad0307ec1bdc48b93082b5658cc2c3b916"},
+	{config.HmacSha512, "0201002c0101010100000000000000020000014000000001ffffff00000a0201000000280000000000000000",
+		"0d7fd6d62acc5819b1202c21c355a41131c7162f7184225a4776c9663a81348c" +
+			"337ec4f12770f5ed1cd0fd958f229cad6bf297603de88204c90055da476fe16b"},
+}
+
+func TestOSPFHmacShaDigest(t *testing.T) {
+	for _, vector := range hmacShaTestVectors {
+		key, _ := hex.DecodeString(vector.key)
+		data, _ := hex.DecodeString(vector.data)
+		digest, _ := hex.DecodeString(vector.digest)
+		result := server.ComputeHmacShaDigest(vector.algorithm, key, data)
+		if !bytes.Equal(result, digest) {
+			t.Error(vector.algorithm, "digest", hex.EncodeToString(result), "expected", vector.digest)
+		}
+	}
+}
+
+func TestOSPFHmacShaKeyLength(t *testing.T) {
+	data := []byte("Test With Truncation")
+	for _, vector := range hmacShaKeyTestVectors {
+		key, _ := hex.DecodeString(vector.key)
+		digest, _ := hex.DecodeString(vector.digest)
+		result := server.ComputeHmacShaDigest(vector.algorithm, key, data)
+		if !bytes.Equal(result, digest) {
+			t.Error(vector.algorithm, "key length", len(key), "digest", hex.EncodeToString(result), "expected",
+				vector.digest)
+		}
+	}
+}
+
+func TestOSPFHmacShaApad(t *testing.T) {
+	for _, vector := range hmacShaApadTestVectors {
+		pkt, _ := hex.DecodeString(vector.packet)
+		digest, _ := hex.DecodeString(vector.digest)
+		apad := server.GetHmacShaApad(len(digest))
+		if hex.EncodeToString(apad) != strings.Repeat("878fe1f3", len(digest)/4) {
+			t.Error(vector.algorithm, "Apad", hex.EncodeToString(apad))
+			continue
+		}
+		result := server.ComputeHmacShaDigest(vector.algorithm, []byte("ospf-key"), append(pkt, apad...))
+		if !bytes.Equal(result, digest) {
+			t.Error(vector.algorithm, "digest", hex.EncodeToString(result), "expected", vector.digest)
+		}
+	}
+}
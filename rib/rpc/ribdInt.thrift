@@ -97,6 +97,17 @@ struct IPv4RouteConfig {
 	5 : bool NullRoute
 	6 : list<RouteNextHopInfo> NextHop
 }
+struct BackupNextHopConfig {
+	1 : string DestinationNw
+	2 : string NetworkMask
+	3 : string Protocol
+	4 : i32 Cost
+	5 : bool IsIPv6
+	6 : string NextHopIp
+	7 : string NextHopIntRef
+	8 : string BackupNextHopIp
+	9 : string BackupNextHopIntRef
+}
 struct IPv4Route {
 	1 : string DestinationNw
 	2 : string NetworkMask
@@ -155,6 +166,8 @@ service RIBDINTServices
 	int GetTotalv4RouteCount();
 	string Getv4RouteCreatedTime(1:int number);
 	oneway void OnewayCreateBulkIPv4Route(1: list<IPv4RouteConfig> config);
+	oneway void OnewaySetBackupNextHop(1: BackupNextHopConfig config);
+	oneway void OnewaySwitchToBackupNextHop(1: string nextHopIp);
 	bool CreatePolicyAction(1: PolicyAction config);
 	bool UpdatePolicyAction(1: PolicyAction origconfig, 2: PolicyAction newconfig, 3: list<bool> attrset, 4: list<PatchOpInfo> op);
 	bool DeletePolicyAction(1: PolicyAction config);
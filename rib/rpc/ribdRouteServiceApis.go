@@ -117,6 +117,30 @@ func (m RIBDServicesHandler) OnewayCreateBulkIPv4Route(cfg []*ribdInt.IPv4RouteC
 	return err
 }
 
+/*
+   Backup next hop APIs. The backup next hop of a route is kept by RIBd and the routes
+   are switched to their backup next hops with a single request when the next hop is
+   not reachable.
+*/
+func (m RIBDServicesHandler) OnewaySetBackupNextHop(cfg *ribdInt.BackupNextHopConfig) (err error) {
+	logger.Debug("OnewaySetBackupNextHop for ", cfg.DestinationNw, ":", cfg.NetworkMask, " backup next hop ",
+		cfg.BackupNextHopIp)
+	m.server.RouteConfCh <- server.RIBdServerConfig{
+		OrigConfigObject: cfg,
+		Op:               "setBackupNextHop",
+	}
+	return err
+}
+
+func (m RIBDServicesHandler) OnewaySwitchToBackupNextHop(nextHopIp string) (err error) {
+	logger.Info("OnewaySwitchToBackupNextHop for next hop ", nextHopIp)
+	m.server.RouteConfCh <- server.RIBdServerConfig{
+		OrigConfigObject: nextHopIp,
+		Op:               "switchToBackupNextHop",
+	}
+	return err
+}
+
 /*
    Delete Route
 */
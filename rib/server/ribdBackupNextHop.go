@@ -0,0 +1,152 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+// ribdBackupNextHop.go
+package server
+
+import (
+	"ribd"
+	"ribdInt"
+)
+
+/*
+   Backup next hops of the routes, keyed by the next hop of the route and the
+   destination network of the route. The backup next hop is installed in place of
+   the next hop of the route when the next hop is not reachable.
+*/
+var BackupNextHopMap map[string]map[string]*ribdInt.BackupNextHopConfig
+
+/*
+   Next hop of the route of each destination network with a backup next hop
+*/
+var BackupNextHopRouteMap map[string]string
+
+func getBackupNextHopRouteKey(cfg *ribdInt.BackupNextHopConfig) string {
+	return cfg.Protocol + ":" + cfg.DestinationNw + "/" + cfg.NetworkMask
+}
+
+/*
+   Set or remove the backup next hop of a route. The backup next hop is removed
+   if the backup next hop ip is not set.
+*/
+func (m RIBDServer) ProcessSetBackupNextHop(cfg *ribdInt.BackupNextHopConfig) {
+	routeKey := getBackupNextHopRouteKey(cfg)
+	if nextHopIp, ok := BackupNextHopRouteMap[routeKey]; ok {
+		delete(BackupNextHopMap[nextHopIp], routeKey)
+		if len(BackupNextHopMap[nextHopIp]) == 0 {
+			delete(BackupNextHopMap, nextHopIp)
+		}
+		delete(BackupNextHopRouteMap, routeKey)
+	}
+	if cfg.BackupNextHopIp == "" {
+		logger.Debug("ProcessSetBackupNextHop: removed backup next hop for ", routeKey)
+		return
+	}
+
+	if _, ok := BackupNextHopMap[cfg.NextHopIp]; !ok {
+		BackupNextHopMap[cfg.NextHopIp] = make(map[string]*ribdInt.BackupNextHopConfig)
+	}
+	BackupNextHopMap[cfg.NextHopIp][routeKey] = cfg
+	BackupNextHopRouteMap[routeKey] = cfg.NextHopIp
+	logger.Debug("ProcessSetBackupNextHop: route ", routeKey, " next hop ", cfg.NextHopIp, " backup next hop ",
+		cfg.BackupNextHopIp)
+}
+
+/*
+   Check if the route of the protocol to the destination network still uses the next hop
+*/
+func isRouteNextHopPresent(cfg *ribdInt.BackupNextHopConfig) bool {
+	destNet, err := getNetowrkPrefixFromStrings(cfg.DestinationNw, cfg.NetworkMask)
+	if err != nil {
+		logger.Err("isRouteNextHopPresent: getNetowrkPrefixFromStrings returned err ", err)
+		return false
+	}
+	routeInfoRecordListItem := RouteInfoMap.Get(destNet)
+	if routeInfoRecordListItem == nil {
+		return false
+	}
+	routeInfoRecordList := routeInfoRecordListItem.(RouteInfoRecordList)
+	for _, routeInfoRecord := range routeInfoRecordList.routeInfoProtocolMap[cfg.Protocol] {
+		if routeInfoRecord.nextHopIp.String() == cfg.NextHopIp {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+   Switch all the routes that use the next hop to their backup next hops. The backup
+   next hop is added before the next hop is removed so the destination stays reachable.
+   The backup next hops are removed once they are installed.
+*/
+func (m RIBDServer) ProcessSwitchToBackupNextHop(nextHopIp string) {
+	backupCfgs, ok := BackupNextHopMap[nextHopIp]
+	if !ok {
+		logger.Info("ProcessSwitchToBackupNextHop: no backup next hops for next hop ", nextHopIp)
+		return
+	}
+	delete(BackupNextHopMap, nextHopIp)
+
+	count := 0
+	for routeKey, cfg := range backupCfgs {
+		delete(BackupNextHopRouteMap, routeKey)
+		if !isRouteNextHopPresent(cfg) {
+			logger.Debug("ProcessSwitchToBackupNextHop: route ", routeKey, " doesn't use next hop ", nextHopIp)
+			continue
+		}
+
+		backupIntRef, err := m.ConvertIntfStrToIfIndexStr(cfg.BackupNextHopIntRef)
+		if err != nil {
+			logger.Err("ProcessSwitchToBackupNextHop: route ", routeKey, " invalid backup next hop IntRef ",
+				cfg.BackupNextHopIntRef)
+			continue
+		}
+		backupNextHop := &ribd.NextHopInfo{NextHopIp: cfg.BackupNextHopIp, NextHopIntRef: backupIntRef}
+		nextHop := &ribd.NextHopInfo{NextHopIp: cfg.NextHopIp, NextHopIntRef: cfg.NextHopIntRef}
+		if cfg.IsIPv6 {
+			route := ribd.IPv6Route{
+				DestinationNw: cfg.DestinationNw,
+				NetworkMask:   cfg.NetworkMask,
+				Protocol:      cfg.Protocol,
+				Cost:          cfg.Cost,
+			}
+			route.NextHop = []*ribd.NextHopInfo{backupNextHop}
+			m.ProcessV6RouteCreateConfig(&route)
+			route.NextHop = []*ribd.NextHopInfo{nextHop}
+			m.ProcessV6RouteDeleteConfig(&route)
+		} else {
+			route := ribd.IPv4Route{
+				DestinationNw: cfg.DestinationNw,
+				NetworkMask:   cfg.NetworkMask,
+				Protocol:      cfg.Protocol,
+				Cost:          cfg.Cost,
+			}
+			route.NextHop = []*ribd.NextHopInfo{backupNextHop}
+			m.ProcessV4RouteCreateConfig(&route)
+			route.NextHop = []*ribd.NextHopInfo{nextHop}
+			m.ProcessV4RouteDeleteConfig(&route)
+		}
+		count++
+	}
+	logger.Info("ProcessSwitchToBackupNextHop: switched ", count, " routes from next hop ", nextHopIp)
+}
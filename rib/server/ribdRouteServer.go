@@ -26,6 +26,7 @@ package server
 
 import (
 	"ribd"
+	"ribdInt"
 )
 
 func (ribdServiceHandler *RIBDServer) StartRouteProcessServer() {
@@ -38,6 +39,10 @@ func (ribdServiceHandler *RIBDServer) StartRouteProcessServer() {
 				ribdServiceHandler.ProcessV4RouteCreateConfig(routeConf.OrigConfigObject.(*ribd.IPv4Route))
 			} else if routeConf.Op == "addBulk" {
 				ribdServiceHandler.ProcessBulkRouteCreateConfig(routeConf.OrigBulkRouteConfigObject) //.([]*ribd.IPv4Route))
+			} else if routeConf.Op == "setBackupNextHop" {
+				ribdServiceHandler.ProcessSetBackupNextHop(routeConf.OrigConfigObject.(*ribdInt.BackupNextHopConfig))
+			} else if routeConf.Op == "switchToBackupNextHop" {
+				ribdServiceHandler.ProcessSwitchToBackupNextHop(routeConf.OrigConfigObject.(string))
 			} else if routeConf.Op == "del" {
 				ribdServiceHandler.ProcessV4RouteDeleteConfig(routeConf.OrigConfigObject.(*ribd.IPv4Route))
 			} else if routeConf.Op == "update" {
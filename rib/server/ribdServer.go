@@ -521,6 +521,8 @@ func NewRIBDServicesHandler(dbHdl *dbutils.DBUtil, loggerC *logging.Writer) *RIB
 	ReverseRouteProtoTypeMapDB = make(map[int]string)
 	ProtocolAdminDistanceMapDB = make(map[string]RouteDistanceConfig)
 	PublisherInfoMap = make(map[string]PublisherMapInfo)
+	BackupNextHopMap = make(map[string]map[string]*ribdInt.BackupNextHopConfig)
+	BackupNextHopRouteMap = make(map[string]string)
 	ribdServicesHandler.NextHopInfoMap = make(map[NextHopInfoKey]NextHopInfo)
 	ribdServicesHandler.TrackReachabilityCh = make(chan TrackReachabilityInfo, 1000)
 	ribdServicesHandler.RouteConfCh = make(chan RIBdServerConfig, 30000)